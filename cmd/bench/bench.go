@@ -0,0 +1,197 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"paqet/internal/bootstrap"
+	"paqet/internal/client"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/pkg/buffer"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPath string
+	count    int
+	size     int
+	asJSON   bool
+)
+
+// echoSize is the size of each RTT message, about that of an interactive
+// keystroke or small request.
+const echoSize = 64
+
+func init() {
+	Cmd.Flags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the client configuration file.")
+	Cmd.Flags().IntVar(&count, "count", 20, "Number of stream opens and round trips to time.")
+	Cmd.Flags().IntVar(&size, "size", 16<<20, "Bytes to send and to receive for the throughput tests (max 64 MiB).")
+	Cmd.Flags().BoolVar(&asJSON, "json", false, "Print the results as JSON.")
+}
+
+// Latency summarizes a set of timings.
+type Latency struct {
+	Samples int           `json:"samples"`
+	Min     time.Duration `json:"min_ns"`
+	P50     time.Duration `json:"p50_ns"`
+	P90     time.Duration `json:"p90_ns"`
+	P99     time.Duration `json:"p99_ns"`
+	Max     time.Duration `json:"max_ns"`
+}
+
+// Throughput is the result of one bulk transfer.
+type Throughput struct {
+	Bytes    int           `json:"bytes"`
+	Duration time.Duration `json:"duration_ns"`
+	Mbps     float64       `json:"mbps"`
+}
+
+type report struct {
+	Server    string     `json:"server"`
+	Transport string     `json:"transport"`
+	Open      Latency    `json:"stream_open"`
+	RTT       Latency    `json:"rtt"`
+	Upload    Throughput `json:"upload"`
+	Download  Throughput `json:"download"`
+}
+
+var Cmd = &cobra.Command{
+	Use:   "bench [flags]",
+	Short: "Measures latency and throughput to a server.",
+	Long:  `Connects to the server of a client configuration like 'run' would, without starting its listeners, and measures how long opening a stream takes, the round-trip time of small messages on an open stream, and the throughput of a --size upload and download. Latencies are reported as percentiles over --count samples.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if count < 1 {
+			log.Fatalf("--count must be at least 1")
+		}
+		if size < 1 || size > conf.MaxProbeBytes {
+			log.Fatalf("--size must be between 1 and %d bytes", conf.MaxProbeBytes)
+		}
+		cfg, err := conf.LoadFromFile(confPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		if cfg.Role != "client" {
+			log.Fatalf("Bench command requires client configuration")
+		}
+		// Keep the report readable: only warnings and errors are logged.
+		if l := flog.Level(cfg.Log.Level); l == flog.None || l >= flog.Warn {
+			flog.SetLevel(cfg.Log.Level)
+		} else {
+			flog.SetLevel(int(flog.Warn))
+		}
+		buffer.Initialize(cfg.Transport.TCPBuf, cfg.Transport.UDPBuf, cfg.Transport.TUNBuf)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if cfg.BootstrapPending() {
+			if err := bootstrap.Resolve(ctx, cfg); err != nil {
+				log.Fatalf("Bootstrap failed: %v", err)
+			}
+		}
+		c, err := client.New(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize client: %v", err)
+		}
+		if err := c.Start(ctx); err != nil {
+			log.Fatalf("Failed to start client: %v", err)
+		}
+
+		r := report{Server: cfg.Server.Addr.String(), Transport: cfg.Transport.Protocol}
+		r.Open = timeOpens(ctx, c)
+		r.RTT = timeEchoes(ctx, c)
+		r.Upload = transfer(ctx, "upload", c.BenchUpload)
+		r.Download = transfer(ctx, "download", c.BenchDownload)
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(r)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Server:\t%s (%s)\n", r.Server, r.Transport)
+		fmt.Fprintf(w, "\tmin\tp50\tp90\tp99\tmax\n")
+		for _, l := range []struct {
+			name string
+			l    Latency
+		}{{"Stream open", r.Open}, {"RTT", r.RTT}} {
+			fmt.Fprintf(w, "%s:\t%s\t%s\t%s\t%s\t%s\n", l.name, ms(l.l.Min), ms(l.l.P50), ms(l.l.P90), ms(l.l.P99), ms(l.l.Max))
+		}
+		w.Flush()
+		for _, t := range []struct {
+			name string
+			t    Throughput
+		}{{"Upload", r.Upload}, {"Download", r.Download}} {
+			fmt.Printf("%-13s %.2f Mbit/s (%.1f MiB in %s)\n", t.name+":", t.t.Mbps, float64(t.t.Bytes)/(1<<20), t.t.Duration.Round(time.Millisecond))
+		}
+	},
+}
+
+// opTimeout bounds each stream open and round trip.
+const opTimeout = 10 * time.Second
+
+func timeOpens(ctx context.Context, c *client.Client) Latency {
+	var d []time.Duration
+	for range count {
+		octx, cancel := context.WithTimeout(ctx, opTimeout)
+		t, err := c.BenchOpen(octx)
+		cancel()
+		if err != nil {
+			log.Fatalf("Stream open failed: %v", err)
+		}
+		d = append(d, t)
+	}
+	return summarize(d)
+}
+
+func timeEchoes(ctx context.Context, c *client.Client) Latency {
+	ectx, cancel := context.WithTimeout(ctx, time.Duration(count)*opTimeout)
+	defer cancel()
+	d, err := c.BenchEcho(ectx, count, echoSize)
+	if err != nil {
+		log.Fatalf("Round trip failed: %v", err)
+	}
+	return summarize(d)
+}
+
+// transfer runs one throughput test, allowing at least 1 Mbit/s.
+func transfer(ctx context.Context, name string, run func(context.Context, int) (time.Duration, error)) Throughput {
+	tctx, cancel := context.WithTimeout(ctx, opTimeout+time.Duration(size/(128<<10))*time.Second)
+	defer cancel()
+	d, err := run(tctx, size)
+	if err != nil {
+		log.Fatalf("The %s failed: %v", name, err)
+	}
+	return Throughput{Bytes: size, Duration: d, Mbps: float64(size*8) / d.Seconds() / 1e6}
+}
+
+func summarize(d []time.Duration) Latency {
+	slices.Sort(d)
+	return Latency{
+		Samples: len(d),
+		Min:     d[0],
+		P50:     percentile(d, 0.50),
+		P90:     percentile(d, 0.90),
+		P99:     percentile(d, 0.99),
+		Max:     d[len(d)-1],
+	}
+}
+
+// percentile returns the nearest-rank q-th percentile of sorted timings.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,86 @@
+package bootstrap
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"paqet/internal/bootstrap"
+	"paqet/internal/flog"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyPath string
+	outPath string
+)
+
+func init() {
+	signCmd.Flags().StringVarP(&keyPath, "key", "k", "", "Path to the base64 Ed25519 private key.")
+	signCmd.Flags().StringVarP(&outPath, "output", "o", "", "Write the signed envelope here instead of stdout.")
+	_ = signCmd.MarkFlagRequired("key")
+	Cmd.AddCommand(keygenCmd, signCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "bootstrap",
+	Short: "Manages signed bootstrap documents.",
+	Long:  `Generates operator keys and signs the server list published at the client's 'bootstrap.url'.`,
+}
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generates an Ed25519 key pair for signing bootstrap documents.",
+	Run: func(cmd *cobra.Command, args []string) {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			flog.Fatalf("Failed to generate key: %v", err)
+		}
+		fmt.Printf("private_key: %s\n", base64.StdEncoding.EncodeToString(priv))
+		fmt.Printf("public_key:  %s\n", base64.StdEncoding.EncodeToString(pub))
+	},
+}
+
+var signCmd = &cobra.Command{
+	Use:   "sign <document.json>",
+	Short: "Signs a bootstrap document with the operator key.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		raw, err := os.ReadFile(keyPath)
+		if err != nil {
+			flog.Fatalf("Failed to read key: %v", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+		if err != nil || len(key) != ed25519.PrivateKeySize {
+			flog.Fatalf("Key must be a base64 Ed25519 private key")
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			flog.Fatalf("Failed to read document: %v", err)
+		}
+		var doc bootstrap.Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			flog.Fatalf("Invalid document: %v", err)
+		}
+		env, err := bootstrap.Sign(&doc, ed25519.PrivateKey(key))
+		if err != nil {
+			flog.Fatalf("Failed to sign document: %v", err)
+		}
+		out, err := json.Marshal(env)
+		if err != nil {
+			flog.Fatalf("Failed to encode envelope: %v", err)
+		}
+		if outPath == "" {
+			fmt.Println(string(out))
+			return
+		}
+		if err := os.WriteFile(outPath, out, 0o644); err != nil {
+			flog.Fatalf("Failed to write envelope: %v", err)
+		}
+	},
+}
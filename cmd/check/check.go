@@ -0,0 +1,78 @@
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"paqet/internal/conf"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPath  string
+	bandwidth int
+	rtt       time.Duration
+	asJSON    bool
+	effective bool
+)
+
+func init() {
+	Cmd.Flags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the configuration file.")
+	Cmd.Flags().IntVar(&bandwidth, "bandwidth", 0, "Expected path bandwidth in Mbit/s; enables window sizing advice together with --rtt.")
+	Cmd.Flags().DurationVar(&rtt, "rtt", 0, "Expected round-trip time to the server (e.g. 150ms).")
+	Cmd.Flags().BoolVar(&asJSON, "json", false, "Print the advice as JSON.")
+	Cmd.Flags().BoolVar(&effective, "effective", false, "Print the effective configuration with defaults and auto-tuned values, secrets redacted, instead of the summary; advice goes to stderr.")
+}
+
+var Cmd = &cobra.Command{
+	Use:     "check [flags]",
+	Aliases: []string{"checkconfig"},
+	Short:   "Validates a configuration file and suggests tuning.",
+	Long:    `Loads the configuration like 'run' would, reports errors, and lists settings that are valid but likely to perform poorly, with a suggested value. Exits with status 1 if the configuration is invalid.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := conf.LoadFromFile(confPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s is invalid: %v\n", confPath, err)
+			os.Exit(1)
+		}
+		if k := cfg.Transport.KCP; bandwidth == 0 && k != nil {
+			bandwidth = k.Bandwidth
+		}
+		advice := cfg.Advise(conf.PathHints{BandwidthMbps: bandwidth, RTT: rtt})
+
+		if effective {
+			b, err := cfg.Effective(false)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to render configuration: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(b))
+			for _, a := range advice {
+				fmt.Fprintf(os.Stderr, "advice: %s\n", a)
+			}
+			return
+		}
+		if asJSON {
+			if advice == nil {
+				advice = []conf.Advice{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(advice)
+			return
+		}
+		if len(advice) == 0 {
+			fmt.Printf("%s is valid, no advice.\n", confPath)
+		} else {
+			fmt.Printf("%s is valid, with %d suggestions:\n", confPath, len(advice))
+			for _, a := range advice {
+				fmt.Printf("  - %s\n", a)
+			}
+		}
+		if bandwidth == 0 || rtt == 0 {
+			fmt.Println("Pass --bandwidth and --rtt to also check window sizes against the path.")
+		}
+	},
+}
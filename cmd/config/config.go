@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"paqet/internal/admin"
+	"paqet/internal/conf"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPath    string
+	socket      string
+	effective   bool
+	running     bool
+	showSecrets bool
+)
+
+func init() {
+	Cmd.PersistentFlags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the configuration file.")
+	Cmd.PersistentFlags().StringVar(&socket, "socket", "", "Admin socket of the running process; overrides admin.socket from the config file.")
+	dumpCmd.Flags().BoolVar(&effective, "effective", false, "Print the configuration with all defaults and auto-tuned values filled in.")
+	dumpCmd.Flags().BoolVar(&running, "running", false, "Print the effective configuration of the running process (via the admin socket).")
+	dumpCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Do not redact keys and passwords.")
+	Cmd.AddCommand(dumpCmd, diffCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspects the configuration.",
+	Long:  `Shows the configuration as paqet sees it after defaults and auto-tuning, and compares it with a running process.`,
+}
+
+var dumpCmd = &cobra.Command{
+	Use:   "dump [flags]",
+	Short: "Prints the configuration file, the effective configuration or that of the running process.",
+	Run: func(cmd *cobra.Command, args []string) {
+		switch {
+		case running:
+			fmt.Print(runningConfig())
+		case effective:
+			cfg, err := conf.LoadFromFile(confPath)
+			if err != nil {
+				log.Fatalf("Failed to load configuration: %v", err)
+			}
+			b, err := cfg.Effective(showSecrets)
+			if err != nil {
+				log.Fatalf("Failed to render configuration: %v", err)
+			}
+			fmt.Print(string(b))
+		default:
+			b, err := os.ReadFile(confPath)
+			if err != nil {
+				log.Fatalf("Failed to read configuration: %v", err)
+			}
+			fmt.Print(string(b))
+		}
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [flags]",
+	Short: "Shows where the running process's configuration differs from the configuration file.",
+	Long:  `Compares the effective configuration of the running process with that of the configuration file, e.g. after the file was edited without a restart or when hardware changed what the autotuner picks. Exits with status 1 if they differ.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := conf.LoadFromFile(confPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		b, err := cfg.Effective(false)
+		if err != nil {
+			log.Fatalf("Failed to render configuration: %v", err)
+		}
+		if socket == "" {
+			socket = adminSocket(cfg)
+		}
+		file, err := flatten(b)
+		if err != nil {
+			log.Fatalf("Failed to parse configuration: %v", err)
+		}
+		live, err := flatten([]byte(runningConfig()))
+		if err != nil {
+			log.Fatalf("Failed to parse running configuration: %v", err)
+		}
+
+		keys := make([]string, 0, len(file)+len(live))
+		for k := range file {
+			keys = append(keys, k)
+		}
+		for k := range live {
+			if _, ok := file[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		drift := 0
+		for _, k := range keys {
+			f, inFile := file[k]
+			r, inLive := live[k]
+			if inFile && inLive && f == r {
+				continue
+			}
+			drift++
+			if inLive {
+				fmt.Printf("- %s: %s\n", k, r)
+			}
+			if inFile {
+				fmt.Printf("+ %s: %s\n", k, f)
+			}
+		}
+		if drift == 0 {
+			fmt.Println("The running configuration matches", confPath)
+			return
+		}
+		fmt.Printf("\n%d settings differ (- running, + %s)\n", drift, confPath)
+		os.Exit(1)
+	},
+}
+
+func adminSocket(cfg *conf.Conf) string {
+	if !cfg.Admin.Enabled() {
+		log.Fatalf("admin.socket is not configured in %s", confPath)
+	}
+	return cfg.Admin.Socket
+}
+
+func runningConfig() string {
+	if socket == "" {
+		cfg, err := conf.LoadFromFile(confPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		socket = adminSocket(cfg)
+	}
+	var out string
+	if err := admin.Get(socket, "/config", &out); err != nil {
+		log.Fatalf("%v", err)
+	}
+	return out
+}
+
+// flatten maps each leaf of a YAML document to its dotted path, e.g.
+// "transport.kcp.mode" or "socks5[0].listen".
+func flatten(doc []byte) (map[string]string, error) {
+	var v any
+	if err := yaml.Unmarshal(doc, &v); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string)
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		switch t := v.(type) {
+		case map[string]any:
+			for k, vv := range t {
+				if prefix != "" {
+					k = prefix + "." + k
+				}
+				walk(k, vv)
+			}
+		case []any:
+			if len(t) == 0 {
+				out[prefix] = "[]"
+			}
+			for i, vv := range t {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), vv)
+			}
+		default:
+			out[prefix] = strings.TrimSpace(fmt.Sprint(v))
+		}
+	}
+	walk("", v)
+	return out, nil
+}
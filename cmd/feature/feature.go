@@ -0,0 +1,84 @@
+package feature
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"paqet/internal/admin"
+	"paqet/internal/conf"
+	"paqet/internal/features"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPath string
+	socket   string
+)
+
+func init() {
+	Cmd.Flags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the configuration file (used to find the admin socket).")
+	Cmd.Flags().StringVar(&socket, "socket", "", "Admin socket of the running process; overrides the config file.")
+}
+
+var Cmd = &cobra.Command{
+	Use:   "feature [<name> <on|off>]",
+	Short: "Lists or flips runtime feature switches of a running process.",
+	Long:  `Without arguments, lists the switches of a running client or server. With a name and on/off, flips one. Changes apply to new connections or streams only and are not written back to the configuration file.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 && len(args) != 2 {
+			return fmt.Errorf("expected no arguments or <name> <on|off>")
+		}
+		if len(args) == 2 && args[1] != "on" && args[1] != "off" {
+			return fmt.Errorf("state must be on or off, got %q", args[1])
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if socket == "" {
+			cfg, err := conf.LoadFromFile(confPath)
+			if err != nil {
+				log.Fatalf("Failed to load configuration: %v", err)
+			}
+			if !cfg.Admin.Enabled() {
+				log.Fatalf("admin.socket is not configured in %s", confPath)
+			}
+			socket = cfg.Admin.Socket
+		}
+
+		if len(args) == 2 {
+			var f features.Flag
+			path := fmt.Sprintf("/features/%s?enabled=%t", url.PathEscape(args[0]), args[1] == "on")
+			if err := admin.Post(socket, path, 10*time.Second, &f); err != nil {
+				log.Fatalf("%v", err)
+			}
+			fmt.Printf("%s is now %s; applies to %s.\n", f.Name, state(f.Enabled), f.Applies)
+			return
+		}
+
+		var flags []features.Flag
+		if err := admin.Get(socket, "/features", &flags); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if len(flags) == 0 {
+			fmt.Println("No runtime switches available for this configuration.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSTATE\tAPPLIES TO\tDESCRIPTION")
+		for _, f := range flags {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Name, state(f.Enabled), f.Applies, f.Description)
+		}
+		w.Flush()
+	},
+}
+
+func state(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,92 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"paqet/internal/admin"
+	"paqet/internal/client"
+	"paqet/internal/conf"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPath string
+	socket   string
+	since    time.Duration
+	asJSON   bool
+)
+
+func init() {
+	Cmd.Flags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the configuration file (used to find the admin socket).")
+	Cmd.Flags().StringVar(&socket, "socket", "", "Admin socket of the running client; overrides the config file.")
+	Cmd.Flags().DurationVar(&since, "since", 0, "Only show events from this long ago (e.g. 12h).")
+	Cmd.Flags().BoolVar(&asJSON, "json", false, "Print the raw events as JSON.")
+}
+
+var Cmd = &cobra.Command{
+	Use:   "history [flags]",
+	Short: "Shows connection lifecycle events of a running client.",
+	Long:  `Queries the admin socket of a running client for connection creations, health-check failures, reconnects and rotations, with a summary per event type.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if socket == "" {
+			cfg, err := conf.LoadFromFile(confPath)
+			if err != nil {
+				log.Fatalf("Failed to load configuration: %v", err)
+			}
+			if !cfg.Admin.Enabled() {
+				log.Fatalf("admin.socket is not configured in %s", confPath)
+			}
+			socket = cfg.Admin.Socket
+		}
+
+		path := "/history"
+		if since > 0 {
+			path += "?since=" + url.QueryEscape(since.String())
+		}
+		var events []client.ConnEvent
+		if err := admin.Get(socket, path, &events); err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(events)
+			return
+		}
+		printEvents(events)
+	},
+}
+
+func printEvents(events []client.ConnEvent) {
+	if len(events) == 0 {
+		fmt.Println("No connection events recorded.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tCONN\tEVENT\tLOCAL\tREASON")
+	counts := make(map[string]int)
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Conn+1, e.Event, e.Local, e.Reason)
+		counts[e.Event]++
+	}
+	w.Flush()
+
+	kinds := make([]string, 0, len(counts))
+	for k := range counts {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	fmt.Printf("\n%d events since %s:", len(events), events[0].Time.Local().Format(time.DateTime))
+	for _, k := range kinds {
+		fmt.Printf(" %s=%d", k, counts[k])
+	}
+	fmt.Println()
+}
@@ -2,11 +2,19 @@ package main
 
 import (
 	"os"
+	"paqet/cmd/bench"
+	"paqet/cmd/bootstrap"
+	"paqet/cmd/check"
+	"paqet/cmd/config"
 	"paqet/cmd/dump"
+	"paqet/cmd/feature"
+	"paqet/cmd/history"
 	"paqet/cmd/iface"
 	"paqet/cmd/ping"
+	"paqet/cmd/profile"
 	"paqet/cmd/run"
 	"paqet/cmd/secret"
+	"paqet/cmd/status"
 	"paqet/cmd/version"
 	"paqet/internal/flog"
 
@@ -24,7 +32,15 @@ func main() {
 	rootCmd.AddCommand(dump.Cmd)
 	rootCmd.AddCommand(ping.Cmd)
 	rootCmd.AddCommand(secret.Cmd)
+	rootCmd.AddCommand(bootstrap.Cmd)
+	rootCmd.AddCommand(config.Cmd)
+	rootCmd.AddCommand(check.Cmd)
+	rootCmd.AddCommand(feature.Cmd)
 	rootCmd.AddCommand(iface.Cmd)
+	rootCmd.AddCommand(history.Cmd)
+	rootCmd.AddCommand(status.Cmd)
+	rootCmd.AddCommand(bench.Cmd)
+	rootCmd.AddCommand(profile.Cmd)
 	rootCmd.AddCommand(version.Cmd)
 
 	if err := rootCmd.Execute(); err != nil {
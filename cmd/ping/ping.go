@@ -1,7 +1,9 @@
 package ping
 
 import (
+	"context"
 	"log"
+	"paqet/internal/bootstrap"
 	"paqet/internal/conf"
 	"paqet/internal/socket"
 
@@ -35,7 +37,13 @@ func sendPacket() {
 	if cfg.Role != "client" {
 		log.Fatalf("Ping command requires client configuration")
 	}
-	sendHandle, err := socket.NewSendHandle(&cfg.Network)
+	ctx := context.Background()
+	if cfg.BootstrapPending() {
+		if err := bootstrap.Resolve(ctx, cfg); err != nil {
+			log.Fatalf("Bootstrap failed: %v", err)
+		}
+	}
+	sendHandle, err := socket.NewSendHandle(ctx, &cfg.Network)
 	if err != nil {
 		log.Fatalf("Failed to create raw socket: %v", err)
 	}
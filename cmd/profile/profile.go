@@ -0,0 +1,57 @@
+package profile
+
+import (
+	"fmt"
+	"log"
+	"paqet/internal/admin"
+	"paqet/internal/conf"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPath string
+	socket   string
+	seconds  int
+)
+
+func init() {
+	Cmd.Flags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the configuration file (used to find the admin socket).")
+	Cmd.Flags().StringVar(&socket, "socket", "", "Admin socket of the running process; overrides the config file.")
+	Cmd.Flags().IntVar(&seconds, "seconds", 30, "Capture duration for cpu and trace profiles.")
+}
+
+var Cmd = &cobra.Command{
+	Use:       "profile <cpu|heap|trace> [flags]",
+	Short:     "Captures a CPU profile, heap snapshot or execution trace from a running process.",
+	Long:      `Asks a running client or server over its admin socket to write a profile to admin.profile_dir and prints the file path. Open the result with "go tool pprof" or "go tool trace".`,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"cpu", "heap", "trace"},
+	Run: func(cmd *cobra.Command, args []string) {
+		kind := args[0]
+		if socket == "" {
+			cfg, err := conf.LoadFromFile(confPath)
+			if err != nil {
+				log.Fatalf("Failed to load configuration: %v", err)
+			}
+			if !cfg.Admin.Enabled() {
+				log.Fatalf("admin.socket is not configured in %s", confPath)
+			}
+			socket = cfg.Admin.Socket
+		}
+
+		path := "/profile/" + kind
+		timeout := 30 * time.Second
+		if kind != "heap" {
+			path += fmt.Sprintf("?seconds=%d", seconds)
+			timeout += time.Duration(seconds) * time.Second
+			fmt.Printf("Capturing %s profile for %ds...\n", kind, seconds)
+		}
+		var p admin.Profile
+		if err := admin.Post(socket, path, timeout, &p); err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Printf("Wrote %s profile (%d bytes) to %s\n", p.Kind, p.Size, p.Path)
+	},
+}
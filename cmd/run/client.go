@@ -2,12 +2,23 @@ package run
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
+	"paqet/internal/admin"
+	"paqet/internal/bootstrap"
 	"paqet/internal/client"
 	"paqet/internal/conf"
+	"paqet/internal/diag"
+	"paqet/internal/dns"
 	"paqet/internal/flog"
 	"paqet/internal/forward"
+	"paqet/internal/logship"
+	"paqet/internal/metrics"
+	"paqet/internal/reverse"
+	"paqet/internal/socket"
 	"paqet/internal/socks"
 	"paqet/internal/tunnel"
 	"syscall"
@@ -25,13 +36,82 @@ func startClient(cfg *conf.Conf) {
 		cancel()
 	}()
 
+	if cfg.Bootstrap.Enabled() {
+		if err := bootstrap.Resolve(ctx, cfg); err != nil {
+			flog.Fatalf("Bootstrap failed: %v", err)
+		}
+	}
+
+	if cfg.Transport.Protocol != "websocket" && cfg.Network.Pacing.Enabled() {
+		j := tunnel.OpenJournal(cfg.Network.Pacing.Journal)
+		if err := socket.InstallPacing(&cfg.Network, j.Record); err != nil {
+			j.Rollback()
+			flog.Fatalf("Failed to install pacing qdisc: %v", err)
+		}
+		defer j.Rollback()
+	}
+
 	client, err := client.New(cfg)
 	if err != nil {
 		flog.Fatalf("Failed to initialize client: %v", err)
 	}
-	if err := client.Start(ctx); err != nil {
+	// The transport outlives ctx until TUN routes and split DNS are
+	// withdrawn, so traffic is never routed into a closed tunnel
+	transportCtx, stopTransport := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopTransport()
+	if err := client.Start(transportCtx); err != nil {
 		flog.Fatalf("Failed to start client: %s", err.Error())
 	}
+	dump := diag.New(cfg.Admin.ProfileDir, cfg)
+	dump.Add("connections", client.Connections)
+	dump.Add("pools", client.Pools)
+	dump.Watch(ctx)
+	var logs *logship.Shipper
+	if cfg.Log.Ship.Enabled() {
+		logs = logship.Start(ctx, &cfg.Log.Ship, func(ctx context.Context) (io.WriteCloser, error) {
+			return client.TCP(ctx, cfg.Log.Ship.Addr)
+		})
+	}
+	if cfg.Metrics.Enabled() {
+		m := metrics.New(&cfg.Metrics)
+		m.Register(client.Collect)
+		if logs != nil {
+			m.Register(logs.Collect)
+		}
+		if err := m.Start(ctx); err != nil {
+			flog.Fatalf("Failed to start metrics endpoint: %v", err)
+		}
+	}
+	var a *admin.Server
+	if cfg.Admin.Enabled() {
+		a = admin.New(&cfg.Admin)
+		a.Handle("GET /status", client.Status)
+		a.Handle("GET /probes", client.ProbeHistory)
+		a.Handle("GET /history", client.ConnHistory)
+		a.Handle("GET /roaming", client.RoamingStatus)
+		a.Handle("GET /breaker", client.BreakerStatus)
+		a.Handle("GET /failover", client.FailoverStatus)
+		a.Handle("GET /fetch", client.FetchStatus)
+		a.HandleConfig(cfg)
+		a.HandleFeatures(client.Features())
+		a.Handle("GET /reload", client.ReloadStatus)
+		a.Handle("POST /reload", func(*http.Request) (any, error) {
+			return reloadClient(ctx, client)
+		})
+		if err := a.Start(ctx); err != nil {
+			flog.Fatalf("Failed to start admin API: %v", err)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if _, err := reloadClient(ctx, client); err != nil {
+				flog.Errorf("Configuration reload failed: %v", err)
+			}
+		}
+	}()
 
 	for _, ss := range cfg.SOCKS5 {
 		s, err := socks.New(client)
@@ -42,8 +122,9 @@ func startClient(cfg *conf.Conf) {
 			flog.Fatalf("SOCKS5 encountered an error: %v", err)
 		}
 	}
-	for _, ff := range cfg.Forward {
-		f, err := forward.New(client, ff.Listen.String(), ff.Target.String(), cfg)
+	for i := range cfg.Forward {
+		ff := &cfg.Forward[i]
+		f, err := forward.New(client, ff, cfg)
 		if err != nil {
 			flog.Fatalf("Failed to initialize Forward: %v", err)
 		}
@@ -51,14 +132,35 @@ func startClient(cfg *conf.Conf) {
 			flog.Infof("Forward encountered an error: %v", err)
 		}
 	}
+	if cfg.Kcptun.Enabled() {
+		if err := forward.NewKcptun(&cfg.Kcptun).Start(ctx); err != nil {
+			flog.Fatalf("Failed to start kcptun client: %v", err)
+		}
+	}
+	for i := range cfg.Reverse {
+		r, err := reverse.New(client, &cfg.Reverse[i])
+		if err != nil {
+			flog.Fatalf("Failed to initialize reverse forward: %v", err)
+		}
+		r.Start(ctx)
+	}
+	if cfg.DNS.Enabled() {
+		if err := dns.New(client, &cfg.DNS).Start(ctx); err != nil {
+			flog.Fatalf("Failed to start DNS forwarder: %v", err)
+		}
+	}
 
 	// Start TUN tunnel if enabled
+	var tun *tunnel.TUN
 	if cfg.TUN.Enabled {
-		tun, err := tunnel.New(&cfg.TUN)
+		tun, err = tunnel.New(&cfg.TUN)
 		if err != nil {
 			flog.Fatalf("Failed to initialize TUN: %v", err)
 		}
 		defer tun.Close()
+		if a != nil {
+			a.HandleTUN(tun)
+		}
 
 		handler := tunnel.NewHandler(tun, client)
 		go func() {
@@ -71,4 +173,18 @@ func startClient(cfg *conf.Conf) {
 	}
 
 	<-ctx.Done()
+	if tun != nil {
+		tun.Deactivate()
+	}
+	stopTransport()
+}
+
+// reloadClient re-reads the configuration file and applies it to c on
+// probation.
+func reloadClient(ctx context.Context, c *client.Client) (*client.ReloadStatus, error) {
+	next, err := conf.LoadFromFile(confPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return c.Reload(ctx, next)
 }
@@ -25,6 +25,9 @@ var Cmd = &cobra.Command{
 			log.Fatalf("Failed to load configuration: %v", err)
 		}
 		initialize(cfg)
+		for _, a := range cfg.Advise(conf.PathHints{}) {
+			flog.Warnf("config advice: %s", a)
+		}
 
 		switch cfg.Role {
 		case "client":
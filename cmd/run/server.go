@@ -1,6 +1,11 @@
 package run
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"paqet/internal/conf"
 	"paqet/internal/flog"
 	"paqet/internal/server"
@@ -13,7 +18,43 @@ func startServer(cfg *conf.Conf) {
 	if err != nil {
 		flog.Fatalf("Failed to initialize server: %v", err)
 	}
-	if err := server.Start(); err != nil {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		<-sig
+		if server.Shutdown() {
+			flog.Infof("Shutdown signal received, letting open streams finish; signal again to stop at once")
+			select {
+			case <-sig:
+			case <-ctx.Done():
+				return
+			}
+		}
+		flog.Infof("Shutdown signal received, initiating graceful shutdown...")
+		cancel()
+	}()
+
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+	defer signal.Stop(usr2)
+	go func() {
+		for {
+			select {
+			case <-usr2:
+				if err := server.HandOff(); err != nil {
+					flog.Errorf("handoff failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := server.Start(ctx); err != nil {
 		flog.Fatalf("Server encountered an error: %v", err)
 	}
 }
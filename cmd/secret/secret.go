@@ -1,18 +1,31 @@
 package secret
 
 import (
+	"crypto/ecdh"
 	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"paqet/internal/conf"
 	"paqet/internal/flog"
 
 	"github.com/spf13/cobra"
 )
 
+var echPublicName string
+
+func init() {
+	Cmd.Flags().StringVar(&echPublicName, "ech", "", "Generate a QUIC ECH key instead, advertising this public name (outer SNI).")
+}
+
 var Cmd = &cobra.Command{
 	Use:   "secret",
 	Short: "Generates a secure, random 32-byte secret key.",
-	Long:  `This command generates a cryptographically secure 32-byte (256-bit) key and prints it. Use this key for the 'encryption.key' field in your config.yaml.`,
+	Long:  `This command generates a cryptographically secure 32-byte (256-bit) key and prints it. Use this key for the 'encryption.key' field in your config.yaml. With --ech it generates a QUIC Encrypted Client Hello key pair instead.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if echPublicName != "" {
+			generateECH()
+			return
+		}
 		length := 32
 		key := make([]byte, length)
 		if _, err := rand.Read(key); err != nil {
@@ -21,3 +34,16 @@ var Cmd = &cobra.Command{
 		fmt.Printf("%x\n", key)
 	},
 }
+
+func generateECH() {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		flog.Fatalf("Failed to generate ECH key: %v", err)
+	}
+	list, err := conf.ECHConfigList(priv.Bytes(), echPublicName)
+	if err != nil {
+		flog.Fatalf("Failed to build ECH config: %v", err)
+	}
+	fmt.Printf("# server: transport.quic\nech_key: %q\nech_public_name: %q\n\n", base64.StdEncoding.EncodeToString(priv.Bytes()), echPublicName)
+	fmt.Printf("# client: transport.quic\nech_config_list: %q\n", base64.StdEncoding.EncodeToString(list))
+}
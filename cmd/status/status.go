@@ -0,0 +1,121 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"paqet/internal/admin"
+	"paqet/internal/conf"
+	"paqet/internal/socket"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPath    string
+	adminSocket string
+	interval    time.Duration
+	asJSON      bool
+)
+
+func init() {
+	Cmd.Flags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the configuration file (used to find the admin socket).")
+	Cmd.Flags().StringVar(&adminSocket, "socket", "", "Admin socket of the running process; overrides the config file.")
+	Cmd.Flags().DurationVar(&interval, "interval", time.Second, "Time between the two samples throughput is measured over (0 = skip).")
+	Cmd.Flags().BoolVar(&asJSON, "json", false, "Print the status as JSON.")
+}
+
+// report is a status with the throughput measured between two samples.
+type report struct {
+	admin.Status
+	InBps  float64 `json:"throughput_in_bps,omitempty"`  // bits per second read from the tunnel
+	OutBps float64 `json:"throughput_out_bps,omitempty"` // bits per second written to the tunnel
+}
+
+var Cmd = &cobra.Command{
+	Use:   "status [flags]",
+	Short: "Summarizes a running client or server.",
+	Long:  `Queries the admin socket of a running client or server for its uptime, transport, connections, open streams, throughput and packet drops. Throughput is measured between two samples --interval apart.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if adminSocket == "" {
+			cfg, err := conf.LoadFromFile(confPath)
+			if err != nil {
+				log.Fatalf("Failed to load configuration: %v", err)
+			}
+			if !cfg.Admin.Enabled() {
+				log.Fatalf("admin.socket is not configured in %s", confPath)
+			}
+			adminSocket = cfg.Admin.Socket
+		}
+
+		var r report
+		if err := admin.Get(adminSocket, "/status", &r.Status); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if interval > 0 {
+			first := r.Status
+			time.Sleep(interval)
+			if err := admin.Get(adminSocket, "/status", &r.Status); err != nil {
+				log.Fatalf("%v", err)
+			}
+			if secs := r.Uptime - first.Uptime; secs > 0 {
+				r.InBps = float64(r.BytesIn-min(first.BytesIn, r.BytesIn)) * 8 / secs
+				r.OutBps = float64(r.BytesOut-min(first.BytesOut, r.BytesOut)) * 8 / secs
+			}
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(r)
+			return
+		}
+		peer := "to"
+		if r.Role == "server" {
+			peer = "on"
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Role:\t%s\n", r.Role)
+		fmt.Fprintf(w, "Uptime:\t%s (since %s)\n", (time.Duration(r.Uptime) * time.Second).String(), r.Started.Local().Format(time.DateTime))
+		fmt.Fprintf(w, "Transport:\t%s %s %s\n", r.Transport, peer, r.Addr)
+		fmt.Fprintf(w, "Connections:\t%d\n", r.Connections)
+		fmt.Fprintf(w, "Streams:\t%d open\n", r.Streams)
+		if interval > 0 {
+			fmt.Fprintf(w, "Throughput:\t%s in, %s out\n", bitrate(r.InBps), bitrate(r.OutBps))
+		}
+		fmt.Fprintf(w, "Transferred:\t%s in, %s out\n", size(r.BytesIn), size(r.BytesOut))
+		drops := fmt.Sprint(r.Dropped)
+		if r.Dropped > 0 {
+			drops += " " + socket.FormatDrops(r.DropsBy)
+		}
+		fmt.Fprintf(w, "Drops:\t%s, queue depth %d\n", drops, r.QueueDepth)
+		w.Flush()
+	},
+}
+
+func bitrate(bps float64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.2f Gbit/s", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.2f Mbit/s", bps/1e6)
+	default:
+		return fmt.Sprintf("%.1f kbit/s", bps/1e3)
+	}
+}
+
+func size(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,155 @@
+// Package admin serves a small JSON API on a local unix socket for runtime
+// introspection and control of a running paqet process.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"paqet/internal/conf"
+	"paqet/internal/features"
+	"paqet/internal/flog"
+	"paqet/internal/handoff"
+	"strconv"
+	"time"
+)
+
+// HandlerFunc returns a value to be encoded as the JSON response body.
+type HandlerFunc func(r *http.Request) (any, error)
+
+type Server struct {
+	cfg *conf.Admin
+	mux *http.ServeMux
+}
+
+func New(cfg *conf.Admin) *Server {
+	s := &Server{cfg: cfg, mux: http.NewServeMux()}
+	s.handleProfiles()
+	s.handleLogLevel()
+	return s
+}
+
+// Handle registers fn for pattern, using http.ServeMux pattern syntax
+// (e.g. "GET /probes").
+func (s *Server) Handle(pattern string, fn HandlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		v, err := fn(r)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			v = map[string]string{"error": err.Error()}
+		}
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			flog.Debugf("admin: failed to write response for %s: %v", r.URL.Path, err)
+		}
+	})
+}
+
+// Start listens on the configured socket and serves until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	ln, err := handoff.Listen("unix", s.cfg.Socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin socket %s: %v", s.cfg.Socket, err)
+	}
+	if err := os.Chmod(s.cfg.Socket, 0o600); err != nil {
+		ln.Close()
+		return fmt.Errorf("failed to restrict admin socket permissions: %v", err)
+	}
+
+	srv := &http.Server{Handler: s.mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			flog.Errorf("admin API stopped: %v", err)
+		}
+	}()
+	flog.Infof("admin API listening on %s", s.cfg.Socket)
+	return nil
+}
+
+// Get queries path on the admin socket of a running process and decodes the
+// JSON response into out.
+func Get(socket, path string, out any) error {
+	return do(http.MethodGet, socket, path, 10*time.Second, out)
+}
+
+// Post triggers the action at path on the admin socket of a running process
+// and decodes the JSON response into out. Actions such as profile captures
+// may take a while, so the caller sets the timeout.
+func Post(socket, path string, timeout time.Duration, out any) error {
+	return do(http.MethodPost, socket, path, timeout, out)
+}
+
+func do(method, socket, path string, timeout time.Duration, out any) error {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	req, err := http.NewRequest(method, "http://paqet"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach admin socket %s: %v", socket, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct{ Error string }
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return fmt.Errorf("admin API: %s", e.Error)
+		}
+		return fmt.Errorf("admin API: %s", resp.Status)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// HandleConfig serves the effective configuration of the running process
+// at GET /config, with secrets redacted.
+func (s *Server) HandleConfig(cfg *conf.Conf) {
+	s.Handle("GET /config", func(*http.Request) (any, error) {
+		b, err := cfg.Effective(false)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	})
+}
+
+// HandleFeatures serves the runtime switches at GET /features and flips one
+// with POST /features/{name}?enabled=true|false.
+func (s *Server) HandleFeatures(set *features.Set) {
+	s.Handle("GET /features", func(*http.Request) (any, error) {
+		return set.List(), nil
+	})
+	s.Handle("POST /features/{name}", func(r *http.Request) (any, error) {
+		on, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			return nil, fmt.Errorf("enabled must be true or false")
+		}
+		f, err := set.Set(r.PathValue("name"), on)
+		if err != nil {
+			return nil, err
+		}
+		flog.Infof("admin: feature %s set to %t (applies to %s)", f.Name, f.Enabled, f.Applies)
+		return f, nil
+	})
+}
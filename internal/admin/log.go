@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+)
+
+// handleLogLevel serves the log level at GET /log/level and changes it with
+// POST /log/level?level=debug until the process restarts.
+func (s *Server) handleLogLevel() {
+	level := func() any {
+		return map[string]string{"level": strings.ToLower(flog.GetLevel().String())}
+	}
+	s.Handle("GET /log/level", func(*http.Request) (any, error) {
+		return level(), nil
+	})
+	s.Handle("POST /log/level", func(r *http.Request) (any, error) {
+		l, err := conf.ParseLogLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			return nil, err
+		}
+		flog.SetLevel(l)
+		flog.Infof("admin: log level set to %s", r.URL.Query().Get("level"))
+		return level(), nil
+	})
+}
@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProfileDuration = 30 * time.Second
+	maxProfileDuration     = 10 * time.Minute
+)
+
+// Profile describes a profile written by the admin API.
+type Profile struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path"`
+	Seconds int    `json:"seconds,omitempty"`
+	Size    int64  `json:"size"`
+}
+
+// profiler serializes captures: the runtime allows only one CPU profile and
+// one execution trace at a time.
+type profiler struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func (s *Server) handleProfiles() {
+	p := &profiler{dir: s.cfg.ProfileDir}
+	s.Handle("POST /profile/cpu", p.cpu)
+	s.Handle("POST /profile/heap", p.heap)
+	s.Handle("POST /profile/trace", p.trace)
+}
+
+func (p *profiler) cpu(r *http.Request) (any, error) {
+	d, err := profileDuration(r)
+	if err != nil {
+		return nil, err
+	}
+	return p.capture("cpu", "pprof", d, func(f *os.File) error {
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		sleep(r, d)
+		pprof.StopCPUProfile()
+		return nil
+	})
+}
+
+func (p *profiler) heap(r *http.Request) (any, error) {
+	return p.capture("heap", "pprof", 0, func(f *os.File) error {
+		runtime.GC() // report up-to-date live objects
+		return pprof.Lookup("heap").WriteTo(f, 0)
+	})
+}
+
+func (p *profiler) trace(r *http.Request) (any, error) {
+	d, err := profileDuration(r)
+	if err != nil {
+		return nil, err
+	}
+	return p.capture("trace", "trace", d, func(f *os.File) error {
+		if err := trace.Start(f); err != nil {
+			return err
+		}
+		sleep(r, d)
+		trace.Stop()
+		return nil
+	})
+}
+
+func (p *profiler) capture(kind, ext string, d time.Duration, write func(*os.File) error) (*Profile, error) {
+	if !p.mu.TryLock() {
+		return nil, fmt.Errorf("another profile is being captured")
+	}
+	defer p.mu.Unlock()
+
+	name := fmt.Sprintf("paqet-%s-%s.%s", kind, time.Now().Format("20060102-150405"), ext)
+	path := filepath.Join(p.dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profile file: %v", err)
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to capture %s profile: %v", kind, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{Kind: kind, Path: path, Seconds: int(d.Seconds()), Size: info.Size()}, nil
+}
+
+// profileDuration reads the optional ?seconds= parameter.
+func profileDuration(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("seconds")
+	if v == "" {
+		return defaultProfileDuration, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || time.Duration(n)*time.Second > maxProfileDuration {
+		return 0, fmt.Errorf("seconds must be between 1-%d", int(maxProfileDuration.Seconds()))
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// sleep waits for d, returning early if the caller goes away.
+func sleep(r *http.Request, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,22 @@
+package admin
+
+import "time"
+
+// Status is the summary of a running process served at GET /status and
+// printed by paqet status.
+type Status struct {
+	Role      string    `json:"role"`
+	Started   time.Time `json:"started"`
+	Uptime    float64   `json:"uptime_seconds"`
+	Transport string    `json:"transport"`
+	Addr      string    `json:"addr"` // server in use (client) or listen address (server)
+
+	Connections int    `json:"connections"`
+	Streams     int64  `json:"streams"`
+	BytesIn     uint64 `json:"bytes_in"`  // stream payload read from the tunnel
+	BytesOut    uint64 `json:"bytes_out"` // stream payload written to the tunnel
+
+	Dropped    uint64            `json:"packets_dropped"`
+	DropsBy    map[string]uint64 `json:"drops_by_reason,omitempty"`
+	QueueDepth int               `json:"queue_depth"`
+}
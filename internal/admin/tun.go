@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"paqet/internal/flog"
+	"paqet/internal/tunnel"
+	"time"
+)
+
+// mirrorQueue is how many packets a slow mirror consumer may fall behind
+// before packets are dropped for it; the relay never waits for it.
+const mirrorQueue = 1024
+
+// Packet is one line of GET /tun/mirror output.
+type Packet struct {
+	Time time.Time `json:"time"`
+	Dir  string    `json:"dir"`
+	Data []byte    `json:"data"` // base64
+}
+
+// HandleTUN lets integrations take part in the TUN relay path of t.
+// POST /tun/inject?dir=inbound|outbound puts the IP packet in the request
+// body on the path, and GET /tun/mirror streams every relayed packet as a
+// JSON line until the consumer disconnects; ?dir= limits it to one
+// direction. GET /tun/routes lists the routing table under tun.routing.
+func (s *Server) HandleTUN(t *tunnel.TUN) {
+	s.Handle("GET /tun/routes", func(r *http.Request) (any, error) {
+		return t.Routes()
+	})
+	s.Handle("POST /tun/inject", func(r *http.Request) (any, error) {
+		dir, err := tunnel.ParseDirection(r.URL.Query().Get("dir"))
+		if err != nil {
+			return nil, err
+		}
+		pkt, err := io.ReadAll(io.LimitReader(r.Body, 65536))
+		if err != nil {
+			return nil, err
+		}
+		if err := t.Inject(dir, pkt); err != nil {
+			return nil, err
+		}
+		return map[string]int{"len": len(pkt)}, nil
+	})
+	s.mux.HandleFunc("GET /tun/mirror", func(w http.ResponseWriter, r *http.Request) {
+		only := -1
+		if d := r.URL.Query().Get("dir"); d != "" {
+			dir, err := tunnel.ParseDirection(d)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			only = int(dir)
+		}
+
+		ch := make(chan Packet, mirrorQueue)
+		remove := t.Mirror(func(dir tunnel.Direction, pkt []byte) {
+			if only >= 0 && int(dir) != only {
+				return
+			}
+			select {
+			case ch <- Packet{Time: time.Now(), Dir: dir.String(), Data: append([]byte(nil), pkt...)}:
+			default:
+			}
+		})
+		defer remove()
+		flog.Infof("admin: TUN mirror consumer connected")
+		defer flog.Infof("admin: TUN mirror consumer disconnected")
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case p := <-ch:
+				if err := enc.Encode(p); err != nil {
+					return
+				}
+				if len(ch) == 0 && flusher != nil {
+					flusher.Flush()
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,205 @@
+// Package bootstrap fetches the current server list and obfuscation
+// parameters from an operator-signed document served over HTTPS.
+package bootstrap
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"path/filepath"
+	"time"
+)
+
+// maxSize bounds the downloaded document.
+const maxSize = 1 << 20
+
+// Envelope is the published form: the payload bytes and their signature.
+type Envelope struct {
+	Payload   []byte `json:"payload"`   // JSON-encoded Document
+	Signature []byte `json:"signature"` // Ed25519 over Payload
+}
+
+// Document is the signed content of a bootstrap envelope.
+type Document struct {
+	Version int      `json:"version"`
+	Expires int64    `json:"expires,omitempty"` // unix seconds, 0 = never
+	Servers []string `json:"servers"`
+	KCP     *struct {
+		Block string `json:"block,omitempty"`
+		Key   string `json:"key,omitempty"`
+	} `json:"kcp,omitempty"`
+	TCP *struct {
+		LocalFlag  []string `json:"local_flag,omitempty"`
+		RemoteFlag []string `json:"remote_flag,omitempty"`
+	} `json:"tcp,omitempty"`
+}
+
+// Sign wraps doc in an envelope signed with key.
+func Sign(doc *Document, key ed25519.PrivateKey) (*Envelope, error) {
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{Payload: payload, Signature: ed25519.Sign(key, payload)}, nil
+}
+
+// Open verifies the envelope signature and expiry and decodes the document.
+func Open(env *Envelope, key ed25519.PublicKey) (*Document, error) {
+	if !ed25519.Verify(key, env.Payload, env.Signature) {
+		return nil, fmt.Errorf("bootstrap signature verification failed")
+	}
+	var doc Document
+	if err := json.Unmarshal(env.Payload, &doc); err != nil {
+		return nil, fmt.Errorf("invalid bootstrap document: %v", err)
+	}
+	if doc.Expires != 0 && time.Now().Unix() > doc.Expires {
+		return nil, fmt.Errorf("bootstrap document expired at %s", time.Unix(doc.Expires, 0).UTC().Format(time.RFC3339))
+	}
+	if len(doc.Servers) == 0 {
+		return nil, fmt.Errorf("bootstrap document lists no servers")
+	}
+	return &doc, nil
+}
+
+// Resolve fetches and verifies the bootstrap document, falling back to the
+// cached copy, and applies it to cfg.
+func Resolve(ctx context.Context, cfg *conf.Conf) error {
+	b := &cfg.Bootstrap
+	raw, err := fetch(ctx, b)
+	if err != nil {
+		flog.Warnf("bootstrap fetch from %s failed: %v", b.URL, err)
+	}
+
+	var doc *Document
+	if raw != nil {
+		doc, err = decode(raw, b.PublicKey)
+		if err != nil {
+			flog.Warnf("bootstrap document rejected: %v", err)
+		} else if b.Cache != "" {
+			if err := writeCache(b.Cache, raw); err != nil {
+				flog.Warnf("failed to cache bootstrap document: %v", err)
+			}
+		}
+	}
+	if doc == nil && b.Cache != "" {
+		if cached, err := os.ReadFile(b.Cache); err == nil {
+			if doc, err = decode(cached, b.PublicKey); err != nil {
+				flog.Warnf("cached bootstrap document rejected: %v", err)
+			} else {
+				flog.Infof("using cached bootstrap document from %s", b.Cache)
+			}
+		}
+	}
+	if doc == nil {
+		if !cfg.BootstrapPending() {
+			flog.Warnf("bootstrap unavailable, using configured server %s", cfg.Server.Addr_)
+			return nil
+		}
+		return fmt.Errorf("no valid bootstrap document available")
+	}
+
+	server, err := pickServer(doc.Servers, cfg)
+	if err != nil {
+		return err
+	}
+	var p conf.BootstrapParams
+	if doc.KCP != nil {
+		p.KCPBlock, p.KCPKey = doc.KCP.Block, doc.KCP.Key
+	}
+	if doc.TCP != nil {
+		p.LocalFlag, p.RemoteFlag = doc.TCP.LocalFlag, doc.TCP.RemoteFlag
+	}
+	if err := cfg.ApplyBootstrap(server, p); err != nil {
+		return err
+	}
+	flog.Infof("bootstrap selected server %s from %d candidates", server, len(doc.Servers))
+	return nil
+}
+
+func decode(raw []byte, key ed25519.PublicKey) (*Document, error) {
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, fmt.Errorf("invalid bootstrap envelope: %v", err)
+	}
+	return Open(&env, key)
+}
+
+func fetch(ctx context.Context, b *conf.Bootstrap) ([]byte, error) {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if b.Front != "" {
+		// Domain fronting: connect and present SNI for the front domain,
+		// route to the real origin with the Host header.
+		tlsCfg.ServerName = b.Front
+		if port := u.Port(); port != "" {
+			u.Host = net.JoinHostPort(b.Front, port)
+		} else {
+			u.Host = b.Front
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(b.Timeout)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = host
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg, Proxy: http.ProxyFromEnvironment}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSize))
+}
+
+func writeCache(path string, raw []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// pickServer returns a random server whose address family is configured
+// on the local interface.
+func pickServer(servers []string, cfg *conf.Conf) (string, error) {
+	for _, i := range rand.Perm(len(servers)) {
+		addr, err := net.ResolveUDPAddr("udp", servers[i])
+		if err != nil {
+			flog.Debugf("bootstrap skipping server %q: %v", servers[i], err)
+			continue
+		}
+		// IPv4 servers are reachable over IPv6 through a NAT64 prefix.
+		if addr.IP.To4() != nil && cfg.Network.IPv4.Addr_ == "" && cfg.Network.NAT64_ == "" {
+			continue
+		}
+		if addr.IP.To4() == nil && cfg.Network.IPv6.Addr_ == "" {
+			continue
+		}
+		return servers[i], nil
+	}
+	return "", fmt.Errorf("bootstrap document has no server reachable with the configured address families")
+}
@@ -0,0 +1,45 @@
+package bootstrap
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func TestSignOpen(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &Document{Version: 1, Servers: []string{"192.0.2.1:9999"}}
+
+	env, err := Sign(doc, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Open(env, pub)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got.Servers[0] != "192.0.2.1:9999" {
+		t.Fatalf("unexpected servers %v", got.Servers)
+	}
+
+	env.Payload[len(env.Payload)-2] ^= 1
+	if _, err := Open(env, pub); err == nil {
+		t.Fatal("tampered payload verified")
+	}
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	env, _ = Sign(doc, priv)
+	if _, err := Open(env, other); err == nil {
+		t.Fatal("wrong key verified")
+	}
+
+	doc.Expires = time.Now().Add(-time.Minute).Unix()
+	env, _ = Sign(doc, priv)
+	if _, err := Open(env, pub); err == nil {
+		t.Fatal("expired document accepted")
+	}
+}
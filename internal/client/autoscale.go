@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"paqet/internal/flog"
+	"paqet/internal/tnet"
+	"sync/atomic"
+	"time"
+)
+
+// autoscaleCalm is how many consecutive low-demand intervals it takes to
+// remove a connection, so that short pauses do not cause churn.
+const autoscaleCalm = 3
+
+// countedStrm counts the payload of a stream towards its connection's load.
+type countedStrm struct {
+	tnet.Strm
+	n *atomic.Uint64
+}
+
+func (s *countedStrm) Read(b []byte) (int, error) {
+	n, err := s.Strm.Read(b)
+	s.n.Add(uint64(n))
+	return n, err
+}
+
+func (s *countedStrm) Write(b []byte) (int, error) {
+	n, err := s.Strm.Write(b)
+	s.n.Add(uint64(n))
+	return n, err
+}
+
+func (s *countedStrm) WriteTo(w io.Writer) (int64, error) {
+	return tnet.WriteTo(s.Strm, w, s.count)
+}
+
+func (s *countedStrm) ReadFrom(r io.Reader) (int64, error) {
+	return tnet.ReadFrom(s.Strm, r, s.count)
+}
+
+func (s *countedStrm) count(n int) {
+	s.n.Add(uint64(n))
+}
+
+// active counts the default slots that take new streams.
+func (c *Client) active() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, tc := range c.iter.Items {
+		if !tc.parked && tc.group == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// autoscale adds a connection when the active ones carry more than
+// autoscale.target_mbps each on average or one of them is backlogged, and
+// removes one when the rest could carry the traffic at half the target for
+// several intervals. A removed connection takes no new streams and is
+// closed once its streams have finished; an added one connects on first use.
+// Connections of transport.groups keep their fixed number.
+func (c *Client) autoscale(ctx context.Context) {
+	cfg := c.cfg.Transport.Autoscale
+	every := time.Duration(cfg.Interval) * time.Second
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	last := make([]uint64, len(c.iter.Items))
+	calm := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		var active []*timedConn
+		var mbps float64
+		backlog := false
+		for i, tc := range c.iter.Items {
+			if tc.group != nil {
+				continue
+			}
+			n := tc.bytes.Load()
+			delta := n - last[i]
+			last[i] = n
+			if tc.parked {
+				c.closeDrained(tc)
+				continue
+			}
+			active = append(active, tc)
+			mbps += float64(delta) * 8 / every.Seconds() / 1e6
+			if stats, ok := tc.conn.(interface{ PacketStats() (uint64, int) }); ok {
+				if _, q := stats.PacketStats(); q > 0 {
+					backlog = true
+				}
+			}
+		}
+
+		n := len(active)
+		switch {
+		case (mbps >= cfg.TargetMbps*float64(n) || backlog) && n < cfg.Max:
+			calm = 0
+			for _, tc := range c.iter.Items {
+				if tc.parked && tc.group == nil {
+					tc.parked = false
+					reason := fmt.Sprintf("%.1f Mbit/s over %d connections", mbps, n)
+					if backlog {
+						reason += ", send queue backlogged"
+					}
+					tc.record(EventScaledUp, reason)
+					flog.Infof("autoscale: adding connection %d (%s)", tc.index+1, reason)
+					break
+				}
+			}
+		case n > cfg.Min && !backlog && mbps < cfg.TargetMbps*float64(n-1)/2:
+			if calm++; calm < autoscaleCalm {
+				break
+			}
+			calm = 0
+			tc := active[n-1]
+			tc.parked = true
+			reason := fmt.Sprintf("%.1f Mbit/s over %d connections", mbps, n)
+			tc.record(EventScaledDown, reason)
+			flog.Infof("autoscale: removing connection %d (%s)", tc.index+1, reason)
+			c.closeDrained(tc)
+		default:
+			calm = 0
+		}
+		c.mu.Unlock()
+	}
+}
+
+// closeDrained closes the connection of a parked slot once no stream other
+// than reserved ones is open on it. Callers hold c.mu.
+func (c *Client) closeDrained(tc *timedConn) {
+	if tc.conn == nil {
+		return
+	}
+	if n, ok := tc.conn.(interface{ NumStreams() int }); ok && n.NumStreams() > c.reserved(tc.conn) {
+		return
+	}
+	_ = tc.conn.Close()
+	tc.conn = nil
+	flog.Debugf("autoscale: connection %d closed", tc.index+1)
+}
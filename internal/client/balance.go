@@ -0,0 +1,133 @@
+package client
+
+import (
+	"io"
+	"math/rand/v2"
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// balancer picks the connection for a new stream among cands, the slots
+// fit to take it. cands is never empty.
+type balancer interface {
+	pick(cands []*timedConn) *timedConn
+}
+
+// newBalancer returns the balancer of performance.balance_strategy, or
+// nil for plain round-robin over c.iter.
+func newBalancer(strategy string) balancer {
+	switch strategy {
+	case conf.BalanceLeastStreams:
+		return &leastStreams{}
+	case conf.BalanceLowestRTT:
+		return &lowestRTT{}
+	case conf.BalanceWeighted:
+		return weighted{}
+	}
+	return nil
+}
+
+// leastStreams picks the connection with the fewest open streams. Ties are
+// broken by a rotating start, so idle connections still take turns.
+type leastStreams struct {
+	start atomic.Uint64
+}
+
+func (b *leastStreams) pick(cands []*timedConn) *timedConn {
+	off := int(b.start.Add(1) % uint64(len(cands)))
+	var best *timedConn
+	var bestN int64
+	for i := range cands {
+		tc := cands[(off+i)%len(cands)]
+		if n := tc.streams.Load(); best == nil || n < bestN {
+			best, bestN = tc, n
+		}
+	}
+	return best
+}
+
+// lowestRTT picks the connection with the lowest heartbeat round-trip
+// time, and takes turns while no connection has one.
+type lowestRTT struct {
+	start atomic.Uint64
+}
+
+func (b *lowestRTT) pick(cands []*timedConn) *timedConn {
+	var best *timedConn
+	var bestRTT time.Duration
+	for _, tc := range cands {
+		if rtt, _ := tc.rtt(); rtt > 0 && (best == nil || rtt < bestRTT) {
+			best, bestRTT = tc, rtt
+		}
+	}
+	if best == nil {
+		best = cands[b.start.Add(1)%uint64(len(cands))]
+	}
+	return best
+}
+
+// weighted picks a connection at random with a probability proportional
+// to the inverse of its round-trip time, so that a connection half as fast
+// gets half as many streams. Connections without a round-trip time yet
+// weigh as much as the fastest one, and connections whose heartbeat is
+// failing get no streams unless all of them are failing.
+type weighted struct{}
+
+func (weighted) pick(cands []*timedConn) *timedConn {
+	var fastest time.Duration
+	rtts := make([]time.Duration, len(cands))
+	failing := make([]bool, len(cands))
+	for i, tc := range cands {
+		rtts[i], failing[i] = tc.rtt()
+		if rtts[i] > 0 && (fastest == 0 || rtts[i] < fastest) {
+			fastest = rtts[i]
+		}
+	}
+	var total float64
+	weights := make([]float64, len(cands))
+	for i, rtt := range rtts {
+		switch {
+		case failing[i]:
+			weights[i] = 0
+		case rtt > 0:
+			weights[i] = float64(fastest) / float64(rtt)
+		default:
+			weights[i] = 1
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		return cands[rand.IntN(len(cands))]
+	}
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return cands[i]
+		}
+		r -= w
+	}
+	return cands[len(cands)-1]
+}
+
+// activeStrm counts a stream as open on its connection until it is closed.
+type activeStrm struct {
+	tnet.Strm
+	n      *atomic.Int64
+	closed sync.Once
+}
+
+func (s *activeStrm) WriteTo(w io.Writer) (int64, error) {
+	return tnet.WriteTo(s.Strm, w, nil)
+}
+
+func (s *activeStrm) ReadFrom(r io.Reader) (int64, error) {
+	return tnet.ReadFrom(s.Strm, r, nil)
+}
+
+func (s *activeStrm) Close() error {
+	s.closed.Do(func() { s.n.Add(-1) })
+	return s.Strm.Close()
+}
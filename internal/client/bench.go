@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"time"
+)
+
+// benchStrm opens a PBENCH stream asking the server to sink size bytes, or
+// to echo the stream when size is 0, and waits for the server's ack.
+func (c *Client) benchStrm(ctx context.Context, size int) (tnet.Strm, error) {
+	strm, err := c.newStrm(ctx, classAny)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := ctx.Deadline(); ok {
+		_ = strm.SetDeadline(d)
+	}
+	p := protocol.Proto{Type: protocol.PBENCH, Size: size}
+	if err := p.Write(strm); err == nil {
+		err = benchAck(strm)
+	}
+	if err != nil {
+		strm.Close()
+		return nil, err
+	}
+	return strm, nil
+}
+
+// benchAck reads the server's ack of a PBENCH stream.
+func benchAck(strm tnet.Strm) error {
+	var p protocol.Proto
+	if err := p.Read(strm); err != nil {
+		return err
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	if p.Type != protocol.PBENCH {
+		return fmt.Errorf("unexpected reply type %d", p.Type)
+	}
+	return nil
+}
+
+// BenchOpen returns how long it takes to open a stream and hear back from
+// the server on it, which is what a proxied connection waits before its
+// first byte.
+func (c *Client) BenchOpen(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	strm, err := c.benchStrm(ctx, 0)
+	if err != nil {
+		return 0, err
+	}
+	d := time.Since(start)
+	strm.Close()
+	return d, nil
+}
+
+// BenchEcho sends n messages of size bytes on one stream, each after the
+// previous one came back, and returns their round-trip times.
+func (c *Client) BenchEcho(ctx context.Context, n, size int) ([]time.Duration, error) {
+	strm, err := c.benchStrm(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer strm.Close()
+
+	msg, echo := make([]byte, size), make([]byte, size)
+	rtts := make([]time.Duration, 0, n)
+	for range n {
+		start := time.Now()
+		if _, err := strm.Write(msg); err != nil {
+			return rtts, err
+		}
+		if _, err := io.ReadFull(strm, echo); err != nil {
+			return rtts, err
+		}
+		rtts = append(rtts, time.Since(start))
+	}
+	return rtts, nil
+}
+
+// BenchUpload sends size bytes and returns the time until the server has
+// received all of them.
+func (c *Client) BenchUpload(ctx context.Context, size int) (time.Duration, error) {
+	strm, err := c.benchStrm(ctx, size)
+	if err != nil {
+		return 0, err
+	}
+	defer strm.Close()
+
+	buf := make([]byte, 32*1024)
+	start := time.Now()
+	for left := size; left > 0; {
+		n, err := strm.Write(buf[:min(left, len(buf))])
+		if err != nil {
+			return 0, err
+		}
+		left -= n
+	}
+	if err := benchAck(strm); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// BenchDownload asks the server for size bytes, as a throughput probe does,
+// and returns the time it took to receive them.
+func (c *Client) BenchDownload(ctx context.Context, size int) (time.Duration, error) {
+	strm, err := c.newStrm(ctx, classAny)
+	if err != nil {
+		return 0, err
+	}
+	defer strm.Close()
+	if d, ok := ctx.Deadline(); ok {
+		_ = strm.SetDeadline(d)
+	}
+
+	start := time.Now()
+	p := protocol.Proto{Type: protocol.PSPD, Size: size}
+	if err := p.Write(strm); err != nil {
+		return 0, err
+	}
+	if n, err := io.CopyN(io.Discard, strm, int64(size)); err != nil {
+		return 0, fmt.Errorf("received %d of %d bytes: %v", n, size, err)
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/metrics"
+	"sync"
+	"time"
+)
+
+// Breaker states, see BreakerStatus.
+const (
+	BreakerClosed   = "closed"    // dials go through
+	BreakerOpen     = "open"      // dials are refused until the cooldown ends
+	BreakerHalfOpen = "half_open" // one probe dial is under way
+)
+
+var (
+	// errCircuitOpen fails dials while the breaker is open, so that a
+	// server down for maintenance is not flooded with handshakes.
+	errCircuitOpen = errors.New("circuit open")
+	// errDialRate fails dials beyond transport.breaker.rate.
+	errDialRate = errors.New("dial rate limit reached")
+)
+
+// refused reports whether err is a dial the breaker did not let through.
+func refused(err error) bool {
+	return errors.Is(err, errCircuitOpen) || errors.Is(err, errDialRate)
+}
+
+// BreakerStatus is the state of the dial breaker, served on the admin API.
+type BreakerStatus struct {
+	Server   string    `json:"server"`
+	State    string    `json:"state"`
+	Since    time.Time `json:"since"`
+	Failures int       `json:"failures"`           // consecutive failed dials
+	Cooldown string    `json:"cooldown,omitempty"` // current cooldown while not closed
+	Retry    time.Time `json:"retry,omitzero"`     // when the next probe dial may start
+	Dials    int       `json:"dials_last_minute"`  // dials started in the last minute
+	Trips    int       `json:"trips"`              // times the circuit has opened
+	Refused  uint64    `json:"refused"`            // dials refused by state or rate
+	LastErr  string    `json:"last_error,omitempty"`
+}
+
+// breaker limits the dials of every connection slot to one server with
+// transport.breaker. Dials beyond rate per minute are refused. After
+// failures failed dials in a row the circuit opens and every dial is
+// refused for the cooldown; then one probe dial is let through, which
+// closes the circuit if it succeeds and reopens it with twice the cooldown,
+// up to max_cooldown, if it fails.
+type breaker struct {
+	cfg    conf.Breaker
+	server string
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	since    time.Time
+	fails    int
+	cooldown time.Duration
+	retry    time.Time   // end of the cooldown while open
+	dials    []time.Time // dial starts within the last minute
+	trips    int
+	lastErr  string
+
+	refused metrics.Counter
+}
+
+func newBreaker(cfg conf.Breaker, server string) *breaker {
+	return &breaker{
+		cfg:      cfg,
+		server:   server,
+		now:      time.Now,
+		state:    BreakerClosed,
+		since:    time.Now(),
+		cooldown: time.Duration(cfg.Cooldown) * time.Second,
+	}
+}
+
+// allow reports whether a dial may start now, and counts it if so.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch b.state {
+	case BreakerHalfOpen:
+		b.refused.Inc()
+		return fmt.Errorf("%w: probe dial to %s under way", errCircuitOpen, b.server)
+	case BreakerOpen:
+		if now.Before(b.retry) {
+			b.refused.Inc()
+			return fmt.Errorf("%w: %d dials to %s failed, next attempt in %s", errCircuitOpen, b.fails, b.server, b.retry.Sub(now).Round(time.Second))
+		}
+	}
+	if b.cfg.Rate > 0 {
+		b.trim(now)
+		if len(b.dials) >= b.cfg.Rate {
+			b.refused.Inc()
+			return fmt.Errorf("%w: %d dials to %s in the last minute", errDialRate, len(b.dials), b.server)
+		}
+	}
+	if b.state == BreakerOpen {
+		b.set(BreakerHalfOpen, now)
+		flog.Infof("dial breaker for %s half-open, probing the server", b.server)
+	}
+	b.dials = append(b.dials, now)
+	return nil
+}
+
+// done records the outcome of a dial allow let through. It returns the
+// history event for a state change, or "".
+func (b *breaker) done(err error) (event, reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if err == nil {
+		b.fails = 0
+		b.lastErr = ""
+		if b.state == BreakerClosed {
+			return "", ""
+		}
+		b.set(BreakerClosed, now)
+		b.cooldown = time.Duration(b.cfg.Cooldown) * time.Second
+		flog.Infof("dial breaker for %s closed, the server answers again", b.server)
+		return EventBreakerClosed, "probe dial succeeded"
+	}
+
+	b.fails++
+	b.lastErr = err.Error()
+	switch {
+	case b.state == BreakerHalfOpen:
+		b.cooldown = min(2*b.cooldown, time.Duration(b.cfg.MaxCooldown)*time.Second)
+	case b.cfg.Failures > 0 && b.fails >= b.cfg.Failures:
+	default:
+		return "", ""
+	}
+	b.set(BreakerOpen, now)
+	b.retry = now.Add(b.cooldown)
+	b.trips++
+	reason = fmt.Sprintf("%d failed dials, retrying in %s: %v", b.fails, b.cooldown, err)
+	flog.Warnf("dial breaker for %s open: %s", b.server, reason)
+	return EventBreakerOpen, reason
+}
+
+// reset closes the circuit for a new server, since the failures so far
+// were another server's. Recent dials still count towards the rate.
+func (b *breaker) reset(server string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.server = server
+	b.fails = 0
+	b.lastErr = ""
+	b.cooldown = time.Duration(b.cfg.Cooldown) * time.Second
+	if b.state != BreakerClosed {
+		b.set(BreakerClosed, b.now())
+	}
+}
+
+func (b *breaker) set(state string, now time.Time) {
+	b.state = state
+	b.since = now
+}
+
+// trim forgets dials older than a minute. b.mu must be held.
+func (b *breaker) trim(now time.Time) {
+	i := 0
+	for i < len(b.dials) && now.Sub(b.dials[i]) >= time.Minute {
+		i++
+	}
+	b.dials = b.dials[i:]
+}
+
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trim(b.now())
+	st := BreakerStatus{
+		Server:   b.server,
+		State:    b.state,
+		Since:    b.since,
+		Failures: b.fails,
+		Dials:    len(b.dials),
+		Trips:    b.trips,
+		Refused:  b.refused.Load(),
+		LastErr:  b.lastErr,
+	}
+	if b.state != BreakerClosed {
+		st.Cooldown = b.cooldown.String()
+		st.Retry = b.retry
+	}
+	return st
+}
+
+// BreakerStatus serves the state of the dial breaker.
+func (c *Client) BreakerStatus(_ *http.Request) (any, error) {
+	if c.breaker == nil {
+		return nil, fmt.Errorf("transport.breaker is not configured")
+	}
+	st := c.breaker.status()
+	return &st, nil
+}
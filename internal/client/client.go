@@ -2,46 +2,200 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
 	"paqet/internal/conf"
+	"paqet/internal/features"
 	"paqet/internal/flog"
+	"paqet/internal/metrics"
 	"paqet/internal/pkg/iterator"
+	"paqet/internal/pkg/ring"
+	"paqet/internal/socket"
+	"paqet/internal/state"
+	"paqet/internal/tap"
 	"paqet/internal/tnet"
+	"paqet/internal/tnet/framed"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Client struct {
+	id      string // transport.client_id or a random per-process ID, keys server-side leases
 	cfg     *conf.Conf
 	iter    *iterator.Iterator[*timedConn]
+	groups  map[string]*iterator.Iterator[*timedConn] // transport.groups connections, also in iter
 	udpPool *udpPool
+	probes  *ring.Ring[ProbeResult]
+	history *ring.Ring[ConnEvent] // connection lifecycle events
+	started time.Time
 	mu      sync.Mutex
+
+	lastActive atomic.Int64 // unix nanoseconds of the last stream request
+
+	streams      *metrics.Streams // nil unless metrics or the admin API are enabled
+	tap          *tap.Tap         // nil unless tap.socket is set
+	connsCreated metrics.Counter
+	retries      metrics.Counter
+	redials      metrics.Counter // connections replaced after failing heartbeats
+	framing      framed.Stats    // PUDP streams with transport.udp_framing
+	features     *features.Set
+	state        *state.Store // nil unless state.dir is set
+	sessions     tls.ClientSessionCache // QUIC session tickets, from state.dir or kept in memory
+
+	tuning   atomic.Pointer[transportTuning]
+	reloadMu sync.Mutex
+	reload   *ReloadStatus // last configuration reload, nil if none
+
+	reserveMu sync.Mutex
+	reserves  map[tnet.Conn]*reserve // streams opened ahead of use, see transport.prefetch
+
+	revMu        sync.Mutex
+	revHandlers  map[string]func(tnet.Strm) // reverse forwards by server listen address
+	revAccepting map[tnet.Conn]bool         // connections accepting server-opened streams
+
+	roaming roaming
+	paused  atomic.Bool // set while roaming has the tunnel paused
+
+	fast     atomic.Pointer[timedConn] // connection for interactive streams, nil unless transport.scheduling picked one
+	balancer balancer                  // nil for round-robin
+
+	breaker *breaker // nil unless transport.breaker is set
+	router  *router  // nil unless routing rules are set
+	servers *servers // server.addr and server.failover
+
+	fetches fetchState // publish.fetch files
 }
 
 func New(cfg *conf.Conf) (*Client, error) {
+	id := cfg.Transport.ClientID
+	if id == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		id = hex.EncodeToString(b)
+	}
 	c := &Client{
+		id:      id,
 		cfg:     cfg,
 		iter:    &iterator.Iterator[*timedConn]{},
 		udpPool: &udpPool{strms: make(map[uint64]tnet.Strm)},
+		probes:  ring.New[ProbeResult](cfg.Probe.History),
+		history: ring.New[ConnEvent](cfg.Admin.History),
+		started: time.Now(),
+
+		reserves: make(map[tnet.Conn]*reserve),
+
+		revHandlers:  make(map[string]func(tnet.Strm)),
+		revAccepting: make(map[tnet.Conn]bool),
+	}
+	if cfg.Metrics.Enabled() || cfg.Admin.Enabled() {
+		c.streams = metrics.NewStreams()
+	}
+	if cfg.State.Enabled() {
+		st, err := state.Open(cfg.State.Dir)
+		if err != nil {
+			return nil, err
+		}
+		c.state = st
+		c.sessions = st.Sessions()
+	} else {
+		c.sessions = tls.NewLRUClientSessionCache(0)
+	}
+	c.balancer = newBalancer(cfg.Performance.BalanceStrategy)
+	c.servers = newServers(cfg.Server.Addrs(), cfg.Server.Failover.Failures)
+	if cfg.Transport.Breaker.Enabled() {
+		c.breaker = newBreaker(cfg.Transport.Breaker, cfg.Server.Addr.String())
+	}
+	if cfg.Routing.Enabled() {
+		r, err := newRouter(&cfg.Routing)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load routing.geoip: %w", err)
+		}
+		c.router = r
+	}
+	c.tuning.Store(&transportTuning{KCP: cfg.Transport.KCP, QUIC: cfg.Transport.QUIC})
+	c.features = features.New()
+	if q := cfg.Transport.QUIC; cfg.Transport.Protocol == "quic" && q != nil {
+		c.features.Register(features.QUICPadding, "Pad QUIC handshake packets", "new connections", q.Padding.Enabled(), func(on bool) error {
+			if on && q.Padding.Max == 0 {
+				return fmt.Errorf("transport.quic.padding is not configured")
+			}
+			return nil
+		})
+		c.features.Register(features.QUICDatagrams, "Negotiate QUIC datagram support", "new connections", q.EnableDatagrams, nil)
 	}
 	return c, nil
 }
 
 func (c *Client) Start(ctx context.Context) error {
-	for i := range c.cfg.Transport.Conn {
-		tc, err := newTimedConn(ctx, c.cfg)
+	if c.cfg.Tap.Enabled() {
+		t, err := tap.Listen(c.cfg.Tap.Socket, c.cfg.Tap.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to start tap: %w", err)
+		}
+		c.tap = t
+		go func() {
+			<-ctx.Done()
+			t.Close()
+		}()
+		flog.Warnf("insecure debug tap serving decrypted stream activity on %s", c.cfg.Tap.Socket)
+	}
+	for i := range max(c.cfg.Transport.Conn, c.cfg.Transport.Autoscale.Max) {
+		tc := &timedConn{id: c.id, index: i, cfg: c.cfg, ctx: ctx, history: c.history, created: &c.connsCreated, features: c.features, tuning: &c.tuning, state: c.state, sessions: c.sessions, dead: c.redial, breaker: c.breaker, servers: c.servers}
+		if i >= c.cfg.Transport.Conn {
+			// Spare slot for autoscale, connected when it is brought in.
+			tc.parked = true
+			c.iter.Items = append(c.iter.Items, tc)
+			continue
+		}
+		conn, err := tc.createConn()
 		if err != nil {
+			// Keep the placeholder with conn=nil. newConn() checks for nil and
+			// calls createConn() on first use.
+			tc.createFailed(err)
 			flog.Warnf("connection %d could not be established at startup (%s), will retry on first use", i+1, err.Error())
-			// Add a placeholder with conn=nil. newConn() checks for nil and calls
-			// createConn() on first use, so all zero-value fields are safe here.
-			tc = &timedConn{cfg: c.cfg, ctx: ctx}
 		} else {
+			tc.conn = conn
+			tc.record(EventCreated, "startup")
 			flog.Debugf("client connection %d created successfully", i+1)
 		}
 		c.iter.Items = append(c.iter.Items, tc)
 	}
+	c.startGroups(ctx)
 	// Note: ticker() is currently disabled but kept for potential future use
 	// go c.ticker(ctx)
 	go c.monitorTransportStats(ctx)
+	if c.cfg.Probe.Enabled() {
+		go c.probe(ctx)
+	}
+	if c.cfg.Transport.IdleSuspend > 0 {
+		c.touch()
+		go c.suspendIdle(ctx)
+	}
+	if c.cfg.Transport.Autoscale.Enabled() {
+		go c.autoscale(ctx)
+	}
+	if c.cfg.Transport.Scheduling.Enabled() {
+		go c.schedule(ctx)
+	}
+	if c.cfg.Roaming.Enabled() {
+		c.roaming.status = RoamingStatus{State: RoamOnline, Since: time.Now()}
+		go c.roam(ctx)
+	}
+	if c.cfg.Server.Failover.Enabled() {
+		go c.failover(ctx)
+	}
+	if k := c.cfg.Transport.KCP; c.cfg.Transport.Protocol == "kcp" && k != nil && k.Bandwidth > 0 {
+		go c.tuneWindows(ctx)
+	}
+	if len(c.cfg.Publish.Fetch) > 0 {
+		c.fetches.files = make([]fetched, len(c.cfg.Publish.Fetch))
+		go c.syncPublished(ctx)
+	}
 
 	go func() {
 		<-ctx.Done()
@@ -59,7 +213,7 @@ func (c *Client) Start(ctx context.Context) error {
 	if c.cfg.Network.IPv6.Addr != nil {
 		ipv6Addr = c.cfg.Network.IPv6.Addr.IP.String()
 	}
-	flog.Infof("Client started: IPv4:%s IPv6:%s -> %s (%d connections)", ipv4Addr, ipv6Addr, c.cfg.Server.Addr, len(c.iter.Items))
+	flog.Infof("Client started: IPv4:%s IPv6:%s -> %s (%d connections)", ipv4Addr, ipv6Addr, c.servers.addr(), c.cfg.Transport.Conn)
 	return nil
 }
 
@@ -75,6 +229,7 @@ func (c *Client) monitorTransportStats(ctx context.Context) {
 		case <-ticker.C:
 			var dropped uint64
 			var queueDepth int
+			reasons := make(map[string]uint64)
 			for _, tc := range c.iter.Items {
 				if tc == nil || tc.conn == nil {
 					continue
@@ -86,14 +241,31 @@ func (c *Client) monitorTransportStats(ctx context.Context) {
 					dropped += d
 					queueDepth += q
 				}
+				if stats, ok := tc.conn.(interface {
+					DropStats() map[string]uint64
+				}); ok {
+					for r, n := range stats.DropStats() {
+						reasons[r] += n
+					}
+				}
 			}
 
 			if dropped > lastDropped || queueDepth > 0 {
-				flog.Warnf("client packet pressure: dropped=%d (+%d), queue_depth=%d",
-					dropped, dropped-lastDropped, queueDepth)
+				flog.Warnf("client packet pressure: dropped=%d (+%d) %s, queue_depth=%d",
+					dropped, dropped-lastDropped, socket.FormatDrops(reasons), queueDepth)
 			}
 			lastDropped = dropped
 		}
 	}
 }
 
+
+// track registers strm, a stream of kind, with metrics and the debug tap.
+func (c *Client) track(strm tnet.Strm, kind string) tnet.Strm {
+	return c.tap.Wrap(c.streams.Track(strm, kind), kind)
+}
+
+// Features returns the client's runtime switches.
+func (c *Client) Features() *features.Set {
+	return c.features
+}
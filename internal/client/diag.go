@@ -0,0 +1,59 @@
+package client
+
+import "time"
+
+// ConnState is the state of one transport connection slot in a diagnostic
+// dump.
+type ConnState struct {
+	Conn      int       `json:"conn"`
+	Group     string    `json:"group,omitempty"`
+	Local     string    `json:"local,omitempty"`
+	Up        bool      `json:"up"`
+	Suspended bool      `json:"suspended,omitempty"`
+	Parked    bool      `json:"parked,omitempty"`
+	Degraded  bool      `json:"degraded,omitempty"`
+	Expire    time.Time `json:"expire,omitzero"`
+	RTTMs     int64     `json:"rtt_ms,omitempty"` // smoothed heartbeat round trip
+	Reserved  int       `json:"reserved,omitempty"`
+	Streams   int64     `json:"streams,omitempty"` // open streams, counted under balance_strategy least_streams
+}
+
+// Connections returns the state of every transport connection slot.
+func (c *Client) Connections() any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conns := make([]ConnState, 0, len(c.iter.Items))
+	for _, tc := range c.iter.Items {
+		rtt, _ := tc.rtt()
+		s := ConnState{
+			Conn:      tc.index,
+			Up:        tc.conn != nil,
+			Suspended: tc.suspended,
+			Parked:    tc.parked,
+			Degraded:  tc.degraded.Load(),
+			Expire:    tc.expire,
+			RTTMs:     rtt.Milliseconds(),
+			Streams:   tc.streams.Load(),
+		}
+		if tc.group != nil {
+			s.Group = tc.group.Name
+		}
+		if tc.conn != nil {
+			s.Local = tc.conn.LocalAddr().String()
+			s.Reserved = c.reserved(tc.conn)
+		}
+		conns = append(conns, s)
+	}
+	return conns
+}
+
+// Pools returns the sizes of the client's stream pools.
+func (c *Client) Pools() any {
+	c.udpPool.mu.RLock()
+	udp := len(c.udpPool.strms)
+	c.udpPool.mu.RUnlock()
+	return map[string]any{
+		"udp_sessions": udp,
+		"paused":       c.paused.Load(),
+	}
+}
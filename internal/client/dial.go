@@ -1,19 +1,32 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"paqet/internal/conf"
 	"paqet/internal/flog"
+	"paqet/internal/protocol"
 	"paqet/internal/tnet"
+	"slices"
 	"time"
 )
 
-func (c *Client) newConn(forceCheck bool) (tnet.Conn, error) {
+func (c *Client) newConn(forceCheck bool, class streamClass, group string, avoid []*timedConn) (*timedConn, tnet.Conn, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	tc := c.iter.Next()
+	var tc *timedConn
+	if group != "" {
+		tc = c.nextIn(group)
+	} else {
+		tc = c.next(class)
+	}
+	if slices.Contains(avoid, tc) {
+		tc = c.other(tc, avoid)
+	}
 	if tc == nil {
-		return nil, fmt.Errorf("no available connections")
+		return nil, nil, fmt.Errorf("no available connections")
 	}
 
 	healthEvery := time.Duration(c.cfg.Performance.ConnectionHealthCheckMs) * time.Millisecond
@@ -29,17 +42,23 @@ func (c *Client) newConn(forceCheck bool) (tnet.Conn, error) {
 		flog.Infof("no active connection, creating transport connection")
 		c, err := tc.createConn()
 		if err != nil {
+			tc.createFailed(err)
 			flog.Errorf("failed to create transport connection: %s", err.Error())
-			return nil, fmt.Errorf("failed to create initial connection: %w", err)
+			return nil, nil, fmt.Errorf("failed to create initial connection: %w", err)
 		}
 		tc.conn = c
-		now := time.Now()
-		tc.expire = now.Add(300 * time.Second)
-		tc.lastHealthCheck = now
-		tc.lastTCPFSend = now
+		if tc.suspended {
+			tc.suspended = false
+			tc.record(EventCreated, "resumed after idle suspend")
+		} else {
+			tc.record(EventCreated, "first use")
+		}
 	}
 
 	now := time.Now()
+	if !tc.expire.IsZero() && now.After(tc.expire) {
+		tc.rotate("scheduled rotation")
+	}
 	if now.Sub(tc.lastTCPFSend) >= tcpfEvery {
 		if err := tc.sendTCPF(tc.conn); err != nil {
 			flog.Debugf("failed to refresh TCPF: %v", err)
@@ -48,62 +67,151 @@ func (c *Client) newConn(forceCheck bool) (tnet.Conn, error) {
 		}
 	}
 
-	if forceCheck || now.Sub(tc.lastHealthCheck) >= healthEvery {
+	// With heartbeats on, dead connections are replaced in the background
+	// and only retries check the connection here.
+	lazyCheck := !tc.heartbeat().Enabled() && now.Sub(tc.lastHealthCheck) >= healthEvery
+	if forceCheck || lazyCheck {
 		tc.lastHealthCheck = now
 		err := tc.conn.Ping(false)
 		if err == nil {
-			return tc.conn, nil
+			return tc, tc.conn, nil
 		}
 
+		reason := err.Error()
+		tc.record(EventHealthFailed, reason)
 		flog.Infof("connection lost, recreating transport connection")
 		if tc.conn != nil {
 			_ = tc.conn.Close()
 		}
 		c, err := tc.createConn()
 		if err != nil {
+			tc.createFailed(err)
 			flog.Errorf("failed to recreate connection: %s", err.Error())
-			return nil, fmt.Errorf("failed to recreate connection: %w", err)
+			return nil, nil, fmt.Errorf("failed to recreate connection: %w", err)
 		}
 		tc.conn = c
-		now = time.Now()
-		tc.expire = now.Add(300 * time.Second)
-		tc.lastHealthCheck = now
-		tc.lastTCPFSend = now
+		tc.record(EventRecreated, reason)
 	}
-	return tc.conn, nil
+	return tc, tc.conn, nil
 }
 
-func (c *Client) newStrm() (tnet.Strm, error) {
-	return c.newStrmWithRetry(0)
+// next returns the next connection in rotation, or the one chosen by
+// performance.balance_strategy, skipping connections whose last scheduled
+// probe failed while a healthy one is available, and slots parked by
+// autoscale. Under transport.scheduling, interactive streams go
+// to the fastest connection and bulk streams to any other. Connections of
+// transport.groups are left to nextIn.
+func (c *Client) next(class streamClass) *timedConn {
+	fast := c.fastest()
+	if class == classInteractive && fast != nil {
+		return fast
+	}
+	if c.balancer != nil {
+		return c.balance(class, fast)
+	}
+	var fallback *timedConn
+	for range c.iter.Items {
+		tc := c.iter.Next()
+		if tc.parked || tc.group != nil {
+			continue
+		}
+		if class == classBulk && tc == fast {
+			continue
+		}
+		if !tc.degraded.Load() {
+			return tc
+		}
+		fallback = tc
+	}
+	if class == classBulk && fast != nil {
+		return fast
+	}
+	return fallback
 }
 
-func (c *Client) newStrmWithRetry(attempt int) (tnet.Strm, error) {
+// balance is next under a performance.balance_strategy other than
+// round_robin: the balancer chooses among the healthy connections, or
+// among the degraded ones if there are no others.
+func (c *Client) balance(class streamClass, fast *timedConn) *timedConn {
+	var healthy, degraded []*timedConn
+	for _, tc := range c.iter.Items {
+		if tc.parked || tc.group != nil || (class == classBulk && tc == fast) {
+			continue
+		}
+		if tc.degraded.Load() {
+			degraded = append(degraded, tc)
+		} else {
+			healthy = append(healthy, tc)
+		}
+	}
+	switch {
+	case len(healthy) > 0:
+		return c.balancer.pick(healthy)
+	case len(degraded) > 0:
+		return c.balancer.pick(degraded)
+	case class == classBulk && fast != nil:
+		return fast
+	}
+	return nil
+}
+
+// newStrm opens a stream of class on the next connection, of the group
+// set on ctx by WithGroup if any, retrying with backoff on failure. It
+// gives up as soon as ctx is done, including mid-backoff.
+func (c *Client) newStrm(ctx context.Context, class streamClass) (tnet.Strm, error) {
+	c.touch()
+	if c.paused.Load() {
+		return nil, errPaused
+	}
+	group := groupOf(ctx)
+	legs := legsOf(ctx)
 	maxAttempts := c.cfg.Performance.MaxRetryAttempts
 	if maxAttempts <= 0 {
 		maxAttempts = 5
 	}
 
-	if attempt >= maxAttempts {
-		return nil, fmt.Errorf("failed to create stream after %d attempts", attempt)
-	}
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			c.retries.Inc()
+			t := time.NewTimer(c.calculateRetryBackoff(attempt - 1))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil, ctx.Err()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-	conn, err := c.newConn(attempt > 0)
-	if err != nil {
-		flog.Debugf("session creation failed (attempt %d/%d), retrying after backoff", attempt+1, maxAttempts)
-		backoff := c.calculateRetryBackoff(attempt)
-		time.Sleep(backoff)
-		return c.newStrmWithRetry(attempt + 1)
-	}
+		tc, conn, err := c.newConn(attempt > 0, class, group, legs.avoid())
+		// Neither an open breaker nor a psk mismatch gets better by retrying
+		if errors.Is(err, errCircuitOpen) || errors.Is(err, protocol.ErrAuthFailed) {
+			return nil, err
+		}
+		if err != nil {
+			flog.Debugf("session creation failed (attempt %d/%d), retrying after backoff", attempt+1, maxAttempts)
+			continue
+		}
 
-	strm, err := conn.OpenStrm()
-	if err != nil {
-		flog.Debugf("failed to open stream (attempt %d/%d), retrying: %v", attempt+1, maxAttempts, err)
-		backoff := c.calculateRetryBackoff(attempt)
-		time.Sleep(backoff)
-		return c.newStrmWithRetry(attempt + 1)
-	}
+		strm, err := c.openOn(ctx, tc, conn)
+		if err != nil {
+			flog.Debugf("failed to open stream (attempt %d/%d), retrying: %v", attempt+1, maxAttempts, err)
+			continue
+		}
 
-	return strm, nil
+		if c.cfg.Transport.Autoscale.Enabled() {
+			strm = &countedStrm{Strm: strm, n: &tc.bytes}
+		}
+		if c.cfg.Performance.BalanceStrategy == conf.BalanceLeastStreams {
+			tc.streams.Add(1)
+			strm = &activeStrm{Strm: strm, n: &tc.streams}
+		}
+		legs.add(tc)
+		return strm, nil
+	}
+	return nil, fmt.Errorf("failed to create stream after %d attempts", maxAttempts)
 }
 
 func (c *Client) calculateRetryBackoff(attempt int) time.Duration {
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"paqet/internal/tnet/dup"
+	"paqet/internal/tnet/multipath"
+	"slices"
+)
+
+// openStrm opens a stream and sends p as its header. With duplicate set
+// the stream is carried on two legs, see openDup; TUN and UDP streams are
+// spread over every connection when transport.multipath is on.
+func (c *Client) openStrm(ctx context.Context, p protocol.Proto, duplicate bool) (tnet.Strm, error) {
+	switch {
+	case duplicate:
+		return c.openDup(ctx, p)
+	case c.cfg.Transport.MultipathEnabled() && (p.Type == protocol.PUDP || p.Type == protocol.PTUN):
+		return c.openMultipath(ctx, p)
+	}
+	return c.openLeg(ctx, p)
+}
+
+// openLeg opens a single stream with header p.
+func (c *Client) openLeg(ctx context.Context, p protocol.Proto) (tnet.Strm, error) {
+	strm, err := c.newStrm(ctx, c.classify(&p))
+	if err != nil {
+		return nil, err
+	}
+	p.CID = strm.CID()
+	// Legs of multi-leg streams stay on the stream: their framing needs
+	// every byte in order, and so do offload frames.
+	d := datagramStrm(strm)
+	if d != nil && p.Dup == "" && !p.Offload && (p.Type == protocol.PUDP || p.Type == protocol.PTUN) {
+		p.Datagram = true
+	}
+	if err := p.Write(strm); err != nil {
+		flog.Debugf("failed to write protocol header on stream %s: %v", strm.CID(), err)
+		strm.Close()
+		return nil, err
+	}
+	if p.Datagram {
+		d.OfferDatagrams()
+		flog.Debugf("stream %s offers to carry its payload in QUIC datagrams", strm.CID())
+	}
+	return strm, nil
+}
+
+// datagramStrm returns the transport stream under strm if both peers
+// negotiated QUIC datagrams on its connection, or nil.
+func datagramStrm(strm tnet.Strm) tnet.DatagramStrm {
+	if s, ok := strm.(*countedStrm); ok {
+		strm = s.Strm
+	}
+	if d, ok := strm.(tnet.DatagramStrm); ok && d.SupportsDatagrams() {
+		return d
+	}
+	return nil
+}
+
+// openDup opens two streams on different transport connections, as long
+// as there are two, and sends the same header with a shared group ID on
+// both. The server merges the legs the same way, so
+// each side sees one stream that survives loss or a stall on either path.
+// If the second leg cannot be opened the stream runs on the first alone.
+func (c *Client) openDup(ctx context.Context, p protocol.Proto) (tnet.Strm, error) {
+	legs, err := c.openLegs(ctx, &p, 2)
+	if err != nil {
+		return nil, err
+	}
+	return dup.New(legs...), nil
+}
+
+// openMultipath opens one leg per transport connection for a datagram
+// stream, see package multipath.
+func (c *Client) openMultipath(ctx context.Context, p protocol.Proto) (tnet.Strm, error) {
+	p.Multipath = c.cfg.Transport.Multipath
+	mode, err := multipath.ParseMode(p.Multipath)
+	if err != nil {
+		return nil, err
+	}
+	legs, err := c.openLegs(ctx, &p, max(c.active(), 1))
+	if err != nil {
+		return nil, err
+	}
+	return multipath.New(mode, legs...), nil
+}
+
+// openLegs opens n streams sharing a new group ID in p and sends p on
+// each. It fails only if no leg could be opened, or if ctx is done.
+func (c *Client) openLegs(ctx context.Context, p *protocol.Proto, n int) ([]tnet.Strm, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate stream group ID: %w", err)
+	}
+	p.Dup = hex.EncodeToString(id)
+	if n != 2 {
+		p.Legs = n
+	}
+
+	var legs []tnet.Strm
+	ctx = context.WithValue(ctx, legsKey{}, &legConns{})
+	for range n {
+		if ctx.Err() != nil {
+			break
+		}
+		strm, err := c.openLeg(ctx, *p)
+		if err != nil {
+			flog.Debugf("failed to open leg %d of stream group %s: %v", len(legs)+1, p.Dup, err)
+			continue
+		}
+		legs = append(legs, strm)
+	}
+	if err := ctx.Err(); err != nil {
+		for _, strm := range legs {
+			strm.Close()
+		}
+		return nil, err
+	}
+	if len(legs) == 0 {
+		return nil, fmt.Errorf("failed to open any leg of stream group %s", p.Dup)
+	}
+	flog.Debugf("stream group %s opened on %d of %d legs", p.Dup, len(legs), n)
+	return legs, nil
+}
+
+type legsKey struct{}
+
+// legConns are the connections the legs of a stream group opened so far
+// use, which the next leg passes over while another one is available.
+type legConns struct {
+	used []*timedConn
+}
+
+// legsOf returns the legConns openLegs set on ctx, or nil.
+func legsOf(ctx context.Context) *legConns {
+	l, _ := ctx.Value(legsKey{}).(*legConns)
+	return l
+}
+
+func (l *legConns) avoid() []*timedConn {
+	if l == nil {
+		return nil
+	}
+	return l.used
+}
+
+func (l *legConns) add(tc *timedConn) {
+	if l != nil {
+		l.used = append(l.used, tc)
+	}
+}
+
+// other returns a usable connection of the same group as tc that is not in
+// avoid, preferring healthy ones, or tc if there is none. The caller holds
+// c.mu.
+func (c *Client) other(tc *timedConn, avoid []*timedConn) *timedConn {
+	var fallback *timedConn
+	for _, o := range c.iter.Items {
+		if o.parked || o.group != tc.group || slices.Contains(avoid, o) {
+			continue
+		}
+		if !o.degraded.Load() {
+			return o
+		}
+		if fallback == nil {
+			fallback = o
+		}
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return tc
+}
@@ -0,0 +1,259 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"paqet/internal/flog"
+	"paqet/internal/metrics"
+	"paqet/internal/tnet"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// servers holds server.addr and the server.failover servers, and which of
+// them the connection slots dial.
+type servers struct {
+	addrs    []*net.UDPAddr // in order of preference
+	failures int            // consecutive failures that switch servers
+
+	active   atomic.Int32
+	failed   atomic.Int32  // consecutive failures of the active server
+	kick     chan struct{} // wakes the failover loop once failed reaches failures
+	switches metrics.Counter
+
+	resume sync.Map // server address -> true once it has shown it can be resumed, see timedConn.greet
+
+	mu        sync.Mutex
+	recovered []int // consecutive passed probes, by server, while a less preferred one is active
+	since     time.Time
+	lastErr   string
+}
+
+func newServers(addrs []*net.UDPAddr, failures int) *servers {
+	return &servers{
+		addrs:     addrs,
+		failures:  failures,
+		kick:      make(chan struct{}, 1),
+		recovered: make([]int, len(addrs)),
+		since:     time.Now(),
+	}
+}
+
+// addr returns the server new connections go to.
+func (s *servers) addr() *net.UDPAddr {
+	return s.addrs[s.active.Load()]
+}
+
+// resumable reports whether a connection to server can skip waiting for
+// the format negotiation and the hello.
+func (s *servers) resumable(server string) bool {
+	ok, _ := s.resume.Load(server)
+	return ok == true
+}
+
+func (s *servers) setResumable(server string, ok bool) {
+	s.resume.Store(server, ok)
+}
+
+// done records the outcome of a dial or health probe of addr. Outcomes
+// for servers no longer in use are ignored.
+func (s *servers) done(addr *net.UDPAddr, err error) {
+	if addr != s.addr() {
+		return
+	}
+	if err == nil {
+		s.failed.Store(0)
+		return
+	}
+	s.mu.Lock()
+	s.lastErr = err.Error()
+	s.mu.Unlock()
+	if int(s.failed.Add(1)) == s.failures && len(s.addrs) > 1 {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// failover probes the servers every server.failover.interval until ctx is
+// done. After server.failover.failures failed dials, heartbeats or probes
+// of the active server, the client switches to the most preferred server
+// that answers a probe. While a less preferred server is active, the
+// preferred ones are probed and switched back to once they pass as many
+// probes in a row.
+func (c *Client) failover(ctx context.Context) {
+	t := time.NewTicker(time.Duration(c.cfg.Server.Failover.Interval) * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-c.servers.kick:
+		}
+		c.checkServers(ctx)
+	}
+}
+
+func (c *Client) checkServers(ctx context.Context) {
+	s := c.servers
+	active := int(s.active.Load())
+	s.done(s.addrs[active], c.pingActive(ctx))
+	if int(s.failed.Load()) >= s.failures {
+		for i, addr := range s.addrs {
+			if i == active || ctx.Err() != nil {
+				continue
+			}
+			if err := c.probeServer(ctx, addr); err != nil {
+				flog.Debugf("failover: server %s does not answer either: %v", addr, err)
+				continue
+			}
+			c.switchServer(i, fmt.Sprintf("%d consecutive failures of %s", s.failed.Load(), s.addrs[active]))
+			return
+		}
+		flog.Warnf("failover: server %s is failing and no other server answers", s.addrs[active])
+		return
+	}
+
+	for i := range active {
+		err := c.probeServer(ctx, s.addrs[i])
+		s.mu.Lock()
+		if err != nil {
+			s.recovered[i] = 0
+		} else {
+			s.recovered[i]++
+		}
+		back := s.recovered[i] >= s.failures
+		s.mu.Unlock()
+		if back {
+			c.switchServer(i, fmt.Sprintf("preferred server %s answers again", s.addrs[i]))
+			return
+		}
+	}
+}
+
+// pingActive pings the active server over one of the live connections.
+// With none up there is nothing to check; failed dials count instead.
+func (c *Client) pingActive(ctx context.Context) error {
+	c.mu.Lock()
+	conn := c.liveConn()
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	_, err := c.ping(ctx, conn, time.Duration(c.cfg.Server.Failover.Timeout)*time.Millisecond)
+	return err
+}
+
+// probeServer dials addr on a connection of its own and pings it.
+func (c *Client) probeServer(ctx context.Context, addr *net.UDPAddr) error {
+	tc := c.iter.Items[0]
+	conn, err := tc.dialAddr(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if c.cfg.Transport.PSK != "" {
+		if _, err := tc.sendHello(conn); err != nil {
+			return err
+		}
+	}
+	_, err = c.ping(ctx, conn, time.Duration(c.cfg.Server.Failover.Timeout)*time.Millisecond)
+	return err
+}
+
+// switchServer makes the server at index i the active one and moves every
+// connection over to it. Streams on the old connections keep running until
+// they end or the drain timeout passes, as after a rotation.
+func (c *Client) switchServer(i int, reason string) {
+	s := c.servers
+	from := s.addr()
+	s.active.Store(int32(i))
+	s.failed.Store(0)
+	s.switches.Inc()
+	s.mu.Lock()
+	clear(s.recovered)
+	s.since = time.Now()
+	s.mu.Unlock()
+	if c.breaker != nil {
+		c.breaker.reset(s.addrs[i].String())
+	}
+	flog.Warnf("failover: switching from server %s to %s (%s)", from, s.addrs[i], reason)
+
+	// Each slot is dialed without c.mu, so stream requests keep using the
+	// old connections meanwhile, and swapped under it.
+	c.mu.Lock()
+	var slots []*timedConn
+	for _, tc := range c.iter.Items {
+		if !tc.parked && tc.conn != nil {
+			slots = append(slots, tc)
+		}
+	}
+	c.mu.Unlock()
+	for _, tc := range slots {
+		conn, err := tc.connect()
+		c.mu.Lock()
+		old := tc.conn
+		switch {
+		case err != nil:
+			tc.createFailed(err)
+			flog.Warnf("failover: connection %d could not be moved to %s (%v), will retry on first use", tc.index+1, s.addrs[i], err)
+			if old != nil {
+				tc.unwatch()
+				tc.conn = nil
+				go drainConn(old, tc.drainTimeout())
+			}
+		case old == nil:
+			// Suspended, paused or failed meanwhile; the next stream
+			// request dials the new server.
+			_ = conn.Close()
+		default:
+			tc.adopt(conn)
+			tc.conn = conn
+			tc.record(EventFailover, fmt.Sprintf("%s -> %s: %s", from, s.addrs[i], reason))
+			go drainConn(old, tc.drainTimeout())
+		}
+		c.mu.Unlock()
+	}
+}
+
+// FailoverStatus reports the configured servers and which one is in use.
+type FailoverStatus struct {
+	Active   string    `json:"active"`
+	Since    time.Time `json:"since"`
+	Servers  []string  `json:"servers"`  // in order of preference
+	Failures int       `json:"failures"` // consecutive failures of the active server
+	Switches uint64    `json:"switches"`
+	LastErr  string    `json:"last_error,omitempty"`
+}
+
+// FailoverStatus serves the state of server failover.
+func (c *Client) FailoverStatus(_ *http.Request) (any, error) {
+	if !c.cfg.Server.Failover.Enabled() {
+		return nil, fmt.Errorf("server.failover is not configured")
+	}
+	s := c.servers
+	st := FailoverStatus{Active: s.addr().String(), Failures: int(s.failed.Load()), Switches: s.switches.Load()}
+	for _, a := range s.addrs {
+		st.Servers = append(st.Servers, a.String())
+	}
+	s.mu.Lock()
+	st.Since, st.LastErr = s.since, s.lastErr
+	s.mu.Unlock()
+	return &st, nil
+}
+
+// liveConn returns the first live, unparked connection, or nil. c.mu must
+// be held.
+func (c *Client) liveConn() tnet.Conn {
+	for _, tc := range c.iter.Items {
+		if tc.conn != nil && !tc.parked {
+			return tc.conn
+		}
+	}
+	return nil
+}
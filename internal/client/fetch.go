@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Fetch downloads the file the server publishes as name into w. have is
+// the SHA-256 of the copy the caller already has, if any; when the server's
+// version matches it nothing is written. Fetch returns the hash of the
+// server's version and whether it was written. The exchange is abandoned
+// when ctx is done.
+func (c *Client) Fetch(ctx context.Context, name string, have []byte, w io.Writer) ([]byte, bool, error) {
+	strm, err := c.newStrm(ctx, classBulk)
+	if err != nil {
+		return nil, false, err
+	}
+	defer strm.Close()
+	stop := context.AfterFunc(ctx, func() { strm.Close() })
+	defer stop()
+
+	p := protocol.Proto{Type: protocol.PFETCH, Name: name, Hash: have}
+	if err := p.Write(strm); err != nil {
+		return nil, false, fmt.Errorf("failed to send fetch request: %w", err)
+	}
+	if err := p.Read(strm); err != nil {
+		return nil, false, fmt.Errorf("failed to read fetch reply: %w", err)
+	}
+	if err := p.Err(); err != nil {
+		return nil, false, err
+	}
+	if p.Type != protocol.PFETCH || len(p.Hash) != sha256.Size {
+		return nil, false, fmt.Errorf("unexpected reply type %d", p.Type)
+	}
+	if bytes.Equal(p.Hash, have) {
+		return p.Hash, false, nil
+	}
+
+	h := sha256.New()
+	n, err := io.CopyN(io.MultiWriter(w, h), strm, int64(p.Size))
+	if err != nil {
+		return nil, false, fmt.Errorf("received %d of %d bytes: %w", n, p.Size, err)
+	}
+	if !bytes.Equal(h.Sum(nil), p.Hash) {
+		return nil, false, fmt.Errorf("content of %s does not match its hash", name)
+	}
+	flog.Debugf("fetched published file %s (%d bytes) on stream %s", name, n, strm.CID())
+	return p.Hash, true, nil
+}
+
+// fetchTimeout bounds one check of a publish.fetch file, download included.
+const fetchTimeout = 10 * time.Minute
+
+// fetched is the outcome of the last check of one publish.fetch file.
+type fetched struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Hash    string    `json:"sha256,omitempty"`
+	Checked time.Time `json:"checked"`
+	Updated time.Time `json:"updated,omitzero"`
+	LastErr string    `json:"last_error,omitempty"`
+}
+
+// fetchState holds the publish.fetch status served on the admin API.
+type fetchState struct {
+	mu    sync.Mutex
+	files []fetched
+}
+
+// syncPublished keeps the publish.fetch files in step with the server,
+// checking at startup and every publish.interval until ctx is done.
+func (c *Client) syncPublished(ctx context.Context) {
+	t := time.NewTicker(time.Duration(c.cfg.Publish.Interval) * time.Second)
+	defer t.Stop()
+	for {
+		for i, f := range c.cfg.Publish.Fetch {
+			if ctx.Err() != nil {
+				return
+			}
+			st := fetched{Name: f.Name, Path: f.Path, Checked: time.Now()}
+			fctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+			hash, changed, err := c.fetchFile(fctx, f.Name, f.Path)
+			cancel()
+			if err != nil {
+				st.LastErr = err.Error()
+				flog.Warnf("failed to fetch published file %s: %v", f.Name, err)
+			} else {
+				st.Hash = hex.EncodeToString(hash)
+				if changed {
+					st.Updated = st.Checked
+					flog.Infof("updated %s from published file %s", f.Path, f.Name)
+				}
+			}
+			c.fetches.mu.Lock()
+			if st.Updated.IsZero() {
+				st.Updated = c.fetches.files[i].Updated
+			}
+			c.fetches.files[i] = st
+			c.fetches.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// fetchFile replaces path with the server's version of name if it differs.
+// The new content is written next to path and renamed over it, so readers
+// never see a partial file.
+func (c *Client) fetchFile(ctx context.Context, name, path string) ([]byte, bool, error) {
+	have, err := hashFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, false, err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(tmp)
+	hash, changed, err := c.Fetch(ctx, name, have, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || !changed {
+		return hash, false, err
+	}
+	if fi, err := os.Stat(path); err == nil {
+		_ = os.Chmod(tmp, fi.Mode().Perm())
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, false, err
+	}
+	return hash, true, nil
+}
+
+// hashFile returns the SHA-256 of the file at path.
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// FetchStatus serves the outcome of the last check of each publish.fetch
+// file.
+func (c *Client) FetchStatus(_ *http.Request) (any, error) {
+	if len(c.cfg.Publish.Fetch) == 0 {
+		return nil, fmt.Errorf("publish.fetch is not configured")
+	}
+	c.fetches.mu.Lock()
+	defer c.fetches.mu.Unlock()
+	return append([]fetched{}, c.fetches.files...), nil
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/pkg/iterator"
+)
+
+type groupKey struct{}
+
+// WithGroup makes the streams opened with ctx use the connections of the
+// transport.groups entry called name. An empty name leaves ctx as it is,
+// on the default connections.
+func WithGroup(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, groupKey{}, name)
+}
+
+// groupOf returns the group set on ctx by WithGroup, or "".
+func groupOf(ctx context.Context) string {
+	name, _ := ctx.Value(groupKey{}).(string)
+	return name
+}
+
+// startGroups sets up the connections of transport.groups after the
+// default ones, dialing them as Start does.
+func (c *Client) startGroups(ctx context.Context) {
+	c.groups = make(map[string]*iterator.Iterator[*timedConn])
+	for i := range c.cfg.Transport.Groups {
+		g := &c.cfg.Transport.Groups[i]
+		it := &iterator.Iterator[*timedConn]{}
+		for range g.Conn {
+			tc := &timedConn{id: c.id, index: len(c.iter.Items), group: g, cfg: c.cfg, ctx: ctx, history: c.history, created: &c.connsCreated, features: c.features, tuning: &c.tuning, state: c.state, sessions: c.sessions, dead: c.redial, breaker: c.breaker, servers: c.servers}
+			conn, err := tc.createConn()
+			if err != nil {
+				tc.createFailed(err)
+				flog.Warnf("connection %d of group %s could not be established at startup (%s), will retry on first use", tc.index+1, g.Name, err.Error())
+			} else {
+				tc.conn = conn
+				tc.record(EventCreated, "startup")
+				flog.Debugf("client connection %d of group %s created successfully", tc.index+1, g.Name)
+			}
+			c.iter.Items = append(c.iter.Items, tc)
+			it.Items = append(it.Items, tc)
+		}
+		c.groups[g.Name] = it
+	}
+}
+
+// nextIn returns the next connection of the group called name in
+// rotation, skipping connections whose last scheduled probe failed while
+// a healthy one is available.
+func (c *Client) nextIn(name string) *timedConn {
+	it := c.groups[name]
+	if it == nil {
+		return nil
+	}
+	var fallback *timedConn
+	for range it.Items {
+		tc := it.Next()
+		if !tc.degraded.Load() {
+			return tc
+		}
+		fallback = tc
+	}
+	return fallback
+}
+
+// heartbeat returns the heartbeat policy of tc: its group's, or
+// transport.heartbeat for the default connections.
+func (tc *timedConn) heartbeat() *conf.Heartbeat {
+	if tc.group != nil {
+		return &tc.group.Heartbeat
+	}
+	return &tc.cfg.Transport.Heartbeat
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"paqet/internal/flog"
+	"paqet/internal/tnet"
+	"paqet/internal/tnet/heartbeat"
+	"time"
+)
+
+// watch starts the heartbeat of conn, a freshly set up connection of tc,
+// and stops the one of the connection it supersedes.
+func (tc *timedConn) watch(conn tnet.Conn) {
+	h := tc.heartbeat()
+	if !h.Enabled() {
+		return
+	}
+	tc.unwatch()
+	m := heartbeat.New(conn, heartbeat.Config{
+		Interval: time.Duration(h.Interval) * time.Second,
+		Timeout:  time.Duration(h.Timeout) * time.Millisecond,
+		Failures: h.Failures,
+		Gob:      tc.isGob(conn),
+	})
+	ctx, cancel := context.WithCancel(tc.ctx)
+	tc.monitor.Store(m)
+	tc.stopMonitor = cancel
+	go func() {
+		if err := m.Run(ctx); err != nil {
+			tc.dead(tc, conn, err)
+		}
+	}()
+}
+
+// unwatch stops the heartbeat of tc's connection.
+func (tc *timedConn) unwatch() {
+	if tc.stopMonitor != nil {
+		tc.stopMonitor()
+		tc.stopMonitor = nil
+	}
+	tc.monitor.Store(nil)
+}
+
+// redial replaces conn, which stopped answering heartbeats, unless it has
+// been replaced already. The slot is empty while the new connection is
+// dialed without c.mu, so stream requests are not held up; if one dials
+// the slot meanwhile, its connection is kept. If the new dial fails too,
+// the slot is left empty and newConn dials again on the next stream
+// request.
+func (c *Client) redial(tc *timedConn, conn tnet.Conn, err error) {
+	c.mu.Lock()
+	if tc.conn != conn {
+		c.mu.Unlock()
+		return
+	}
+	c.redials.Inc()
+	c.servers.done(c.servers.addr(), err)
+	reason := "heartbeat: " + err.Error()
+	tc.record(EventHealthFailed, reason)
+	flog.Warnf("connection %d stopped answering heartbeats (%v), re-dialing", tc.index+1, err)
+	_ = conn.Close()
+	tc.monitor.Store(nil)
+	tc.conn = nil
+	c.mu.Unlock()
+
+	next, err := tc.connect()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		tc.createFailed(err)
+		flog.Errorf("failed to re-dial connection %d: %v", tc.index+1, err)
+		return
+	}
+	if tc.conn != nil || tc.suspended || c.paused.Load() {
+		_ = next.Close()
+		return
+	}
+	tc.adopt(next)
+	tc.conn = next
+	tc.record(EventRecreated, reason)
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Connection lifecycle events recorded in the client's history.
+const (
+	EventCreated       = "created"
+	EventCreateFailed  = "create_failed"
+	EventHealthFailed  = "health_check_failed"
+	EventRecreated     = "recreated"
+	EventRotated       = "rotated"
+	EventProbeFailed   = "probe_failed"
+	EventRecovered     = "recovered"
+	EventSuspended     = "suspended"
+	EventScaledUp      = "scaled_up"
+	EventScaledDown    = "scaled_down"
+	EventBreakerOpen   = "breaker_open"
+	EventBreakerClosed = "breaker_closed"
+	EventFailover      = "failover"
+)
+
+// ConnEvent is one entry in the connection history.
+type ConnEvent struct {
+	Time   time.Time `json:"time"`
+	Conn   int       `json:"conn"`
+	Event  string    `json:"event"`
+	Reason string    `json:"reason,omitempty"`
+	Local  string    `json:"local,omitempty"`
+}
+
+// record appends a lifecycle event for tc to the client history.
+func (tc *timedConn) record(event, reason string) {
+	e := ConnEvent{Time: time.Now(), Conn: tc.index, Event: event, Reason: reason}
+	if tc.conn != nil {
+		e.Local = tc.conn.LocalAddr().String()
+	}
+	tc.history.Push(e)
+}
+
+// createFailed records a failed createConn. Dials the breaker refused are
+// left out: they never reached the server, and the breaker records its own
+// state changes.
+func (tc *timedConn) createFailed(err error) {
+	if !refused(err) {
+		tc.record(EventCreateFailed, err.Error())
+	}
+}
+
+// ConnHistory serves the connection history, optionally limited to events
+// newer than ?since=<duration> (e.g. 12h).
+func (c *Client) ConnHistory(req *http.Request) (any, error) {
+	var after time.Time
+	if s := req.URL.Query().Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since %q: %v", s, err)
+		}
+		after = time.Now().Add(-d)
+	}
+	events := []ConnEvent{}
+	for _, e := range c.history.Items() {
+		if e.Time.After(after) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
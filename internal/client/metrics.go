@@ -0,0 +1,76 @@
+package client
+
+import (
+	"paqet/internal/conf"
+	"paqet/internal/metrics"
+	"slices"
+	"strconv"
+)
+
+// Collect writes the client's metrics for the /metrics endpoint.
+func (c *Client) Collect(w *metrics.Writer) {
+	w.Counter("paqet_connections_created_total", "Transport connections established to the server.", c.connsCreated.Load())
+	w.Counter("paqet_stream_retries_total", "Stream open attempts retried after a failure.", c.retries.Load())
+	c.streams.Collect(w)
+	if c.cfg.Transport.Autoscale.Enabled() {
+		w.Gauge("paqet_connections_active", "Transport connection slots taking new streams under autoscale.", int64(c.active()))
+	}
+	if c.cfg.Transport.Heartbeat.Enabled() || slices.ContainsFunc(c.cfg.Transport.Groups, func(g conf.Group) bool { return g.Heartbeat.Enabled() }) {
+		w.Counter("paqet_heartbeat_redials_total", "Transport connections re-dialed after failing heartbeats.", c.redials.Load())
+		for _, tc := range c.iter.Items {
+			if m := tc.monitor.Load(); m != nil {
+				w.Gauge("paqet_heartbeat_rtt_milliseconds", "Smoothed heartbeat round-trip time, by connection.", m.Stats().RTT.Milliseconds(), "conn", strconv.Itoa(tc.index))
+			}
+		}
+	}
+	if c.breaker != nil {
+		st := c.breaker.status()
+		var open int64
+		if st.State != BreakerClosed {
+			open = 1
+		}
+		w.Gauge("paqet_breaker_open", "Whether the dial breaker refuses dials to the server (1 open, 0 closed).", open)
+		w.Counter("paqet_breaker_refused_total", "Transport connection dials refused by the breaker's state or rate limit.", st.Refused)
+		w.Counter("paqet_breaker_trips_total", "Times the dial breaker has opened.", uint64(st.Trips))
+	}
+	if c.cfg.Transport.UDPFraming.Mode != "off" {
+		w.Counter("paqet_udp_framed_datagrams_total", "Datagrams sent on length-framed UDP streams.", c.framing.Datagrams.Load())
+		w.Counter("paqet_udp_framing_delay_microseconds_total", "Time spent pacing and writing framed datagrams.", c.framing.Delay.Load())
+	}
+	if c.cfg.Server.Failover.Enabled() {
+		w.Gauge("paqet_server_active", "Index of the server in use: 0 for server.addr, then server.failover.servers by priority.", int64(c.servers.active.Load()))
+		w.Counter("paqet_failover_switches_total", "Failovers and failbacks between servers.", c.servers.switches.Load())
+	}
+	if c.router != nil {
+		c.router.collect(w)
+	}
+	if c.cfg.Transport.Scheduling.Enabled() {
+		fast := int64(-1)
+		if tc := c.fast.Load(); tc != nil {
+			fast = int64(tc.index)
+		}
+		w.Gauge("paqet_interactive_connection", "Connection interactive streams are scheduled on, -1 for any.", fast)
+	}
+
+	drops := make(map[string]uint64)
+	for _, tc := range c.iter.Items {
+		if tc == nil || tc.conn == nil {
+			continue
+		}
+		if stats, ok := tc.conn.(interface {
+			DropStats() map[string]uint64
+		}); ok {
+			for r, n := range stats.DropStats() {
+				drops[r] += n
+			}
+		}
+	}
+	reasons := make([]string, 0, len(drops))
+	for r := range drops {
+		reasons = append(reasons, r)
+	}
+	slices.Sort(reasons)
+	for _, r := range reasons {
+		w.Counter("paqet_packets_dropped_total", "Outgoing packets dropped by the raw socket, by reason.", drops[r], "reason", r)
+	}
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"net/netip"
+	"paqet/internal/flog"
+	"paqet/internal/pkg/nat64"
+	"paqet/internal/tnet"
+)
+
+// unmapTarget turns IPv6 forms of IPv4 destinations back into IPv4 before
+// they are sent to the server. On an IPv6-only network, DNS64 hands local
+// applications addresses in the NAT64 prefix, which mean nothing on the
+// server's network; IPv4-mapped addresses are unmapped for the same reason.
+func (c *Client) unmapTarget(addr *tnet.Addr) {
+	ip, err := netip.ParseAddr(addr.Host)
+	if err != nil {
+		return
+	}
+	switch {
+	case ip.Is4In6():
+		ip = ip.Unmap()
+	case c.cfg.Network.NAT64.IsValid():
+		v4, ok := nat64.Extract(c.cfg.Network.NAT64, ip)
+		if !ok {
+			return
+		}
+		flog.Debugf("target %s is NAT64-synthesized, sending %s", addr.Host, v4)
+		ip = v4
+	default:
+		return
+	}
+	addr.Host = ip.String()
+}
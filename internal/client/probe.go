@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/socket"
+	"paqet/internal/tnet"
+	"strconv"
+	"time"
+)
+
+// ProbeResult is one scheduled measurement of a client connection.
+type ProbeResult struct {
+	Time   time.Time `json:"time"`
+	Conn   int       `json:"conn"`
+	Server string    `json:"server"`
+	Kind   string    `json:"kind"` // "latency" or "throughput"
+	RTTMs  float64   `json:"rtt_ms,omitempty"`
+	Mbps   float64   `json:"mbps,omitempty"`
+	UpMbps float64   `json:"up_mbps,omitempty"` // with pacing_rate "auto"
+	Error  string    `json:"error,omitempty"`
+}
+
+// probe runs the scheduled latency and throughput probes until ctx is done.
+func (c *Client) probe(ctx context.Context) {
+	cfg := c.cfg.Probe
+	latency := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+	defer latency.Stop()
+	var throughput <-chan time.Time
+	if cfg.ThroughputInterval > 0 {
+		t := time.NewTicker(time.Duration(cfg.ThroughputInterval) * time.Second)
+		defer t.Stop()
+		throughput = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-latency.C:
+			c.runProbes(ctx, "latency", c.probeLatency)
+		case <-throughput:
+			c.runProbes(ctx, "throughput", c.probeThroughput)
+		}
+	}
+}
+
+func (c *Client) runProbes(ctx context.Context, kind string, fn func(context.Context, tnet.Conn, *ProbeResult) error) {
+	for i, tc := range c.iter.Items {
+		if ctx.Err() != nil {
+			return
+		}
+		c.mu.Lock()
+		conn, suspended, parked := tc.conn, tc.suspended, tc.parked
+		c.mu.Unlock()
+		if suspended && conn == nil {
+			continue // probing would wake the suspended connection's radio
+		}
+		if parked {
+			continue
+		}
+
+		r := ProbeResult{Time: time.Now(), Conn: i, Server: c.servers.addr().String(), Kind: kind}
+		err := fmt.Errorf("no active connection")
+		if conn != nil {
+			err = fn(ctx, conn, &r)
+		}
+		c.mu.Lock()
+		if err != nil {
+			r.Error = err.Error()
+			if !tc.degraded.Swap(true) {
+				tc.record(EventProbeFailed, fmt.Sprintf("%s: %v", kind, err))
+				flog.Warnf("%s probe failed on connection %d: %v", kind, i+1, err)
+			}
+			// Force a health check (and reconnect) on the next use.
+			tc.lastHealthCheck = time.Time{}
+		} else if tc.degraded.Swap(false) {
+			tc.record(EventRecovered, kind+" probe")
+			flog.Infof("connection %d recovered (%s probe)", i+1, kind)
+		}
+		c.mu.Unlock()
+		c.probes.Push(r)
+	}
+}
+
+func (c *Client) probeLatency(ctx context.Context, conn tnet.Conn, r *ProbeResult) error {
+	rtt, err := c.ping(ctx, conn, time.Duration(c.cfg.Probe.Timeout)*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	r.RTTMs = float64(rtt.Microseconds()) / 1000
+	return nil
+}
+
+// ping sends a PPING on a new stream of conn and returns the round-trip
+// time of its PPONG.
+func (c *Client) ping(ctx context.Context, conn tnet.Conn, timeout time.Duration) (time.Duration, error) {
+	strm, err := c.open(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	defer strm.Close()
+	_ = strm.SetDeadline(time.Now().Add(timeout))
+
+	start := time.Now()
+	p := protocol.Proto{Type: protocol.PPING}
+	if err := p.Write(strm); err != nil {
+		return 0, err
+	}
+	if err := p.Read(strm); err != nil {
+		return 0, err
+	}
+	if err := p.Err(); err != nil {
+		return 0, err
+	}
+	if p.Type != protocol.PPONG {
+		return 0, fmt.Errorf("unexpected reply type %d", p.Type)
+	}
+	return time.Since(start), nil
+}
+
+func (c *Client) probeThroughput(ctx context.Context, conn tnet.Conn, r *ProbeResult) error {
+	strm, err := c.open(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer strm.Close()
+	// Allow for a slow link: the timeout covers the first byte, plus 1s per 128KB.
+	size := c.cfg.Probe.ThroughputBytes
+	timeout := time.Duration(c.cfg.Probe.Timeout)*time.Millisecond + time.Duration(size/(128<<10))*time.Second
+	_ = strm.SetDeadline(time.Now().Add(timeout))
+
+	start := time.Now()
+	p := protocol.Proto{Type: protocol.PSPD, Size: size}
+	if err := p.Write(strm); err != nil {
+		return err
+	}
+	n, err := io.CopyN(io.Discard, strm, int64(size))
+	if err != nil {
+		return fmt.Errorf("received %d of %d bytes: %v", n, size, err)
+	}
+	r.Mbps = float64(n*8) / time.Since(start).Seconds() / 1e6
+	if c.cfg.Network.PCAP.PacingAuto {
+		// Pacing applies to what the client sends, so it follows the
+		// upload direction.
+		up, err := c.probeUpload(ctx, conn, size, timeout)
+		if err != nil {
+			return fmt.Errorf("upload: %v", err)
+		}
+		r.UpMbps = up
+		// Leave headroom so pacing follows the path instead of capping it
+		// at the last measurement.
+		socket.SetPacingRate(c.cfg.Network.Interface_, up*1.25)
+	}
+	return nil
+}
+
+// probeUpload sends size bytes on a PBENCH stream of conn and returns the
+// rate at which the server received them, in Mbit/s.
+func (c *Client) probeUpload(ctx context.Context, conn tnet.Conn, size int, timeout time.Duration) (float64, error) {
+	strm, err := c.open(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	defer strm.Close()
+	_ = strm.SetDeadline(time.Now().Add(timeout))
+
+	p := protocol.Proto{Type: protocol.PBENCH, Size: size}
+	if err := p.Write(strm); err != nil {
+		return 0, err
+	}
+	if err := benchAck(strm); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 32*1024)
+	start := time.Now()
+	for left := size; left > 0; {
+		n, err := strm.Write(buf[:min(left, len(buf))])
+		if err != nil {
+			return 0, fmt.Errorf("sent %d of %d bytes: %v", size-left, size, err)
+		}
+		left -= n
+	}
+	if err := benchAck(strm); err != nil {
+		return 0, err
+	}
+	return float64(size*8) / time.Since(start).Seconds() / 1e6, nil
+}
+
+// ProbeHistory serves the recorded probe results, optionally filtered by
+// ?conn=N and ?kind=latency|throughput.
+func (c *Client) ProbeHistory(req *http.Request) (any, error) {
+	q := req.URL.Query()
+	conn := -1
+	if s := q.Get("conn"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid conn %q", s)
+		}
+		conn = n
+	}
+	kind := q.Get("kind")
+
+	results := []ProbeResult{}
+	for _, r := range c.probes.Items() {
+		if (conn < 0 || r.Conn == conn) && (kind == "" || r.Kind == kind) {
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
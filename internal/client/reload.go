@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"time"
+)
+
+// Reload states reported by ReloadStatus.
+const (
+	ReloadProbation  = "probation"
+	ReloadCommitted  = "committed"
+	ReloadRolledBack = "rolled_back"
+)
+
+// ReloadStatus describes the most recent configuration reload.
+type ReloadStatus struct {
+	State       string    `json:"state"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished,omitzero"`
+	Reason      string    `json:"reason,omitempty"`
+	Attempts    uint64    `json:"attempts"`     // connections (re)created during probation
+	SuccessRate float64   `json:"success_rate"` // fraction of those attempts that succeeded
+	DropRate    float64   `json:"drop_rate"`    // dropped packets per second during probation
+}
+
+// Reload applies the reloadable settings of next provisionally: every
+// connection is rotated onto the new settings (old ones drain in the
+// background) and the client is watched for reload.probation seconds. If the
+// connection success rate or packet drop rate crosses the thresholds in
+// next.Reload, the previous settings are restored the same way.
+//
+// Only c.tuning is swapped, which dialAddr and quicConf read for every new
+// connection. c.cfg keeps the configuration the client started with, so
+// what is read from it once at startup does not change: whether
+// tuneWindows runs, and the defaults of the QUIC runtime switches.
+func (c *Client) Reload(ctx context.Context, next *conf.Conf) (*ReloadStatus, error) {
+	if err := c.cfg.CheckReloadable(next); err != nil {
+		return nil, err
+	}
+
+	c.reloadMu.Lock()
+	if c.reload != nil && c.reload.State == ReloadProbation {
+		c.reloadMu.Unlock()
+		return nil, fmt.Errorf("a reload is already in probation")
+	}
+	st := &ReloadStatus{State: ReloadProbation, Started: time.Now()}
+	c.reload = st
+	c.reloadMu.Unlock()
+
+	blue := c.tuning.Load()
+	green := &transportTuning{KCP: next.Transport.KCP, QUIC: next.Transport.QUIC}
+	created := c.connsCreated.Load()
+
+	flog.Infof("applying reloaded configuration, probation %ds", next.Reload.Probation)
+	c.tuning.Store(green)
+	c.rotateAll("configuration reload")
+
+	go c.probation(ctx, st, next.Reload, created, blue)
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	out := *st
+	return &out, nil
+}
+
+// ReloadStatus serves the state of the most recent reload.
+func (c *Client) ReloadStatus(_ *http.Request) (any, error) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	if c.reload == nil {
+		return nil, fmt.Errorf("no configuration reload has been applied")
+	}
+	st := *c.reload
+	return &st, nil
+}
+
+// probation watches the client health after a reload and restores the blue
+// settings if it degrades before the window ends.
+func (c *Client) probation(ctx context.Context, st *ReloadStatus, r conf.Reload, created uint64, blue *transportTuning) {
+	window := time.Duration(r.Probation) * time.Second
+	ticker := time.NewTicker(min(window/4, 5*time.Second))
+	defer ticker.Stop()
+	deadline := time.After(window)
+
+	// Packet counters restart with each connection, so drops are summed
+	// from the increases seen at every tick.
+	var dropped uint64
+	last := c.packetsDropped()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-deadline:
+			c.finishReload(st, ReloadCommitted, "probation passed")
+			flog.Infof("reloaded configuration committed")
+			return
+		}
+
+		n := c.packetsDropped()
+		if n > last {
+			dropped += n - last
+		}
+		last = n
+		ok := c.connsCreated.Load() - created
+		attempts := ok + c.createFailures(st.Started)
+		success := 1.0
+		if attempts > 0 {
+			success = float64(ok) / float64(attempts)
+		}
+		drops := float64(dropped) / time.Since(st.Started).Seconds()
+		c.reloadMu.Lock()
+		st.Attempts, st.SuccessRate, st.DropRate = attempts, success, drops
+		c.reloadMu.Unlock()
+
+		var reason string
+		switch {
+		case attempts > 0 && success < r.MinSuccessRate:
+			reason = fmt.Sprintf("connection success rate %.2f below %.2f", success, r.MinSuccessRate)
+		case drops > r.MaxDropRate:
+			reason = fmt.Sprintf("drop rate %.1f/s above %.1f/s", drops, r.MaxDropRate)
+		default:
+			continue
+		}
+		flog.Warnf("rolling back reloaded configuration: %s", reason)
+		c.tuning.Store(blue)
+		c.rotateAll("configuration rollback")
+		c.finishReload(st, ReloadRolledBack, reason)
+		return
+	}
+}
+
+func (c *Client) finishReload(st *ReloadStatus, state, reason string) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	st.State = state
+	st.Reason = reason
+	st.Finished = time.Now()
+}
+
+// rotateAll moves every active connection onto the current tuning.
+// Suspended connections pick it up when they reconnect.
+func (c *Client) rotateAll(reason string) {
+	for _, tc := range c.iter.Items {
+		c.mu.Lock()
+		if tc.conn != nil {
+			tc.rotate(reason)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// createFailures counts failed connection attempts recorded after t.
+func (c *Client) createFailures(t time.Time) uint64 {
+	var n uint64
+	for _, e := range c.history.Items() {
+		if e.Event == EventCreateFailed && e.Time.After(t) {
+			n++
+		}
+	}
+	return n
+}
+
+// packetsDropped sums the outgoing packets dropped on active connections.
+func (c *Client) packetsDropped() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n uint64
+	for _, tc := range c.iter.Items {
+		if stats, ok := tc.conn.(interface{ PacketStats() (uint64, int) }); ok {
+			d, _ := stats.PacketStats()
+			n += d
+		}
+	}
+	return n
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"sync"
+	"time"
+)
+
+// reserveTTL is how long a reserved stream is handed out after it was
+// opened, leaving a margin before the server gives up on it.
+const reserveTTL = protocol.ReserveIdle / 2
+
+// reserve keeps up to transport.prefetch streams open ahead of use on one
+// transport connection. Opening a stream queues a frame behind any data
+// already waiting on the connection, and QUIC may block until the server
+// raises its stream limit; taking a reserved one costs neither, so a
+// burst of SOCKS connections does not open streams one after another.
+type reserve struct {
+	ctx   context.Context // lifetime of the client, not of any one request
+	conn  tnet.Conn
+	size  int
+	mu    sync.Mutex
+	strms []reservedStrm // oldest first
+	wake  chan struct{}
+}
+
+type reservedStrm struct {
+	strm   tnet.Strm
+	opened time.Time
+}
+
+// openOn opens a stream on conn, the current connection of tc, taking a
+// reserved one when available.
+func (c *Client) openOn(ctx context.Context, tc *timedConn, conn tnet.Conn) (tnet.Strm, error) {
+	if c.cfg.Transport.Prefetch == 0 {
+		return tc.open(ctx, conn)
+	}
+	if strm := c.reserveFor(tc.ctx, conn).take(); strm != nil {
+		return strm, nil
+	}
+	return tc.open(ctx, conn)
+}
+
+// open opens a stream on conn, one of the client's connections, see
+// timedConn.open.
+func (c *Client) open(ctx context.Context, conn tnet.Conn) (tnet.Strm, error) {
+	c.mu.Lock()
+	var gob *timedConn
+	for _, tc := range c.iter.Items {
+		if tc.isGob(conn) {
+			gob = tc
+			break
+		}
+	}
+	c.mu.Unlock()
+	if gob != nil {
+		return gob.open(ctx, conn)
+	}
+	return conn.OpenStrm(ctx)
+}
+
+// reserveFor returns the reserve of conn, starting one on first use that
+// runs until ctx is done or conn is replaced.
+func (c *Client) reserveFor(ctx context.Context, conn tnet.Conn) *reserve {
+	c.reserveMu.Lock()
+	defer c.reserveMu.Unlock()
+	r, ok := c.reserves[conn]
+	if !ok {
+		r = &reserve{ctx: ctx, conn: conn, size: c.cfg.Transport.Prefetch, wake: make(chan struct{}, 1)}
+		c.reserves[conn] = r
+		go c.fillReserve(r)
+	}
+	return r
+}
+
+// reserved counts the idle reserved streams on conn, which do not keep an
+// otherwise idle connection from being suspended.
+func (c *Client) reserved(conn tnet.Conn) int {
+	c.reserveMu.Lock()
+	r := c.reserves[conn]
+	c.reserveMu.Unlock()
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.strms)
+}
+
+// fillReserve tops up r after streams are taken or expire, until its
+// connection is no longer in use by the client.
+func (c *Client) fillReserve(r *reserve) {
+	ticker := time.NewTicker(reserveTTL / 4)
+	defer ticker.Stop()
+	for {
+		if r.ctx.Err() != nil || !c.inUse(r.conn) {
+			c.reserveMu.Lock()
+			delete(c.reserves, r.conn)
+			c.reserveMu.Unlock()
+			r.expire(time.Time{})
+			return
+		}
+		r.expire(time.Now().Add(-reserveTTL))
+		for r.len() < r.size {
+			strm, err := c.open(r.ctx, r.conn)
+			if err != nil {
+				flog.Debugf("failed to open reserved stream: %v", err)
+				break
+			}
+			p := protocol.Proto{Type: protocol.PRSV}
+			if err := p.Write(strm); err != nil {
+				strm.Close()
+				break
+			}
+			r.mu.Lock()
+			r.strms = append(r.strms, reservedStrm{strm: strm, opened: time.Now()})
+			r.mu.Unlock()
+		}
+		select {
+		case <-r.wake:
+		case <-ticker.C:
+		case <-r.ctx.Done():
+		}
+	}
+}
+
+// inUse reports whether conn is the current connection of any slot that
+// takes new streams.
+func (c *Client) inUse(conn tnet.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tc := range c.iter.Items {
+		if tc.conn == conn && !tc.parked {
+			return true
+		}
+	}
+	return false
+}
+
+// take hands out the newest reserved stream, or nil if none is left.
+func (r *reserve) take() tnet.Strm {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var strm tnet.Strm
+	if n := len(r.strms); n > 0 && time.Since(r.strms[n-1].opened) < reserveTTL {
+		strm = r.strms[n-1].strm
+		r.strms = r.strms[:n-1]
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return strm
+}
+
+// expire closes the reserved streams opened before t, or all of them if t
+// is zero.
+func (r *reserve) expire(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(r.strms) && (t.IsZero() || r.strms[n].opened.Before(t)) {
+		r.strms[n].strm.Close()
+		n++
+	}
+	r.strms = r.strms[n:]
+}
+
+func (r *reserve) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.strms)
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"time"
+)
+
+// reverseHeaderTimeout bounds how long the server may take to answer a
+// reverse forward request or to send the header of a stream it opened.
+const reverseHeaderTimeout = 10 * time.Second
+
+// Reverse keeps a reverse forward registered on the server until ctx ends:
+// the server listens on listen and, for every connection it accepts there,
+// opens a stream back to the client that is passed to handle. The
+// registration is renewed with backoff whenever the transport connection
+// carrying it is lost.
+func (c *Client) Reverse(ctx context.Context, listen *tnet.Addr, handle func(tnet.Strm)) {
+	key := listen.String()
+	c.revMu.Lock()
+	c.revHandlers[key] = handle
+	c.revMu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if err := c.reverseOnce(ctx, listen); err != nil {
+			flog.Warnf("reverse forward on %s: %v", key, err)
+		} else {
+			attempt = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.calculateRetryBackoff(attempt)):
+		}
+	}
+}
+
+// reverseOnce registers listen on one transport connection and returns
+// when the registration ends.
+func (c *Client) reverseOnce(ctx context.Context, listen *tnet.Addr) error {
+	tc, conn, err := c.newConn(false, classAny, "", nil)
+	if err != nil {
+		return err
+	}
+	strm, err := tc.open(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("failed to open control stream: %w", err)
+	}
+	defer strm.Close()
+	c.acceptReverse(conn)
+
+	p := protocol.Proto{Type: protocol.PREV, Addr: listen, ClientID: c.id}
+	if err := p.Write(strm); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	_ = strm.SetReadDeadline(time.Now().Add(reverseHeaderTimeout))
+	if err := p.Read(strm); err != nil {
+		return fmt.Errorf("failed to read reply: %w", err)
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	if p.Type != protocol.PREV || p.Addr == nil {
+		return fmt.Errorf("refused by the server, see its log")
+	}
+	_ = strm.SetReadDeadline(time.Time{})
+	flog.Infof("reverse forward on server %s registered (stream %s)", listen, strm.CID())
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = strm.Read(make([]byte, 1))
+		close(done)
+	}()
+	select {
+	case <-done:
+		return fmt.Errorf("control stream %s closed", strm.CID())
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// acceptReverse starts accepting the streams the server opens on conn for
+// reverse forwards, once per connection.
+func (c *Client) acceptReverse(conn tnet.Conn) {
+	c.revMu.Lock()
+	defer c.revMu.Unlock()
+	if c.revAccepting[conn] {
+		return
+	}
+	c.revAccepting[conn] = true
+	go func() {
+		defer func() {
+			c.revMu.Lock()
+			delete(c.revAccepting, conn)
+			c.revMu.Unlock()
+		}()
+		for {
+			strm, err := conn.AcceptStrm()
+			if err != nil {
+				flog.Debugf("stopped accepting reverse streams on %s: %v", conn.LocalAddr(), err)
+				return
+			}
+			go c.dispatchReverse(strm)
+		}
+	}()
+}
+
+func (c *Client) dispatchReverse(strm tnet.Strm) {
+	var p protocol.Proto
+	_ = strm.SetReadDeadline(time.Now().Add(reverseHeaderTimeout))
+	if err := p.Read(strm); err != nil || p.Type != protocol.PREV || p.Addr == nil {
+		flog.Debugf("dropping stream %s opened by the server: unexpected header (%v)", strm.CID(), err)
+		strm.Close()
+		return
+	}
+	_ = strm.SetReadDeadline(time.Time{})
+	c.revMu.Lock()
+	handle := c.revHandlers[p.Addr.String()]
+	c.revMu.Unlock()
+	if handle == nil {
+		flog.Debugf("dropping reverse stream %s for unknown listener %s", strm.CID(), p.Addr)
+		strm.Close()
+		return
+	}
+	flog.Debugf("reverse stream %s (server stream %s) on %s", strm.CID(), p.CID, p.Addr)
+	handle(c.track(strm, "tcp"))
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"paqet/internal/flog"
+	"sync"
+	"time"
+)
+
+// Roaming states, see conf.Roaming.
+const (
+	RoamOnline  = "online"
+	RoamPortal  = "captive_portal"
+	RoamOffline = "offline"
+)
+
+// errPaused fails stream requests while roaming has the tunnel paused, so
+// that applications get an error at once instead of after every retry.
+var errPaused = errors.New("tunnel paused: no connectivity past the local network")
+
+// RoamingStatus reports what the connectivity check last found.
+type RoamingStatus struct {
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Paused    bool      `json:"paused"`
+	Portal    string    `json:"portal,omitempty"` // where the portal redirected the check to
+	Detail    string    `json:"detail,omitempty"`
+	LastCheck time.Time `json:"last_check"`
+	Pauses    int       `json:"pauses"` // times the tunnel has been paused
+}
+
+type roaming struct {
+	mu     sync.Mutex
+	status RoamingStatus
+}
+
+// roam checks connectivity on the schedule of conf.Roaming until ctx is
+// done. Two failed checks in a row pause the tunnel: every connection is
+// closed and stream requests fail at once. The first passing check brings
+// all connections back up.
+func (c *Client) roam(ctx context.Context) {
+	cfg := c.cfg.Roaming
+	hc := &http.Client{
+		Timeout: time.Duration(cfg.Timeout) * time.Millisecond,
+		// A new connection for every check: the network may have changed
+		// under the last one, and no proxy, which would hide the portal.
+		Transport: &http.Transport{DisableKeepAlives: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	failures := 0
+	for {
+		state, portal, detail := c.checkConnectivity(ctx, hc)
+		if ctx.Err() != nil {
+			return
+		}
+		if state == RoamOnline {
+			failures = 0
+		} else {
+			failures++
+		}
+		c.setRoaming(state, portal, detail, failures >= 2)
+
+		every := cfg.Interval
+		if failures > 0 {
+			every = cfg.FastInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(every) * time.Second):
+		}
+	}
+}
+
+// checkConnectivity fetches the check URL outside the tunnel. Anything but
+// the expected status, or a body on a 204, is a portal hijacking the
+// request; no response at all is offline.
+func (c *Client) checkConnectivity(ctx context.Context, hc *http.Client) (state, portal, detail string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.Roaming.URL, nil)
+	if err != nil {
+		return RoamOffline, "", err.Error()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return RoamOffline, "", err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1))
+	if resp.StatusCode == c.cfg.Roaming.Status && (resp.StatusCode != http.StatusNoContent || len(body) == 0) {
+		return RoamOnline, "", ""
+	}
+	return RoamPortal, resp.Header.Get("Location"), fmt.Sprintf("check answered %s", resp.Status)
+}
+
+func (c *Client) setRoaming(state, portal, detail string, pause bool) {
+	c.roaming.mu.Lock()
+	st := &c.roaming.status
+	st.LastCheck = time.Now()
+	st.Portal, st.Detail = portal, detail
+	if st.State != state {
+		st.State, st.Since = state, st.LastCheck
+	}
+	wasPaused := st.Paused
+	switch {
+	case pause && !wasPaused:
+		st.Paused = true
+		st.Pauses++
+	case state == RoamOnline && wasPaused:
+		st.Paused = false
+	}
+	paused := st.Paused
+	c.roaming.mu.Unlock()
+
+	switch {
+	case paused && !wasPaused:
+		c.pause(state, detail)
+	case !paused && wasPaused:
+		c.resume()
+	}
+}
+
+// pause closes every connection and makes stream requests fail until
+// resume.
+func (c *Client) pause(state, detail string) {
+	c.paused.Store(true)
+	flog.Warnf("roaming: %s (%s), pausing the tunnel", state, detail)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tc := range c.iter.Items {
+		if tc.conn == nil {
+			continue
+		}
+		tc.record(EventSuspended, state)
+		tc.unwatch()
+		_ = tc.conn.Close()
+		tc.conn = nil
+		tc.suspended = true
+	}
+}
+
+// resume dials every connection at once instead of waiting for the next
+// stream request to find it missing.
+func (c *Client) resume() {
+	flog.Infof("roaming: connectivity is back, resuming the tunnel")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tc := range c.iter.Items {
+		if tc.parked || tc.conn != nil {
+			continue
+		}
+		conn, err := tc.createConn()
+		if err != nil {
+			tc.createFailed(err)
+			flog.Warnf("roaming: connection %d could not be re-established (%v), will retry on first use", tc.index+1, err)
+			continue
+		}
+		tc.conn = conn
+		tc.suspended = false
+		tc.record(EventCreated, "resumed after roaming pause")
+	}
+	c.paused.Store(false)
+}
+
+// RoamingStatus serves the state of the connectivity check.
+func (c *Client) RoamingStatus(_ *http.Request) (any, error) {
+	if !c.cfg.Roaming.Enabled() {
+		return nil, fmt.Errorf("roaming is not configured")
+	}
+	c.roaming.mu.Lock()
+	defer c.roaming.mu.Unlock()
+	st := c.roaming.status
+	return &st, nil
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/metrics"
+	"paqet/internal/pkg/mmdb"
+	"paqet/internal/tnet"
+	"time"
+)
+
+var errRouteBlocked = errors.New("destination blocked by routing rules")
+
+// router applies the routing rules to the client's streams.
+type router struct {
+	cfg *conf.Routing
+	geo *mmdb.Reader // nil unless a geoip rule needs it
+
+	direct  metrics.Counter
+	tunnel  metrics.Counter
+	blocked metrics.Counter
+}
+
+func newRouter(cfg *conf.Routing) (*router, error) {
+	r := &router{cfg: cfg}
+	if cfg.NeedsGeoIP() {
+		geo, err := mmdb.Open(cfg.GeoIP)
+		if err != nil {
+			return nil, err
+		}
+		r.geo = geo
+	}
+	return r, nil
+}
+
+// route returns the rule deciding a connection over network to host:port.
+func (r *router) route(network, host string, port uint16) conf.RoutingRule {
+	var country func(netip.Addr) string
+	if r.geo != nil {
+		country = r.geo.Country
+	}
+	rule := r.cfg.Match(network, host, port, country)
+	switch rule.Action {
+	case "direct":
+		r.direct.Inc()
+	case "block":
+		r.blocked.Inc()
+	default:
+		r.tunnel.Inc()
+	}
+	return rule
+}
+
+// bypass handles a stream to addr that the routing rules keep out of the
+// tunnel: it dials addr from the local network, or refuses it. It returns
+// false if the stream should go through the tunnel, with ctx carrying the
+// group the rule named, if any.
+func (c *Client) bypass(ctx context.Context, network string, addr *tnet.Addr) (tnet.Strm, context.Context, bool, error) {
+	if c.router == nil {
+		return nil, ctx, false, nil
+	}
+	rule := c.router.route(network, addr.Host, uint16(addr.Port))
+	switch rule.Action {
+	case "direct":
+		d := net.Dialer{Timeout: 10 * time.Second}
+		conn, err := d.DialContext(ctx, network, addr.String())
+		if err != nil {
+			return nil, ctx, true, err
+		}
+		strm := &directStrm{Conn: conn, cid: tnet.NewCID()}
+		flog.Debugf("%s %s routed direct as %s", network, addr, strm.cid)
+		return strm, ctx, true, nil
+	case "block":
+		flog.Debugf("%s %s blocked by routing rules", network, addr)
+		return nil, ctx, true, errRouteBlocked
+	}
+	return nil, WithGroup(ctx, rule.Group), false, nil
+}
+
+// directStrm is a connection that the routing rules sent around the
+// tunnel, dressed as a stream for the SOCKS5 and forward handlers.
+type directStrm struct {
+	net.Conn
+	cid string
+}
+
+func (s *directStrm) SID() int    { return 0 }
+func (s *directStrm) CID() string { return s.cid }
+
+func (r *router) collect(w *metrics.Writer) {
+	const help = "SOCKS5 and forward destinations by routing decision."
+	w.Counter("paqet_routing_decisions_total", help, r.tunnel.Load(), "action", "tunnel")
+	w.Counter("paqet_routing_decisions_total", help, r.direct.Load(), "action", "direct")
+	w.Counter("paqet_routing_decisions_total", help, r.blocked.Load(), "action", "block")
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"slices"
+	"time"
+)
+
+// streamClass decides which connections a new stream may be put on under
+// transport.scheduling.
+type streamClass int
+
+const (
+	classAny         streamClass = iota // plain rotation, also with scheduling off
+	classInteractive                    // the fastest connection
+	classBulk                           // every connection but the fastest
+)
+
+// classify returns the class of a stream with header p.
+func (c *Client) classify(p *protocol.Proto) streamClass {
+	s := &c.cfg.Transport.Scheduling
+	if !s.Enabled() {
+		return classAny
+	}
+	switch p.Type {
+	case protocol.PTCP, protocol.PUDP:
+		if p.Addr != nil && slices.Contains(s.Interactive, p.Addr.Port) {
+			return classInteractive
+		}
+		return classBulk
+	case protocol.PTUN:
+		return classBulk
+	}
+	return classAny
+}
+
+// schedule re-picks the connection for interactive streams every
+// transport.scheduling.interval until ctx is done.
+func (c *Client) schedule(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.cfg.Transport.Scheduling.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.reschedule()
+		}
+	}
+}
+
+// reschedule makes the connection with the lowest heartbeat round-trip
+// time the one for interactive streams. Streams already open stay where
+// they are.
+func (c *Client) reschedule() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur := c.fast.Load()
+	var best *timedConn
+	var bestRTT, curRTT time.Duration
+	for _, tc := range c.iter.Items {
+		if tc.parked || tc.group != nil || tc.degraded.Load() {
+			continue
+		}
+		rtt, _ := tc.rtt()
+		if rtt == 0 {
+			continue
+		}
+		if tc == cur {
+			curRTT = rtt
+		}
+		if best == nil || rtt < bestRTT {
+			best, bestRTT = tc, rtt
+		}
+	}
+	// Move only to a clearly faster connection, so that jitter does not
+	// send interactive streams back and forth between two similar ones.
+	if curRTT > 0 && bestRTT*5 > curRTT*4 {
+		return
+	}
+	if best == cur {
+		return
+	}
+	c.fast.Store(best)
+	if best == nil {
+		flog.Infof("scheduling: no connection has a round-trip time yet, interactive streams use any connection")
+		return
+	}
+	flog.Infof("scheduling: interactive streams move to connection %d (rtt %v)", best.index+1, bestRTT.Round(time.Millisecond))
+}
+
+// fastest returns the connection for interactive streams, or nil if there
+// is none fit to take streams.
+func (c *Client) fastest() *timedConn {
+	tc := c.fast.Load()
+	if tc == nil || tc.parked || tc.degraded.Load() {
+		return nil
+	}
+	return tc
+}
+
+// rtt returns the smoothed heartbeat round-trip time of tc, or 0 if it has
+// none yet. failing reports that its last ping failed, in which case the
+// round-trip time is 0 as well.
+func (tc *timedConn) rtt() (rtt time.Duration, failing bool) {
+	m := tc.monitor.Load()
+	if m == nil {
+		return 0, false
+	}
+	st := m.Stats()
+	if st.Failures > 0 {
+		return 0, true
+	}
+	return st.RTT, false
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"paqet/internal/admin"
+)
+
+// Status serves the summary printed by paqet status.
+func (c *Client) Status(_ *http.Request) (any, error) {
+	st := admin.Status{
+		Role:      "client",
+		Started:   c.started,
+		Uptime:    time.Since(c.started).Seconds(),
+		Transport: c.cfg.Transport.Protocol,
+		Addr:      c.servers.addr().String(),
+		DropsBy:   make(map[string]uint64),
+	}
+	st.Streams, st.BytesIn, st.BytesOut = c.streams.Totals()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tc := range c.iter.Items {
+		if tc == nil || tc.conn == nil {
+			continue
+		}
+		st.Connections++
+		if stats, ok := tc.conn.(interface {
+			PacketStats() (uint64, int)
+		}); ok {
+			d, q := stats.PacketStats()
+			st.Dropped += d
+			st.QueueDepth += q
+		}
+		if stats, ok := tc.conn.(interface {
+			DropStats() map[string]uint64
+		}); ok {
+			for r, n := range stats.DropStats() {
+				st.DropsBy[r] += n
+			}
+		}
+	}
+	return st, nil
+}
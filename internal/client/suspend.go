@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"paqet/internal/flog"
+	"time"
+)
+
+// touch records application activity for the idle suspend timer.
+func (c *Client) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// suspendIdle closes transport connections once the client has been idle
+// for transport.idle_suspend, stopping keepalives and cover traffic until
+// newConn() reconnects them on the next request.
+func (c *Client) suspendIdle(ctx context.Context) {
+	idle := time.Duration(c.cfg.Transport.IdleSuspend) * time.Second
+	ticker := time.NewTicker(min(idle/4, 15*time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			since := time.Since(time.Unix(0, c.lastActive.Load()))
+			if since < idle {
+				continue
+			}
+			c.mu.Lock()
+			for _, tc := range c.iter.Items {
+				if tc.conn == nil {
+					continue
+				}
+				if n, ok := tc.conn.(interface{ NumStreams() int }); ok && n.NumStreams() > c.reserved(tc.conn) {
+					continue
+				}
+				tc.record(EventSuspended, fmt.Sprintf("idle for %s", since.Round(time.Second)))
+				tc.unwatch()
+				_ = tc.conn.Close()
+				tc.conn = nil
+				tc.suspended = true
+				flog.Debugf("connection %d suspended after %s idle", tc.index+1, since.Round(time.Second))
+			}
+			c.mu.Unlock()
+		}
+	}
+}
@@ -1,33 +1,48 @@
 package client
 
 import (
+	"context"
 	"paqet/internal/flog"
 	"paqet/internal/protocol"
 	"paqet/internal/tnet"
 )
 
-func (c *Client) TCP(addr string) (tnet.Strm, error) {
-	strm, err := c.newStrm()
-	if err != nil {
-		flog.Debugf("failed to create stream for TCP %s: %v", addr, err)
-		return nil, err
-	}
+// TCP opens a stream to addr relayed by the server. Cancelling ctx abandons
+// the open, including any retries; it does not affect a returned stream.
+func (c *Client) TCP(ctx context.Context, addr string) (tnet.Strm, error) {
+	return c.TCPReuse(ctx, addr, protocol.ReuseDefault)
+}
 
+// TCPReuse opens a TCP stream carrying a hint for how the server should
+// pool the upstream connection.
+func (c *Client) TCPReuse(ctx context.Context, addr string, reuse protocol.Reuse) (tnet.Strm, error) {
+	return c.tcp(ctx, addr, reuse, false)
+}
+
+// TCPDup is TCPReuse with every write duplicated across two transport
+// connections, see openDup.
+func (c *Client) TCPDup(ctx context.Context, addr string, reuse protocol.Reuse) (tnet.Strm, error) {
+	return c.tcp(ctx, addr, reuse, true)
+}
+
+func (c *Client) tcp(ctx context.Context, addr string, reuse protocol.Reuse, duplicate bool) (tnet.Strm, error) {
 	tAddr, err := tnet.NewAddr(addr)
 	if err != nil {
 		flog.Debugf("invalid TCP address %s: %v", addr, err)
-		strm.Close()
 		return nil, err
 	}
+	strm, ctx, ok, err := c.bypass(ctx, "tcp", tAddr)
+	if ok {
+		return strm, err
+	}
+	c.unmapTarget(tAddr)
 
-	p := protocol.Proto{Type: protocol.PTCP, Addr: tAddr}
-	err = p.Write(strm)
+	strm, err = c.openStrm(ctx, protocol.Proto{Type: protocol.PTCP, Addr: tAddr, Reuse: reuse}, duplicate)
 	if err != nil {
-		flog.Debugf("failed to write TCP protocol header for %s on stream %d: %v", addr, strm.SID(), err)
-		strm.Close()
+		flog.Debugf("failed to create stream for TCP %s: %v", addr, err)
 		return nil, err
 	}
 
-	flog.Debugf("TCP stream %d created for %s", strm.SID(), addr)
-	return strm, nil
+	flog.Debugf("TCP stream %s created for %s", strm.CID(), addr)
+	return c.track(strm, "tcp"), nil
 }
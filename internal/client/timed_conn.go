@@ -2,38 +2,135 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"math/rand/v2"
+	"net"
 	"paqet/internal/conf"
+	"paqet/internal/features"
+	"paqet/internal/flog"
+	"paqet/internal/metrics"
+	"paqet/internal/pkg/ring"
 	"paqet/internal/protocol"
 	"paqet/internal/socket"
+	"paqet/internal/state"
 	"paqet/internal/tnet"
+	"paqet/internal/tnet/heartbeat"
 	"paqet/internal/tnet/kcp"
 	"paqet/internal/tnet/quic"
+	"paqet/internal/tnet/ws"
+	"sync/atomic"
 	"time"
 )
 
 type timedConn struct {
+	id              string
+	index           int         // position in the client's connection list
+	group           *conf.Group // transport.groups entry, nil for the default connections
 	cfg             *conf.Conf
 	conn            tnet.Conn
-	expire          time.Time
+	expire          time.Time // when to rotate the connection, zero if never
 	ctx             context.Context
 	lastHealthCheck time.Time
 	lastTCPFSend    time.Time
+	degraded        atomic.Bool // last scheduled probe failed
+	suspended       bool        // closed by idle suspend, reconnects on next use
+	history         *ring.Ring[ConnEvent]
+	created         *metrics.Counter // transport connections established
+	features        *features.Set
+	state           *state.Store           // nil unless state.dir is set
+	sessions        tls.ClientSessionCache // QUIC session tickets, shared by every slot
+
+	tuning *atomic.Pointer[transportTuning] // protocol settings for new connections
+	gob    atomic.Pointer[tnet.Conn]        // connection whose server only reads gob, see negotiateFormat
+
+	parked  bool          // removed by autoscale: takes no new streams, closed once drained
+	bytes   atomic.Uint64 // payload carried by streams opened on this slot, see autoscale
+	streams atomic.Int64  // open streams of this slot, counted under balance_strategy least_streams
+
+	monitor     atomic.Pointer[heartbeat.Monitor]              // heartbeat of conn, nil unless transport.heartbeat is set
+	stopMonitor context.CancelFunc                             // stops monitor
+	dead        func(tc *timedConn, conn tnet.Conn, err error) // called when conn stops answering heartbeats
+
+	breaker *breaker // shared by every slot, nil unless transport.breaker is set
+	servers *servers // shared by every slot, picks the server to dial
 }
 
-func newTimedConn(ctx context.Context, cfg *conf.Conf) (*timedConn, error) {
-	var err error
-	tc := timedConn{cfg: cfg, ctx: ctx}
-	tc.conn, err = tc.createConn()
+// transportTuning holds the protocol settings a configuration reload may
+// change. Connections pick them up when they are (re)created; code that
+// needs transport.kcp or transport.quic after startup reads them here, not
+// from cfg.
+type transportTuning struct {
+	KCP  *conf.KCP
+	QUIC *conf.QUIC
+}
+
+// createConn dials a transport connection to the server, if the breaker
+// lets it, and resets tc's timers and heartbeat for it. c.mu is held.
+func (tc *timedConn) createConn() (tnet.Conn, error) {
+	conn, err := tc.connect()
 	if err != nil {
 		return nil, err
 	}
+	tc.adopt(conn)
+	return conn, nil
+}
 
-	return &tc, nil
+// connect dials and sets up a transport connection, if the breaker lets
+// it. It leaves the state under c.mu alone, so that it can run without the
+// lock; the caller passes the connection to adopt before putting it in
+// tc.conn.
+func (tc *timedConn) connect() (tnet.Conn, error) {
+	if tc.breaker == nil {
+		return tc.dial()
+	}
+	if err := tc.breaker.allow(); err != nil {
+		return nil, err
+	}
+	conn, err := tc.dial()
+	if event, reason := tc.breaker.done(err); event != "" {
+		// The breaker is shared by every slot, so the event names no
+		// connection address.
+		tc.history.Push(ConnEvent{Time: time.Now(), Conn: tc.index, Event: event, Reason: reason})
+	}
+	return conn, err
 }
 
-func (tc *timedConn) createConn() (tnet.Conn, error) {
+// adopt resets the health and rotation timers and the heartbeat for conn,
+// which becomes tc's connection. c.mu is held.
+func (tc *timedConn) adopt(conn tnet.Conn) {
+	now := time.Now()
+	tc.degraded.Store(false)
+	tc.lastTCPFSend = now
+	tc.lastHealthCheck = now
+	tc.expire = tc.nextRotation(now)
+	tc.watch(conn)
+}
+
+// dial connects to the server currently in use and sets the connection up.
+func (tc *timedConn) dial() (tnet.Conn, error) {
+	addr := tc.servers.addr()
+	conn, err := tc.dialAddr(addr)
+	if err == nil {
+		conn, err = tc.setupConn(conn, addr)
+	}
+	tc.servers.done(addr, err)
+	return conn, err
+}
+
+// dialAddr opens a bare transport connection to addr.
+func (tc *timedConn) dialAddr(addr *net.UDPAddr) (tnet.Conn, error) {
+	if tc.cfg.Transport.Protocol == "websocket" {
+		return ws.Dial(tc.ctx, addr, tc.cfg.Transport.WS)
+	}
+
 	netCfg := tc.cfg.Network
+	if netCfg.PortHopping.Enabled() {
+		netCfg.PortHopping.Hop = addr
+	}
+	if netCfg.Gate.Enabled() {
+		netCfg.Gate.Knock = addr
+	}
 	pConn, err := socket.New(tc.ctx, &netCfg)
 	if err != nil {
 		return nil, fmt.Errorf("could not create packet conn: %w", err)
@@ -42,9 +139,9 @@ func (tc *timedConn) createConn() (tnet.Conn, error) {
 	var conn tnet.Conn
 	switch tc.cfg.Transport.Protocol {
 	case "kcp":
-		conn, err = kcp.Dial(tc.cfg.Server.Addr, tc.cfg.Transport.KCP, pConn)
+		conn, err = kcp.Dial(addr, tc.tuning.Load().KCP, &tc.cfg.Transport.Obfs, pConn)
 	case "quic":
-		conn, err = quic.Dial(tc.ctx, tc.cfg.Server.Addr, tc.cfg.Transport.QUIC, pConn)
+		conn, err = quic.Dial(tc.ctx, addr, tc.quicConf(addr), &tc.cfg.Transport.Obfs, pConn)
 	default:
 		_ = pConn.Close()
 		return nil, fmt.Errorf("unsupported transport protocol: %s", tc.cfg.Transport.Protocol)
@@ -54,19 +151,270 @@ func (tc *timedConn) createConn() (tnet.Conn, error) {
 		_ = pConn.Close()
 		return nil, err
 	}
-	err = tc.sendTCPF(conn)
-	if err != nil {
+	return conn, nil
+}
+
+// setupConn sends the per-connection client state over a freshly dialed
+// conn.
+func (tc *timedConn) setupConn(conn tnet.Conn, addr *net.UDPAddr) (tnet.Conn, error) {
+	if err := tc.greet(conn, addr.String(), tc.cfg.Transport.ResumeValue() && tc.servers.resumable(addr.String())); err != nil {
 		_ = conn.Close()
 		return nil, err
 	}
-	now := time.Now()
-	tc.lastTCPFSend = now
-	tc.lastHealthCheck = now
+	if err := tc.sendBind(conn); err != nil {
+		flog.Debugf("failed to bind connection to client state: %v", err)
+	}
+	tc.created.Inc()
 	return conn, nil
 }
 
+// greet settles the message format, completes the hello and sends the TCP
+// flags. A server that has shown it can be resumed is not waited for: the
+// format is known, and the hello ack and a 0-RTT handshake are confirmed
+// in the background while streams already flow.
+func (tc *timedConn) greet(conn tnet.Conn, server string, resume bool) error {
+	var acked <-chan helloAck
+	if resume {
+		if tc.cfg.Transport.PSK != "" {
+			ch, err := tc.sendHelloAhead(conn)
+			if err != nil {
+				return fmt.Errorf("authenticated hello failed: %w", err)
+			}
+			acked = ch
+		}
+		go tc.confirm(conn, server, acked)
+	} else {
+		if e, ok := conn.(tnet.EarlyConn); ok {
+			// Every step below waits for a reply, so let a 0-RTT handshake
+			// settle first rather than lose the steps to a rejection.
+			if _, err := e.Confirm(tc.ctx); err != nil {
+				return err
+			}
+		}
+		binary := tc.negotiateFormat(conn)
+		ok := binary
+		if tc.cfg.Transport.PSK != "" {
+			r, err := tc.sendHello(conn)
+			if err != nil {
+				return fmt.Errorf("authenticated hello failed: %w", err)
+			}
+			ok = ok && r
+		}
+		tc.servers.setResumable(server, ok)
+	}
+	return tc.sendTCPF(conn)
+}
+
+// confirm completes a resumed setup. If the server rejected the 0-RTT data,
+// whatever was sent in it is lost and the setup is repeated in full; if
+// the hello was not acknowledged, conn is closed and the next connection
+// waits for the server again.
+func (tc *timedConn) confirm(conn tnet.Conn, server string, acked <-chan helloAck) {
+	if e, ok := conn.(tnet.EarlyConn); ok {
+		accepted, err := e.Confirm(tc.ctx)
+		if err != nil {
+			return
+		}
+		if !accepted {
+			flog.Debugf("server %s rejected 0-RTT data, repeating connection setup", server)
+			if err := tc.greet(conn, server, false); err != nil {
+				flog.Warnf("connection setup after rejected 0-RTT failed: %v", err)
+				_ = conn.Close()
+				return
+			}
+			if err := tc.sendBind(conn); err != nil {
+				flog.Debugf("failed to bind connection to client state: %v", err)
+			}
+			return
+		}
+	}
+	if acked == nil {
+		return
+	}
+	if ack := <-acked; ack.err != nil {
+		flog.Warnf("hello sent ahead of the first streams failed, closing connection: %v", ack.err)
+		tc.servers.setResumable(server, false)
+		_ = conn.Close()
+	}
+}
+
+// quicConf returns the QUIC settings for a new connection to addr with
+// the current runtime switches applied.
+func (tc *timedConn) quicConf(addr *net.UDPAddr) *conf.QUIC {
+	q := *tc.tuning.Load().QUIC
+	q.EnableDatagrams = tc.features.Enabled(features.QUICDatagrams)
+	if !tc.features.Enabled(features.QUICPadding) {
+		q.Padding = conf.QUICPadding{}
+	}
+	q.SessionCache = tc.sessions
+	if !tc.cfg.Transport.ResumeValue() {
+		off := false
+		q.Enable0RTT = &off
+	}
+	if tc.state != nil {
+		if q.TOFU {
+			q.VerifyServer = tc.state.TrustOnFirstUse(addr.String())
+		}
+	}
+	return &q
+}
+
+// sendBind tells the server that conn belongs to this client, so state such
+// as a delegated prefix carries over from the connection it replaces.
+func (tc *timedConn) sendBind(conn tnet.Conn) error {
+	strm, err := tc.open(tc.ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer strm.Close()
+
+	p := protocol.Proto{Type: protocol.PBIND, ClientID: tc.id}
+	return p.Write(strm)
+}
+
+// negotiateFormat selects the binary message format, or gob if the server
+// predates it. A failed ping also selects gob, which every server reads, and
+// the next connection asks again. It reports whether binary was selected.
+func (tc *timedConn) negotiateFormat(conn tnet.Conn) bool {
+	strm, err := conn.OpenStrm(tc.ctx)
+	if err != nil {
+		return false
+	}
+	defer strm.Close()
+	_ = strm.SetDeadline(time.Now().Add(10 * time.Second))
+	binary := protocol.Negotiate(strm)
+	if binary {
+		tc.gob.Store(nil)
+	} else {
+		flog.Debugf("server did not answer a binary ping, using gob messages on this connection")
+		tc.gob.Store(&conn)
+	}
+	return binary
+}
+
+// open opens a stream on conn, a connection of tc, marked for gob messages
+// if its server predates the binary format.
+func (tc *timedConn) open(ctx context.Context, conn tnet.Conn) (tnet.Strm, error) {
+	strm, err := conn.OpenStrm(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tc.isGob(conn) {
+		return protocol.GobStrm{Strm: strm}, nil
+	}
+	return strm, nil
+}
+
+// isGob reports whether the server of conn only reads gob messages.
+func (tc *timedConn) isGob(conn tnet.Conn) bool {
+	g := tc.gob.Load()
+	return g != nil && *g == conn
+}
+
+// sendHello proves knowledge of transport.psk to the server and checks its
+// reply. The server serves no other streams on conn until this succeeds.
+// It reports whether the server holds streams that arrive ahead of a
+// hello, see sendHelloAhead.
+func (tc *timedConn) sendHello(conn tnet.Conn) (bool, error) {
+	acked, err := tc.sendHelloAhead(conn)
+	if err != nil {
+		return false, err
+	}
+	ack := <-acked
+	return ack.resume, ack.err
+}
+
+// helloAck is the outcome of a hello.
+type helloAck struct {
+	resume bool // the server holds streams arriving ahead of a hello
+	err    error
+}
+
+// sendHelloAhead sends the hello and checks the reply in the background,
+// delivering the outcome on the returned channel.
+func (tc *timedConn) sendHelloAhead(conn tnet.Conn) (<-chan helloAck, error) {
+	strm, err := tc.open(tc.ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	psk := []byte(tc.cfg.Transport.PSK)
+	hello, err := protocol.NewHello(psk, tc.id, time.Now())
+	if err == nil {
+		err = hello.Write(strm)
+	}
+	if err != nil {
+		strm.Close()
+		return nil, err
+	}
+	acked := make(chan helloAck, 1)
+	go func() {
+		defer strm.Close()
+		_ = strm.SetReadDeadline(time.Now().Add(10 * time.Second))
+		var ack protocol.Proto
+		err := ack.Read(strm)
+		if err == nil {
+			err = ack.Err()
+		}
+		if err == nil {
+			err = ack.VerifyAck(psk, hello)
+		}
+		acked <- helloAck{resume: ack.Resume, err: err}
+	}()
+	return acked, nil
+}
+
+// nextRotation returns the next rotation time with ±20% jitter, or zero if
+// rotation is disabled.
+func (tc *timedConn) nextRotation(now time.Time) time.Time {
+	kcpCfg := tc.tuning.Load().KCP
+	if tc.cfg.Transport.Protocol != "kcp" || kcpCfg == nil || kcpCfg.Rotate == 0 {
+		return time.Time{}
+	}
+	period := time.Duration(kcpCfg.Rotate) * time.Second
+	jitter := time.Duration(rand.Int64N(int64(period)*2/5)) - period/5
+	return now.Add(period + jitter)
+}
+
+// rotate replaces the connection with a fresh one and drains the old one in
+// the background. On failure the current connection stays in use.
+func (tc *timedConn) rotate(reason string) {
+	conn, err := tc.createConn()
+	if err != nil {
+		tc.createFailed(err)
+		flog.Warnf("connection rotation failed, keeping current connection: %v", err)
+		tc.expire = time.Now().Add(30 * time.Second)
+		return
+	}
+	old := tc.conn
+	tc.conn = conn
+	tc.record(EventRotated, reason)
+	flog.Debugf("transport connection rotated to %s", conn.LocalAddr())
+	go drainConn(old, tc.drainTimeout())
+}
+
+// drainTimeout is how long a replaced connection keeps serving its streams.
+func (tc *timedConn) drainTimeout() time.Duration {
+	if k := tc.tuning.Load().KCP; k != nil && k.RotateDrain > 0 {
+		return time.Duration(k.RotateDrain) * time.Second
+	}
+	return 300 * time.Second
+}
+
+// drainConn closes conn once its streams have finished or timeout passes.
+func drainConn(conn tnet.Conn, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if n, ok := conn.(interface{ NumStreams() int }); !ok || n.NumStreams() == 0 {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	_ = conn.Close()
+}
+
 func (tc *timedConn) sendTCPF(conn tnet.Conn) error {
-	strm, err := conn.OpenStrm()
+	strm, err := tc.open(tc.ctx, conn)
 	if err != nil {
 		return err
 	}
@@ -81,6 +429,7 @@ func (tc *timedConn) sendTCPF(conn tnet.Conn) error {
 }
 
 func (tc *timedConn) close() {
+	tc.unwatch()
 	if tc.conn != nil {
 		tc.conn.Close()
 	}
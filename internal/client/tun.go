@@ -1,26 +1,91 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"paqet/internal/flog"
 	"paqet/internal/protocol"
 	"paqet/internal/tnet"
+	"paqet/internal/tunnel"
 )
 
-func (c *Client) TUN() (tnet.Strm, error) {
-	strm, err := c.newStrm()
+// TUN opens a stream carrying TUN packets. ctx bounds only the open.
+func (c *Client) TUN(ctx context.Context) (tnet.Strm, error) {
+	strm, err := c.openStrm(ctx, protocol.Proto{Type: protocol.PTUN, ClientID: c.id, Offload: c.cfg.TUN.Offload}, false)
 	if err != nil {
 		flog.Debugf("failed to create stream for TUN: %v", err)
 		return nil, err
 	}
 
-	p := protocol.Proto{Type: protocol.PTUN, Addr: nil}
-	err = p.Write(strm)
+	flog.Debugf("TUN stream %s created", strm.CID())
+	return c.track(strm, "tun"), nil
+}
+
+// Prefix asks the server to delegate an IPv6 prefix to this client.
+// The exchange is abandoned when ctx is done.
+func (c *Client) Prefix(ctx context.Context) (*net.IPNet, error) {
+	strm, err := c.newStrm(ctx, classAny)
 	if err != nil {
-		flog.Debugf("failed to write TUN protocol header on stream %d: %v", strm.SID(), err)
-		strm.Close()
 		return nil, err
 	}
+	defer strm.Close()
+	stop := context.AfterFunc(ctx, func() { strm.Close() })
+	defer stop()
+
+	p := protocol.Proto{Type: protocol.PPD, ClientID: c.id}
+	if err := p.Write(strm); err != nil {
+		return nil, fmt.Errorf("failed to send prefix request: %w", err)
+	}
+	if err := p.Read(strm); err != nil {
+		return nil, fmt.Errorf("failed to read prefix reply: %w", err)
+	}
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	if p.Type != protocol.PPD || p.Prefix == "" {
+		return nil, fmt.Errorf("server has no prefix to delegate")
+	}
+	_, prefix, err := net.ParseCIDR(p.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delegated prefix %q: %w", p.Prefix, err)
+	}
+	flog.Debugf("server delegated prefix %s on stream %s", prefix, strm.CID())
+	return prefix, nil
+}
 
-	flog.Debugf("TUN stream %d created", strm.SID())
-	return strm, nil
+// Lease asks the server for a tunnel address from its tun.pool, along with
+// the MTU and routes it pushes. The exchange is abandoned when ctx is done.
+func (c *Client) Lease(ctx context.Context) (*tunnel.Lease, error) {
+	strm, err := c.newStrm(ctx, classAny)
+	if err != nil {
+		return nil, err
+	}
+	defer strm.Close()
+	stop := context.AfterFunc(ctx, func() { strm.Close() })
+	defer stop()
+
+	p := protocol.Proto{Type: protocol.PTUNCFG, ClientID: c.id}
+	if err := p.Write(strm); err != nil {
+		return nil, fmt.Errorf("failed to send tunnel address request: %w", err)
+	}
+	if err := p.Read(strm); err != nil {
+		return nil, fmt.Errorf("failed to read tunnel address reply: %w", err)
+	}
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	if p.Type != protocol.PTUNCFG || p.TUNAddr == "" {
+		return nil, fmt.Errorf("server has no tunnel address to assign")
+	}
+	l := &tunnel.Lease{Addr: p.TUNAddr, MTU: p.MTU}
+	for _, r := range p.Routes {
+		_, route, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pushed route %q: %w", r, err)
+		}
+		l.Routes = append(l.Routes, route)
+	}
+	flog.Debugf("server leased tunnel address %s on stream %s", l.Addr, strm.CID())
+	return l, nil
 }
@@ -1,47 +1,64 @@
 package client
 
 import (
+	"context"
 	"paqet/internal/flog"
 	"paqet/internal/pkg/hash"
 	"paqet/internal/protocol"
 	"paqet/internal/tnet"
+	"paqet/internal/tnet/framed"
 )
 
-func (c *Client) UDP(lAddr, tAddr string) (tnet.Strm, bool, uint64, error) {
+// UDP returns the stream relaying datagrams from lAddr to tAddr, opening
+// one unless it exists already. ctx bounds only the open.
+func (c *Client) UDP(ctx context.Context, lAddr, tAddr string) (tnet.Strm, bool, uint64, error) {
+	return c.udp(ctx, lAddr, tAddr, false)
+}
+
+// UDPDup is UDP with every datagram duplicated across two transport
+// connections, see openDup.
+func (c *Client) UDPDup(ctx context.Context, lAddr, tAddr string) (tnet.Strm, bool, uint64, error) {
+	return c.udp(ctx, lAddr, tAddr, true)
+}
+
+func (c *Client) udp(ctx context.Context, lAddr, tAddr string, duplicate bool) (tnet.Strm, bool, uint64, error) {
 	key := hash.AddrPair(lAddr, tAddr)
 	c.udpPool.mu.RLock()
 	if strm, exists := c.udpPool.strms[key]; exists {
 		c.udpPool.mu.RUnlock()
-		flog.Debugf("reusing UDP stream %d for %s -> %s", strm.SID(), lAddr, tAddr)
+		flog.Debugf("reusing UDP stream %s for %s -> %s", strm.CID(), lAddr, tAddr)
 		return strm, false, key, nil
 	}
 	c.udpPool.mu.RUnlock()
 
-	strm, err := c.newStrm()
-	if err != nil {
-		flog.Debugf("failed to create stream for UDP %s -> %s: %v", lAddr, tAddr, err)
-		return nil, false, 0, err
-	}
-
 	taddr, err := tnet.NewAddr(tAddr)
 	if err != nil {
 		flog.Debugf("invalid UDP address %s: %v", tAddr, err)
-		strm.Close()
 		return nil, false, 0, err
 	}
-	p := protocol.Proto{Type: protocol.PUDP, Addr: taddr}
-	err = p.Write(strm)
+	strm, ctx, bypassed, err := c.bypass(ctx, "udp", taddr)
+	if !bypassed {
+		c.unmapTarget(taddr)
+		p := protocol.Proto{Type: protocol.PUDP, Addr: taddr}
+		framing := &c.cfg.Transport.UDPFraming
+		p.Framed = framing.Framed(c.cfg.Transport.Protocol) && !c.cfg.Transport.MultipathEnabled()
+		strm, err = c.openStrm(ctx, p, duplicate)
+		if err == nil {
+			if p.Framed {
+				strm = framed.New(strm, framing.Pace, &c.framing)
+			}
+			strm = c.track(strm, "udp")
+		}
+	}
 	if err != nil {
-		flog.Debugf("failed to write UDP protocol header for %s -> %s on stream %d: %v", lAddr, tAddr, strm.SID(), err)
-		strm.Close()
+		flog.Debugf("failed to create stream for UDP %s -> %s: %v", lAddr, tAddr, err)
 		return nil, false, 0, err
 	}
-
 	c.udpPool.mu.Lock()
 	c.udpPool.strms[key] = strm
 	c.udpPool.mu.Unlock()
 
-	flog.Debugf("UDP stream %d created for %s -> %s", strm.SID(), lAddr, tAddr)
+	flog.Debugf("UDP stream %s created for %s -> %s", strm.CID(), lAddr, tAddr)
 	return strm, true, key, nil
 }
 
@@ -15,7 +15,7 @@ func (p *udpPool) delete(key uint64) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if strm, exists := p.strms[key]; exists {
-		flog.Debugf("closing UDP session stream %d", strm.SID())
+		flog.Debugf("closing UDP session stream %s", strm.CID())
 		strm.Close()
 	} else {
 		flog.Debugf("UDP session key %d not found for close", key)
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/socket"
+	"paqet/internal/tnet"
+)
+
+// windowPings is how many pings tuneWindows takes the lowest RTT of, so
+// that a stream setup delayed by other traffic does not inflate it.
+const windowPings = 3
+
+// tuneWindows measures the RTT to the server once a connection is up and
+// checks the KCP windows and network.pcap.sockbuf against the
+// bandwidth-delay product for transport.kcp.bandwidth, logging the
+// reasoning. With transport.kcp.auto_window, windows and a capture buffer
+// that fall short are raised on the live sessions and for new connections.
+// The server's windows cannot be changed from here, so those are only
+// logged.
+func (c *Client) tuneWindows(ctx context.Context) {
+	rtt, err := c.measureRTT(ctx)
+	if err != nil {
+		return
+	}
+	cur := c.tuning.Load()
+	k := cur.KCP
+	h := conf.PathHints{BandwidthMbps: k.Bandwidth, RTT: rtt}
+	window := k.Window(h)
+	flog.Infof("measured %s RTT to %s: %d Mbit/s needs a KCP window of about %d packets of %d bytes (sndwnd %d, rcvwnd %d configured)",
+		rtt.Round(time.Millisecond), c.servers.addr(), k.Bandwidth, window, k.MTU, k.Sndwnd, k.Rcvwnd)
+
+	// c.cfg keeps the KCP settings the client started with; advise on the
+	// ones in use, which a reload may have replaced.
+	cfg := *c.cfg
+	cfg.Transport.KCP = k
+	advice := cfg.AdviseWindows(h)
+	if len(advice) == 0 {
+		flog.Infof("KCP windows and network.pcap.sockbuf cover the bandwidth-delay product")
+		return
+	}
+	for _, a := range advice {
+		flog.Warnf("window advice: %s", a)
+		if a.Field == "network.pcap.sockbuf" {
+			c.growSockbuf(k, a.Suggest)
+		}
+	}
+	if !k.AutoWindow || (k.Sndwnd >= window && k.Rcvwnd >= window) {
+		return
+	}
+
+	next := *k
+	next.Sndwnd, next.Rcvwnd = max(k.Sndwnd, window), max(k.Rcvwnd, window)
+	if !c.tuning.CompareAndSwap(cur, &transportTuning{KCP: &next, QUIC: cur.QUIC}) {
+		flog.Infof("not raising KCP windows, a configuration reload changed them meanwhile")
+		return
+	}
+	n := 0
+	c.mu.Lock()
+	for _, tc := range c.iter.Items {
+		if s, ok := tc.conn.(interface{ SetWindowSize(int, int) }); ok {
+			s.SetWindowSize(next.Sndwnd, next.Rcvwnd)
+			n++
+		}
+	}
+	c.mu.Unlock()
+	flog.Infof("raised KCP windows to sndwnd %d, rcvwnd %d on %d connections and for new ones", next.Sndwnd, next.Rcvwnd, n)
+	flog.Warnf("only the client's windows were raised: downloads stay capped by the server's transport.kcp.sndwnd, which should be at least %d", window)
+}
+
+// growSockbuf raises the capture buffers to suggest bytes with
+// transport.kcp.auto_window, or points at the settings that would.
+func (c *Client) growSockbuf(k *conf.KCP, suggest string) {
+	if !k.AutoWindow {
+		if !c.cfg.Network.PCAP.Autosize {
+			flog.Warnf("network.pcap.sockbuf is only raised at runtime with transport.kcp.auto_window or network.pcap.autosize")
+		}
+		return
+	}
+	size, err := strconv.Atoi(suggest)
+	if err != nil {
+		return
+	}
+	n, err := socket.GrowSockbuf(c.cfg.Network.Interface_, size)
+	if err != nil {
+		flog.Errorf("failed to raise network.pcap.sockbuf to %d bytes: %v", size, err)
+		return
+	}
+	flog.Infof("raised network.pcap.sockbuf to %d bytes on %d connections and for new ones", size, n)
+}
+
+// measureRTT waits for a connection and returns the lowest of windowPings
+// round-trip times on it.
+func (c *Client) measureRTT(ctx context.Context) (time.Duration, error) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		var best time.Duration
+		if conn := c.firstConn(); conn != nil {
+			for range windowPings {
+				rtt, err := c.ping(ctx, conn, 5*time.Second)
+				if err == nil && (best == 0 || rtt < best) {
+					best = rtt
+				}
+			}
+		}
+		if best > 0 {
+			return best, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// firstConn returns the first established connection, or nil if there is
+// none yet.
+func (c *Client) firstConn() tnet.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tc := range c.iter.Items {
+		if tc.conn != nil {
+			return tc.conn
+		}
+	}
+	return nil
+}
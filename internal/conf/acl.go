@@ -0,0 +1,144 @@
+package conf
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ACL restricts the upstream destinations a server dials for its clients,
+// e.g. to keep it from relaying into link-local or private networks.
+// Rules are checked in order against each address the server connects to,
+// after name resolution, and the first match decides.
+type ACL struct {
+	Default string    `yaml:"default"` // action when no rule matches: allow or deny
+	Rules   []ACLRule `yaml:"rules"`
+}
+
+// ACLRule matches a destination when all of its non-empty criteria do.
+type ACLRule struct {
+	Action   string   `yaml:"action"`   // allow or deny
+	CIDR_    []string `yaml:"cidr"`     // destination networks, matched against the resolved address
+	Ports_   string   `yaml:"ports"`    // "22", "8000-8999", comma separated
+	Domains  []string `yaml:"domains"`  // suffixes of the requested host name: "corp.example" covers "db.corp.example"
+	Services []string `yaml:"services"` // port presets such as dns, quic or bittorrent, see services
+
+	CIDR  []netip.Prefix `yaml:"-"`
+	Ports [][2]uint16    `yaml:"-"`
+}
+
+// Enabled reports whether any destination can be refused.
+func (a *ACL) Enabled() bool {
+	return len(a.Rules) > 0 || a.Default == "deny"
+}
+
+// Allow reports whether the server may connect over network to ip:port
+// for a stream that asked for host, which is a name or an address literal.
+func (a *ACL) Allow(network, host string, ip netip.Addr, port uint16) bool {
+	ip = ip.Unmap()
+	for _, r := range a.Rules {
+		if r.match(network, host, ip, port) {
+			return r.Action == "allow"
+		}
+	}
+	return a.Default != "deny"
+}
+
+func (r *ACLRule) match(network, host string, ip netip.Addr, port uint16) bool {
+	if len(r.CIDR) > 0 && !slices.ContainsFunc(r.CIDR, func(p netip.Prefix) bool { return p.Contains(ip) }) {
+		return false
+	}
+	if len(r.Ports) > 0 && !slices.ContainsFunc(r.Ports, func(p [2]uint16) bool { return port >= p[0] && port <= p[1] }) {
+		return false
+	}
+	if len(r.Domains) > 0 {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if !slices.ContainsFunc(r.Domains, func(d string) bool { return host == d || strings.HasSuffix(host, "."+d) }) {
+			return false
+		}
+	}
+	if len(r.Services) > 0 && !slices.ContainsFunc(r.Services, func(s string) bool { return matchService(s, network, port) }) {
+		return false
+	}
+	return true
+}
+
+func (a *ACL) setDefaults() {
+	if a.Default == "" {
+		a.Default = "allow"
+	}
+}
+
+func (a *ACL) validate() []error {
+	var errors []error
+	if a.Default != "allow" && a.Default != "deny" {
+		errors = append(errors, fmt.Errorf("server.acl.default must be allow or deny"))
+	}
+	for i := range a.Rules {
+		for _, err := range a.Rules[i].validate() {
+			errors = append(errors, fmt.Errorf("server.acl.rules[%d] %v", i, err))
+		}
+	}
+	return errors
+}
+
+func (r *ACLRule) validate() []error {
+	var errors []error
+	if r.Action != "allow" && r.Action != "deny" {
+		errors = append(errors, fmt.Errorf("action must be allow or deny"))
+	}
+	if len(r.CIDR_) == 0 && r.Ports_ == "" && len(r.Domains) == 0 && len(r.Services) == 0 {
+		errors = append(errors, fmt.Errorf("needs at least one of cidr, ports, domains or services; use server.acl.default for a catch-all"))
+	}
+
+	r.CIDR = r.CIDR[:0]
+	for _, c := range r.CIDR_ {
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid cidr '%s': %v", c, err))
+			continue
+		}
+		r.CIDR = append(r.CIDR, p.Masked())
+	}
+
+	ports, errs := parsePortRanges(r.Ports_)
+	r.Ports = ports
+	errors = append(errors, errs...)
+
+	for i, d := range r.Domains {
+		r.Domains[i] = strings.ToLower(strings.Trim(d, "."))
+	}
+	for i, s := range r.Services {
+		r.Services[i] = strings.ToLower(s)
+		if _, ok := services[r.Services[i]]; !ok {
+			errors = append(errors, fmt.Errorf("unknown service '%s', must be one of %v", s, serviceNames()))
+		}
+	}
+	return errors
+}
+
+// parsePortRanges parses a comma separated list of ports and port ranges
+// such as "22, 8000-8999".
+func parsePortRanges(s string) ([][2]uint16, []error) {
+	var ranges [][2]uint16
+	var errors []error
+	for _, s := range strings.Split(s, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(s, "-")
+		if !isRange {
+			hi = lo
+		}
+		from, err1 := strconv.ParseUint(strings.TrimSpace(lo), 10, 16)
+		to, err2 := strconv.ParseUint(strings.TrimSpace(hi), 10, 16)
+		if err1 != nil || err2 != nil || from == 0 || from > to {
+			errors = append(errors, fmt.Errorf("invalid port range '%s'", s))
+			continue
+		}
+		ranges = append(ranges, [2]uint16{uint16(from), uint16(to)})
+	}
+	return ranges, errors
+}
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	a := ACL{Default: "allow", Rules: []ACLRule{
+		{Action: "allow", Domains: []string{"Corp.Example."}, Ports_: "443"},
+		{Action: "deny", CIDR_: []string{"10.0.0.0/8", "169.254.0.0/16", "fd00::/8"}},
+		{Action: "deny", Ports_: "25, 6000-6063"},
+		{Action: "deny", Services: []string{"BitTorrent", "quic"}},
+	}}
+	if errs := a.validate(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	for _, c := range []struct {
+		net  string
+		host string
+		ip   string
+		port uint16
+		want bool
+	}{
+		{"tcp", "example.com", "93.184.216.34", 443, true},
+		{"tcp", "10.1.2.3", "10.1.2.3", 80, false},
+		{"tcp", "metadata", "169.254.169.254", 80, false},
+		{"tcp", "db.corp.example", "10.0.0.5", 443, true}, // allowed before the cidr rule
+		{"tcp", "db.corp.example", "10.0.0.5", 5432, false},
+		{"tcp", "notcorp.example", "10.0.0.5", 443, false},
+		{"tcp", "v6.example", "::ffff:10.0.0.1", 80, false}, // IPv4-mapped
+		{"tcp", "v6.example", "fd12::1", 80, false},
+		{"tcp", "mail.example", "93.184.216.34", 25, false},
+		{"tcp", "x.example", "93.184.216.34", 6010, false},
+		{"tcp", "peer.example", "93.184.216.34", 6881, false},
+		{"udp", "93.184.216.34", "93.184.216.34", 6900, false},
+		{"udp", "example.com", "93.184.216.34", 443, false},
+		{"tcp", "example.com", "93.184.216.34", 8443, true},
+		{"udp6", "example.com", "2001:db8::1", 53, true},
+	} {
+		if got := a.Allow(c.net, c.host, netip.MustParseAddr(c.ip), c.port); got != c.want {
+			t.Errorf("Allow(%s, %s, %s, %d) = %v, want %v", c.net, c.host, c.ip, c.port, got, c.want)
+		}
+	}
+
+	a.Default = "deny"
+	if a.Allow("tcp", "example.com", netip.MustParseAddr("93.184.216.34"), 443) {
+		t.Errorf("unmatched destination allowed with default deny")
+	}
+}
+
+func TestACLValidate(t *testing.T) {
+	for _, r := range []ACLRule{
+		{Action: "block", Ports_: "22"},
+		{Action: "deny"},
+		{Action: "deny", CIDR_: []string{"10.0.0.0"}},
+		{Action: "deny", Ports_: "0"},
+		{Action: "deny", Ports_: "90-80"},
+		{Action: "deny", Ports_: "70000"},
+		{Action: "deny", Services: []string{"torrent"}},
+	} {
+		if errs := r.validate(); len(errs) == 0 {
+			t.Errorf("rule %+v validated", r)
+		}
+	}
+}
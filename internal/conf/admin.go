@@ -0,0 +1,50 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Admin configures the local admin API, served as JSON over HTTP on a unix
+// socket.
+type Admin struct {
+	Socket  string `yaml:"socket"`
+	History int    `yaml:"history"` // connection lifecycle events kept in memory
+
+	ProfileDir string `yaml:"profile_dir"` // where captured CPU/heap/trace profiles and SIGQUIT dumps are written
+}
+
+// Enabled reports whether the admin API should be served.
+func (a *Admin) Enabled() bool {
+	return a.Socket != ""
+}
+
+func (a *Admin) setDefaults() {
+	if a.History == 0 {
+		a.History = 1000
+	}
+	if a.ProfileDir == "" {
+		a.ProfileDir = os.TempDir()
+	}
+}
+
+func (a *Admin) validate() []error {
+	var errors []error
+	if a.History < 0 || a.History > 100000 {
+		errors = append(errors, fmt.Errorf("admin.history must be between 0-100000"))
+	}
+	if !a.Enabled() {
+		return errors
+	}
+	if !filepath.IsAbs(a.Socket) {
+		errors = append(errors, fmt.Errorf("admin.socket must be an absolute path"))
+	}
+	if len(a.Socket) > 104 {
+		errors = append(errors, fmt.Errorf("admin.socket path is too long (max 104 characters)"))
+	}
+	if info, err := os.Stat(a.ProfileDir); err != nil || !info.IsDir() {
+		errors = append(errors, fmt.Errorf("admin.profile_dir %s is not a directory", a.ProfileDir))
+	}
+	return errors
+}
@@ -0,0 +1,167 @@
+package conf
+
+import (
+	"fmt"
+	"time"
+)
+
+// Advice is a heuristic suggestion about a setting that is valid but likely
+// to perform poorly.
+type Advice struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Suggest string `json:"suggest,omitempty"` // suggested value for Field
+}
+
+func (a Advice) String() string {
+	if a.Suggest == "" {
+		return fmt.Sprintf("%s: %s", a.Field, a.Message)
+	}
+	return fmt.Sprintf("%s: %s (suggested: %s)", a.Field, a.Message, a.Suggest)
+}
+
+// PathHints describes the expected network path. Rules that need a value
+// that is left zero are skipped.
+type PathHints struct {
+	BandwidthMbps int
+	RTT           time.Duration
+}
+
+// bdp returns the bandwidth-delay product in bytes, or 0 without hints.
+func (h PathHints) bdp() int64 {
+	if h.BandwidthMbps <= 0 || h.RTT <= 0 {
+		return 0
+	}
+	return int64(h.BandwidthMbps) * 1_000_000 / 8 * int64(h.RTT) / int64(time.Second)
+}
+
+// Advise checks a loaded configuration against rules of thumb.
+func (c *Conf) Advise(h PathHints) []Advice {
+	var advice []Advice
+	if c.Transport.Protocol != "websocket" {
+		advice = append(advice, c.Network.PCAP.advise(c.Network.MTU)...)
+		if c.TUN.Enabled && c.TUN.MTU > c.Network.MTU {
+			advice = append(advice, Advice{
+				Field:   "tun.mtu",
+				Message: fmt.Sprintf("%d is larger than network.mtu %d; full-size TUN packets are split across raw packets, so one loss stalls the whole packet", c.TUN.MTU, c.Network.MTU),
+				Suggest: fmt.Sprintf("%d", c.Network.MTU),
+			})
+		}
+	}
+	for i, f := range c.Forward {
+		if f.Duplicate && c.Transport.Conn < 2 {
+			advice = append(advice, Advice{
+				Field:   fmt.Sprintf("forward[%d].duplicate", i),
+				Message: "both copies share the only transport connection, so a loss or stall on it hits them together",
+			})
+		}
+	}
+	if c.Role == "client" && c.Transport.MultipathEnabled() && c.Transport.Conn < 2 {
+		advice = append(advice, Advice{
+			Field:   "transport.conn",
+			Message: "transport.multipath has only one connection to spread traffic over",
+			Suggest: "2",
+		})
+	}
+	if c.Role == "client" && c.Transport.Scheduling.Enabled() && max(c.Transport.Conn, c.Transport.Autoscale.Max) < 2 {
+		advice = append(advice, Advice{
+			Field:   "transport.conn",
+			Message: "transport.scheduling has only one connection, so interactive and bulk streams still share it",
+			Suggest: "2",
+		})
+	}
+	switch c.Transport.Protocol {
+	case "kcp":
+		advice = append(advice, c.AdviseWindows(h)...)
+	case "quic":
+		if c.Transport.QUIC != nil {
+			advice = append(advice, c.Transport.QUIC.advise(h)...)
+		}
+	}
+	return advice
+}
+
+func (p *PCAP) advise(mtu int) []Advice {
+	// Draining the send queue from the high to the low watermark hands
+	// this many bytes to the kernel at once.
+	burst := p.SendQueueSize * (p.HighWatermark - p.LowWatermark) / 100 * mtu
+	if p.Sockbuf >= burst {
+		return nil
+	}
+	return []Advice{{
+		Field:   "network.pcap.sockbuf",
+		Message: fmt.Sprintf("%d bytes cannot absorb the %d-byte burst of a send queue draining between its watermarks; the kernel drops the excess", p.Sockbuf, burst),
+		Suggest: fmt.Sprintf("%d", min(nextPowerOf2(burst), 64*1024*1024)),
+	}}
+}
+
+// Window returns the KCP window, in packets, that covers the
+// bandwidth-delay product of h with headroom for loss recovery, or 0
+// without hints.
+func (k *KCP) Window(h PathHints) int {
+	bdp := h.bdp()
+	if bdp == 0 {
+		return 0
+	}
+	need := int((bdp + int64(k.MTU) - 1) / int64(k.MTU))
+	return min(need*3/2, 32768)
+}
+
+// AdviseWindows checks the KCP windows and network.pcap.sockbuf against
+// the bandwidth-delay product of h.
+func (c *Conf) AdviseWindows(h PathHints) []Advice {
+	if c.Transport.Protocol != "kcp" || c.Transport.KCP == nil {
+		return nil
+	}
+	return append(c.Transport.KCP.advise(h), c.Network.PCAP.adviseBDP(h)...)
+}
+
+// adviseBDP checks that the socket buffer can take a full window sent at
+// once, as KCP does after a stall.
+func (p *PCAP) adviseBDP(h PathHints) []Advice {
+	bdp := h.bdp()
+	if bdp == 0 || int64(p.Sockbuf) >= bdp {
+		return nil
+	}
+	return []Advice{{
+		Field:   "network.pcap.sockbuf",
+		Message: fmt.Sprintf("%d bytes is below the bandwidth-delay product of %d bytes for %d Mbit/s at %s; a full window flushed at once overflows it", p.Sockbuf, bdp, h.BandwidthMbps, h.RTT),
+		Suggest: fmt.Sprintf("%d", min(nextPowerOf2(int(bdp)), 64*1024*1024)),
+	}}
+}
+
+func (k *KCP) advise(h PathHints) []Advice {
+	bdp := h.bdp()
+	if bdp == 0 {
+		return nil
+	}
+	need := int((bdp + int64(k.MTU) - 1) / int64(k.MTU))
+	var advice []Advice
+	for _, w := range []struct {
+		field string
+		value int
+	}{{"transport.kcp.rcvwnd", k.Rcvwnd}, {"transport.kcp.sndwnd", k.Sndwnd}} {
+		if w.value >= need {
+			continue
+		}
+		capMbps := int64(w.value) * int64(k.MTU) * 8 * int64(time.Second) / int64(h.RTT) / 1_000_000
+		advice = append(advice, Advice{
+			Field:   w.field,
+			Message: fmt.Sprintf("%d packets is below the bandwidth-delay product of %d packets for %d Mbit/s at %s; throughput is capped near %d Mbit/s", w.value, need, h.BandwidthMbps, h.RTT, capMbps),
+			Suggest: fmt.Sprintf("%d", k.Window(h)),
+		})
+	}
+	return advice
+}
+
+func (q *QUIC) advise(h PathHints) []Advice {
+	bdp := h.bdp()
+	if bdp == 0 || q.MaxConnectionReceiveWindow >= bdp {
+		return nil
+	}
+	return []Advice{{
+		Field:   "transport.quic.max_connection_receive_window",
+		Message: fmt.Sprintf("%d bytes is below the bandwidth-delay product of %d bytes for %d Mbit/s at %s", q.MaxConnectionReceiveWindow, bdp, h.BandwidthMbps, h.RTT),
+		Suggest: fmt.Sprintf("%d", bdp*2),
+	}}
+}
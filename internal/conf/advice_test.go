@@ -0,0 +1,49 @@
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKCPAdviceWindow(t *testing.T) {
+	k := &KCP{MTU: 1350, Rcvwnd: 1024, Sndwnd: 32768}
+
+	if got := k.advise(PathHints{}); len(got) != 0 {
+		t.Fatalf("advice without path hints: %v", got)
+	}
+
+	// 100 Mbit/s at 200ms is 2.5 MB in flight, about 1852 packets.
+	got := k.advise(PathHints{BandwidthMbps: 100, RTT: 200 * time.Millisecond})
+	if len(got) != 1 || got[0].Field != "transport.kcp.rcvwnd" {
+		t.Fatalf("advice = %v, want one rcvwnd entry", got)
+	}
+	if got[0].Suggest != "2778" {
+		t.Errorf("suggested rcvwnd = %s, want 2778", got[0].Suggest)
+	}
+}
+
+func TestPCAPAdviceSockbuf(t *testing.T) {
+	p := &PCAP{Sockbuf: 1 << 20, SendQueueSize: 10000, HighWatermark: 100, LowWatermark: 90}
+	got := p.advise(1500)
+	if len(got) != 1 || got[0].Suggest != "2097152" {
+		t.Fatalf("advice = %v, want sockbuf 2097152", got)
+	}
+
+	p.Sockbuf = 2 << 20
+	if got := p.advise(1500); len(got) != 0 {
+		t.Errorf("advice for a large enough sockbuf: %v", got)
+	}
+}
+
+func TestPCAPAdviceBDP(t *testing.T) {
+	p := &PCAP{Sockbuf: 1 << 20}
+	if got := p.adviseBDP(PathHints{}); len(got) != 0 {
+		t.Fatalf("advice without path hints: %v", got)
+	}
+
+	// 100 Mbit/s at 200ms is 2.5 MB, rounded up to 4 MB.
+	got := p.adviseBDP(PathHints{BandwidthMbps: 100, RTT: 200 * time.Millisecond})
+	if len(got) != 1 || got[0].Suggest != "4194304" {
+		t.Fatalf("advice = %v, want sockbuf 4194304", got)
+	}
+}
@@ -0,0 +1,56 @@
+package conf
+
+import "fmt"
+
+// Autoscale lets the client add transport connections while the existing
+// ones are saturated and drop them again when demand falls, instead of
+// keeping transport.conn connections regardless of load.
+type Autoscale struct {
+	Min        int     `yaml:"min"`         // never fewer connections (default 1)
+	Max        int     `yaml:"max"`         // never more connections (0 = off)
+	Interval   int     `yaml:"interval"`    // seconds between decisions
+	TargetMbps float64 `yaml:"target_mbps"` // per-connection throughput that triggers another connection
+}
+
+// Enabled reports whether the connection count is scaled automatically.
+func (a *Autoscale) Enabled() bool {
+	return a.Max > 0
+}
+
+func (a *Autoscale) setDefaults() {
+	if !a.Enabled() {
+		return
+	}
+	if a.Min == 0 {
+		a.Min = 1
+	}
+	if a.Interval == 0 {
+		a.Interval = 10
+	}
+	if a.TargetMbps == 0 {
+		a.TargetMbps = 20
+	}
+}
+
+func (a *Autoscale) validate(conn int) []error {
+	var errors []error
+	if !a.Enabled() {
+		return errors
+	}
+	if a.Max > 256 {
+		errors = append(errors, fmt.Errorf("autoscale max must be between 1-256 connections"))
+	}
+	if a.Min < 1 || a.Min > a.Max {
+		errors = append(errors, fmt.Errorf("autoscale min must be between 1 and autoscale max (%d)", a.Max))
+	}
+	if conn < a.Min || conn > a.Max {
+		errors = append(errors, fmt.Errorf("transport conn (%d) must be between autoscale min (%d) and max (%d)", conn, a.Min, a.Max))
+	}
+	if a.Interval < 2 || a.Interval > 300 {
+		errors = append(errors, fmt.Errorf("autoscale interval must be between 2-300 seconds"))
+	}
+	if a.TargetMbps <= 0 {
+		errors = append(errors, fmt.Errorf("autoscale target_mbps must be positive"))
+	}
+	return errors
+}
@@ -0,0 +1,36 @@
+package conf
+
+import "testing"
+
+func TestAutoscaleValidate(t *testing.T) {
+	a := Autoscale{Max: 8}
+	a.setDefaults()
+	if a.Min != 1 || a.Interval != 10 || a.TargetMbps != 20 {
+		t.Fatalf("defaults = %+v", a)
+	}
+	if errs := a.validate(2); len(errs) != 0 {
+		t.Errorf("valid config: %v", errs)
+	}
+	if errs := a.validate(9); len(errs) != 1 {
+		t.Errorf("conn above max: %v", errs)
+	}
+
+	a = Autoscale{Min: 4, Max: 2, Interval: 1, TargetMbps: 20}
+	if errs := a.validate(2); len(errs) != 3 {
+		t.Errorf("min above max, conn below min and short interval: %v", errs)
+	}
+
+	off := Autoscale{}
+	off.setDefaults()
+	if off.Enabled() || len(off.validate(1)) != 0 {
+		t.Errorf("disabled autoscale: %+v", off)
+	}
+}
+
+func TestAutoscaleClampsDefaultConn(t *testing.T) {
+	tr := Transport{Protocol: "websocket", WS: &WebSocket{}, Autoscale: Autoscale{Min: 6, Max: 8}}
+	tr.setDefaults("client")
+	if tr.Conn != 6 {
+		t.Errorf("default conn = %d, want autoscale min 6", tr.Conn)
+	}
+}
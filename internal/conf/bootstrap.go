@@ -0,0 +1,101 @@
+package conf
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Bootstrap configures fetching the server list and obfuscation parameters
+// from a signed document published over HTTPS.
+type Bootstrap struct {
+	URL        string `yaml:"url"`
+	Front      string `yaml:"front"`      // TLS/SNI host for domain fronting; the URL host goes in the Host header
+	PublicKey_ string `yaml:"public_key"` // operator Ed25519 public key, base64 or hex
+	Cache      string `yaml:"cache"`      // last verified document, used when the fetch fails
+	Timeout    int    `yaml:"timeout"`    // seconds
+
+	PublicKey ed25519.PublicKey `yaml:"-"`
+}
+
+// BootstrapParams are the settings a bootstrap document may override.
+type BootstrapParams struct {
+	KCPBlock   string
+	KCPKey     string
+	LocalFlag  []string
+	RemoteFlag []string
+}
+
+// Enabled reports whether a bootstrap URL is configured.
+func (b *Bootstrap) Enabled() bool {
+	return b.URL != ""
+}
+
+func (b *Bootstrap) setDefaults() {
+	if b.Timeout == 0 {
+		b.Timeout = 15
+	}
+}
+
+func (b *Bootstrap) validate() []error {
+	var errors []error
+	if !b.Enabled() {
+		return errors
+	}
+
+	u, err := url.Parse(b.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		errors = append(errors, fmt.Errorf("bootstrap url must be an https:// URL"))
+	}
+	if strings.ContainsAny(b.Front, "/:") {
+		errors = append(errors, fmt.Errorf("bootstrap front must be a bare hostname"))
+	}
+
+	key, err := decodeKey(b.PublicKey_)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		errors = append(errors, fmt.Errorf("bootstrap public_key must be a %d-byte Ed25519 key in base64 or hex", ed25519.PublicKeySize))
+	}
+	b.PublicKey = key
+
+	if b.Timeout < 1 || b.Timeout > 300 {
+		errors = append(errors, fmt.Errorf("bootstrap timeout must be between 1-300 seconds"))
+	}
+	return errors
+}
+
+func decodeKey(s string) ([]byte, error) {
+	if k, err := hex.DecodeString(s); err == nil {
+		return k, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// BootstrapPending reports whether validation was deferred until the server
+// address is supplied by a bootstrap document.
+func (c *Conf) BootstrapPending() bool {
+	return c.Role == "client" && c.Bootstrap.Enabled() && c.Server.Addr_ == ""
+}
+
+// ApplyBootstrap sets the server address and obfuscation parameters taken
+// from a verified bootstrap document and re-runs validation.
+func (c *Conf) ApplyBootstrap(server string, p BootstrapParams) error {
+	c.Server.Addr_ = server
+	if c.Transport.KCP != nil {
+		if p.KCPBlock != "" {
+			c.Transport.KCP.Block_ = p.KCPBlock
+		}
+		if p.KCPKey != "" {
+			c.Transport.KCP.Key = p.KCPKey
+		}
+	}
+	if len(p.LocalFlag) > 0 {
+		c.Network.TCP.LF_ = p.LocalFlag
+	}
+	if len(p.RemoteFlag) > 0 {
+		c.Network.TCP.RF_ = p.RemoteFlag
+	}
+	return c.validate()
+}
@@ -0,0 +1,50 @@
+package conf
+
+import "fmt"
+
+// Breaker caps how often the client establishes transport connections to
+// the server, on top of the retry backoff of single streams, and stops
+// dialing a server that keeps failing until a cooldown has passed.
+type Breaker struct {
+	Rate        int `yaml:"rate"`         // dials per minute to the server, 0 = unlimited
+	Failures    int `yaml:"failures"`     // consecutive failed dials that open the circuit, 0 = never
+	Cooldown    int `yaml:"cooldown"`     // seconds the circuit stays open before a probe dial
+	MaxCooldown int `yaml:"max_cooldown"` // seconds the cooldown doubles up to after failed probes
+}
+
+// Enabled reports whether dials are limited at all.
+func (b *Breaker) Enabled() bool {
+	return b.Rate > 0 || b.Failures > 0
+}
+
+func (b *Breaker) setDefaults() {
+	if b.Failures == 0 {
+		return
+	}
+	if b.Cooldown == 0 {
+		b.Cooldown = 30
+	}
+	if b.MaxCooldown == 0 {
+		b.MaxCooldown = max(600, b.Cooldown)
+	}
+}
+
+func (b *Breaker) validate() []error {
+	var errors []error
+	if b.Rate < 0 || b.Rate > 600 {
+		errors = append(errors, fmt.Errorf("transport.breaker.rate must be between 0-600 dials per minute"))
+	}
+	if b.Failures < 0 || b.Failures > 100 {
+		errors = append(errors, fmt.Errorf("transport.breaker.failures must be between 0-100"))
+	}
+	if b.Failures == 0 {
+		return errors
+	}
+	if b.Cooldown < 1 || b.Cooldown > 3600 {
+		errors = append(errors, fmt.Errorf("transport.breaker.cooldown must be between 1-3600 seconds"))
+	}
+	if b.MaxCooldown < b.Cooldown || b.MaxCooldown > 86400 {
+		errors = append(errors, fmt.Errorf("transport.breaker.max_cooldown must be between the cooldown and 86400 seconds"))
+	}
+	return errors
+}
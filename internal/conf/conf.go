@@ -2,8 +2,11 @@ package conf
 
 import (
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
 	"paqet/internal/flog"
+	"paqet/internal/pkg/nat64"
 	"slices"
 	"strings"
 
@@ -11,16 +14,33 @@ import (
 )
 
 type Conf struct {
-	Role        string      `yaml:"role"`
-	Log         Log         `yaml:"log"`
-	Listen      Server      `yaml:"listen"`
-	SOCKS5      []SOCKS5    `yaml:"socks5"`
-	Forward     []Forward   `yaml:"forward"`
-	TUN         TUN         `yaml:"tun"`
-	Network     Network     `yaml:"network"`
-	Server      Server      `yaml:"server"`
-	Transport   Transport   `yaml:"transport"`
-	Performance Performance `yaml:"performance"`
+	Role        string        `yaml:"role"`
+	Log         Log           `yaml:"log"`
+	Listen      Server        `yaml:"listen"`
+	SOCKS5      []SOCKS5      `yaml:"socks5"`
+	Forward     []Forward     `yaml:"forward"`
+	Reverse     []Reverse     `yaml:"reverse"`
+	TUN         TUN           `yaml:"tun"`
+	Network     Network       `yaml:"network"`
+	Server      Server        `yaml:"server"`
+	Transport   Transport     `yaml:"transport"`
+	Performance Performance   `yaml:"performance"`
+	HA          HA            `yaml:"ha"`
+	Bootstrap   Bootstrap     `yaml:"bootstrap"`
+	Egress      Egress        `yaml:"egress"`
+	Admin       Admin         `yaml:"admin"`
+	Probe       Probe         `yaml:"probe"`
+	UpstreamTLS []UpstreamTLS `yaml:"upstream_tls"`
+	Metrics     Metrics       `yaml:"metrics"`
+	Reload      Reload        `yaml:"reload"`
+	Tap         Tap           `yaml:"tap"`
+	State       State         `yaml:"state"`
+	Roaming     Roaming       `yaml:"roaming"`
+	DNS         DNS           `yaml:"dns"`
+	Routing     Routing       `yaml:"routing"`
+	Kcptun      Kcptun        `yaml:"kcptun"`
+	Publish     Publish       `yaml:"publish"`
+	DestStats   DestStats     `yaml:"dest_stats"`
 }
 
 func LoadFromFile(path string) (*Conf, error) {
@@ -34,6 +54,12 @@ func LoadFromFile(path string) (*Conf, error) {
 	if err := yaml.Unmarshal(data, &conf); err != nil {
 		return &conf, err
 	}
+	if err := conf.applyEnv(os.Environ()); err != nil {
+		return &conf, err
+	}
+	if err := conf.resolveSecrets(); err != nil {
+		return &conf, err
+	}
 
 	validRoles := []string{"client", "server"}
 	if !slices.Contains(validRoles, conf.Role) {
@@ -62,6 +88,21 @@ func (c *Conf) setDefaults() {
 	c.Server.setDefaults()
 	c.Transport.setDefaults(c.Role)
 	c.Performance.setDefaults(c.Role)
+	c.HA.setDefaults()
+	c.Bootstrap.setDefaults()
+	c.Egress.setDefaults()
+	c.Admin.setDefaults()
+	c.Probe.setDefaults()
+	c.Roaming.setDefaults()
+	c.DNS.setDefaults()
+	c.Metrics.setDefaults()
+	c.Reload.setDefaults()
+	c.Kcptun.setDefaults(c.Role)
+	c.Publish.setDefaults()
+	c.DestStats.setDefaults()
+	for i := range c.UpstreamTLS {
+		c.UpstreamTLS[i].setDefaults()
+	}
 	// Link performance config to network for access in lower layers
 	c.Network.Performance = &c.Performance
 }
@@ -70,8 +111,13 @@ func (c *Conf) validate() error {
 	var allErrors []error
 
 	allErrors = append(allErrors, c.Log.validate()...)
-	if c.Role == "client" && len(c.SOCKS5) == 0 && len(c.Forward) == 0 && !c.TUN.Enabled {
-		flog.Warnf("warning: client mode enabled but no SOCKS5, forward, or TUN configurations found")
+	allErrors = append(allErrors, c.Bootstrap.validate()...)
+	if c.BootstrapPending() {
+		// The rest is validated by ApplyBootstrap once the server is known.
+		return writeErr(allErrors)
+	}
+	if c.Role == "client" && len(c.SOCKS5) == 0 && len(c.Forward) == 0 && len(c.Reverse) == 0 && !c.TUN.Enabled && !c.DNS.Enabled() && !c.Kcptun.Enabled() {
+		flog.Warnf("warning: client mode enabled but no SOCKS5, forward, reverse, TUN, DNS or kcptun configurations found")
 	}
 	for i := range c.SOCKS5 {
 		errs := c.SOCKS5[i].validate()
@@ -86,29 +132,235 @@ func (c *Conf) validate() error {
 			allErrors = append(allErrors, fmt.Errorf("forward[%d] %v", i, err))
 		}
 	}
+	for i := range c.Reverse {
+		for _, err := range c.Reverse[i].validate() {
+			allErrors = append(allErrors, fmt.Errorf("reverse[%d] %v", i, err))
+		}
+	}
 
 	allErrors = append(allErrors, c.TUN.validate()...)
+	if c.TUN.Enabled && c.TUN.Offload {
+		if c.Transport.TUNBuf < 128*1024 {
+			allErrors = append(allErrors, fmt.Errorf("tun.offload requires a transport.tunbuf of at least 128KB to hold a super-packet"))
+		}
+		if c.Role == "client" && c.Transport.MultipathEnabled() {
+			allErrors = append(allErrors, fmt.Errorf("tun.offload cannot be combined with transport.multipath, which splits the stream into datagrams"))
+		}
+	}
 
-	allErrors = append(allErrors, c.Network.validate()...)
+	// The WebSocket transport uses the kernel's TCP stack, not the raw
+	// packet path, so the network section is unused.
+	if c.Transport.Protocol != "websocket" {
+		allErrors = append(allErrors, c.Network.validate()...)
+	}
 	allErrors = append(allErrors, c.Transport.validate()...)
+	if c.Network.PortHopping.Enabled() {
+		if c.Transport.PSK == "" {
+			allErrors = append(allErrors, fmt.Errorf("network.port_hopping requires transport.psk, from which the schedule is derived"))
+		}
+		if c.Transport.Protocol == "websocket" {
+			allErrors = append(allErrors, fmt.Errorf("network.port_hopping applies to the kcp and quic transports only"))
+		}
+		c.Network.PortHopping.Key = []byte(c.Transport.PSK)
+	}
+	if c.Network.Gate.Enabled() {
+		if c.Transport.PSK == "" {
+			allErrors = append(allErrors, fmt.Errorf("network.gate requires transport.psk, with which knocks are authenticated"))
+		}
+		if c.Transport.Protocol == "websocket" {
+			allErrors = append(allErrors, fmt.Errorf("network.gate applies to the kcp and quic transports only"))
+		}
+		c.Network.Gate.Key = []byte(c.Transport.PSK)
+	}
 	allErrors = append(allErrors, c.Performance.validate()...)
+	allErrors = append(allErrors, c.Kcptun.validate(c.Role)...)
+	allErrors = append(allErrors, c.Publish.validate(c.Role)...)
+	allErrors = append(allErrors, c.validateMTU()...)
+	allErrors = append(allErrors, c.Admin.validate()...)
+	allErrors = append(allErrors, c.Metrics.validate()...)
+	allErrors = append(allErrors, c.Tap.validate()...)
 	if c.Role == "server" {
 		allErrors = append(allErrors, c.Listen.validate()...)
+		allErrors = append(allErrors, c.HA.validate()...)
+		allErrors = append(allErrors, c.Egress.validate()...)
+		allErrors = append(allErrors, c.Server.ACL.validate()...)
+		allErrors = append(allErrors, c.Server.Reverse.validate()...)
+		allErrors = append(allErrors, c.Server.Priority.validate()...)
+		allErrors = append(allErrors, c.Server.validateEgressProxy()...)
+		allErrors = append(allErrors, c.DestStats.validate()...)
+		if c.DestStats.Enabled() && !c.Admin.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("dest_stats is served on the admin API and requires admin.socket"))
+		}
+		if c.Transport.PSK == "" && slices.ContainsFunc(c.Server.Priority, func(r PriorityRule) bool { return len(r.Clients) > 0 }) {
+			allErrors = append(allErrors, fmt.Errorf("server.priority clients requires transport.psk, without which clients do not authenticate"))
+		}
+		if len(c.Reverse) > 0 {
+			allErrors = append(allErrors, fmt.Errorf("reverse is only used in the client role; servers allow ports with server.reverse"))
+		}
+		if c.Server.Failover.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("server.failover is only used in the client role"))
+		}
+		if c.Network.PCAP.PacingAuto {
+			allErrors = append(allErrors, fmt.Errorf("network.pcap.pacing_rate \"auto\" is only supported on clients"))
+		}
+		if c.State.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("state.dir is only used in the client role"))
+		}
+		if c.Roaming.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("roaming is only used in the client role"))
+		}
+		if c.DNS.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("dns is only used in the client role"))
+		}
+		if c.Routing.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("routing is only used in the client role"))
+		}
+		if c.Transport.Heartbeat.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("transport.heartbeat is only used in the client role"))
+		}
+		if len(c.Transport.Groups) > 0 {
+			allErrors = append(allErrors, fmt.Errorf("transport.groups is only used in the client role"))
+		}
+		if c.Transport.Scheduling.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("transport.scheduling is only used in the client role"))
+		}
+		if c.Transport.Breaker.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("transport.breaker is only used in the client role"))
+		}
+		if c.Transport.Resume != nil {
+			allErrors = append(allErrors, fmt.Errorf("transport.resume is only used in the client role; servers allow 0-RTT with transport.quic.enable_0rtt"))
+		}
+		if k := c.Transport.KCP; k != nil && (k.Bandwidth != 0 || k.AutoWindow) {
+			allErrors = append(allErrors, fmt.Errorf("transport.kcp.bandwidth and auto_window are only used in the client role"))
+		}
+		if c.Performance.BalanceStrategy != BalanceRoundRobin {
+			allErrors = append(allErrors, fmt.Errorf("performance.balance_strategy is only used in the client role"))
+		}
+		if c.TUN.Enabled && c.TUN.Auto {
+			allErrors = append(allErrors, fmt.Errorf("tun.addr \"auto\" is only used in the client role"))
+		}
+		if len(c.TUN.Routes_) > 0 || len(c.TUN.ExcludeRoutes_) > 0 {
+			allErrors = append(allErrors, fmt.Errorf("tun.routes and tun.exclude_routes are only used in the client role"))
+		}
+		if c.TUN.DownGrace != 0 {
+			allErrors = append(allErrors, fmt.Errorf("tun.down_grace is only used in the client role"))
+		}
+		if c.TUN.Enabled && c.TUN.Queues > 1 && !c.TUN.Routing {
+			allErrors = append(allErrors, fmt.Errorf("tun.queues above 1 on a server requires tun.routing, without which flows would be hashed across every client's streams"))
+		}
+		if c.Server.DrainTimeout < 1 || c.Server.DrainTimeout > 86400 {
+			allErrors = append(allErrors, fmt.Errorf("server.drain_timeout must be between 1-86400 seconds"))
+		}
+		if c.Server.ShutdownGrace != -1 && (c.Server.ShutdownGrace < 1 || c.Server.ShutdownGrace > 86400) {
+			allErrors = append(allErrors, fmt.Errorf("server.shutdown_grace must be -1 or between 1-86400 seconds"))
+		}
+		for i := range c.UpstreamTLS {
+			for _, err := range c.UpstreamTLS[i].validate() {
+				allErrors = append(allErrors, fmt.Errorf("upstream_tls[%d] %v", i, err))
+			}
+		}
 	} else {
 		allErrors = append(allErrors, c.Server.validate()...)
-		if c.Server.Addr.IP.To4() != nil && c.Network.IPv4.Addr == nil {
-			allErrors = append(allErrors, fmt.Errorf("server address is IPv4, but the IPv4 interface is not configured"))
+		if c.Server.ACL.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("server.acl is only used in the server role"))
+		}
+		if c.Server.Reverse.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("server.reverse is only used in the server role"))
+		}
+		if len(c.Server.Priority) > 0 {
+			allErrors = append(allErrors, fmt.Errorf("server.priority is only used in the server role"))
+		}
+		if c.Server.EgressProxy_ != "" {
+			allErrors = append(allErrors, fmt.Errorf("server.egress_proxy is only used in the server role"))
+		}
+		if c.DestStats.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("dest_stats is only used in the server role"))
+		}
+		if c.Server.Failover.Enabled() && c.Transport.Protocol != "websocket" && c.Network.Port != 0 {
+			allErrors = append(allErrors, fmt.Errorf("server.failover probes other servers on ports of their own, which requires network.port 0"))
+		}
+		if c.Network.Gate.Decoy_ != "" {
+			allErrors = append(allErrors, fmt.Errorf("network.gate.decoy is only used in the server role"))
 		}
-		if c.Server.Addr.IP.To4() == nil && c.Network.IPv6.Addr == nil {
-			allErrors = append(allErrors, fmt.Errorf("server address is IPv6, but the IPv6 interface is not configured"))
+		if c.TUN.Routing || c.TUN.SNAT {
+			allErrors = append(allErrors, fmt.Errorf("tun.routing and tun.snat are only used in the server role"))
 		}
-		if c.Transport.Conn > 1 && c.Network.Port != 0 {
-			allErrors = append(allErrors, fmt.Errorf("only one connection is allowed when a client port is explicitly set"))
+		if c.TUN.ProxyARP != "" {
+			allErrors = append(allErrors, fmt.Errorf("tun.proxy_arp is only used in the server role"))
+		}
+		if c.TUN.Pool_ != "" {
+			allErrors = append(allErrors, fmt.Errorf("tun.pool is only used in the server role"))
+		}
+		allErrors = append(allErrors, c.Probe.validate()...)
+		allErrors = append(allErrors, c.Roaming.validate()...)
+		allErrors = append(allErrors, c.DNS.validate()...)
+		allErrors = append(allErrors, c.Routing.validate()...)
+		allErrors = append(allErrors, c.Reload.validate()...)
+		allErrors = append(allErrors, c.Transport.Heartbeat.validate("transport.heartbeat")...)
+		allErrors = append(allErrors, validateGroups(c.Transport.Groups)...)
+		allErrors = append(allErrors, c.validateGroupRefs()...)
+		allErrors = append(allErrors, c.Transport.Scheduling.validate()...)
+		allErrors = append(allErrors, c.Transport.Breaker.validate()...)
+		if c.Transport.Scheduling.Enabled() && !c.Transport.Heartbeat.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("transport.scheduling requires transport.heartbeat, whose pings measure the round-trip times"))
+		}
+		if b := c.Performance.BalanceStrategy; (b == BalanceLowestRTT || b == BalanceWeighted) && !c.Transport.Heartbeat.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("performance.balance_strategy %s requires transport.heartbeat, whose pings measure the round-trip times", b))
+		}
+		allErrors = append(allErrors, c.State.validate()...)
+		if q := c.Transport.QUIC; c.Transport.Protocol == "quic" && q != nil && q.TOFU && !c.State.Enabled() {
+			allErrors = append(allErrors, fmt.Errorf("transport.quic.tofu requires state.dir"))
+		}
+		if c.Network.PCAP.PacingAuto && c.Probe.ThroughputInterval == 0 {
+			allErrors = append(allErrors, fmt.Errorf("network.pcap.pacing_rate \"auto\" requires probe.throughput_interval"))
+		}
+		c.synthesizeServerAddr()
+		if c.Network.PortHopping.Enabled() {
+			c.Network.PortHopping.Hop = c.Server.Addr
+		}
+		if c.Network.Gate.Enabled() {
+			c.Network.Gate.Knock = c.Server.Addr
+		}
+		c.TUN.Servers = c.Server.Addrs()
+		if c.Transport.Protocol != "websocket" {
+			for _, addr := range c.Server.Addrs() {
+				if addr.IP.To4() != nil && c.Network.IPv4.Addr == nil {
+					allErrors = append(allErrors, fmt.Errorf("server address %s is IPv4, but the IPv4 interface is not configured", addr))
+				}
+				if addr.IP.To4() == nil && c.Network.IPv6.Addr == nil {
+					allErrors = append(allErrors, fmt.Errorf("server address %s is IPv6, but the IPv6 interface is not configured", addr))
+				}
+			}
+			if max(c.Transport.Conn, c.Transport.Autoscale.Max)+c.Transport.GroupConns() > 1 && c.Network.Port != 0 {
+				allErrors = append(allErrors, fmt.Errorf("only one connection is allowed when a client port is explicitly set"))
+			}
 		}
 	}
 	return writeErr(allErrors)
 }
 
+// synthesizeServerAddr rewrites IPv4 server addresses into the NAT64
+// prefix when only IPv6 is configured, so the raw packet path can reach
+// them.
+func (c *Conf) synthesizeServerAddr() {
+	if !c.Network.NAT64.IsValid() || c.Server.Addr == nil || c.Network.IPv4.Addr != nil {
+		return
+	}
+	synthesize := func(addr *net.UDPAddr) *net.UDPAddr {
+		v4, ok := netip.AddrFromSlice(addr.IP.To4())
+		if !ok {
+			return addr
+		}
+		return &net.UDPAddr{IP: nat64.Synthesize(c.Network.NAT64, v4).AsSlice(), Port: addr.Port}
+	}
+	c.Server.Addr = synthesize(c.Server.Addr)
+	for i := range c.Server.Failover.Servers {
+		if s := &c.Server.Failover.Servers[i]; s.Addr != nil {
+			s.Addr = synthesize(s.Addr)
+		}
+	}
+}
+
 func writeErr(allErrors []error) error {
 	if len(allErrors) > 0 {
 		var messages []string
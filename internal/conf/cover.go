@@ -0,0 +1,35 @@
+package conf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Cover configures traffic sent during idle periods so that a quiet
+// connection keeps the packet pattern of the selected profile instead of
+// going silent or emitting only transport keepalives.
+type Cover struct {
+	Profile string `yaml:"profile"` // none, tls or rtp
+	Idle    int    `yaml:"idle_ms"` // quiet time before cover traffic starts
+}
+
+func (c *Cover) setDefaults() {
+	if c.Profile == "" {
+		c.Profile = "none"
+	}
+	if c.Idle == 0 {
+		c.Idle = 1000
+	}
+}
+
+func (c *Cover) validate() []error {
+	var errors []error
+	validProfiles := []string{"none", "tls", "rtp"}
+	if !slices.Contains(validProfiles, c.Profile) {
+		errors = append(errors, fmt.Errorf("cover profile must be one of: %v", validProfiles))
+	}
+	if c.Idle < 20 || c.Idle > 600000 {
+		errors = append(errors, fmt.Errorf("cover idle_ms must be between 20-600000"))
+	}
+	return errors
+}
@@ -0,0 +1,34 @@
+package conf
+
+import "fmt"
+
+// DestStats samples the TCP streams a server relays to break packet loss
+// down by destination: loss on the tunnel connection that carried them
+// against retransmissions on the upstream connection to the destination,
+// to tell a bad path to the client from a bad destination.
+type DestStats struct {
+	Sample int `yaml:"sample"` // measure 1 in Sample TCP streams (0 = off)
+	Max    int `yaml:"max"`    // destinations kept; the least recently seen goes first
+}
+
+// Enabled reports whether streams are sampled.
+func (d *DestStats) Enabled() bool {
+	return d.Sample > 0
+}
+
+func (d *DestStats) setDefaults() {
+	if d.Max == 0 {
+		d.Max = 1000
+	}
+}
+
+func (d *DestStats) validate() []error {
+	var errors []error
+	if d.Sample < 0 || d.Sample > 1000000 {
+		errors = append(errors, fmt.Errorf("dest_stats.sample must be between 0-1000000"))
+	}
+	if d.Max < 1 || d.Max > 100000 {
+		errors = append(errors, fmt.Errorf("dest_stats.max must be between 1-100000"))
+	}
+	return errors
+}
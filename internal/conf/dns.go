@@ -0,0 +1,61 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// DNS is the client's DNS forwarder: queries sent to Listen are resolved
+// through the tunnel, so that none leave the host on the local network.
+type DNS struct {
+	Listen_  string `yaml:"listen"`   // host:port served over UDP and TCP; empty disables the forwarder
+	Upstream string `yaml:"upstream"` // resolver host:port reached over UDP, or an https:// DoH URL
+	Timeout  int    `yaml:"timeout"`  // seconds a query may take through the tunnel
+
+	Listen *net.UDPAddr `yaml:"-"`
+	DoH    *url.URL     `yaml:"-"` // set when Upstream is a DoH URL
+}
+
+// Enabled reports whether the DNS forwarder should be served.
+func (d *DNS) Enabled() bool {
+	return d.Listen_ != ""
+}
+
+func (d *DNS) setDefaults() {
+	if !d.Enabled() {
+		return
+	}
+	if d.Upstream == "" {
+		d.Upstream = "1.1.1.1:53"
+	}
+	if d.Timeout == 0 {
+		d.Timeout = 5
+	}
+}
+
+func (d *DNS) validate() []error {
+	var errors []error
+	if !d.Enabled() {
+		return errors
+	}
+	l, err := validateAddr(d.Listen_, true)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("dns.listen %v", err))
+	}
+	d.Listen = l
+
+	d.DoH = nil
+	if u, err := url.Parse(d.Upstream); err == nil && u.Scheme == "https" {
+		if u.Host == "" {
+			errors = append(errors, fmt.Errorf("dns.upstream '%s' has no host", d.Upstream))
+		}
+		d.DoH = u
+	} else if _, _, err := net.SplitHostPort(d.Upstream); err != nil {
+		errors = append(errors, fmt.Errorf("invalid dns.upstream '%s' (expected host:port or https:// URL): %v", d.Upstream, err))
+	}
+	if d.Timeout < 1 || d.Timeout > 60 {
+		errors = append(errors, fmt.Errorf("dns.timeout must be between 1-60 seconds"))
+	}
+	return errors
+}
@@ -0,0 +1,27 @@
+package conf
+
+import "testing"
+
+func TestDNSConfig(t *testing.T) {
+	for _, tc := range []struct {
+		listen, upstream string
+		doh, ok          bool
+	}{
+		{"127.0.0.1:53", "", false, true},
+		{"127.0.0.1:5353", "9.9.9.9:53", false, true},
+		{"127.0.0.1:53", "https://dns.example/dns-query", true, true},
+		{"127.0.0.1:53", "9.9.9.9", false, false},
+		{"127.0.0.1:53", "https:///dns-query", false, false},
+		{"127.0.0.1", "", false, false},
+	} {
+		d := DNS{Listen_: tc.listen, Upstream: tc.upstream}
+		d.setDefaults()
+		errs := d.validate()
+		if (len(errs) == 0) != tc.ok {
+			t.Errorf("listen %s, upstream %q: errors %v, want ok=%v", tc.listen, tc.upstream, errs, tc.ok)
+		}
+		if tc.ok && (d.DoH != nil) != tc.doh {
+			t.Errorf("upstream %q: DoH %v, want %v", tc.upstream, d.DoH, tc.doh)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package conf
+
+import (
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	echVersion    = 0xfe0d
+	hpkeX25519KEM = 0x0020
+	hpkeHKDF256   = 0x0001
+	hpkeAES128GCM = 0x0001
+	hpkeChaCha20  = 0x0003
+)
+
+// ECHConfigList derives the serialized ECHConfigList for an X25519 ECH
+// private key. The result is deterministic, so the server and the value
+// handed to clients always match byte for byte.
+func ECHConfigList(key []byte, publicName string) ([]byte, error) {
+	config, err := echConfig(key, publicName)
+	if err != nil {
+		return nil, err
+	}
+	return appendU16Bytes(nil, config), nil
+}
+
+func echConfig(key []byte, publicName string) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ECH key: %v", err)
+	}
+	if publicName == "" || len(publicName) > 255 {
+		return nil, fmt.Errorf("ECH public name must be 1-255 characters")
+	}
+	pub := priv.PublicKey().Bytes()
+	id := sha256.Sum256(pub)
+
+	var c []byte
+	c = append(c, id[0]) // config_id
+	c = binary.BigEndian.AppendUint16(c, hpkeX25519KEM)
+	c = appendU16Bytes(c, pub)
+	var suites []byte
+	for _, aead := range []uint16{hpkeAES128GCM, hpkeChaCha20} {
+		suites = binary.BigEndian.AppendUint16(suites, hpkeHKDF256)
+		suites = binary.BigEndian.AppendUint16(suites, aead)
+	}
+	c = appendU16Bytes(c, suites)
+	c = append(c, 0) // maximum_name_length
+	c = append(c, byte(len(publicName)))
+	c = append(c, publicName...)
+	c = binary.BigEndian.AppendUint16(c, 0) // no extensions
+
+	out := binary.BigEndian.AppendUint16(nil, echVersion)
+	return appendU16Bytes(out, c), nil
+}
+
+func appendU16Bytes(b, v []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+	return append(b, v...)
+}
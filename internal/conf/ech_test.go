@@ -0,0 +1,48 @@
+package conf
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestECHHandshake(t *testing.T) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ECHConfigList(priv.Bytes(), "cdn.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &QUIC{ECHKey: priv.Bytes(), ECHPublicName: "cdn.example.com", ALPN: []string{"h3"}}
+	serverTLS, err := server.GenerateTLSConfig("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &QUIC{ECHConfigList: list, ALPN: []string{"h3"}, RandomizeHello: true, InsecureSkipVerify: true, ServerName: "paqet.internal"}
+	clientTLS, err := client.GenerateTLSConfig("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	errc := make(chan error, 1)
+	go func() { errc <- tls.Server(c1, serverTLS).Handshake() }()
+
+	cc := tls.Client(c2, clientTLS)
+	if err := cc.Handshake(); err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	if !cc.ConnectionState().ECHAccepted {
+		t.Error("ECH was not accepted")
+	}
+}
@@ -0,0 +1,59 @@
+package conf
+
+import (
+	"slices"
+
+	"github.com/goccy/go-yaml"
+)
+
+const redacted = "<redacted>"
+
+// Effective renders the configuration with all defaults and auto-tuned
+// values filled in, as YAML that could be loaded again. Secrets are
+// replaced with a placeholder unless showSecrets is set.
+func (c *Conf) Effective(showSecrets bool) ([]byte, error) {
+	out := *c
+	if !showSecrets {
+		out.SOCKS5 = slices.Clone(c.SOCKS5)
+		for i := range out.SOCKS5 {
+			out.SOCKS5[i].Password = redact(out.SOCKS5[i].Password)
+		}
+		if c.Transport.KCP != nil {
+			kcp := *c.Transport.KCP
+			kcp.Key = redact(kcp.Key)
+			out.Transport.KCP = &kcp
+		}
+		if c.Transport.QUIC != nil {
+			quic := *c.Transport.QUIC
+			quic.ECHKey_ = redact(quic.ECHKey_)
+			out.Transport.QUIC = &quic
+		}
+		out.Transport.PSK = redact(out.Transport.PSK)
+		out.HA.Key = redact(out.HA.Key)
+		out.Kcptun.Key = redact(out.Kcptun.Key)
+	} else {
+		// Secrets read from files or commands are inline now, and only
+		// one source may be set for the output to load again.
+		if c.Transport.KCP != nil {
+			kcp := *c.Transport.KCP
+			kcp.KeyFile, kcp.KeyCmd = "", ""
+			out.Transport.KCP = &kcp
+		}
+		if c.Transport.QUIC != nil {
+			quic := *c.Transport.QUIC
+			quic.ECHKeyFile, quic.ECHKeyCmd = "", ""
+			out.Transport.QUIC = &quic
+		}
+		out.Transport.PSKFile, out.Transport.PSKCmd = "", ""
+		out.HA.KeyFile, out.HA.KeyCmd = "", ""
+		out.Kcptun.KeyFile, out.Kcptun.KeyCmd = "", ""
+	}
+	return yaml.Marshal(&out)
+}
+
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
@@ -0,0 +1,40 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEffectiveRedactsSecrets(t *testing.T) {
+	c := &Conf{
+		Role:   "client",
+		SOCKS5: []SOCKS5{{Username: "alice", Password: "hunter2"}},
+		HA:     HA{Key: "ha-secret"},
+	}
+	c.Transport.KCP = &KCP{Key: "kcp-secret"}
+
+	b, err := c.Effective(false)
+	if err != nil {
+		t.Fatalf("Effective: %v", err)
+	}
+	out := string(b)
+	for _, secret := range []string{"hunter2", "ha-secret", "kcp-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("redacted output contains %q", secret)
+		}
+	}
+	if !strings.Contains(out, "alice") {
+		t.Errorf("redacted output lost the username")
+	}
+	if c.SOCKS5[0].Password != "hunter2" || c.Transport.KCP.Key != "kcp-secret" || c.HA.Key != "ha-secret" {
+		t.Errorf("Effective modified the live configuration")
+	}
+
+	b, err = c.Effective(true)
+	if err != nil {
+		t.Fatalf("Effective: %v", err)
+	}
+	if !strings.Contains(string(b), "kcp-secret") {
+		t.Errorf("showSecrets output is missing the KCP key")
+	}
+}
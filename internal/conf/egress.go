@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Egress tags the server's upstream sockets so exit traffic can be policy
+// routed separately from the tunnel-facing interface.
+type Egress struct {
+	Mark  uint32 `yaml:"mark"`  // SO_MARK applied to upstream TCP/UDP sockets
+	Table int    `yaml:"table"` // routing table for marked traffic
+	Rules bool   `yaml:"rules"` // add "ip rule fwmark <mark> table <table>" at startup
+}
+
+// Enabled reports whether upstream sockets are marked.
+func (e *Egress) Enabled() bool {
+	return e.Mark != 0
+}
+
+func (e *Egress) setDefaults() {}
+
+func (e *Egress) validate() []error {
+	var errors []error
+	if !e.Enabled() {
+		if e.Rules {
+			errors = append(errors, fmt.Errorf("egress.rules requires egress.mark"))
+		}
+		return errors
+	}
+	if runtime.GOOS != "linux" {
+		errors = append(errors, fmt.Errorf("egress.mark is not supported on %s", runtime.GOOS))
+	}
+	if e.Rules && (e.Table < 1 || e.Table > 252) {
+		errors = append(errors, fmt.Errorf("egress.table must be between 1-252 when egress.rules is enabled"))
+	}
+	return errors
+}
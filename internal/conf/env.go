@@ -0,0 +1,105 @@
+package conf
+
+import (
+	"fmt"
+	"paqet/internal/flog"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// envPrefix starts the names of environment variables that override
+// settings of the configuration file.
+const envPrefix = "PAQET_"
+
+// envReserved are PAQET_ variables paqet uses for other purposes.
+var envReserved = []string{"PAQET_HANDOFF"}
+
+// applyEnv overrides settings with the PAQET_ variables of environ, named
+// after the setting's path in the file, upper-cased and joined with
+// underscores: PAQET_TRANSPORT_KCP_KEY sets transport.kcp.key. String
+// settings take the value as it is; others parse it as YAML, so lists
+// such as socks5 can be given in flow style.
+func (c *Conf) applyEnv(environ []string) error {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok && strings.HasPrefix(name, envPrefix) && !slices.Contains(envReserved, name) {
+			env[name] = value
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	if err := applyEnvTo(reflect.ValueOf(c).Elem(), strings.TrimSuffix(envPrefix, "_"), env); err != nil {
+		return err
+	}
+	for name := range env {
+		flog.Warnf("warning: environment variable %s does not name a configuration setting and is ignored", name)
+	}
+	return nil
+}
+
+// applyEnvTo sets the fields of the struct v named prefix from env, and
+// removes the variables it used from env.
+func applyEnvTo(v reflect.Value, prefix string, env map[string]string) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		key, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if !f.IsExported() || key == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if opts == "inline" {
+			if err := applyEnvTo(fv, prefix, env); err != nil {
+				return err
+			}
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+
+		if value, ok := env[name]; ok {
+			delete(env, name)
+			if fv.Kind() == reflect.String {
+				fv.SetString(value)
+			} else if err := yaml.Unmarshal([]byte(value), fv.Addr().Interface()); err != nil {
+				return fmt.Errorf("environment variable %s: %v", name, err)
+			}
+			flog.Debugf("configuration %s set from the environment", name)
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct || !hasEnvPrefix(env, name+"_") {
+			continue
+		}
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				fv.Set(reflect.New(ft))
+			}
+			fv = fv.Elem()
+		}
+		if err := applyEnvTo(fv, name, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasEnvPrefix(env map[string]string, prefix string) bool {
+	for name := range env {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package conf
+
+import "testing"
+
+func TestApplyEnv(t *testing.T) {
+	c := Conf{Role: "client", Transport: Transport{Protocol: "quic", Conn: 2}}
+	err := c.applyEnv([]string{
+		"PAQET_TRANSPORT_PROTOCOL=kcp",
+		"PAQET_TRANSPORT_KCP_KEY=s3cret: #1",
+		"PAQET_TRANSPORT_HEARTBEAT_INTERVAL=5",
+		"PAQET_NETWORK_PCAP_SEND_QUEUE_SIZE=2000",
+		`PAQET_SOCKS5=[{listen: "127.0.0.1:1080", tls_cert: "/etc/paqet/socks.crt"}]`,
+		"PAQET_HANDOFF=ignored",
+		"PAQET_NO_SUCH_SETTING=1",
+		"HOME=/root",
+	})
+	if err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if c.Transport.Protocol != "kcp" || c.Transport.Conn != 2 {
+		t.Errorf("transport = %s with %d connections, want kcp with 2", c.Transport.Protocol, c.Transport.Conn)
+	}
+	if c.Transport.KCP == nil || c.Transport.KCP.Key != "s3cret: #1" {
+		t.Errorf("transport.kcp = %+v, want the key taken verbatim", c.Transport.KCP)
+	}
+	if c.Transport.Heartbeat.Interval != 5 || c.Network.PCAP.SendQueueSize != 2000 {
+		t.Errorf("heartbeat.interval = %d, send_queue_size = %d, want 5 and 2000", c.Transport.Heartbeat.Interval, c.Network.PCAP.SendQueueSize)
+	}
+	if len(c.SOCKS5) != 1 || c.SOCKS5[0].Listen_ != "127.0.0.1:1080" || c.SOCKS5[0].TLSCert != "/etc/paqet/socks.crt" {
+		t.Errorf("socks5 = %+v, want one listener with its inline TLS settings", c.SOCKS5)
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	var c Conf
+	if err := c.applyEnv([]string{"PAQET_TRANSPORT_CONN=many"}); err == nil {
+		t.Error("applyEnv accepted a non-numeric transport.conn")
+	}
+}
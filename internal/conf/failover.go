@@ -0,0 +1,82 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"slices"
+)
+
+// Failover lists further servers the client switches to when the one it
+// uses stops answering, and returns from once a preferred one recovers.
+type Failover struct {
+	Servers  []FailoverServer `yaml:"servers"`
+	Failures int              `yaml:"failures"` // consecutive failed dials or health probes before switching
+	Interval int              `yaml:"interval"` // seconds between health probes
+	Timeout  int              `yaml:"timeout"`  // milliseconds before a health probe counts as failed
+}
+
+// FailoverServer is one alternative to server.addr.
+type FailoverServer struct {
+	Addr_    string `yaml:"addr"`
+	Priority int    `yaml:"priority"` // lower is preferred; server.addr has priority 0
+
+	Addr *net.UDPAddr `yaml:"-"`
+}
+
+// Enabled reports whether any alternative server is configured.
+func (f *Failover) Enabled() bool {
+	return len(f.Servers) > 0
+}
+
+func (f *Failover) setDefaults() {
+	if f.Failures == 0 {
+		f.Failures = 3
+	}
+	if f.Interval == 0 {
+		f.Interval = 10
+	}
+	if f.Timeout == 0 {
+		f.Timeout = 3000
+	}
+}
+
+func (f *Failover) validate() []error {
+	var errors []error
+	// Sorting keeps the order of equal priorities, so the list order
+	// breaks ties.
+	slices.SortStableFunc(f.Servers, func(a, b FailoverServer) int { return a.Priority - b.Priority })
+	for i := range f.Servers {
+		s := &f.Servers[i]
+		addr, err := validateAddr(s.Addr_, true)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("server.failover.servers %v", err))
+			continue
+		}
+		s.Addr = addr
+		if s.Priority < 1 {
+			errors = append(errors, fmt.Errorf("server.failover.servers priority of %s must be at least 1, server.addr has 0", s.Addr_))
+		}
+	}
+	if f.Failures < 1 || f.Failures > 100 {
+		errors = append(errors, fmt.Errorf("server.failover.failures must be between 1-100"))
+	}
+	if f.Interval < 1 || f.Interval > 3600 {
+		errors = append(errors, fmt.Errorf("server.failover.interval must be between 1-3600 seconds"))
+	}
+	if f.Timeout < 100 || f.Timeout > 60000 {
+		errors = append(errors, fmt.Errorf("server.failover.timeout must be between 100-60000 milliseconds"))
+	}
+	return errors
+}
+
+// Addrs returns server.addr followed by the failover servers in order of
+// preference.
+func (s *Server) Addrs() []*net.UDPAddr {
+	addrs := []*net.UDPAddr{s.Addr}
+	for _, f := range s.Failover.Servers {
+		if f.Addr != nil {
+			addrs = append(addrs, f.Addr)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,47 @@
+package conf
+
+import "testing"
+
+func TestFailoverOrder(t *testing.T) {
+	s := Server{Addr_: "10.0.0.1:9999", Failover: Failover{Servers: []FailoverServer{
+		{Addr_: "10.0.0.3:9999", Priority: 2},
+		{Addr_: "10.0.0.2:9999", Priority: 1},
+		{Addr_: "10.0.0.4:9999", Priority: 2},
+	}}}
+	s.setDefaults()
+	if errs := s.validate(); len(errs) > 0 {
+		t.Fatalf("validate: %v", errs)
+	}
+	var got []string
+	for _, a := range s.Addrs() {
+		got = append(got, a.String())
+	}
+	want := []string{"10.0.0.1:9999", "10.0.0.2:9999", "10.0.0.3:9999", "10.0.0.4:9999"}
+	if len(got) != len(want) {
+		t.Fatalf("Addrs() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Addrs() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFailoverValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		f    Failover
+		ok   bool
+	}{
+		{"none", Failover{}, true},
+		{"priority zero", Failover{Servers: []FailoverServer{{Addr_: "10.0.0.2:9999"}}}, false},
+		{"bad addr", Failover{Servers: []FailoverServer{{Addr_: "10.0.0.2", Priority: 1}}}, false},
+		{"failures", Failover{Servers: []FailoverServer{{Addr_: "10.0.0.2:9999", Priority: 1}}, Failures: 500}, false},
+		{"ok", Failover{Servers: []FailoverServer{{Addr_: "10.0.0.2:9999", Priority: 1}}, Interval: 30}, true},
+	} {
+		tc.f.setDefaults()
+		if errs := tc.f.validate(); (len(errs) == 0) != tc.ok {
+			t.Errorf("%s: errors %v, want ok=%v", tc.name, errs, tc.ok)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package conf
 
 import (
+	"fmt"
 	"net"
 	"paqet/internal/tnet"
 )
@@ -9,8 +10,16 @@ type Forward struct {
 	Listen_  string       `yaml:"listen"`
 	Target_  string       `yaml:"target"`
 	Protocol string       `yaml:"protocol"`
+	Reuse    string       `yaml:"reuse"` // upstream reuse hint sent to the server: short or warm
+	Group    string       `yaml:"group"` // transport.groups connections to use, empty for the default ones
 	Listen   *net.UDPAddr `yaml:"-"`
 	Target   *tnet.Addr   `yaml:"-"`
+
+	// Duplicate sends every write on two transport connections and keeps
+	// whichever copy arrives first, for low-rate traffic such as DNS or SSH.
+	Duplicate bool `yaml:"duplicate"`
+
+	ListenerSecurity `yaml:",inline"`
 }
 
 func (c *Forward) setDefaults() {}
@@ -27,6 +36,11 @@ func (c *Forward) validate() []error {
 		errors = append(errors, err)
 	}
 	c.Target = t
+	errors = append(errors, validateReuse(c.Reuse)...)
 
+	errors = append(errors, c.ListenerSecurity.validate()...)
+	if c.Protocol == "udp" && (c.TLSConfig != nil || c.ProxyProtocol) {
+		errors = append(errors, fmt.Errorf("TLS and PROXY protocol are only supported for tcp forwards"))
+	}
 	return errors
 }
@@ -0,0 +1,42 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+)
+
+// Gate makes the server play dead to active probes: packets from a source
+// address are dropped without any response until it has sent a knock
+// authenticated with transport.psk, and again once it has been quiet for
+// the window. Clients knock when they start and every third of the window.
+type Gate struct {
+	Window int    `yaml:"window"` // seconds a source stays open after its last packet; 0 disables the gate
+	Decoy_ string `yaml:"decoy"`  // server only: host:port that kernel TCP connections to the listen port are relayed to
+
+	Decoy *net.TCPAddr `yaml:"-"`
+	Key   []byte       `yaml:"-"` // Set from transport.psk
+	Knock *net.UDPAddr `yaml:"-"` // Set from server.addr on clients: the address knocks are sent to
+}
+
+// Enabled reports whether the gate is configured.
+func (g *Gate) Enabled() bool {
+	return g.Window > 0
+}
+
+func (g *Gate) validate() []error {
+	var errors []error
+	if g.Window < 0 || (g.Enabled() && (g.Window < 10 || g.Window > 3600)) {
+		errors = append(errors, fmt.Errorf("network.gate.window must be between 10-3600 seconds"))
+	}
+	if g.Decoy_ != "" {
+		if !g.Enabled() {
+			errors = append(errors, fmt.Errorf("network.gate.decoy requires network.gate.window"))
+		}
+		addr, err := net.ResolveTCPAddr("tcp", g.Decoy_)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid network.gate.decoy '%s': %v", g.Decoy_, err))
+		}
+		g.Decoy = addr
+	}
+	return errors
+}
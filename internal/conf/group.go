@@ -0,0 +1,94 @@
+package conf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Group is a named set of client transport connections with a health
+// policy of its own. SOCKS5 and forward listeners and routing rules pick a
+// group by name; everything else uses the transport.conn connections.
+type Group struct {
+	Name string `yaml:"name"`
+	Conn int    `yaml:"conn"` // connections of the group, default 1
+
+	// Replaces transport.heartbeat for the group's connections; inherited
+	// when unset
+	Heartbeat Heartbeat `yaml:"heartbeat"`
+}
+
+// GroupConns returns the number of connections of all groups.
+func (t *Transport) GroupConns() int {
+	n := 0
+	for _, g := range t.Groups {
+		n += g.Conn
+	}
+	return n
+}
+
+// Group returns the group called name, or nil.
+func (t *Transport) Group(name string) *Group {
+	for i := range t.Groups {
+		if t.Groups[i].Name == name {
+			return &t.Groups[i]
+		}
+	}
+	return nil
+}
+
+func (g *Group) setDefaults(inherit Heartbeat) {
+	if g.Conn == 0 {
+		g.Conn = 1
+	}
+	if g.Heartbeat.Enabled() {
+		g.Heartbeat.setDefaults()
+	} else {
+		g.Heartbeat = inherit
+	}
+}
+
+func validateGroups(groups []Group) []error {
+	var errors []error
+	for i, g := range groups {
+		name := fmt.Sprintf("transport.groups[%d]", i)
+		switch {
+		case g.Name == "":
+			errors = append(errors, fmt.Errorf("%s.name is required", name))
+		case strings.ContainsFunc(g.Name, func(r rune) bool { return !isGroupRune(r) }):
+			errors = append(errors, fmt.Errorf("%s.name '%s' may only contain letters, digits, '-' and '_'", name, g.Name))
+		case slices.ContainsFunc(groups[:i], func(o Group) bool { return o.Name == g.Name }):
+			errors = append(errors, fmt.Errorf("%s.name '%s' is used by another group", name, g.Name))
+		}
+		if g.Conn < 1 || g.Conn > 256 {
+			errors = append(errors, fmt.Errorf("%s.conn must be between 1-256", name))
+		}
+		errors = append(errors, g.Heartbeat.validate(name+".heartbeat")...)
+	}
+	return errors
+}
+
+func isGroupRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
+}
+
+// validateGroupRefs checks that the groups named by listeners and routing
+// rules exist.
+func (c *Conf) validateGroupRefs() []error {
+	var errors []error
+	check := func(where, name string) {
+		if name != "" && c.Transport.Group(name) == nil {
+			errors = append(errors, fmt.Errorf("%s group '%s' is not defined in transport.groups", where, name))
+		}
+	}
+	for i, s := range c.SOCKS5 {
+		check(fmt.Sprintf("socks5[%d]", i), s.Group)
+	}
+	for i, f := range c.Forward {
+		check(fmt.Sprintf("forward[%d]", i), f.Group)
+	}
+	for i, r := range c.Routing.Rules {
+		check(fmt.Sprintf("routing.rules[%d]", i), r.Group)
+	}
+	return errors
+}
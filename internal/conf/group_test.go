@@ -0,0 +1,53 @@
+package conf
+
+import "testing"
+
+func TestGroupDefaults(t *testing.T) {
+	tr := Transport{
+		Heartbeat: Heartbeat{Interval: 10},
+		Groups:    []Group{{Name: "interactive", Conn: 2, Heartbeat: Heartbeat{Interval: 2, Timeout: 500}}, {Name: "bulk"}},
+	}
+	tr.setDefaults("client")
+	if h := tr.Groups[0].Heartbeat; h.Interval != 2 || h.Timeout != 500 || h.Failures != 3 {
+		t.Errorf("interactive heartbeat = %+v, want its own with default failures", h)
+	}
+	if g := tr.Groups[1]; g.Conn != 1 || g.Heartbeat != tr.Heartbeat {
+		t.Errorf("bulk = %+v, want 1 connection and the transport heartbeat", g)
+	}
+	if n := tr.GroupConns(); n != 3 {
+		t.Errorf("GroupConns() = %d, want 3", n)
+	}
+}
+
+func TestGroupValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		groups  []Group
+		wantErr bool
+	}{
+		{"valid", []Group{{Name: "interactive", Conn: 2}, {Name: "bulk_2", Conn: 4}}, false},
+		{"no name", []Group{{Conn: 1}}, true},
+		{"bad name", []Group{{Name: "a:b", Conn: 1}}, true},
+		{"duplicate", []Group{{Name: "bulk", Conn: 1}, {Name: "bulk", Conn: 2}}, true},
+		{"too many connections", []Group{{Name: "bulk", Conn: 300}}, true},
+		{"bad heartbeat", []Group{{Name: "bulk", Conn: 1, Heartbeat: Heartbeat{Interval: 1, Timeout: 5000, Failures: 3}}}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := validateGroups(tt.groups); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("validateGroups() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGroupRefs(t *testing.T) {
+	c := Conf{
+		SOCKS5:    []SOCKS5{{Group: "interactive"}},
+		Forward:   []Forward{{Group: "missing"}},
+		Transport: Transport{Groups: []Group{{Name: "interactive", Conn: 1}}},
+		Routing:   Routing{Rules: []RoutingRule{{Kind: "default", Action: "tunnel", Group: "bulk"}}},
+	}
+	if errs := c.validateGroupRefs(); len(errs) != 2 {
+		t.Errorf("validateGroupRefs() = %v, want errors for forward[0] and routing.rules[0]", errs)
+	}
+}
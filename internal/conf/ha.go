@@ -0,0 +1,58 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+)
+
+// HA configures a hot-standby server pair. Both servers listen on Listen
+// and dial each other's Peer to replicate client lease state.
+type HA struct {
+	Listen_    string `yaml:"listen"`
+	Peer_      string `yaml:"peer"`
+	Key        string `yaml:"key"`
+	KeyFile    string `yaml:"key_file"`    // read key from this file instead
+	KeyCmd     string `yaml:"key_cmd"`     // or from what this shell command prints
+	LeaseGrace int    `yaml:"lease_grace"` // seconds a lease outlives its connection
+
+	Listen *net.TCPAddr `yaml:"-"`
+	Peer   *net.TCPAddr `yaml:"-"`
+}
+
+// Enabled reports whether replication with a peer server is configured.
+func (h *HA) Enabled() bool {
+	return h.Peer_ != ""
+}
+
+func (h *HA) setDefaults() {
+	if h.LeaseGrace == 0 {
+		h.LeaseGrace = 300
+	}
+}
+
+func (h *HA) validate() []error {
+	var errors []error
+	if !h.Enabled() {
+		return errors
+	}
+
+	peer, err := net.ResolveTCPAddr("tcp", h.Peer_)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("invalid ha.peer '%s': %v", h.Peer_, err))
+	}
+	h.Peer = peer
+
+	listen, err := net.ResolveTCPAddr("tcp", h.Listen_)
+	if err != nil || h.Listen_ == "" {
+		errors = append(errors, fmt.Errorf("ha.listen is required when ha.peer is set"))
+	}
+	h.Listen = listen
+
+	if len(h.Key) < 16 {
+		errors = append(errors, fmt.Errorf("ha.key must be at least 16 characters"))
+	}
+	if h.LeaseGrace < 0 || h.LeaseGrace > 86400 {
+		errors = append(errors, fmt.Errorf("ha.lease_grace must be between 0 and 86400 seconds"))
+	}
+	return errors
+}
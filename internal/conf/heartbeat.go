@@ -0,0 +1,47 @@
+package conf
+
+import "fmt"
+
+// Heartbeat makes the client ping every transport connection in the
+// background and replace one that stops answering, instead of finding out
+// when the next stream is requested on it.
+type Heartbeat struct {
+	Interval int `yaml:"interval"` // seconds between pings, 0 = off
+	Timeout  int `yaml:"timeout"`  // milliseconds before a ping counts as failed
+	Failures int `yaml:"failures"` // consecutive failed pings before the connection is re-dialed
+}
+
+// Enabled reports whether heartbeats are configured.
+func (h *Heartbeat) Enabled() bool {
+	return h.Interval > 0
+}
+
+func (h *Heartbeat) setDefaults() {
+	if !h.Enabled() {
+		return
+	}
+	if h.Timeout == 0 {
+		h.Timeout = 3000
+	}
+	if h.Failures == 0 {
+		h.Failures = 3
+	}
+}
+
+// validate checks h, configured at name, e.g. transport.heartbeat.
+func (h *Heartbeat) validate(name string) []error {
+	var errors []error
+	if !h.Enabled() {
+		return errors
+	}
+	if h.Interval > 300 {
+		errors = append(errors, fmt.Errorf("%s.interval must be between 1-300 seconds", name))
+	}
+	if h.Timeout < 100 || h.Timeout > h.Interval*1000 {
+		errors = append(errors, fmt.Errorf("%s.timeout must be between 100 milliseconds and the interval", name))
+	}
+	if h.Failures < 1 || h.Failures > 100 {
+		errors = append(errors, fmt.Errorf("%s.failures must be between 1-100", name))
+	}
+	return errors
+}
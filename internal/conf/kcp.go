@@ -22,12 +22,27 @@ type KCP struct {
 	Dshard int `yaml:"dshard"`
 	Pshard int `yaml:"pshard"`
 
-	Block_ string `yaml:"block"`
-	Key    string `yaml:"key"`
+	Block_  string `yaml:"block"`
+	Key     string `yaml:"key"`
+	KeyFile string `yaml:"key_file"` // read key from this file instead
+	KeyCmd  string `yaml:"key_cmd"`  // or from what this shell command prints
 
 	Smuxbuf   int `yaml:"smuxbuf"`
 	Streambuf int `yaml:"streambuf"`
 
+	// Rotate replaces the client's KCP session (new conversation ID and, with
+	// an unset client port, a new source port) every Rotate seconds. The old
+	// session keeps serving its open streams for up to RotateDrain seconds.
+	Rotate      int `yaml:"rotate"`
+	RotateDrain int `yaml:"rotate_drain"`
+
+	// Bandwidth is the expected path bandwidth in Mbit/s (client role).
+	// When set, the client measures the RTT to the server once connected
+	// and logs the windows and sockbuf the bandwidth-delay product needs;
+	// AutoWindow also raises the windows and sockbuf to match.
+	Bandwidth  int  `yaml:"bandwidth"`
+	AutoWindow bool `yaml:"auto_window"`
+
 	Block kcp.BlockCrypt `yaml:"-"`
 }
 
@@ -69,6 +84,9 @@ func (k *KCP) setDefaults(role string) {
 		// Scale with CPU count: 1 MB per core, between 2 MB and 32 MB.
 		k.Streambuf = clampInt(cpus*1024*1024, 2*1024*1024, 32*1024*1024)
 	}
+	if k.RotateDrain == 0 {
+		k.RotateDrain = 300
+	}
 }
 
 func (k *KCP) validate() []error {
@@ -79,8 +97,8 @@ func (k *KCP) validate() []error {
 		errors = append(errors, fmt.Errorf("KCP mode must be one of: %v", validModes))
 	}
 
-	if k.MTU < 50 || k.MTU > 1500 {
-		errors = append(errors, fmt.Errorf("KCP MTU must be between 50-1500 bytes"))
+	if k.MTU < 50 || k.MTU > kcpMaxMTU {
+		errors = append(errors, fmt.Errorf("KCP MTU must be between 50-%d bytes", kcpMaxMTU))
 	}
 
 	if k.Rcvwnd < 1 || k.Rcvwnd > 32768 {
@@ -110,5 +128,18 @@ func (k *KCP) validate() []error {
 		errors = append(errors, fmt.Errorf("KCP streambuf must be >= 1024 bytes"))
 	}
 
+	if k.Rotate != 0 && (k.Rotate < 30 || k.Rotate > 86400) {
+		errors = append(errors, fmt.Errorf("KCP rotate must be 0 (disabled) or between 30-86400 seconds"))
+	}
+	if k.RotateDrain < 1 || k.RotateDrain > 86400 {
+		errors = append(errors, fmt.Errorf("KCP rotate_drain must be between 1-86400 seconds"))
+	}
+	if k.Bandwidth < 0 || k.Bandwidth > 100000 {
+		errors = append(errors, fmt.Errorf("KCP bandwidth must be between 0-100000 Mbit/s"))
+	}
+	if k.AutoWindow && k.Bandwidth == 0 {
+		errors = append(errors, fmt.Errorf("KCP auto_window requires bandwidth"))
+	}
+
 	return errors
 }
@@ -0,0 +1,173 @@
+package conf
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+
+	"github.com/xtaci/kcp-go/v5"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Kcptun is an endpoint that speaks the wire format of stock kcptun: KCP
+// over plain UDP, its key derivation, optional snappy compression and
+// smux. It runs next to the paqet transport, so that existing kcptun
+// clients or servers keep working during a migration. A kcptun stream
+// carries no destination: the kcptun server forwards all of them to its
+// one target.
+type Kcptun struct {
+	Listen_ string `yaml:"listen"` // server: UDP address for kcptun clients; client: local TCP address
+	Remote_ string `yaml:"remote"` // client: the kcptun server
+	Target_ string `yaml:"target"` // server: where every stream is forwarded
+
+	Key         string `yaml:"key"`
+	KeyFile     string `yaml:"key_file"` // read key from this file instead
+	KeyCmd      string `yaml:"key_cmd"`  // or from what this shell command prints
+	Crypt       string `yaml:"crypt"`
+	Mode        string `yaml:"mode"`
+	MTU         int    `yaml:"mtu"`
+	SndWnd      int    `yaml:"sndwnd"`
+	RcvWnd      int    `yaml:"rcvwnd"`
+	DataShard   *int   `yaml:"datashard"`
+	ParityShard *int   `yaml:"parityshard"`
+	NoComp      bool   `yaml:"nocomp"`
+	SmuxVer     int    `yaml:"smuxver"`
+	SmuxBuf     int    `yaml:"smuxbuf"`
+	StreamBuf   int    `yaml:"streambuf"`
+	KeepAlive   int    `yaml:"keepalive"` // seconds between smux keepalives
+
+	Listen *net.UDPAddr   `yaml:"-"` // server role
+	Local  *net.TCPAddr   `yaml:"-"` // client role
+	Remote *net.UDPAddr   `yaml:"-"`
+	Target string         `yaml:"-"`
+	Block  kcp.BlockCrypt `yaml:"-"`
+}
+
+// Enabled reports whether a kcptun endpoint is configured.
+func (k *Kcptun) Enabled() bool {
+	return k.Listen_ != ""
+}
+
+// setDefaults applies the defaults of kcptun itself, which differ between
+// its client and server.
+func (k *Kcptun) setDefaults(role string) {
+	if k.Crypt == "" {
+		k.Crypt = "aes"
+	}
+	if k.Mode == "" {
+		k.Mode = "fast"
+	}
+	if k.MTU == 0 {
+		k.MTU = 1350
+	}
+	if k.SndWnd == 0 {
+		k.SndWnd = 128
+		if role == "server" {
+			k.SndWnd = 1024
+		}
+	}
+	if k.RcvWnd == 0 {
+		k.RcvWnd = 512
+		if role == "server" {
+			k.RcvWnd = 1024
+		}
+	}
+	if k.DataShard == nil {
+		k.DataShard = new(int)
+		*k.DataShard = 10
+	}
+	if k.ParityShard == nil {
+		k.ParityShard = new(int)
+		*k.ParityShard = 3
+	}
+	if k.SmuxVer == 0 {
+		k.SmuxVer = 1
+	}
+	if k.SmuxBuf == 0 {
+		k.SmuxBuf = 4 * 1024 * 1024
+	}
+	if k.StreamBuf == 0 {
+		k.StreamBuf = 2 * 1024 * 1024
+	}
+	if k.KeepAlive == 0 {
+		k.KeepAlive = 10
+	}
+}
+
+func (k *Kcptun) validate(role string) []error {
+	if !k.Enabled() {
+		return nil
+	}
+	var errors []error
+	if role == "server" {
+		addr, err := validateAddr(k.Listen_, true)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("kcptun.listen %v", err))
+		}
+		k.Listen = addr
+		if k.Remote_ != "" {
+			errors = append(errors, fmt.Errorf("kcptun.remote is only used in the client role"))
+		}
+		if _, _, err := net.SplitHostPort(k.Target_); err != nil {
+			errors = append(errors, fmt.Errorf("kcptun.target must be a host:port address"))
+		}
+		k.Target = k.Target_
+	} else {
+		addr, err := net.ResolveTCPAddr("tcp", k.Listen_)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("kcptun.listen: %v", err))
+		}
+		k.Local = addr
+		if k.Remote, err = validateAddr(k.Remote_, true); err != nil {
+			errors = append(errors, fmt.Errorf("kcptun.remote %v", err))
+		}
+		if k.Target_ != "" {
+			errors = append(errors, fmt.Errorf("kcptun.target is only used in the server role, the kcptun server picks the target"))
+		}
+	}
+
+	if _, ok := blockCrypts[k.Crypt]; !ok {
+		errors = append(errors, fmt.Errorf("kcptun.crypt must be one of: %v", slices.Sorted(maps.Keys(blockCrypts))))
+	} else if !slices.Contains([]string{"none", "null"}, k.Crypt) && k.Key == "" {
+		errors = append(errors, fmt.Errorf("kcptun.key is required"))
+	} else if b, err := newKcptunBlock(k.Crypt, k.Key); err != nil {
+		errors = append(errors, fmt.Errorf("kcptun.crypt %v", err))
+	} else {
+		k.Block = b
+	}
+	if !slices.Contains([]string{"normal", "fast", "fast2", "fast3"}, k.Mode) {
+		errors = append(errors, fmt.Errorf("kcptun.mode must be one of: normal, fast, fast2, fast3"))
+	}
+	if k.MTU < 50 || k.MTU > kcpMaxMTU {
+		errors = append(errors, fmt.Errorf("kcptun.mtu must be between 50-%d bytes", kcpMaxMTU))
+	}
+	if k.SndWnd < 1 || k.SndWnd > 32768 || k.RcvWnd < 1 || k.RcvWnd > 32768 {
+		errors = append(errors, fmt.Errorf("kcptun.sndwnd and kcptun.rcvwnd must be between 1-32768"))
+	}
+	if *k.DataShard < 0 || *k.ParityShard < 0 || *k.DataShard+*k.ParityShard > 255 {
+		errors = append(errors, fmt.Errorf("kcptun.datashard and kcptun.parityshard must be >= 0 and at most 255 together"))
+	}
+	if k.SmuxVer != 1 && k.SmuxVer != 2 {
+		errors = append(errors, fmt.Errorf("kcptun.smuxver must be 1 or 2"))
+	}
+	if k.SmuxBuf < 1024 || k.StreamBuf < 1024 || k.StreamBuf > k.SmuxBuf {
+		errors = append(errors, fmt.Errorf("kcptun.smuxbuf and kcptun.streambuf must be >= 1024 bytes, and streambuf at most smuxbuf"))
+	}
+	if k.KeepAlive < 1 || k.KeepAlive > 3600 {
+		errors = append(errors, fmt.Errorf("kcptun.keepalive must be between 1-3600 seconds"))
+	}
+	return errors
+}
+
+// newKcptunBlock derives the key the way kcptun does, which is not how
+// transport.kcp derives its own.
+func newKcptunBlock(crypt, key string) (kcp.BlockCrypt, error) {
+	pass := pbkdf2.Key([]byte(key), []byte("kcp-go"), 4096, 32, sha1.New)
+	b := blockCrypts[crypt]
+	if b.keySize > 0 {
+		pass = pass[:b.keySize]
+	}
+	return b.build(pass)
+}
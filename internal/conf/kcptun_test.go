@@ -0,0 +1,46 @@
+package conf
+
+import "testing"
+
+func TestKcptunValidate(t *testing.T) {
+	zero := 0
+	for _, tc := range []struct {
+		name string
+		role string
+		k    Kcptun
+		ok   bool
+	}{
+		{"off", "client", Kcptun{}, true},
+		{"client", "client", Kcptun{Listen_: "127.0.0.1:12948", Remote_: "10.0.0.1:29900", Key: "secret"}, true},
+		{"client target", "client", Kcptun{Listen_: "127.0.0.1:12948", Remote_: "10.0.0.1:29900", Target_: "127.0.0.1:22", Key: "secret"}, false},
+		{"client no remote", "client", Kcptun{Listen_: "127.0.0.1:12948", Key: "secret"}, false},
+		{"server", "server", Kcptun{Listen_: ":29900", Target_: "127.0.0.1:22", Key: "secret"}, true},
+		{"server no target", "server", Kcptun{Listen_: ":29900", Key: "secret"}, false},
+		{"no key", "server", Kcptun{Listen_: ":29900", Target_: "127.0.0.1:22"}, false},
+		{"null crypt", "server", Kcptun{Listen_: ":29900", Target_: "127.0.0.1:22", Crypt: "null"}, true},
+		{"unknown crypt", "server", Kcptun{Listen_: ":29900", Target_: "127.0.0.1:22", Key: "secret", Crypt: "rot13"}, false},
+		{"no fec", "server", Kcptun{Listen_: ":29900", Target_: "127.0.0.1:22", Key: "secret", DataShard: &zero, ParityShard: &zero}, true},
+		{"smuxver", "server", Kcptun{Listen_: ":29900", Target_: "127.0.0.1:22", Key: "secret", SmuxVer: 3}, false},
+	} {
+		tc.k.setDefaults(tc.role)
+		errs := tc.k.validate(tc.role)
+		if (len(errs) == 0) != tc.ok {
+			t.Errorf("%s: errors %v, want ok=%v", tc.name, errs, tc.ok)
+		}
+		if tc.ok && tc.k.Enabled() && tc.k.Crypt != "null" && tc.k.Block == nil {
+			t.Errorf("%s: no block crypt", tc.name)
+		}
+	}
+}
+
+func TestKcptunDefaults(t *testing.T) {
+	var c, s Kcptun
+	c.setDefaults("client")
+	s.setDefaults("server")
+	if c.SndWnd != 128 || c.RcvWnd != 512 || s.SndWnd != 1024 || s.RcvWnd != 1024 {
+		t.Errorf("windows: client %d/%d, server %d/%d", c.SndWnd, c.RcvWnd, s.SndWnd, s.RcvWnd)
+	}
+	if *c.DataShard != 10 || *c.ParityShard != 3 || c.SmuxVer != 1 || c.Crypt != "aes" || c.Mode != "fast" {
+		t.Errorf("defaults differ from kcptun: %+v", c)
+	}
+}
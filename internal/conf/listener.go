@@ -0,0 +1,55 @@
+package conf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// ListenerSecurity hardens a local client listener (SOCKS5 or TCP forward)
+// that is shared with other users or sits behind a load balancer.
+type ListenerSecurity struct {
+	TLSCert       string `yaml:"tls_cert"`       // Require TLS from local consumers with this certificate
+	TLSKey        string `yaml:"tls_key"`        // Key for tls_cert
+	TLSClientCA   string `yaml:"tls_client_ca"`  // Optional: also require client certificates signed by this CA
+	ProxyProtocol bool   `yaml:"proxy_protocol"` // Expect a HAProxy PROXY v1/v2 header on every connection
+
+	TLSConfig *tls.Config `yaml:"-"`
+}
+
+func (l *ListenerSecurity) validate() []error {
+	var errors []error
+	if l.TLSCert == "" && l.TLSKey == "" {
+		if l.TLSClientCA != "" {
+			errors = append(errors, fmt.Errorf("tls_client_ca requires tls_cert and tls_key"))
+		}
+		return errors
+	}
+	if l.TLSCert == "" || l.TLSKey == "" {
+		errors = append(errors, fmt.Errorf("tls_cert and tls_key must be set together"))
+		return errors
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.TLSCert, l.TLSKey)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("failed to load listener certificate: %v", err))
+		return errors
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if l.TLSClientCA != "" {
+		pem, err := os.ReadFile(l.TLSClientCA)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("failed to read tls_client_ca: %v", err))
+			return errors
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			errors = append(errors, fmt.Errorf("tls_client_ca '%s' contains no certificates", l.TLSClientCA))
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	l.TLSConfig = cfg
+	return errors
+}
@@ -8,31 +8,47 @@ type Log struct {
 	Level_ string `yaml:"level"`
 
 	Level int `yaml:"-"`
+
+	// Send log records to a remote collector
+	Ship LogShip `yaml:"ship"`
 }
 
 func (l *Log) setDefaults() {
 	if l.Level_ == "" {
 		l.Level_ = "none"
 	}
+	l.Ship.setDefaults()
 }
 
-func (l *Log) validate() []error {
-	var errors []error
-	switch l.Level_ {
+// ParseLogLevel returns the flog level of a log.level name.
+func ParseLogLevel(name string) (int, error) {
+	switch name {
 	case "none":
-		l.Level = -1
+		return -1, nil
 	case "debug":
-		l.Level = 0
+		return 0, nil
 	case "info":
-		l.Level = 1
+		return 1, nil
 	case "warn":
-		l.Level = 2
+		return 2, nil
 	case "error":
-		l.Level = 3
+		return 3, nil
 	case "fatal":
-		l.Level = 4
-	default:
-		errors = append(errors, fmt.Errorf("invalid logging level '%s': must be one of none, debug, info, warn, error, fatal", l.Level_))
+		return 4, nil
+	}
+	return 0, fmt.Errorf("invalid logging level '%s': must be one of none, debug, info, warn, error, fatal", name)
+}
+
+func (l *Log) validate() []error {
+	var errors []error
+	level, err := ParseLogLevel(l.Level_)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	l.Level = level
+	errors = append(errors, l.Ship.validate()...)
+	if l.Ship.Enabled() && l.Level < 0 {
+		errors = append(errors, fmt.Errorf("log.ship requires a log.level other than none"))
 	}
 	return errors
 }
@@ -0,0 +1,61 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// LogShip sends log records to a remote collector for hosts that have no
+// other way to get their logs out. Clients reach the collector through the
+// tunnel, servers directly.
+type LogShip struct {
+	Addr     string `yaml:"addr"`     // collector host:port; empty disables shipping
+	Host     string `yaml:"host"`     // name records are tagged with, default the hostname
+	Batch    int    `yaml:"batch_kb"` // uncompressed KiB that make a batch
+	Interval int    `yaml:"interval"` // seconds after which a partial batch is sent
+	Queue    int    `yaml:"queue"`    // records held while the collector is unreachable
+}
+
+// Enabled reports whether log shipping is configured.
+func (l *LogShip) Enabled() bool {
+	return l.Addr != ""
+}
+
+func (l *LogShip) setDefaults() {
+	if !l.Enabled() {
+		return
+	}
+	if l.Host == "" {
+		l.Host, _ = os.Hostname()
+	}
+	if l.Batch == 0 {
+		l.Batch = 64
+	}
+	if l.Interval == 0 {
+		l.Interval = 5
+	}
+	if l.Queue == 0 {
+		l.Queue = 10000
+	}
+}
+
+func (l *LogShip) validate() []error {
+	var errors []error
+	if !l.Enabled() {
+		return errors
+	}
+	if _, _, err := net.SplitHostPort(l.Addr); err != nil {
+		errors = append(errors, fmt.Errorf("invalid log.ship.addr '%s': %v", l.Addr, err))
+	}
+	if l.Batch < 1 || l.Batch > 4096 {
+		errors = append(errors, fmt.Errorf("log.ship.batch_kb must be between 1-4096"))
+	}
+	if l.Interval < 1 || l.Interval > 3600 {
+		errors = append(errors, fmt.Errorf("log.ship.interval must be between 1-3600 seconds"))
+	}
+	if l.Queue < 100 || l.Queue > 1000000 {
+		errors = append(errors, fmt.Errorf("log.ship.queue must be between 100-1000000 records"))
+	}
+	return errors
+}
@@ -0,0 +1,32 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+)
+
+// Metrics configures the optional Prometheus /metrics endpoint.
+type Metrics struct {
+	Listen_ string       `yaml:"listen"`
+	Listen  *net.TCPAddr `yaml:"-"`
+}
+
+// Enabled reports whether the metrics endpoint should be served.
+func (m *Metrics) Enabled() bool {
+	return m.Listen_ != ""
+}
+
+func (m *Metrics) setDefaults() {}
+
+func (m *Metrics) validate() []error {
+	var errors []error
+	if !m.Enabled() {
+		return errors
+	}
+	addr, err := net.ResolveTCPAddr("tcp", m.Listen_)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("metrics.listen %q is invalid: %v", m.Listen_, err))
+	}
+	m.Listen = addr
+	return errors
+}
@@ -0,0 +1,55 @@
+package conf
+
+import (
+	"fmt"
+)
+
+const (
+	// Largest UDP payloads the transport libraries accept: kcp-go sizes its
+	// buffers for 1500 bytes and quic-go caps packets at 1452. No transport
+	// fills a larger frame, so jumbo link MTUs buy nothing.
+	kcpMaxMTU        = 1500
+	quicMaxPacket    = 1452
+	maxLinkMTU       = 1500
+	tcpHeaderMaxSize = 20 + 20 // header plus the SYN options we send
+)
+
+// MaxPayload returns the largest transport payload that fits in one crafted
+// TCP packet at the configured link MTU.
+func (n *Network) MaxPayload() int {
+	ipHdr := 20
+	if n.IPv6.Addr_ != "" {
+		ipHdr = 40
+	}
+	return n.MTU - ipHdr - tcpHeaderMaxSize
+}
+
+// validateMTU checks that the raw packet path, transport and TUN sizes agree.
+// Transport packet sizes are held to network.mtu only when it is set, since
+// configurations without it accepted any KCP mtu up to 1500.
+func (c *Conf) validateMTU() []error {
+	var errors []error
+	payload := c.Network.MaxPayload()
+	if o := &c.Transport.Obfs; o.Enabled() {
+		// The obfuscation headers come out of every packet.
+		payload -= o.Overhead()
+		if n := len(o.Buckets); n > 0 && o.Buckets[n-1] > payload+ObfsOverhead {
+			errors = append(errors, fmt.Errorf("transport.obfs bucket %d exceeds the %d-byte frame that fits network.mtu %d", o.Buckets[n-1], payload+ObfsOverhead, c.Network.MTU))
+		}
+	}
+
+	if c.Network.mtuAuto {
+		return errors
+	}
+	switch c.Transport.Protocol {
+	case "kcp":
+		if c.Transport.KCP != nil && c.Transport.KCP.MTU > payload {
+			errors = append(errors, fmt.Errorf("KCP mtu (%d) exceeds the %d-byte payload that fits network.mtu %d", c.Transport.KCP.MTU, payload, c.Network.MTU))
+		}
+	case "quic":
+		if q := c.Transport.QUIC; q != nil && q.InitialPacketSize > min(payload, quicMaxPacket) {
+			errors = append(errors, fmt.Errorf("QUIC initial_packet_size (%d) must not exceed %d for network.mtu %d", q.InitialPacketSize, min(payload, quicMaxPacket), c.Network.MTU))
+		}
+	}
+	return errors
+}
@@ -0,0 +1,16 @@
+package conf
+
+import "testing"
+
+func TestValidateMTU(t *testing.T) {
+	c := &Conf{Transport: Transport{Protocol: "kcp", KCP: &KCP{MTU: 1500}}}
+	c.Network.MTU = 1500
+
+	if errs := c.validateMTU(); len(errs) != 1 {
+		t.Errorf("kcp mtu above network.mtu: got %v, want one error", errs)
+	}
+	c.Network.mtuAuto = true
+	if errs := c.validateMTU(); len(errs) != 0 {
+		t.Errorf("kcp mtu with network.mtu unset: got %v, want none", errs)
+	}
+}
@@ -3,6 +3,8 @@ package conf
 import (
 	"fmt"
 	"net"
+	"net/netip"
+	"paqet/internal/pkg/nat64"
 	"runtime"
 )
 
@@ -20,14 +22,33 @@ type Network struct {
 	IPv6        Addr           `yaml:"ipv6"`
 	PCAP        PCAP           `yaml:"pcap"`
 	TCP         TCP            `yaml:"tcp"`
+	MTU         int            `yaml:"mtu"` // link MTU of the raw packet path
+	Cover       Cover          `yaml:"cover"`
+	Pacing      Pacing         `yaml:"pacing"`
 	Performance *Performance   `yaml:"-"` // Set from parent Conf
 	Interface   *net.Interface `yaml:"-"`
 	Port        int            `yaml:"-"`
+	mtuAuto     bool           // mtu was left to the interface or the 1500 default
+
+	// NAT64 prefix of an IPv6-only network. The client reaches an IPv4
+	// server through it and maps synthesized targets back to IPv4.
+	NAT64_ string       `yaml:"nat64_prefix"`
+	NAT64  netip.Prefix `yaml:"-"`
+
+	// Rotate the server port of every flow through a range on a shared
+	// schedule
+	PortHopping PortHopping `yaml:"port_hopping"`
+
+	// Drop packets from sources that have not sent an authenticated knock
+	Gate Gate `yaml:"gate"`
 }
 
 func (n *Network) setDefaults(role string) {
 	n.PCAP.setDefaults(role)
 	n.TCP.setDefaults()
+	n.Cover.setDefaults()
+	n.PortHopping.setDefaults()
+	n.Pacing.setDefaults(n.Interface_)
 }
 
 func (n *Network) validate() []error {
@@ -45,6 +66,23 @@ func (n *Network) validate() []error {
 	}
 	n.Interface = lIface
 
+	if n.MTU == 0 {
+		n.mtuAuto = true
+	}
+	if lIface != nil && lIface.MTU > 0 {
+		if n.MTU == 0 {
+			n.MTU = min(lIface.MTU, 1500)
+		} else if n.MTU > lIface.MTU {
+			errors = append(errors, fmt.Errorf("network mtu %d exceeds the MTU of %s (%d)", n.MTU, n.Interface_, lIface.MTU))
+		}
+	}
+	if n.MTU == 0 {
+		n.MTU = 1500
+	}
+	if n.MTU < 576 || n.MTU > maxLinkMTU {
+		errors = append(errors, fmt.Errorf("network mtu must be between 576-%d", maxLinkMTU))
+	}
+
 	if runtime.GOOS == "windows" && n.GUID == "" {
 		errors = append(errors, fmt.Errorf("guid is required on windows"))
 	}
@@ -73,8 +111,23 @@ func (n *Network) validate() []error {
 		n.Port = n.IPv6.Addr.Port
 	}
 
+	if n.NAT64_ != "" {
+		prefix, err := netip.ParsePrefix(n.NAT64_)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid network.nat64_prefix '%s': %v", n.NAT64_, err))
+		} else if err := nat64.ValidPrefix(prefix); err != nil {
+			errors = append(errors, fmt.Errorf("invalid network.nat64_prefix: %v", err))
+		} else {
+			n.NAT64 = prefix.Masked()
+		}
+	}
+
 	errors = append(errors, n.PCAP.validate()...)
 	errors = append(errors, n.TCP.validate()...)
+	errors = append(errors, n.Cover.validate()...)
+	errors = append(errors, n.Pacing.validate()...)
+	errors = append(errors, n.PortHopping.validate()...)
+	errors = append(errors, n.Gate.validate()...)
 
 	return errors
 }
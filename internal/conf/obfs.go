@@ -0,0 +1,87 @@
+package conf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ObfsOverhead is the frame header internal/obfs adds to each packet.
+const ObfsOverhead = 4
+
+// tlsRecordHeader is added in front of the frame when mimicking TLS.
+const tlsRecordHeader = 5
+
+// Obfs shapes the packets of the kcp and quic transports so that their
+// sizes and timing do not fingerprint the flow. Both peers must use the
+// same setting, since it changes the packet framing.
+type Obfs struct {
+	Buckets   []int   `yaml:"buckets"`    // pad each packet to the smallest bucket it fits in
+	DummyRate float64 `yaml:"dummy_rate"` // chance of a dummy packet after each packet, 0-0.5
+	Jitter    int     `yaml:"jitter"`     // largest random delay per packet in milliseconds, 0 = off
+
+	// Open each flow with a TLS 1.3 ClientHello/ServerHello exchange and
+	// send packets as TLS application data records: "tls" or "none"
+	Mimic string `yaml:"mimic"`
+	// Client: server name in the mimicked ClientHello (empty = none, as
+	// browsers do for IP addresses)
+	SNI string `yaml:"sni"`
+
+	Role string `yaml:"-"` // Set from parent Conf
+	Key  []byte `yaml:"-"` // Set from transport.psk
+}
+
+// Enabled reports whether obfuscation is configured.
+func (o *Obfs) Enabled() bool {
+	return len(o.Buckets) > 0 || o.DummyRate > 0 || o.Jitter > 0 || o.MimicTLS()
+}
+
+// MimicTLS reports whether flows are dressed up as TLS.
+func (o *Obfs) MimicTLS() bool {
+	return o.Mimic == "tls"
+}
+
+// Overhead returns the bytes added to each packet.
+func (o *Obfs) Overhead() int {
+	if o.MimicTLS() {
+		return tlsRecordHeader + ObfsOverhead
+	}
+	return ObfsOverhead
+}
+
+func (o *Obfs) setDefaults(role string) {
+	o.Role = role
+	if o.Mimic == "" {
+		o.Mimic = "none"
+	}
+	slices.Sort(o.Buckets)
+	o.Buckets = slices.Compact(o.Buckets)
+}
+
+func (o *Obfs) validate(protocol string) []error {
+	var errors []error
+	validMimics := []string{"none", "tls"}
+	if !slices.Contains(validMimics, o.Mimic) {
+		errors = append(errors, fmt.Errorf("transport.obfs.mimic must be one of: %v", validMimics))
+	}
+	if !o.Enabled() {
+		return errors
+	}
+	if protocol == "websocket" {
+		errors = append(errors, fmt.Errorf("transport.obfs applies to the kcp and quic transports only"))
+	}
+	if len(o.SNI) > 253 {
+		errors = append(errors, fmt.Errorf("transport.obfs.sni is too long"))
+	}
+	for _, b := range o.Buckets {
+		if b < 64 || b > maxLinkMTU {
+			errors = append(errors, fmt.Errorf("transport.obfs bucket %d must be between 64-%d bytes", b, maxLinkMTU))
+		}
+	}
+	if o.DummyRate < 0 || o.DummyRate > 0.5 {
+		errors = append(errors, fmt.Errorf("transport.obfs.dummy_rate must be between 0-0.5"))
+	}
+	if o.Jitter < 0 || o.Jitter > 200 {
+		errors = append(errors, fmt.Errorf("transport.obfs.jitter must be between 0-200 milliseconds"))
+	}
+	return errors
+}
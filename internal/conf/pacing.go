@@ -0,0 +1,46 @@
+package conf
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+)
+
+// Pacing installs a tc qdisc on network.interface for the lifetime of the
+// process so that bursts from the raw packet sender are spread out at the
+// configured rate instead of tripping middlebox policers.
+type Pacing struct {
+	Qdisc   string `yaml:"qdisc"`   // fq or cake, empty = leave the interface alone
+	Rate    int    `yaml:"rate"`    // Mbit/s for everything leaving the interface
+	Journal string `yaml:"journal"` // undo log of the qdisc change, replayed after a crash
+}
+
+// Enabled reports whether a pacing qdisc should be installed.
+func (p *Pacing) Enabled() bool {
+	return p.Qdisc != ""
+}
+
+func (p *Pacing) setDefaults(iface string) {
+	if p.Journal == "" {
+		p.Journal = filepath.Join("/var/run/paqet", "pacing-"+iface+".journal")
+	}
+}
+
+func (p *Pacing) validate() []error {
+	var errors []error
+	if !p.Enabled() {
+		return errors
+	}
+	if runtime.GOOS != "linux" {
+		errors = append(errors, fmt.Errorf("pacing is not supported on %s", runtime.GOOS))
+	}
+	validQdiscs := []string{"fq", "cake"}
+	if !slices.Contains(validQdiscs, p.Qdisc) {
+		errors = append(errors, fmt.Errorf("pacing qdisc must be one of: %v", validQdiscs))
+	}
+	if p.Rate < 1 || p.Rate > 100000 {
+		errors = append(errors, fmt.Errorf("pacing rate must be between 1-100000 Mbit/s"))
+	}
+	return errors
+}
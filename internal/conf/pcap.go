@@ -3,6 +3,8 @@ package conf
 import (
 	"fmt"
 	"paqet/internal/flog"
+	"slices"
+	"strconv"
 )
 
 type PCAP struct {
@@ -11,6 +13,30 @@ type PCAP struct {
 	MaxRetries    int `yaml:"max_retries"`
 	InitialBackoff int `yaml:"initial_backoff_ms"`
 	MaxBackoff     int `yaml:"max_backoff_ms"`
+
+	// Send queue watermarks, in percent of send_queue_size. Once the queue
+	// reaches HighWatermark, DropPolicy applies until it drains below
+	// LowWatermark.
+	HighWatermark int    `yaml:"high_watermark"`
+	LowWatermark  int    `yaml:"low_watermark"`
+	DropPolicy    string `yaml:"drop_policy"` // tail, head or priority
+
+	// RXVerifyChecksum drops received packets with a bad TCP checksum.
+	RXVerifyChecksum bool `yaml:"rx_verify_checksum"`
+
+	// Software pacing of crafted packets, shared by every connection on the
+	// interface: a rate in Mbit/s, "auto" to follow the upload rate the
+	// client's throughput probes measure, or empty for none.
+	PacingRate_ string  `yaml:"pacing_rate"`
+	PacingRate  float64 `yaml:"-"` // Mbit/s, 0 = unpaced until a probe sets it
+	PacingAuto  bool    `yaml:"-"`
+
+	// Autosize doubles Sockbuf when the kernel drops captured packets and
+	// SendQueueSize when the send queue drops packets, up to MaxSockbuf and
+	// MaxSendQueueSize.
+	Autosize         bool `yaml:"autosize"`
+	MaxSockbuf       int  `yaml:"max_sockbuf"`
+	MaxSendQueueSize int  `yaml:"max_send_queue_size"`
 }
 
 func (p *PCAP) setDefaults(role string) {
@@ -42,6 +68,23 @@ func (p *PCAP) setDefaults(role string) {
 	if p.MaxBackoff == 0 {
 		p.MaxBackoff = 2000 // 2s
 	}
+	if p.HighWatermark == 0 {
+		p.HighWatermark = 100
+	}
+	if p.LowWatermark == 0 {
+		p.LowWatermark = p.HighWatermark * 9 / 10
+	}
+	if p.DropPolicy == "" {
+		p.DropPolicy = "tail"
+	}
+	if p.Autosize {
+		if p.MaxSockbuf == 0 {
+			p.MaxSockbuf = max(min(p.Sockbuf*4, 100*1024*1024), p.Sockbuf)
+		}
+		if p.MaxSendQueueSize == 0 {
+			p.MaxSendQueueSize = max(min(p.SendQueueSize*4, 100000), p.SendQueueSize)
+		}
+	}
 }
 
 func (p *PCAP) validate() []error {
@@ -76,5 +119,39 @@ func (p *PCAP) validate() []error {
 		errors = append(errors, fmt.Errorf("PCAP max_backoff_ms must be between initial_backoff_ms and 60000"))
 	}
 
+	// Zero values are left for setDefaults; only reject explicit bad input.
+	if p.HighWatermark < 0 || p.HighWatermark > 100 {
+		errors = append(errors, fmt.Errorf("PCAP high_watermark must be between 1 and 100 percent"))
+	}
+	if p.LowWatermark < 0 || p.LowWatermark > p.HighWatermark {
+		errors = append(errors, fmt.Errorf("PCAP low_watermark must be between 1 and high_watermark"))
+	}
+	validPolicies := []string{"", "tail", "head", "priority"}
+	if !slices.Contains(validPolicies, p.DropPolicy) {
+		errors = append(errors, fmt.Errorf("PCAP drop_policy must be one of: %v", validPolicies[1:]))
+	}
+
+	switch p.PacingRate_ {
+	case "":
+	case "auto":
+		p.PacingAuto = true
+	default:
+		rate, err := strconv.ParseFloat(p.PacingRate_, 64)
+		if err != nil || rate < 0.1 || rate > 100000 {
+			errors = append(errors, fmt.Errorf("PCAP pacing_rate must be \"auto\" or between 0.1-100000 Mbit/s"))
+		}
+		p.PacingRate = rate
+	}
+	if p.Autosize {
+		if p.MaxSockbuf < p.Sockbuf || p.MaxSockbuf > 100*1024*1024 {
+			errors = append(errors, fmt.Errorf("PCAP max_sockbuf must be between sockbuf and 100MB"))
+		}
+		if p.MaxSendQueueSize < p.SendQueueSize || p.MaxSendQueueSize > 100000 {
+			errors = append(errors, fmt.Errorf("PCAP max_send_queue_size must be between send_queue_size and 100000"))
+		}
+	} else if p.MaxSockbuf != 0 || p.MaxSendQueueSize != 0 {
+		errors = append(errors, fmt.Errorf("PCAP max_sockbuf and max_send_queue_size are only used with autosize"))
+	}
+
 	return errors
 }
@@ -99,6 +99,46 @@ func TestPCAPConfigValidation(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "autosize limits",
+			pcap: PCAP{
+				Sockbuf:          4 * 1024 * 1024,
+				SendQueueSize:    1000,
+				MaxRetries:       3,
+				InitialBackoff:   10,
+				MaxBackoff:       1000,
+				Autosize:         true,
+				MaxSockbuf:       16 * 1024 * 1024,
+				MaxSendQueueSize: 4000,
+			},
+			wantErr: false,
+		},
+		{
+			name: "autosize max below initial",
+			pcap: PCAP{
+				Sockbuf:          4 * 1024 * 1024,
+				SendQueueSize:    1000,
+				MaxRetries:       3,
+				InitialBackoff:   10,
+				MaxBackoff:       1000,
+				Autosize:         true,
+				MaxSockbuf:       1024 * 1024,
+				MaxSendQueueSize: 4000,
+			},
+			wantErr: true,
+		},
+		{
+			name: "autosize limit without autosize",
+			pcap: PCAP{
+				Sockbuf:          4 * 1024 * 1024,
+				SendQueueSize:    1000,
+				MaxRetries:       3,
+				InitialBackoff:   10,
+				MaxBackoff:       1000,
+				MaxSendQueueSize: 4000,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -21,6 +21,11 @@ type Performance struct {
 	// Default is GOMAXPROCS (number of CPU cores)
 	PacketWorkers int `yaml:"packet_workers"`
 
+	// RXQueues is the number of receive worker queues. Captured frames are
+	// hashed by flow (peer address) so each peer's packets stay in order.
+	// 1 decodes frames inline on the reading goroutine.
+	RXQueues int `yaml:"rx_queues"`
+
 	// StreamWorkerPoolSize is the size of the worker pool for stream handling
 	// Default is 1000
 	StreamWorkerPoolSize int `yaml:"stream_worker_pool_size"`
@@ -54,8 +59,46 @@ type Performance struct {
 
 	// TCPFlagRefreshMs controls how often PTCPF metadata is refreshed to the peer.
 	TCPFlagRefreshMs int `yaml:"tcp_flag_refresh_ms"`
+
+	// DialFailureTTL is how long, in seconds, the server answers streams
+	// for a target whose last upstream dial failed with that failure
+	// instead of dialing again. Default is 5; -1 disables the cache.
+	DialFailureTTL int `yaml:"dial_failure_ttl"`
+
+	// MaxStreamsPerConn limits the streams one transport connection may
+	// have open on the server; further opens are refused. 0 is unlimited.
+	MaxStreamsPerConn int `yaml:"max_streams_per_conn"`
+
+	// StreamBacklog is how many streams may wait on the server for a
+	// max_concurrent_streams slot before new ones are refused.
+	// Default is 1024; -1 refuses as soon as every slot is taken.
+	StreamBacklog int `yaml:"stream_backlog"`
+
+	// MaxDialsPerTarget limits the upstream dials in flight to one target
+	// address, so that streams to a slow host do not hold every stream
+	// slot while their dials time out. 0 is unlimited.
+	MaxDialsPerTarget int `yaml:"max_dials_per_target"`
+
+	// DialQueue is how many dials may wait per target for one of its
+	// max_dials_per_target slots before further streams to it are refused.
+	// Default is 256; -1 refuses as soon as every slot is taken.
+	DialQueue int `yaml:"dial_queue"`
+
+	// BalanceStrategy is how the client spreads new streams over its
+	// transport connections: round_robin (default), least_streams,
+	// lowest_rtt or weighted (random, in proportion to the inverse of the
+	// round-trip time). lowest_rtt and weighted need transport.heartbeat.
+	BalanceStrategy string `yaml:"balance_strategy"`
 }
 
+// Strategies of performance.balance_strategy.
+const (
+	BalanceRoundRobin   = "round_robin"
+	BalanceLeastStreams = "least_streams"
+	BalanceLowestRTT    = "lowest_rtt"
+	BalanceWeighted     = "weighted"
+)
+
 func (p *Performance) setDefaults(role string) {
 	cpus := sysCPUCount()
 
@@ -77,6 +120,14 @@ func (p *Performance) setDefaults(role string) {
 		}
 	}
 
+	if p.RXQueues == 0 {
+		// A client has a single peer, so extra queues would sit idle.
+		p.RXQueues = 1
+		if role == "server" {
+			p.RXQueues = clampInt(runtime.GOMAXPROCS(0), 1, 16)
+		}
+	}
+
 	if p.StreamWorkerPoolSize == 0 {
 		// Scale with CPU count: 2500 per core (server) / 1250 per core (client).
 		if role == "server" {
@@ -123,6 +174,22 @@ func (p *Performance) setDefaults(role string) {
 	if p.TCPFlagRefreshMs == 0 {
 		p.TCPFlagRefreshMs = 5000
 	}
+
+	if p.DialFailureTTL == 0 {
+		p.DialFailureTTL = 5
+	}
+
+	if p.StreamBacklog == 0 {
+		p.StreamBacklog = 1024
+	}
+
+	if p.DialQueue == 0 {
+		p.DialQueue = 256
+	}
+
+	if p.BalanceStrategy == "" {
+		p.BalanceStrategy = BalanceRoundRobin
+	}
 }
 
 func (p *Performance) validate() []error {
@@ -140,6 +207,10 @@ func (p *Performance) validate() []error {
 		errors = append(errors, fmt.Errorf("packet_workers must be between 1 and 64"))
 	}
 
+	if p.RXQueues < 0 || p.RXQueues > 64 {
+		errors = append(errors, fmt.Errorf("rx_queues must be between 1 and 64"))
+	}
+
 	if p.StreamWorkerPoolSize < 10 || p.StreamWorkerPoolSize > 100000 {
 		errors = append(errors, fmt.Errorf("stream_worker_pool_size must be between 10 and 100000"))
 	}
@@ -172,6 +243,32 @@ func (p *Performance) validate() []error {
 		errors = append(errors, fmt.Errorf("tcp_flag_refresh_ms must be between 500 and 600000"))
 	}
 
+	if p.DialFailureTTL != -1 && (p.DialFailureTTL < 1 || p.DialFailureTTL > 300) {
+		errors = append(errors, fmt.Errorf("dial_failure_ttl must be -1 (off) or between 1 and 300 seconds"))
+	}
+
+	if p.MaxStreamsPerConn < 0 {
+		errors = append(errors, fmt.Errorf("max_streams_per_conn must be >= 0 (0 means unlimited)"))
+	}
+
+	if p.StreamBacklog < -1 {
+		errors = append(errors, fmt.Errorf("stream_backlog must be -1 (none) or >= 1"))
+	}
+
+	if p.MaxDialsPerTarget < 0 || p.MaxDialsPerTarget > 10000 {
+		errors = append(errors, fmt.Errorf("max_dials_per_target must be between 0 and 10000 (0 means unlimited)"))
+	}
+
+	if p.DialQueue < -1 {
+		errors = append(errors, fmt.Errorf("dial_queue must be -1 (none) or >= 1"))
+	}
+
+	switch p.BalanceStrategy {
+	case BalanceRoundRobin, BalanceLeastStreams, BalanceLowestRTT, BalanceWeighted:
+	default:
+		errors = append(errors, fmt.Errorf("balance_strategy must be one of: round_robin, least_streams, lowest_rtt, weighted"))
+	}
+
 	return errors
 }
 
@@ -0,0 +1,50 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PortHopping moves the server port of every flow through a range of ports
+// on a schedule that client and server derive from transport.psk and the
+// clock, so that blocking or throttling one port does not stop the tunnel.
+type PortHopping struct {
+	Ports_   string `yaml:"ports"`    // server port range, e.g. "20000-29999"
+	Interval int    `yaml:"interval"` // seconds on each port
+
+	Min int          `yaml:"-"`
+	Max int          `yaml:"-"`
+	Key []byte       `yaml:"-"` // Set from transport.psk
+	Hop *net.UDPAddr `yaml:"-"` // Set from server.addr on clients: the address whose port hops
+}
+
+// Enabled reports whether port hopping is configured.
+func (p *PortHopping) Enabled() bool {
+	return p.Ports_ != ""
+}
+
+func (p *PortHopping) setDefaults() {
+	if p.Enabled() && p.Interval == 0 {
+		p.Interval = 60
+	}
+}
+
+func (p *PortHopping) validate() []error {
+	var errors []error
+	if !p.Enabled() {
+		return errors
+	}
+	lo, hi, ok := strings.Cut(p.Ports_, "-")
+	first, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	last, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if !ok || err1 != nil || err2 != nil || first < 1 || last > 65535 || last-first < 1 {
+		errors = append(errors, fmt.Errorf("network.port_hopping.ports must be a range of at least two ports, e.g. \"20000-29999\""))
+	}
+	p.Min, p.Max = first, last
+	if p.Interval < 10 || p.Interval > 86400 {
+		errors = append(errors, fmt.Errorf("network.port_hopping.interval must be between 10-86400 seconds"))
+	}
+	return errors
+}
@@ -0,0 +1,86 @@
+package conf
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// Priority classes of server.priority, highest first.
+const (
+	PriorityHigh = iota
+	PriorityNormal
+	PriorityLow
+	PriorityClasses
+)
+
+var priorityNames = []string{"high", "normal", "low"}
+
+// Priority assigns clients to priority classes on a server. When every
+// max_concurrent_streams slot is taken, waiting streams of a higher class
+// get the next free slot first, and a full backlog makes room for them by
+// refusing the newest waiting stream of a lower class. Rules are checked in
+// order and the first match decides; clients no rule matches are normal.
+type Priority []PriorityRule
+
+// PriorityRule matches a client when all of its non-empty criteria do.
+type PriorityRule struct {
+	Class_  string   `yaml:"class"`   // high, normal or low
+	Clients []string `yaml:"clients"` // transport.client_id of clients that completed an authenticated hello
+	CIDR_   []string `yaml:"cidr"`    // client source networks
+
+	Class int            `yaml:"-"`
+	CIDR  []netip.Prefix `yaml:"-"`
+}
+
+// Class returns the class of a client with source address ip that
+// authenticated as clientID, or "" if it did not.
+func (p Priority) Class(clientID string, ip netip.Addr) int {
+	ip = ip.Unmap()
+	for _, r := range p {
+		if len(r.Clients) > 0 && (clientID == "" || !slices.Contains(r.Clients, clientID)) {
+			continue
+		}
+		if len(r.CIDR) > 0 && !slices.ContainsFunc(r.CIDR, func(c netip.Prefix) bool { return c.Contains(ip) }) {
+			continue
+		}
+		return r.Class
+	}
+	return PriorityNormal
+}
+
+// PriorityName returns the name of class.
+func PriorityName(class int) string {
+	return priorityNames[class]
+}
+
+func (p Priority) validate() []error {
+	var errors []error
+	for i := range p {
+		for _, err := range p[i].validate() {
+			errors = append(errors, fmt.Errorf("server.priority[%d] %v", i, err))
+		}
+	}
+	return errors
+}
+
+func (r *PriorityRule) validate() []error {
+	var errors []error
+	r.Class = slices.Index(priorityNames, r.Class_)
+	if r.Class < 0 {
+		errors = append(errors, fmt.Errorf("class must be one of: %v", priorityNames))
+	}
+	if len(r.Clients) == 0 && len(r.CIDR_) == 0 {
+		errors = append(errors, fmt.Errorf("needs at least one of clients or cidr"))
+	}
+	r.CIDR = r.CIDR[:0]
+	for _, c := range r.CIDR_ {
+		pfx, err := netip.ParsePrefix(c)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid cidr '%s': %v", c, err))
+			continue
+		}
+		r.CIDR = append(r.CIDR, pfx.Masked())
+	}
+	return errors
+}
@@ -0,0 +1,39 @@
+package conf
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPriority(t *testing.T) {
+	p := Priority{
+		{Class_: "high", Clients: []string{"ops-laptop"}},
+		{Class_: "low", CIDR_: []string{"198.51.100.0/24"}},
+		{Class_: "high", Clients: []string{"backup"}, CIDR_: []string{"203.0.113.0/24"}},
+	}
+	if errs := p.validate(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	for _, c := range []struct {
+		id   string
+		ip   string
+		want int
+	}{
+		{"ops-laptop", "198.51.100.7", PriorityHigh}, // first match wins
+		{"", "198.51.100.7", PriorityLow},
+		{"", "::ffff:198.51.100.7", PriorityLow}, // IPv4-mapped
+		{"backup", "203.0.113.9", PriorityHigh},
+		{"backup", "192.0.2.1", PriorityNormal}, // right client, wrong network
+		{"", "203.0.113.9", PriorityNormal},     // unauthenticated
+	} {
+		if got := p.Class(c.id, netip.MustParseAddr(c.ip)); got != c.want {
+			t.Errorf("Class(%q, %s) = %s, want %s", c.id, c.ip, PriorityName(got), PriorityName(c.want))
+		}
+	}
+
+	bad := Priority{{Class_: "urgent"}}
+	if errs := bad.validate(); len(errs) != 2 {
+		t.Fatalf("got %d errors for an unknown class without criteria, want 2", len(errs))
+	}
+}
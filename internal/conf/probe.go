@@ -0,0 +1,57 @@
+package conf
+
+import "fmt"
+
+// MaxProbeBytes caps the download a client may request for a throughput test.
+const MaxProbeBytes = 64 << 20
+
+// Probe schedules background latency and throughput measurements on each
+// client connection. Results steer stream placement away from failing
+// connections and are kept in a history served by the admin API.
+type Probe struct {
+	Interval           int `yaml:"interval"`            // seconds between latency probes, 0 = off
+	Timeout            int `yaml:"timeout"`             // milliseconds before a probe counts as failed
+	ThroughputInterval int `yaml:"throughput_interval"` // seconds between throughput tests, 0 = off
+	ThroughputBytes    int `yaml:"throughput_bytes"`    // bytes downloaded per throughput test
+	History            int `yaml:"history"`             // results kept for the admin API
+}
+
+// Enabled reports whether scheduled probes are configured.
+func (p *Probe) Enabled() bool {
+	return p.Interval > 0
+}
+
+func (p *Probe) setDefaults() {
+	if p.Timeout == 0 {
+		p.Timeout = 3000
+	}
+	if p.ThroughputBytes == 0 {
+		p.ThroughputBytes = 1 << 20
+	}
+	if p.History == 0 {
+		p.History = 512
+	}
+}
+
+func (p *Probe) validate() []error {
+	var errors []error
+	if !p.Enabled() {
+		return errors
+	}
+	if p.Interval < 5 || p.Interval > 3600 {
+		errors = append(errors, fmt.Errorf("probe.interval must be between 5-3600 seconds"))
+	}
+	if p.Timeout < 100 || p.Timeout > 60000 {
+		errors = append(errors, fmt.Errorf("probe.timeout must be between 100-60000 milliseconds"))
+	}
+	if p.ThroughputInterval != 0 && (p.ThroughputInterval < 60 || p.ThroughputInterval > 86400) {
+		errors = append(errors, fmt.Errorf("probe.throughput_interval must be 0 or between 60-86400 seconds"))
+	}
+	if p.ThroughputBytes < 64<<10 || p.ThroughputBytes > MaxProbeBytes {
+		errors = append(errors, fmt.Errorf("probe.throughput_bytes must be between 64KB and %dMB", MaxProbeBytes>>20))
+	}
+	if p.History < 16 || p.History > 65536 {
+		errors = append(errors, fmt.Errorf("probe.history must be between 16-65536"))
+	}
+	return errors
+}
@@ -0,0 +1,91 @@
+package conf
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// Publish lets a server hand files to its clients through the tunnel, so
+// that routing rules, GeoIP databases or client configs can be rolled out
+// to a fleet without a channel of its own. The server lists the files it
+// publishes under a name each; clients name the ones they keep a copy of.
+type Publish struct {
+	// Server: published name -> file, read afresh on every request
+	Files map[string]string `yaml:"files"`
+
+	// Client: files kept in sync with the server's copies
+	Fetch    []FetchFile `yaml:"fetch"`
+	Interval int         `yaml:"interval"` // seconds between checks for new versions
+}
+
+// FetchFile is one published file a client keeps a copy of.
+type FetchFile struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"` // replaced atomically when the server's version changes
+}
+
+var publishName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Enabled reports whether the server publishes any file or the client
+// fetches any.
+func (p *Publish) Enabled() bool {
+	return len(p.Files) > 0 || len(p.Fetch) > 0
+}
+
+func (p *Publish) setDefaults() {
+	if p.Interval == 0 {
+		p.Interval = 3600
+	}
+}
+
+func (p *Publish) validate(role string) []error {
+	var errors []error
+	if role == "server" {
+		if len(p.Fetch) > 0 {
+			errors = append(errors, fmt.Errorf("publish.fetch is only used in the client role"))
+		}
+		for _, name := range slices.Sorted(maps.Keys(p.Files)) {
+			path := p.Files[name]
+			if !publishName.MatchString(name) {
+				errors = append(errors, fmt.Errorf("publish.files name %q must be 1-128 letters, digits, '.', '_' or '-', not starting with a symbol", name))
+			}
+			if !filepath.IsAbs(path) {
+				errors = append(errors, fmt.Errorf("publish.files %s must be an absolute path", name))
+				continue
+			}
+			if fi, err := os.Stat(path); err != nil {
+				errors = append(errors, fmt.Errorf("publish.files %s: %v", name, err))
+			} else if !fi.Mode().IsRegular() {
+				errors = append(errors, fmt.Errorf("publish.files %s: %s is not a regular file", name, path))
+			}
+		}
+		return errors
+	}
+
+	if len(p.Files) > 0 {
+		errors = append(errors, fmt.Errorf("publish.files is only used in the server role"))
+	}
+	seen := make(map[string]bool)
+	for i, f := range p.Fetch {
+		if !publishName.MatchString(f.Name) {
+			errors = append(errors, fmt.Errorf("publish.fetch[%d] name %q is not a valid published name", i, f.Name))
+		}
+		if f.Path == "" {
+			errors = append(errors, fmt.Errorf("publish.fetch[%d] path is required", i))
+			continue
+		}
+		path := filepath.Clean(f.Path)
+		if seen[path] {
+			errors = append(errors, fmt.Errorf("publish.fetch[%d] path %s is used by another entry", i, f.Path))
+		}
+		seen[path] = true
+	}
+	if p.Interval < 60 || p.Interval > 604800 {
+		errors = append(errors, fmt.Errorf("publish.interval must be between 60-604800 seconds"))
+	}
+	return errors
+}
@@ -0,0 +1,39 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublishValidate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(file, []byte("rules: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		role string
+		p    Publish
+		ok   bool
+	}{
+		{"none", "server", Publish{}, true},
+		{"server ok", "server", Publish{Files: map[string]string{"routing": file}}, true},
+		{"traversal", "server", Publish{Files: map[string]string{"../etc": file}}, false},
+		{"dot name", "server", Publish{Files: map[string]string{".hidden": file}}, false},
+		{"relative path", "server", Publish{Files: map[string]string{"routing": "rules.yaml"}}, false},
+		{"missing file", "server", Publish{Files: map[string]string{"routing": file + ".gone"}}, false},
+		{"directory", "server", Publish{Files: map[string]string{"routing": filepath.Dir(file)}}, false},
+		{"fetch on server", "server", Publish{Fetch: []FetchFile{{Name: "routing", Path: file}}}, false},
+		{"client ok", "client", Publish{Fetch: []FetchFile{{Name: "routing", Path: file}}}, true},
+		{"files on client", "client", Publish{Files: map[string]string{"routing": file}}, false},
+		{"no path", "client", Publish{Fetch: []FetchFile{{Name: "routing"}}}, false},
+		{"same path", "client", Publish{Fetch: []FetchFile{{Name: "a", Path: file}, {Name: "b", Path: file}}}, false},
+		{"interval", "client", Publish{Fetch: []FetchFile{{Name: "routing", Path: file}}, Interval: 10}, false},
+	} {
+		tc.p.setDefaults()
+		if errs := tc.p.validate(tc.role); (len(errs) == 0) != tc.ok {
+			t.Errorf("%s: errors %v, want ok=%v", tc.name, errs, tc.ok)
+		}
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	mrand "math/rand/v2"
+	"slices"
 	"time"
 )
 
@@ -25,7 +28,13 @@ type QUIC struct {
 
 	// Performance settings
 	EnableDatagrams bool  `yaml:"enable_datagrams"` // Enable QUIC datagram support (default: false)
-	Enable0RTT      *bool `yaml:"enable_0rtt"`      // Enable 0-RTT for faster reconnections (default: true)
+	Enable0RTT      *bool `yaml:"enable_0rtt"`      // Enable 0-RTT for faster reconnections (default: false)
+
+	// Packet size used before path MTU discovery; 0 uses the quic-go default (1280)
+	InitialPacketSize int `yaml:"initial_packet_size"`
+
+	// Handshake datagram padding (both sides must enable it)
+	Padding QUICPadding `yaml:"padding"`
 
 	// Keep-alive settings
 	KeepAlivePeriod int `yaml:"keep_alive_period"` // Keep-alive period in seconds (default: 10)
@@ -37,8 +46,35 @@ type QUIC struct {
 	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // Skip TLS verification (default: false, set true for testing)
 	ServerName         string `yaml:"server_name"`          // Server name for TLS verification
 
+	// Certificates and mutual TLS (see quic_tls.go)
+	CertFile     string   `yaml:"cert_file"`     // Server certificate, or client certificate for mTLS
+	KeyFile      string   `yaml:"key_file"`      // Private key for cert_file
+	CAFile       string   `yaml:"ca_file"`       // CA bundle: verifies the server (client) or requires client certs (server)
+	PinnedSHA256 []string `yaml:"pinned_sha256"` // SHA-256 fingerprints of accepted peer certificates
+	TOFU         bool     `yaml:"tofu"`          // Trust the server certificate seen first, kept in state.dir (client)
+
+	// Handshake fingerprint settings
+	ALPN           []string `yaml:"alpn"`            // ALPN protocols (default: paqet-quic); must overlap between client and server
+	RandomizeHello bool     `yaml:"randomize_hello"` // Shuffle key share group and ALPN order on every dial (client)
+	ECHConfigList_ string   `yaml:"ech_config_list"` // Base64 ECHConfigList from the server or fronting provider (client)
+	ECHKey_        string   `yaml:"ech_key"`         // Base64 X25519 ECH private key (server)
+	ECHKeyFile     string   `yaml:"ech_key_file"`    // read ech_key from this file instead
+	ECHKeyCmd      string   `yaml:"ech_key_cmd"`     // or from what this shell command prints
+	ECHPublicName  string   `yaml:"ech_public_name"` // Outer SNI advertised in the ECH config (server)
+
 	// Internal TLS config (not exposed to YAML)
 	TLSConfig *tls.Config `yaml:"-"`
+
+	ECHConfigList []byte `yaml:"-"`
+	ECHKey        []byte `yaml:"-"`
+
+	Certificate *tls.Certificate `yaml:"-"`
+	CAPool      *x509.CertPool   `yaml:"-"`
+	Pins        [][]byte         `yaml:"-"`
+
+	// Set per connection by the client from its state directory.
+	SessionCache tls.ClientSessionCache                      `yaml:"-"`
+	VerifyServer func([][]byte, [][]*x509.Certificate) error `yaml:"-"`
 }
 
 func (q *QUIC) setDefaults(role string) {
@@ -110,9 +146,14 @@ func (q *QUIC) setDefaults(role string) {
 	}
 
 	if q.Enable0RTT == nil {
-		enable := true
+		enable := false
 		q.Enable0RTT = &enable
 	}
+
+	if len(q.ALPN) == 0 {
+		q.ALPN = []string{"paqet-quic"}
+	}
+	q.Padding.setDefaults()
 }
 
 func (q *QUIC) validate() []error {
@@ -150,12 +191,37 @@ func (q *QUIC) validate() []error {
 		errors = append(errors, fmt.Errorf("QUIC keep_alive_period must be between 1-60 seconds"))
 	}
 
+	if q.InitialPacketSize != 0 && (q.InitialPacketSize < 1200 || q.InitialPacketSize > quicMaxPacket) {
+		errors = append(errors, fmt.Errorf("QUIC initial_packet_size must be between 1200-%d bytes", quicMaxPacket))
+	}
+
+	errors = append(errors, q.Padding.validate()...)
+
+	if q.ECHConfigList_ != "" {
+		list, err := base64.StdEncoding.DecodeString(q.ECHConfigList_)
+		if err != nil || len(list) < 2 {
+			errors = append(errors, fmt.Errorf("QUIC ech_config_list must be a base64 ECHConfigList"))
+		}
+		q.ECHConfigList = list
+	}
+	if q.ECHKey_ != "" {
+		key, err := base64.StdEncoding.DecodeString(q.ECHKey_)
+		if err == nil {
+			_, err = echConfig(key, q.ECHPublicName)
+		}
+		if err != nil {
+			errors = append(errors, fmt.Errorf("QUIC ech_key: %v", err))
+		}
+		q.ECHKey = key
+	}
+	errors = append(errors, q.validateCerts()...)
+
 	return errors
 }
 
 func (q *QUIC) Enable0RTTValue() bool {
 	if q.Enable0RTT == nil {
-		return true
+		return false
 	}
 	return *q.Enable0RTT
 }
@@ -166,29 +232,55 @@ const certValidityDays = 365
 // GenerateTLSConfig generates a TLS configuration for QUIC
 func (q *QUIC) GenerateTLSConfig(role string) (*tls.Config, error) {
 	if role == "server" {
-		// Generate self-signed certificate for server
-		cert, err := generateSelfSignedCert()
+		cert, err := q.serverCert()
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate self-signed certificate: %w", err)
+			return nil, err
 		}
 
-		return &tls.Config{
+		tlsConfig := &tls.Config{
 			Certificates: []tls.Certificate{cert},
-			NextProtos:   []string{"paqet-quic"},
+			NextProtos:   q.ALPN,
 			MinVersion:   tls.VersionTLS13, // QUIC requires TLS 1.3
-		}, nil
+		}
+		if q.ECHKey != nil {
+			config, err := echConfig(q.ECHKey, q.ECHPublicName)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.EncryptedClientHelloKeys = []tls.EncryptedClientHelloKey{{Config: config, PrivateKey: q.ECHKey, SendAsRetry: true}}
+		}
+		q.applyServerAuth(tlsConfig)
+		if err := rotateTicketKeys(tlsConfig); err != nil {
+			return nil, err
+		}
+		return tlsConfig, nil
 	}
 
 	// Client configuration
 	tlsConfig := &tls.Config{
-		NextProtos:         []string{"paqet-quic"},
+		NextProtos:         slices.Clone(q.ALPN),
 		MinVersion:         tls.VersionTLS13,
 		InsecureSkipVerify: q.InsecureSkipVerify,
 	}
+	if q.ECHConfigList != nil {
+		tlsConfig.EncryptedClientHelloConfigList = q.ECHConfigList
+	}
+	if q.RandomizeHello {
+		// Go's crypto/tls fixes the extension order, so vary what it does
+		// expose: the key share group and the order of groups and ALPN.
+		tlsConfig.CurvePreferences = []tls.CurveID{tls.X25519MLKEM768, tls.X25519, tls.CurveP256, tls.CurveP384}
+		mrand.Shuffle(len(tlsConfig.CurvePreferences), func(i, j int) {
+			tlsConfig.CurvePreferences[i], tlsConfig.CurvePreferences[j] = tlsConfig.CurvePreferences[j], tlsConfig.CurvePreferences[i]
+		})
+		mrand.Shuffle(len(tlsConfig.NextProtos), func(i, j int) {
+			tlsConfig.NextProtos[i], tlsConfig.NextProtos[j] = tlsConfig.NextProtos[j], tlsConfig.NextProtos[i]
+		})
+	}
 
 	if q.ServerName != "" {
 		tlsConfig.ServerName = q.ServerName
 	}
+	q.applyClientAuth(tlsConfig)
 
 	return tlsConfig, nil
 }
@@ -0,0 +1,47 @@
+package conf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// QUICPadding pads datagrams that carry only Initial and Handshake packets
+// to a size drawn from [Min, Max], hiding the fixed handshake sizes of
+// quic-go. Both peers strip the padding before QUIC sees the datagram.
+type QUICPadding struct {
+	Min          int    `yaml:"min"`
+	Max          int    `yaml:"max"`
+	Distribution string `yaml:"distribution"` // uniform or normal
+}
+
+// Enabled reports whether handshake padding is configured.
+func (p *QUICPadding) Enabled() bool {
+	return p.Max > 0
+}
+
+func (p *QUICPadding) setDefaults() {
+	if !p.Enabled() {
+		return
+	}
+	if p.Min == 0 {
+		p.Min = 1200
+	}
+	if p.Distribution == "" {
+		p.Distribution = "uniform"
+	}
+}
+
+func (p *QUICPadding) validate() []error {
+	var errors []error
+	if !p.Enabled() {
+		return errors
+	}
+	if p.Min < 1200 || p.Min > p.Max || p.Max > quicMaxPacket {
+		errors = append(errors, fmt.Errorf("QUIC padding requires 1200 <= min <= max <= %d", quicMaxPacket))
+	}
+	validDists := []string{"uniform", "normal"}
+	if !slices.Contains(validDists, p.Distribution) {
+		errors = append(errors, fmt.Errorf("QUIC padding distribution must be one of: %v", validDists))
+	}
+	return errors
+}
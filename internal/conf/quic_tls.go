@@ -0,0 +1,192 @@
+package conf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// validateCerts loads the QUIC certificate, CA bundle and pinned
+// fingerprints.
+func (q *QUIC) validateCerts() []error {
+	var errors []error
+
+	if (q.CertFile == "") != (q.KeyFile == "") {
+		errors = append(errors, fmt.Errorf("QUIC cert_file and key_file must be set together"))
+	} else if q.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(q.CertFile, q.KeyFile)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("failed to load QUIC certificate: %v", err))
+		} else {
+			q.Certificate = &cert
+		}
+	}
+	if q.CAFile != "" {
+		pem, err := os.ReadFile(q.CAFile)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("failed to read QUIC ca_file: %v", err))
+		} else {
+			q.CAPool = x509.NewCertPool()
+			if !q.CAPool.AppendCertsFromPEM(pem) {
+				errors = append(errors, fmt.Errorf("QUIC ca_file %s contains no PEM certificates", q.CAFile))
+			}
+		}
+	}
+	q.Pins = nil
+	for _, p := range q.PinnedSHA256 {
+		pin, err := hex.DecodeString(strings.ReplaceAll(p, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			errors = append(errors, fmt.Errorf("QUIC pinned_sha256 %q must be a hex SHA-256 fingerprint", p))
+			continue
+		}
+		q.Pins = append(q.Pins, pin)
+	}
+	if q.TOFU && (q.CAFile != "" || len(q.PinnedSHA256) > 0 || q.InsecureSkipVerify) {
+		errors = append(errors, fmt.Errorf("QUIC tofu cannot be combined with ca_file, pinned_sha256 or insecure_skip_verify"))
+	}
+
+	return errors
+}
+
+// serverCert returns the configured server certificate, or a throwaway
+// self-signed one.
+func (q *QUIC) serverCert() (tls.Certificate, error) {
+	if q.Certificate != nil {
+		return *q.Certificate, nil
+	}
+	cert, err := generateSelfSignedCert()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate self-signed certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// applyServerAuth requires client certificates when a CA bundle or pins
+// are configured.
+func (q *QUIC) applyServerAuth(c *tls.Config) {
+	if q.CAPool != nil {
+		c.ClientCAs = q.CAPool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	} else if len(q.Pins) > 0 {
+		c.ClientAuth = tls.RequireAnyClientCert
+	}
+	if len(q.Pins) > 0 {
+		c.VerifyConnection = verifyConnection(verifyPins(q.Pins))
+	}
+}
+
+// applyClientAuth presents the client certificate and verifies the server
+// against the CA bundle and/or pins. A pin without a CA bundle replaces
+// chain verification, so a self-signed server certificate can be trusted
+// without insecure_skip_verify. Pins and trust on first use are checked in
+// VerifyConnection, which unlike VerifyPeerCertificate also runs on
+// resumed sessions, so a ticket cannot outlive a pin change.
+func (q *QUIC) applyClientAuth(c *tls.Config) {
+	if q.Certificate != nil {
+		c.Certificates = []tls.Certificate{*q.Certificate}
+	}
+	if q.CAPool != nil {
+		c.RootCAs = q.CAPool
+	}
+	if len(q.Pins) > 0 {
+		if q.CAPool == nil {
+			c.InsecureSkipVerify = true
+		}
+		c.VerifyConnection = verifyConnection(verifyPins(q.Pins))
+	}
+	if q.VerifyServer != nil {
+		// Trust on first use: the state directory decides, not a CA.
+		c.InsecureSkipVerify = true
+		c.VerifyConnection = verifyConnection(q.VerifyServer)
+	}
+	c.ClientSessionCache = q.SessionCache
+}
+
+// ticketKeyPeriod is how long a session ticket key issues tickets. Tickets
+// stay valid for one more period, so none lives beyond two.
+const ticketKeyPeriod = 24 * time.Hour
+
+// ticketKeys draws a random key to issue tickets with and, when the
+// previous period's keys are prev, keeps the key that issued them so that
+// their tickets still resume. Keys live only in memory: a captured ticket
+// cannot be opened once its key is gone, and a server restart starts over
+// with full handshakes.
+func ticketKeys(prev [][32]byte, elapsed int64) ([][32]byte, error) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate QUIC session ticket key: %w", err)
+	}
+	keys := [][32]byte{key}
+	if elapsed == 1 && len(prev) > 0 {
+		keys = append(keys, prev[0])
+	}
+	return keys, nil
+}
+
+// rotateTicketKeys keys the session tickets of c with ticketKeys, moving
+// to a new key every ticketKeyPeriod. QUIC clones c per connection, so
+// handshakes get a clone carrying the current keys from GetConfigForClient.
+func rotateTicketKeys(c *tls.Config) error {
+	base := c.Clone()
+	var mu sync.Mutex
+	var period int64
+	var keys [][32]byte
+	var current *tls.Config
+	config := func() (*tls.Config, error) {
+		p := time.Now().Unix() / int64(ticketKeyPeriod/time.Second)
+		mu.Lock()
+		defer mu.Unlock()
+		if current == nil || p != period {
+			next, err := ticketKeys(keys, p-period)
+			if err != nil {
+				return nil, err
+			}
+			cfg := base.Clone()
+			cfg.SetSessionTicketKeys(next)
+			current, period, keys = cfg, p, next
+		}
+		return current, nil
+	}
+	if _, err := config(); err != nil {
+		return err
+	}
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) { return config() }
+	return nil
+}
+
+// verifyConnection adapts a check of the raw peer certificates to
+// tls.Config.VerifyConnection.
+func verifyConnection(verify func([][]byte, [][]*x509.Certificate) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		raw := make([][]byte, len(cs.PeerCertificates))
+		for i, cert := range cs.PeerCertificates {
+			raw[i] = cert.Raw
+		}
+		return verify(raw, cs.VerifiedChains)
+	}
+}
+
+// verifyPins accepts a handshake only if the peer's leaf certificate
+// matches one of pins.
+func verifyPins(pins [][]byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("peer presented no certificate")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		for _, pin := range pins {
+			if bytes.Equal(pin, sum[:]) {
+				return nil
+			}
+		}
+		return fmt.Errorf("peer certificate %x is not pinned", sum)
+	}
+}
@@ -0,0 +1,183 @@
+package conf
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCert writes a fresh self-signed certificate and key to dir and
+// returns their paths and the certificate's fingerprint.
+func writeCert(t *testing.T, dir, name string) (string, string, string) {
+	t.Helper()
+	cert, err := generateSelfSignedCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(cert.PrivateKey.(*rsa.PrivateKey))})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return certFile, keyFile, hex.EncodeToString(sum[:])
+}
+
+func handshake(t *testing.T, server, client *QUIC) error {
+	t.Helper()
+	for _, q := range []*QUIC{server, client} {
+		q.ALPN = []string{"paqet-quic"}
+		if errs := q.validateCerts(); len(errs) > 0 {
+			t.Fatalf("validateCerts: %v", errs)
+		}
+	}
+	serverTLS, err := server.GenerateTLSConfig("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTLS, err := client.GenerateTLSConfig("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTLS.ServerName = "paqet.internal"
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	errc := make(chan error, 1)
+	go func() {
+		err := tls.Server(c1, serverTLS).Handshake()
+		c1.Close()
+		errc <- err
+	}()
+	cerr := tls.Client(c2, clientTLS).Handshake()
+	c2.Close()
+	serr := <-errc
+	if cerr != nil {
+		return cerr
+	}
+	return serr
+}
+
+func TestQUICPinnedServerCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, pin := writeCert(t, dir, "server")
+	_, _, otherPin := writeCert(t, dir, "other")
+
+	server := &QUIC{CertFile: certFile, KeyFile: keyFile}
+	if err := handshake(t, server, &QUIC{PinnedSHA256: []string{pin}}); err != nil {
+		t.Errorf("pinned handshake failed: %v", err)
+	}
+	if err := handshake(t, server, &QUIC{PinnedSHA256: []string{otherPin}}); err == nil {
+		t.Errorf("handshake with the wrong pin succeeded")
+	}
+}
+
+func TestQUICMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey, serverPin := writeCert(t, dir, "server")
+	clientCert, clientKey, clientPin := writeCert(t, dir, "client")
+
+	server := &QUIC{CertFile: serverCert, KeyFile: serverKey, PinnedSHA256: []string{clientPin}}
+	client := &QUIC{CertFile: clientCert, KeyFile: clientKey, PinnedSHA256: []string{serverPin}}
+	if err := handshake(t, server, client); err != nil {
+		t.Errorf("mutual TLS handshake failed: %v", err)
+	}
+	if err := handshake(t, server, &QUIC{PinnedSHA256: []string{serverPin}}); err == nil {
+		t.Errorf("server accepted a client without a certificate")
+	}
+}
+
+func TestQUICPinFormat(t *testing.T) {
+	q := &QUIC{PinnedSHA256: []string{"AB:CD", "zz"}}
+	if errs := q.validateCerts(); len(errs) != 2 {
+		t.Errorf("got %d errors for malformed pins, want 2", len(errs))
+	}
+}
+
+// TestQUICPinnedResumption tests that a session ticket issued under one pin
+// does not resume once the pin changes.
+func TestQUICPinnedResumption(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, pin := writeCert(t, dir, "server")
+	_, _, otherPin := writeCert(t, dir, "other")
+	server := &QUIC{CertFile: certFile, KeyFile: keyFile, ALPN: []string{"paqet-quic"}}
+	if errs := server.validateCerts(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	serverTLS, err := server.GenerateTLSConfig("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := tls.NewLRUClientSessionCache(4)
+
+	connect := func(pin string) (bool, error) {
+		client := &QUIC{PinnedSHA256: []string{pin}, ALPN: []string{"paqet-quic"}, SessionCache: cache}
+		if errs := client.validateCerts(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		clientTLS, err := client.GenerateTLSConfig("client")
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientTLS.ServerName = "paqet.internal"
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		defer c2.Close()
+		go func() {
+			s := tls.Server(c1, serverTLS)
+			if s.Handshake() == nil {
+				s.Write([]byte{1}) // delivers the session ticket
+			}
+			c1.Close()
+		}()
+		c := tls.Client(c2, clientTLS)
+		if err := c.Handshake(); err != nil {
+			return false, err
+		}
+		if _, err := c.Read(make([]byte, 1)); err != nil {
+			return false, err
+		}
+		return c.ConnectionState().DidResume, nil
+	}
+
+	if _, err := connect(pin); err != nil {
+		t.Fatalf("first handshake: %v", err)
+	}
+	if resumed, err := connect(pin); err != nil || !resumed {
+		t.Fatalf("second handshake: resumed %t, %v", resumed, err)
+	}
+	if _, err := connect(otherPin); err == nil {
+		t.Error("resumed a session after the pin changed")
+	}
+}
+
+func TestTicketKeys(t *testing.T) {
+	today, err := ticketKeys(nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(today) != 1 {
+		t.Fatalf("first keys: got %d, want 1", len(today))
+	}
+	tomorrow, _ := ticketKeys(today, 1)
+	if len(tomorrow) != 2 || tomorrow[1] != today[0] || tomorrow[0] == today[0] {
+		t.Error("ticket keys do not rotate to the next period")
+	}
+	later, _ := ticketKeys(tomorrow, 2)
+	if len(later) != 1 || later[0] == tomorrow[0] {
+		t.Error("ticket keys kept a key older than one period")
+	}
+}
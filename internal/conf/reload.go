@@ -0,0 +1,71 @@
+package conf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Reload controls how a hot-reloaded configuration is trialled. Changes are
+// applied provisionally and rolled back if the connection success rate or
+// packet drop rate degrades within the probation window.
+type Reload struct {
+	Probation      int     `yaml:"probation"`        // seconds before a reload is committed
+	MinSuccessRate float64 `yaml:"min_success_rate"` // fraction of connection attempts that must succeed
+	MaxDropRate    float64 `yaml:"max_drop_rate"`    // dropped packets per second
+}
+
+func (r *Reload) setDefaults() {
+	if r.Probation == 0 {
+		r.Probation = 60
+	}
+	if r.MinSuccessRate == 0 {
+		r.MinSuccessRate = 0.9
+	}
+	if r.MaxDropRate == 0 {
+		r.MaxDropRate = 50
+	}
+}
+
+func (r *Reload) validate() []error {
+	var errors []error
+	if r.Probation < 5 || r.Probation > 3600 {
+		errors = append(errors, fmt.Errorf("reload.probation must be between 5-3600 seconds"))
+	}
+	if r.MinSuccessRate < 0 || r.MinSuccessRate > 1 {
+		errors = append(errors, fmt.Errorf("reload.min_success_rate must be between 0 and 1"))
+	}
+	if r.MaxDropRate < 0 {
+		errors = append(errors, fmt.Errorf("reload.max_drop_rate must be >= 0"))
+	}
+	return errors
+}
+
+// CheckReloadable reports whether next differs from c only in settings that
+// can be applied without a restart: the KCP and QUIC tuning used for new
+// transport connections, and the reload section itself.
+func (c *Conf) CheckReloadable(next *Conf) error {
+	if c.Transport.Protocol != next.Transport.Protocol {
+		return fmt.Errorf("transport.protocol cannot be changed without a restart")
+	}
+	a, err := c.reloadBase()
+	if err != nil {
+		return err
+	}
+	b, err := next.reloadBase()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(a, b) {
+		return fmt.Errorf("only transport.kcp, transport.quic and reload can be changed without a restart")
+	}
+	return nil
+}
+
+// reloadBase renders the configuration without its reloadable settings.
+func (c *Conf) reloadBase() ([]byte, error) {
+	base := *c
+	base.Transport.KCP = nil
+	base.Transport.QUIC = nil
+	base.Reload = Reload{}
+	return base.Effective(true)
+}
@@ -0,0 +1,31 @@
+package conf
+
+import "testing"
+
+func TestCheckReloadable(t *testing.T) {
+	base := func() *Conf {
+		c := &Conf{Role: "client", SOCKS5: []SOCKS5{{Username: "alice"}}}
+		c.Transport.Protocol = "kcp"
+		c.Transport.KCP = &KCP{Mode: "fast", Rcvwnd: 512}
+		return c
+	}
+
+	next := base()
+	next.Transport.KCP.Rcvwnd = 2048
+	next.Reload.Probation = 30
+	if err := base().CheckReloadable(next); err != nil {
+		t.Errorf("KCP tuning change rejected: %v", err)
+	}
+
+	next = base()
+	next.SOCKS5[0].Username = "bob"
+	if err := base().CheckReloadable(next); err == nil {
+		t.Errorf("SOCKS5 change accepted")
+	}
+
+	next = base()
+	next.Transport.Protocol = "quic"
+	if err := base().CheckReloadable(next); err == nil {
+		t.Errorf("protocol change accepted")
+	}
+}
@@ -0,0 +1,61 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"paqet/internal/tnet"
+	"slices"
+)
+
+// Reverse asks the server to listen on Listen and forward every TCP
+// connection it accepts back through the client to Target, a service on
+// the client's side (like ssh -R).
+type Reverse struct {
+	Listen_ string       `yaml:"listen"` // on the server
+	Target_ string       `yaml:"target"` // dialed by the client
+	Listen  *net.UDPAddr `yaml:"-"`
+	Target  *tnet.Addr   `yaml:"-"`
+}
+
+func (r *Reverse) validate() []error {
+	var errors []error
+	l, err := validateAddr(r.Listen_, true)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	r.Listen = l
+
+	t, err := tnet.NewAddr(r.Target_)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	r.Target = t
+	return errors
+}
+
+// ReversePolicy lists the ports a server lets clients listen on for
+// reverse forwards. Reverse forwarding is refused when it is empty.
+type ReversePolicy struct {
+	Ports_ string      `yaml:"ports"` // "2222", "10000-10100", comma separated
+	Ports  [][2]uint16 `yaml:"-"`
+}
+
+// Enabled reports whether clients may request reverse forwards.
+func (r *ReversePolicy) Enabled() bool {
+	return r.Ports_ != ""
+}
+
+// Allow reports whether a client may listen on port.
+func (r *ReversePolicy) Allow(port int) bool {
+	return slices.ContainsFunc(r.Ports, func(p [2]uint16) bool { return port >= int(p[0]) && port <= int(p[1]) })
+}
+
+func (r *ReversePolicy) validate() []error {
+	var errors []error
+	ports, errs := parsePortRanges(r.Ports_)
+	for _, err := range errs {
+		errors = append(errors, fmt.Errorf("server.reverse: %v", err))
+	}
+	r.Ports = ports
+	return errors
+}
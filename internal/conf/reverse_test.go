@@ -0,0 +1,23 @@
+package conf
+
+import "testing"
+
+func TestReversePolicy(t *testing.T) {
+	p := ReversePolicy{Ports_: "2222, 10000-10100"}
+	if errs := p.validate(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for port, want := range map[int]bool{2222: true, 10000: true, 10100: true, 22: false, 10101: false} {
+		if got := p.Allow(port); got != want {
+			t.Errorf("Allow(%d) = %v, want %v", port, got, want)
+		}
+	}
+
+	var off ReversePolicy
+	if off.Enabled() || off.Allow(2222) {
+		t.Error("empty policy allows reverse forwards")
+	}
+	if errs := (&ReversePolicy{Ports_: "0-10"}).validate(); len(errs) != 1 {
+		t.Errorf("invalid range: %v", errs)
+	}
+}
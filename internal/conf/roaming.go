@@ -0,0 +1,61 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Roaming watches the network a client is on for captive portals. Behind
+// a portal, or with no connectivity at all, the tunnel is paused instead of
+// redialing into the void, and every connection is brought back up as soon
+// as the check passes again.
+type Roaming struct {
+	URL          string `yaml:"url"`           // connectivity check fetched outside the tunnel; empty disables roaming
+	Status       int    `yaml:"status"`        // status code of an unhijacked response
+	Interval     int    `yaml:"interval"`      // seconds between checks while online
+	FastInterval int    `yaml:"fast_interval"` // seconds between checks while paused
+	Timeout      int    `yaml:"timeout"`       // milliseconds before a check counts as offline
+}
+
+// Enabled reports whether roaming is configured.
+func (r *Roaming) Enabled() bool {
+	return r.URL != ""
+}
+
+func (r *Roaming) setDefaults() {
+	if r.Status == 0 {
+		r.Status = 204
+	}
+	if r.Interval == 0 {
+		r.Interval = 15
+	}
+	if r.FastInterval == 0 {
+		r.FastInterval = 2
+	}
+	if r.Timeout == 0 {
+		r.Timeout = 3000
+	}
+}
+
+func (r *Roaming) validate() []error {
+	var errors []error
+	if !r.Enabled() {
+		return errors
+	}
+	if u, err := url.Parse(r.URL); err != nil || u.Scheme != "http" || u.Host == "" {
+		errors = append(errors, fmt.Errorf("roaming.url must be a plain http:// URL, which portals can hijack"))
+	}
+	if r.Status < 200 || r.Status > 299 {
+		errors = append(errors, fmt.Errorf("roaming.status must be a 2xx status code"))
+	}
+	if r.Interval < 1 || r.Interval > 3600 {
+		errors = append(errors, fmt.Errorf("roaming.interval must be between 1-3600 seconds"))
+	}
+	if r.FastInterval < 1 || r.FastInterval > r.Interval {
+		errors = append(errors, fmt.Errorf("roaming.fast_interval must be between 1 second and roaming.interval"))
+	}
+	if r.Timeout < 100 || r.Timeout > 30000 {
+		errors = append(errors, fmt.Errorf("roaming.timeout must be between 100-30000 milliseconds"))
+	}
+	return errors
+}
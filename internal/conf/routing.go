@@ -0,0 +1,154 @@
+package conf
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Routing decides per destination whether a SOCKS5 or forward connection
+// of the client goes through the tunnel, directly out of the local network,
+// or nowhere. Rules are checked in order and the first match decides;
+// destinations no rule matches go through the tunnel.
+type Routing struct {
+	GeoIP  string   `yaml:"geoip"` // MaxMind DB country database for geoip rules
+	Rules_ []string `yaml:"rules"` // "<match> -> <action>", e.g. "geoip:ir -> direct", "service:bittorrent -> block" or "domain-suffix:ssh.example.com -> tunnel:interactive"
+
+	Rules []RoutingRule `yaml:"-"`
+}
+
+// RoutingRule is a parsed routing rule.
+type RoutingRule struct {
+	Kind   string // domain, domain-suffix, domain-keyword, ip-cidr, geoip, service or default
+	Value  string // lower-case name, keyword or service, upper-case country code
+	Prefix netip.Prefix
+	Action string // tunnel, direct or block
+	Group  string // transport.groups connections for tunnel, empty for the default ones
+}
+
+var routingKinds = []string{"domain", "domain-suffix", "domain-keyword", "ip-cidr", "geoip", "service"}
+
+// Enabled reports whether any rule is configured.
+func (r *Routing) Enabled() bool {
+	return len(r.Rules_) > 0
+}
+
+// NeedsGeoIP reports whether any rule looks up countries.
+func (r *Routing) NeedsGeoIP() bool {
+	return slices.ContainsFunc(r.Rules, func(rule RoutingRule) bool { return rule.Kind == "geoip" })
+}
+
+// Route returns the action for a connection over network ("tcp" or "udp")
+// to host and port; host is a name or an address literal. country looks
+// up the country code of an address; it is only called for geoip rules.
+// Name and address rules only match destinations given as names and
+// addresses respectively, since resolving names locally would leak them.
+func (r *Routing) Route(network, host string, port uint16, country func(netip.Addr) string) string {
+	return r.Match(network, host, port, country).Action
+}
+
+// Match is Route returning the whole rule that decided, so that callers
+// see the group of a tunnel action.
+func (r *Routing) Match(network, host string, port uint16, country func(netip.Addr) string) RoutingRule {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip, err := netip.ParseAddr(host)
+	isIP := err == nil
+	if isIP {
+		ip = ip.Unmap()
+	}
+	for _, rule := range r.Rules {
+		var match bool
+		switch rule.Kind {
+		case "default":
+			match = true
+		case "domain":
+			match = !isIP && host == rule.Value
+		case "domain-suffix":
+			match = !isIP && (host == rule.Value || strings.HasSuffix(host, "."+rule.Value))
+		case "domain-keyword":
+			match = !isIP && strings.Contains(host, rule.Value)
+		case "ip-cidr":
+			match = isIP && rule.Prefix.Contains(ip)
+		case "geoip":
+			match = isIP && country != nil && country(ip) == rule.Value
+		case "service":
+			match = matchService(rule.Value, network, port)
+		}
+		if match {
+			return rule
+		}
+	}
+	return RoutingRule{Kind: "default", Action: "tunnel"}
+}
+
+func (r *Routing) validate() []error {
+	var errors []error
+	r.Rules = r.Rules[:0]
+	for i, s := range r.Rules_ {
+		rule, err := parseRoutingRule(s)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("routing.rules[%d] %v", i, err))
+			continue
+		}
+		r.Rules = append(r.Rules, rule)
+	}
+	if r.NeedsGeoIP() && r.GeoIP == "" {
+		errors = append(errors, fmt.Errorf("routing geoip rules require routing.geoip, a MaxMind DB country database"))
+	}
+	return errors
+}
+
+// parseRoutingRule parses "<kind>:<value> -> <action>" or
+// "default -> <action>", where a tunnel action may name a group as
+// "tunnel:<group>".
+func parseRoutingRule(s string) (RoutingRule, error) {
+	var rule RoutingRule
+	match, action, ok := strings.Cut(s, "->")
+	if !ok {
+		return rule, fmt.Errorf("'%s' must have the form '<match> -> <action>'", s)
+	}
+	action, group, grouped := strings.Cut(strings.TrimSpace(action), ":")
+	rule.Action = strings.ToLower(strings.TrimSpace(action))
+	if !slices.Contains([]string{"tunnel", "direct", "block"}, rule.Action) {
+		return rule, fmt.Errorf("action '%s' must be tunnel, direct or block", rule.Action)
+	}
+	if grouped {
+		rule.Group = strings.TrimSpace(group)
+		if rule.Action != "tunnel" || rule.Group == "" {
+			return rule, fmt.Errorf("only the tunnel action takes a group, as 'tunnel:<group>'")
+		}
+	}
+	match = strings.TrimSpace(match)
+	if strings.EqualFold(match, "default") {
+		rule.Kind = "default"
+		return rule, nil
+	}
+	kind, value, ok := strings.Cut(match, ":")
+	kind, value = strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(value)
+	if !ok || value == "" || !slices.Contains(routingKinds, kind) {
+		return rule, fmt.Errorf("match '%s' must be default or one of %v followed by ':<value>'", match, routingKinds)
+	}
+	rule.Kind = kind
+	switch kind {
+	case "ip-cidr":
+		p, err := netip.ParsePrefix(value)
+		if err != nil {
+			return rule, fmt.Errorf("invalid ip-cidr '%s': %v", value, err)
+		}
+		rule.Prefix = p.Masked()
+	case "geoip":
+		if len(value) != 2 {
+			return rule, fmt.Errorf("geoip '%s' must be a two-letter country code", value)
+		}
+		rule.Value = strings.ToUpper(value)
+	case "service":
+		rule.Value = strings.ToLower(value)
+		if _, ok := services[rule.Value]; !ok {
+			return rule, fmt.Errorf("unknown service '%s', must be one of %v", value, serviceNames())
+		}
+	default:
+		rule.Value = strings.ToLower(strings.Trim(value, "."))
+	}
+	return rule, nil
+}
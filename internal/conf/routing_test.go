@@ -0,0 +1,100 @@
+package conf
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestRoutingRoute(t *testing.T) {
+	r := Routing{GeoIP: "/dev/null", Rules_: []string{
+		"domain-suffix:corp.local -> tunnel",
+		"domain:example.com -> direct",
+		"domain-keyword:ads -> block",
+		"ip-cidr:192.168.0.0/16 -> direct",
+		"geoip:ir -> direct",
+		"service:bittorrent -> block",
+		"service:QUIC -> direct",
+		"default -> tunnel",
+	}}
+	if errs := r.validate(); len(errs) > 0 {
+		t.Fatalf("validate: %v", errs)
+	}
+	country := func(ip netip.Addr) string {
+		if netip.MustParsePrefix("5.0.0.0/8").Contains(ip) {
+			return "IR"
+		}
+		return "US"
+	}
+	for host, want := range map[string]string{
+		"db.corp.local":    "tunnel",
+		"example.com.":     "direct",
+		"www.example.com":  "tunnel",
+		"ads.tracker.net":  "block",
+		"192.168.1.1":      "direct",
+		"5.1.2.3":          "direct",
+		"8.8.8.8":          "tunnel",
+		"::ffff:5.1.2.3":   "direct",
+		"iran.example.org": "tunnel",
+	} {
+		if got := r.Route("tcp", host, 443, country); got != want {
+			t.Errorf("Route(%s) = %s, want %s", host, got, want)
+		}
+	}
+}
+
+func TestRoutingService(t *testing.T) {
+	r := Routing{Rules_: []string{"service:bittorrent -> block", "service:quic -> direct", "service:dns -> tunnel", "default -> direct"}}
+	if errs := r.validate(); len(errs) > 0 {
+		t.Fatalf("validate: %v", errs)
+	}
+	for _, c := range []struct {
+		network string
+		port    uint16
+		want    string
+	}{
+		{"tcp", 6881, "block"},
+		{"udp", 6999, "block"},
+		{"udp", 443, "direct"},
+		{"tcp", 443, "direct"}, // default: quic is UDP only
+		{"udp", 53, "tunnel"},
+		{"tcp", 853, "tunnel"},
+		{"tcp", 7000, "direct"},
+	} {
+		if got := r.Route(c.network, "tracker.example", c.port, nil); got != c.want {
+			t.Errorf("Route(%s, %d) = %s, want %s", c.network, c.port, got, c.want)
+		}
+	}
+}
+
+func TestRoutingGroup(t *testing.T) {
+	r := Routing{Rules_: []string{"domain-suffix:ssh.example.com -> tunnel:interactive", "default -> tunnel"}}
+	if errs := r.validate(); len(errs) > 0 {
+		t.Fatalf("validate: %v", errs)
+	}
+	if rule := r.Match("tcp", "git.ssh.example.com", 22, nil); rule.Action != "tunnel" || rule.Group != "interactive" {
+		t.Errorf("Match(git.ssh.example.com) = %s:%s, want tunnel:interactive", rule.Action, rule.Group)
+	}
+	if rule := r.Match("tcp", "example.com", 443, nil); rule.Action != "tunnel" || rule.Group != "" {
+		t.Errorf("Match(example.com) = %s:%s, want tunnel", rule.Action, rule.Group)
+	}
+}
+
+func TestRoutingInvalid(t *testing.T) {
+	for _, rules := range [][]string{
+		{"geoip:ir direct"},
+		{"geoip:iran -> direct"},
+		{"ip-cidr:10.0.0.0 -> direct"},
+		{"domain: -> direct"},
+		{"port:80 -> direct"},
+		{"service:torrent -> block"},
+		{"default -> proxy"},
+		{"default -> direct:bulk"},
+		{"default -> tunnel:"},
+		{"geoip:ir -> direct"}, // no routing.geoip
+	} {
+		r := Routing{Rules_: rules}
+		if errs := r.validate(); len(errs) == 0 {
+			t.Errorf("rules %q: expected validation error", rules)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package conf
+
+import "fmt"
+
+// Scheduling keeps interactive streams off the connections that bulk
+// transfers fill up. A client with several transport connections puts
+// streams to interactive ports on the connection with the lowest heartbeat
+// round-trip time and every other stream on the rest, and re-picks that
+// connection as the round-trip times change.
+type Scheduling struct {
+	Interactive []int `yaml:"interactive_ports"` // TCP and UDP destination ports of interactive streams; empty disables scheduling
+	Interval    int   `yaml:"interval"`          // seconds between re-evaluations of the fastest connection
+}
+
+// Enabled reports whether scheduling is configured.
+func (s *Scheduling) Enabled() bool {
+	return len(s.Interactive) > 0
+}
+
+func (s *Scheduling) setDefaults() {
+	if s.Interval == 0 {
+		s.Interval = 10
+	}
+}
+
+func (s *Scheduling) validate() []error {
+	var errors []error
+	if !s.Enabled() {
+		return errors
+	}
+	for _, p := range s.Interactive {
+		if p < 1 || p > 65535 {
+			errors = append(errors, fmt.Errorf("transport.scheduling.interactive_ports: invalid port %d", p))
+		}
+	}
+	if s.Interval < 1 || s.Interval > 3600 {
+		errors = append(errors, fmt.Errorf("transport.scheduling.interval must be between 1-3600 seconds"))
+	}
+	return errors
+}
@@ -0,0 +1,90 @@
+package conf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// secretTimeout bounds a *_cmd command printing a secret.
+const secretTimeout = 10 * time.Second
+
+// readSecret returns the secret configured at name, e.g.
+// transport.kcp.key: value itself, the contents of file, or what cmd
+// prints when run by the shell. Trailing line breaks are trimmed from the
+// latter two. At most one of the three may be set.
+func readSecret(name, value, file, cmd string) (string, error) {
+	set := 0
+	for _, s := range []string{value, file, cmd} {
+		if s != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return "", fmt.Errorf("only one of %s, %s_file and %s_cmd may be set", name, name, name)
+	}
+	switch {
+	case file != "":
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("%s_file: %v", name, err)
+		}
+		s := strings.TrimRight(string(b), "\r\n")
+		if s == "" {
+			return "", fmt.Errorf("%s_file %s is empty", name, file)
+		}
+		return s, nil
+	case cmd != "":
+		ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+		defer cancel()
+		sh, flag := "/bin/sh", "-c"
+		if runtime.GOOS == "windows" {
+			sh, flag = "cmd", "/C"
+		}
+		out, err := exec.CommandContext(ctx, sh, flag, cmd).Output()
+		if err != nil {
+			// Only stderr is shown: stdout may hold part of the secret.
+			var exit *exec.ExitError
+			if errors.As(err, &exit) && len(exit.Stderr) > 0 {
+				err = fmt.Errorf("%v: %s", err, bytes.TrimSpace(exit.Stderr))
+			}
+			return "", fmt.Errorf("%s_cmd failed: %v", name, err)
+		}
+		s := strings.TrimRight(string(out), "\r\n")
+		if s == "" {
+			return "", fmt.Errorf("%s_cmd printed nothing", name)
+		}
+		return s, nil
+	}
+	return value, nil
+}
+
+// resolveSecrets replaces the secrets configured with *_file or *_cmd by
+// their values, before defaults and validation see them.
+func (c *Conf) resolveSecrets() error {
+	var errs []error
+	resolve := func(name string, value *string, file, cmd string) {
+		s, err := readSecret(name, *value, file, cmd)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		*value = s
+	}
+	if k := c.Transport.KCP; k != nil {
+		resolve("transport.kcp.key", &k.Key, k.KeyFile, k.KeyCmd)
+	}
+	if q := c.Transport.QUIC; q != nil {
+		resolve("transport.quic.ech_key", &q.ECHKey_, q.ECHKeyFile, q.ECHKeyCmd)
+	}
+	resolve("transport.psk", &c.Transport.PSK, c.Transport.PSKFile, c.Transport.PSKCmd)
+	resolve("ha.key", &c.HA.Key, c.HA.KeyFile, c.HA.KeyCmd)
+	resolve("kcptun.key", &c.Kcptun.Key, c.Kcptun.KeyFile, c.Kcptun.KeyCmd)
+	return writeErr(errs)
+}
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestReadSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := readSecret("transport.kcp.key", "", file, ""); err != nil || s != "from-file" {
+		t.Errorf("key_file = %q, %v, want from-file", s, err)
+	}
+	if s, err := readSecret("transport.kcp.key", "inline", "", ""); err != nil || s != "inline" {
+		t.Errorf("key = %q, %v, want inline", s, err)
+	}
+	if _, err := readSecret("transport.kcp.key", "inline", file, ""); err == nil {
+		t.Error("key and key_file together were accepted")
+	}
+	if _, err := readSecret("transport.kcp.key", "", filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("missing key_file was accepted")
+	}
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSecret("transport.psk", "", empty, ""); err == nil {
+		t.Error("empty psk_file was accepted")
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if s, err := readSecret("transport.psk", "", "", "printf 'from-cmd\\n'"); err != nil || s != "from-cmd" {
+		t.Errorf("psk_cmd = %q, %v, want from-cmd", s, err)
+	}
+	if _, err := readSecret("transport.psk", "", "", "echo oops >&2; exit 3"); err == nil {
+		t.Error("failing psk_cmd was accepted")
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "psk")
+	if err := os.WriteFile(file, []byte("0123456789abcdef\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := Conf{Transport: Transport{PSKFile: file, KCP: &KCP{Key: "inline"}}}
+	if err := c.resolveSecrets(); err != nil {
+		t.Fatalf("resolveSecrets: %v", err)
+	}
+	if c.Transport.PSK != "0123456789abcdef" || c.Transport.KCP.Key != "inline" {
+		t.Errorf("psk = %q, kcp.key = %q", c.Transport.PSK, c.Transport.KCP.Key)
+	}
+	b, err := c.Effective(true)
+	if err != nil {
+		t.Fatalf("Effective: %v", err)
+	}
+	var again Conf
+	if err := yaml.Unmarshal(b, &again); err != nil || again.resolveSecrets() != nil {
+		t.Errorf("effective configuration with secrets does not load again: %v", err)
+	}
+}
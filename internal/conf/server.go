@@ -1,15 +1,81 @@
 package conf
 
 import (
+	"fmt"
 	"net"
+	"net/url"
 )
 
 type Server struct {
 	Addr_ string       `yaml:"addr"`
 	Addr  *net.UDPAddr `yaml:"-"`
+
+	// Client: servers to switch to when the one at addr fails
+	Failover Failover `yaml:"failover"`
+
+	// ACL and Reverse apply in the server role only; the client uses addr
+	// and failover.
+	ACL     ACL           `yaml:"acl"`
+	Reverse ReversePolicy `yaml:"reverse"`
+
+	// Seconds a server that handed off to a new process keeps serving
+	// the connections it has (server role)
+	DrainTimeout int `yaml:"drain_timeout"`
+
+	// Seconds a server told to stop by SIGTERM, SIGINT or the admin API
+	// lets open streams finish, -1 to stop at once (server role)
+	ShutdownGrace int `yaml:"shutdown_grace"`
+
+	// Priority classes of clients competing for stream slots (server role)
+	Priority Priority `yaml:"priority"`
+
+	// Proxy that upstream connections are dialed through instead of
+	// directly (server role): socks5://[user:pass@]host:port or
+	// http://[user:pass@]host:port
+	EgressProxy_ string   `yaml:"egress_proxy"`
+	EgressProxy  *url.URL `yaml:"-"`
+}
+
+func (s *Server) setDefaults() {
+	s.ACL.setDefaults()
+	s.Failover.setDefaults()
+	if s.DrainTimeout == 0 {
+		s.DrainTimeout = 300
+	}
+	if s.ShutdownGrace == 0 {
+		s.ShutdownGrace = 30
+	}
+}
+
+// validateEgressProxy parses egress_proxy.
+func (s *Server) validateEgressProxy() []error {
+	s.EgressProxy = nil
+	if s.EgressProxy_ == "" {
+		return nil
+	}
+	u, err := url.Parse(s.EgressProxy_)
+	if err != nil {
+		return []error{fmt.Errorf("server.egress_proxy: %v", err)}
+	}
+	if u.Scheme != "socks5" && u.Scheme != "http" {
+		return []error{fmt.Errorf("server.egress_proxy scheme must be socks5 or http")}
+	}
+	if u.Port() == "" || u.Hostname() == "" {
+		return []error{fmt.Errorf("server.egress_proxy must include the proxy's host and port")}
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return []error{fmt.Errorf("server.egress_proxy must not have a path or query")}
+	}
+	if u.User != nil && u.Scheme == "socks5" {
+		pass, _ := u.User.Password()
+		if len(u.User.Username()) > 255 || len(pass) > 255 {
+			return []error{fmt.Errorf("server.egress_proxy SOCKS5 username and password must be at most 255 bytes")}
+		}
+	}
+	s.EgressProxy = u
+	return nil
 }
 
-func (s *Server) setDefaults() {}
 func (s *Server) validate() []error {
 	var errors []error
 	addr, err := validateAddr(s.Addr_, true)
@@ -17,6 +83,7 @@ func (s *Server) validate() []error {
 		errors = append(errors, err)
 	}
 	s.Addr = addr
+	errors = append(errors, s.Failover.validate()...)
 
 	// if s.Timeout < 1 || s.Timeout > 3600 {
 	// 	errors = append(errors, fmt.Errorf("server timeout must be between 1-3600 seconds"))
@@ -0,0 +1,60 @@
+package conf
+
+import (
+	"slices"
+	"strings"
+)
+
+// service describes the traffic of a well-known application by the
+// destination ports it uses. Matching goes by port alone, so a service
+// moved to another port is not recognized, and anything else on its ports
+// is taken for it.
+type service struct {
+	tcp [][2]uint16
+	udp [][2]uint16
+}
+
+// services are the presets that routing rules and server ACLs can name.
+var services = map[string]service{
+	"dns":        {tcp: ports(53, 853), udp: ports(53, 853, 5353)},
+	"quic":       {udp: ports(443, 8443)},
+	"http":       {tcp: ports(80, 8000, 8008, 8080)},
+	"https":      {tcp: ports(443, 8443)},
+	"ssh":        {tcp: ports(22)},
+	"smtp":       {tcp: ports(25, 465, 587)},
+	"mail":       {tcp: ports(25, 110, 143, 465, 587, 993, 995)},
+	"ntp":        {udp: ports(123)},
+	"stun":       {tcp: ports(3478, 5349), udp: ports(3478, 5349, 19302)},
+	"rdp":        {tcp: ports(3389), udp: ports(3389)},
+	"bittorrent": {tcp: [][2]uint16{{6881, 6999}}, udp: [][2]uint16{{6881, 6999}, {6771, 6771}}},
+}
+
+func ports(p ...uint16) [][2]uint16 {
+	r := make([][2]uint16, len(p))
+	for i, p := range p {
+		r[i] = [2]uint16{p, p}
+	}
+	return r
+}
+
+// serviceNames lists the presets in a stable order, for error messages.
+func serviceNames() []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// matchService reports whether a connection over network ("tcp", "udp",
+// or one of their "4" and "6" variants) to port belongs to the service
+// name.
+func matchService(name, network string, port uint16) bool {
+	s := services[name]
+	r := s.tcp
+	if strings.HasPrefix(network, "udp") {
+		r = s.udp
+	}
+	return slices.ContainsFunc(r, func(p [2]uint16) bool { return port >= p[0] && port <= p[1] })
+}
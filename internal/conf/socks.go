@@ -8,7 +8,11 @@ type SOCKS5 struct {
 	Listen_  string       `yaml:"listen"`
 	Username string       `yaml:"username"`
 	Password string       `yaml:"password"`
+	Reuse    string       `yaml:"reuse"` // upstream reuse hint sent to the server: short or warm
+	Group    string       `yaml:"group"` // transport.groups connections to use, empty for the default ones
 	Listen   *net.UDPAddr `yaml:"-"`
+
+	ListenerSecurity `yaml:",inline"`
 }
 
 func (c *SOCKS5) setDefaults() {}
@@ -20,5 +24,7 @@ func (c *SOCKS5) validate() []error {
 		errors = append(errors, err)
 	}
 	c.Listen = addr
+	errors = append(errors, validateReuse(c.Reuse)...)
+	errors = append(errors, c.ListenerSecurity.validate()...)
 	return errors
 }
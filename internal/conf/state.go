@@ -0,0 +1,29 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+)
+
+// State configures the client state directory, which keeps QUIC session
+// tickets and the server certificates trusted by transport.quic.tofu
+// across restarts.
+type State struct {
+	Dir string `yaml:"dir"`
+}
+
+// Enabled reports whether a state directory is configured.
+func (s *State) Enabled() bool {
+	return s.Dir != ""
+}
+
+func (s *State) validate() []error {
+	var errors []error
+	if !s.Enabled() {
+		return errors
+	}
+	if fi, err := os.Stat(s.Dir); err == nil && !fi.IsDir() {
+		errors = append(errors, fmt.Errorf("state.dir %s is not a directory", s.Dir))
+	}
+	return errors
+}
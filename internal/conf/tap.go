@@ -0,0 +1,32 @@
+package conf
+
+import "fmt"
+
+// Tap mirrors stream activity, and optionally the first bytes of every
+// read and write, to consumers of a local unix socket for debugging. It
+// exposes decrypted traffic, so it has to be acknowledged with
+// insecure_debug.
+type Tap struct {
+	Socket        string `yaml:"socket"`
+	Payload       int    `yaml:"payload"` // bytes of payload per event (0 = lengths only)
+	InsecureDebug bool   `yaml:"insecure_debug"`
+}
+
+// Enabled reports whether the tap socket should be served.
+func (t *Tap) Enabled() bool {
+	return t.Socket != ""
+}
+
+func (t *Tap) validate() []error {
+	var errors []error
+	if !t.Enabled() {
+		return errors
+	}
+	if !t.InsecureDebug {
+		errors = append(errors, fmt.Errorf("tap.socket exposes decrypted traffic and requires tap.insecure_debug: true"))
+	}
+	if t.Payload < 0 || t.Payload > 4096 {
+		errors = append(errors, fmt.Errorf("tap.payload must be between 0-4096 bytes"))
+	}
+	return errors
+}
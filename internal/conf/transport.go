@@ -13,6 +13,75 @@ type Transport struct {
 	TUNBuf   int    `yaml:"tunbuf"`
 	KCP      *KCP   `yaml:"kcp"`
 	QUIC     *QUIC  `yaml:"quic"`
+
+	// Client low-power mode: close idle transport connections after this
+	// many seconds and reconnect on the next request (0 = off)
+	IdleSuspend int `yaml:"idle_suspend"`
+
+	WS *WebSocket `yaml:"websocket"`
+
+	// Pre-shared key for the authenticated hello each transport connection
+	// must complete before the server accepts streams on it (empty = off)
+	PSK     string `yaml:"psk"`
+	PSKFile string `yaml:"psk_file"` // read psk from this file instead
+	PSKCmd  string `yaml:"psk_cmd"`  // or from what this shell command prints
+
+	// Client: identifier sent in the hello, by which the server tells
+	// clients apart across reconnects (empty = random per process)
+	ClientID string `yaml:"client_id"`
+
+	// Client: streams kept open ahead of use on each transport connection,
+	// so a burst of new connections skips stream setup (0 = off)
+	Prefetch int `yaml:"prefetch"`
+
+	// Client: spread TUN and UDP traffic over all transport connections,
+	// "stripe" (each datagram on the best path) or "duplicate" (on every
+	// path); empty or "off" keeps one connection per stream
+	Multipath string `yaml:"multipath"`
+
+	// Frame PUDP datagrams with their length on stream transports, and
+	// optionally pace them
+	UDPFraming UDPFraming `yaml:"udp_framing"`
+
+	// Client: scale the number of connections between autoscale.min and
+	// autoscale.max with demand; conn is then the starting count
+	Autoscale Autoscale `yaml:"autoscale"`
+
+	// Client: ping each connection in the background and re-dial it after
+	// heartbeat.failures consecutive pings go unanswered
+	Heartbeat Heartbeat `yaml:"heartbeat"`
+
+	// Client: named sets of connections with their own health policy,
+	// chosen by listeners and routing rules instead of the conn ones
+	Groups []Group `yaml:"groups"`
+
+	// Client: put interactive streams on the connection with the lowest
+	// heartbeat round-trip time and bulk streams on the others
+	Scheduling Scheduling `yaml:"scheduling"`
+
+	// Client: limit how often transport connections to the server are
+	// dialed, and stop dialing for a while after repeated failures
+	Breaker Breaker `yaml:"breaker"`
+
+	// Client: reconnect to a server seen before without waiting for the
+	// format negotiation and hello round trips, and with QUIC 0-RTT where
+	// transport.quic.enable_0rtt allows it (default: true)
+	Resume *bool `yaml:"resume"`
+
+	// kcp and quic: pad packets to bucketed sizes, add dummy packets and
+	// delay packets at random, so that sizes and bursts do not fingerprint
+	// the flow; both sides must match
+	Obfs Obfs `yaml:"obfs"`
+}
+
+// ResumeValue reports whether reconnects may skip setup round trips.
+func (t *Transport) ResumeValue() bool {
+	return t.Resume == nil || *t.Resume
+}
+
+// MultipathEnabled reports whether TUN and UDP streams use multipath.
+func (t *Transport) MultipathEnabled() bool {
+	return t.Multipath == "stripe" || t.Multipath == "duplicate"
 }
 
 func (t *Transport) setDefaults(role string) {
@@ -21,6 +90,15 @@ func (t *Transport) setDefaults(role string) {
 		t.Protocol = "quic"
 	}
 
+	t.Autoscale.setDefaults()
+	t.Heartbeat.setDefaults()
+	for i := range t.Groups {
+		t.Groups[i].setDefaults(t.Heartbeat)
+	}
+	t.Scheduling.setDefaults()
+	t.Breaker.setDefaults()
+	t.UDPFraming.setDefaults()
+	t.Obfs.setDefaults(role)
 	if t.Conn == 0 {
 		if role == "client" {
 			switch t.Protocol {
@@ -34,6 +112,9 @@ func (t *Transport) setDefaults(role string) {
 		} else {
 			t.Conn = 1
 		}
+		if t.Autoscale.Enabled() {
+			t.Conn = clampInt(t.Conn, t.Autoscale.Min, t.Autoscale.Max)
+		}
 	}
 
 	if t.TCPBuf == 0 {
@@ -69,13 +150,18 @@ func (t *Transport) setDefaults(role string) {
 			t.QUIC = &QUIC{}
 		}
 		t.QUIC.setDefaults(role)
+	case "websocket":
+		if t.WS == nil {
+			t.WS = &WebSocket{}
+		}
+		t.WS.setDefaults()
 	}
 }
 
 func (t *Transport) validate() []error {
 	var errors []error
 
-	validProtocols := []string{"kcp", "quic"}
+	validProtocols := []string{"kcp", "quic", "websocket"}
 	if !slices.Contains(validProtocols, t.Protocol) {
 		errors = append(errors, fmt.Errorf("transport protocol must be one of: %v", validProtocols))
 	}
@@ -96,6 +182,38 @@ func (t *Transport) validate() []error {
 		errors = append(errors, fmt.Errorf("tunbuf must be between 8KB and 32MB"))
 	}
 
+	if t.IdleSuspend != 0 && (t.IdleSuspend < 30 || t.IdleSuspend > 86400) {
+		errors = append(errors, fmt.Errorf("idle_suspend must be 0 or between 30-86400 seconds"))
+	}
+
+	if t.Prefetch < 0 || t.Prefetch > 32 {
+		errors = append(errors, fmt.Errorf("prefetch must be between 0-32"))
+	}
+
+	if t.Multipath != "" && t.Multipath != "off" && !t.MultipathEnabled() {
+		errors = append(errors, fmt.Errorf("multipath must be off, stripe or duplicate"))
+	}
+
+	errors = append(errors, t.Autoscale.validate(t.Conn)...)
+	errors = append(errors, t.UDPFraming.validate()...)
+	if t.UDPFraming.Mode == "on" && t.MultipathEnabled() {
+		errors = append(errors, fmt.Errorf("transport.udp_framing cannot be combined with multipath, which already keeps datagrams apart"))
+	}
+	errors = append(errors, t.Obfs.validate(t.Protocol)...)
+	if t.Obfs.Enabled() {
+		if t.PSK == "" {
+			errors = append(errors, fmt.Errorf("transport.obfs requires transport.psk, with which frame headers are masked"))
+		}
+		t.Obfs.Key = []byte(t.PSK)
+	}
+
+	if t.PSK != "" && len(t.PSK) < 16 {
+		errors = append(errors, fmt.Errorf("transport psk must be at least 16 characters"))
+	}
+	if len(t.ClientID) > 64 {
+		errors = append(errors, fmt.Errorf("transport client_id must be at most 64 characters"))
+	}
+
 	switch t.Protocol {
 	case "kcp":
 		if t.KCP == nil {
@@ -109,6 +227,12 @@ func (t *Transport) validate() []error {
 			return errors
 		}
 		errors = append(errors, t.QUIC.validate()...)
+	case "websocket":
+		if t.WS == nil {
+			errors = append(errors, fmt.Errorf("transport.websocket is required when protocol is 'websocket'"))
+			return errors
+		}
+		errors = append(errors, t.WS.validate()...)
 	}
 
 	return errors
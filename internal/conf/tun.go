@@ -3,16 +3,72 @@ package conf
 import (
 	"fmt"
 	"net"
+	"path/filepath"
+	"runtime"
 )
 
 type TUN struct {
 	Enabled bool   `yaml:"enabled"`
 	Name    string `yaml:"name"`
-	Addr    string `yaml:"addr"`
+	Addr    string `yaml:"addr"`  // CIDR, or "auto" on a client to lease one from the server's Pool
+	Addr6   string `yaml:"addr6"` // optional IPv6 CIDR for a dual-stack tunnel
 	MTU     int    `yaml:"mtu"`
+	DNS     TUNDNS `yaml:"dns"`
+	Journal string `yaml:"journal"` // undo log of host changes, replayed after a crash
 
-	IP  net.IP `yaml:"-"`
-	Net *net.IPNet `yaml:"-"`
+	// IPv6 prefix delegation. The server hands out /64s from PrefixPool_;
+	// the client requests one and optionally assigns it to DelegateIface.
+	PrefixPool_   string `yaml:"prefix_pool"`
+	RequestPrefix bool   `yaml:"request_prefix"`
+	DelegateIface string `yaml:"delegate_iface"`
+
+	// Linux: exchange TCP super-packets of up to 64KB with the kernel
+	// (GSO/GRO) and carry them to the peer whole; both sides must match
+	Offload bool `yaml:"offload"`
+
+	// Linux: open a multiqueue device with this many queues, each read by
+	// its own worker, and shard flows across the TUN streams (default 1)
+	Queues int `yaml:"queues"`
+
+	// Server: deliver packets read from the device to the client that owns
+	// the destination address, learned from the packets each client sends
+	Routing bool `yaml:"routing"`
+	// Server, Linux: masquerade traffic from the tunnel network that leaves
+	// through another interface, and enable IP forwarding
+	SNAT bool `yaml:"snat"`
+	// Server, Linux: answer ARP and neighbor solicitations on this LAN
+	// interface for the overlay addresses routed into the device
+	ProxyARP string `yaml:"proxy_arp"`
+
+	// Server: lease client addresses from Pool_, a range inside the tunnel
+	// network, to clients with addr "auto", and push them the MTU and
+	// PushRoutes
+	Pool_      string   `yaml:"pool"`
+	PushRoutes []string `yaml:"push_routes"`
+
+	// Client: networks to route into the tunnel once it is up; "default"
+	// sends everything through it, with the server itself and
+	// ExcludeRoutes_ kept on the original gateway
+	Routes_        []string `yaml:"routes"`
+	ExcludeRoutes_ []string `yaml:"exclude_routes"`
+
+	// Client: seconds the tunnel may be down before routes and split DNS
+	// are withdrawn until it reconnects (0 = keep them, failing closed)
+	DownGrace int `yaml:"down_grace"`
+
+	Routes        []*net.IPNet   `yaml:"-"`
+	ExcludeRoutes []*net.IPNet   `yaml:"-"`
+	Servers       []*net.UDPAddr `yaml:"-"` // Set from server.addr and server.failover on clients: kept off the tunnel by full-tunnel routes
+
+	IP   net.IP     `yaml:"-"`
+	Net  *net.IPNet `yaml:"-"`
+	Auto bool       `yaml:"-"` // addr is "auto"
+	IP6  net.IP     `yaml:"-"` // nil unless addr6 is set
+	Net6 *net.IPNet `yaml:"-"`
+
+	Pool *net.IPNet `yaml:"-"`
+
+	PrefixPool *net.IPNet `yaml:"-"`
 }
 
 func (t *TUN) setDefaults() {
@@ -22,6 +78,12 @@ func (t *TUN) setDefaults() {
 	if t.MTU == 0 {
 		t.MTU = 1500
 	}
+	if t.Journal == "" {
+		t.Journal = filepath.Join("/var/run/paqet", t.Name+".journal")
+	}
+	if t.Queues == 0 {
+		t.Queues = 1
+	}
 }
 
 func (t *TUN) validate() []error {
@@ -36,17 +98,134 @@ func (t *TUN) validate() []error {
 		return errors
 	}
 
+	if t.MTU < 68 || t.MTU > 65535 {
+		errors = append(errors, fmt.Errorf("tun.mtu must be between 68-65535"))
+	}
+	if t.DownGrace < 0 || t.DownGrace > 3600 {
+		errors = append(errors, fmt.Errorf("tun.down_grace must be between 0-3600 seconds"))
+	} else if t.DownGrace > 0 && len(t.Routes_) == 0 && !t.DNS.Enabled() {
+		errors = append(errors, fmt.Errorf("tun.down_grace requires tun.routes or tun.dns, which it withdraws"))
+	}
+
+	if t.Addr6 != "" {
+		ip6, net6, err := net.ParseCIDR(t.Addr6)
+		if err != nil || ip6.To4() != nil {
+			errors = append(errors, fmt.Errorf("invalid tun.addr6 format (expected IPv6 CIDR, e.g., fd00:8::1/64)"))
+		} else {
+			t.IP6, t.Net6 = ip6, net6
+		}
+		if t.MTU < 1280 {
+			errors = append(errors, fmt.Errorf("tun.mtu must be at least 1280 with tun.addr6, the IPv6 minimum"))
+		}
+	}
+
+	t.Auto = t.Addr == "auto"
+	if t.Auto {
+		if t.Routing || t.SNAT || t.ProxyARP != "" || t.Pool_ != "" || t.PrefixPool_ != "" {
+			errors = append(errors, fmt.Errorf("tun.addr \"auto\" is for clients and cannot be combined with server settings"))
+		}
+		return append(errors, t.DNS.validate()...)
+	}
+
 	ip, ipNet, err := net.ParseCIDR(t.Addr)
 	if err != nil {
-		errors = append(errors, fmt.Errorf("invalid tun.addr format (expected CIDR, e.g., 10.0.0.1/24): %v", err))
+		errors = append(errors, fmt.Errorf("invalid tun.addr format (expected CIDR, e.g., 10.0.0.1/24, or \"auto\"): %v", err))
 		return errors
 	}
 	t.IP = ip
 	t.Net = ipNet
+	if t.IP6 != nil && ip.To4() == nil {
+		errors = append(errors, fmt.Errorf("tun.addr must be an IPv4 CIDR when tun.addr6 is set"))
+	}
 
-	if t.MTU < 68 || t.MTU > 65535 {
-		errors = append(errors, fmt.Errorf("tun.mtu must be between 68-65535"))
+	errors = append(errors, t.DNS.validate()...)
+
+	if t.PrefixPool_ != "" {
+		_, pool, err := net.ParseCIDR(t.PrefixPool_)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid tun.prefix_pool: %v", err))
+		} else if ones, bits := pool.Mask.Size(); bits != 128 || ones > 64 {
+			errors = append(errors, fmt.Errorf("tun.prefix_pool must be an IPv6 prefix of /64 or shorter"))
+		} else {
+			t.PrefixPool = pool
+		}
+	}
+	if t.DelegateIface != "" && !t.RequestPrefix {
+		errors = append(errors, fmt.Errorf("tun.delegate_iface requires tun.request_prefix"))
+	}
+	if t.Offload && runtime.GOOS != "linux" {
+		errors = append(errors, fmt.Errorf("tun.offload is only supported on Linux"))
+	}
+	if t.Queues < 0 || t.Queues > 64 {
+		errors = append(errors, fmt.Errorf("tun.queues must be between 1-64"))
+	} else if t.Queues > 1 && runtime.GOOS != "linux" {
+		errors = append(errors, fmt.Errorf("tun.queues is only supported on Linux"))
+	}
+	if t.SNAT && runtime.GOOS != "linux" {
+		errors = append(errors, fmt.Errorf("tun.snat is only supported on Linux"))
+	}
+	t.Routes = t.Routes[:0]
+	for _, r := range t.Routes_ {
+		if r == "default" {
+			t.Routes = append(t.Routes, &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)})
+			if t.Net6 != nil || (t.Net != nil && t.Net.IP.To4() == nil) {
+				t.Routes = append(t.Routes, &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)})
+			}
+			continue
+		}
+		_, n, err := net.ParseCIDR(r)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid tun.routes entry %q (expected CIDR or \"default\"): %v", r, err))
+			continue
+		}
+		t.Routes = append(t.Routes, n)
+	}
+	t.ExcludeRoutes = t.ExcludeRoutes[:0]
+	for _, r := range t.ExcludeRoutes_ {
+		_, n, err := net.ParseCIDR(r)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid tun.exclude_routes entry %q: %v", r, err))
+			continue
+		}
+		t.ExcludeRoutes = append(t.ExcludeRoutes, n)
+	}
+	if len(t.ExcludeRoutes_) > 0 && len(t.Routes_) == 0 {
+		errors = append(errors, fmt.Errorf("tun.exclude_routes requires tun.routes"))
+	}
+	if len(t.Routes_) > 0 && runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		errors = append(errors, fmt.Errorf("tun.routes is not supported on %s", runtime.GOOS))
+	}
+
+	if t.Pool_ != "" {
+		_, pool, err := net.ParseCIDR(t.Pool_)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid tun.pool: %v", err))
+		} else if netOnes, _ := t.Net.Mask.Size(); !t.Net.Contains(pool.IP) || len(pool.Mask) != len(t.Net.Mask) || ones(pool) < netOnes {
+			errors = append(errors, fmt.Errorf("tun.pool %s must lie inside the tunnel network %s", pool, t.Net))
+		} else {
+			t.Pool = pool
+		}
+	}
+	for _, r := range t.PushRoutes {
+		if _, _, err := net.ParseCIDR(r); err != nil {
+			errors = append(errors, fmt.Errorf("invalid tun.push_routes entry %q: %v", r, err))
+		}
+	}
+	if len(t.PushRoutes) > 0 && t.Pool_ == "" {
+		errors = append(errors, fmt.Errorf("tun.push_routes requires tun.pool"))
+	}
+	if t.ProxyARP != "" {
+		if runtime.GOOS != "linux" {
+			errors = append(errors, fmt.Errorf("tun.proxy_arp is only supported on Linux"))
+		} else if t.ProxyARP == t.Name {
+			errors = append(errors, fmt.Errorf("tun.proxy_arp must name a LAN interface, not the TUN device"))
+		}
 	}
 
 	return errors
 }
+
+func ones(n *net.IPNet) int {
+	o, _ := n.Mask.Size()
+	return o
+}
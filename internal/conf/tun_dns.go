@@ -0,0 +1,69 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+)
+
+// TUNDNS configures split-horizon DNS for the TUN device: queries for the
+// listed domains are sent to the tunnel-side servers, everything else keeps
+// using the system resolver.
+type TUNDNS struct {
+	Servers_ []string `yaml:"servers"`
+	Domains_ []string `yaml:"domains"`
+
+	// BlockLeaks rejects plaintext DNS (port 53) leaving through any
+	// interface other than the TUN device or loopback.
+	BlockLeaks bool `yaml:"block_leaks"`
+
+	Servers []net.IP `yaml:"-"`
+	Domains []string `yaml:"-"`
+}
+
+// Enabled reports whether split DNS has been configured.
+func (d *TUNDNS) Enabled() bool {
+	return len(d.Servers_) > 0
+}
+
+func (d *TUNDNS) validate() []error {
+	var errors []error
+
+	if d.BlockLeaks && runtime.GOOS != "linux" {
+		errors = append(errors, fmt.Errorf("tun.dns.block_leaks is not supported on %s", runtime.GOOS))
+	}
+
+	if !d.Enabled() {
+		if len(d.Domains_) > 0 {
+			errors = append(errors, fmt.Errorf("tun.dns.servers is required when tun.dns.domains is set"))
+		}
+		return errors
+	}
+	if len(d.Domains_) == 0 {
+		errors = append(errors, fmt.Errorf("tun.dns.domains is required when tun.dns.servers is set"))
+	}
+
+	d.Servers = d.Servers[:0]
+	for _, s := range d.Servers_ {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			errors = append(errors, fmt.Errorf("invalid tun.dns server '%s': must be an IP address", s))
+			continue
+		}
+		d.Servers = append(d.Servers, ip)
+	}
+
+	d.Domains = d.Domains[:0]
+	for _, dom := range d.Domains_ {
+		// Accept "~corp.example", ".corp.example" and "corp.example" alike.
+		name := strings.ToLower(strings.Trim(strings.TrimPrefix(dom, "~"), "."))
+		if name == "" || strings.ContainsAny(name, " /\\") {
+			errors = append(errors, fmt.Errorf("invalid tun.dns domain '%s'", dom))
+			continue
+		}
+		d.Domains = append(d.Domains, name)
+	}
+
+	return errors
+}
@@ -67,3 +67,139 @@ func TestTUNConfigDisabled(t *testing.T) {
 		t.Errorf("Expected no errors when TUN is disabled, got: %v", errs)
 	}
 }
+
+func TestTUNDNSConfig(t *testing.T) {
+	tun := TUN{
+		Enabled: true,
+		Addr:    "10.0.8.1/24",
+		MTU:     1400,
+		DNS: TUNDNS{
+			Servers_: []string{"10.0.8.2"},
+			Domains_: []string{"~Corp.Example", ".internal."},
+		},
+	}
+
+	errs := tun.validate()
+	if len(errs) > 0 {
+		t.Fatalf("Expected no errors, got: %v", errs)
+	}
+	if len(tun.DNS.Servers) != 1 || tun.DNS.Servers[0].String() != "10.0.8.2" {
+		t.Errorf("Expected server 10.0.8.2, got %v", tun.DNS.Servers)
+	}
+	if len(tun.DNS.Domains) != 2 || tun.DNS.Domains[0] != "corp.example" || tun.DNS.Domains[1] != "internal" {
+		t.Errorf("Expected normalized domains, got %v", tun.DNS.Domains)
+	}
+}
+
+func TestTUNDNSConfigInvalid(t *testing.T) {
+	cases := []TUNDNS{
+		{Servers_: []string{"not-an-ip"}, Domains_: []string{"corp.example"}},
+		{Servers_: []string{"10.0.8.2"}},
+		{Domains_: []string{"corp.example"}},
+	}
+	for i, dns := range cases {
+		if errs := dns.validate(); len(errs) == 0 {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
+
+func TestTUNConfigPool(t *testing.T) {
+	for _, tc := range []struct {
+		pool   string
+		routes []string
+		ok     bool
+	}{
+		{"10.0.8.128/25", []string{"10.0.9.0/24"}, true},
+		{"10.0.8.0/24", nil, true},
+		{"10.0.0.0/16", nil, false},
+		{"10.0.9.0/25", nil, false},
+		{"2001:db8::/120", nil, false},
+		{"10.0.8.128/25", []string{"10.0.9.0"}, false},
+	} {
+		tun := TUN{Enabled: true, Addr: "10.0.8.1/24", MTU: 1400, Pool_: tc.pool, PushRoutes: tc.routes}
+		tun.setDefaults()
+		if errs := tun.validate(); (len(errs) == 0) != tc.ok {
+			t.Errorf("pool %s, routes %v: errors %v, want ok=%v", tc.pool, tc.routes, errs, tc.ok)
+		}
+	}
+
+	tun := TUN{Enabled: true, Addr: "auto", MTU: 1400}
+	tun.setDefaults()
+	if errs := tun.validate(); len(errs) > 0 || !tun.Auto {
+		t.Errorf("addr auto: errors %v, auto %v", errs, tun.Auto)
+	}
+}
+
+func TestTUNConfigAddr6(t *testing.T) {
+	for _, tc := range []struct {
+		addr, addr6 string
+		mtu         int
+		ok          bool
+	}{
+		{"10.0.8.1/24", "fd00:8::1/64", 1400, true},
+		{"auto", "fd00:8::1/64", 1400, true},
+		{"10.0.8.1/24", "10.0.9.1/24", 1400, false},
+		{"fd00:9::1/64", "fd00:8::1/64", 1400, false},
+		{"10.0.8.1/24", "fd00:8::1/64", 1200, false},
+	} {
+		tun := TUN{Enabled: true, Addr: tc.addr, Addr6: tc.addr6, MTU: tc.mtu}
+		tun.setDefaults()
+		if errs := tun.validate(); (len(errs) == 0) != tc.ok {
+			t.Errorf("addr %s, addr6 %s, mtu %d: errors %v, want ok=%v", tc.addr, tc.addr6, tc.mtu, errs, tc.ok)
+		}
+	}
+}
+
+func TestTUNConfigRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		addr6   string
+		routes  []string
+		exclude []string
+		n       int
+		ok      bool
+	}{
+		{"", []string{"default"}, nil, 1, true},
+		{"fd00:8::1/64", []string{"default"}, []string{"192.168.0.0/16"}, 2, true},
+		{"", []string{"10.20.0.0/16", "10.30.0.0/16"}, nil, 2, true},
+		{"", []string{"10.20.0.0"}, nil, 0, false},
+		{"", nil, []string{"192.168.0.0/16"}, 0, false},
+	} {
+		tun := TUN{Enabled: true, Addr: "10.0.8.1/24", Addr6: tc.addr6, MTU: 1400, Routes_: tc.routes, ExcludeRoutes_: tc.exclude}
+		tun.setDefaults()
+		errs := tun.validate()
+		if (len(errs) == 0) != tc.ok {
+			t.Errorf("routes %v, exclude %v: errors %v, want ok=%v", tc.routes, tc.exclude, errs, tc.ok)
+		}
+		if tc.ok && len(tun.Routes) != tc.n {
+			t.Errorf("routes %v: got %d networks, want %d", tc.routes, len(tun.Routes), tc.n)
+		}
+	}
+}
+
+func TestTUNConfigDownGrace(t *testing.T) {
+	for _, tc := range []struct {
+		grace  int
+		routes []string
+		dns    []string
+		ok     bool
+	}{
+		{0, nil, nil, true},
+		{30, []string{"default"}, nil, true},
+		{30, nil, []string{"10.0.8.2"}, true},
+		{30, nil, nil, false},
+		{-1, []string{"default"}, nil, false},
+		{3601, []string{"default"}, nil, false},
+	} {
+		tun := TUN{Enabled: true, Addr: "10.0.8.1/24", MTU: 1400, Routes_: tc.routes, DownGrace: tc.grace}
+		tun.DNS.Servers_ = tc.dns
+		if tc.dns != nil {
+			tun.DNS.Domains_ = []string{"corp.example"}
+		}
+		tun.setDefaults()
+		errs := tun.validate()
+		if (len(errs) == 0) != tc.ok {
+			t.Errorf("down_grace %d, routes %v, dns %v: errors %v, want ok=%v", tc.grace, tc.routes, tc.dns, errs, tc.ok)
+		}
+	}
+}
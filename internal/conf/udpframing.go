@@ -0,0 +1,36 @@
+package conf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// UDPFraming frames every datagram of a PUDP stream with its length, so
+// that datagram boundaries survive transports that deliver a byte stream,
+// and can pace the datagrams a side sends.
+type UDPFraming struct {
+	Mode string `yaml:"mode"` // Client: auto (on for websocket), on or off
+	Pace int    `yaml:"pace"` // datagrams per second sent on each framed stream, 0 = unpaced
+}
+
+// Framed reports whether the client frames PUDP streams over protocol.
+func (u *UDPFraming) Framed(protocol string) bool {
+	return u.Mode == "on" || u.Mode == "auto" && protocol == "websocket"
+}
+
+func (u *UDPFraming) setDefaults() {
+	if u.Mode == "" {
+		u.Mode = "auto"
+	}
+}
+
+func (u *UDPFraming) validate() []error {
+	var errors []error
+	if !slices.Contains([]string{"auto", "on", "off"}, u.Mode) {
+		errors = append(errors, fmt.Errorf("transport.udp_framing.mode must be auto, on or off"))
+	}
+	if u.Pace < 0 || u.Pace > 1000000 {
+		errors = append(errors, fmt.Errorf("transport.udp_framing.pace must be between 0-1000000 datagrams per second"))
+	}
+	return errors
+}
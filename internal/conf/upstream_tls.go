@@ -0,0 +1,78 @@
+package conf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+)
+
+// UpstreamTLS makes the server originate TLS toward matching upstream
+// targets, so a client application speaking plaintext can reach a
+// destination that requires TLS.
+type UpstreamTLS struct {
+	Targets            []string `yaml:"targets"`              // host:port patterns, "*" wildcards allowed
+	ServerName         string   `yaml:"server_name"`          // SNI and verification name; defaults to the target host
+	ALPN               []string `yaml:"alpn"`                 // ALPN protocols offered upstream
+	CertFile           string   `yaml:"cert_file"`            // Optional client certificate
+	KeyFile            string   `yaml:"key_file"`             // Optional client certificate key
+	CAFile             string   `yaml:"ca_file"`              // Verify the upstream against this CA instead of system roots
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify"` // Skip upstream certificate verification
+
+	TLSConfig *tls.Config `yaml:"-"`
+}
+
+// Match reports whether addr (host:port) is covered by one of the targets.
+func (u *UpstreamTLS) Match(addr string) bool {
+	for _, t := range u.Targets {
+		if ok, _ := path.Match(t, addr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *UpstreamTLS) setDefaults() {}
+
+func (u *UpstreamTLS) validate() []error {
+	var errors []error
+	if len(u.Targets) == 0 {
+		errors = append(errors, fmt.Errorf("targets must not be empty"))
+	}
+	for _, t := range u.Targets {
+		if _, err := path.Match(t, ""); err != nil {
+			errors = append(errors, fmt.Errorf("invalid target pattern '%s': %v", t, err))
+		}
+	}
+
+	tlsCfg := &tls.Config{
+		ServerName:         u.ServerName,
+		NextProtos:         u.ALPN,
+		InsecureSkipVerify: u.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if (u.CertFile == "") != (u.KeyFile == "") {
+		errors = append(errors, fmt.Errorf("cert_file and key_file must be set together"))
+	} else if u.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(u.CertFile, u.KeyFile)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("failed to load client certificate: %v", err))
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if u.CAFile != "" {
+		pem, err := os.ReadFile(u.CAFile)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("failed to read ca_file: %v", err))
+		} else {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				errors = append(errors, fmt.Errorf("ca_file '%s' contains no certificates", u.CAFile))
+			}
+			tlsCfg.RootCAs = pool
+		}
+	}
+	u.TLSConfig = tlsCfg
+	return errors
+}
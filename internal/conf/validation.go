@@ -3,6 +3,7 @@ package conf
 import (
 	"fmt"
 	"net"
+	"slices"
 )
 
 func validateAddr(addr string, vPort bool) (*net.UDPAddr, error) {
@@ -24,6 +25,14 @@ func validateAddr(addr string, vPort bool) (*net.UDPAddr, error) {
 	return uAddr, nil
 }
 
+func validateReuse(reuse string) []error {
+	validReuse := []string{"", "short", "warm"}
+	if !slices.Contains(validReuse, reuse) {
+		return []error{fmt.Errorf("reuse must be one of: %v", validReuse[1:])}
+	}
+	return nil
+}
+
 // func validateMAC(mac string) (net.HardwareAddr, error) {
 // 	if mac == "" {
 // 		return nil, fmt.Errorf("MAC address is required")
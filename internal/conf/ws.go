@@ -0,0 +1,145 @@
+package conf
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// WebSocket carries the tunnel over an ordinary TCP (optionally TLS)
+// WebSocket connection instead of crafted packets, for networks where the
+// raw socket path is blocked or a CDN/reverse proxy sits in front of the
+// server.
+type WebSocket struct {
+	Path string `yaml:"path"` // HTTP path of the upgrade request
+	Host string `yaml:"host"` // Host header sent by the client, defaults to server.addr
+
+	TLS                bool   `yaml:"tls"`
+	ServerName         string `yaml:"server_name"`          // client: SNI and verification name, defaults to host
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // client
+	CertFile           string `yaml:"cert_file"`            // server: self-signed when empty
+	KeyFile            string `yaml:"key_file"`             // server
+
+	Smuxbuf   int `yaml:"smuxbuf"`
+	Streambuf int `yaml:"streambuf"`
+
+	// Server behind a reverse proxy: Bind overrides listen.addr with a
+	// loopback "host:port" or "unix:/path", and RealIP names where the
+	// client address is taken from when the peer is a trusted proxy.
+	Bind            string   `yaml:"bind"`
+	RealIP          string   `yaml:"real_ip"` // "", "x-forwarded-for" or "proxy"
+	TrustedProxies_ []string `yaml:"trusted_proxies"`
+
+	Certificate    *tls.Certificate `yaml:"-"`
+	TrustedProxies []netip.Prefix   `yaml:"-"`
+}
+
+func (w *WebSocket) setDefaults() {
+	cpus := sysCPUCount()
+
+	if w.Path == "" {
+		w.Path = "/"
+	}
+	if w.Smuxbuf == 0 {
+		w.Smuxbuf = clampInt(cpus*1024*1024, 4*1024*1024, 64*1024*1024)
+	}
+	if w.Streambuf == 0 {
+		w.Streambuf = clampInt(cpus*1024*1024, 2*1024*1024, 32*1024*1024)
+	}
+	if len(w.TrustedProxies_) == 0 {
+		w.TrustedProxies_ = []string{"127.0.0.0/8", "::1/128"}
+	}
+}
+
+func (w *WebSocket) validate() []error {
+	var errors []error
+
+	if !strings.HasPrefix(w.Path, "/") {
+		errors = append(errors, fmt.Errorf("websocket path must start with '/'"))
+	}
+	if (w.CertFile == "") != (w.KeyFile == "") {
+		errors = append(errors, fmt.Errorf("websocket cert_file and key_file must be set together"))
+	}
+	if w.CertFile != "" {
+		if !w.TLS {
+			errors = append(errors, fmt.Errorf("websocket cert_file requires tls to be enabled"))
+		}
+		cert, err := tls.LoadX509KeyPair(w.CertFile, w.KeyFile)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("failed to load websocket certificate: %v", err))
+		} else {
+			w.Certificate = &cert
+		}
+	}
+	if path, ok := strings.CutPrefix(w.Bind, "unix:"); ok {
+		if path == "" {
+			errors = append(errors, fmt.Errorf("websocket bind 'unix:' requires a socket path"))
+		}
+	} else if w.Bind != "" {
+		if _, _, err := net.SplitHostPort(w.Bind); err != nil {
+			errors = append(errors, fmt.Errorf("invalid websocket bind '%s': must be host:port or unix:/path", w.Bind))
+		}
+	}
+	switch w.RealIP {
+	case "", "x-forwarded-for", "proxy":
+	default:
+		errors = append(errors, fmt.Errorf("websocket real_ip must be one of: x-forwarded-for, proxy"))
+	}
+	w.TrustedProxies = w.TrustedProxies[:0]
+	for _, s := range w.TrustedProxies_ {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid websocket trusted_proxies entry '%s': %v", s, err))
+			continue
+		}
+		w.TrustedProxies = append(w.TrustedProxies, prefix.Masked())
+	}
+
+	if w.Smuxbuf < 1024 {
+		errors = append(errors, fmt.Errorf("websocket smuxbuf must be >= 1024 bytes"))
+	}
+	if w.Streambuf < 1024 {
+		errors = append(errors, fmt.Errorf("websocket streambuf must be >= 1024 bytes"))
+	}
+
+	return errors
+}
+
+// BindNetwork returns the network and address the server listens on, or
+// empty strings to use listen.addr.
+func (w *WebSocket) BindNetwork() (network, addr string) {
+	if path, ok := strings.CutPrefix(w.Bind, "unix:"); ok {
+		return "unix", path
+	}
+	if w.Bind != "" {
+		return "tcp", w.Bind
+	}
+	return "", ""
+}
+
+// Trusted reports whether ip belongs to a reverse proxy allowed to supply
+// the client address.
+func (w *WebSocket) Trusted(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range w.TrustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServerTLSConfig returns the listener's TLS configuration, generating a
+// self-signed certificate when none is configured.
+func (w *WebSocket) ServerTLSConfig() (*tls.Config, error) {
+	if w.Certificate != nil {
+		return &tls.Config{Certificates: []tls.Certificate{*w.Certificate}}, nil
+	}
+	cert, err := generateSelfSignedCert()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate self-signed certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
@@ -0,0 +1,159 @@
+// Package diag writes a diagnostic snapshot of a running process to a file
+// on SIGQUIT: goroutine stacks, the state the client or server registers,
+// runtime statistics and a hash of the configuration. The process keeps
+// running, so a hang can be captured as it happens and the file attached
+// to a bug report.
+package diag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// sourceTimeout bounds each Source, which may wait on a lock held by the
+// very goroutine that hangs.
+const sourceTimeout = 2 * time.Second
+
+// Source returns a value to be written to the snapshot as JSON.
+type Source func() any
+
+// Dumper writes snapshots to a directory.
+type Dumper struct {
+	dir     string
+	cfg     *conf.Conf
+	started time.Time
+
+	mu      sync.Mutex
+	names   []string
+	sources map[string]Source
+}
+
+func New(dir string, cfg *conf.Conf) *Dumper {
+	return &Dumper{dir: dir, cfg: cfg, started: time.Now(), sources: make(map[string]Source)}
+}
+
+// Add registers src to be written under name in every snapshot.
+func (d *Dumper) Add(name string, src Source) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.sources[name]; !ok {
+		d.names = append(d.names, name)
+	}
+	d.sources[name] = src
+}
+
+// Watch writes a snapshot each time the process receives SIGQUIT, until
+// ctx is done. It replaces the Go runtime's handler, which dumps the
+// goroutines to stderr and exits.
+func (d *Dumper) Watch(ctx context.Context) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGQUIT)
+	go func() {
+		defer signal.Stop(quit)
+		for {
+			select {
+			case <-quit:
+				path, err := d.Write()
+				if err != nil {
+					flog.Errorf("diagnostic dump failed: %v", err)
+					continue
+				}
+				flog.Infof("diagnostic dump written to %s", path)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Write writes a snapshot and returns the path of the file.
+func (d *Dumper) Write() (string, error) {
+	name := fmt.Sprintf("paqet-diag-%s.txt", time.Now().Format("20060102-150405.000"))
+	path := filepath.Join(d.dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create dump file: %v", err)
+	}
+	err = d.write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+func (d *Dumper) write(w io.Writer) error {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	fmt.Fprintf(w, "paqet diagnostic dump\n\n")
+	fmt.Fprintf(w, "time:        %s\n", time.Now().Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "pid:         %d\n", os.Getpid())
+	fmt.Fprintf(w, "uptime:      %s\n", time.Since(d.started).Round(time.Second))
+	fmt.Fprintf(w, "go:          %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(w, "role:        %s\n", d.cfg.Role)
+	fmt.Fprintf(w, "config hash: %s\n", d.configHash())
+	fmt.Fprintf(w, "goroutines:  %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "heap:        %d bytes in use, %d objects, %d GC cycles\n", ms.HeapInuse, ms.HeapObjects, ms.NumGC)
+
+	d.mu.Lock()
+	names := append([]string(nil), d.names...)
+	sources := make([]Source, len(names))
+	for i, n := range names {
+		sources[i] = d.sources[n]
+	}
+	d.mu.Unlock()
+	for i, n := range names {
+		fmt.Fprintf(w, "\n== %s ==\n", n)
+		b, err := json.MarshalIndent(collect(sources[i]), "", "  ")
+		if err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\n", b)
+	}
+
+	fmt.Fprintf(w, "\n== goroutines ==\n")
+	return pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// collect runs src, giving up after sourceTimeout.
+func collect(src Source) any {
+	done := make(chan any, 1)
+	go func() {
+		done <- src()
+	}()
+	select {
+	case v := <-done:
+		return v
+	case <-time.After(sourceTimeout):
+		return map[string]string{"error": fmt.Sprintf("no answer within %v, likely blocked on a lock; see the goroutines below", sourceTimeout)}
+	}
+}
+
+// configHash identifies the effective configuration with secrets redacted,
+// so that dumps can be matched to a configuration without revealing it.
+func (d *Dumper) configHash() string {
+	b, err := d.cfg.Effective(false)
+	if err != nil {
+		return "unknown (" + err.Error() + ")"
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,29 @@
+package diag
+
+import (
+	"os"
+	"paqet/internal/conf"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	d := New(t.TempDir(), &conf.Conf{Role: "client"})
+	d.Add("connections", func() any {
+		return []map[string]any{{"conn": 0, "up": true}}
+	})
+
+	path, err := d.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"config hash: ", "== connections ==", `"up": true`, "== goroutines ==", "diag.TestWrite"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("dump is missing %q", want)
+		}
+	}
+}
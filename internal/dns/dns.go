@@ -0,0 +1,234 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"paqet/internal/client"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"sync/atomic"
+	"time"
+)
+
+// maxMsg is the largest DNS message, bounded by the TCP length prefix.
+const maxMsg = 65535
+
+// Forwarder answers DNS queries on a local address by resolving them
+// through the tunnel: each query goes to the upstream resolver on its own
+// PUDP stream, or as a DoH request over a stream to the DoH server.
+type Forwarder struct {
+	client *client.Client
+	cfg    *conf.DNS
+	doh    *http.Client // nil unless the upstream is a DoH URL
+	seq    atomic.Uint64
+}
+
+func New(c *client.Client, cfg *conf.DNS) *Forwarder {
+	f := &Forwarder{client: c, cfg: cfg}
+	if cfg.DoH != nil {
+		f.doh = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return c.TCP(ctx, addr)
+			},
+			ForceAttemptHTTP2: true,
+			IdleConnTimeout:   90 * time.Second,
+		}}
+	}
+	return f
+}
+
+// Start serves dns.listen over UDP and TCP until ctx is done.
+func (f *Forwarder) Start(ctx context.Context) error {
+	pc, err := net.ListenUDP("udp", f.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to bind DNS forwarder on %s: %v", f.cfg.Listen, err)
+	}
+	ln, err := net.Listen("tcp", f.cfg.Listen.String())
+	if err != nil {
+		pc.Close()
+		return fmt.Errorf("failed to bind DNS forwarder on %s: %v", f.cfg.Listen, err)
+	}
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+		ln.Close()
+	}()
+	go f.serveUDP(ctx, pc)
+	go f.serveTCP(ctx, ln)
+	flog.Infof("DNS forwarder listening on %s -> %s", f.cfg.Listen, f.cfg.Upstream)
+	return nil
+}
+
+func (f *Forwarder) serveUDP(ctx context.Context, pc *net.UDPConn) {
+	buf := make([]byte, maxMsg)
+	for {
+		n, caddr, err := pc.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				flog.Errorf("DNS forwarder stopped reading on %s: %v", pc.LocalAddr(), err)
+			}
+			return
+		}
+		q := bytes.Clone(buf[:n])
+		go func() {
+			if r := f.answer(ctx, q); r != nil {
+				_, _ = pc.WriteToUDP(r, caddr)
+			}
+		}()
+	}
+}
+
+func (f *Forwarder) serveTCP(ctx context.Context, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				flog.Errorf("DNS forwarder stopped accepting on %s: %v", ln.Addr(), err)
+			}
+			return
+		}
+		go f.handleTCP(ctx, conn)
+	}
+}
+
+// handleTCP answers the length-prefixed queries on conn one by one, until
+// the client stays idle for 10 seconds.
+func (f *Forwarder) handleTCP(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	var l [2]byte
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return
+		}
+		q := make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, q); err != nil {
+			return
+		}
+		r := f.answer(ctx, q)
+		if r == nil {
+			return
+		}
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(r)))); err != nil {
+			return
+		}
+		if _, err := conn.Write(r); err != nil {
+			return
+		}
+	}
+}
+
+// answer resolves q through the tunnel, or returns a SERVFAIL answer when
+// that fails. It returns nil for messages too short to be queries.
+func (f *Forwarder) answer(ctx context.Context, q []byte) []byte {
+	if len(q) < 12 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(f.cfg.Timeout)*time.Second)
+	defer cancel()
+	r, err := f.exchange(ctx, q)
+	if err == nil && (len(r) < 12 || !bytes.Equal(r[:2], q[:2])) {
+		err = fmt.Errorf("malformed answer of %d bytes", len(r))
+	}
+	if err != nil {
+		flog.Debugf("DNS query %x to %s failed: %v", q[:2], f.cfg.Upstream, err)
+		return servfail(q)
+	}
+	return r
+}
+
+func (f *Forwarder) exchange(ctx context.Context, q []byte) ([]byte, error) {
+	if f.doh != nil {
+		return f.exchangeDoH(ctx, q)
+	}
+
+	// Every query gets its own stream, so answers cannot cross.
+	src := fmt.Sprintf("dns#%d", f.seq.Add(1))
+	strm, _, k, err := f.client.UDP(ctx, src, f.cfg.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer f.client.CloseUDP(k)
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = strm.SetDeadline(deadline)
+	}
+	if _, err := strm.Write(q); err != nil {
+		return nil, err
+	}
+	r := make([]byte, maxMsg)
+	n, err := strm.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	return r[:n], nil
+}
+
+// exchangeDoH sends q as an RFC 8484 POST request.
+func (f *Forwarder) exchangeDoH(ctx context.Context, q []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.cfg.DoH.String(), bytes.NewReader(q))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := f.doh.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server answered %s", resp.Status)
+	}
+	r, err := io.ReadAll(io.LimitReader(resp.Body, maxMsg+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(r) > maxMsg {
+		return nil, errors.New("DoH answer exceeds the DNS message size")
+	}
+	return r, nil
+}
+
+// servfail turns query q into a SERVFAIL answer that repeats its question.
+func servfail(q []byte) []byte {
+	end := 12
+	if binary.BigEndian.Uint16(q[4:6]) == 1 {
+		if n := questionEnd(q); n > 0 {
+			end = n
+		}
+	}
+	r := bytes.Clone(q[:end])
+	r[2] |= 0x80       // QR
+	r[3] = 0x80 | 0x02 // RA, RCODE SERVFAIL
+	clear(r[6:12])     // no answer, authority or additional records
+	if end == 12 {
+		clear(r[4:6])
+	}
+	return r
+}
+
+// questionEnd returns the offset just past the first question of q, or 0
+// if it is truncated or compressed.
+func questionEnd(q []byte) int {
+	i := 12
+	for i < len(q) {
+		l := int(q[i])
+		if l == 0 {
+			if i+5 > len(q) {
+				return 0
+			}
+			return i + 5
+		}
+		if l&0xc0 != 0 {
+			return 0
+		}
+		i += 1 + l
+	}
+	return 0
+}
@@ -0,0 +1,26 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestServfail(t *testing.T) {
+	// Query for example.com A with an EDNS OPT record.
+	q, _ := hex.DecodeString("abcd01200001000000000001" +
+		"076578616d706c6503636f6d0000010001" +
+		"0000291000000000000000")
+	r := servfail(q)
+	want, _ := hex.DecodeString("abcd81820001000000000000" +
+		"076578616d706c6503636f6d0000010001")
+	if !bytes.Equal(r, want) {
+		t.Fatalf("servfail:\n got %x\nwant %x", r, want)
+	}
+
+	// A question that cannot be parsed leaves only the header.
+	r = servfail(q[:20])
+	if len(r) != 12 || r[3] != 0x82 || r[5] != 0 {
+		t.Errorf("servfail of a truncated query: %x", r)
+	}
+}
@@ -0,0 +1,90 @@
+// Package features holds switches that can be flipped at runtime through
+// the admin API. Callers read a switch when they set up a connection or
+// stream, so flipping one never changes traffic already in flight.
+package features
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Names of the runtime switches.
+const (
+	Pooling       = "pooling"        // server: pool upstream TCP connections for new streams
+	QUICPadding   = "quic_padding"   // client: pad handshakes of new QUIC connections
+	QUICDatagrams = "quic_datagrams" // client: negotiate datagram support on new QUIC connections
+)
+
+// Flag is the state of one switch.
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Applies     string `json:"applies"` // what picks up a change: "new streams" or "new connections"
+	Enabled     bool   `json:"enabled"`
+
+	check func(on bool) error
+}
+
+type Set struct {
+	mu    sync.RWMutex
+	flags []*Flag
+}
+
+func New() *Set {
+	return &Set{}
+}
+
+// Register adds a switch. check, if not nil, can refuse a new value, e.g.
+// when enabling needs configuration that is missing.
+func (s *Set) Register(name, description, applies string, enabled bool, check func(on bool) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flags = append(s.flags, &Flag{Name: name, Description: description, Applies: applies, Enabled: enabled, check: check})
+}
+
+// Enabled reports whether the switch is on; unknown switches are off.
+func (s *Set) Enabled(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if f := s.find(name); f != nil {
+		return f.Enabled
+	}
+	return false
+}
+
+// Set flips a switch and returns its new state.
+func (s *Set) Set(name string, on bool) (Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.find(name)
+	if f == nil {
+		return Flag{}, fmt.Errorf("unknown feature %q", name)
+	}
+	if f.check != nil {
+		if err := f.check(on); err != nil {
+			return Flag{}, err
+		}
+	}
+	f.Enabled = on
+	return *f, nil
+}
+
+// List returns the state of all switches in registration order.
+func (s *Set) List() []Flag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Flag, 0, len(s.flags))
+	for _, f := range s.flags {
+		out = append(out, *f)
+	}
+	return out
+}
+
+func (s *Set) find(name string) *Flag {
+	for _, f := range s.flags {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
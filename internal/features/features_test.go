@@ -0,0 +1,36 @@
+package features
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	s := New()
+	s.Register(Pooling, "pool", "new streams", true, nil)
+	s.Register(QUICPadding, "pad", "new connections", false, func(on bool) error {
+		if on {
+			return errors.New("not configured")
+		}
+		return nil
+	})
+
+	if !s.Enabled(Pooling) || s.Enabled(QUICPadding) || s.Enabled("missing") {
+		t.Fatalf("initial states wrong: %v", s.List())
+	}
+	if f, err := s.Set(Pooling, false); err != nil || f.Enabled {
+		t.Fatalf("Set(pooling, false) = %v, %v", f, err)
+	}
+	if s.Enabled(Pooling) {
+		t.Errorf("pooling still enabled after Set")
+	}
+	if _, err := s.Set(QUICPadding, true); err == nil {
+		t.Errorf("check did not refuse enabling padding")
+	}
+	if s.Enabled(QUICPadding) {
+		t.Errorf("refused change was applied")
+	}
+	if _, err := s.Set("missing", true); err == nil {
+		t.Errorf("Set accepted an unknown feature")
+	}
+}
@@ -8,7 +8,7 @@ import (
 )
 
 func WErr(err error) error {
-	if minLevel == 0 {
+	if GetLevel() == Debug {
 		return err
 	}
 	if err == nil {
@@ -32,7 +32,8 @@ func WErr(err error) error {
 		return nil
 	}
 
-	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
 		// return NetworkTimeout
 		return nil
 	}
@@ -3,6 +3,7 @@ package flog
 import (
 	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,11 +19,30 @@ const (
 )
 
 var (
-	minLevel = Info
+	minLevel atomic.Int32 // Level, changed at runtime through the admin API
 	logCh    = make(chan string, 1024)
+	sink     atomic.Pointer[func(Record)]
 )
 
+// Record is a logged message as passed to a sink.
+type Record struct {
+	Time  time.Time
+	Level Level
+	Msg   string
+}
+
+// SetSink passes every message logged from now on to fn as well, which
+// must not block or log. A nil fn removes the sink.
+func SetSink(fn func(Record)) {
+	if fn == nil {
+		sink.Store(nil)
+		return
+	}
+	sink.Store(&fn)
+}
+
 func init() {
+	minLevel.Store(int32(Info))
 	// Start the logging goroutine immediately to prevent race conditions
 	go func() {
 		for msg := range logCh {
@@ -32,11 +52,16 @@ func init() {
 }
 
 func SetLevel(l int) {
-	minLevel = Level(l)
+	minLevel.Store(int32(l))
+}
+
+// GetLevel returns the level set by SetLevel.
+func GetLevel() Level {
+	return Level(minLevel.Load())
 }
 
 func logf(level Level, format string, args ...any) {
-	if level < minLevel || minLevel == None {
+	if min := GetLevel(); level < min || min == None {
 		return
 	}
 
@@ -49,8 +74,12 @@ func logf(level Level, format string, args ...any) {
 		}
 	}
 
-	now := time.Now().Format("2006-01-02 15:04:05.000")
-	line := fmt.Sprintf("%s [%s] %s\n", now, level.String(), fmt.Sprintf(format, args...))
+	now := time.Now()
+	msg := fmt.Sprintf(format, args...)
+	line := fmt.Sprintf("%s [%s] %s\n", now.Format("2006-01-02 15:04:05.000"), level.String(), msg)
+	if fn := sink.Load(); fn != nil {
+		(*fn)(Record{Time: now, Level: level, Msg: msg})
+	}
 
 	// Use blocking send with timeout to prevent message loss
 	// This ensures critical messages are logged even under high load
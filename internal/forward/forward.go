@@ -6,6 +6,7 @@ import (
 	"paqet/internal/client"
 	"paqet/internal/conf"
 	"paqet/internal/flog"
+	"paqet/internal/protocol"
 	"sync"
 )
 
@@ -13,15 +14,23 @@ type Forward struct {
 	client          *client.Client
 	listenAddr      string
 	targetAddr      string
+	security        *conf.ListenerSecurity // optional TLS/PROXY protocol on TCP listeners
+	reuse           protocol.Reuse
+	duplicate       bool   // carry streams on two transport connections
+	group           string // transport.groups connections to use, empty for the default ones
 	wg              sync.WaitGroup
 	streamSemaphore chan struct{} // Limits concurrent stream processing
 }
 
-func New(client *client.Client, listenAddr, targetAddr string, cfg *conf.Conf) (*Forward, error) {
+func New(client *client.Client, fwd *conf.Forward, cfg *conf.Conf) (*Forward, error) {
 	f := &Forward{
 		client:     client,
-		listenAddr: listenAddr,
-		targetAddr: targetAddr,
+		listenAddr: fwd.Listen.String(),
+		targetAddr: fwd.Target.String(),
+		security:   &fwd.ListenerSecurity,
+		reuse:      protocol.ParseReuse(fwd.Reuse),
+		duplicate:  fwd.Duplicate,
+		group:      fwd.Group,
 	}
 	
 	// Initialize semaphore for limiting concurrent connections
@@ -35,6 +44,7 @@ func New(client *client.Client, listenAddr, targetAddr string, cfg *conf.Conf) (
 
 func (f *Forward) Start(ctx context.Context, protocol string) error {
 	flog.Debugf("starting %s forwarder: %s -> %s", protocol, f.listenAddr, f.targetAddr)
+	ctx = client.WithGroup(ctx, f.group)
 	switch protocol {
 	case "tcp":
 		return f.startTCP(ctx)
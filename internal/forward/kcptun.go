@@ -0,0 +1,104 @@
+package forward
+
+import (
+	"context"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/pkg/buffer"
+	"paqet/internal/tnet"
+	"paqet/internal/tnet/kcptun"
+	"sync"
+)
+
+// Kcptun is a kcptun client: it carries every TCP connection accepted on
+// kcptun.listen to a stock kcptun server, which forwards it to its target.
+// One session is shared by all connections and redialed once it dies.
+type Kcptun struct {
+	cfg  *conf.Kcptun
+	mu   sync.Mutex
+	conn tnet.Conn
+}
+
+func NewKcptun(cfg *conf.Kcptun) *Kcptun {
+	return &Kcptun{cfg: cfg}
+}
+
+// Start listens on kcptun.listen until ctx is done.
+func (k *Kcptun) Start(ctx context.Context) error {
+	listener, err := net.ListenTCP("tcp", k.cfg.Local)
+	if err != nil {
+		flog.Errorf("failed to bind TCP socket on %s: %v", k.cfg.Local, err)
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		k.mu.Lock()
+		if k.conn != nil {
+			k.conn.Close()
+		}
+		k.mu.Unlock()
+	}()
+	flog.Infof("kcptun client listening on %s -> kcptun server %s", k.cfg.Local, k.cfg.Remote)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					flog.Errorf("failed to accept TCP connection on %s: %v", k.cfg.Local, err)
+				}
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := k.handleConn(ctx, conn); err != nil {
+					flog.Errorf("kcptun connection %s closed with error: %v", conn.RemoteAddr(), err)
+				}
+			}()
+		}
+	}()
+	return nil
+}
+
+func (k *Kcptun) handleConn(ctx context.Context, conn net.Conn) error {
+	strm, err := k.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer strm.Close()
+	flog.Infof("accepted TCP connection %s -> kcptun server %s", conn.RemoteAddr(), k.cfg.Remote)
+
+	errCh := make(chan error, 2)
+	go func() { errCh <- buffer.CopyT(conn, strm) }()
+	go func() { errCh <- buffer.CopyT(strm, conn) }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// open opens a stream on the session, dialing a new session if there is
+// none or the last one has closed.
+func (k *Kcptun) open(ctx context.Context) (tnet.Strm, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.conn != nil {
+		strm, err := k.conn.OpenStrm(ctx)
+		if err == nil {
+			return strm, nil
+		}
+		flog.Infof("kcptun session to %s lost (%v), redialing", k.cfg.Remote, err)
+		k.conn.Close()
+		k.conn = nil
+	}
+	conn, err := kcptun.Dial(k.cfg)
+	if err != nil {
+		return nil, err
+	}
+	k.conn = conn
+	return conn.OpenStrm(ctx)
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"paqet/internal/flog"
 	"paqet/internal/pkg/buffer"
+	"paqet/internal/pkg/inbound"
 )
 
 func (f *Forward) listenTCP(ctx context.Context) error {
@@ -53,6 +54,12 @@ func (f *Forward) listenTCP(ctx context.Context) error {
 					<-f.streamSemaphore
 				}
 			}()
+			conn, err := inbound.Wrap(ctx, conn, f.security)
+			if err != nil {
+				flog.Warnf("rejected TCP connection on %s: %v", f.listenAddr, err)
+				return
+			}
+			defer conn.Close()
 			if err := f.handleTCPConn(ctx, conn); err != nil {
 				flog.Errorf("TCP connection %s -> %s closed with error: %v", conn.RemoteAddr(), f.targetAddr, err)
 			} else {
@@ -63,7 +70,11 @@ func (f *Forward) listenTCP(ctx context.Context) error {
 }
 
 func (f *Forward) handleTCPConn(ctx context.Context, conn net.Conn) error {
-	strm, err := f.client.TCP(f.targetAddr)
+	open := f.client.TCPReuse
+	if f.duplicate {
+		open = f.client.TCPDup
+	}
+	strm, err := open(ctx, f.targetAddr, f.reuse)
 	if err != nil {
 		flog.Errorf("failed to establish stream for %s -> %s: %v", conn.RemoteAddr(), f.targetAddr, err)
 		return err
@@ -93,7 +104,7 @@ func (f *Forward) handleTCPConn(ctx context.Context, conn net.Conn) error {
 	select {
 	case err := <-errCh:
 		if err != nil {
-			flog.Errorf("TCP stream %d failed for %s -> %s: %v", strm.SID(), conn.RemoteAddr(), f.targetAddr, err)
+			flog.Errorf("TCP stream %s failed for %s -> %s: %v", strm.CID(), conn.RemoteAddr(), f.targetAddr, err)
 			return err
 		}
 	case <-ctx.Done():
@@ -56,7 +56,11 @@ func (f *Forward) handleUDPPacket(ctx context.Context, conn *net.UDPConn) error
 		return nil
 	}
 
-	strm, new, k, err := f.client.UDP(caddr.String(), f.targetAddr)
+	open := f.client.UDP
+	if f.duplicate {
+		open = f.client.UDPDup
+	}
+	strm, new, k, err := open(ctx, caddr.String(), f.targetAddr)
 	if err != nil {
 		flog.Errorf("failed to establish UDP stream for %s -> %s: %v", caddr, f.targetAddr, err)
 		f.client.CloseUDP(k)
@@ -69,7 +73,7 @@ func (f *Forward) handleUDPPacket(ctx context.Context, conn *net.UDPConn) error
 		return err
 	}
 	if new {
-		flog.Infof("accepted UDP connection %d for %s -> %s", strm.SID(), caddr, f.targetAddr)
+		flog.Infof("accepted UDP connection on stream %s for %s -> %s", strm.CID(), caddr, f.targetAddr)
 		go f.handleUDPStrm(ctx, k, strm, conn, caddr)
 	}
 
@@ -80,7 +84,7 @@ func (f *Forward) handleUDPStrm(ctx context.Context, k uint64, strm tnet.Strm, c
 	bufp := buffer.UPool.Get()
 	defer func() {
 		buffer.UPool.Put(bufp)
-		flog.Debugf("UDP stream %d closed for %s -> %s", strm.SID(), caddr, f.targetAddr)
+		flog.Debugf("UDP stream %s closed for %s -> %s", strm.CID(), caddr, f.targetAddr)
 		f.client.CloseUDP(k)
 	}()
 	buf := *bufp
@@ -95,7 +99,7 @@ func (f *Forward) handleUDPStrm(ctx context.Context, k uint64, strm tnet.Strm, c
 		err := CopyU(strm, conn, caddr, buf)
 		strm.SetDeadline(time.Time{})
 		if err != nil {
-			flog.Errorf("UDP stream %d failed for %s -> %s: %v", strm.SID(), caddr, f.targetAddr, err)
+			flog.Errorf("UDP stream %s failed for %s -> %s: %v", strm.CID(), caddr, f.targetAddr, err)
 			return
 		}
 	}
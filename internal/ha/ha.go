@@ -0,0 +1,261 @@
+package ha
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/handoff"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single replicated state change.
+type Event struct {
+	Op     string `json:"op"`   // OpLease or OpRelease
+	Pool   string `json:"pool"` // PoolPrefix or PoolAddr
+	Owner  string `json:"owner"`
+	Subnet string `json:"subnet,omitempty"`
+}
+
+const (
+	OpLease   = "lease"
+	OpRelease = "release"
+
+	PoolPrefix = "prefix" // IPv6 prefixes from tun.prefix_pool
+	PoolAddr   = "addr"   // tunnel addresses from tun.pool
+)
+
+// message is an Event as sent on the wire.
+type message struct {
+	Seq uint64 `json:"seq"`
+	Event
+}
+
+// session is one replication connection. The receiver opens it with a
+// random nonce that the sender mixes into every MAC, and each message
+// carries a sequence number one above the last, so captured messages cannot
+// be replayed on this connection or on any other.
+type session struct {
+	nonce []byte
+	seq   uint64
+}
+
+const nonceSize = 16
+
+// Replicator keeps a peer server's lease state in sync with ours. Local
+// changes are pushed over an outbound connection to the peer; changes from
+// the peer arrive on an inbound connection and are passed to the handler.
+// Every message is authenticated with an HMAC over the shared key.
+type Replicator struct {
+	cfg      *conf.HA
+	snapshot func() []Event // full local state, sent on every (re)connect
+	handler  func(Event)    // applies a remote event
+	takeover func()         // called when the peer's connection is lost
+	out      chan Event
+	wg       sync.WaitGroup
+}
+
+func New(cfg *conf.HA, snapshot func() []Event, handler func(Event), takeover func()) *Replicator {
+	return &Replicator{
+		cfg:      cfg,
+		snapshot: snapshot,
+		handler:  handler,
+		takeover: takeover,
+		out:      make(chan Event, 1024),
+	}
+}
+
+// Start runs the replication listener and the peer sender until ctx is done.
+func (r *Replicator) Start(ctx context.Context) error {
+	l, err := handoff.Listen("tcp", r.cfg.Listen.String())
+	if err != nil {
+		return fmt.Errorf("failed to listen for HA peer on %s: %w", r.cfg.Listen, err)
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		r.accept(ctx, l)
+	}()
+	go func() {
+		defer r.wg.Done()
+		r.send(ctx)
+	}()
+	flog.Infof("HA replication listening on %s, peer %s", r.cfg.Listen, r.cfg.Peer)
+	return nil
+}
+
+// Wait blocks until the replication goroutines have exited.
+func (r *Replicator) Wait() {
+	r.wg.Wait()
+}
+
+// Publish queues a local change for the peer. It never blocks; if the peer
+// is unreachable for long the full snapshot on reconnect covers the gap.
+func (r *Replicator) Publish(e Event) {
+	select {
+	case r.out <- e:
+	default:
+		flog.Debugf("HA replication queue full, dropping %s event for %s", e.Op, e.Owner)
+	}
+}
+
+func (r *Replicator) accept(ctx context.Context, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return // handed off to a new process
+			}
+			flog.Errorf("failed to accept HA peer connection: %v", err)
+			continue
+		}
+		go r.receive(ctx, conn)
+	}
+}
+
+func (r *Replicator) receive(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	flog.Infof("HA peer connected from %s", conn.RemoteAddr())
+
+	s := &session{nonce: make([]byte, nonceSize)}
+	if _, err := rand.Read(s.nonce); err != nil {
+		flog.Errorf("failed to generate HA session nonce: %v", err)
+		return
+	}
+	if _, err := conn.Write([]byte(hex.EncodeToString(s.nonce) + "\n")); err != nil {
+		return
+	}
+
+	synced := false
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		e, err := r.decode(s, sc.Text())
+		if err != nil {
+			flog.Errorf("rejecting HA message from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		synced = true
+		r.handler(e)
+	}
+	flog.Infof("HA peer %s disconnected", conn.RemoteAddr())
+	if synced && ctx.Err() == nil && r.takeover != nil {
+		r.takeover()
+	}
+}
+
+func (r *Replicator) send(ctx context.Context) {
+	backoff := time.Second
+	for {
+		dialer := net.Dialer{Timeout: 10 * time.Second}
+		conn, err := dialer.DialContext(ctx, "tcp", r.cfg.Peer.String())
+		if err == nil {
+			backoff = time.Second
+			err = r.stream(ctx, conn)
+			conn.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		flog.Debugf("HA peer %s unavailable: %v", r.cfg.Peer, err)
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// stream reads the session nonce from the peer and sends a full snapshot
+// followed by incremental events.
+func (r *Replicator) stream(ctx context.Context, conn net.Conn) error {
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read session nonce: %w", err)
+	}
+	nonce, err := hex.DecodeString(strings.TrimSuffix(line, "\n"))
+	if err != nil || len(nonce) != nonceSize {
+		return fmt.Errorf("malformed session nonce")
+	}
+	s := &session{nonce: nonce}
+
+	w := bufio.NewWriter(conn)
+	for _, e := range r.snapshot() {
+		if _, err := w.WriteString(r.encode(s, e)); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	flog.Infof("HA state synced to peer %s", r.cfg.Peer)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-r.out:
+			if _, err := w.WriteString(r.encode(s, e)); err != nil {
+				return err
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *Replicator) encode(s *session, e Event) string {
+	s.seq++
+	payload, _ := json.Marshal(message{Seq: s.seq, Event: e})
+	return hex.EncodeToString(r.mac(s.nonce, payload)) + " " + string(payload) + "\n"
+}
+
+func (r *Replicator) decode(s *session, line string) (Event, error) {
+	var m message
+	sum, payload, ok := strings.Cut(line, " ")
+	if !ok {
+		return m.Event, fmt.Errorf("malformed message")
+	}
+	mac, err := hex.DecodeString(sum)
+	if err != nil || !hmac.Equal(mac, r.mac(s.nonce, []byte(payload))) {
+		return m.Event, fmt.Errorf("authentication failed")
+	}
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return m.Event, err
+	}
+	if m.Seq != s.seq+1 {
+		return m.Event, fmt.Errorf("unexpected sequence number %d, want %d", m.Seq, s.seq+1)
+	}
+	s.seq = m.Seq
+	return m.Event, nil
+}
+
+func (r *Replicator) mac(nonce, payload []byte) []byte {
+	h := hmac.New(sha256.New, []byte(r.cfg.Key))
+	h.Write(nonce)
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,56 @@
+package ha
+
+import (
+	"paqet/internal/conf"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	r := New(&conf.HA{Key: "0123456789abcdef"}, nil, nil, nil)
+	e := Event{Op: OpLease, Pool: PoolPrefix, Owner: "client-1", Subnet: "2001:db8::/64"}
+	nonce := []byte("0123456789abcdef")
+
+	line := strings.TrimSuffix(r.encode(&session{nonce: nonce}, e), "\n")
+	got, err := r.decode(&session{nonce: nonce}, line)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got != e {
+		t.Errorf("decode = %+v, want %+v", got, e)
+	}
+
+	other := New(&conf.HA{Key: "fedcba9876543210"}, nil, nil, nil)
+	if _, err := other.decode(&session{nonce: nonce}, line); err == nil {
+		t.Error("expected authentication failure with a different key")
+	}
+
+	tampered := strings.Replace(line, "client-1", "client-2", 1)
+	if _, err := r.decode(&session{nonce: nonce}, tampered); err == nil {
+		t.Error("expected authentication failure for tampered payload")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	r := New(&conf.HA{Key: "0123456789abcdef"}, nil, nil, nil)
+	e := Event{Op: OpRelease, Pool: PoolAddr, Owner: "client-1"}
+
+	send := &session{nonce: []byte("0123456789abcdef")}
+	first := strings.TrimSuffix(r.encode(send, e), "\n")
+	second := strings.TrimSuffix(r.encode(send, e), "\n")
+
+	recv := &session{nonce: send.nonce}
+	if _, err := r.decode(recv, first); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, err := r.decode(recv, first); err == nil {
+		t.Error("expected a replayed message to be rejected")
+	}
+	if _, err := r.decode(recv, second); err != nil {
+		t.Errorf("decode of the next message: %v", err)
+	}
+
+	if _, err := r.decode(&session{nonce: []byte("fedcba9876543210")}, first); err == nil {
+		t.Error("expected a message from another session to be rejected")
+	}
+}
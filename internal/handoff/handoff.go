@@ -0,0 +1,296 @@
+// Package handoff replaces a running server process with a new binary
+// without dropping its tunnels. The old process execs the new one, passing
+// its listening sockets and the client flows it still serves as inherited
+// file descriptors. Once the new process is listening it tells the old one,
+// which stops taking new clients and drains the flows it has; the new
+// process leaves those flows alone until the old one exits.
+package handoff
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"paqet/internal/flog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envVar lists the inherited descriptors as name=fd pairs.
+const envVar = "PAQET_HANDOFF"
+
+// readyTimeout bounds how long the new process may take to start listening.
+const readyTimeout = 30 * time.Second
+
+const (
+	readyName = "ready" // pipe the new process writes to once it is listening
+	flowsName = "flows" // pipe carrying the old process's flows, open until it exits
+)
+
+var (
+	mu        sync.Mutex
+	inherited map[string]*os.File
+	listeners = make(map[string]net.Listener)
+)
+
+func init() {
+	inherited = make(map[string]*os.File)
+	for _, kv := range strings.Split(os.Getenv(envVar), ",") {
+		name, fd, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			continue
+		}
+		inherited[name] = os.NewFile(uintptr(n), name)
+	}
+	os.Unsetenv(envVar)
+}
+
+// Inherited reports whether this process was started by a handoff.
+func Inherited() bool {
+	return inherited[readyName] != nil
+}
+
+// Listen returns the listener for network and addr inherited from the
+// previous process, or a new one. A stale unix socket file is replaced;
+// any other file at the path is left alone and reported as an error.
+// Listeners obtained here are passed on by Exec.
+func Listen(network, addr string) (net.Listener, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	key := network + ":" + addr
+	var ln net.Listener
+	var err error
+	if f := inherited[key]; f != nil {
+		delete(inherited, key)
+		ln, err = net.FileListener(f)
+		f.Close()
+	} else {
+		if network == "unix" {
+			// A socket left behind by a previous process would make Listen fail.
+			if fi, err := os.Lstat(addr); err == nil {
+				if fi.Mode()&os.ModeSocket == 0 {
+					return nil, fmt.Errorf("%s exists and is not a socket", addr)
+				}
+				if err := os.Remove(addr); err != nil {
+					return nil, err
+				}
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		ln, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	listeners[key] = ln
+	return ln, nil
+}
+
+// Flows are the client flows, by remote address, that the previous process
+// still serves.
+type Flows struct {
+	mu   sync.Mutex
+	m    map[string]bool
+	done chan struct{}
+}
+
+// Has reports whether the previous process still serves the flow of addr.
+func (f *Flows) Has(addr string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.m[addr]
+}
+
+// Len returns the number of flows the previous process still serves.
+func (f *Flows) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.m)
+}
+
+// Done is closed once the previous process has exited.
+func (f *Flows) Done() <-chan struct{} {
+	return f.done
+}
+
+// Ready tells the previous process that this one is listening, so that it
+// starts draining, and returns the flows it keeps serving. It returns nil
+// without a handoff.
+func Ready() *Flows {
+	mu.Lock()
+	ready, flows := inherited[readyName], inherited[flowsName]
+	delete(inherited, readyName)
+	delete(inherited, flowsName)
+	for key, f := range inherited {
+		// A listener the new configuration no longer uses.
+		f.Close()
+		delete(inherited, key)
+	}
+	mu.Unlock()
+	if ready == nil || flows == nil {
+		return nil
+	}
+
+	// The list ends with an empty line. Each line after it is a flow that
+	// has ended, and EOF means the previous process is gone.
+	f := &Flows{m: make(map[string]bool), done: make(chan struct{})}
+	r := bufio.NewReader(flows)
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" || err != nil {
+			break
+		}
+		f.m[line] = true
+	}
+	_, _ = ready.Write([]byte{1})
+	ready.Close()
+	go func() {
+		defer close(f.done)
+		defer flows.Close()
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			delete(f.m, strings.TrimSpace(line))
+			f.mu.Unlock()
+		}
+	}()
+	return f
+}
+
+// Child is a process started by Exec.
+type Child struct {
+	Pid int
+
+	mu    sync.Mutex
+	flows *os.File // held open until this process exits
+}
+
+// Ended tells the child that this process no longer serves the flow of
+// addr, so that the child may take it.
+func (c *Child) Ended(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintln(c.flows, addr)
+}
+
+// Exec starts the current executable with the same arguments, passing the
+// listeners obtained from Listen and the remote addresses of flows, and
+// waits until it is listening. The caller must then close its listeners
+// and drain; the child takes over their sockets.
+func Exec(flows []string) (*Child, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyR.Close()
+	flowsR, flowsW, err := os.Pipe()
+	if err != nil {
+		readyW.Close()
+		return nil, err
+	}
+
+	files := []*os.File{readyW, flowsR}
+	names := []string{readyName, flowsName}
+	mu.Lock()
+	for key, ln := range listeners {
+		f, err := listenerFile(ln)
+		if err != nil {
+			flog.Warnf("listener %s cannot be handed off: %v", key, err)
+			continue
+		}
+		defer f.Close()
+		files = append(files, f)
+		names = append(names, key)
+	}
+	mu.Unlock()
+
+	env := make([]string, len(names))
+	for i, name := range names {
+		env[i] = fmt.Sprintf("%s=%d", name, 3+i) // ExtraFiles start at fd 3
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), envVar+"="+strings.Join(env, ","))
+	cmd.ExtraFiles = files
+	err = cmd.Start()
+	readyW.Close()
+	flowsR.Close()
+	if err != nil {
+		flowsW.Close()
+		return nil, err
+	}
+	child := &Child{Pid: cmd.Process.Pid, flows: flowsW}
+	// The child reads the list before it signals ready; flows that end
+	// meanwhile are reported after it, in order.
+	child.mu.Lock()
+	go func() {
+		defer child.mu.Unlock()
+		for _, f := range flows {
+			fmt.Fprintln(flowsW, f)
+		}
+		fmt.Fprintln(flowsW)
+	}()
+	// The child writes to the ready pipe once it is listening; the pipe
+	// closes without data if it exits first.
+	got := make(chan int, 1)
+	go func() {
+		n, _ := readyR.Read(make([]byte, 1))
+		got <- n
+	}()
+	select {
+	case n := <-got:
+		if n > 0 {
+			go cmd.Wait()
+			return child, nil
+		}
+		err = fmt.Errorf("new process exited during startup: %v", cmd.Wait())
+	case <-time.After(readyTimeout):
+		_ = cmd.Process.Kill()
+		go cmd.Wait()
+		err = fmt.Errorf("new process did not start listening within %s", readyTimeout)
+	}
+	child.mu.Lock()
+	flowsW.Close()
+	child.mu.Unlock()
+	return nil, err
+}
+
+// Release stops the listeners obtained from Listen without removing unix
+// socket files, which now belong to the new process.
+func Release() {
+	mu.Lock()
+	defer mu.Unlock()
+	for key, ln := range listeners {
+		if u, ok := ln.(*net.UnixListener); ok {
+			u.SetUnlinkOnClose(false)
+		}
+		_ = ln.Close()
+		delete(listeners, key)
+	}
+}
+
+func listenerFile(ln net.Listener) (*os.File, error) {
+	switch l := ln.(type) {
+	case *net.TCPListener:
+		return l.File()
+	case *net.UnixListener:
+		return l.File()
+	}
+	return nil, fmt.Errorf("unsupported listener type %T", ln)
+}
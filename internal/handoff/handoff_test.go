@@ -0,0 +1,70 @@
+package handoff
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+const testAddr = "127.0.0.1:0"
+
+// TestMain runs the child side of TestExec when the test binary is started
+// by Exec.
+func TestMain(m *testing.M) {
+	if Inherited() {
+		os.Exit(child())
+	}
+	os.Exit(m.Run())
+}
+
+func child() int {
+	ln, err := Listen("tcp", testAddr)
+	if err != nil {
+		return 1
+	}
+	flows := Ready()
+	if flows == nil || !flows.Has("192.0.2.1:1000") {
+		return 2
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		return 3
+	}
+	defer conn.Close()
+	// The parent reports the flow ended before it connects.
+	for deadline := time.Now().Add(5 * time.Second); flows.Has("192.0.2.1:1000"); {
+		if time.Now().After(deadline) {
+			return 4
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn.Write([]byte("ok"))
+	return 0
+}
+
+func TestExec(t *testing.T) {
+	ln, err := Listen("tcp", testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Exec([]string{"192.0.2.1:1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	Release()
+
+	c.Ended("192.0.2.1:1000")
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got, err := io.ReadAll(conn)
+	if err != nil || string(got) != "ok" {
+		t.Fatalf("child replied %q, %v", got, err)
+	}
+}
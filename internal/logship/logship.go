@@ -0,0 +1,138 @@
+// Package logship sends log records to a remote collector. Records are
+// queued as JSON lines, batched, and every batch is written to a TCP
+// connection as one zstd frame, so the collector side can be as simple as
+// `nc -lk 5140 | zstd -d`. The logger never waits for the collector: while
+// it is unreachable records queue up to a limit and are dropped beyond it.
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/metrics"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const maxBackoff = 30 * time.Second
+
+// DialFunc opens the connection batches are written to.
+type DialFunc func(ctx context.Context) (io.WriteCloser, error)
+
+// Record is one line of shipped output.
+type Record struct {
+	Time  time.Time `json:"time"`
+	Host  string    `json:"host"`
+	Level string    `json:"level"`
+	Msg   string    `json:"msg"`
+}
+
+// Shipper batches and sends records.
+type Shipper struct {
+	cfg     *conf.LogShip
+	dial    DialFunc
+	records chan []byte
+	enc     *zstd.Encoder
+
+	dropped atomic.Uint64
+	batches atomic.Uint64
+	bytes   atomic.Uint64
+}
+
+func New(cfg *conf.LogShip, dial DialFunc) *Shipper {
+	enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	return &Shipper{cfg: cfg, dial: dial, records: make(chan []byte, cfg.Queue), enc: enc}
+}
+
+// Start sends every message logged from now on until ctx is done.
+func Start(ctx context.Context, cfg *conf.LogShip, dial DialFunc) *Shipper {
+	s := New(cfg, dial)
+	flog.SetSink(s.Add)
+	go func() {
+		s.Run(ctx)
+		flog.SetSink(nil)
+	}()
+	return s
+}
+
+// Add queues r, or drops it when the queue is full.
+func (s *Shipper) Add(r flog.Record) {
+	b, err := json.Marshal(Record{Time: r.Time, Host: s.cfg.Host, Level: r.Level.String(), Msg: r.Msg})
+	if err != nil {
+		return
+	}
+	select {
+	case s.records <- append(b, '\n'):
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Run sends batches until ctx is done. A batch goes out once it holds
+// batch_kb or interval has passed since the last one; a batch the
+// collector did not take is retried with backoff, while further records
+// wait in the queue.
+func (s *Shipper) Run(ctx context.Context) {
+	var conn io.WriteCloser
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	limit := s.cfg.Batch * 1024
+	batch := make([]byte, 0, limit)
+	var frame []byte
+	t := time.NewTicker(time.Duration(s.cfg.Interval) * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-s.records:
+			batch = append(batch, r...)
+			if len(batch) < limit {
+				continue
+			}
+		case <-t.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		frame = s.enc.EncodeAll(batch, frame[:0])
+		for backoff := time.Second; ; backoff = min(2*backoff, maxBackoff) {
+			var err error
+			if conn == nil {
+				conn, err = s.dial(ctx)
+			}
+			if err == nil {
+				if _, err = conn.Write(frame); err == nil {
+					break
+				}
+				conn.Close()
+				conn = nil
+			}
+			// Not logged: the message would be shipped too and keep the
+			// queue from ever draining.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+		s.batches.Add(1)
+		s.bytes.Add(uint64(len(frame)))
+		batch = batch[:0]
+	}
+}
+
+// Collect writes the shipper's metrics for the /metrics endpoint.
+func (s *Shipper) Collect(w *metrics.Writer) {
+	w.Counter("paqet_log_batches_sent_total", "Compressed log batches sent to the collector.", s.batches.Load())
+	w.Counter("paqet_log_bytes_sent_total", "Compressed bytes of log batches sent to the collector.", s.bytes.Load())
+	w.Counter("paqet_log_records_dropped_total", "Log records dropped because the shipping queue was full.", s.dropped.Load())
+	w.Gauge("paqet_log_records_queued", "Log records waiting to be shipped.", int64(len(s.records)))
+}
@@ -0,0 +1,90 @@
+package logship
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type collector struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *collector) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(b)
+}
+
+func (c *collector) Close() error { return nil }
+
+func (c *collector) records(t *testing.T) []Record {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dec, err := zstd.NewReader(bytes.NewReader(c.buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	var rs []Record
+	sc := bufio.NewScanner(dec)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("bad record %q: %v", sc.Text(), err)
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func TestShipper(t *testing.T) {
+	cfg := &conf.LogShip{Addr: "collector:5140", Host: "edge-1", Batch: 1, Interval: 1, Queue: 100}
+	c := &collector{}
+	s := New(cfg, func(context.Context) (io.WriteCloser, error) { return c, nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	for i := 0; i < 50; i++ {
+		s.Add(flog.Record{Time: time.Now(), Level: flog.Warn, Msg: "upstream dial failed: connection refused"})
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	var rs []Record
+	for time.Now().Before(deadline) {
+		if rs = c.records(t); len(rs) == 50 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rs) != 50 {
+		t.Fatalf("collector got %d records, want 50", len(rs))
+	}
+	if rs[0].Host != "edge-1" || rs[0].Level != "WARN" {
+		t.Fatalf("record %+v not tagged with host and level", rs[0])
+	}
+	if s.batches.Load() < 2 {
+		t.Fatalf("sent %d batches, want a batch per KiB", s.batches.Load())
+	}
+}
+
+func TestShipperDropsWhenFull(t *testing.T) {
+	cfg := &conf.LogShip{Host: "edge-1", Batch: 1, Interval: 1, Queue: 10}
+	s := New(cfg, nil)
+	for i := 0; i < 15; i++ {
+		s.Add(flog.Record{Msg: "x"})
+	}
+	if got := s.dropped.Load(); got != 5 {
+		t.Fatalf("dropped %d records, want 5", got)
+	}
+}
@@ -0,0 +1,132 @@
+// Package metrics exposes counters and gauges in the Prometheus text
+// exposition format on an optional HTTP listener.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/handoff"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a monotonically increasing value.
+type Counter struct{ v atomic.Uint64 }
+
+func (c *Counter) Inc()         { c.v.Add(1) }
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+func (c *Counter) Load() uint64 { return c.v.Load() }
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ v atomic.Int64 }
+
+func (g *Gauge) Inc()        { g.v.Add(1) }
+func (g *Gauge) Dec()        { g.v.Add(-1) }
+func (g *Gauge) Load() int64 { return g.v.Load() }
+
+// Writer formats samples in the Prometheus text format. Samples of one
+// metric must be written together; HELP and TYPE are emitted before the
+// first of them.
+type Writer struct {
+	w    *bufio.Writer
+	last string
+}
+
+// Counter writes a counter sample. labels are name/value pairs.
+func (w *Writer) Counter(name, help string, v uint64, labels ...string) {
+	w.sample(name, help, "counter", strconv.FormatUint(v, 10), labels)
+}
+
+// Gauge writes a gauge sample. labels are name/value pairs.
+func (w *Writer) Gauge(name, help string, v int64, labels ...string) {
+	w.sample(name, help, "gauge", strconv.FormatInt(v, 10), labels)
+}
+
+func (w *Writer) sample(name, help, typ, value string, labels []string) {
+	if name != w.last {
+		fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		w.last = name
+	}
+	w.w.WriteString(name)
+	if len(labels) > 0 {
+		w.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.w.WriteByte(',')
+			}
+			fmt.Fprintf(w.w, `%s="%s"`, labels[i], escaper.Replace(labels[i+1]))
+		}
+		w.w.WriteByte('}')
+	}
+	w.w.WriteByte(' ')
+	w.w.WriteString(value)
+	w.w.WriteByte('\n')
+}
+
+// escaper escapes label values as the text format requires.
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// CollectFunc writes the current value of a set of metrics.
+type CollectFunc func(w *Writer)
+
+type Server struct {
+	cfg        *conf.Metrics
+	mu         sync.Mutex
+	collectors []CollectFunc
+}
+
+func New(cfg *conf.Metrics) *Server {
+	return &Server{cfg: cfg}
+}
+
+// Register adds fn to the collectors run on every scrape.
+func (s *Server) Register(fn CollectFunc) {
+	s.mu.Lock()
+	s.collectors = append(s.collectors, fn)
+	s.mu.Unlock()
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w := &Writer{w: bufio.NewWriter(rw)}
+	s.mu.Lock()
+	for _, fn := range s.collectors {
+		fn(w)
+	}
+	s.mu.Unlock()
+	if err := w.w.Flush(); err != nil {
+		flog.Debugf("metrics: failed to write response to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// Start serves GET /metrics on the configured address until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	ln, err := handoff.Listen("tcp", s.cfg.Listen.String())
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics on %s: %v", s.cfg.Listen, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s)
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			flog.Errorf("metrics endpoint stopped: %v", err)
+		}
+	}()
+	flog.Infof("metrics endpoint listening on http://%s/metrics", ln.Addr())
+	return nil
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeHTTP(t *testing.T) {
+	s := New(nil)
+	var c Counter
+	c.Add(3)
+	s.Register(func(w *Writer) {
+		w.Counter("paqet_test_total", "A test counter.", c.Load(), "kind", `a"b`)
+		w.Counter("paqet_test_total", "A test counter.", 1, "kind", "c")
+		w.Gauge("paqet_test_open", "A test gauge.", -2)
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	want := `# HELP paqet_test_total A test counter.
+# TYPE paqet_test_total counter
+paqet_test_total{kind="a\"b"} 3
+paqet_test_total{kind="c"} 1
+# HELP paqet_test_open A test gauge.
+# TYPE paqet_test_open gauge
+paqet_test_open -2
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTraffic(t *testing.T) {
+	tr := NewTraffic()
+	rw := tr.Wrap(&bytes.Buffer{}, "tcp")
+	if _, err := rw.Write([]byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	// The buffer echoes the request back, which counts as the response.
+	if _, err := io.ReadAll(rw); err != nil {
+		t.Fatal(err)
+	}
+	ssh := tr.Wrap(&bytes.Buffer{}, "tcp")
+	_, _ = ssh.Write([]byte("SSH-2.0-test\r\n"))
+
+	got := tr.Snapshot()
+	if c := got["http"]; c.Flows != 1 || c.BytesUp != 18 || c.BytesDown != 18 {
+		t.Errorf("http = %+v", c)
+	}
+	if c := got["ssh"]; c.Flows != 1 || c.BytesUp != 14 {
+		t.Errorf("ssh = %+v", c)
+	}
+	if c := got["other"]; c.Flows != 0 {
+		t.Errorf("other = %+v", c)
+	}
+	if rw := (*Traffic)(nil).Wrap(&bytes.Buffer{}, "udp"); rw == nil {
+		t.Error("nil Traffic must return the flow")
+	}
+}
+
+// copyStrm is a stream with its own copy path, which records its use.
+type copyStrm struct {
+	net.Conn
+	buf          bytes.Buffer
+	wrote, taken bool
+}
+
+func (s *copyStrm) SID() int    { return 0 }
+func (s *copyStrm) CID() string { return "" }
+
+func (s *copyStrm) WriteTo(w io.Writer) (int64, error) {
+	s.wrote = true
+	return s.buf.WriteTo(w)
+}
+
+func (s *copyStrm) ReadFrom(r io.Reader) (int64, error) {
+	s.taken = true
+	return s.buf.ReadFrom(r)
+}
+
+func TestTrackedCopy(t *testing.T) {
+	s := NewStreams()
+	inner := &copyStrm{}
+	strm := s.Track(inner, "tcp")
+
+	if _, err := io.Copy(strm, struct{ io.Reader }{strings.NewReader("upstream")}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, strm); err != nil {
+		t.Fatal(err)
+	}
+	if !inner.taken || !inner.wrote {
+		t.Errorf("copies bypassed the stream's own path: ReadFrom %v, WriteTo %v", inner.taken, inner.wrote)
+	}
+	if _, in, out := s.Totals(); in != 8 || out != 8 {
+		t.Errorf("counted %d bytes in and %d out, want 8 and 8", in, out)
+	}
+}
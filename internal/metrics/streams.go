@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"io"
+	"paqet/internal/tnet"
+	"sync"
+)
+
+// Stream kinds tracked by Streams.
+var streamKinds = []string{"tcp", "udp", "tun"}
+
+// Streams counts tunnel streams by kind and the payload bytes they carry.
+// A nil *Streams is disabled: Track returns streams unchanged so the
+// transports keep their zero-copy paths when neither metrics nor the admin
+// API are on.
+type Streams struct {
+	open     map[string]*Gauge
+	total    map[string]*Counter
+	bytesIn  Counter // read from the tunnel
+	bytesOut Counter // written to the tunnel
+}
+
+func NewStreams() *Streams {
+	s := &Streams{
+		open:  make(map[string]*Gauge),
+		total: make(map[string]*Counter),
+	}
+	for _, k := range streamKinds {
+		s.open[k] = &Gauge{}
+		s.total[k] = &Counter{}
+	}
+	return s
+}
+
+// Track counts strm as an open stream of kind until it is closed.
+func (s *Streams) Track(strm tnet.Strm, kind string) tnet.Strm {
+	if s == nil || s.open[kind] == nil {
+		return strm
+	}
+	s.open[kind].Inc()
+	s.total[kind].Inc()
+	return &trackedStrm{Strm: strm, s: s, kind: kind}
+}
+
+// Totals returns the streams open and the payload bytes read from and
+// written to the tunnel, or zeros if s is disabled.
+func (s *Streams) Totals() (open int64, bytesIn, bytesOut uint64) {
+	if s == nil {
+		return 0, 0, 0
+	}
+	for _, k := range streamKinds {
+		open += s.open[k].Load()
+	}
+	return open, s.bytesIn.Load(), s.bytesOut.Load()
+}
+
+func (s *Streams) Collect(w *Writer) {
+	for _, k := range streamKinds {
+		w.Gauge("paqet_streams_open", "Tunnel streams currently open, by type.", s.open[k].Load(), "type", k)
+	}
+	for _, k := range streamKinds {
+		w.Counter("paqet_streams_total", "Tunnel streams opened, by type.", s.total[k].Load(), "type", k)
+	}
+	w.Counter("paqet_stream_bytes_total", "Payload bytes carried on tunnel streams.", s.bytesIn.Load(), "direction", "in")
+	w.Counter("paqet_stream_bytes_total", "Payload bytes carried on tunnel streams.", s.bytesOut.Load(), "direction", "out")
+}
+
+type trackedStrm struct {
+	tnet.Strm
+	s      *Streams
+	kind   string
+	closed sync.Once
+}
+
+func (t *trackedStrm) Read(b []byte) (int, error) {
+	n, err := t.Strm.Read(b)
+	t.s.bytesIn.Add(uint64(n))
+	return n, err
+}
+
+func (t *trackedStrm) Write(b []byte) (int, error) {
+	n, err := t.Strm.Write(b)
+	t.s.bytesOut.Add(uint64(n))
+	return n, err
+}
+
+func (t *trackedStrm) WriteTo(w io.Writer) (int64, error) {
+	return tnet.WriteTo(t.Strm, w, func(n int) { t.s.bytesIn.Add(uint64(n)) })
+}
+
+func (t *trackedStrm) ReadFrom(r io.Reader) (int64, error) {
+	return tnet.ReadFrom(t.Strm, r, func(n int) { t.s.bytesOut.Add(uint64(n)) })
+}
+
+func (t *trackedStrm) Close() error {
+	t.closed.Do(func() { t.s.open[t.kind].Dec() })
+	return t.Strm.Close()
+}
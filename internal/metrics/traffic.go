@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"io"
+	"paqet/internal/pkg/sniff"
+	"sync"
+	"sync/atomic"
+)
+
+// Traffic counts relayed flows and their bytes by the protocol detected on
+// their first bytes. A nil *Traffic is disabled: Wrap returns the flow
+// unchanged.
+type Traffic struct {
+	classes map[string]*trafficClass
+}
+
+type trafficClass struct {
+	flows Counter
+	up    Counter // towards the destination
+	down  Counter // back from the destination
+}
+
+func NewTraffic() *Traffic {
+	t := &Traffic{classes: make(map[string]*trafficClass)}
+	for _, c := range sniff.Classes {
+		t.classes[c] = &trafficClass{}
+	}
+	return t
+}
+
+// Wrap counts what is written to and read from rw, the connection to the
+// destination of a flow over network. The flow is classified by the first
+// bytes seen in either direction.
+func (t *Traffic) Wrap(rw io.ReadWriter, network string) io.ReadWriter {
+	if t == nil {
+		return rw
+	}
+	return &classified{ReadWriter: rw, t: t, network: network}
+}
+
+// TrafficClass is the share of one protocol class in the relayed traffic.
+type TrafficClass struct {
+	Flows     uint64 `json:"flows"`
+	BytesUp   uint64 `json:"bytes_up"`
+	BytesDown uint64 `json:"bytes_down"`
+}
+
+// Snapshot returns the counts by class.
+func (t *Traffic) Snapshot() map[string]TrafficClass {
+	out := make(map[string]TrafficClass, len(t.classes))
+	for name, c := range t.classes {
+		out[name] = TrafficClass{Flows: c.flows.Load(), BytesUp: c.up.Load(), BytesDown: c.down.Load()}
+	}
+	return out
+}
+
+func (t *Traffic) Collect(w *Writer) {
+	for _, name := range sniff.Classes {
+		w.Counter("paqet_traffic_flows_total", "Relayed flows, by detected protocol.", t.classes[name].flows.Load(), "class", name)
+	}
+	for _, name := range sniff.Classes {
+		c := t.classes[name]
+		w.Counter("paqet_traffic_bytes_total", "Relayed payload bytes, by detected protocol.", c.up.Load(), "class", name, "direction", "up")
+		w.Counter("paqet_traffic_bytes_total", "Relayed payload bytes, by detected protocol.", c.down.Load(), "class", name, "direction", "down")
+	}
+}
+
+type classified struct {
+	io.ReadWriter
+	t       *Traffic
+	network string
+	mu      sync.Mutex // held while the first bytes are classified
+	class   atomic.Pointer[trafficClass]
+}
+
+// classOf returns the class of the flow, detecting it from b if no data
+// has been seen yet.
+func (c *classified) classOf(b []byte) *trafficClass {
+	if tc := c.class.Load(); tc != nil {
+		return tc
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tc := c.class.Load(); tc != nil {
+		return tc
+	}
+	tc := c.t.classes[sniff.Detect(c.network, b)]
+	tc.flows.Inc()
+	c.class.Store(tc)
+	return tc
+}
+
+func (c *classified) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return c.ReadWriter.Write(b)
+	}
+	tc := c.classOf(b)
+	n, err := c.ReadWriter.Write(b)
+	tc.up.Add(uint64(n))
+	return n, err
+}
+
+func (c *classified) Read(b []byte) (int, error) {
+	n, err := c.ReadWriter.Read(b)
+	if n > 0 {
+		c.classOf(b[:n]).down.Add(uint64(n))
+	}
+	return n, err
+}
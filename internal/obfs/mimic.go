@@ -0,0 +1,249 @@
+package obfs
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// TLS record content types.
+const (
+	recordChangeCipherSpec = 0x14
+	recordHandshake        = 0x16
+	recordApplicationData  = 0x17
+)
+
+// handshakeTimeout bounds how long a client holds its first packets back
+// waiting for the server's reply to its ClientHello.
+const handshakeTimeout = time.Second
+
+// maxHeld caps the packets held per flow during the handshake; the
+// transport retransmits what is dropped beyond it.
+const maxHeld = 64
+
+// tlsMimic dresses a flow up as TLS 1.3: the client opens it with a
+// ClientHello, the server answers with a ServerHello, ChangeCipherSpec and
+// what passes for its encrypted handshake, and the client completes with a
+// ChangeCipherSpec and Finished before its first packet goes out. From
+// then on every packet is an application data record. The server keeps no
+// state: it answers every ClientHello.
+type tlsMimic struct {
+	c      *Conn
+	client bool
+	sni    string
+
+	mu    sync.Mutex
+	flows map[string]*tlsFlow // client only, by server address
+}
+
+type tlsFlow struct {
+	mu   sync.Mutex
+	done bool
+	held [][]byte
+}
+
+// hold keeps frame back if the flow to addr has not completed its
+// handshake, starting the handshake if needed.
+func (m *tlsMimic) hold(frame []byte, addr net.Addr) bool {
+	if !m.client {
+		return false
+	}
+	m.mu.Lock()
+	f := m.flows[addr.String()]
+	if f == nil {
+		f = &tlsFlow{}
+		m.flows[addr.String()] = f
+	}
+	m.mu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return false
+	}
+	if f.held == nil {
+		_ = m.c.send(clientHello(m.sni), addr)
+		time.AfterFunc(handshakeTimeout, func() { m.finish(addr, false) })
+	}
+	if len(f.held) < maxHeld {
+		f.held = append(f.held, frame)
+	}
+	return true
+}
+
+// finish completes the handshake with addr, on its ServerHello or once the
+// timeout has passed, and sends the packets held back.
+func (m *tlsMimic) finish(addr net.Addr, answered bool) {
+	m.mu.Lock()
+	f := m.flows[addr.String()]
+	m.mu.Unlock()
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return
+	}
+	f.done = true
+	if answered {
+		_ = m.c.send(clientFinished(), addr)
+	}
+	for _, frame := range f.held {
+		_ = m.c.send(frame, addr)
+	}
+	f.held = nil
+}
+
+// handshake handles a received handshake record.
+func (m *tlsMimic) handshake(rec []byte, addr net.Addr) {
+	if len(rec) < 6 {
+		return
+	}
+	switch rec[5] {
+	case 1: // ClientHello
+		if !m.client {
+			_ = m.c.send(serverHello(), addr)
+		}
+	case 2: // ServerHello
+		if m.client {
+			m.finish(addr, true)
+		}
+	}
+}
+
+// record writes the header of a TLS record of typ with n bytes of content.
+func record(b []byte, typ byte, n int) {
+	b[0], b[1], b[2] = typ, 0x03, 0x03
+	binary.BigEndian.PutUint16(b[3:5], uint16(n))
+}
+
+// The cipher suites and extension contents of a current Chrome ClientHello.
+var (
+	chromeSuites = []uint16{
+		0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030,
+		0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+	}
+	chromeGroups  = []byte{0, 6, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18}
+	chromeALPN    = []byte{0, 12, 2, 'h', '2', 8, 'h', 't', 't', 'p', '/', '1', '.', '1'}
+	chromeSigAlgs = []byte{0, 16, 4, 3, 8, 4, 4, 1, 5, 3, 8, 5, 5, 1, 8, 6, 6, 1}
+)
+
+// clientHello builds a TLS 1.3 ClientHello record with the extensions of a
+// current Chrome, which also sends them in random order.
+func clientHello(sni string) []byte {
+	var exts [][]byte
+	if sni != "" {
+		name := make([]byte, 5+len(sni))
+		binary.BigEndian.PutUint16(name[0:2], uint16(3+len(sni)))
+		binary.BigEndian.PutUint16(name[3:5], uint16(len(sni)))
+		copy(name[5:], sni)
+		exts = append(exts, ext(0x0000, name))
+	}
+	keyShare := make([]byte, 2+4+32)
+	binary.BigEndian.PutUint16(keyShare[0:2], 4+32)
+	binary.BigEndian.PutUint16(keyShare[2:4], 0x001d) // x25519
+	binary.BigEndian.PutUint16(keyShare[4:6], 32)
+	fill(keyShare[6:])
+	exts = append(exts,
+		ext(0x0017, nil),                   // extended_master_secret
+		ext(0xff01, []byte{0}),             // renegotiation_info
+		ext(0x000a, chromeGroups),          // supported_groups
+		ext(0x000b, []byte{1, 0}),          // ec_point_formats
+		ext(0x0023, nil),                   // session_ticket
+		ext(0x0010, chromeALPN),            // application_layer_protocol_negotiation
+		ext(0x0005, []byte{1, 0, 0, 0, 0}), // status_request
+		ext(0x000d, chromeSigAlgs),         // signature_algorithms
+		ext(0x0012, nil),                   // signed_certificate_timestamp
+		ext(0x0033, keyShare),              // key_share
+		ext(0x002d, []byte{1, 1}),          // psk_key_exchange_modes
+		ext(0x002b, []byte{4, 3, 4, 3, 3}), // supported_versions
+		ext(0x001b, []byte{2, 0, 2}),       // compress_certificate
+	)
+	rand.Shuffle(len(exts), func(i, j int) { exts[i], exts[j] = exts[j], exts[i] })
+
+	body := []byte{0x03, 0x03} // legacy_version
+	body = append(body, random(32)...)
+	body = append(body, 32)
+	body = append(body, random(32)...) // legacy_session_id
+	body = binary.BigEndian.AppendUint16(body, uint16(2*len(chromeSuites)))
+	for _, s := range chromeSuites {
+		body = binary.BigEndian.AppendUint16(body, s)
+	}
+	body = append(body, 1, 0) // compression methods
+	var extBytes []byte
+	for _, e := range exts {
+		extBytes = append(extBytes, e...)
+	}
+	// Like Chrome, pad the hello to 512 bytes.
+	if n := 4 + len(body) + 2 + len(extBytes); n < 512 {
+		extBytes = append(extBytes, ext(0x0015, make([]byte, max(512-n-4, 0)))...)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(extBytes)))
+	body = append(body, extBytes...)
+	b := handshakeRecord(1, body)
+	b[2] = 0x01 // the first record of a connection claims TLS 1.0
+	return b
+}
+
+// serverHello builds the server's reply to a ClientHello: a ServerHello
+// choosing TLS 1.3 with x25519, a ChangeCipherSpec, and an application data
+// record the size of an encrypted certificate chain.
+func serverHello() []byte {
+	keyShare := make([]byte, 4+32)
+	binary.BigEndian.PutUint16(keyShare[0:2], 0x001d)
+	binary.BigEndian.PutUint16(keyShare[2:4], 32)
+	fill(keyShare[4:])
+	exts := append(ext(0x002b, []byte{0x03, 0x04}), ext(0x0033, keyShare)...)
+
+	body := []byte{0x03, 0x03}
+	body = append(body, random(32)...)
+	body = append(body, 32)
+	body = append(body, random(32)...)
+	body = append(body, 0x13, 0x01, 0) // TLS_AES_128_GCM_SHA256, no compression
+	body = binary.BigEndian.AppendUint16(body, uint16(len(exts)))
+	body = append(body, exts...)
+
+	b := handshakeRecord(2, body)
+	b = append(b, changeCipherSpec()...)
+	return append(b, appData(700+rand.IntN(400))...)
+}
+
+// clientFinished is the client's ChangeCipherSpec and encrypted Finished.
+func clientFinished() []byte {
+	return append(changeCipherSpec(), appData(53)...)
+}
+
+func handshakeRecord(typ byte, body []byte) []byte {
+	b := make([]byte, 5+4, 5+4+len(body))
+	record(b, recordHandshake, 4+len(body))
+	b[5] = typ
+	b[6], b[7], b[8] = byte(len(body)>>16), byte(len(body)>>8), byte(len(body))
+	return append(b, body...)
+}
+
+func changeCipherSpec() []byte {
+	return []byte{recordChangeCipherSpec, 0x03, 0x03, 0x00, 0x01, 0x01}
+}
+
+func appData(n int) []byte {
+	b := make([]byte, 5+n)
+	record(b, recordApplicationData, n)
+	fill(b[5:])
+	return b
+}
+
+func ext(typ uint16, data []byte) []byte {
+	b := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(b[0:2], typ)
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(data)))
+	return append(b, data...)
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	fill(b)
+	return b
+}
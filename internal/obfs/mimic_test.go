@@ -0,0 +1,40 @@
+package obfs
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+)
+
+// TestClientHello has crypto/tls parse the mimicked ClientHello.
+func TestClientHello(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	go func() {
+		defer b.Close()
+		b.Write(clientHello("www.example.com"))
+	}()
+
+	var hello *tls.ClientHelloInfo
+	srv := tls.Server(a, &tls.Config{
+		GetConfigForClient: func(h *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = h
+			return nil, errors.New("done")
+		},
+	})
+	srv.Handshake()
+	if hello == nil {
+		t.Fatal("crypto/tls did not parse the ClientHello")
+	}
+	if hello.ServerName != "www.example.com" {
+		t.Errorf("server name %q", hello.ServerName)
+	}
+	if !slices.Contains(hello.SupportedVersions, tls.VersionTLS13) {
+		t.Errorf("TLS 1.3 not offered: %v", hello.SupportedVersions)
+	}
+	if !slices.Equal(hello.SupportedProtos, []string{"h2", "http/1.1"}) {
+		t.Errorf("ALPN %v", hello.SupportedProtos)
+	}
+}
@@ -0,0 +1,247 @@
+// Package obfs shapes the packets of the raw-packet transports. Each packet
+// is framed with a length header masked under transport.psk and runs through a pipeline that
+// pads it to a bucketed size, may follow it with a dummy packet, and may
+// delay it by a random amount, so that neither the constant packet sizes of
+// KCP and QUIC nor their bursts show on the wire. The receiving side strips
+// the framing and drops dummy packets before the transport sees them.
+//
+// With mimic: tls the flow additionally opens with what looks like a TLS 1.3
+// handshake, and every frame travels as a TLS application data record.
+package obfs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"math/rand/v2"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/socket"
+	"sync"
+	"time"
+)
+
+const headerLen = conf.ObfsOverhead
+
+// queueLen bounds the packets waiting for their jitter delay; WriteTo blocks
+// once it is full.
+const queueLen = 1024
+
+var bufPool = sync.Pool{New: func() any { return make([]byte, 64*1024) }}
+
+type packet struct {
+	frame []byte
+	addr  net.Addr
+	due   time.Time
+}
+
+// Conn frames and shapes the packets of a socket.PacketConn.
+type Conn struct {
+	*socket.PacketConn
+	cfg *conf.Obfs
+
+	macs    *sync.Pool  // HMAC-SHA256 under transport.psk, see lengthMask
+	tls     *tlsMimic   // nil unless mimic is tls
+	queue   chan packet // packets waiting for their jitter delay, nil without jitter
+	lastDue time.Time   // due time of the last queued packet, which keeps them in order
+	mu      sync.Mutex  // guards lastDue and the order of queued packets
+}
+
+// Wrap returns pConn itself unless cfg enables obfuscation.
+func Wrap(pConn *socket.PacketConn, cfg *conf.Obfs) net.PacketConn {
+	if cfg == nil || !cfg.Enabled() {
+		return pConn
+	}
+	c := &Conn{PacketConn: pConn, cfg: cfg, macs: newMACs(cfg.Key)}
+	if cfg.MimicTLS() {
+		c.tls = &tlsMimic{c: c, client: cfg.Role == "client", sni: cfg.SNI, flows: make(map[string]*tlsFlow)}
+	}
+	if cfg.Jitter > 0 {
+		c.queue = make(chan packet, queueLen)
+		go c.sendLoop()
+	}
+	return c
+}
+
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if err := c.write(c.frame(b, len(b)), addr); err != nil {
+		return 0, err
+	}
+	if c.cfg.DummyRate > 0 && rand.Float64() < c.cfg.DummyRate {
+		_ = c.write(c.frame(nil, c.dummySize()), addr)
+	}
+	return len(b), nil
+}
+
+// write sends frame unless the TLS handshake holds it back.
+func (c *Conn) write(frame []byte, addr net.Addr) error {
+	if c.tls != nil && c.tls.hold(frame, addr) {
+		return nil
+	}
+	return c.send(frame, addr)
+}
+
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := bufPool.Get().([]byte)
+	defer bufPool.Put(buf)
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(buf)
+		if err != nil {
+			return 0, addr, err
+		}
+		frame := buf[:n]
+		if c.tls != nil {
+			if frame = c.unwrap(frame, addr); frame == nil {
+				continue
+			}
+		}
+		payload, ok := c.parse(frame)
+		if !ok || len(payload) == 0 {
+			continue // a dummy, or not ours
+		}
+		return copy(b, payload), addr, nil
+	}
+}
+
+// unwrap returns the frame in the application data record b, handling
+// handshake records and discarding what is not a record.
+func (c *Conn) unwrap(b []byte, addr net.Addr) []byte {
+	if len(b) < 5 || b[1] != 0x03 {
+		return nil
+	}
+	switch b[0] {
+	case recordApplicationData:
+		n := int(binary.BigEndian.Uint16(b[3:5]))
+		if 5+n > len(b) {
+			return nil
+		}
+		return b[5 : 5+n]
+	case recordHandshake:
+		c.tls.handshake(b, addr)
+	}
+	return nil
+}
+
+// frame returns payload behind a header, padded to the smallest bucket that
+// holds at least size bytes of payload. A frame without payload is a dummy.
+// With mimic: tls it is wrapped in an application data record.
+func (c *Conn) frame(payload []byte, size int) []byte {
+	n := headerLen + size
+	for _, b := range c.cfg.Buckets {
+		if b >= n {
+			n = b
+			break
+		}
+	}
+	if c.tls != nil {
+		r := appData(n)
+		c.writeFrame(r[5:], payload)
+		return r
+	}
+	f := make([]byte, n)
+	c.writeFrame(f, payload)
+	return f
+}
+
+// writeFrame fills f with the header, payload and random padding. The
+// header is a random nonce followed by the payload length under the nonce's
+// mask.
+func (c *Conn) writeFrame(f, payload []byte) {
+	fill(f[0:2])
+	binary.BigEndian.PutUint16(f[2:4], uint16(len(payload))^c.lengthMask(f[0:2]))
+	fill(f[headerLen+copy(f[headerLen:], payload):])
+}
+
+func newMACs(key []byte) *sync.Pool {
+	return &sync.Pool{New: func() any { return hmac.New(sha256.New, key) }}
+}
+
+// lengthMask derives the mask of the length field from the nonce, so that
+// without the key the length cannot be told apart from the random bytes
+// around it.
+func (c *Conn) lengthMask(nonce []byte) uint16 {
+	h := c.macs.Get().(hash.Hash)
+	defer c.macs.Put(h)
+	h.Reset()
+	h.Write(nonce)
+	var sum [sha256.Size]byte
+	return binary.BigEndian.Uint16(h.Sum(sum[:0]))
+}
+
+// dummySize picks the payload size of a dummy packet: one of the buckets,
+// or a size in the range of small transport packets without them.
+func (c *Conn) dummySize() int {
+	if n := len(c.cfg.Buckets); n > 0 {
+		return c.cfg.Buckets[rand.IntN(n)] - headerLen
+	}
+	return 64 + rand.IntN(448)
+}
+
+// send writes frame now, or queues it for a random delay up to the jitter.
+func (c *Conn) send(frame []byte, addr net.Addr) error {
+	if c.queue == nil {
+		_, err := c.PacketConn.WriteTo(frame, addr)
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	due := time.Now().Add(time.Duration(rand.IntN(c.cfg.Jitter*1000+1)) * time.Microsecond)
+	if due.Before(c.lastDue) {
+		due = c.lastDue
+	}
+	c.lastDue = due
+	select {
+	case c.queue <- packet{frame, addr, due}:
+		return nil
+	case <-c.Done():
+		return net.ErrClosed
+	}
+}
+
+func (c *Conn) sendLoop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		var p packet
+		select {
+		case p = <-c.queue:
+		case <-c.Done():
+			return
+		}
+		if d := time.Until(p.due); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-timer.C:
+			case <-c.Done():
+				return
+			}
+		}
+		_, _ = c.PacketConn.WriteTo(p.frame, p.addr)
+	}
+}
+
+// parse returns the payload of frame, which is empty for a dummy. ok is
+// false if frame is too short for the length in its header.
+func (c *Conn) parse(frame []byte) (payload []byte, ok bool) {
+	if len(frame) < headerLen {
+		return nil, false
+	}
+	n := int(binary.BigEndian.Uint16(frame[2:4]) ^ c.lengthMask(frame[0:2]))
+	if headerLen+n > len(frame) {
+		return nil, false
+	}
+	return frame[headerLen : headerLen+n], true
+}
+
+// fill overwrites b with random bytes, so that padding looks like the
+// encrypted payload.
+func fill(b []byte) {
+	for len(b) >= 8 {
+		binary.LittleEndian.PutUint64(b, rand.Uint64())
+		b = b[8:]
+	}
+	for i := range b {
+		b[i] = byte(rand.Uint32())
+	}
+}
@@ -0,0 +1,83 @@
+package obfs
+
+import (
+	"bytes"
+	"paqet/internal/conf"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+func TestFrame(t *testing.T) {
+	c := &Conn{cfg: &conf.Obfs{Buckets: []int{128, 512, 1024}}, macs: newMACs(testKey)}
+	tests := []struct {
+		size, want int
+	}{
+		{10, 128},
+		{124, 128},
+		{125, 512},
+		{1020, 1024},
+		{1400, 1404}, // larger than every bucket
+	}
+	for _, tt := range tests {
+		payload := bytes.Repeat([]byte{0xab}, tt.size)
+		f := c.frame(payload, len(payload))
+		if len(f) != tt.want {
+			t.Errorf("%d-byte payload framed to %d bytes, want %d", tt.size, len(f), tt.want)
+		}
+		got, ok := c.parse(f)
+		if !ok || !bytes.Equal(got, payload) {
+			t.Errorf("%d-byte payload did not survive framing", tt.size)
+		}
+	}
+}
+
+func TestDummy(t *testing.T) {
+	c := &Conn{cfg: &conf.Obfs{Buckets: []int{256}}, macs: newMACs(testKey)}
+	f := c.frame(nil, c.dummySize())
+	if len(f) != 256 {
+		t.Fatalf("dummy framed to %d bytes, want 256", len(f))
+	}
+	if got, ok := c.parse(f); !ok || len(got) != 0 {
+		t.Fatal("dummy not recognized")
+	}
+}
+
+func TestParseRejectsShort(t *testing.T) {
+	c := &Conn{cfg: &conf.Obfs{}, macs: newMACs(testKey)}
+	f := c.frame([]byte("hello"), 5)
+	if _, ok := c.parse(f[:len(f)-1]); ok {
+		t.Fatal("truncated frame accepted")
+	}
+	if _, ok := c.parse(f[:2]); ok {
+		t.Fatal("frame shorter than its header accepted")
+	}
+}
+
+func TestRecordWrapping(t *testing.T) {
+	c := &Conn{cfg: &conf.Obfs{Buckets: []int{256}}, macs: newMACs(testKey), tls: &tlsMimic{}}
+	f := c.frame([]byte("hello"), 5)
+	if len(f) != 5+256 || f[0] != recordApplicationData {
+		t.Fatalf("frame of %d bytes starting %#x, want a 261-byte application data record", len(f), f[0])
+	}
+	got, ok := c.parse(c.unwrap(f, nil))
+	if !ok || string(got) != "hello" {
+		t.Fatalf("unwrapped %q", got)
+	}
+	if c.unwrap(changeCipherSpec(), nil) != nil {
+		t.Fatal("ChangeCipherSpec taken for data")
+	}
+}
+
+func TestHeaderNeedsKey(t *testing.T) {
+	c := &Conn{cfg: &conf.Obfs{}, macs: newMACs(testKey)}
+	other := &Conn{cfg: &conf.Obfs{}, macs: newMACs([]byte("fedcba9876543210"))}
+	payload := []byte("hello")
+	for range 8 {
+		// Each frame has a 1 in 65536 chance of the other key's mask matching.
+		if got, ok := other.parse(c.frame(payload, 256)); !ok || !bytes.Equal(got, payload) {
+			return
+		}
+	}
+	t.Fatal("frames parsed without the key")
+}
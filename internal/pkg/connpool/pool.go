@@ -34,6 +34,11 @@ func (pc *poolConn) Close() error {
 	return pc.pool.put(pc)
 }
 
+// NetConn returns the pooled connection.
+func (pc *poolConn) NetConn() net.Conn {
+	return pc.Conn
+}
+
 // MarkUnusable marks the connection as unusable so it won't be returned to pool
 func (pc *poolConn) MarkUnusable() {
 	pc.unusable = true
@@ -51,8 +56,9 @@ type ConnPool struct {
 	wg          sync.WaitGroup
 }
 
-// New creates a new connection pool
-func New(maxPoolSize int, idleTimeout time.Duration, factory func(context.Context) (net.Conn, error)) (*ConnPool, error) {
+// New creates a new connection pool. Its idle cleanup stops and pending
+// connections are no longer dialed once ctx is done.
+func New(ctx context.Context, maxPoolSize int, idleTimeout time.Duration, factory func(context.Context) (net.Conn, error)) (*ConnPool, error) {
 	if maxPoolSize <= 0 {
 		maxPoolSize = 10
 	}
@@ -60,7 +66,7 @@ func New(maxPoolSize int, idleTimeout time.Duration, factory func(context.Contex
 		idleTimeout = 90 * time.Second
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	pool := &ConnPool{
 		factory:     factory,
 		conns:       make(chan *poolConn, maxPoolSize),
@@ -256,3 +262,8 @@ func (p *ConnPool) cleanupIdleConns() {
 func (p *ConnPool) Len() int {
 	return len(p.conns)
 }
+
+// Cap returns the maximum number of idle connections the pool keeps
+func (p *ConnPool) Cap() int {
+	return p.maxPoolSize
+}
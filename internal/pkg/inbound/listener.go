@@ -0,0 +1,64 @@
+// Package inbound applies the optional PROXY protocol and TLS layers to
+// connections accepted by local client listeners.
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"paqet/internal/conf"
+	"time"
+)
+
+// handshakeTimeout bounds the PROXY header and TLS handshake of a new
+// connection.
+const handshakeTimeout = 10 * time.Second
+
+// Wrap reads the PROXY header (if enabled) and completes the TLS handshake
+// (if configured) on conn. The returned conn reports the original client as
+// its RemoteAddr.
+func Wrap(ctx context.Context, conn net.Conn, cfg *conf.ListenerSecurity) (net.Conn, error) {
+	if !cfg.ProxyProtocol && cfg.TLSConfig == nil {
+		return conn, nil
+	}
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	if cfg.ProxyProtocol {
+		br := bufio.NewReader(conn)
+		src, err := readProxyHeader(br)
+		if err != nil {
+			return nil, err
+		}
+		conn = &proxiedConn{Conn: conn, r: br, remote: src}
+	}
+	if cfg.TLSConfig != nil {
+		tc := tls.Server(conn, cfg.TLSConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tc
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// proxiedConn replays bytes buffered while parsing the PROXY header and
+// reports the source address it carried.
+type proxiedConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxiedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr {
+	if c.remote == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remote
+}
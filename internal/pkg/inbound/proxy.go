@@ -0,0 +1,95 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// readProxyHeader consumes a HAProxy PROXY protocol v1 or v2 header from r
+// and returns the original source address, or nil for LOCAL/UNKNOWN headers.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	// Both signatures can be told apart by their first 6 bytes; a short v1
+	// header may be all the client sends before waiting for a reply.
+	peek, err := r.Peek(6)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY header: %v", err)
+	}
+	if bytes.Equal(peek, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	if bytes.Equal(peek, proxyV2Sig[:6]) {
+		if peek, err = r.Peek(len(proxyV2Sig)); err == nil && bytes.Equal(peek, proxyV2Sig) {
+			return readProxyV2(r)
+		}
+	}
+	return nil, fmt.Errorf("connection did not start with a PROXY header")
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	// The v1 header is at most 107 bytes including CRLF.
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PROXY v1 header: %v", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("PROXY v1 header is not terminated")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed PROXY v1 source %s:%s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 header: %v", err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY v2 version %d", hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 addresses: %v", err)
+	}
+	if hdr[12]&0x0f == 0 { // LOCAL: health check from the proxy itself
+		return nil, nil
+	}
+	switch hdr[13] >> 4 {
+	case 1: // AF_INET: src(4) dst(4) sport(2) dport(2)
+		if len(body) < 12 {
+			return nil, fmt.Errorf("short PROXY v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 2: // AF_INET6: src(16) dst(16) sport(2) dport(2)
+		if len(body) < 36 {
+			return nil, fmt.Errorf("short PROXY v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil
+}
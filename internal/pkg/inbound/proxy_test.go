@@ -0,0 +1,57 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := append([]byte{}, proxyV2Sig...)
+	v2 = append(v2, 0x21, 0x11) // v2 PROXY, AF_INET/STREAM
+	v2 = binary.BigEndian.AppendUint16(v2, 12)
+	v2 = append(v2, 198, 51, 100, 7, 10, 0, 0, 1)
+	v2 = binary.BigEndian.AppendUint16(v2, 40000)
+	v2 = binary.BigEndian.AppendUint16(v2, 1080)
+
+	local := append([]byte{}, proxyV2Sig...)
+	local = append(local, 0x20, 0x00, 0, 0)
+
+	tests := []struct {
+		name    string
+		header  []byte
+		want    string // "" for no address
+		wantErr bool
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 203.0.113.5 10.0.0.1 51234 1080\r\n"), "203.0.113.5:51234", false},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::5 2001:db8::1 51234 1080\r\n"), "[2001:db8::5]:51234", false},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v2 ipv4", v2, "198.51.100.7:40000", false},
+		{"v2 local", local, "", false},
+		{"missing", []byte("\x05\x01\x00 socks greeting"), "", true},
+		{"v1 malformed", []byte("PROXY TCP4 nope 10.0.0.1 1 2\r\n"), "", true},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(bytes.NewReader(append(tt.header, "payload"...)))
+		addr, err := readProxyHeader(r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		got := ""
+		if addr != nil {
+			got = addr.String()
+		}
+		if got != tt.want {
+			t.Errorf("%s: addr = %q, want %q", tt.name, got, tt.want)
+		}
+		if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+			t.Errorf("%s: remaining data = %q, want payload", tt.name, rest)
+		}
+	}
+}
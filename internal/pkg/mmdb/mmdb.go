@@ -0,0 +1,286 @@
+// Package mmdb reads MaxMind DB files, such as the GeoLite2 and DB-IP
+// country databases, far enough to look up the country of an address.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Reader looks addresses up in a database held in memory.
+type Reader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	data       []byte // data section
+	v4Start    uint   // node IPv4 lookups start at in an IPv6 tree
+}
+
+// Open reads the database at path.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := New(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+// New parses a database from buf, which the Reader keeps.
+func New(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("not a MaxMind DB file")
+	}
+	meta := buf[i+len(metadataMarker):]
+	v, _, err := decode(meta, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata")
+	}
+	r := &Reader{buf: buf}
+	r.nodeCount, _ = toUint(m["node_count"])
+	r.recordSize, _ = toUint(m["record_size"])
+	r.ipVersion, _ = toUint(m["ip_version"])
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, fmt.Errorf("search tree exceeds the file")
+	}
+	r.data = buf[treeSize+16 : i]
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for range 96 {
+			if node >= r.nodeCount {
+				break
+			}
+			node = r.record(node, 0)
+		}
+		r.v4Start = node
+	}
+	return r, nil
+}
+
+// Lookup returns the record for ip, or nil if the database has none.
+func (r *Reader) Lookup(ip netip.Addr) (any, error) {
+	ip = ip.Unmap()
+	node, bits := uint(0), 128
+	if ip.Is4() {
+		bits = 32
+		if r.ipVersion == 6 {
+			node = r.v4Start
+		}
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+	b := ip.AsSlice()
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		node = r.record(node, uint(b[i/8]>>(7-i%8))&1)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, fmt.Errorf("search tree ends inside a node")
+	}
+	off := node - r.nodeCount - 16
+	if off >= uint(len(r.data)) {
+		return nil, fmt.Errorf("record points past the data section")
+	}
+	v, _, err := decode(r.data, off, 0)
+	return v, err
+}
+
+// Country returns the ISO 3166 code of the country ip is located in, or
+// registered to, or "" if the database does not know.
+func (r *Reader) Country(ip netip.Addr) string {
+	v, err := r.Lookup(ip)
+	if err != nil {
+		return ""
+	}
+	m, _ := v.(map[string]any)
+	for _, k := range []string{"country", "registered_country"} {
+		if c, ok := m[k].(map[string]any); ok {
+			if code, ok := c["iso_code"].(string); ok {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// decode decodes the value at off in data and returns it with the offset
+// of the next value. depth bounds nesting, which also stops pointer loops.
+func decode(data []byte, off uint, depth int) (any, uint, error) {
+	if depth > 32 {
+		return nil, 0, fmt.Errorf("data nested too deeply")
+	}
+	next := func(n uint) ([]byte, error) {
+		if off+n > uint(len(data)) {
+			return nil, fmt.Errorf("value exceeds the data section")
+		}
+		b := data[off : off+n]
+		off += n
+		return b, nil
+	}
+	b, err := next(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	typ := uint(ctrl >> 5)
+	if typ == 1 {
+		// Pointer: the value lives elsewhere, decoding resumes after it.
+		ss, vvv := uint(ctrl>>3)&3, uint(ctrl&7)
+		b, err := next(ss + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		var p uint
+		switch ss {
+		case 0:
+			p = vvv<<8 | uint(b[0])
+		case 1:
+			p = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			p = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			p = uint(binary.BigEndian.Uint32(b))
+		}
+		v, _, err := decode(data, p, depth+1)
+		return v, off, err
+	}
+	if typ == 0 {
+		b, err := next(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := next(n)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	switch typ {
+	case 7: // map
+		m := make(map[string]any, size)
+		for range size {
+			k, n, err := decode(data, off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			v, n, err := decode(data, n, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key], off = v, n
+		}
+		return m, off, nil
+	case 11: // array
+		a := make([]any, 0, min(size, 1024))
+		for range size {
+			v, n, err := decode(data, off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, off = append(a, v), n
+		}
+		return a, off, nil
+	case 14: // boolean, held in the size
+		return size != 0, off, nil
+	case 13: // end marker
+		return nil, off, nil
+	}
+
+	b, err = next(size)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case 2:
+		return string(b), off, nil
+	case 3:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of %d bytes", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case 4:
+		return bytes.Clone(b), off, nil
+	case 5, 6, 9, 10:
+		var u uint64
+		for _, c := range b[max(0, len(b)-8):] {
+			u = u<<8 | uint64(c)
+		}
+		return u, off, nil
+	case 8:
+		var u uint32
+		for _, c := range b {
+			u = u<<8 | uint32(c)
+		}
+		return int32(u), off, nil
+	case 15:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of %d bytes", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), off, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown data type %d", typ)
+	}
+}
+
+func toUint(v any) (uint, bool) {
+	u, ok := v.(uint64)
+	return uint(u), ok
+}
@@ -0,0 +1,60 @@
+package mmdb
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func str(s string) []byte { return append([]byte{0x40 | byte(len(s))}, s...) }
+
+func uint16v(v uint16) []byte { return []byte{0xa2, byte(v >> 8), byte(v)} }
+
+func mapv(kv ...[]byte) []byte {
+	return append([]byte{0xe0 | byte(len(kv)/2)}, bytes.Join(kv, nil)...)
+}
+
+// testDB builds a one-node tree of record size 24 in which the left half of
+// the address space is in IR and the right half is unknown.
+func testDB(t *testing.T, ipVersion uint16) *Reader {
+	t.Helper()
+	const nodes = 1
+	data := mapv(str("country"), mapv(str("iso_code"), str("IR")))
+	tree := []byte{0, 0, nodes + 16, 0, 0, nodes}
+	meta := mapv(
+		str("node_count"), []byte{0xc1, nodes}, // uint32
+		str("record_size"), uint16v(24),
+		str("ip_version"), uint16v(ipVersion),
+	)
+	var buf []byte
+	buf = append(buf, tree...)
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	buf = append(buf, meta...)
+	r, err := New(buf)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return r
+}
+
+func TestCountry(t *testing.T) {
+	r := testDB(t, 4)
+	for ip, want := range map[string]string{
+		"10.1.2.3":   "IR",
+		"127.0.0.1":  "IR",
+		"200.0.0.1":  "",
+		"2001:db8::": "",
+	} {
+		if got := r.Country(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Country(%s) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestNotMMDB(t *testing.T) {
+	if _, err := New([]byte("plain text")); err == nil {
+		t.Error("parsed a file without metadata")
+	}
+}
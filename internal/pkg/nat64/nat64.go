@@ -0,0 +1,58 @@
+// Package nat64 maps IPv4 addresses into and out of a NAT64 prefix using
+// the RFC 6052 layout, so that IPv4 destinations stay reachable from
+// IPv6-only networks.
+package nat64
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// WellKnown is the RFC 6052 well-known prefix.
+var WellKnown = netip.MustParsePrefix("64:ff9b::/96")
+
+// ValidPrefix reports an error unless p can carry embedded IPv4 addresses.
+func ValidPrefix(p netip.Prefix) error {
+	if !p.Addr().Is6() || p.Addr().Is4In6() {
+		return fmt.Errorf("NAT64 prefix %s is not IPv6", p)
+	}
+	switch p.Bits() {
+	case 32, 40, 48, 56, 64, 96:
+		return nil
+	}
+	return fmt.Errorf("NAT64 prefix %s must be /32, /40, /48, /56, /64 or /96", p)
+}
+
+// Synthesize embeds v4 in prefix. Bits 64-71 are reserved and left zero, so
+// the IPv4 octets skip byte 8 for prefixes shorter than /96.
+func Synthesize(prefix netip.Prefix, v4 netip.Addr) netip.Addr {
+	a := prefix.Masked().Addr().As16()
+	b := v4.Unmap().As4()
+	i := prefix.Bits() / 8
+	for _, o := range b {
+		if i == 8 {
+			i++
+		}
+		a[i] = o
+		i++
+	}
+	return netip.AddrFrom16(a)
+}
+
+// Extract returns the IPv4 address embedded in ip if ip lies in prefix.
+func Extract(prefix netip.Prefix, ip netip.Addr) (netip.Addr, bool) {
+	if !ip.Is6() || ip.Is4In6() || !prefix.Contains(ip) {
+		return netip.Addr{}, false
+	}
+	a := ip.As16()
+	var b [4]byte
+	i := prefix.Bits() / 8
+	for n := range b {
+		if i == 8 {
+			i++
+		}
+		b[n] = a[i]
+		i++
+	}
+	return netip.AddrFrom4(b), true
+}
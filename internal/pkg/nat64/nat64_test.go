@@ -0,0 +1,52 @@
+package nat64
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestSynthesizeRFC6052(t *testing.T) {
+	// Examples from RFC 6052 section 2.4 for 192.0.2.33.
+	v4 := netip.MustParseAddr("192.0.2.33")
+	for _, c := range []struct{ prefix, want string }{
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::192.0.2.33"},
+		{"64:ff9b::/96", "64:ff9b::192.0.2.33"},
+	} {
+		p := netip.MustParsePrefix(c.prefix)
+		want := netip.MustParseAddr(c.want)
+		if got := Synthesize(p, v4); got != want {
+			t.Errorf("Synthesize(%s) = %s, want %s", p, got, want)
+		}
+		if got, ok := Extract(p, want); !ok || got != v4 {
+			t.Errorf("Extract(%s, %s) = %s, %v", p, want, got, ok)
+		}
+	}
+}
+
+func TestExtractOutsidePrefix(t *testing.T) {
+	for _, ip := range []string{"2001:db8::1", "192.0.2.33", "::ffff:192.0.2.33"} {
+		if _, ok := Extract(WellKnown, netip.MustParseAddr(ip)); ok {
+			t.Errorf("Extract(%s) matched the well-known prefix", ip)
+		}
+	}
+}
+
+func TestValidPrefix(t *testing.T) {
+	for p, ok := range map[string]bool{
+		"64:ff9b::/96":   true,
+		"2001:db8::/32":  true,
+		"2001:db8::/80":  false,
+		"10.0.0.0/8":     false,
+		"::ffff:0:0/96":  false,
+		"2001:db8::/128": false,
+	} {
+		if err := ValidPrefix(netip.MustParsePrefix(p)); (err == nil) != ok {
+			t.Errorf("ValidPrefix(%s) = %v", p, err)
+		}
+	}
+}
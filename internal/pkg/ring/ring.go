@@ -0,0 +1,43 @@
+package ring
+
+import "sync"
+
+// Ring is a fixed-size, concurrency-safe buffer that keeps the most recent
+// items pushed into it.
+type Ring[T any] struct {
+	mu    sync.Mutex
+	items []T
+	next  int
+	full  bool
+}
+
+func New[T any](size int) *Ring[T] {
+	return &Ring[T]{items: make([]T, size)}
+}
+
+// Push adds v, overwriting the oldest item once the ring is full.
+func (r *Ring[T]) Push(v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.items) == 0 {
+		return
+	}
+	r.items[r.next] = v
+	r.next++
+	if r.next == len(r.items) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Items returns a copy of the buffered items, oldest first.
+func (r *Ring[T]) Items() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]T(nil), r.items[:r.next]...)
+	}
+	out := make([]T, 0, len(r.items))
+	out = append(out, r.items[r.next:]...)
+	return append(out, r.items[:r.next]...)
+}
@@ -0,0 +1,32 @@
+package ring
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := New[int](3)
+	if got := r.Items(); len(got) != 0 {
+		t.Fatalf("empty ring returned %v", got)
+	}
+	r.Push(1)
+	r.Push(2)
+	if got := r.Items(); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("partial ring: got %v, want [1 2]", got)
+	}
+	r.Push(3)
+	r.Push(4)
+	r.Push(5)
+	if got := r.Items(); !slices.Equal(got, []int{3, 4, 5}) {
+		t.Errorf("wrapped ring: got %v, want [3 4 5]", got)
+	}
+}
+
+func TestRing_ZeroSize(t *testing.T) {
+	r := New[int](0)
+	r.Push(1)
+	if got := r.Items(); len(got) != 0 {
+		t.Errorf("zero-size ring returned %v", got)
+	}
+}
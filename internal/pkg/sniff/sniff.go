@@ -0,0 +1,108 @@
+// Package sniff guesses the application protocol of a relayed flow from
+// its first bytes. It looks at fixed headers only and never parses further
+// than that, so it is cheap enough to run on every stream, and a protocol
+// tunnelled inside another (HTTP in TLS, anything in SSH) is reported as the
+// outer one.
+package sniff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// Protocol classes reported by Detect.
+const (
+	TLS   = "tls"
+	HTTP  = "http"
+	QUIC  = "quic"
+	DNS   = "dns"
+	SSH   = "ssh"
+	Other = "other"
+)
+
+// Classes lists every class Detect returns, in a stable order.
+var Classes = []string{TLS, HTTP, QUIC, DNS, SSH, Other}
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("HEAD "), []byte("PUT "),
+	[]byte("DELETE "), []byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "),
+	[]byte("TRACE "), []byte("PRI * HTTP/2"), []byte("HTTP/1."),
+}
+
+// Detect classifies b, the first chunk seen on a flow over network ("tcp"
+// or "udp", or one of their "4" and "6" variants), in either direction.
+func Detect(network string, b []byte) string {
+	if strings.HasPrefix(network, "udp") {
+		switch {
+		case isQUIC(b):
+			return QUIC
+		case isDNS(b):
+			return DNS
+		}
+		return Other
+	}
+	switch {
+	case isTLS(b):
+		return TLS
+	case bytes.HasPrefix(b, []byte("SSH-")):
+		return SSH
+	case isHTTP(b):
+		return HTTP
+	case len(b) > 2 && int(binary.BigEndian.Uint16(b)) == len(b)-2 && isDNS(b[2:]):
+		// DNS over TCP prefixes each message with its length.
+		return DNS
+	}
+	return Other
+}
+
+// isTLS matches a handshake record header of SSL 3.0 up to TLS 1.3.
+func isTLS(b []byte) bool {
+	return len(b) >= 5 && b[0] == 0x16 && b[1] == 0x03 && b[2] <= 0x04
+}
+
+func isHTTP(b []byte) bool {
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// isQUIC matches a long header packet of QUIC v1, v2, a draft version or
+// version negotiation. Short header packets carry nothing to go by, but a
+// flow starts with a long header one.
+func isQUIC(b []byte) bool {
+	if len(b) < 7 || b[0]&0xc0 != 0xc0 {
+		return false
+	}
+	switch v := binary.BigEndian.Uint32(b[1:5]); {
+	case v == 0, v == 0x00000001, v == 0x6b3343cf:
+		return true
+	case v>>8 == 0xff0000:
+		return true
+	}
+	return false
+}
+
+// isDNS matches a message header with a standard opcode and a plausible
+// number of records for a single query or its answer.
+func isDNS(b []byte) bool {
+	if len(b) < 17 { // header and the shortest question
+		return false
+	}
+	switch opcode := b[2] >> 3 & 0x0f; opcode {
+	case 0, 1, 2, 4, 5:
+	default:
+		return false
+	}
+	if b[3]&0x40 != 0 { // the Z bit is always zero
+		return false
+	}
+	qd := binary.BigEndian.Uint16(b[4:6])
+	an := binary.BigEndian.Uint16(b[6:8])
+	ns := binary.BigEndian.Uint16(b[8:10])
+	ar := binary.BigEndian.Uint16(b[10:12])
+	return qd == 1 && an < 256 && ns < 256 && ar < 256
+}
@@ -0,0 +1,42 @@
+package sniff
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func dnsQuery() []byte {
+	b := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	b = append(b, 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1)
+	return b
+}
+
+func TestDetect(t *testing.T) {
+	quic := append([]byte{0xc3, 0, 0, 0, 1, 8}, make([]byte, 1200)...)
+	tcpDNS := binary.BigEndian.AppendUint16(nil, uint16(len(dnsQuery())))
+	tcpDNS = append(tcpDNS, dnsQuery()...)
+	for _, tc := range []struct {
+		name    string
+		network string
+		b       []byte
+		want    string
+	}{
+		{"client hello", "tcp", []byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01}, TLS},
+		{"tls application data", "tcp", []byte{0x17, 0x03, 0x03, 0x00, 0x10}, Other},
+		{"http request", "tcp", []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), HTTP},
+		{"h2c preface", "tcp", []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), HTTP},
+		{"http response", "tcp", []byte("HTTP/1.1 200 OK\r\n"), HTTP},
+		{"ssh banner", "tcp4", []byte("SSH-2.0-OpenSSH_9.6\r\n"), SSH},
+		{"dns over tcp", "tcp", tcpDNS, DNS},
+		{"dns", "udp", dnsQuery(), DNS},
+		{"dns over tcp on udp", "udp", tcpDNS, Other},
+		{"quic initial", "udp6", quic, QUIC},
+		{"quic short header", "udp", []byte{0x43, 1, 2, 3, 4, 5, 6, 7}, Other},
+		{"tls on udp", "udp", []byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01}, Other},
+		{"empty", "tcp", nil, Other},
+	} {
+		if got := Detect(tc.network, tc.b); got != tc.want {
+			t.Errorf("%s: Detect = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HelloSkew is how far a hello's timestamp may be from the server clock.
+// Nonces are remembered for twice as long, so a captured hello cannot be
+// replayed while its timestamp is still accepted.
+const HelloSkew = 60 * time.Second
+
+// ErrAuthFailed is returned when a hello or its acknowledgement does not
+// prove knowledge of transport.psk.
+var ErrAuthFailed = errors.New("authentication failed")
+
+const (
+	helloLabel = "paqet-hello\x00"
+	ackLabel   = "paqet-hello-ack\x00"
+)
+
+// NewHello returns a PHELO request proving knowledge of psk.
+func NewHello(psk []byte, clientID string, now time.Time) (*Proto, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	p := &Proto{Type: PHELO, ClientID: clientID, Nonce: nonce, Time: now.Unix()}
+	p.MAC = p.helloMAC(psk)
+	return p, nil
+}
+
+// VerifyHello checks a PHELO request against psk, the clock and the replay
+// cache, and returns the acknowledgement to send back.
+func (p *Proto) VerifyHello(psk []byte, now time.Time, seen *ReplayCache) (*Proto, error) {
+	if len(p.Nonce) != 16 {
+		return nil, fmt.Errorf("hello nonce has invalid length %d", len(p.Nonce))
+	}
+	if d := now.Sub(time.Unix(p.Time, 0)); d > HelloSkew || d < -HelloSkew {
+		return nil, fmt.Errorf("hello timestamp is %s off the server clock", d.Round(time.Second))
+	}
+	if !hmac.Equal(p.MAC, p.helloMAC(psk)) {
+		return nil, fmt.Errorf("hello %w", ErrAuthFailed)
+	}
+	if !seen.Add(p.Nonce, now) {
+		return nil, fmt.Errorf("hello nonce replayed")
+	}
+	ack := p.Reply(PHELO)
+	ack.Nonce, ack.MAC = p.Nonce, ackMAC(psk, p.Nonce)
+	return &ack, nil
+}
+
+// VerifyAck checks the server's reply to hello, so that the client knows
+// the server holds the same key.
+func (p *Proto) VerifyAck(psk []byte, hello *Proto) error {
+	if p.Type != PHELO || !hmac.Equal(p.MAC, ackMAC(psk, hello.Nonce)) {
+		return fmt.Errorf("server failed hello: %w", ErrAuthFailed)
+	}
+	return nil
+}
+
+func (p *Proto) helloMAC(psk []byte) []byte {
+	m := hmac.New(sha256.New, psk)
+	m.Write([]byte(helloLabel))
+	m.Write(p.Nonce)
+	m.Write(binary.BigEndian.AppendUint64(nil, uint64(p.Time)))
+	m.Write([]byte(p.ClientID))
+	return m.Sum(nil)
+}
+
+func ackMAC(psk, nonce []byte) []byte {
+	m := hmac.New(sha256.New, psk)
+	m.Write([]byte(ackLabel))
+	m.Write(nonce)
+	return m.Sum(nil)
+}
+
+// ReplayCache remembers hello nonces for 2×HelloSkew.
+type ReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: make(map[string]time.Time)}
+}
+
+// Add records nonce and reports whether it was new.
+func (c *ReplayCache) Add(nonce []byte, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n, exp := range c.seen {
+		if now.After(exp) {
+			delete(c.seen, n)
+		}
+	}
+	if _, ok := c.seen[string(nonce)]; ok {
+		return false
+	}
+	c.seen[string(nonce)] = now.Add(2 * HelloSkew)
+	return true
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHello(t *testing.T) {
+	psk := []byte("0123456789abcdef")
+	now := time.Now()
+	seen := NewReplayCache()
+
+	hello, err := NewHello(psk, "client-1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := hello.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got Proto
+	if err := got.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := got.VerifyHello([]byte("fedcba9876543210"), now, seen); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("hello with the wrong key: got %v, want ErrAuthFailed", err)
+	}
+	if _, err := got.VerifyHello(psk, now.Add(2*HelloSkew), seen); err == nil {
+		t.Errorf("stale hello accepted")
+	}
+	ack, err := got.VerifyHello(psk, now, seen)
+	if err != nil {
+		t.Fatalf("VerifyHello: %v", err)
+	}
+	if err := ack.VerifyAck(psk, hello); err != nil {
+		t.Errorf("VerifyAck: %v", err)
+	}
+	if err := ack.VerifyAck([]byte("fedcba9876543210"), hello); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("ack with the wrong key: got %v, want ErrAuthFailed", err)
+	}
+	if _, err := got.VerifyHello(psk, now.Add(time.Second), seen); err == nil {
+		t.Errorf("replayed hello accepted")
+	}
+
+	got.ClientID = "client-2"
+	got.Nonce = bytes.Repeat([]byte{1}, 16)
+	if _, err := got.VerifyHello(psk, now, seen); err == nil {
+		t.Errorf("tampered hello accepted")
+	}
+}
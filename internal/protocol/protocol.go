@@ -1,40 +1,153 @@
 package protocol
 
 import (
+	"bytes"
 	"encoding/gob"
+	"fmt"
 	"io"
 	"paqet/internal/conf"
 	"paqet/internal/tnet"
+	"time"
 )
 
 type PType = byte
 
 const (
-	PPING PType = 0x01
-	PPONG PType = 0x02
-	PTCPF PType = 0x03
-	PTCP  PType = 0x04
-	PUDP  PType = 0x05
-	PTUN  PType = 0x06
+	PPING   PType = 0x01
+	PPONG   PType = 0x02
+	PTCPF   PType = 0x03
+	PTCP    PType = 0x04
+	PUDP    PType = 0x05
+	PTUN    PType = 0x06
+	PPD     PType = 0x07 // IPv6 prefix delegation request/reply
+	PBIND   PType = 0x08 // binds a new transport connection to the client's state
+	PSPD    PType = 0x09 // throughput probe: server streams Size bytes back
+	PHELO   PType = 0x0a // PSK-authenticated hello, see hello.go
+	PRSV    PType = 0x0b // stream opened ahead of use; the real header follows when it is taken
+	PREV    PType = 0x0c // reverse forward: client asks the server to listen on Addr; server opens one back per accepted connection
+	PERR    PType = 0x0d // server refused the stream; Error says why
+	PTUNCFG PType = 0x0e // tunnel address request/reply, see conf.TUN.Pool
+	PFETCH  PType = 0x0f // published file request; the reply is followed by Size bytes of content
+	PBENCH  PType = 0x10 // paqet bench: the server acks, then echoes the stream, or sinks Size bytes and acks again
 )
 
+// ReserveIdle is how long the server holds a PRSV stream open waiting for
+// its real header. Clients stop handing out reserved streams well before.
+const ReserveIdle = 2 * time.Minute
+
+// Reuse hints how the server should treat the upstream connection of a
+// PTCP stream.
+type Reuse = byte
+
+const (
+	ReuseDefault Reuse = iota // follow the server's pooling policy
+	ReuseNone                 // short-lived: dial a fresh connection, never pool it
+	ReuseWarm                 // keep upstream warm: pool even if pooling is off
+)
+
+// ParseReuse maps a config value ("", "short", "warm") to a Reuse hint.
+func ParseReuse(s string) Reuse {
+	switch s {
+	case "short":
+		return ReuseNone
+	case "warm":
+		return ReuseWarm
+	}
+	return ReuseDefault
+}
+
 type Proto struct {
 	Type PType
 	Addr *tnet.Addr
 	TCPF []conf.TCPF
+	// Prefix carries the delegated IPv6 prefix in a PPD reply; empty if none.
+	Prefix string
+	// ClientID identifies the client process across reconnects and server
+	// failover so that leases follow the client rather than its address.
+	ClientID string
+	// Size is the number of bytes requested by a PSPD probe.
+	Size int
+	// CID is the client's log correlation ID for the stream.
+	CID string
+	// Reuse is the client's upstream connection reuse hint for PTCP.
+	Reuse Reuse
+	// Nonce, Time and MAC authenticate a PHELO exchange.
+	Nonce []byte
+	Time  int64
+	MAC   []byte
+	// Dup groups the legs of a stream carried on several transport
+	// connections; all legs carry the same value. Empty for ordinary streams.
+	Dup string
+	// Legs is the number of legs in the Dup group; 0 means 2.
+	Legs int
+	// Multipath is "stripe" or "duplicate" for datagram streams (PUDP,
+	// PTUN) spread over the legs, see package multipath. Empty for the
+	// ordered duplication of package dup.
+	Multipath string
+	// Error is the reason a PERR reply refuses a stream.
+	Error string
+	// Datagram asks for the payload of a PUDP or PTUN stream to be sent as
+	// QUIC datagrams where it fits, see tnet.DatagramStrm.
+	Datagram bool
+	// Offload marks a PTUN stream of length-framed packets behind a
+	// virtio-net header, see conf.TUN.Offload. Both peers must agree.
+	Offload bool
+	// Framed marks a PUDP stream whose datagrams are each preceded by a
+	// 2-byte length, see package framed.
+	Framed bool
+	// TUNAddr, MTU and Routes carry the tunnel configuration in a PTUNCFG
+	// reply: the client's address in CIDR notation, the device MTU and the
+	// networks to route into the tunnel. TUNAddr is empty if none.
+	TUNAddr string
+	MTU     int
+	Routes  []string
+	// Name is the published file a PFETCH stream asks for.
+	Name string
+	// Hash is the SHA-256 of a published file: in a PFETCH request the
+	// version the client has, in the reply the one the server sends. A
+	// reply with the hash of the request carries no content.
+	Hash []byte
+	// Resume marks a PHELO ack from a server that holds streams arriving
+	// ahead of the hello until it is verified, so a reconnecting client
+	// need not wait for the ack before opening them.
+	Resume bool
+
+	gob bool // received as gob; replies are encoded the same way
 }
 
+// Read decodes a message in either the binary format or gob, whichever
+// the peer sent.
 func (p *Proto) Read(r io.Reader) error {
-	dec := gob.NewDecoder(r)
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return err
+	}
+	if first[0] == Magic {
+		return p.readBinary(r)
+	}
 
+	dec := gob.NewDecoder(io.MultiReader(bytes.NewReader(first[:]), r))
 	err := dec.Decode(p)
 	if err != nil {
 		return err
 	}
+	p.gob = true
 	return nil
 }
 
 func (p *Proto) Write(w io.Writer) error {
+	if p.Addr != nil && len(p.Addr.Host) > 255 {
+		return fmt.Errorf("host name too long: %d bytes", len(p.Addr.Host))
+	}
+	if _, gob := w.(GobStrm); !p.gob && !gob {
+		b, err := p.appendBinary(make([]byte, 0, 64))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
 	enc := gob.NewEncoder(w)
 
 	err := enc.Encode(p)
@@ -44,3 +157,18 @@ func (p *Proto) Write(w io.Writer) error {
 
 	return nil
 }
+
+// Err returns the reason carried by a PERR reply, or nil for any other
+// message.
+func (p *Proto) Err() error {
+	if p.Type != PERR {
+		return nil
+	}
+	return fmt.Errorf("refused by server: %s", p.Error)
+}
+
+// Reply returns a message of type t encoded like p, so that peers which
+// predate the binary format can read it.
+func (p *Proto) Reply(t PType) Proto {
+	return Proto{Type: t, gob: p.gob}
+}
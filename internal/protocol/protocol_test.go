@@ -0,0 +1,177 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sample() Proto {
+	return Proto{
+		Type:      PTCP,
+		Addr:      &tnet.Addr{Host: "example.com", Port: 443},
+		TCPF:      []conf.TCPF{{PSH: true, ACK: true}, {SYN: true, NS: true}},
+		ClientID:  "0123456789abcdef",
+		Size:      1 << 20,
+		CID:       "a1b2c3",
+		Reuse:     ReuseWarm,
+		Nonce:     bytes.Repeat([]byte{7}, 16),
+		Time:      1700000000,
+		MAC:       bytes.Repeat([]byte{9}, 32),
+		Dup:       "5e1f0c2a9b3d4e6f",
+		Legs:      3,
+		Multipath: "stripe",
+		Datagram:  true,
+		Offload:   true,
+		Framed:    true,
+		Resume:    true,
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tuncfg := Proto{Type: PTUNCFG, TUNAddr: "10.0.8.5/24", MTU: 1400, Routes: []string{"10.0.9.0/24", "0.0.0.0/0"}}
+	fetch := Proto{Type: PFETCH, Name: "geoip.mmdb", Size: 4 << 20, Hash: bytes.Repeat([]byte{3}, 32)}
+	for _, p := range []Proto{sample(), {Type: PPING}, {Type: PERR, Error: "too many streams"}, tuncfg, fetch} {
+		var buf bytes.Buffer
+		if err := p.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Bytes()[0] != Magic {
+			t.Fatalf("message does not start with the magic byte")
+		}
+		buf.WriteString("payload")
+
+		var got Proto
+		if err := got.Read(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("got %+v, want %+v", got, p)
+		}
+		if rest := buf.String(); rest != "payload" {
+			t.Errorf("Read consumed stream data, %q left", rest)
+		}
+	}
+}
+
+func TestWriteExtensionsTooLong(t *testing.T) {
+	p := Proto{Type: PERR, Error: strings.Repeat("x", 1<<16)}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err == nil {
+		t.Fatal("wrote a message whose extensions overflow their length")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes of a message that failed", buf.Len())
+	}
+}
+
+func TestGobCompat(t *testing.T) {
+	// A peer that predates the binary format sends plain gob.
+	var buf bytes.Buffer
+	want := sample()
+	if err := gob.NewEncoder(&buf).Encode(&want); err != nil {
+		t.Fatal(err)
+	}
+	var got Proto
+	if err := got.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !got.gob || got.Addr.String() != want.Addr.String() || got.ClientID != want.ClientID {
+		t.Fatalf("gob message decoded as %+v", got)
+	}
+
+	// Replies to it must be gob too.
+	buf.Reset()
+	reply := got.Reply(PPONG)
+	if err := reply.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var pong Proto
+	if err := gob.NewDecoder(&buf).Decode(&pong); err != nil || pong.Type != PPONG {
+		t.Errorf("gob peer cannot read the reply: %v", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	serve := func(c net.Conn, gobOnly bool) {
+		defer c.Close()
+		var p Proto
+		if gobOnly {
+			// Old peers fail on the magic byte and close the stream.
+			if gob.NewDecoder(c).Decode(&p) != nil {
+				return
+			}
+		} else if p.Read(c) != nil {
+			return
+		}
+		reply := p.Reply(PPONG)
+		_ = reply.Write(c)
+	}
+
+	for _, gobOnly := range []bool{false, true} {
+		c1, c2 := net.Pipe()
+		go serve(c2, gobOnly)
+		if got := Negotiate(c1); got == gobOnly {
+			t.Errorf("Negotiate with gobOnly=%v returned %v", gobOnly, got)
+		}
+		c1.Close()
+	}
+}
+
+type pipeStrm struct {
+	net.Conn
+}
+
+func (pipeStrm) SID() int    { return 0 }
+func (pipeStrm) CID() string { return "" }
+
+func TestGobStrm(t *testing.T) {
+	// Streams to an old peer are marked one by one; others stay binary.
+	for _, gobOnly := range []bool{false, true} {
+		c1, c2 := net.Pipe()
+		var w tnet.Strm = pipeStrm{c1}
+		if gobOnly {
+			w = GobStrm{Strm: w}
+		}
+		want := sample()
+		go func() {
+			_ = want.Write(w)
+			c1.Close()
+		}()
+		var got Proto
+		if err := got.Read(c2); err != nil {
+			t.Fatalf("gobOnly=%v: read: %v", gobOnly, err)
+		}
+		if got.gob != gobOnly {
+			t.Errorf("gobOnly=%v: message received as gob=%v", gobOnly, got.gob)
+		}
+		c2.Close()
+	}
+}
+
+func BenchmarkProtoGob(b *testing.B) {
+	p := sample()
+	b.ReportAllocs()
+	for b.Loop() {
+		var buf bytes.Buffer
+		_ = gob.NewEncoder(&buf).Encode(&p)
+		var got Proto
+		_ = gob.NewDecoder(&buf).Decode(&got)
+	}
+}
+
+func BenchmarkProtoBinary(b *testing.B) {
+	p := sample()
+	b.ReportAllocs()
+	for b.Loop() {
+		var buf bytes.Buffer
+		_ = p.Write(&buf)
+		var got Proto
+		_ = got.Read(&buf)
+	}
+}
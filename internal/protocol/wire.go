@@ -0,0 +1,290 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+)
+
+// Binary header layout (all integers big-endian):
+//
+//	magic   1 byte  0xB0, never the first byte of a gob message
+//	version 1 byte
+//	type    1 byte
+//	port    2 bytes \ Addr; both zero when there is none
+//	hostlen 1 byte  |
+//	host    hostlen /
+//	extlen  2 bytes
+//	ext     extlen bytes of fields: tag (1 byte), uvarint length, value
+//
+// Readers skip extension tags they do not know, so fields can be added
+// without a version bump; Version changes only for incompatible layouts.
+const (
+	Magic   = 0xB0
+	Version = 1
+)
+
+// Extension field tags.
+const (
+	tagTCPF      = 1
+	tagPrefix    = 2
+	tagClientID  = 3
+	tagSize      = 4
+	tagCID       = 5
+	tagReuse     = 6
+	tagNonce     = 7
+	tagTime      = 8
+	tagMAC       = 9
+	tagDup       = 10
+	tagLegs      = 11
+	tagMultipath = 12
+	tagError     = 13
+	tagDatagram  = 14
+	tagOffload   = 15
+	tagTUNAddr   = 16
+	tagMTU       = 17
+	tagRoute     = 18 // repeated, one per route
+	tagFramed    = 19
+	tagName      = 20
+	tagHash      = 21
+	tagResume    = 22
+)
+
+// GobStrm marks a stream on a connection to a peer that predates the
+// binary format, see Negotiate. Messages written to it are encoded as gob.
+type GobStrm struct {
+	tnet.Strm
+}
+
+func (s GobStrm) WriteTo(w io.Writer) (int64, error) {
+	return tnet.WriteTo(s.Strm, w, nil)
+}
+
+func (s GobStrm) ReadFrom(r io.Reader) (int64, error) {
+	return tnet.ReadFrom(s.Strm, r, nil)
+}
+
+// Negotiate pings the peer in the binary format and reports whether it
+// answered in kind. Peers that only speak gob fail to decode the ping and
+// close the stream.
+func Negotiate(rw io.ReadWriter) bool {
+	p := Proto{Type: PPING}
+	b, _ := p.appendBinary(nil)
+	if _, err := rw.Write(b); err != nil {
+		return false
+	}
+	var reply Proto
+	return reply.Read(rw) == nil && reply.Type == PPONG && !reply.gob
+}
+
+// appendBinary appends p in the binary format. It fails when the extension
+// fields do not fit their 16-bit length.
+func (p *Proto) appendBinary(b []byte) ([]byte, error) {
+	var host string
+	var port int
+	if p.Addr != nil {
+		host, port = p.Addr.Host, p.Addr.Port
+	}
+	b = append(b, Magic, Version, p.Type)
+	b = binary.BigEndian.AppendUint16(b, uint16(port))
+	b = append(b, byte(len(host)))
+	b = append(b, host...)
+
+	extAt := len(b)
+	b = append(b, 0, 0)
+	if len(p.TCPF) > 0 {
+		v := make([]byte, 0, 2*len(p.TCPF))
+		for _, f := range p.TCPF {
+			v = binary.BigEndian.AppendUint16(v, tcpfBits(f))
+		}
+		b = appendField(b, tagTCPF, v)
+	}
+	b = appendString(b, tagPrefix, p.Prefix)
+	b = appendString(b, tagClientID, p.ClientID)
+	if p.Size != 0 {
+		b = appendField(b, tagSize, binary.AppendUvarint(nil, uint64(p.Size)))
+	}
+	b = appendString(b, tagCID, p.CID)
+	if p.Reuse != ReuseDefault {
+		b = appendField(b, tagReuse, []byte{p.Reuse})
+	}
+	if len(p.Nonce) > 0 {
+		b = appendField(b, tagNonce, p.Nonce)
+	}
+	if p.Time != 0 {
+		b = appendField(b, tagTime, binary.BigEndian.AppendUint64(nil, uint64(p.Time)))
+	}
+	if len(p.MAC) > 0 {
+		b = appendField(b, tagMAC, p.MAC)
+	}
+	b = appendString(b, tagDup, p.Dup)
+	if p.Legs != 0 {
+		b = appendField(b, tagLegs, []byte{byte(p.Legs)})
+	}
+	b = appendString(b, tagMultipath, p.Multipath)
+	b = appendString(b, tagError, p.Error)
+	if p.Datagram {
+		b = appendField(b, tagDatagram, nil)
+	}
+	if p.Offload {
+		b = appendField(b, tagOffload, nil)
+	}
+	b = appendString(b, tagTUNAddr, p.TUNAddr)
+	if p.MTU != 0 {
+		b = appendField(b, tagMTU, binary.AppendUvarint(nil, uint64(p.MTU)))
+	}
+	for _, r := range p.Routes {
+		b = appendString(b, tagRoute, r)
+	}
+	if p.Framed {
+		b = appendField(b, tagFramed, nil)
+	}
+	b = appendString(b, tagName, p.Name)
+	if len(p.Hash) > 0 {
+		b = appendField(b, tagHash, p.Hash)
+	}
+	if p.Resume {
+		b = appendField(b, tagResume, nil)
+	}
+	ext := len(b) - extAt - 2
+	if ext > math.MaxUint16 {
+		return nil, fmt.Errorf("message extensions too long: %d bytes", ext)
+	}
+	binary.BigEndian.PutUint16(b[extAt:], uint16(ext))
+	return b, nil
+}
+
+func appendField(b []byte, tag byte, v []byte) []byte {
+	b = append(b, tag)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, tag byte, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = append(b, tag)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readBinary decodes a message whose magic byte has been consumed.
+func (p *Proto) readBinary(r io.Reader) error {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[0] != Version {
+		return fmt.Errorf("unsupported protocol version %d", hdr[0])
+	}
+	*p = Proto{Type: hdr[1]}
+
+	port := binary.BigEndian.Uint16(hdr[2:4])
+	// Read the host together with the extension length that follows it.
+	rest := make([]byte, int(hdr[4])+2)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return err
+	}
+	if hostLen := int(hdr[4]); hostLen > 0 || port != 0 {
+		p.Addr = &tnet.Addr{Host: string(rest[:hostLen]), Port: int(port)}
+	}
+	extLen := int(binary.BigEndian.Uint16(rest[len(rest)-2:]))
+	if extLen == 0 {
+		return nil
+	}
+	ext := make([]byte, extLen)
+	if _, err := io.ReadFull(r, ext); err != nil {
+		return err
+	}
+	return p.decodeExt(ext)
+}
+
+func (p *Proto) decodeExt(ext []byte) error {
+	for len(ext) > 0 {
+		tag := ext[0]
+		n, k := binary.Uvarint(ext[1:])
+		if k <= 0 || uint64(len(ext)-1-k) < n {
+			return fmt.Errorf("truncated protocol field %d", tag)
+		}
+		v := ext[1+k : 1+k+int(n)]
+		ext = ext[1+k+int(n):]
+
+		switch tag {
+		case tagTCPF:
+			p.TCPF = make([]conf.TCPF, 0, len(v)/2)
+			for i := 0; i+1 < len(v); i += 2 {
+				p.TCPF = append(p.TCPF, bitsTCPF(binary.BigEndian.Uint16(v[i:])))
+			}
+		case tagPrefix:
+			p.Prefix = string(v)
+		case tagClientID:
+			p.ClientID = string(v)
+		case tagSize:
+			size, _ := binary.Uvarint(v)
+			p.Size = int(size)
+		case tagCID:
+			p.CID = string(v)
+		case tagReuse:
+			if len(v) == 1 {
+				p.Reuse = v[0]
+			}
+		case tagNonce:
+			p.Nonce = v
+		case tagTime:
+			if len(v) == 8 {
+				p.Time = int64(binary.BigEndian.Uint64(v))
+			}
+		case tagMAC:
+			p.MAC = v
+		case tagDup:
+			p.Dup = string(v)
+		case tagLegs:
+			if len(v) == 1 {
+				p.Legs = int(v[0])
+			}
+		case tagMultipath:
+			p.Multipath = string(v)
+		case tagError:
+			p.Error = string(v)
+		case tagDatagram:
+			p.Datagram = true
+		case tagOffload:
+			p.Offload = true
+		case tagTUNAddr:
+			p.TUNAddr = string(v)
+		case tagMTU:
+			mtu, _ := binary.Uvarint(v)
+			p.MTU = int(mtu)
+		case tagRoute:
+			p.Routes = append(p.Routes, string(v))
+		case tagFramed:
+			p.Framed = true
+		case tagName:
+			p.Name = string(v)
+		case tagHash:
+			p.Hash = v
+		case tagResume:
+			p.Resume = true
+		}
+	}
+	return nil
+}
+
+func tcpfBits(f conf.TCPF) uint16 {
+	var b uint16
+	for i, set := range []bool{f.FIN, f.SYN, f.RST, f.PSH, f.ACK, f.URG, f.ECE, f.CWR, f.NS} {
+		if set {
+			b |= 1 << i
+		}
+	}
+	return b
+}
+
+func bitsTCPF(b uint16) conf.TCPF {
+	on := func(i int) bool { return b&(1<<i) != 0 }
+	return conf.TCPF{FIN: on(0), SYN: on(1), RST: on(2), PSH: on(3), ACK: on(4), URG: on(5), ECE: on(6), CWR: on(7), NS: on(8)}
+}
@@ -0,0 +1,69 @@
+// Package reverse serves reverse forwards: ports the server listens on
+// whose connections are carried back to the client and dialed there.
+package reverse
+
+import (
+	"context"
+	"net"
+	"paqet/internal/client"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/pkg/buffer"
+	"paqet/internal/tnet"
+	"time"
+)
+
+// dialTimeout bounds the client-side dial of the target.
+const dialTimeout = 10 * time.Second
+
+type Reverse struct {
+	client     *client.Client
+	listen     *tnet.Addr
+	targetAddr string
+}
+
+func New(client *client.Client, r *conf.Reverse) (*Reverse, error) {
+	listen, err := tnet.NewAddr(r.Listen.String())
+	if err != nil {
+		return nil, err
+	}
+	return &Reverse{client: client, listen: listen, targetAddr: r.Target.String()}, nil
+}
+
+// Start registers the forward with the server and keeps it registered
+// until ctx ends.
+func (r *Reverse) Start(ctx context.Context) {
+	flog.Debugf("starting reverse forwarder: server %s -> %s", r.listen, r.targetAddr)
+	go r.client.Reverse(ctx, r.listen, func(strm tnet.Strm) {
+		if err := r.handle(ctx, strm); err != nil {
+			flog.Debugf("reverse stream %s closed with: %v", strm.CID(), err)
+		}
+	})
+}
+
+func (r *Reverse) handle(ctx context.Context, strm tnet.Strm) error {
+	defer strm.Close()
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", r.targetAddr)
+	if err != nil {
+		flog.Errorf("reverse forward %s: failed to connect to %s: %v", r.listen, r.targetAddr, err)
+		return err
+	}
+	defer conn.Close()
+	flog.Infof("reverse forward %s: stream %s -> %s", r.listen, strm.CID(), r.targetAddr)
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- buffer.CopyT(conn, strm)
+	}()
+	go func() {
+		errCh <- buffer.CopyT(strm, conn)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"fmt"
+	"net/netip"
+	"syscall"
+
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+)
+
+// aclControl checks every address the dialer is about to connect to for a
+// stream that asked for host. Running after name resolution means a name
+// that resolves into a denied network is refused too.
+func aclControl(acl *conf.ACL, host string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if !acl.Allow(network, host, ap.Addr(), ap.Port()) {
+			flog.Warnf("server.acl denied %s connection to %s (%s)", network, address, host)
+			return fmt.Errorf("destination %s denied by server.acl", address)
+		}
+		return nil
+	}
+}
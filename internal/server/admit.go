@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+)
+
+// refuseTimeout bounds how long a refused stream may take to send the
+// header that tells whether it waits for a reply.
+const refuseTimeout = 2 * time.Second
+
+// acquire takes a performance.max_concurrent_streams slot for a stream of
+// a client in class, waiting in the backlog when none is free. It fails
+// without waiting when the backlog is full too, unless it can displace a
+// stream of a lower class, see streamSlots.
+func (s *Server) acquire(ctx context.Context, class int) error {
+	if s.streamSlots == nil {
+		return nil
+	}
+	return s.streamSlots.acquire(ctx, class)
+}
+
+// release returns the slot taken by acquire.
+func (s *Server) release() {
+	if s.streamSlots != nil {
+		s.streamSlots.release()
+	}
+}
+
+// refuse turns strm away. Streams that wait for a reply header, such as
+// pings and prefix requests, get a PERR naming reason; streams that carry
+// data are closed without one, since their client would read it as payload.
+func (s *Server) refuse(strm tnet.Strm, reason error) {
+	var p protocol.Proto
+	_ = strm.SetReadDeadline(time.Now().Add(refuseTimeout))
+	if err := p.Read(strm); err != nil {
+		strm.Close()
+		s.streamsRefused.Inc()
+		flog.Warnf("refused stream %s from %s: %v", strm.CID(), strm.RemoteAddr(), reason)
+		return
+	}
+	s.refuseProto(strm, &p, reason)
+}
+
+// refuseProto is refuse for a stream whose header p has been read.
+func (s *Server) refuseProto(strm tnet.Strm, p *protocol.Proto, reason error) {
+	defer strm.Close()
+	s.streamsRefused.Inc()
+	flog.Warnf("refused stream %s (type %d) from %s: %v", strm.CID(), p.Type, strm.RemoteAddr(), reason)
+	switch p.Type {
+	case protocol.PPING, protocol.PPD, protocol.PTUNCFG, protocol.PREV, protocol.PHELO, protocol.PFETCH, protocol.PBENCH:
+		r := p.Reply(protocol.PERR)
+		r.Error = reason.Error()
+		_ = r.Write(strm)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+)
+
+// handleBench serves a paqet bench stream. The header is acked at once,
+// which lets the client time opening a stream. After that the stream is
+// echoed back until the client closes it, or, when p.Size is set, that
+// many bytes are read and acked so the client can time the upload.
+func (s *Server) handleBench(strm tnet.Strm, p *protocol.Proto) error {
+	if p.Size < 0 || p.Size > conf.MaxProbeBytes {
+		r := p.Reply(protocol.PERR)
+		r.Error = fmt.Sprintf("invalid bench upload size %d", p.Size)
+		_ = r.Write(strm)
+		return fmt.Errorf("%s", r.Error)
+	}
+	ack := p.Reply(protocol.PBENCH)
+	if err := ack.Write(strm); err != nil {
+		return err
+	}
+	if p.Size == 0 {
+		n, err := io.Copy(strm, strm)
+		flog.Debugf("echoed %d bytes on bench stream %s", n, strm.CID())
+		return err
+	}
+	if n, err := io.CopyN(io.Discard, strm, int64(p.Size)); err != nil {
+		return fmt.Errorf("received %d of %d bench bytes: %w", n, p.Size, err)
+	}
+	flog.Debugf("received %d byte bench upload on stream %s", p.Size, strm.CID())
+	return ack.Write(strm)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"paqet/internal/flog"
+	"paqet/internal/handoff"
+)
+
+// decoyDialTimeout bounds the connection to the decoy, so a prober is not
+// left on a half-open socket much longer than a real server would leave it.
+const decoyDialTimeout = 5 * time.Second
+
+// serveDecoy listens on the listen port with the kernel's TCP stack and
+// relays every connection accepted there to network.gate.decoy. Clients
+// never complete a kernel handshake, so whoever connects is a browser or a
+// prober, and both find the decoy's web server where the tunnel is.
+func (s *Server) serveDecoy(ctx context.Context) error {
+	ln, err := handoff.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Listen.Addr.Port))
+	if err != nil {
+		return fmt.Errorf("could not listen for decoy connections: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	flog.Infof("relaying TCP connections on :%d to decoy %s", s.cfg.Listen.Addr.Port, s.cfg.Network.Gate.Decoy)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.relayDecoy(ctx, c)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) relayDecoy(ctx context.Context, c net.Conn) {
+	defer c.Close()
+	d := net.Dialer{Timeout: decoyDialTimeout}
+	up, err := d.DialContext(ctx, "tcp", s.cfg.Network.Gate.Decoy.String())
+	if err != nil {
+		flog.Warnf("failed to reach decoy %s for %s: %v", s.cfg.Network.Gate.Decoy, c.RemoteAddr(), err)
+		return
+	}
+	defer up.Close()
+	flog.Debugf("relaying %s to decoy %s", c.RemoteAddr(), s.cfg.Network.Gate.Decoy)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(up, c)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(c, up)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+)
+
+// destStats aggregates, per destination host, the packet loss seen by a
+// sample of the TCP streams relayed to it: on the tunnel connection that
+// carried the stream, in the server's sending direction, and on the
+// upstream connection to the destination. Loss on the tunnel alone points
+// at the path to the client, retransmissions upstream at the destination
+// or the path to it. A nil *destStats samples nothing.
+type destStats struct {
+	cfg  conf.DestStats
+	seen atomic.Uint64 // TCP streams relayed, sampled or not
+
+	mu    sync.Mutex
+	dests map[string]*DestState
+}
+
+// DestState is the aggregate for one destination on the admin API.
+type DestState struct {
+	Host     string    `json:"host"`
+	Streams  uint64    `json:"streams"` // sampled streams
+	LastSeen time.Time `json:"last_seen"`
+
+	// The tunnel and upstream figures are left out, rather than reported
+	// as 0, while no sampled stream could count them: the tunnel's with
+	// KCP, the upstream's off Linux.
+	TunnelSent uint64   `json:"tunnel_packets_sent,omitempty"`
+	TunnelLost uint64   `json:"tunnel_packets_lost,omitempty"`
+	TunnelLoss *float64 `json:"tunnel_loss,omitempty"`
+
+	UpstreamSent    uint64   `json:"upstream_segments_sent,omitempty"`
+	UpstreamRetrans uint64   `json:"upstream_retransmits,omitempty"`
+	UpstreamLoss    *float64 `json:"upstream_loss,omitempty"`
+	UpstreamRTTMs   float64  `json:"upstream_rtt_ms,omitempty"` // mean over the sampled streams
+
+	tunnelCounted   bool
+	upstreamCounted bool
+	rttSum          time.Duration
+	rttSamples      int
+}
+
+func newDestStats(cfg conf.DestStats) *destStats {
+	return &destStats{cfg: cfg, dests: make(map[string]*DestState)}
+}
+
+// destSample measures one stream. A nil *destSample measures nothing.
+type destSample struct {
+	d    *destStats
+	host string
+
+	conn            tnet.LossCounter // nil unless the transport counts loss
+	sent, lost      uint64
+	upstream        tcpCounts
+	upstreamCounted bool
+}
+
+// sample picks 1 in dest_stats.sample streams to host over conn.
+func (d *destStats) sample(conn tnet.Conn, host string) *destSample {
+	if d == nil || d.seen.Add(1)%uint64(d.cfg.Sample) != 0 {
+		return nil
+	}
+	s := &destSample{d: d, host: host}
+	if lc, ok := conn.(tnet.LossCounter); ok {
+		s.conn = lc
+		s.sent, s.lost = lc.LossCounts()
+	}
+	return s
+}
+
+// begin reads the counters of the upstream connection, which may have
+// carried other streams before if it came from a pool.
+func (s *destSample) begin(up net.Conn) {
+	if s == nil {
+		return
+	}
+	s.upstream, s.upstreamCounted = readTCPCounts(up)
+}
+
+// end takes the counters of both connections again and adds what changed
+// while the stream was open to its destination.
+func (s *destSample) end(up net.Conn) {
+	if s == nil {
+		return
+	}
+	var sent, lost uint64
+	if s.conn != nil {
+		nowSent, nowLost := s.conn.LossCounts()
+		sent, lost = delta(nowSent, s.sent), delta(nowLost, s.lost)
+	}
+	var upstream tcpCounts
+	upstreamOK := false
+	if s.upstreamCounted {
+		if now, ok := readTCPCounts(up); ok {
+			upstream = tcpCounts{segsOut: delta(now.segsOut, s.upstream.segsOut), retrans: delta(now.retrans, s.upstream.retrans), rtt: now.rtt}
+			upstreamOK = true
+		}
+	}
+
+	d := s.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st := d.dests[s.host]
+	if st == nil {
+		if len(d.dests) >= d.cfg.Max {
+			d.evict()
+		}
+		st = &DestState{Host: s.host}
+		d.dests[s.host] = st
+	}
+	st.Streams++
+	st.LastSeen = time.Now()
+	if s.conn != nil {
+		st.tunnelCounted = true
+		st.TunnelSent += sent
+		st.TunnelLost += lost
+	}
+	if upstreamOK {
+		st.upstreamCounted = true
+		st.UpstreamSent += upstream.segsOut
+		st.UpstreamRetrans += upstream.retrans
+		if upstream.rtt > 0 {
+			st.rttSum += upstream.rtt
+			st.rttSamples++
+		}
+	}
+}
+
+// evict drops the least recently seen destination. d.mu is held.
+func (d *destStats) evict() {
+	var oldest *DestState
+	for _, st := range d.dests {
+		if oldest == nil || st.LastSeen.Before(oldest.LastSeen) {
+			oldest = st
+		}
+	}
+	if oldest != nil {
+		delete(d.dests, oldest.Host)
+	}
+}
+
+// List returns the destinations, most sampled first.
+func (d *destStats) List() []DestState {
+	d.mu.Lock()
+	out := make([]DestState, 0, len(d.dests))
+	for _, st := range d.dests {
+		out = append(out, *st)
+	}
+	d.mu.Unlock()
+	for i := range out {
+		st := &out[i]
+		if st.tunnelCounted {
+			loss := ratio(st.TunnelLost, st.TunnelSent)
+			st.TunnelLoss = &loss
+		}
+		if st.upstreamCounted {
+			loss := ratio(st.UpstreamRetrans, st.UpstreamSent)
+			st.UpstreamLoss = &loss
+		}
+		if st.rttSamples > 0 {
+			st.UpstreamRTTMs = float64((st.rttSum / time.Duration(st.rttSamples)).Microseconds()) / 1000
+		}
+	}
+	slices.SortFunc(out, func(a, b DestState) int {
+		if c := cmp.Compare(b.Streams, a.Streams); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Host, b.Host)
+	})
+	return out
+}
+
+// delta returns now - then, or 0 for counters that went down.
+func delta(now, then uint64) uint64 {
+	if now < then {
+		return 0
+	}
+	return now - then
+}
+
+func ratio(n, of uint64) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) / float64(of)
+}
+
+// Destinations serves GET /destinations.
+func (s *Server) Destinations(_ *http.Request) (any, error) {
+	if s.dests == nil {
+		return nil, fmt.Errorf("dest_stats is not enabled")
+	}
+	return s.dests.List(), nil
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+
+	"paqet/internal/conf"
+)
+
+// ConnState is an accepted transport connection in a diagnostic dump.
+type ConnState struct {
+	Remote   string `json:"remote"`
+	Authed   bool   `json:"authed"`
+	Class    string `json:"class,omitempty"` // priority class, once authed
+	Streams  int    `json:"streams"`
+	Draining bool   `json:"draining,omitempty"`
+}
+
+// Connections returns every accepted transport connection.
+func (s *Server) Connections() any {
+	conns := []ConnState{}
+	s.conns.Range(func(k, addr any) bool {
+		c := ConnState{Remote: addr.(string)}
+		if v, ok := s.authed.Load(k); ok {
+			c.Authed, c.Class = true, conf.PriorityName(v.(int))
+		}
+		if n, ok := k.(interface{ NumStreams() int }); ok {
+			c.Streams = n.NumStreams()
+		}
+		_, c.Draining = s.draining.Load(c.Remote)
+		conns = append(conns, c)
+		return true
+	})
+	slices.SortFunc(conns, func(a, b ConnState) int {
+		return cmp.Compare(a.Remote, b.Remote)
+	})
+	return conns
+}
+
+// Pools returns the state of the upstream connection pools and the stream
+// slots.
+func (s *Server) Pools() any {
+	type pool struct {
+		Idle int `json:"idle"`
+		Cap  int `json:"cap"`
+	}
+	pools := make(map[string]pool)
+	s.connPoolsMu.RLock()
+	for addr, p := range s.connPools {
+		pools[addr] = pool{Idle: p.Len(), Cap: p.Cap()}
+	}
+	s.connPoolsMu.RUnlock()
+
+	s.dupMu.Lock()
+	dups := len(s.dups)
+	s.dupMu.Unlock()
+	s.reverseMu.Lock()
+	reverses := len(s.reverses)
+	s.reverseMu.Unlock()
+
+	out := map[string]any{
+		"upstream":          pools,
+		"multi_leg_groups":  dups,
+		"reverse_listeners": reverses,
+	}
+	if s.streamSlots != nil {
+		waiting, displaced := s.streamSlots.stats()
+		s.streamSlots.mu.Lock()
+		free := s.streamSlots.free
+		s.streamSlots.mu.Unlock()
+		out["stream_slots"] = map[string]any{
+			"size":      s.streamSlots.size,
+			"free":      free,
+			"waiting":   waiting,
+			"displaced": displaced,
+		}
+	}
+	return out
+}
+
+// Traffic serves the relayed flows and bytes by detected protocol.
+func (s *Server) Traffic(_ *http.Request) (any, error) {
+	return s.traffic.Snapshot(), nil
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"paqet/internal/flog"
+)
+
+// maxDialFailures bounds the negative cache; expired entries are swept
+// when it fills up.
+const maxDialFailures = 10000
+
+// dialFailures remembers upstream dials that failed recently, so a client
+// application retrying a dead destination in a loop is answered at once
+// instead of tying up a handler until the dial times out again.
+type dialFailures struct {
+	ttl time.Duration
+
+	mu sync.Mutex
+	m  map[string]dialFailure
+}
+
+type dialFailure struct {
+	err   error
+	until time.Time
+}
+
+func newDialFailures(ttl time.Duration) *dialFailures {
+	return &dialFailures{ttl: ttl, m: make(map[string]dialFailure)}
+}
+
+// check returns the cached failure for key, if still fresh.
+func (d *dialFailures) check(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.m[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(f.until) {
+		delete(d.m, key)
+		return nil
+	}
+	return f.err
+}
+
+func (d *dialFailures) record(key string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if len(d.m) >= maxDialFailures {
+		for k, f := range d.m {
+			if now.After(f.until) {
+				delete(d.m, k)
+			}
+		}
+		if len(d.m) >= maxDialFailures {
+			return
+		}
+	}
+	d.m[key] = dialFailure{err: err, until: now.Add(d.ttl)}
+}
+
+func (d *dialFailures) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.m)
+}
+
+// dial connects to an upstream target, directly or through
+// server.egress_proxy, answering from the negative cache
+// when the last attempt to reach it failed within
+// performance.dial_failure_ttl, and waiting for a slot when
+// performance.max_dials_per_target dials to it are in flight.
+func (s *Server) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	key := network + "/" + addr
+	if s.dialFailures != nil {
+		if err := s.dialFailures.check(key); err != nil {
+			s.dialsCached.Inc()
+			return nil, fmt.Errorf("not dialing %s, it failed recently: %w", addr, err)
+		}
+	}
+	if s.dialSlots != nil {
+		release, err := s.dialSlots.acquire(ctx, key)
+		if err != nil {
+			s.dialsThrottled.Inc()
+			return nil, fmt.Errorf("not dialing %s: %w", addr, err)
+		}
+		defer release()
+	}
+	var conn net.Conn
+	var err error
+	if s.cfg.Server.EgressProxy != nil {
+		conn, err = s.dialProxy(ctx, network, addr)
+	} else {
+		conn, err = s.dialer(addr).DialContext(ctx, network, addr)
+	}
+	// A dial cut short by the stream going away says nothing about the target.
+	if err != nil && ctx.Err() == nil && s.dialFailures != nil {
+		s.dialFailures.record(key, err)
+		flog.Debugf("caching failed dial to %s for %s", addr, s.dialFailures.ttl)
+	}
+	return conn, err
+}
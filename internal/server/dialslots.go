@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// dialSlots limits the upstream dials in flight to each target, so that a
+// burst of streams to one slow host waits in that host's queue instead of
+// tying up the stream slots every other target needs.
+type dialSlots struct {
+	limit int // dials in flight per target
+	queue int // dials waiting per target, beyond which they are refused
+
+	mu      sync.Mutex
+	targets map[string]*targetSlots
+}
+
+type targetSlots struct {
+	sem     chan struct{}
+	waiting int
+	users   int // holders and waiters; the entry goes when none are left
+}
+
+func newDialSlots(limit, queue int) *dialSlots {
+	return &dialSlots{limit: limit, queue: max(queue, 0), targets: make(map[string]*targetSlots)}
+}
+
+// acquire takes a dial slot for key, waiting in its queue while all are
+// taken. It fails without waiting when the queue is full too.
+func (d *dialSlots) acquire(ctx context.Context, key string) (release func(), err error) {
+	d.mu.Lock()
+	t := d.targets[key]
+	if t == nil {
+		t = &targetSlots{sem: make(chan struct{}, d.limit)}
+		d.targets[key] = t
+	}
+	select {
+	case t.sem <- struct{}{}:
+		t.users++
+		d.mu.Unlock()
+		return func() { d.release(key, t) }, nil
+	default:
+	}
+	if t.waiting >= d.queue {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("%d dials to %s are in flight and %d are queued", d.limit, key, t.waiting)
+	}
+	t.waiting++
+	t.users++
+	d.mu.Unlock()
+
+	select {
+	case t.sem <- struct{}{}:
+		d.mu.Lock()
+		t.waiting--
+		d.mu.Unlock()
+		return func() { d.release(key, t) }, nil
+	case <-ctx.Done():
+		d.mu.Lock()
+		t.waiting--
+		d.mu.Unlock()
+		d.leave(key, t)
+		return nil, ctx.Err()
+	}
+}
+
+func (d *dialSlots) release(key string, t *targetSlots) {
+	<-t.sem
+	d.leave(key, t)
+}
+
+func (d *dialSlots) leave(key string, t *targetSlots) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t.users--; t.users == 0 {
+		delete(d.targets, key)
+	}
+}
+
+// queued returns the dials waiting across all targets.
+func (d *dialSlots) queued() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, t := range d.targets {
+		n += t.waiting
+	}
+	return n
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"paqet/internal/tnet/dup"
+	"paqet/internal/tnet/multipath"
+)
+
+// dupPairTimeout bounds how long the first leg of a multi-leg stream waits
+// for the others before it is served with the legs that arrived.
+const dupPairTimeout = 2 * time.Second
+
+// dupTombstone is how long a finished multi-leg stream is remembered, so
+// that a leg arriving after it does not start the stream over and replay
+// its request upstream.
+const dupTombstone = time.Minute
+
+// legGroup collects the legs of one multi-leg stream.
+type legGroup struct {
+	want    int
+	legs    []tnet.Strm
+	started bool          // merged stream built, or finished; late legs are refused
+	ready   chan struct{} // closed when all legs have joined
+	done    chan struct{} // closed once the merged stream has been served
+}
+
+// joinLegs merges strm with the other legs of the stream described by p.
+// The handler of the leg that arrives first gets the merged stream and must
+// call release when it is done; the handlers of the other legs get a nil
+// stream and are parked until then, since returning would close their leg.
+func (s *Server) joinLegs(ctx context.Context, strm tnet.Strm, p *protocol.Proto) (merged tnet.Strm, release func()) {
+	want := p.Legs
+	if want == 0 {
+		want = 2
+	}
+
+	s.dupMu.Lock()
+	if g, ok := s.dups[p.Dup]; ok {
+		if g.started {
+			s.dupMu.Unlock()
+			flog.Debugf("stream %s: leg %s arrived too late, closing it", p.Dup, strm.CID())
+			return nil, nil
+		}
+		g.legs = append(g.legs, strm)
+		if len(g.legs) == g.want {
+			close(g.ready)
+		}
+		s.dupMu.Unlock()
+		select {
+		case <-g.done:
+		case <-ctx.Done():
+		}
+		return nil, nil
+	}
+	g := &legGroup{want: want, legs: []tnet.Strm{strm}, ready: make(chan struct{}), done: make(chan struct{})}
+	s.dups[p.Dup] = g
+	s.dupMu.Unlock()
+
+	t := time.NewTimer(dupPairTimeout)
+	defer t.Stop()
+	select {
+	case <-g.ready:
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	s.dupMu.Lock()
+	g.started = true
+	legs := g.legs
+	s.dupMu.Unlock()
+
+	if len(legs) < want {
+		flog.Debugf("stream %s: %d of %d legs arrived, serving stream %s with those", p.Dup, len(legs), want, strm.CID())
+	} else {
+		flog.Debugf("stream %s joined %d legs", p.Dup, len(legs))
+	}
+	release = func() {
+		close(g.done)
+		time.AfterFunc(dupTombstone, func() {
+			s.dupMu.Lock()
+			delete(s.dups, p.Dup)
+			s.dupMu.Unlock()
+		})
+	}
+	if p.Multipath != "" {
+		mode, err := multipath.ParseMode(p.Multipath)
+		if err != nil {
+			flog.Warnf("stream %s: %v, falling back to duplicate", p.Dup, err)
+			mode = multipath.Duplicate
+		}
+		return multipath.New(mode, legs...), release
+	}
+	return dup.New(legs...), release
+}
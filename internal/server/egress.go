@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"paqet/internal/flog"
+)
+
+// dialer returns the dialer used for upstream connections to addr. It
+// refuses destinations denied by server.acl and marks its sockets when
+// egress.mark is configured. With server.egress_proxy it only connects to
+// the proxy, and dialProxy checks the ACL instead.
+func (s *Server) dialer(addr string) *net.Dialer {
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	var controls []func(network, address string, c syscall.RawConn) error
+	if acl := &s.cfg.Server.ACL; acl.Enabled() && s.cfg.Server.EgressProxy == nil {
+		host, _, _ := net.SplitHostPort(addr)
+		controls = append(controls, aclControl(acl, host))
+	}
+	if s.cfg.Egress.Enabled() {
+		controls = append(controls, markControl(s.cfg.Egress.Mark))
+	}
+	if len(controls) > 0 {
+		d.Control = func(network, address string, c syscall.RawConn) error {
+			for _, control := range controls {
+				if err := control(network, address, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return d
+}
+
+// setupEgressRules routes marked traffic through egress.table for both
+// address families. The returned function removes the rules again.
+func (s *Server) setupEgressRules() (func(), error) {
+	mark := strconv.FormatUint(uint64(s.cfg.Egress.Mark), 10)
+	table := strconv.Itoa(s.cfg.Egress.Table)
+	var added []string
+	teardown := func() {
+		for _, family := range added {
+			cmd := exec.Command("ip", family, "rule", "del", "fwmark", mark, "table", table)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				flog.Warnf("failed to remove %s egress rule: %v, output: %s", family, err, output)
+			}
+		}
+	}
+	for _, family := range []string{"-4", "-6"} {
+		// Replace rather than duplicate a rule left behind by an unclean exit.
+		_ = exec.Command("ip", family, "rule", "del", "fwmark", mark, "table", table).Run()
+		cmd := exec.Command("ip", family, "rule", "add", "fwmark", mark, "table", table)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			teardown()
+			return nil, fmt.Errorf("failed to add %s egress rule: %v, output: %s", family, err, output)
+		}
+		added = append(added, family)
+	}
+	flog.Infof("egress traffic marked %s is routed via table %s", mark, table)
+	return teardown, nil
+}
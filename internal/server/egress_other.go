@@ -0,0 +1,10 @@
+//go:build !linux
+
+package server
+
+import "syscall"
+
+// SO_MARK is Linux-only; conf rejects egress.mark elsewhere.
+func markControl(uint32) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
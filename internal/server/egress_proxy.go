@@ -0,0 +1,260 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"paqet/internal/flog"
+
+	"github.com/txthinking/socks5"
+)
+
+// proxyHandshakeTimeout bounds the exchange with server.egress_proxy
+// before a connection is handed to the stream.
+const proxyHandshakeTimeout = 10 * time.Second
+
+// dialProxy connects to addr through server.egress_proxy. The proxy makes
+// the actual connection, so server.acl is checked here beforehand, on the
+// addresses the server itself resolves the target to.
+func (s *Server) dialProxy(ctx context.Context, network, addr string) (net.Conn, error) {
+	if err := s.checkACL(ctx, network, addr); err != nil {
+		return nil, err
+	}
+	u := s.cfg.Server.EgressProxy
+	if u.Scheme == "http" && network != "tcp" {
+		return nil, fmt.Errorf("cannot relay %s to %s: server.egress_proxy is an HTTP proxy", network, addr)
+	}
+	conn, err := s.dialer(u.Host).DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach egress proxy %s: %w", u.Host, err)
+	}
+
+	// Handshakes only watch deadlines, so cancelling ctx expires them.
+	deadline := time.Now().Add(proxyHandshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	var c net.Conn
+	switch u.Scheme {
+	case "http":
+		c, err = httpConnect(conn, u, addr)
+	default:
+		c, err = s.socks5Connect(ctx, conn, u, network, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("egress proxy %s: %w", u.Host, err)
+	}
+	if !stop() {
+		c.Close()
+		return nil, ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	flog.Debugf("%s connection to %s established through egress proxy %s", network, addr, u.Host)
+	return c, nil
+}
+
+// checkACL applies server.acl to the addresses addr resolves to.
+func (s *Server) checkACL(ctx context.Context, network, addr string) error {
+	acl := &s.cfg.Server.ACL
+	if !acl.Enabled() {
+		return nil
+	}
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port in %s", addr)
+	}
+	ips := []netip.Addr{}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = append(ips, ip)
+	} else if ips, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+		return err
+	}
+	control := aclControl(acl, host)
+	for _, ip := range ips {
+		if err := control(network, netip.AddrPortFrom(ip, uint16(port)).String(), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// httpConnect asks the HTTP proxy on conn for a tunnel to addr.
+func httpConnect(conn net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	// The body of a CONNECT response is the tunnel, so it is left unread.
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT %s answered %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn keeps bytes the proxy sent right after its response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// socks5Connect negotiates with the SOCKS5 proxy on conn and returns a
+// connection to addr: conn itself for TCP, or a UDP association whose
+// lifetime is tied to conn.
+func (s *Server) socks5Connect(ctx context.Context, conn net.Conn, u *url.URL, network, addr string) (net.Conn, error) {
+	method := socks5.MethodNone
+	if u.User != nil {
+		method = socks5.MethodUsernamePassword
+	}
+	if _, err := socks5.NewNegotiationRequest([]byte{method}).WriteTo(conn); err != nil {
+		return nil, err
+	}
+	nrp, err := socks5.NewNegotiationReplyFrom(conn)
+	if err != nil {
+		return nil, err
+	}
+	if nrp.Method != method {
+		return nil, fmt.Errorf("proxy does not accept authentication method %d", method)
+	}
+	if method == socks5.MethodUsernamePassword {
+		pass, _ := u.User.Password()
+		if _, err := socks5.NewUserPassNegotiationRequest([]byte(u.User.Username()), []byte(pass)).WriteTo(conn); err != nil {
+			return nil, err
+		}
+		urp, err := socks5.NewUserPassNegotiationReplyFrom(conn)
+		if err != nil {
+			return nil, err
+		}
+		if urp.Status != socks5.UserPassStatusSuccess {
+			return nil, socks5.ErrUserPassAuth
+		}
+	}
+
+	cmd, target := socks5.CmdConnect, addr
+	if network == "udp" {
+		cmd, target = socks5.CmdUDP, "0.0.0.0:0"
+	}
+	atyp, host, port, err := socks5.ParseAddress(target)
+	if err != nil {
+		return nil, err
+	}
+	if atyp == socks5.ATYPDomain {
+		host = host[1:]
+	}
+	if _, err := socks5.NewRequest(cmd, atyp, host, port).WriteTo(conn); err != nil {
+		return nil, err
+	}
+	rp, err := socks5.NewReplyFrom(conn)
+	if err != nil {
+		return nil, err
+	}
+	if rp.Rep != socks5.RepSuccess {
+		return nil, fmt.Errorf("proxy refused %s to %s with reply %d", network, addr, rp.Rep)
+	}
+	if network != "udp" {
+		return conn, nil
+	}
+
+	// The relay may answer with an unspecified address, meaning its own.
+	relay := rp.Address()
+	if rh, rport, _ := net.SplitHostPort(relay); net.ParseIP(rh).IsUnspecified() {
+		relay = net.JoinHostPort(u.Hostname(), rport)
+	}
+	pc, err := s.dialer(relay).DialContext(ctx, "udp", relay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach UDP relay %s: %w", relay, err)
+	}
+	atyp, host, port, err = socks5.ParseAddress(addr)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	if atyp == socks5.ATYPDomain {
+		host = host[1:]
+	}
+	c := &socks5UDPConn{Conn: pc, ctrl: conn, atyp: atyp, host: host, port: port}
+	// The association ends with the control connection.
+	go func() {
+		_ = conn.SetDeadline(time.Time{})
+		_, _ = io.Copy(io.Discard, conn)
+		pc.Close()
+	}()
+	return c, nil
+}
+
+// socks5UDPConn relays datagrams to one target through a SOCKS5 UDP
+// association.
+type socks5UDPConn struct {
+	net.Conn
+	ctrl       net.Conn
+	atyp       byte
+	host, port []byte
+	rbuf       []byte
+}
+
+func (c *socks5UDPConn) Write(b []byte) (int, error) {
+	if _, err := c.Conn.Write(socks5.NewDatagram(c.atyp, c.host, c.port, b).Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read returns the payload of the next datagram from the relay.
+func (c *socks5UDPConn) Read(b []byte) (int, error) {
+	if c.rbuf == nil {
+		c.rbuf = make([]byte, 65535)
+	}
+	for {
+		n, err := c.Conn.Read(c.rbuf)
+		if err != nil {
+			return 0, err
+		}
+		d, err := socks5.NewDatagramFromBytes(c.rbuf[:n])
+		if err != nil || d.Frag != 0 {
+			continue
+		}
+		return copy(b, d.Data), nil
+	}
+}
+
+func (c *socks5UDPConn) Close() error {
+	c.ctrl.Close()
+	return c.Conn.Close()
+}
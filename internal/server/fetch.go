@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+)
+
+// handleFetch sends the file published as p.Name, followed by its content
+// unless the client already has the version with hash p.Hash. The file is
+// read on every request, so replacing it publishes a new version.
+func (s *Server) handleFetch(strm tnet.Strm, p *protocol.Proto) error {
+	path, ok := s.cfg.Publish.Files[p.Name]
+	if !ok {
+		return s.refuseFetch(strm, p, fmt.Errorf("no file is published as %q", p.Name))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		flog.Errorf("failed to open published file %s: %v", p.Name, err)
+		return s.refuseFetch(strm, p, fmt.Errorf("published file %q is unavailable", p.Name))
+	}
+	defer f.Close()
+
+	// The hash goes ahead of the content, which is read twice for it.
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		flog.Errorf("failed to read published file %s: %v", p.Name, err)
+		return s.refuseFetch(strm, p, fmt.Errorf("published file %q is unavailable", p.Name))
+	}
+
+	reply := p.Reply(protocol.PFETCH)
+	reply.Name, reply.Hash = p.Name, h.Sum(nil)
+	if bytes.Equal(reply.Hash, p.Hash) {
+		flog.Debugf("published file %s on stream %s is unchanged for %s", p.Name, strm.CID(), strm.RemoteAddr())
+		return reply.Write(strm)
+	}
+	reply.Size = int(size)
+	if err := reply.Write(strm); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(strm, f, size); err != nil {
+		return fmt.Errorf("failed to send published file %s: %w", p.Name, err)
+	}
+	flog.Infof("sent published file %s (%d bytes) to %s", p.Name, size, strm.RemoteAddr())
+	return nil
+}
+
+func (s *Server) refuseFetch(strm tnet.Strm, p *protocol.Proto, reason error) error {
+	r := p.Reply(protocol.PERR)
+	r.Error = reason.Error()
+	_ = r.Write(strm)
+	return reason
+}
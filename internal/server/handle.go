@@ -2,7 +2,9 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 
 	"paqet/internal/flog"
 	"paqet/internal/protocol"
@@ -10,6 +12,10 @@ import (
 )
 
 func (s *Server) handleConn(ctx context.Context, conn tnet.Conn) {
+	defer s.authed.Delete(conn)
+	defer s.clients.Delete(conn)
+	defer s.helloFinished(conn)
+	var open atomic.Int64 // streams of conn being handled or waiting for a slot
 	for {
 		select {
 		case <-ctx.Done():
@@ -18,65 +24,136 @@ func (s *Server) handleConn(ctx context.Context, conn tnet.Conn) {
 		default:
 		}
 		strm, err := conn.AcceptStrm()
+		if errors.Is(err, tnet.ErrConnClosed) {
+			flog.Debugf("connection %s closed: %v", conn.RemoteAddr(), err)
+			return
+		}
 		if err != nil {
 			flog.Errorf("failed to accept stream on %s: %v", conn.RemoteAddr(), err)
 			return
 		}
-		
-		// Acquire semaphore if configured (limits concurrent stream handlers)
-		if s.streamSemaphore != nil {
-			select {
-			case s.streamSemaphore <- struct{}{}:
-				// Acquired, proceed
-			case <-ctx.Done():
-				strm.Close()
-				return
-			}
+
+		if s.stopping.Load() {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.refuse(strm, errShuttingDown)
+			}()
+			continue
 		}
-		
+
+		// Excess streams are refused rather than left queued in the
+		// session, where neither side would see them waiting.
+		if limit := s.cfg.Performance.MaxStreamsPerConn; limit > 0 && open.Load() >= int64(limit) {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.refuse(strm, fmt.Errorf("connection already has %d streams open", limit))
+			}()
+			continue
+		}
+		open.Add(1)
+
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
+			defer open.Add(-1)
+			var p protocol.Proto
+			if err := p.Read(strm); err != nil {
+				flog.Errorf("failed to read protocol message from stream %s: %v", strm.CID(), err)
+				strm.Close()
+				return
+			}
+			// Streams that arrive ahead of the hello wait for it before
+			// taking a slot, which verified clients' streams would miss.
+			if !s.authenticated(conn, p.Type) && !s.awaitHello(ctx, conn) {
+				s.refuseProto(strm, &p, fmt.Errorf("stream type %d from %s before an authenticated hello", p.Type, strm.RemoteAddr()))
+				return
+			}
+			// Acquire a slot if configured (limits concurrent stream handlers)
+			if err := s.acquire(ctx, s.classOf(conn)); err != nil {
+				s.refuseProto(strm, &p, err)
+				return
+			}
 			defer func() {
 				strm.Close()
-				// Release semaphore
-				if s.streamSemaphore != nil {
-					<-s.streamSemaphore
-				}
+				s.release()
 			}()
-			if err := s.handleStrm(ctx, strm); err != nil {
-				flog.Errorf("stream %d from %s closed with error: %v", strm.SID(), strm.RemoteAddr(), err)
+			if err := s.dispatch(ctx, conn, strm, &p); err != nil {
+				flog.Errorf("stream %s from %s closed with error: %v", strm.CID(), strm.RemoteAddr(), err)
 			} else {
-				flog.Debugf("stream %d from %s closed", strm.SID(), strm.RemoteAddr())
+				flog.Debugf("stream %s from %s closed", strm.CID(), strm.RemoteAddr())
 			}
 		}()
 	}
 }
 
-func (s *Server) handleStrm(ctx context.Context, strm tnet.Strm) error {
-	var p protocol.Proto
-	err := p.Read(strm)
-	if err != nil {
-		flog.Errorf("failed to read protocol message from stream %d: %v", strm.SID(), err)
-		return err
+// dispatch serves strm according to its header p.
+func (s *Server) dispatch(ctx context.Context, conn tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	if !s.authenticated(conn, p.Type) {
+		return fmt.Errorf("stream type %d from %s before an authenticated hello", p.Type, strm.RemoteAddr())
+	}
+	if p.Dup != "" && (p.Type == protocol.PTCP || p.Type == protocol.PUDP || p.Type == protocol.PTUN) {
+		merged, release := s.joinLegs(ctx, strm, p)
+		if merged == nil {
+			return nil
+		}
+		defer release()
+		strm = merged
+	}
+
+	if p.Datagram && p.Dup == "" {
+		if d, ok := strm.(tnet.DatagramStrm); ok && d.SupportsDatagrams() {
+			d.UseDatagrams()
+			flog.Debugf("stream %s carries its payload in QUIC datagrams", strm.CID())
+		}
 	}
 
 	switch p.Type {
 	case protocol.PPING:
-		return s.handlePing(strm)
+		return s.handlePing(strm, p)
 	case protocol.PTCPF:
-		if len(p.TCPF) != 0 {
+		if len(p.TCPF) != 0 && s.pConn != nil {
 			s.pConn.SetClientTCPF(strm.RemoteAddr(), p.TCPF)
 		}
 		return nil
 	case protocol.PTCP:
-		return s.handleTCPProtocol(ctx, strm, &p)
+		strm = s.track(strm, "tcp", p.Addr.String())
+		defer strm.Close()
+		return s.handleTCPProtocol(ctx, conn, strm, p)
 	case protocol.PUDP:
-		return s.handleUDPProtocol(ctx, strm, &p)
+		strm = s.track(strm, "udp", p.Addr.String())
+		defer strm.Close()
+		return s.handleUDPProtocol(ctx, strm, p)
 	case protocol.PTUN:
-		return s.handleTUNProtocol(ctx, strm)
+		strm = s.track(strm, "tun", "")
+		defer strm.Close()
+		return s.handleTUNProtocol(ctx, conn, strm, p)
+	case protocol.PPD:
+		return s.handlePrefixProtocol(conn, strm, p)
+	case protocol.PTUNCFG:
+		return s.handleTUNConfigProtocol(conn, strm, p)
+	case protocol.PBIND:
+		owner, err := s.owner(conn, p)
+		if err != nil {
+			return err
+		}
+		s.bindAddr(conn, owner)
+		return s.handleBindProtocol(conn, p)
+	case protocol.PSPD:
+		return s.handleSpeedProbe(strm, p)
+	case protocol.PHELO:
+		return s.handleHello(conn, strm, p)
+	case protocol.PRSV:
+		return s.handleReserve(ctx, conn, strm)
+	case protocol.PREV:
+		return s.handleReverse(ctx, conn, strm, p)
+	case protocol.PFETCH:
+		return s.handleFetch(strm, p)
+	case protocol.PBENCH:
+		return s.handleBench(strm, p)
 	default:
-		flog.Errorf("unknown protocol type %d on stream %d", p.Type, strm.SID())
+		flog.Errorf("unknown protocol type %d on stream %s", p.Type, strm.CID())
 		return fmt.Errorf("unknown protocol type: %d", p.Type)
 	}
 }
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"paqet/internal/flog"
+	"paqet/internal/handoff"
+	"paqet/internal/tnet"
+)
+
+// HandOff hands the server over to a new process, see handOff.
+func (s *Server) HandOff() error {
+	st := s.stopper.Load()
+	if st == nil {
+		return fmt.Errorf("server is not listening yet")
+	}
+	return s.handOff(st.listener, st.stop)
+}
+
+// handOff starts a new process from the current executable, which may be
+// an upgraded binary, and hands new clients over to it. This process then
+// serves only the connections it has until they end or server.drain_timeout
+// passes, and stops the server through stop.
+func (s *Server) handOff(listener tnet.Listener, stop context.CancelFunc) error {
+	if s.tun != nil {
+		return fmt.Errorf("a server with a TUN device cannot hand off, since the device cannot be shared")
+	}
+	if !s.handingOff.CompareAndSwap(false, true) {
+		return fmt.Errorf("a handoff or shutdown is already in progress")
+	}
+
+	// From here on, packets of new flows are left to the new process.
+	var flows []string
+	s.conns.Range(func(_, addr any) bool {
+		s.draining.Store(addr, struct{}{})
+		flows = append(flows, addr.(string))
+		return true
+	})
+	if s.pConn != nil {
+		s.pConn.SetFilter(func(addr net.Addr) bool {
+			_, ok := s.draining.Load(addr.String())
+			return ok
+		})
+	}
+
+	child, err := handoff.Exec(flows)
+	if err != nil {
+		if s.pConn != nil {
+			s.pConn.SetFilter(nil)
+		}
+		s.draining.Clear()
+		s.handingOff.Store(false)
+		return err
+	}
+	s.child.Store(child)
+	flog.Infof("handed off to process %d, draining %d connections", child.Pid, len(flows))
+
+	handoff.Release()
+	if d, ok := listener.(interface{ Drain() }); ok {
+		d.Drain()
+	}
+	go s.drain(stop, time.Duration(s.cfg.Server.DrainTimeout)*time.Second)
+	return nil
+}
+
+// drain stops the server once the connections it still serves have ended,
+// or timeout has passed. Connections without open streams are closed right
+// away: their clients reconnect, to the new process after a handoff, when
+// they next need a stream.
+func (s *Server) drain(stop context.CancelFunc, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		left := 0
+		s.conns.Range(func(k, _ any) bool {
+			conn := k.(tnet.Conn)
+			if n, ok := conn.(interface{ NumStreams() int }); ok && n.NumStreams() == 0 {
+				_ = conn.Close()
+			}
+			left++
+			return true
+		})
+		if left == 0 {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	flog.Infof("drain finished, stopping")
+	stop()
+}
+
+// adopt takes over from the process that started this one, if any, once
+// the listener is up: it leaves the flows that process still drains alone
+// until it exits.
+func (s *Server) adopt() {
+	draining := handoff.Ready()
+	if draining == nil {
+		return
+	}
+	flog.Infof("took over from the previous process, which drains %d connections", draining.Len())
+	if s.pConn == nil {
+		return
+	}
+	s.pConn.SetFilter(func(addr net.Addr) bool {
+		return !draining.Has(addr.String())
+	})
+	go func() {
+		<-draining.Done()
+		s.pConn.SetFilter(nil)
+		flog.Infof("previous process has exited")
+	}()
+}
+
+// trackConn and untrackConn keep the registry of accepted connections that a
+// handoff drains.
+func (s *Server) trackConn(conn tnet.Conn) {
+	s.conns.Store(conn, conn.RemoteAddr().String())
+}
+
+func (s *Server) untrackConn(conn tnet.Conn) {
+	addr, _ := s.conns.LoadAndDelete(conn)
+	if child := s.child.Load(); child != nil {
+		s.draining.Delete(addr)
+		child.Ended(addr.(string))
+	}
+}
+
+// unlessHandedOff runs teardown, which undoes system settings such as
+// routing rules, unless the new process has taken them over.
+func (s *Server) unlessHandedOff(teardown func()) {
+	if s.child.Load() == nil {
+		teardown()
+	}
+}
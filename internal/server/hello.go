@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+)
+
+// authenticated reports whether a stream of type t may be served on conn.
+// With transport.psk set, only pings and the hello itself are answered
+// until the connection has completed a valid hello.
+func (s *Server) authenticated(conn tnet.Conn, t protocol.PType) bool {
+	if s.helloSeen == nil || t == protocol.PPING || t == protocol.PHELO {
+		return true
+	}
+	_, ok := s.authed.Load(conn)
+	return ok
+}
+
+// helloWait is how long a stream that arrives ahead of its connection's
+// hello is held before it is refused. Resuming clients send the hello and
+// their first streams without waiting in between.
+const helloWait = 5 * time.Second
+
+// helloHeld is how many streams of one connection awaitHello holds at
+// once; further ones are refused. A resuming client sends only its first
+// few streams ahead of the ack.
+const helloHeld = 8
+
+// helloWaiters are the streams of a connection held by awaitHello.
+type helloWaiters struct {
+	done chan struct{} // closed once the hello is handled
+	held atomic.Int32
+}
+
+// awaitHello holds a stream that arrived on conn before the hello and
+// reports whether the hello has been verified since.
+func (s *Server) awaitHello(ctx context.Context, conn tnet.Conn) bool {
+	v, _ := s.helloDone.LoadOrStore(conn, &helloWaiters{done: make(chan struct{})})
+	w := v.(*helloWaiters)
+	if w.held.Add(1) > helloHeld {
+		w.held.Add(-1)
+		return false
+	}
+	defer w.held.Add(-1)
+	// The hello may have been verified before w was stored.
+	if _, ok := s.authed.Load(conn); ok {
+		return true
+	}
+	t := time.NewTimer(helloWait)
+	defer t.Stop()
+	select {
+	case <-w.done:
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	_, ok := s.authed.Load(conn)
+	return ok
+}
+
+// helloFinished wakes the streams of conn held by awaitHello.
+func (s *Server) helloFinished(conn tnet.Conn) {
+	if v, ok := s.helloDone.LoadAndDelete(conn); ok {
+		close(v.(*helloWaiters).done)
+	}
+}
+
+// handleHello verifies a client's PSK hello and marks conn as authenticated.
+func (s *Server) handleHello(conn tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	defer s.helloFinished(conn)
+	if s.helloSeen == nil {
+		// Closing the stream without an ack fails the client's dial, which
+		// points at the mismatched psk settings.
+		return fmt.Errorf("hello from %s but transport.psk is not set", conn.RemoteAddr())
+	}
+	ack, err := p.VerifyHello([]byte(s.cfg.Transport.PSK), time.Now(), s.helloSeen)
+	if err != nil {
+		return fmt.Errorf("rejected hello from %s: %w", conn.RemoteAddr(), err)
+	}
+	class := s.cfg.Server.Priority.Class(p.ClientID, remoteIP(conn.RemoteAddr()))
+	s.authed.Store(conn, class)
+	s.clients.Store(conn, p.ClientID)
+	flog.Debugf("connection %s authenticated as %s (priority %s)", conn.RemoteAddr(), p.ClientID, conf.PriorityName(class))
+	ack.Resume = true
+	return ack.Write(strm)
+}
+
+// owner returns the client that the stream header p speaks for on conn,
+// or its address for clients without an ID. The ClientID is bound to conn
+// by the hello or, without transport.psk, by the first stream that names
+// one, and a stream naming another client is refused, so that one client
+// cannot claim the routes, leases or forwards of another.
+func (s *Server) owner(conn tnet.Conn, p *protocol.Proto) (string, error) {
+	if v, loaded := s.clients.LoadOrStore(conn, p.ClientID); loaded && v.(string) != p.ClientID {
+		return "", fmt.Errorf("stream type %d from %s names client %q but the connection belongs to %q", p.Type, conn.RemoteAddr(), p.ClientID, v)
+	}
+	if p.ClientID == "" {
+		return conn.RemoteAddr().String(), nil
+	}
+	return p.ClientID, nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"paqet/internal/tnet/kcptun"
+)
+
+// serveKcptun accepts stock kcptun clients on kcptun.listen and relays
+// each of their streams to kcptun.target, like a TCP stream from a paqet
+// client: through the stream slots, server.acl and server.egress_proxy.
+func (s *Server) serveKcptun(ctx context.Context) error {
+	cfg := &s.cfg.Kcptun
+	l, err := kcptun.Listen(cfg)
+	if err != nil {
+		return fmt.Errorf("could not start kcptun listener: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+	flog.Infof("accepting kcptun clients on %s -> %s", l.Addr(), cfg.Target)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, tnet.ErrConnClosed) {
+					return
+				}
+				flog.Errorf("failed to accept kcptun connection: %v", err)
+				continue
+			}
+			flog.Infof("accepted kcptun connection from %s", conn.RemoteAddr())
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer conn.Close()
+				s.handleKcptunConn(ctx, conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+func (s *Server) handleKcptunConn(ctx context.Context, conn tnet.Conn) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	for {
+		strm, err := conn.AcceptStrm()
+		if errors.Is(err, tnet.ErrAcceptTimeout) {
+			continue
+		}
+		if err != nil {
+			flog.Debugf("kcptun connection %s closed: %v", conn.RemoteAddr(), err)
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.acquire(ctx, s.classOf(conn)); err != nil {
+				strm.Close()
+				flog.Warnf("refused kcptun stream from %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			defer s.release()
+			strm := s.track(strm, "tcp", s.cfg.Kcptun.Target)
+			defer strm.Close()
+			flog.Infof("accepted kcptun stream %s: %s -> %s", strm.CID(), conn.RemoteAddr(), s.cfg.Kcptun.Target)
+			if err := s.handleTCP(ctx, strm, s.cfg.Kcptun.Target, protocol.ReuseDefault, nil); err != nil {
+				flog.Debugf("kcptun stream %s closed with error: %v", strm.CID(), err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"paqet/internal/flog"
+	"paqet/internal/tnet"
+)
+
+// liveStreams is the registry of open relay streams listed and closed
+// through the admin API. A nil *liveStreams is disabled: Track returns
+// streams unchanged, as metrics.Streams does.
+type liveStreams struct {
+	next  atomic.Uint64
+	strms sync.Map // id -> *liveStrm
+}
+
+// StreamState is an open relay stream on the admin API.
+type StreamState struct {
+	ID       uint64    `json:"id"`
+	CID      string    `json:"cid"`
+	Remote   string    `json:"remote"`
+	Kind     string    `json:"kind"`
+	Target   string    `json:"target,omitempty"`
+	Opened   time.Time `json:"opened"`
+	BytesIn  uint64    `json:"bytes_in"`  // read from the tunnel
+	BytesOut uint64    `json:"bytes_out"` // written to the tunnel
+	Idle     float64   `json:"idle_seconds"`
+}
+
+// Track registers strm, a stream of kind relaying to target, until it is
+// closed.
+func (l *liveStreams) Track(strm tnet.Strm, kind, target string) tnet.Strm {
+	if l == nil {
+		return strm
+	}
+	now := time.Now()
+	t := &liveStrm{Strm: strm, l: l, id: l.next.Add(1), kind: kind, target: target, opened: now}
+	t.last.Store(now.UnixNano())
+	l.strms.Store(t.id, t)
+	return t
+}
+
+// List returns the open streams, oldest first.
+func (l *liveStreams) List() []StreamState {
+	now := time.Now()
+	strms := []StreamState{}
+	l.strms.Range(func(_, v any) bool {
+		t := v.(*liveStrm)
+		strms = append(strms, StreamState{
+			ID:       t.id,
+			CID:      t.CID(),
+			Remote:   t.RemoteAddr().String(),
+			Kind:     t.kind,
+			Target:   t.target,
+			Opened:   t.opened,
+			BytesIn:  t.in.Load(),
+			BytesOut: t.out.Load(),
+			Idle:     now.Sub(time.Unix(0, t.last.Load())).Seconds(),
+		})
+		return true
+	})
+	slices.SortFunc(strms, func(a, b StreamState) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return strms
+}
+
+type liveStrm struct {
+	tnet.Strm
+	l        *liveStreams
+	id       uint64
+	kind     string
+	target   string
+	opened   time.Time
+	in, out  atomic.Uint64
+	last     atomic.Int64 // unix nanoseconds of the last read or write
+	unlisted sync.Once
+}
+
+func (t *liveStrm) Read(b []byte) (int, error) {
+	n, err := t.Strm.Read(b)
+	t.received(n)
+	return n, err
+}
+
+func (t *liveStrm) Write(b []byte) (int, error) {
+	n, err := t.Strm.Write(b)
+	t.sent(n)
+	return n, err
+}
+
+func (t *liveStrm) WriteTo(w io.Writer) (int64, error) {
+	return tnet.WriteTo(t.Strm, w, t.received)
+}
+
+func (t *liveStrm) ReadFrom(r io.Reader) (int64, error) {
+	return tnet.ReadFrom(t.Strm, r, t.sent)
+}
+
+func (t *liveStrm) received(n int) {
+	if n > 0 {
+		t.in.Add(uint64(n))
+		t.last.Store(time.Now().UnixNano())
+	}
+}
+
+func (t *liveStrm) sent(n int) {
+	if n > 0 {
+		t.out.Add(uint64(n))
+		t.last.Store(time.Now().UnixNano())
+	}
+}
+
+func (t *liveStrm) Close() error {
+	t.unlisted.Do(func() { t.l.strms.Delete(t.id) })
+	return t.Strm.Close()
+}
+
+// Streams serves GET /streams.
+func (s *Server) Streams(_ *http.Request) (any, error) {
+	return s.live.List(), nil
+}
+
+// CloseStream serves POST /streams/{id}/close, which ends a relay stream
+// and the upstream connection it carries.
+func (s *Server) CloseStream(r *http.Request) (any, error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream id %q", r.PathValue("id"))
+	}
+	v, ok := s.live.strms.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("no open stream %d", id)
+	}
+	t := v.(*liveStrm)
+	flog.Infof("admin: closing stream %s from %s to %s", t.CID(), t.RemoteAddr(), t.target)
+	_ = t.Close()
+	return map[string]uint64{"closed": id}, nil
+}
+
+// Clients serves GET /clients: every accepted transport connection.
+func (s *Server) Clients(_ *http.Request) (any, error) {
+	return s.Connections(), nil
+}
+
+// KickClient serves POST /clients/kick?remote=addr, which closes the
+// client's transport connections and with them all of its streams.
+func (s *Server) KickClient(r *http.Request) (any, error) {
+	remote := r.URL.Query().Get("remote")
+	if remote == "" {
+		return nil, fmt.Errorf("remote is required")
+	}
+	n := 0
+	s.conns.Range(func(k, addr any) bool {
+		if addr.(string) == remote {
+			_ = k.(tnet.Conn).Close()
+			n++
+		}
+		return true
+	})
+	if n == 0 {
+		return nil, fmt.Errorf("no connection from %s", remote)
+	}
+	flog.Infof("admin: closed %d connections from %s", n, remote)
+	return map[string]int{"closed": n}, nil
+}
+
+// Drops serves GET /drops: packets the raw socket dropped, by reason.
+func (s *Server) Drops(_ *http.Request) (any, error) {
+	if s.pConn == nil {
+		return nil, fmt.Errorf("the %s transport has no raw packet socket", s.cfg.Transport.Protocol)
+	}
+	return map[string]any{
+		"dropped":       s.pConn.DroppedPackets(),
+		"by_reason":     s.pConn.DropStats(),
+		"queue_depth":   s.pConn.QueueDepth(),
+		"bad_checksums": s.pConn.BadChecksums(),
+	}, nil
+}
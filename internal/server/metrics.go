@@ -0,0 +1,71 @@
+package server
+
+import (
+	"paqet/internal/conf"
+	"paqet/internal/metrics"
+	"slices"
+)
+
+// Collect writes the server's metrics for the /metrics endpoint.
+func (s *Server) Collect(w *metrics.Writer) {
+	w.Counter("paqet_connections_accepted_total", "Transport connections accepted from clients.", s.connsAccepted.Load())
+	s.streams.Collect(w)
+	s.traffic.Collect(w)
+	w.Counter("paqet_streams_refused_total", "Streams refused by the per-connection limit or a full backlog.", s.streamsRefused.Load())
+	if s.streamSlots != nil {
+		waiting, displaced := s.streamSlots.stats()
+		var total int
+		for _, n := range waiting {
+			total += n
+		}
+		w.Gauge("paqet_streams_waiting", "Streams waiting for a max_concurrent_streams slot.", int64(total))
+		if len(s.cfg.Server.Priority) > 0 {
+			for c, n := range waiting {
+				w.Gauge("paqet_streams_waiting_by_class", "Streams waiting for a slot, by priority class.", int64(n), "class", conf.PriorityName(c))
+			}
+			w.Counter("paqet_streams_displaced_total", "Waiting streams refused to make room for a higher priority class.", displaced)
+		}
+	}
+
+	if s.pConn != nil {
+		drops := s.pConn.DropStats()
+		reasons := make([]string, 0, len(drops))
+		for r := range drops {
+			reasons = append(reasons, r)
+		}
+		slices.Sort(reasons)
+		for _, r := range reasons {
+			w.Counter("paqet_packets_dropped_total", "Outgoing packets dropped by the raw socket, by reason.", drops[r], "reason", r)
+		}
+		w.Counter("paqet_packets_bad_checksum_total", "Received packets with an invalid TCP checksum.", s.pConn.BadChecksums())
+		if s.cfg.Network.Gate.Enabled() {
+			w.Counter("paqet_gate_dropped_total", "Received packets dropped from sources that had not knocked.", s.pConn.GateDrops())
+		}
+	}
+
+	var pools, idle, capacity int64
+	s.connPoolsMu.RLock()
+	for _, p := range s.connPools {
+		pools++
+		idle += int64(p.Len())
+		capacity += int64(p.Cap())
+	}
+	s.connPoolsMu.RUnlock()
+	w.Gauge("paqet_upstream_pools", "Upstream TCP connection pools (one per target).", pools)
+	w.Gauge("paqet_upstream_pool_idle_connections", "Idle upstream connections held across all pools.", idle)
+	w.Gauge("paqet_upstream_pool_capacity", "Idle connections all pools may hold.", capacity)
+
+	if s.dialFailures != nil {
+		w.Gauge("paqet_upstream_dial_failures_cached", "Upstream targets whose recent dial failure is cached.", int64(s.dialFailures.len()))
+		w.Counter("paqet_upstream_dials_refused_total", "Upstream dials answered from the failure cache.", s.dialsCached.Load())
+	}
+	if s.dialSlots != nil {
+		w.Gauge("paqet_upstream_dials_queued", "Upstream dials waiting for a max_dials_per_target slot.", int64(s.dialSlots.queued()))
+		w.Counter("paqet_upstream_dials_throttled_total", "Upstream dials refused because their target's queue was full.", s.dialsThrottled.Load())
+	}
+	w.Counter("paqet_udp_framed_datagrams_total", "Datagrams sent on length-framed UDP streams.", s.framing.Datagrams.Load())
+	w.Counter("paqet_udp_framing_delay_microseconds_total", "Time spent pacing and writing framed datagrams.", s.framing.Delay.Load())
+	if s.tun != nil && s.cfg.TUN.Routing {
+		w.Counter("paqet_tun_unrouted_total", "Packets from the TUN device dropped because no client owns their destination.", s.tun.Unrouted())
+	}
+}
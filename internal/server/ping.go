@@ -1,18 +1,38 @@
 package server
 
 import (
+	"fmt"
+	"paqet/internal/conf"
 	"paqet/internal/flog"
 	"paqet/internal/protocol"
 	"paqet/internal/tnet"
 )
 
-func (s *Server) handlePing(strm tnet.Strm) error {
-	flog.Debugf("accepted ping on stream %d from %s", strm.SID(), strm.RemoteAddr())
-	p := protocol.Proto{Type: protocol.PPONG}
-	if err := p.Write(strm); err != nil {
-		flog.Errorf("failed to send pong on stream %d: %v", strm.SID(), err)
+func (s *Server) handlePing(strm tnet.Strm, p *protocol.Proto) error {
+	flog.Debugf("accepted ping on stream %s from %s", strm.CID(), strm.RemoteAddr())
+	pong := p.Reply(protocol.PPONG)
+	if err := pong.Write(strm); err != nil {
+		flog.Errorf("failed to send pong on stream %s: %v", strm.CID(), err)
 		return err
 	}
-	flog.Debugf("sent pong on stream %d", strm.SID())
+	flog.Debugf("sent pong on stream %s", strm.CID())
+	return nil
+}
+
+// handleSpeedProbe streams the requested number of bytes for a client
+// throughput test.
+func (s *Server) handleSpeedProbe(strm tnet.Strm, p *protocol.Proto) error {
+	if p.Size <= 0 || p.Size > conf.MaxProbeBytes {
+		return fmt.Errorf("invalid throughput probe size %d", p.Size)
+	}
+	flog.Debugf("serving %d byte throughput probe on stream %s", p.Size, strm.CID())
+	buf := make([]byte, 32*1024)
+	for left := p.Size; left > 0; {
+		n, err := strm.Write(buf[:min(left, len(buf))])
+		if err != nil {
+			return err
+		}
+		left -= n
+	}
 	return nil
 }
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"net"
+	"paqet/internal/flog"
+	"paqet/internal/ha"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"paqet/internal/tunnel"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prefixHold is how long a prefix stays leased to a client ID after the
+// client's last transport connection closes, unless ha.lease_grace is set.
+const prefixHold = 2 * time.Minute
+
+// prefixLeases tracks the delegated prefix of each client ID and which
+// transport connections belong to the client. A lease outlives the
+// client's last connection for a hold time, so a reconnecting client, or
+// with HA one failing over to the peer server, keeps its prefix.
+type prefixLeases struct {
+	pool   *tunnel.SubnetPool
+	owners map[tnet.Conn]string
+	expiry map[string]*time.Timer
+	grace  time.Duration
+	mu     sync.Mutex
+}
+
+func newPrefixLeases(pool *tunnel.SubnetPool, grace time.Duration) *prefixLeases {
+	return &prefixLeases{
+		pool:   pool,
+		owners: make(map[tnet.Conn]string),
+		expiry: make(map[string]*time.Timer),
+		grace:  grace,
+	}
+}
+
+// handlePrefixProtocol leases a /64 from tun.prefix_pool to the client that
+// owns conn and routes it into the TUN device.
+func (s *Server) handlePrefixProtocol(conn tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	reply := p.Reply(protocol.PPD)
+	if s.prefixes == nil || s.tun == nil {
+		flog.Warnf("prefix delegation requested on stream %s but tun.prefix_pool is not configured", strm.CID())
+		return reply.Write(strm)
+	}
+
+	owner, err := s.owner(conn, p)
+	if err != nil {
+		_ = reply.Write(strm)
+		return err
+	}
+
+	l := s.prefixes
+	l.mu.Lock()
+	if t, ok := l.expiry[owner]; ok {
+		t.Stop()
+		delete(l.expiry, owner)
+	}
+	prefix, err := l.pool.Acquire(owner)
+	if err == nil {
+		l.owners[conn] = owner
+	}
+	l.mu.Unlock()
+	if err != nil {
+		flog.Errorf("failed to delegate prefix to %s: %v", owner, err)
+		return reply.Write(strm)
+	}
+
+	if err := s.tun.AddRoute(prefix); err != nil {
+		// The route may survive from an earlier lease of the same prefix.
+		flog.Debugf("prefix route for %s: %v", prefix, err)
+	}
+	if s.ha != nil {
+		s.ha.Publish(ha.Event{Op: ha.OpLease, Pool: ha.PoolPrefix, Owner: owner, Subnet: prefix.String()})
+	}
+	flog.Infof("delegated prefix %s to %s (%s)", prefix, owner, conn.RemoteAddr())
+
+	reply.Prefix = prefix.String()
+	return reply.Write(strm)
+}
+
+// releasePrefix removes the route for the prefix of the client that owns
+// conn once its last connection has closed, and returns the lease to the
+// pool after the hold time.
+func (s *Server) releasePrefix(conn tnet.Conn) {
+	if s.prefixes == nil {
+		return
+	}
+	l := s.prefixes
+	l.mu.Lock()
+	owner, ok := l.owners[conn]
+	delete(l.owners, conn)
+	rebound := slices.Contains(mapValues(l.owners), owner)
+	l.mu.Unlock()
+	if !ok || rebound {
+		return
+	}
+
+	if prefix := l.pool.Leases()[owner]; prefix != nil {
+		if err := s.tun.DelRoute(prefix); err != nil {
+			flog.Debugf("failed to remove route for prefix %s: %v", prefix, err)
+		}
+	}
+
+	if l.grace <= 0 {
+		s.expirePrefix(owner)
+		return
+	}
+	l.mu.Lock()
+	l.expiry[owner] = time.AfterFunc(l.grace, func() { s.expirePrefix(owner) })
+	l.mu.Unlock()
+}
+
+// handleBindProtocol attaches conn to the client, whether or not it holds
+// a lease yet, so that a lease lasts as long as any of the client's
+// connections and survives when the client replaces its previous one.
+func (s *Server) handleBindProtocol(conn tnet.Conn, p *protocol.Proto) error {
+	if s.prefixes == nil || p.ClientID == "" {
+		return nil
+	}
+	l := s.prefixes
+	l.mu.Lock()
+	if t, ok := l.expiry[p.ClientID]; ok {
+		t.Stop()
+		delete(l.expiry, p.ClientID)
+	}
+	l.owners[conn] = p.ClientID
+	l.mu.Unlock()
+
+	prefix := l.pool.Leases()[p.ClientID]
+	if prefix == nil {
+		return nil
+	}
+
+	if err := s.tun.AddRoute(prefix); err != nil {
+		flog.Debugf("prefix route for %s: %v", prefix, err)
+	}
+	flog.Debugf("bound %s to prefix %s of %s", conn.RemoteAddr(), prefix, p.ClientID)
+	return nil
+}
+
+func (s *Server) expirePrefix(owner string) {
+	l := s.prefixes
+	l.mu.Lock()
+	delete(l.expiry, owner)
+	active := slices.Contains(mapValues(l.owners), owner)
+	l.mu.Unlock()
+	if active {
+		return
+	}
+
+	if prefix := l.pool.Release(owner); prefix != nil {
+		flog.Infof("released prefix %s from %s", prefix, owner)
+		if s.ha != nil {
+			s.ha.Publish(ha.Event{Op: ha.OpRelease, Pool: ha.PoolPrefix, Owner: owner})
+		}
+	}
+}
+
+// leaseSnapshot returns all prefix and address leases as events for a
+// newly connected HA peer.
+func (s *Server) leaseSnapshot() []ha.Event {
+	var events []ha.Event
+	if s.prefixes != nil {
+		for owner, prefix := range s.prefixes.pool.Leases() {
+			events = append(events, ha.Event{Op: ha.OpLease, Pool: ha.PoolPrefix, Owner: owner, Subnet: prefix.String()})
+		}
+	}
+	if s.addrs != nil {
+		for owner, host := range s.addrs.pool.Leases() {
+			if strings.HasPrefix(owner, "reserved:") {
+				continue
+			}
+			events = append(events, ha.Event{Op: ha.OpLease, Pool: ha.PoolAddr, Owner: owner, Subnet: host.String()})
+		}
+	}
+	return events
+}
+
+// applyPeerEvent mirrors a lease change made on the HA peer server.
+func (s *Server) applyPeerEvent(e ha.Event) {
+	var pool *tunnel.SubnetPool
+	var mu *sync.Mutex
+	var owners map[tnet.Conn]string
+	switch {
+	case e.Pool == ha.PoolPrefix && s.prefixes != nil:
+		pool, mu, owners = s.prefixes.pool, &s.prefixes.mu, s.prefixes.owners
+	case e.Pool == ha.PoolAddr && s.addrs != nil:
+		pool, mu, owners = s.addrs.pool, &s.addrs.mu, s.addrs.owners
+	default:
+		flog.Debugf("ignoring HA %s event for %s pool %q, which is not configured here", e.Op, e.Owner, e.Pool)
+		return
+	}
+
+	switch e.Op {
+	case ha.OpLease:
+		_, subnet, err := net.ParseCIDR(e.Subnet)
+		if err != nil {
+			flog.Errorf("invalid %s lease %q from HA peer: %v", e.Pool, e.Subnet, err)
+			return
+		}
+		if err := pool.Restore(e.Owner, subnet); err != nil {
+			flog.Warnf("HA peer %s lease for %s conflicts: %v", e.Pool, e.Owner, err)
+		}
+	case ha.OpRelease:
+		mu.Lock()
+		active := slices.Contains(mapValues(owners), e.Owner)
+		mu.Unlock()
+		if !active {
+			pool.Release(e.Owner)
+		}
+	}
+}
+
+// takeOverPeerLeases routes every prefix leased on the HA peer into our TUN
+// device once the peer is gone, so traffic for its clients' prefixes is
+// delivered here as soon as they reconnect. Prefixes whose client does not
+// come back are released after the lease grace period.
+func (s *Server) takeOverPeerLeases() {
+	if s.prefixes == nil || s.tun == nil {
+		return
+	}
+	l := s.prefixes
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	local := mapValues(l.owners)
+	for owner, prefix := range l.pool.Leases() {
+		if _, ok := l.expiry[owner]; ok || slices.Contains(local, owner) {
+			continue
+		}
+		if err := s.tun.AddRoute(prefix); err != nil {
+			flog.Debugf("prefix route for %s: %v", prefix, err)
+		}
+		flog.Infof("took over prefix %s of %s from the HA peer", prefix, owner)
+		l.expiry[owner] = time.AfterFunc(l.grace, func() {
+			s.expirePrefix(owner)
+			if l.pool.Leases()[owner] == nil {
+				if err := s.tun.DelRoute(prefix); err != nil {
+					flog.Debugf("failed to remove route for prefix %s: %v", prefix, err)
+				}
+			}
+		})
+	}
+}
+
+func mapValues[K comparable, V any](m map[K]V) []V {
+	out := make([]V, 0, len(m))
+	for _, v := range m {
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+)
+
+var errDisplaced = errors.New("displaced from the backlog by a stream of a higher priority class")
+
+// streamSlots are the performance.max_concurrent_streams slots. Streams
+// that find them all taken wait in a backlog queue per priority class, and
+// a slot that frees up goes to the longest waiting stream of the highest
+// class. When the backlog is full, a stream displaces the newest waiting
+// stream of the lowest class below its own, or is refused if there is none.
+type streamSlots struct {
+	size    int
+	backlog int
+
+	mu        sync.Mutex
+	free      int
+	waiting   int
+	queues    [conf.PriorityClasses][]chan bool // receives true for a slot, false when displaced
+	displaced uint64
+}
+
+func newStreamSlots(size, backlog int) *streamSlots {
+	return &streamSlots{size: size, backlog: max(backlog, 0), free: size}
+}
+
+func (q *streamSlots) acquire(ctx context.Context, class int) error {
+	q.mu.Lock()
+	if q.free > 0 {
+		q.free--
+		q.mu.Unlock()
+		return nil
+	}
+	if q.waiting >= q.backlog && !q.displace(class) {
+		q.mu.Unlock()
+		return fmt.Errorf("all %d stream slots are busy and the backlog of %d is full", q.size, q.backlog)
+	}
+	w := make(chan bool, 1)
+	q.queues[class] = append(q.queues[class], w)
+	q.waiting++
+	q.mu.Unlock()
+
+	select {
+	case ok := <-w:
+		if !ok {
+			return errDisplaced
+		}
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		if i := indexOf(q.queues[class], w); i >= 0 {
+			q.queues[class] = append(q.queues[class][:i], q.queues[class][i+1:]...)
+			q.waiting--
+			q.mu.Unlock()
+			return ctx.Err()
+		}
+		q.mu.Unlock()
+		// Handed a slot or displaced while giving up.
+		if <-w {
+			q.release()
+		}
+		return ctx.Err()
+	}
+}
+
+// displace refuses the newest waiting stream of the lowest class below
+// class, and reports whether there was one.
+func (q *streamSlots) displace(class int) bool {
+	for c := conf.PriorityClasses - 1; c > class; c-- {
+		if n := len(q.queues[c]); n > 0 {
+			q.queues[c][n-1] <- false
+			q.queues[c] = q.queues[c][:n-1]
+			q.waiting--
+			q.displaced++
+			return true
+		}
+	}
+	return false
+}
+
+func (q *streamSlots) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for c := range q.queues {
+		if len(q.queues[c]) > 0 {
+			q.queues[c][0] <- true
+			q.queues[c] = q.queues[c][1:]
+			q.waiting--
+			return
+		}
+	}
+	q.free++
+}
+
+// stats returns the streams waiting in each class and the streams
+// displaced so far.
+func (q *streamSlots) stats() (waiting [conf.PriorityClasses]int, displaced uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for c := range q.queues {
+		waiting[c] = len(q.queues[c])
+	}
+	return waiting, q.displaced
+}
+
+func indexOf(ws []chan bool, w chan bool) int {
+	for i := range ws {
+		if ws[i] == w {
+			return i
+		}
+	}
+	return -1
+}
+
+// classOf returns the priority class of the client on conn: by the ID it
+// authenticated with, or by its address alone before or without a hello.
+func (s *Server) classOf(conn tnet.Conn) int {
+	if len(s.cfg.Server.Priority) == 0 {
+		return conf.PriorityNormal
+	}
+	if v, ok := s.authed.Load(conn); ok {
+		return v.(int)
+	}
+	return s.cfg.Server.Priority.Class("", remoteIP(conn.RemoteAddr()))
+}
+
+func remoteIP(addr net.Addr) netip.Addr {
+	if ua, ok := addr.(*net.UDPAddr); ok {
+		ip, _ := netip.AddrFromSlice(ua.IP)
+		return ip
+	}
+	ap, _ := netip.ParseAddrPort(addr.String())
+	return ap.Addr()
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+)
+
+// handleReserve holds a stream the client opened ahead of use until its
+// real header arrives, then serves it like a freshly opened stream.
+func (s *Server) handleReserve(ctx context.Context, conn tnet.Conn, strm tnet.Strm) error {
+	_ = strm.SetReadDeadline(time.Now().Add(protocol.ReserveIdle))
+	var p protocol.Proto
+	if err := p.Read(strm); err != nil {
+		flog.Debugf("reserved stream %s from %s released unused: %v", strm.CID(), strm.RemoteAddr(), err)
+		return nil
+	}
+	_ = strm.SetReadDeadline(time.Time{})
+	if p.Type == protocol.PRSV {
+		return fmt.Errorf("nested reserve header on stream %s", strm.CID())
+	}
+	return s.dispatch(ctx, conn, strm, &p)
+}
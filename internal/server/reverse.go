@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+)
+
+// reverseListener is a port opened on behalf of a client, see
+// handleReverse.
+type reverseListener struct {
+	owner string // ClientID, or the connection's address for old clients
+	ln    net.Listener
+}
+
+// handleReverse serves a reverse forward: it listens on p.Addr and, for
+// every TCP connection accepted there, opens a stream back to the client on
+// conn. The listener lives as long as strm, which the client keeps open;
+// a client reconnecting on a new transport connection takes its listeners
+// over.
+func (s *Server) handleReverse(ctx context.Context, conn tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	reply := p.Reply(protocol.PREV)
+	if p.Addr == nil || !s.cfg.Server.Reverse.Allow(p.Addr.Port) {
+		_ = reply.Write(strm)
+		return fmt.Errorf("reverse forward on %v refused: port not allowed by server.reverse", p.Addr)
+	}
+	addr := p.Addr.String()
+	owner, err := s.owner(conn, p)
+	if err != nil {
+		_ = reply.Write(strm)
+		return err
+	}
+
+	s.reverseMu.Lock()
+	if old, ok := s.reverses[addr]; ok {
+		if old.owner != owner {
+			s.reverseMu.Unlock()
+			_ = reply.Write(strm)
+			return fmt.Errorf("reverse forward on %s refused: in use by another client", addr)
+		}
+		_ = old.ln.Close()
+		delete(s.reverses, addr)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.reverseMu.Unlock()
+		_ = reply.Write(strm)
+		return fmt.Errorf("reverse forward on %s: %w", addr, err)
+	}
+	r := &reverseListener{owner: owner, ln: ln}
+	s.reverses[addr] = r
+	s.reverseMu.Unlock()
+	defer func() {
+		_ = ln.Close()
+		s.reverseMu.Lock()
+		if s.reverses[addr] == r {
+			delete(s.reverses, addr)
+		}
+		s.reverseMu.Unlock()
+		flog.Infof("reverse forward on %s for %s closed", addr, owner)
+	}()
+
+	reply.Addr = p.Addr
+	if err := reply.Write(strm); err != nil {
+		return err
+	}
+	flog.Infof("reverse forward on %s opened for %s (stream %s)", addr, owner, strm.CID())
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveReverse(ctx, conn, p.Addr, c)
+		}
+	}()
+
+	// The client never writes on the control stream; it ends when the
+	// client closes it or the transport connection goes away.
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, strm)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// serveReverse carries one connection accepted on a reverse listener to the
+// client over a stream the server opens on conn.
+func (s *Server) serveReverse(ctx context.Context, conn tnet.Conn, addr *tnet.Addr, c net.Conn) {
+	strm, err := conn.OpenStrm(ctx)
+	if err != nil {
+		flog.Warnf("reverse forward on %s: failed to open stream to client for %s: %v", addr, c.RemoteAddr(), err)
+		_ = c.Close()
+		return
+	}
+	strm = s.track(strm, "tcp", c.RemoteAddr().String())
+	defer strm.Close()
+
+	p := protocol.Proto{Type: protocol.PREV, Addr: addr, CID: strm.CID()}
+	if err := p.Write(strm); err != nil {
+		flog.Warnf("reverse forward on %s: failed to send header on stream %s: %v", addr, strm.CID(), err)
+		_ = c.Close()
+		return
+	}
+	flog.Debugf("reverse forward on %s: %s on stream %s", addr, c.RemoteAddr(), strm.CID())
+	_ = s.relayTCP(ctx, strm, c, c.RemoteAddr().String(), nil)
+}
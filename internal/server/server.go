@@ -2,57 +2,146 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
-	"os"
-	"os/signal"
+	"net/http"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
+	"paqet/internal/admin"
 	"paqet/internal/conf"
+	"paqet/internal/diag"
+	"paqet/internal/features"
 	"paqet/internal/flog"
+	"paqet/internal/ha"
+	"paqet/internal/handoff"
+	"paqet/internal/logship"
+	"paqet/internal/metrics"
 	"paqet/internal/pkg/connpool"
+	"paqet/internal/protocol"
 	"paqet/internal/socket"
+	"paqet/internal/tap"
 	"paqet/internal/tnet"
+	"paqet/internal/tnet/framed"
 	"paqet/internal/tnet/kcp"
 	"paqet/internal/tnet/quic"
+	"paqet/internal/tnet/ws"
 	"paqet/internal/tunnel"
 )
 
 type Server struct {
-	cfg             *conf.Conf
-	pConn           *socket.PacketConn
-	tun             *tunnel.TUN
-	wg              sync.WaitGroup
-	streamSemaphore chan struct{} // Limits concurrent stream processing
-	connPools       map[string]*connpool.ConnPool
-	connPoolsMu     sync.RWMutex
+	cfg         *conf.Conf
+	started     time.Time
+	pConn       *socket.PacketConn
+	tun         *tunnel.TUN
+	prefixes    *prefixLeases  // IPv6 /64s delegated to TUN clients
+	addrs       *addrLeases    // tunnel addresses leased from tun.pool
+	ha          *ha.Replicator // lease replication to a standby server
+	wg          sync.WaitGroup
+	streamSlots *streamSlots // Limits concurrent stream processing
+	connPools   map[string]*connpool.ConnPool
+	connPoolsMu sync.RWMutex
+
+	streams       *metrics.Streams // nil unless metrics or the admin API are enabled
+	traffic       *metrics.Traffic // nil unless metrics or the admin API are enabled
+	live          *liveStreams     // nil unless the admin API is enabled
+	dests         *destStats       // nil unless dest_stats is enabled
+	tap           *tap.Tap         // nil unless tap.socket is set
+	connsAccepted metrics.Counter
+	dialsCached   metrics.Counter
+	features      *features.Set
+
+	streamsRefused metrics.Counter
+	framing        framed.Stats // PUDP streams the client frames
+
+	helloSeen *protocol.ReplayCache // nil unless transport.psk is set
+	authed    sync.Map              // tnet.Conn -> priority class, connections past the hello
+	helloDone sync.Map              // tnet.Conn -> *helloWaiters, streams held until its hello is handled
+	clients   sync.Map              // tnet.Conn -> ClientID from the hello, or else the first stream naming one
+
+	dialFailures *dialFailures // nil if performance.dial_failure_ttl is -1
+
+	dialSlots      *dialSlots // nil unless performance.max_dials_per_target is set
+	dialsThrottled metrics.Counter
+
+	dupMu sync.Mutex
+	dups  map[string]*legGroup // multi-leg streams by Proto.Dup
+
+	reverseMu sync.Mutex
+	reverses  map[string]*reverseListener // reverse forwards by listen address
+
+	conns      sync.Map                      // tnet.Conn -> remote address, accepted connections
+	draining   sync.Map                      // remote addresses of the connections a handoff or shutdown drains
+	handingOff atomic.Bool                   // a handoff or shutdown is draining
+	child      atomic.Pointer[handoff.Child] // process handed off to, see handOff
+	stopping   atomic.Bool                   // new streams are refused, see shutDown
+	stopper    atomic.Pointer[stopper]       // set once the listener is up
 }
 
 func New(cfg *conf.Conf) (*Server, error) {
 	s := &Server{
-		cfg: cfg,
+		cfg:     cfg,
+		started: time.Now(),
+		dups:    make(map[string]*legGroup),
+
+		reverses: make(map[string]*reverseListener),
 	}
 
 	// Initialize semaphore for limiting concurrent streams
 	maxStreams := cfg.Performance.MaxConcurrentStreams
 	if maxStreams > 0 {
-		s.streamSemaphore = make(chan struct{}, maxStreams)
+		s.streamSlots = newStreamSlots(maxStreams, cfg.Performance.StreamBacklog)
+	}
+
+	// Pools are also created on demand for streams hinted ReuseWarm, even
+	// when pooling is disabled globally.
+	s.connPools = make(map[string]*connpool.ConnPool)
+
+	if cfg.Metrics.Enabled() || cfg.Admin.Enabled() {
+		s.streams = metrics.NewStreams()
+	}
+	if cfg.Metrics.Enabled() || cfg.Admin.Enabled() {
+		s.traffic = metrics.NewTraffic()
+	}
+	if cfg.Admin.Enabled() {
+		s.live = &liveStreams{}
+	}
+	if cfg.DestStats.Enabled() {
+		s.dests = newDestStats(cfg.DestStats)
+	}
+
+	if ttl := cfg.Performance.DialFailureTTL; ttl > 0 {
+		s.dialFailures = newDialFailures(time.Duration(ttl) * time.Second)
+	}
+	if n := cfg.Performance.MaxDialsPerTarget; n > 0 {
+		s.dialSlots = newDialSlots(n, cfg.Performance.DialQueue)
 	}
 
-	// Initialize connection pools map if enabled
-	if cfg.Performance.ConnectionPoolingEnabled() {
-		s.connPools = make(map[string]*connpool.ConnPool)
+	if cfg.Transport.PSK != "" {
+		s.helloSeen = protocol.NewReplayCache()
 	}
 
+	s.features = features.New()
+	s.features.Register(features.Pooling, "Pool upstream TCP connections for streams without a reuse hint", "new streams",
+		cfg.Performance.ConnectionPoolingEnabled(), nil)
+
 	return s, nil
 }
 
-// getConnPool gets or creates a connection pool for a specific target address
-func (s *Server) getConnPool(addr string) (*connpool.ConnPool, error) {
-	if !s.cfg.Performance.ConnectionPoolingEnabled() {
+// getConnPool gets or creates a connection pool for a specific target address,
+// honouring the client's reuse hint over the global pooling policy.
+func (s *Server) getConnPool(ctx context.Context, addr string, reuse protocol.Reuse) (*connpool.ConnPool, error) {
+	switch reuse {
+	case protocol.ReuseNone:
 		return nil, nil
+	case protocol.ReuseWarm:
+	default:
+		if !s.features.Enabled(features.Pooling) {
+			return nil, nil
+		}
 	}
 
 	s.connPoolsMu.RLock()
@@ -75,11 +164,11 @@ func (s *Server) getConnPool(addr string) (*connpool.ConnPool, error) {
 
 	// Create connection factory
 	factory := func(ctx context.Context) (net.Conn, error) {
-		dialer := &net.Dialer{Timeout: 10 * time.Second}
-		return dialer.DialContext(ctx, "tcp", addr)
+		return s.dial(ctx, "tcp", addr)
 	}
 
 	pool, err := connpool.New(
+		ctx,
 		s.cfg.Performance.TCPConnectionPoolSize,
 		time.Duration(s.cfg.Performance.TCPConnectionIdleTimeout)*time.Second,
 		factory,
@@ -92,17 +181,60 @@ func (s *Server) getConnPool(addr string) (*connpool.ConnPool, error) {
 	return pool, nil
 }
 
-func (s *Server) Start() error {
-	ctx, cancel := context.WithCancel(context.Background())
+// Start serves until ctx is done or a shutdown or handoff stops the server.
+func (s *Server) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(sig)
-	go func() {
-		<-sig
-		flog.Infof("Shutdown signal received, initiating graceful shutdown...")
-		cancel()
-	}()
+
+	var a *admin.Server
+	if s.cfg.Admin.Enabled() {
+		a = admin.New(&s.cfg.Admin)
+		a.HandleConfig(s.cfg)
+		a.HandleFeatures(s.features)
+		a.Handle("GET /status", s.Status)
+		a.Handle("GET /traffic", s.Traffic)
+		a.Handle("POST /drain", s.Drain)
+		a.Handle("GET /clients", s.Clients)
+		a.Handle("POST /clients/kick", s.KickClient)
+		a.Handle("GET /streams", s.Streams)
+		a.Handle("POST /streams/{id}/close", s.CloseStream)
+		a.Handle("GET /pools", func(*http.Request) (any, error) { return s.Pools(), nil })
+		a.Handle("GET /drops", s.Drops)
+		a.Handle("GET /destinations", s.Destinations)
+		if err := a.Start(ctx); err != nil {
+			return err
+		}
+	}
+	dump := diag.New(s.cfg.Admin.ProfileDir, s.cfg)
+	dump.Add("connections", s.Connections)
+	dump.Add("pools", s.Pools)
+	dump.Watch(ctx)
+	if s.cfg.Tap.Enabled() {
+		t, err := tap.Listen(s.cfg.Tap.Socket, s.cfg.Tap.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to start tap: %w", err)
+		}
+		defer t.Close()
+		s.tap = t
+		flog.Warnf("insecure debug tap serving decrypted stream activity on %s", s.cfg.Tap.Socket)
+	}
+	var logs *logship.Shipper
+	if s.cfg.Log.Ship.Enabled() {
+		logs = logship.Start(ctx, &s.cfg.Log.Ship, func(ctx context.Context) (io.WriteCloser, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", s.cfg.Log.Ship.Addr)
+		})
+	}
+	if s.cfg.Metrics.Enabled() {
+		m := metrics.New(&s.cfg.Metrics)
+		m.Register(s.Collect)
+		if logs != nil {
+			m.Register(logs.Collect)
+		}
+		if err := m.Start(ctx); err != nil {
+			return err
+		}
+	}
 
 	// Initialize TUN if enabled
 	if s.cfg.TUN.Enabled {
@@ -112,31 +244,107 @@ func (s *Server) Start() error {
 		}
 		s.tun = tun
 		defer tun.Close()
+		if err := tun.Activate(); err != nil {
+			return fmt.Errorf("failed to configure TUN DNS: %v", err)
+		}
 		flog.Infof("TUN device initialized: %s (%s)", s.cfg.TUN.Name, s.cfg.TUN.Addr)
+		if a != nil {
+			a.HandleTUN(tun)
+		}
+		if tun.Sharded() {
+			go func() {
+				if err := tun.Shard(ctx); err != nil && ctx.Err() == nil {
+					flog.Errorf("TUN queue relay stopped: %v", err)
+				}
+			}()
+		}
+
+		if s.cfg.TUN.PrefixPool != nil {
+			pool, err := tunnel.NewSubnetPool(s.cfg.TUN.PrefixPool, 64)
+			if err != nil {
+				return fmt.Errorf("failed to initialize prefix pool: %v", err)
+			}
+			grace := prefixHold
+			if s.cfg.HA.Enabled() {
+				grace = time.Duration(s.cfg.HA.LeaseGrace) * time.Second
+			}
+			s.prefixes = newPrefixLeases(pool, grace)
+			flog.Infof("IPv6 prefix delegation enabled from %s", s.cfg.TUN.PrefixPool)
+		}
+		if s.cfg.TUN.Pool != nil {
+			addrs, err := newAddrLeases(&s.cfg.TUN)
+			if err != nil {
+				return fmt.Errorf("failed to initialize tunnel address pool: %v", err)
+			}
+			s.addrs = addrs
+			flog.Infof("tunnel address assignment enabled from %s", s.cfg.TUN.Pool)
+		}
 	}
 
-	pConn, err := socket.New(ctx, &s.cfg.Network)
-	if err != nil {
-		return fmt.Errorf("could not create raw packet conn: %w", err)
+	if s.cfg.HA.Enabled() {
+		if s.prefixes == nil && s.addrs == nil {
+			flog.Warnf("ha is configured but there is no lease state to replicate (neither tun.prefix_pool nor tun.pool is set)")
+		} else {
+			s.ha = ha.New(&s.cfg.HA, s.leaseSnapshot, s.applyPeerEvent, s.takeOverPeerLeases)
+			if err := s.ha.Start(ctx); err != nil {
+				return err
+			}
+			defer s.ha.Wait()
+		}
+	}
+
+	if s.cfg.Egress.Rules {
+		teardown, err := s.setupEgressRules()
+		if err != nil {
+			return err
+		}
+		defer s.unlessHandedOff(teardown)
+	}
+
+	var pConn *socket.PacketConn
+	var err error
+	if s.cfg.Transport.Protocol != "websocket" {
+		if s.cfg.Network.Pacing.Enabled() {
+			j := tunnel.OpenJournal(s.cfg.Network.Pacing.Journal)
+			defer s.unlessHandedOff(j.Rollback)
+			if err := socket.InstallPacing(&s.cfg.Network, j.Record); err != nil {
+				return err
+			}
+		}
+		pConn, err = socket.New(ctx, &s.cfg.Network)
+		if err != nil {
+			return fmt.Errorf("could not create raw packet conn: %w", err)
+		}
+		s.pConn = pConn
+		go s.monitorPacketStats(ctx)
+	}
+	if s.cfg.Network.Gate.Decoy != nil {
+		if err := s.serveDecoy(ctx); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Kcptun.Enabled() {
+		if err := s.serveKcptun(ctx); err != nil {
+			return err
+		}
 	}
-	s.pConn = pConn
-	go s.monitorPacketStats(ctx)
 
 	var listener tnet.Listener
 	switch s.cfg.Transport.Protocol {
 	case "kcp":
-		listener, err = kcp.Listen(s.cfg.Transport.KCP, pConn)
+		listener, err = kcp.Listen(s.cfg.Transport.KCP, &s.cfg.Transport.Obfs, pConn)
 		if err != nil {
 			return fmt.Errorf("could not start KCP listener: %w", err)
 		}
 	case "quic":
-		listener, err = quic.Listen(s.cfg.Transport.QUIC, pConn)
+		listener, err = quic.Listen(ctx, s.cfg.Transport.QUIC, &s.cfg.Transport.Obfs, pConn)
 		if err != nil {
 			return fmt.Errorf("could not start QUIC listener: %w", err)
 		}
-		// Set context on QUIC listener for proper cancellation
-		if quicListener, ok := listener.(interface{ SetContext(context.Context) }); ok {
-			quicListener.SetContext(ctx)
+	case "websocket":
+		listener, err = ws.Listen(s.cfg.Listen.Addr, s.cfg.Transport.WS)
+		if err != nil {
+			return fmt.Errorf("could not start WebSocket listener: %w", err)
 		}
 	default:
 		return fmt.Errorf("unsupported transport protocol: %s", s.cfg.Transport.Protocol)
@@ -146,6 +354,8 @@ func (s *Server) Start() error {
 		<-ctx.Done()
 		_ = listener.Close()
 	}()
+	s.adopt()
+	s.stopper.Store(&stopper{listener: listener, stop: cancel})
 
 	poolingStatus := "disabled"
 	if s.cfg.Performance.ConnectionPoolingEnabled() {
@@ -168,14 +378,12 @@ func (s *Server) Start() error {
 	s.wg.Wait()
 
 	// Close all connection pools
-	if s.cfg.Performance.ConnectionPoolingEnabled() {
-		s.connPoolsMu.Lock()
-		for addr, pool := range s.connPools {
-			flog.Debugf("closing connection pool for %s", addr)
-			pool.Close()
-		}
-		s.connPoolsMu.Unlock()
+	s.connPoolsMu.Lock()
+	for addr, pool := range s.connPools {
+		flog.Debugf("closing connection pool for %s", addr)
+		pool.Close()
 	}
+	s.connPoolsMu.Unlock()
 
 	flog.Infof("Server shutdown completed")
 	return nil
@@ -199,15 +407,29 @@ func (s *Server) listen(ctx context.Context, listener tnet.Listener) {
 				return
 			default:
 			}
+			if errors.Is(err, tnet.ErrConnClosed) {
+				flog.Debugf("listener closed, accept loop stopped")
+				return
+			}
 			flog.Errorf("failed to accept connection: %v", err)
 			continue
 		}
+		if s.stopping.Load() {
+			flog.Debugf("closing connection from %s accepted while shutting down", conn.RemoteAddr())
+			_ = conn.Close()
+			continue
+		}
 		flog.Infof("accepted new connection from %s (local: %s)", conn.RemoteAddr(), conn.LocalAddr())
+		s.connsAccepted.Inc()
 
+		s.trackConn(conn)
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
+			defer s.untrackConn(conn)
 			defer conn.Close()
+			defer s.releasePrefix(conn)
+			defer s.releaseAddr(conn)
 			s.handleConn(ctx, conn)
 		}()
 	}
@@ -217,7 +439,7 @@ func (s *Server) monitorPacketStats(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	var lastDropped uint64
+	var lastDropped, lastBadCsum uint64
 	for {
 		select {
 		case <-ctx.Done():
@@ -229,10 +451,20 @@ func (s *Server) monitorPacketStats(ctx context.Context) {
 			dropped := s.pConn.DroppedPackets()
 			queueDepth := s.pConn.QueueDepth()
 			if dropped > lastDropped || queueDepth > 0 {
-				flog.Warnf("server packet pressure: dropped=%d (+%d), queue_depth=%d",
-					dropped, dropped-lastDropped, queueDepth)
+				flog.Warnf("server packet pressure: dropped=%d (+%d) %s, queue_depth=%d",
+					dropped, dropped-lastDropped, socket.FormatDrops(s.pConn.DropStats()), queueDepth)
 			}
 			lastDropped = dropped
+			if bad := s.pConn.BadChecksums(); bad > lastBadCsum {
+				flog.Warnf("server dropped %d received packets with bad TCP checksums", bad-lastBadCsum)
+				lastBadCsum = bad
+			}
 		}
 	}
 }
+
+// track registers strm, a stream of kind relaying to target, with metrics,
+// the admin API and the debug tap.
+func (s *Server) track(strm tnet.Strm, kind, target string) tnet.Strm {
+	return s.tap.Wrap(s.live.Track(s.streams.Track(strm, kind), kind, target), kind)
+}
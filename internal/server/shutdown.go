@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"paqet/internal/flog"
+	"paqet/internal/tnet"
+)
+
+// errShuttingDown refuses the streams clients open while the server shuts
+// down.
+var errShuttingDown = errors.New("server is shutting down")
+
+// stopper is what shutDown needs from Start once the listener is up.
+type stopper struct {
+	listener tnet.Listener
+	stop     context.CancelFunc
+}
+
+// shutdownState is the outcome of starting a graceful shutdown.
+type shutdownState struct {
+	Connections int       `json:"connections"`
+	Deadline    time.Time `json:"deadline"`
+}
+
+// shutDown stops the server gracefully: it takes no new connections or
+// streams, and stops once the streams it has have ended or grace has passed.
+func (s *Server) shutDown(grace time.Duration) (*shutdownState, error) {
+	st := s.stopper.Load()
+	if st == nil {
+		return nil, fmt.Errorf("server is not listening yet")
+	}
+	if !s.handingOff.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("a handoff or shutdown is already in progress")
+	}
+	s.stopping.Store(true)
+
+	// Packets of new flows are dropped, as during a handoff, so that only
+	// the clients already connected get through.
+	n := 0
+	s.conns.Range(func(_, addr any) bool {
+		s.draining.Store(addr, struct{}{})
+		n++
+		return true
+	})
+	if s.pConn != nil {
+		s.pConn.SetFilter(func(addr net.Addr) bool {
+			_, ok := s.draining.Load(addr.String())
+			return ok
+		})
+	}
+	if d, ok := st.listener.(interface{ Drain() }); ok {
+		d.Drain()
+	}
+	flog.Infof("shutting down, draining %d connections for up to %s", n, grace)
+	go s.drain(st.stop, grace)
+	return &shutdownState{Connections: n, Deadline: time.Now().Add(grace)}, nil
+}
+
+// Shutdown starts a graceful shutdown with server.shutdown_grace. It returns
+// false if the server should be stopped at once instead, because no grace
+// is configured or the shutdown could not start.
+func (s *Server) Shutdown() bool {
+	grace := s.shutdownGrace()
+	if grace == 0 {
+		return false
+	}
+	if _, err := s.shutDown(grace); err != nil {
+		flog.Warnf("cannot shut down gracefully: %v", err)
+		return false
+	}
+	return true
+}
+
+// shutdownGrace returns server.shutdown_grace as a duration, zero if the
+// server stops at once.
+func (s *Server) shutdownGrace() time.Duration {
+	return time.Duration(max(s.cfg.Server.ShutdownGrace, 0)) * time.Second
+}
+
+// Drain serves POST /drain, which shuts the server down as SIGTERM does.
+func (s *Server) Drain(_ *http.Request) (any, error) {
+	return s.shutDown(s.shutdownGrace())
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"paqet/internal/admin"
+)
+
+// Status serves the summary printed by paqet status.
+func (s *Server) Status(_ *http.Request) (any, error) {
+	st := admin.Status{
+		Role:      "server",
+		Started:   s.started,
+		Uptime:    time.Since(s.started).Seconds(),
+		Transport: s.cfg.Transport.Protocol,
+		Addr:      s.cfg.Listen.Addr.String(),
+	}
+	st.Streams, st.BytesIn, st.BytesOut = s.streams.Totals()
+	s.conns.Range(func(_, _ any) bool {
+		st.Connections++
+		return true
+	})
+	if s.pConn != nil {
+		st.Dropped = s.pConn.DroppedPackets()
+		st.DropsBy = s.pConn.DropStats()
+		st.QueueDepth = s.pConn.QueueDepth()
+	}
+	return st, nil
+}
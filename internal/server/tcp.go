@@ -7,20 +7,31 @@ import (
 	"paqet/internal/pkg/buffer"
 	"paqet/internal/protocol"
 	"paqet/internal/tnet"
-	"time"
 )
 
-func (s *Server) handleTCPProtocol(ctx context.Context, strm tnet.Strm, p *protocol.Proto) error {
-	flog.Infof("accepted TCP stream %d: %s -> %s", strm.SID(), strm.RemoteAddr(), p.Addr.String())
-	return s.handleTCP(ctx, strm, p.Addr.String())
+func (s *Server) handleTCPProtocol(ctx context.Context, conn tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	flog.Infof("accepted TCP stream %s (client stream %s): %s -> %s", strm.CID(), p.CID, strm.RemoteAddr(), p.Addr.String())
+	return s.handleTCP(ctx, strm, p.Addr.String(), p.Reuse, s.dests.sample(conn, p.Addr.Host))
 }
 
-func (s *Server) handleTCP(ctx context.Context, strm tnet.Strm, addr string) error {
+// handleTCP relays strm to addr. sample, if not nil, measures the stream
+// for dest_stats.
+func (s *Server) handleTCP(ctx context.Context, strm tnet.Strm, addr string, reuse protocol.Reuse, sample *destSample) error {
 	var conn net.Conn
 	var err error
 	
-	// Try to get connection from pool if enabled
-	pool, poolErr := s.getConnPool(addr)
+	// TLS-originated connections are dialed per stream and never pooled
+	if up := s.upstreamTLS(addr); up != nil {
+		conn, err = s.dialTLS(ctx, addr, up)
+		if err != nil {
+			flog.Errorf("failed to establish TLS connection to %s for stream %s: %v", addr, strm.CID(), err)
+			return err
+		}
+		return s.relayTCP(ctx, strm, conn, addr, sample)
+	}
+
+	// Try to get connection from pool if enabled or hinted by the client
+	pool, poolErr := s.getConnPool(ctx, addr, reuse)
 	if poolErr != nil {
 		flog.Warnf("failed to get connection pool for %s: %v, falling back to direct dial", addr, poolErr)
 	}
@@ -35,30 +46,37 @@ func (s *Server) handleTCP(ctx context.Context, strm tnet.Strm, addr string) err
 	
 	// Fall back to direct dial if pooling is disabled or failed
 	if pool == nil {
-		dialer := &net.Dialer{Timeout: 10 * time.Second}
-		conn, err = dialer.DialContext(ctx, "tcp", addr)
+		conn, err = s.dial(ctx, "tcp", addr)
 		if err != nil {
-			flog.Errorf("failed to establish TCP connection to %s for stream %d: %v", addr, strm.SID(), err)
+			flog.Errorf("failed to establish TCP connection to %s for stream %s: %v", addr, strm.CID(), err)
 			return err
 		}
 	}
-	
+	return s.relayTCP(ctx, strm, conn, addr, sample)
+}
+
+// relayTCP copies data between strm and the upstream conn until either side
+// finishes, then closes conn.
+func (s *Server) relayTCP(ctx context.Context, strm tnet.Strm, conn net.Conn, addr string, sample *destSample) error {
+	sample.begin(conn)
 	defer func() {
+		sample.end(conn)
 		conn.Close()
-		flog.Debugf("closed TCP connection %s for stream %d", addr, strm.SID())
+		flog.Debugf("closed TCP connection %s for stream %s", addr, strm.CID())
 	}()
-	flog.Debugf("TCP connection established to %s for stream %d", addr, strm.SID())
+	flog.Debugf("TCP connection established to %s for stream %s", addr, strm.CID())
 
+	up := s.traffic.Wrap(conn, "tcp")
 	errChan := make(chan error, 2)
 	go func() {
-		err := buffer.CopyT(conn, strm)
+		err := buffer.CopyT(up, strm)
 		select {
 		case errChan <- err:
 		case <-ctx.Done():
 		}
 	}()
 	go func() {
-		err := buffer.CopyT(strm, conn)
+		err := buffer.CopyT(strm, up)
 		select {
 		case errChan <- err:
 		case <-ctx.Done():
@@ -68,7 +86,7 @@ func (s *Server) handleTCP(ctx context.Context, strm tnet.Strm, addr string) err
 	select {
 	case err := <-errChan:
 		if err != nil {
-			flog.Errorf("TCP stream %d to %s failed: %v", strm.SID(), addr, err)
+			flog.Errorf("TCP stream %s to %s failed: %v", strm.CID(), addr, err)
 			// Mark connection as unusable if it's from a pool
 			if pc, ok := conn.(interface{ MarkUnusable() }); ok {
 				pc.MarkUnusable()
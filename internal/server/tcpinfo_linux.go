@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpCounts is what destStats reads from an upstream TCP connection.
+type tcpCounts struct {
+	segsOut, retrans uint64
+	rtt              time.Duration
+}
+
+// readTCPCounts reads the kernel's counters for conn, looking through TLS
+// and pooled connections to the TCP socket underneath.
+func readTCPCounts(conn net.Conn) (tcpCounts, bool) {
+	for {
+		u, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = u.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return tcpCounts{}, false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return tcpCounts{}, false
+	}
+	var info *unix.TCPInfo
+	err = raw.Control(func(fd uintptr) {
+		info, err = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil || info == nil {
+		return tcpCounts{}, false
+	}
+	return tcpCounts{
+		segsOut: uint64(info.Segs_out),
+		retrans: uint64(info.Total_retrans),
+		rtt:     time.Duration(info.Rtt) * time.Microsecond,
+	}, true
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package server
+
+import (
+	"net"
+	"time"
+)
+
+type tcpCounts struct {
+	segsOut, retrans uint64
+	rtt              time.Duration
+}
+
+// TCP_INFO is Linux-only; elsewhere destStats reports tunnel loss only.
+func readTCPCounts(net.Conn) (tcpCounts, bool) {
+	return tcpCounts{}, false
+}
@@ -3,51 +3,102 @@ package server
 import (
 	"context"
 	"io"
+	"net/netip"
 	"paqet/internal/flog"
 	"paqet/internal/pkg/buffer"
+	"paqet/internal/protocol"
 	"paqet/internal/tnet"
 )
 
-func (s *Server) handleTUNProtocol(ctx context.Context, strm tnet.Strm) error {
-	flog.Infof("TUN stream %d from %s: starting tunnel relay", strm.SID(), strm.RemoteAddr())
+func (s *Server) handleTUNProtocol(ctx context.Context, conn tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	flog.Infof("TUN stream %s (client stream %s) from %s: starting tunnel relay", strm.CID(), p.CID, strm.RemoteAddr())
 
 	if !s.cfg.TUN.Enabled || s.tun == nil {
 		flog.Errorf("TUN stream received but TUN is not enabled on server")
 		return io.ErrClosedPipe
 	}
+	if p.Offload != s.cfg.TUN.Offload {
+		flog.Errorf("TUN stream %s: tun.offload is %t on the client but %t on the server", strm.CID(), p.Offload, s.cfg.TUN.Offload)
+		return io.ErrClosedPipe
+	}
+	client, err := s.owner(conn, p)
+	if err != nil {
+		return err
+	}
 
 	// Start bidirectional relay between stream and TUN device
 	errCh := make(chan error, 2)
+	peer, detach := s.tun.Peer(strm)
+	defer detach()
+	dev := s.tun.Route(s.tun.NextQueue(), peer, client)
+	s.routeLease(client)
+	s.routePrefix(client)
 
 	// Stream -> TUN (using large buffer pool)
 	go func() {
-		err := buffer.CopyTUN(ctx, s.tun, strm)
+		err := buffer.CopyTUN(ctx, dev, s.tun.Source(strm))
 		if err != nil && err != io.EOF && err != context.Canceled {
 			flog.Debugf("Stream to TUN copy error: %v", err)
 		}
 		errCh <- err
 	}()
 
-	// TUN -> Stream (using large buffer pool)
-	go func() {
-		err := buffer.CopyTUN(ctx, strm, s.tun)
-		if err != nil && err != io.EOF && err != context.Canceled {
-			flog.Debugf("TUN to Stream copy error: %v", err)
-		}
-		errCh <- err
-	}()
+	// TUN -> Stream (using large buffer pool); with several queues or
+	// tun.routing the device's Shard workers feed every stream instead
+	if !s.tun.Sharded() {
+		go func() {
+			err := buffer.CopyTUN(ctx, peer, s.tun)
+			if err != nil && err != io.EOF && err != context.Canceled {
+				flog.Debugf("TUN to Stream copy error: %v", err)
+			}
+			errCh <- err
+		}()
+	}
 
 	// Wait for error or context cancellation
 	select {
 	case err := <-errCh:
 		if err != context.Canceled && err != io.EOF {
-			flog.Infof("TUN stream %d closed with error: %v", strm.SID(), err)
+			flog.Infof("TUN stream %s closed with error: %v", strm.CID(), err)
 			return err
 		}
-		flog.Infof("TUN stream %d closed", strm.SID())
+		flog.Infof("TUN stream %s closed", strm.CID())
 		return nil
 	case <-ctx.Done():
-		flog.Infof("TUN stream %d closed due to context cancellation", strm.SID())
+		flog.Infof("TUN stream %s closed due to context cancellation", strm.CID())
 		return ctx.Err()
 	}
 }
+
+// routeLease routes the tunnel address leased to client from tun.pool, if
+// any, to the client's TUN streams.
+func (s *Server) routeLease(client string) {
+	if s.addrs == nil {
+		return
+	}
+	lease := s.addrs.pool.Leases()[client]
+	if lease == nil {
+		return
+	}
+	if addr, ok := netip.AddrFromSlice(lease.IP); ok {
+		s.tun.RouteLease(client, addr.Unmap())
+	}
+}
+
+// routePrefix routes the IPv6 prefix delegated to client, if any, to the
+// client's TUN streams.
+func (s *Server) routePrefix(client string) {
+	if s.prefixes == nil {
+		return
+	}
+	lease := s.prefixes.pool.Leases()[client]
+	if lease == nil {
+		return
+	}
+	ones, _ := lease.Mask.Size()
+	addr, ok := netip.AddrFromSlice(lease.IP)
+	if !ok {
+		return
+	}
+	s.tun.RoutePrefix(client, netip.PrefixFrom(addr.Unmap(), ones))
+}
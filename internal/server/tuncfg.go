@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/ha"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"paqet/internal/tunnel"
+	"slices"
+	"sync"
+)
+
+// addrLeases tracks the tunnel addresses leased from tun.pool and which
+// transport connections hold them. A lease is returned to the pool when the
+// last connection of its client closes.
+type addrLeases struct {
+	pool   *tunnel.SubnetPool
+	owners map[tnet.Conn]string
+	mu     sync.Mutex
+}
+
+// newAddrLeases returns a pool of the host addresses in cfg.Pool, less the
+// server's own address and, for IPv4, the network and broadcast addresses
+// of the tunnel network.
+func newAddrLeases(cfg *conf.TUN) (*addrLeases, error) {
+	_, bits := cfg.Pool.Mask.Size()
+	pool, err := tunnel.NewSubnetPool(cfg.Pool, bits)
+	if err != nil {
+		return nil, err
+	}
+	reserved := map[string]net.IP{"server": cfg.IP}
+	if ip4 := cfg.Net.IP.To4(); ip4 != nil {
+		bcast := make(net.IP, len(ip4))
+		for i := range ip4 {
+			bcast[i] = ip4[i] | ^cfg.Net.Mask[i]
+		}
+		reserved["network"], reserved["broadcast"] = ip4, bcast
+	}
+	for name, ip := range reserved {
+		if cfg.Pool.Contains(ip) {
+			host := &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(bits, bits)}
+			if bits == 32 {
+				host.IP = ip.To4()
+			}
+			if err := pool.Restore("reserved:"+name, host); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &addrLeases{pool: pool, owners: make(map[tnet.Conn]string)}, nil
+}
+
+// handleTUNConfigProtocol leases a tunnel address from tun.pool to the
+// client that owns conn and replies with it, tun.mtu and tun.push_routes.
+func (s *Server) handleTUNConfigProtocol(conn tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	reply := p.Reply(protocol.PTUNCFG)
+	if s.addrs == nil || s.tun == nil {
+		flog.Warnf("tunnel address requested on stream %s but tun.pool is not configured", strm.CID())
+		return reply.Write(strm)
+	}
+
+	owner, err := s.owner(conn, p)
+	if err != nil {
+		_ = reply.Write(strm)
+		return err
+	}
+	l := s.addrs
+	l.mu.Lock()
+	host, err := l.pool.Acquire(owner)
+	if err == nil {
+		l.owners[conn] = owner
+	}
+	l.mu.Unlock()
+	if err != nil {
+		flog.Errorf("failed to lease a tunnel address to %s: %v", owner, err)
+		return reply.Write(strm)
+	}
+
+	if s.ha != nil {
+		s.ha.Publish(ha.Event{Op: ha.OpLease, Pool: ha.PoolAddr, Owner: owner, Subnet: host.String()})
+	}
+	ones, _ := s.cfg.TUN.Net.Mask.Size()
+	reply.TUNAddr = fmt.Sprintf("%s/%d", host.IP, ones)
+	reply.MTU = s.cfg.TUN.MTU
+	reply.Routes = s.cfg.TUN.PushRoutes
+	flog.Infof("leased tunnel address %s to %s (%s)", reply.TUNAddr, owner, conn.RemoteAddr())
+	return reply.Write(strm)
+}
+
+// bindAddr attaches conn to the address leased to owner, if any, so the
+// lease survives when the client replaces the connection it asked on.
+func (s *Server) bindAddr(conn tnet.Conn, owner string) {
+	if s.addrs == nil || owner == "" {
+		return
+	}
+	l := s.addrs
+	if l.pool.Leases()[owner] == nil {
+		return
+	}
+	l.mu.Lock()
+	l.owners[conn] = owner
+	l.mu.Unlock()
+}
+
+// releaseAddr returns the address held by conn to the pool unless another
+// connection of the same client still holds it.
+func (s *Server) releaseAddr(conn tnet.Conn) {
+	if s.addrs == nil {
+		return
+	}
+	l := s.addrs
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	owner, ok := l.owners[conn]
+	delete(l.owners, conn)
+	if !ok || slices.Contains(mapValues(l.owners), owner) {
+		return
+	}
+	if host := l.pool.Release(owner); host != nil {
+		flog.Infof("released tunnel address %s from %s", host.IP, owner)
+		if s.ha != nil {
+			s.ha.Publish(ha.Event{Op: ha.OpRelease, Pool: ha.PoolAddr, Owner: owner})
+		}
+	}
+}
@@ -2,40 +2,44 @@ package server
 
 import (
 	"context"
-	"net"
 	"paqet/internal/flog"
 	"paqet/internal/pkg/buffer"
 	"paqet/internal/protocol"
 	"paqet/internal/tnet"
+	"paqet/internal/tnet/framed"
 )
 
 func (s *Server) handleUDPProtocol(ctx context.Context, strm tnet.Strm, p *protocol.Proto) error {
-	flog.Infof("accepted UDP stream %d: %s -> %s", strm.SID(), strm.RemoteAddr(), p.Addr.String())
+	flog.Infof("accepted UDP stream %s (client stream %s): %s -> %s", strm.CID(), p.CID, strm.RemoteAddr(), p.Addr.String())
+	if p.Framed {
+		strm = framed.New(strm, s.cfg.Transport.UDPFraming.Pace, &s.framing)
+	}
 	return s.handleUDP(ctx, strm, p.Addr.String())
 }
 
 func (s *Server) handleUDP(ctx context.Context, strm tnet.Strm, addr string) error {
-	conn, err := net.Dial("udp", addr)
+	conn, err := s.dial(ctx, "udp", addr)
 	if err != nil {
-		flog.Errorf("failed to establish UDP connection to %s for stream %d: %v", addr, strm.SID(), err)
+		flog.Errorf("failed to establish UDP connection to %s for stream %s: %v", addr, strm.CID(), err)
 		return err
 	}
 	defer func() {
 		conn.Close()
-		flog.Debugf("closed UDP connection %s for stream %d", addr, strm.SID())
+		flog.Debugf("closed UDP connection %s for stream %s", addr, strm.CID())
 	}()
-	flog.Debugf("UDP connection established to %s for stream %d", addr, strm.SID())
+	flog.Debugf("UDP connection established to %s for stream %s", addr, strm.CID())
 
+	up := s.traffic.Wrap(conn, "udp")
 	errChan := make(chan error, 2)
 	go func() {
-		err := buffer.CopyU(conn, strm)
+		err := buffer.CopyU(up, strm)
 		select {
 		case errChan <- err:
 		case <-ctx.Done():
 		}
 	}()
 	go func() {
-		err := buffer.CopyU(strm, conn)
+		err := buffer.CopyU(strm, up)
 		select {
 		case errChan <- err:
 		case <-ctx.Done():
@@ -45,7 +49,7 @@ func (s *Server) handleUDP(ctx context.Context, strm tnet.Strm, addr string) err
 	select {
 	case err := <-errChan:
 		if err != nil {
-			flog.Errorf("UDP stream %d to %s failed: %v", strm.SID(), addr, err)
+			flog.Errorf("UDP stream %s to %s failed: %v", strm.CID(), addr, err)
 			return err
 		}
 	case <-ctx.Done():
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"paqet/internal/conf"
+	"time"
+)
+
+// upstreamTLS returns the first upstream_tls entry matching addr, or nil if
+// the connection should stay plaintext.
+func (s *Server) upstreamTLS(addr string) *conf.UpstreamTLS {
+	for i := range s.cfg.UpstreamTLS {
+		if s.cfg.UpstreamTLS[i].Match(addr) {
+			return &s.cfg.UpstreamTLS[i]
+		}
+	}
+	return nil
+}
+
+// dialTLS dials addr and completes a TLS handshake using up's settings.
+func (s *Server) dialTLS(ctx context.Context, addr string, up *conf.UpstreamTLS) (net.Conn, error) {
+	raw, err := s.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := up.TLSConfig.Clone()
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+		cfg.ServerName = host
+	}
+
+	conn := tls.Client(raw, cfg)
+	hsCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := conn.HandshakeContext(hsCtx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return conn, nil
+}
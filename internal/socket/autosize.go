@@ -0,0 +1,85 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"time"
+)
+
+// autosizeInterval is how often autosize reads the drop counters.
+const autosizeInterval = 10 * time.Second
+
+var errNoDropCounter = errors.New("kernel drop counter of the capture socket is not available")
+
+// newPacketSocket returns the descriptor of the one packet socket in after
+// that is not in before, or -1 if there is not exactly one.
+func newPacketSocket(before, after map[uint64]int) int {
+	fd := -1
+	for ino, n := range after {
+		if _, ok := before[ino]; ok {
+			continue
+		}
+		if fd >= 0 {
+			return -1
+		}
+		fd = n
+	}
+	return fd
+}
+
+// autosize doubles the capture buffer when the kernel drops captured packets
+// and the send queue when it drops packets, each up to its limit in cfg,
+// until ctx is done.
+func autosize(ctx context.Context, cfg *conf.PCAP, send *SendHandle, recv *RecvHandle) {
+	kernel := true
+	if _, err := recv.kernelDrops(); err != nil {
+		flog.Warnf("network.pcap.autosize: %v, only the send queue is autosized", err)
+		kernel = false
+	}
+	dropped := send.DroppedPackets()
+	var bufFull, queueFull bool // limit reached, logged once
+
+	t := time.NewTicker(autosizeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if kernel {
+			n, err := recv.kernelDrops()
+			if err != nil {
+				flog.Warnf("network.pcap.autosize: failed to read kernel drops: %v", err)
+			} else if n > 0 {
+				size := recv.bufferSize()
+				if next := min(size*2, cfg.MaxSockbuf); next > size {
+					if err := recv.resize(next); err != nil {
+						flog.Errorf("network.pcap.autosize: failed to grow the capture buffer to %d bytes: %v", next, err)
+					} else {
+						flog.Infof("kernel dropped %d captured packets, grew network.pcap.sockbuf from %d to %d bytes", n, size, next)
+					}
+				} else if !bufFull {
+					bufFull = true
+					flog.Warnf("kernel dropped %d captured packets with network.pcap.sockbuf at max_sockbuf (%d bytes)", n, size)
+				}
+			}
+		}
+
+		d := send.DroppedPackets()
+		if n := d - dropped; n > 0 {
+			size := send.queueSize()
+			if next := min(size*2, cfg.MaxSendQueueSize); next > size {
+				send.size.Store(int32(next))
+				flog.Infof("send queue dropped %d packets, grew network.pcap.send_queue_size from %d to %d", n, size, next)
+			} else if !queueFull {
+				queueFull = true
+				flog.Warnf("send queue dropped %d packets with network.pcap.send_queue_size at max_send_queue_size (%d)", n, size)
+			}
+		}
+		dropped = d
+	}
+}
@@ -0,0 +1,46 @@
+package socket
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// csumAdd accumulates b into a ones' complement sum.
+func csumAdd(sum uint32, b []byte) uint32 {
+	for len(b) >= 2 {
+		sum += uint32(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+func csumFold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return uint16(sum)
+}
+
+// pseudoHeaderSum returns the unfolded TCP pseudo-header sum.
+func pseudoHeaderSum(src, dst net.IP, length int) uint32 {
+	var sum uint32
+	if s4, d4 := src.To4(), dst.To4(); s4 != nil && d4 != nil {
+		sum = csumAdd(sum, s4)
+		sum = csumAdd(sum, d4)
+	} else {
+		sum = csumAdd(sum, src.To16())
+		sum = csumAdd(sum, dst.To16())
+	}
+	return sum + 6 + uint32(length) // IPPROTO_TCP
+}
+
+// validTCPChecksum verifies the checksum of a received TCP segment given as
+// its header (always a multiple of 4 bytes) and payload.
+func validTCPChecksum(src, dst net.IP, hdr, payload []byte) bool {
+	sum := pseudoHeaderSum(src, dst, len(hdr)+len(payload))
+	sum = csumAdd(csumAdd(sum, hdr), payload)
+	return csumFold(sum) == 0xffff
+}
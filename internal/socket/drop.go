@@ -0,0 +1,130 @@
+package socket
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// DropReason classifies why the send path discarded a packet.
+type DropReason int
+
+const (
+	DropQueueFull DropReason = iota // queue at capacity
+	DropWatermark                   // rejected while above the high watermark
+	DropHead                        // evicted from the head of the queue
+	DropRetry                       // queue full when requeueing a failed write
+	numDropReasons
+)
+
+var dropReasonNames = [numDropReasons]string{"queue_full", "watermark", "head_drop", "retry_full"}
+
+func (r DropReason) String() string {
+	if r < 0 || r >= numDropReasons {
+		return fmt.Sprintf("DropReason(%d)", int(r))
+	}
+	return dropReasonNames[r]
+}
+
+// priorityMaxSize is the largest payload the priority policy treats as
+// control traffic. KCP and QUIC acknowledgements fit well below it.
+const priorityMaxSize = 128
+
+type dropCounters [numDropReasons]atomic.Uint64
+
+func (d *dropCounters) add(r DropReason) {
+	d[r].Add(1)
+}
+
+func (d *dropCounters) total() uint64 {
+	var n uint64
+	for i := range d {
+		n += d[i].Load()
+	}
+	return n
+}
+
+func (d *dropCounters) snapshot() map[string]uint64 {
+	m := make(map[string]uint64, numDropReasons)
+	for i := range d {
+		m[DropReason(i).String()] = d[i].Load()
+	}
+	return m
+}
+
+// FormatDrops renders non-zero drop counters as "[reason=n ...]" in a
+// stable order for log lines.
+func FormatDrops(stats map[string]uint64) string {
+	var parts []string
+	for _, name := range dropReasonNames {
+		if n := stats[name]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", name, n))
+		}
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// admit decides whether req may enter the send queue under the configured
+// watermarks and drop policy, evicting queued packets when the policy says so.
+func (h *SendHandle) admit(req *sendRequest) error {
+	if high, low := h.watermarks(); high > 0 {
+		depth := len(h.sendQueue)
+		if depth >= high {
+			h.congested.Store(true)
+		} else if depth <= low {
+			h.congested.Store(false)
+		}
+	}
+
+	if h.congested.Load() {
+		switch h.cfg.PCAP.DropPolicy {
+		case "head":
+			h.evictHead()
+		case "priority":
+			if len(req.payload) > priorityMaxSize {
+				h.drops.add(DropWatermark)
+				return fmt.Errorf("send queue above high watermark, packet dropped")
+			}
+			h.evictHead()
+		default:
+			h.drops.add(DropWatermark)
+			return fmt.Errorf("send queue above high watermark, packet dropped")
+		}
+	}
+
+	if n := int(h.size.Load()); n > 0 && len(h.sendQueue) >= n {
+		h.drops.add(DropQueueFull)
+		return fmt.Errorf("send queue full, packet dropped")
+	}
+	select {
+	case h.sendQueue <- req:
+		return nil
+	case <-h.ctx.Done():
+		return h.ctx.Err()
+	default:
+		h.drops.add(DropQueueFull)
+		return fmt.Errorf("send queue full, packet dropped")
+	}
+}
+
+// watermarks returns the queue depths that start and end early drop, which
+// follow the queue size as autosize grows it.
+func (h *SendHandle) watermarks() (high, low int) {
+	n := int(h.size.Load())
+	if n == 0 || h.highMark == 0 {
+		return h.highMark, h.lowMark
+	}
+	return max(n*h.cfg.PCAP.HighWatermark/100, 1), n * h.cfg.PCAP.LowWatermark / 100
+}
+
+// evictHead discards the oldest queued packet to make room for a newer one.
+func (h *SendHandle) evictHead() {
+	select {
+	case old := <-h.sendQueue:
+		h.drops.add(DropHead)
+		if old.errChan != nil {
+			old.errChan <- fmt.Errorf("packet evicted from send queue")
+		}
+	default:
+	}
+}
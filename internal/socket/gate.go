@@ -0,0 +1,136 @@
+package socket
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/protocol"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A knock is a random nonce, the sender's clock in Unix seconds and an
+// HMAC-SHA256 of both keyed with transport.psk, truncated to 16 bytes.
+const (
+	knockNonce = 16
+	knockSize  = knockNonce + 8 + 16
+)
+
+// gate drops every packet from a source address that has not knocked, so
+// that a prober gets nothing back from the transport, not even a
+// handshake error. A knock is accepted once, within protocol.HelloSkew of
+// the server's clock, and opens its source address until it has been
+// quiet for the window. Knocks are consumed here and never reach the
+// transport.
+type gate struct {
+	cfg     *conf.Gate
+	seen    *protocol.ReplayCache
+	open    sync.Map // source IP -> *atomic.Int64, Unix nanoseconds of its last packet
+	dropped atomic.Uint64
+}
+
+func newGate(cfg *conf.Gate) *gate {
+	return &gate{cfg: cfg, seen: protocol.NewReplayCache()}
+}
+
+func (g *gate) window() time.Duration {
+	return time.Duration(g.cfg.Window) * time.Second
+}
+
+// admit reports whether payload from addr is passed on to the transport.
+func (g *gate) admit(payload []byte, addr net.Addr, now time.Time) bool {
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	src := string(ua.IP.To16())
+	if len(payload) == knockSize && g.verify(payload, now) {
+		last := &atomic.Int64{}
+		last.Store(now.UnixNano())
+		if v, loaded := g.open.LoadOrStore(src, last); loaded {
+			v.(*atomic.Int64).Store(now.UnixNano())
+		} else {
+			flog.Debugf("gate: %s knocked", ua.IP)
+		}
+		return false
+	}
+	if v, ok := g.open.Load(src); ok {
+		last := v.(*atomic.Int64)
+		if now.UnixNano()-last.Load() < int64(g.window()) {
+			last.Store(now.UnixNano())
+			return true
+		}
+	}
+	g.dropped.Add(1)
+	return false
+}
+
+func (g *gate) verify(k []byte, now time.Time) bool {
+	ts := time.Unix(int64(binary.BigEndian.Uint64(k[knockNonce:])), 0)
+	if d := now.Sub(ts); d > protocol.HelloSkew || d < -protocol.HelloSkew {
+		return false
+	}
+	if !hmac.Equal(k[knockNonce+8:], knockMAC(g.cfg.Key, k[:knockNonce+8])) {
+		return false
+	}
+	return g.seen.Add(k[:knockNonce], now)
+}
+
+// sweep forgets the sources that have been quiet for the window until ctx
+// is done.
+func (g *gate) sweep(ctx context.Context) {
+	t := time.NewTicker(g.window())
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			g.open.Range(func(k, v any) bool {
+				if now.UnixNano()-v.(*atomic.Int64).Load() >= int64(g.window()) {
+					g.open.Delete(k)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func newKnock(key []byte, now time.Time) []byte {
+	k := make([]byte, knockSize)
+	rand.Read(k[:knockNonce])
+	binary.BigEndian.PutUint64(k[knockNonce:], uint64(now.Unix()))
+	copy(k[knockNonce+8:], knockMAC(key, k[:knockNonce+8]))
+	return k
+}
+
+func knockMAC(key, msg []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("paqet knock"))
+	mac.Write(msg)
+	return mac.Sum(nil)[:16]
+}
+
+// knock keeps the client's source open at the server's gate until ctx is
+// done: it knocks at once, again a second later in case the first was
+// lost, then every third of the window.
+func knock(ctx context.Context, cfg *conf.Gate, send *SendHandle) {
+	delay := time.Second
+	for {
+		if err := send.Write(newKnock(cfg.Key, time.Now()), cfg.Knock); err != nil {
+			flog.Debugf("gate: failed to knock: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = time.Duration(cfg.Window) * time.Second / 3
+	}
+}
@@ -0,0 +1,51 @@
+package socket
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"paqet/internal/conf"
+)
+
+func TestGate(t *testing.T) {
+	cfg := &conf.Gate{Window: 60, Key: []byte("0123456789abcdef")}
+	g := newGate(cfg)
+	client := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}
+	prober := &net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 40000}
+	now := time.Now()
+	data := []byte("transport packet")
+
+	if g.admit(data, client, now) {
+		t.Fatal("packet admitted before a knock")
+	}
+	k := newKnock(cfg.Key, now)
+	if g.admit(k, client, now) {
+		t.Fatal("knock passed on to the transport")
+	}
+	if !g.admit(data, &net.UDPAddr{IP: client.IP, Port: 40001}, now) {
+		t.Fatal("packet dropped after a knock")
+	}
+
+	// A replayed knock opens nothing, nor does one with another key or
+	// from a stale clock.
+	g.admit(k, prober, now)
+	g.admit(newKnock([]byte("another key"), now), prober, now)
+	g.admit(newKnock(cfg.Key, now.Add(-5*time.Minute)), prober, now)
+	if g.admit(data, prober, now) {
+		t.Fatal("prober admitted")
+	}
+
+	// The window runs from the last packet.
+	later := now.Add(50 * time.Second)
+	if !g.admit(data, client, later) {
+		t.Fatal("packet dropped within the window")
+	}
+	if g.admit(data, client, later.Add(61*time.Second)) {
+		t.Fatal("packet admitted after the window")
+	}
+	// Invalid knocks are dropped like any other packet.
+	if got := g.dropped.Load(); got != 6 {
+		t.Fatalf("dropped %d packets, want 6", got)
+	}
+}
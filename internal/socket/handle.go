@@ -4,11 +4,20 @@ import (
 	"fmt"
 	"paqet/internal/conf"
 	"runtime"
+	"time"
 
 	"github.com/gopacket/gopacket/pcap"
 )
 
 func newHandle(cfg *conf.Network) (*pcap.Handle, error) {
+	return newHandleTimeout(cfg, cfg.PCAP.Sockbuf, pcap.BlockForever)
+}
+
+// newHandleTimeout opens a capture handle with a buffer of sockbuf bytes and
+// the given packet buffer timeout. A positive timeout puts the handle in
+// non-blocking mode, so reads return pcap.NextErrorTimeoutExpired instead of
+// sleeping until a packet.
+func newHandleTimeout(cfg *conf.Network, sockbuf int, timeout time.Duration) (*pcap.Handle, error) {
 	// On Windows, use the GUID field to construct the NPF device name
 	// On other platforms, use the interface name directly
 	ifaceName := cfg.Interface.Name
@@ -22,8 +31,8 @@ func newHandle(cfg *conf.Network) (*pcap.Handle, error) {
 	}
 	defer inactive.CleanUp()
 
-	if err = inactive.SetBufferSize(cfg.PCAP.Sockbuf); err != nil {
-		return nil, fmt.Errorf("failed to set pcap buffer size to %d: %v", cfg.PCAP.Sockbuf, err)
+	if err = inactive.SetBufferSize(sockbuf); err != nil {
+		return nil, fmt.Errorf("failed to set pcap buffer size to %d: %v", sockbuf, err)
 	}
 
 	if err = inactive.SetSnapLen(65536); err != nil {
@@ -32,7 +41,7 @@ func newHandle(cfg *conf.Network) (*pcap.Handle, error) {
 	if err = inactive.SetPromisc(true); err != nil {
 		return nil, fmt.Errorf("failed to enable promiscuous mode: %v", err)
 	}
-	if err = inactive.SetTimeout(pcap.BlockForever); err != nil {
+	if err = inactive.SetTimeout(timeout); err != nil {
 		return nil, fmt.Errorf("failed to set pcap timeout: %v", err)
 	}
 	if err = inactive.SetImmediateMode(true); err != nil {
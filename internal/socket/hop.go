@@ -0,0 +1,105 @@
+package socket
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"time"
+)
+
+// hopper computes the port hopping schedule: the server port of each
+// interval is drawn from the range by an HMAC of the interval number keyed
+// with transport.psk. Clients send to the port of the current interval and
+// see the server under its configured address whatever port it answers
+// from. Servers capture the ports of the previous, current and next
+// interval, which absorbs clock skew of up to one interval, and answer from
+// the current one. Flows are identified by the client's address, which does
+// not change, so transport sessions survive each hop.
+type hopper struct {
+	cfg *conf.PortHopping
+}
+
+func newHopper(cfg *conf.PortHopping) *hopper {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &hopper{cfg: cfg}
+}
+
+// slot returns the number of the interval t falls in.
+func (h *hopper) slot(t time.Time) int64 {
+	return t.Unix() / int64(h.cfg.Interval)
+}
+
+// port returns the server port of interval slot.
+func (h *hopper) port(slot int64) int {
+	mac := hmac.New(sha256.New, h.cfg.Key)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(slot))
+	mac.Write(b[:])
+	n := binary.BigEndian.Uint32(mac.Sum(nil))
+	return h.cfg.Min + int(n%uint32(h.cfg.Max-h.cfg.Min+1))
+}
+
+// dst returns the port to send to addr on: the current hop for the server,
+// the port of addr for anyone else.
+func (h *hopper) dst(addr *net.UDPAddr) int {
+	if s := h.cfg.Hop; s != nil && addr.Port == s.Port && addr.IP.Equal(s.IP) {
+		return h.port(h.slot(time.Now()))
+	}
+	return addr.Port
+}
+
+// received restores the configured server port in the source address of
+// a packet the server sent from a hop.
+func (h *hopper) received(addr net.Addr) {
+	ua, ok := addr.(*net.UDPAddr)
+	s := h.cfg.Hop
+	if !ok || s == nil || ua.Port < h.cfg.Min || ua.Port > h.cfg.Max || !ua.IP.Equal(s.IP) {
+		return
+	}
+	ua.Port = s.Port
+}
+
+// filter returns the capture filter for the hops around slot.
+func (h *hopper) filter(slot int64) string {
+	return fmt.Sprintf("tcp and (dst port %d or dst port %d or dst port %d)", h.port(slot-1), h.port(slot), h.port(slot+1))
+}
+
+// serve moves the server's capture filter and source port along with the
+// schedule until ctx is done.
+func (h *hopper) serve(ctx context.Context, send *SendHandle, recv *RecvHandle) error {
+	slot := h.slot(time.Now())
+	if err := h.apply(slot, send, recv); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			next := time.Unix((slot+1)*int64(h.cfg.Interval), 0)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			slot = h.slot(time.Now())
+			if err := h.apply(slot, send, recv); err != nil {
+				flog.Errorf("port hopping: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (h *hopper) apply(slot int64, send *SendHandle, recv *RecvHandle) error {
+	if err := recv.setFilter(h.filter(slot)); err != nil {
+		return fmt.Errorf("failed to set BPF filter: %w", err)
+	}
+	send.hopPort.Store(uint32(h.port(slot)))
+	flog.Debugf("port hopping: now on port %d", h.port(slot))
+	return nil
+}
@@ -0,0 +1,46 @@
+package socket
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"paqet/internal/conf"
+)
+
+func TestHopper(t *testing.T) {
+	server := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 443}
+	cfg := &conf.PortHopping{Ports_: "20000-20999", Interval: 60, Min: 20000, Max: 20999, Key: []byte("0123456789abcdef"), Hop: server}
+	h := newHopper(cfg)
+
+	// Both sides must agree on the schedule, and it must move.
+	other := newHopper(&conf.PortHopping{Ports_: cfg.Ports_, Interval: 60, Min: 20000, Max: 20999, Key: cfg.Key})
+	seen := make(map[int]bool)
+	for slot := int64(0); slot < 50; slot++ {
+		p := h.port(slot)
+		if p < 20000 || p > 20999 {
+			t.Fatalf("slot %d on port %d, outside the range", slot, p)
+		}
+		if p != other.port(slot) {
+			t.Fatalf("slot %d: peers disagree on the port", slot)
+		}
+		seen[p] = true
+	}
+	if len(seen) < 10 {
+		t.Fatalf("50 slots used only %d ports", len(seen))
+	}
+
+	want := h.port(h.slot(time.Now()))
+	if got := h.dst(&net.UDPAddr{IP: server.IP, Port: 443}); got != want {
+		t.Fatalf("sent to port %d, want the current hop %d", got, want)
+	}
+	if got := h.dst(&net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 443}); got != 443 {
+		t.Fatalf("another host's port rewritten to %d", got)
+	}
+
+	from := &net.UDPAddr{IP: server.IP, Port: want}
+	h.received(from)
+	if from.Port != 443 {
+		t.Fatalf("reply from the hop seen on port %d, want 443", from.Port)
+	}
+}
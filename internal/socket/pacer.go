@@ -0,0 +1,91 @@
+package socket
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// pacingInterval is the burst a pacer allows: the bytes the rate permits in
+// this much time go out back to back, anything beyond waits.
+const pacingInterval = 2 * time.Millisecond
+
+// pacer is a token bucket in bytes shared by the send workers of every
+// handle on an interface, since they all drain into the same uplink.
+type pacer struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second, 0 = unpaced
+	burst  float64
+	floor  float64 // minimum burst: a few full-size packets
+	tokens float64
+	last   time.Time
+}
+
+var (
+	pacersMu sync.Mutex
+	pacers   = make(map[string]*pacer) // by interface name
+)
+
+// pacerFor returns the interface's pacer, creating it at mbps on first use.
+func pacerFor(iface string, mbps float64, mtu int) *pacer {
+	pacersMu.Lock()
+	defer pacersMu.Unlock()
+	p := pacers[iface]
+	if p == nil {
+		p = &pacer{floor: float64(4 * mtu), last: time.Now()}
+		p.setRate(mbps)
+		pacers[iface] = p
+	}
+	return p
+}
+
+// SetPacingRate changes the pacing rate of the handles on iface, e.g. from
+// a throughput measurement. It has no effect unless pacing is configured.
+func SetPacingRate(iface string, mbps float64) {
+	pacersMu.Lock()
+	p := pacers[iface]
+	pacersMu.Unlock()
+	if p != nil {
+		p.setRate(mbps)
+	}
+}
+
+func (p *pacer) setRate(mbps float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rate = mbps * 1e6 / 8
+	p.burst = math.Max(p.rate*pacingInterval.Seconds(), p.floor)
+	p.tokens = math.Min(p.tokens, p.burst)
+}
+
+// wait blocks until n bytes may be sent. Callers reserve their bytes in
+// arrival order, so concurrent workers are spaced out rather than racing.
+func (p *pacer) wait(ctx context.Context, n int) error {
+	p.mu.Lock()
+	if p.rate == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	p.tokens = math.Min(p.tokens+now.Sub(p.last).Seconds()*p.rate, p.burst)
+	p.last = now
+	p.tokens -= float64(n)
+	var delay time.Duration
+	if p.tokens < 0 {
+		delay = time.Duration(-p.tokens / p.rate * float64(time.Second))
+	}
+	p.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
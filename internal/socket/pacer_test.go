@@ -0,0 +1,33 @@
+package socket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPacerRate(t *testing.T) {
+	p := &pacer{floor: 6000, last: time.Now()}
+	p.setRate(8) // 1 MB/s
+
+	ctx := context.Background()
+	start := time.Now()
+	// The bucket starts empty, so 110 KB take ~110ms.
+	for range 110 {
+		if err := p.wait(ctx, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 80*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("sending 110 KB at 1 MB/s took %s, want ~110ms", d)
+	}
+
+	p.setRate(0)
+	start = time.Now()
+	for range 1000 {
+		_ = p.wait(ctx, 1500)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("unpaced sends took %s", d)
+	}
+}
@@ -0,0 +1,80 @@
+package socket
+
+import (
+	"fmt"
+	"os/exec"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"strconv"
+	"strings"
+)
+
+// InstallPacing replaces the root qdisc of the raw packet interface with
+// one that shapes everything leaving it to the configured rate. The command
+// that puts back the current root qdisc is passed to record before anything
+// changes, so that replaying the journal restores the interface.
+func InstallPacing(n *conf.Network, record func(undo ...string) error) error {
+	iface := n.Interface_
+	rate := strconv.Itoa(n.Pacing.Rate) + "mbit"
+
+	undo, err := rootQdiscUndo(iface)
+	if err != nil {
+		return err
+	}
+	if err := record(undo...); err != nil {
+		return fmt.Errorf("failed to journal qdisc change on %s: %v", iface, err)
+	}
+
+	var steps [][]string
+	switch n.Pacing.Qdisc {
+	case "fq":
+		// fq's maxrate caps each flow, so an htb class shapes the aggregate
+		// and fq paces the flows inside it.
+		steps = [][]string{
+			{"qdisc", "replace", "dev", iface, "root", "handle", "1:", "htb", "default", "1"},
+			{"class", "replace", "dev", iface, "parent", "1:", "classid", "1:1", "htb", "rate", rate, "ceil", rate},
+			{"qdisc", "replace", "dev", iface, "parent", "1:1", "handle", "10:", "fq"},
+		}
+	case "cake":
+		steps = [][]string{{"qdisc", "replace", "dev", iface, "root", "cake", "bandwidth", rate}}
+	}
+	for _, args := range steps {
+		if output, err := exec.Command("tc", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to install %s qdisc on %s: %v, output: %s", n.Pacing.Qdisc, iface, err, output)
+		}
+	}
+	flog.Infof("pacing %s at %s with %s", iface, rate, n.Pacing.Qdisc)
+	return nil
+}
+
+// rootQdiscUndo returns the command that restores the current root qdisc
+// of iface.
+func rootQdiscUndo(iface string) ([]string, error) {
+	out, err := exec.Command("tc", "qdisc", "show", "dev", iface, "root").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the root qdisc of %s: %v", iface, err)
+	}
+	return qdiscRestore(iface, string(out)), nil
+}
+
+// qdiscRestore turns the output of "tc qdisc show root" into the command
+// that restores it. The kernel's default qdisc, which has handle 0:, comes
+// back when the root qdisc is deleted; a configured one is replaced with
+// its kind and parameters as tc shows them.
+func qdiscRestore(iface, show string) []string {
+	line, _, _ := strings.Cut(strings.TrimSpace(show), "\n")
+	fields := strings.Fields(line)
+	// qdisc <kind> <handle> root refcnt <n> <parameters...>
+	if len(fields) < 4 || fields[0] != "qdisc" || fields[2] == "0:" {
+		return []string{"tc", "qdisc", "del", "dev", iface, "root"}
+	}
+	undo := []string{"tc", "qdisc", "replace", "dev", iface, "root", "handle", fields[2], fields[1]}
+	params := fields[3:]
+	if params[0] == "root" {
+		params = params[1:]
+	}
+	if len(params) >= 2 && params[0] == "refcnt" {
+		params = params[2:]
+	}
+	return append(undo, params...)
+}
@@ -0,0 +1,25 @@
+package socket
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestQdiscRestore(t *testing.T) {
+	tests := []struct {
+		show string
+		want string
+	}{
+		{"qdisc fq_codel 0: root refcnt 2 limit 10240p flows 1024\n", "tc qdisc del dev eth0 root"},
+		{"qdisc mq 0: root \n", "tc qdisc del dev eth0 root"},
+		{"", "tc qdisc del dev eth0 root"},
+		{"qdisc tbf 8001: root refcnt 2 rate 50Mbit burst 64Kb lat 50ms \n", "tc qdisc replace dev eth0 root handle 8001: tbf rate 50Mbit burst 64Kb lat 50ms"},
+	}
+	for _, tt := range tests {
+		got := qdiscRestore("eth0", tt.show)
+		if want := strings.Fields(tt.want); !slices.Equal(got, want) {
+			t.Errorf("qdiscRestore(%q) = %q, want %q", tt.show, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package socket
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// packetSockets maps the inode of each packet socket this process holds to
+// its descriptor, from /proc/net/packet and /proc/self/fd.
+func packetSockets() map[uint64]int {
+	f, err := os.Open("/proc/net/packet")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	inodes := make(map[uint64]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// sk RefCnt Type Proto Iface R Rmem User Inode
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 9 {
+			continue
+		}
+		if ino, err := strconv.ParseUint(fields[8], 10, 64); err == nil {
+			inodes[ino] = true
+		}
+	}
+
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return nil
+	}
+	socks := make(map[uint64]int)
+	for _, e := range entries {
+		link, err := os.Readlink("/proc/self/fd/" + e.Name())
+		if err != nil {
+			continue
+		}
+		s, ok := strings.CutPrefix(link, "socket:[")
+		if !ok {
+			continue
+		}
+		ino, err := strconv.ParseUint(strings.TrimSuffix(s, "]"), 10, 64)
+		if err != nil || !inodes[ino] {
+			continue
+		}
+		if fd, err := strconv.Atoi(e.Name()); err == nil {
+			socks[ino] = fd
+		}
+	}
+	return socks
+}
+
+// readKernelDrops returns the packets the kernel dropped on packet socket
+// fd because its buffer was full. Reading the counter resets it.
+func readKernelDrops(fd int) (uint64, error) {
+	st, err := unix.GetsockoptTpacketStatsV3(fd, unix.SOL_PACKET, unix.PACKET_STATISTICS)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(st.Drops), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package socket
+
+// Kernel drop counters of the capture socket are read on Linux only;
+// elsewhere autosize grows the send queue alone.
+func packetSockets() map[uint64]int {
+	return nil
+}
+
+func readKernelDrops(int) (uint64, error) {
+	return 0, errNoDropCounter
+}
@@ -5,49 +5,169 @@ import (
 	"net"
 	"paqet/internal/conf"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gopacket/gopacket"
 	"github.com/gopacket/gopacket/layers"
 	"github.com/gopacket/gopacket/pcap"
 )
 
+// readTimeout bounds how long a read waits in libpcap for a packet. Closing
+// a handle waits for the read in progress, so an idle link would otherwise
+// hold up resize and Close indefinitely.
+const readTimeout = 100 * time.Millisecond
+
 type RecvHandle struct {
-	handle *pcap.Handle
+	handle  atomic.Pointer[pcap.Handle]
+	cfg     *conf.Network
+	verify  bool
+	badCsum atomic.Uint64
+
+	mu      sync.Mutex // serialises reopen, filter changes and Close
+	filter  string     // BPF filter, reapplied when the handle is reopened
+	sockbuf int        // buffer size of the open handle
+	fd      int        // descriptor of its capture socket, -1 if not known
+	closed  bool
 }
 
 func NewRecvHandle(cfg *conf.Network) (*RecvHandle, error) {
-	handle, err := newHandle(cfg)
+	h := &RecvHandle{
+		cfg:    cfg,
+		verify: cfg.PCAP.RXVerifyChecksum,
+		filter: fmt.Sprintf("tcp and dst port %d", cfg.Port),
+	}
+	sockbuf := sockbufFor(cfg.Interface_, cfg.PCAP.Sockbuf)
+	handle, fd, err := h.open(sockbuf)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open pcap handle: %w", err)
+		return nil, err
 	}
+	h.handle.Store(handle)
+	h.sockbuf, h.fd = sockbuf, fd
+	capturesMu.Lock()
+	captures[h] = struct{}{}
+	capturesMu.Unlock()
+	return h, nil
+}
+
+// open opens a capture handle with a buffer of sockbuf bytes and the
+// current filter. The descriptor of its socket is found by looking for the
+// packet socket that appeared while it was opened.
+func (h *RecvHandle) open(sockbuf int) (*pcap.Handle, int, error) {
+	before := packetSockets()
+	handle, err := newHandleTimeout(h.cfg, sockbuf, readTimeout)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to open pcap handle: %w", err)
+	}
+	fd := newPacketSocket(before, packetSockets())
 
 	// SetDirection is not fully supported on Windows Npcap, so skip it
 	if runtime.GOOS != "windows" {
 		if err := handle.SetDirection(pcap.DirectionIn); err != nil {
-			return nil, fmt.Errorf("failed to set pcap direction in: %v", err)
+			handle.Close()
+			return nil, -1, fmt.Errorf("failed to set pcap direction in: %v", err)
 		}
 	}
 
-	filter := fmt.Sprintf("tcp and dst port %d", cfg.Port)
-	if err := handle.SetBPFFilter(filter); err != nil {
-		return nil, fmt.Errorf("failed to set BPF filter: %w", err)
+	if err := handle.SetBPFFilter(h.filter); err != nil {
+		handle.Close()
+		return nil, -1, fmt.Errorf("failed to set BPF filter: %w", err)
+	}
+	return handle, fd, nil
+}
+
+// setFilter replaces the BPF filter of the capture handle.
+func (h *RecvHandle) setFilter(expr string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.handle.Load().SetBPFFilter(expr); err != nil {
+		return err
 	}
+	h.filter = expr
+	return nil
+}
 
-	return &RecvHandle{handle: handle}, nil
+// resize replaces the capture handle with one whose buffer is sockbuf
+// bytes. Both capture while the new one is opened, so a few packets may be
+// read twice, which the transports discard as duplicates.
+func (h *RecvHandle) resize(sockbuf int) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return net.ErrClosed
+	}
+	handle, fd, err := h.open(sockbuf)
+	if err != nil {
+		h.mu.Unlock()
+		return err
+	}
+	old := h.handle.Swap(handle)
+	h.sockbuf, h.fd = sockbuf, fd
+	h.mu.Unlock()
+
+	// Close waits for a read in progress, at most readTimeout, which then
+	// sees the new handle.
+	old.Close()
+	return nil
+}
+
+// bufferSize returns the buffer size of the capture handle in bytes.
+func (h *RecvHandle) bufferSize() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sockbuf
+}
+
+// kernelDrops returns the number of packets the kernel dropped for a full
+// capture buffer since the last call.
+func (h *RecvHandle) kernelDrops() (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.fd < 0 {
+		return 0, errNoDropCounter
+	}
+	return readKernelDrops(h.fd)
+}
+
+// next returns the next captured frame.
+func (h *RecvHandle) next() ([]byte, error) {
+	for {
+		handle := h.handle.Load()
+		data, _, err := handle.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+		if err != nil && h.handle.Load() != handle {
+			// Closed by resize: carry on with the new handle.
+			continue
+		}
+		return data, err
+	}
 }
 
 func (h *RecvHandle) Read() ([]byte, net.Addr, error) {
-	data, _, err := h.handle.ReadPacketData()
+	data, err := h.next()
 	if err != nil {
 		return nil, nil, err
 	}
+	payload, addr := h.decode(data)
+	if addr == nil {
+		return nil, nil, nil
+	}
+	return payload, addr, nil
+}
+
+// decode extracts the payload and source address of a captured frame. addr
+// is nil if the frame is not a valid packet for this connection.
+func (h *RecvHandle) decode(data []byte) ([]byte, *net.UDPAddr) {
 	p := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.NoCopy)
 
 	addr := &net.UDPAddr{}
 
 	netLayer := p.NetworkLayer()
 	if netLayer == nil {
-		return nil, nil, nil
+		return nil, nil
 	}
 	switch netLayer.LayerType() {
 	case layers.LayerTypeIPv4:
@@ -58,25 +178,42 @@ func (h *RecvHandle) Read() ([]byte, net.Addr, error) {
 
 	trLayer := p.TransportLayer()
 	if trLayer == nil {
-		return nil, nil, nil
+		return nil, nil
 	}
 	switch trLayer.LayerType() {
 	case layers.LayerTypeTCP:
-		addr.Port = int(trLayer.(*layers.TCP).SrcPort)
+		tcp := trLayer.(*layers.TCP)
+		if h.verify && !validTCPChecksum(addr.IP, netLayer.NetworkFlow().Dst().Raw(), tcp.Contents, tcp.Payload) {
+			h.badCsum.Add(1)
+			return nil, nil
+		}
+		addr.Port = int(tcp.SrcPort)
 	case layers.LayerTypeUDP:
 		addr.Port = int(trLayer.(*layers.UDP).SrcPort)
 	}
 
 	appLayer := p.ApplicationLayer()
 	if appLayer == nil {
-		return nil, nil, nil
+		return nil, nil
 	}
 
-	return appLayer.Payload(), addr, nil
+	return appLayer.Payload(), addr
+}
+
+// BadChecksums returns the number of packets dropped by checksum verification.
+func (h *RecvHandle) BadChecksums() uint64 {
+	return h.badCsum.Load()
 }
 
 func (h *RecvHandle) Close() {
-	if h.handle != nil {
-		h.handle.Close()
+	capturesMu.Lock()
+	delete(captures, h)
+	capturesMu.Unlock()
+	h.mu.Lock()
+	h.closed = true
+	handle := h.handle.Load()
+	h.mu.Unlock()
+	if handle != nil {
+		handle.Close()
 	}
 }
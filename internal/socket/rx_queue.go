@@ -0,0 +1,117 @@
+package socket
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"net"
+)
+
+// rxQueueDepth is the number of frames buffered per receive worker.
+const rxQueueDepth = 1024
+
+type rxPacket struct {
+	payload []byte
+	addr    net.Addr
+	err     error
+}
+
+// rxQueues spreads frame decoding over several workers. Frames are assigned
+// by flowHash, so all packets of one peer are decoded by the same worker and
+// delivered in capture order.
+type rxQueues struct {
+	queues []chan []byte
+	out    chan rxPacket
+}
+
+func newRXQueues(ctx context.Context, h *RecvHandle, n int) *rxQueues {
+	q := &rxQueues{
+		queues: make([]chan []byte, n),
+		out:    make(chan rxPacket, rxQueueDepth),
+	}
+	for i := range q.queues {
+		q.queues[i] = make(chan []byte, rxQueueDepth)
+		go q.work(ctx, h, q.queues[i])
+	}
+	go q.capture(ctx, h)
+	return q
+}
+
+// capture reads frames and hands each to the worker owning its flow.
+func (q *rxQueues) capture(ctx context.Context, h *RecvHandle) {
+	for {
+		data, err := h.next()
+		if err != nil {
+			select {
+			case q.out <- rxPacket{err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		select {
+		case q.queues[flowHash(data)%uint32(len(q.queues))] <- data:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *rxQueues) work(ctx context.Context, h *RecvHandle, in <-chan []byte) {
+	for {
+		select {
+		case data := <-in:
+			payload, addr := h.decode(data)
+			if addr == nil {
+				continue
+			}
+			select {
+			case q.out <- rxPacket{payload: payload, addr: addr}:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// flowHash hashes the source address and port of an Ethernet frame without
+// fully decoding it. Frames that cannot be parsed hash to 0.
+func flowHash(frame []byte) uint32 {
+	off := 12
+	if len(frame) < off+2 {
+		return 0
+	}
+	etherType := binary.BigEndian.Uint16(frame[off:])
+	off += 2
+	if etherType == 0x8100 && len(frame) >= off+4 { // 802.1Q tag
+		etherType = binary.BigEndian.Uint16(frame[off+2:])
+		off += 4
+	}
+
+	var src []byte
+	switch etherType {
+	case 0x0800:
+		if len(frame) < off+20 {
+			return 0
+		}
+		src = frame[off+12 : off+16]
+		off += int(frame[off]&0x0f) * 4
+	case 0x86dd:
+		if len(frame) < off+40 {
+			return 0
+		}
+		src = frame[off+8 : off+24]
+		off += 40
+	default:
+		return 0
+	}
+	if len(frame) < off+2 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write(src)
+	h.Write(frame[off : off+2]) // source port
+	return h.Sum32()
+}
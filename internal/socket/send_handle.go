@@ -51,14 +51,23 @@ type SendHandle struct {
 	tcpPool        sync.Pool
 	bufPool        sync.Pool
 	sendQueue      chan *sendRequest
+	size           atomic.Int32 // slots of sendQueue in use when autosized, 0 = all
 	ctx            context.Context
 	cancel         context.CancelFunc
 	wg             sync.WaitGroup
 	cfg            *conf.Network
-	droppedPackets atomic.Uint64
+	drops          dropCounters
+	congested      atomic.Bool
+	highMark       int // queue depth that starts early drop, 0 = only when full
+	lowMark        int // queue depth that ends early drop
+
+	pacer *pacer // nil unless network.pcap.pacing_rate is set
+
+	hop     *hopper       // nil unless network.port_hopping is set
+	hopPort atomic.Uint32 // server: source port of the current hop, 0 to use srcPort
 }
 
-func NewSendHandle(cfg *conf.Network) (*SendHandle, error) {
+func NewSendHandle(ctx context.Context, cfg *conf.Network) (*SendHandle, error) {
 	handle, err := newHandle(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open pcap handle: %w", err)
@@ -71,8 +80,15 @@ func NewSendHandle(cfg *conf.Network) (*SendHandle, error) {
 		}
 	}
 
+	// Advertise the MSS a real stack would use on this link (1460 at MTU 1500)
+	mtu := cfg.MTU
+	if mtu == 0 {
+		mtu = 1500
+	}
+	mss := make([]byte, 2)
+	binary.BigEndian.PutUint16(mss, uint16(mtu-40))
 	synOptions := []layers.TCPOption{
-		{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}},
+		{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: mss},
 		{OptionType: layers.TCPOptionKindSACKPermitted, OptionLength: 2},
 		{OptionType: layers.TCPOptionKindTimestamps, OptionLength: 10, OptionData: make([]byte, 8)},
 		{OptionType: layers.TCPOptionKindNop},
@@ -85,7 +101,13 @@ func NewSendHandle(cfg *conf.Network) (*SendHandle, error) {
 		{OptionType: layers.TCPOptionKindTimestamps, OptionLength: 10, OptionData: make([]byte, 8)},
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// An autosized queue is allocated at its limit and grown by raising size.
+	queue := cfg.PCAP.SendQueueSize
+	if cfg.PCAP.Autosize {
+		queue = cfg.PCAP.MaxSendQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
 	sh := &SendHandle{
 		handle:     handle,
 		srcPort:    uint16(cfg.Port),
@@ -94,7 +116,7 @@ func NewSendHandle(cfg *conf.Network) (*SendHandle, error) {
 		tcpF:       TCPF{tcpF: iterator.Iterator[conf.TCPF]{Items: cfg.TCP.LF}, clientTCPF: make(map[uint64]*iterator.Iterator[conf.TCPF])},
 		time:       uint32(time.Now().UnixNano() / int64(time.Millisecond)),
 		cfg:        cfg,
-		sendQueue:  make(chan *sendRequest, cfg.PCAP.SendQueueSize),
+		sendQueue:  make(chan *sendRequest, queue),
 		ctx:        ctx,
 		cancel:     cancel,
 		ethPool: sync.Pool{
@@ -123,6 +145,16 @@ func NewSendHandle(cfg *conf.Network) (*SendHandle, error) {
 			},
 		},
 	}
+	if cfg.PCAP.HighWatermark > 0 && cfg.PCAP.HighWatermark < 100 {
+		sh.highMark = max(cfg.PCAP.SendQueueSize*cfg.PCAP.HighWatermark/100, 1)
+		sh.lowMark = cfg.PCAP.SendQueueSize * cfg.PCAP.LowWatermark / 100
+	}
+	if cfg.PCAP.Autosize {
+		sh.size.Store(int32(cfg.PCAP.SendQueueSize))
+	}
+	if cfg.PCAP.PacingRate > 0 || cfg.PCAP.PacingAuto {
+		sh.pacer = pacerFor(cfg.Interface_, cfg.PCAP.PacingRate, cfg.MTU)
+	}
 	if cfg.IPv4.Addr != nil {
 		sh.srcIPv4 = cfg.IPv4.Addr.IP
 		sh.srcIPv4RHWA = cfg.IPv4.Router
@@ -176,8 +208,12 @@ func (h *SendHandle) buildIPv6Header(dstIP net.IP) *layers.IPv6 {
 
 func (h *SendHandle) buildTCPHeader(dstPort uint16, f conf.TCPF) *layers.TCP {
 	tcp := h.tcpPool.Get().(*layers.TCP)
+	srcPort := h.srcPort
+	if p := h.hopPort.Load(); p != 0 {
+		srcPort = uint16(p)
+	}
 	*tcp = layers.TCP{
-		SrcPort: layers.TCPPort(h.srcPort),
+		SrcPort: layers.TCPPort(srcPort),
 		DstPort: layers.TCPPort(dstPort),
 		FIN:     f.FIN, SYN: f.SYN, RST: f.RST, PSH: f.PSH, ACK: f.ACK, URG: f.URG, ECE: f.ECE, CWR: f.CWR, NS: f.NS,
 		Window: 65535,
@@ -219,16 +255,9 @@ func (h *SendHandle) Write(payload []byte, addr *net.UDPAddr) error {
 		retries: 0,
 	}
 
-	// Try to enqueue the request with flow control
-	select {
-	case h.sendQueue <- req:
-		// Successfully queued
-	case <-h.ctx.Done():
-		return h.ctx.Err()
-	default:
-		// Queue is full - apply back-pressure
-		h.droppedPackets.Add(1)
-		return fmt.Errorf("send queue full, packet dropped")
+	// Enqueue subject to the watermark and drop policy
+	if err := h.admit(req); err != nil {
+		return err
 	}
 
 	// Wait for the result
@@ -248,6 +277,15 @@ func (h *SendHandle) processQueue() {
 		case <-h.ctx.Done():
 			return
 		case req := <-h.sendQueue:
+			if h.pacer != nil {
+				// Ethernet, IPv6 and TCP headers with options; IPv4 is 20 bytes less.
+				if err := h.pacer.wait(h.ctx, len(req.payload)+86); err != nil {
+					if req.errChan != nil {
+						req.errChan <- err
+					}
+					return
+				}
+			}
 			err := h.executeWrite(req)
 			if err != nil && req.retries < h.cfg.PCAP.MaxRetries {
 				// Retry with exponential backoff
@@ -267,7 +305,7 @@ func (h *SendHandle) processQueue() {
 						return
 					default:
 						// Queue full on retry - drop
-						h.droppedPackets.Add(1)
+						h.drops.add(DropRetry)
 						if req.errChan != nil {
 							req.errChan <- fmt.Errorf("send queue full on retry: %w", err)
 						}
@@ -312,6 +350,9 @@ func (h *SendHandle) executeWrite(req *sendRequest) error {
 	dstPort := uint16(req.addr.Port)
 
 	f := h.getClientTCPF(dstIP, dstPort)
+	if h.hop != nil {
+		dstPort = uint16(h.hop.dst(req.addr))
+	}
 	tcpLayer := h.buildTCPHeader(dstPort, f)
 	defer h.tcpPool.Put(tcpLayer)
 
@@ -389,9 +430,22 @@ func (h *SendHandle) Close() {
 }
 
 func (h *SendHandle) DroppedPackets() uint64 {
-	return h.droppedPackets.Load()
+	return h.drops.total()
+}
+
+// DropStats returns the number of dropped packets by reason.
+func (h *SendHandle) DropStats() map[string]uint64 {
+	return h.drops.snapshot()
 }
 
 func (h *SendHandle) QueueDepth() int {
 	return len(h.sendQueue)
 }
+
+// queueSize returns the number of packets the send queue holds.
+func (h *SendHandle) queueSize() int {
+	if n := h.size.Load(); n > 0 {
+		return int(n)
+	}
+	return cap(h.sendQueue)
+}
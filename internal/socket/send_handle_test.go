@@ -7,6 +7,9 @@ import (
 	"paqet/internal/pkg/iterator"
 	"testing"
 	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
 )
 
 // TestSendQueueBackpressure tests that the send queue properly applies backpressure
@@ -187,3 +190,131 @@ func TestSetClientTCPFWithNilAddr(t *testing.T) {
 		t.Errorf("Expected clientTCPF map to have 2 entries, got %d", len(sh.tcpF.clientTCPF))
 	}
 }
+
+// TestDropPolicies tests the watermark drop policies and per-reason counters
+func TestDropPolicies(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+	small := make([]byte, 64)
+	large := make([]byte, 1200)
+
+	newHandle := func(policy string) *SendHandle {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return &SendHandle{
+			cfg:       &conf.Network{PCAP: conf.PCAP{SendQueueSize: 4, DropPolicy: policy}},
+			sendQueue: make(chan *sendRequest, 4),
+			ctx:       ctx,
+			cancel:    cancel,
+			highMark:  2,
+			lowMark:   1,
+		}
+	}
+	fill := func(sh *SendHandle, n int) {
+		for i := 0; i < n; i++ {
+			sh.sendQueue <- &sendRequest{payload: large, addr: addr, errChan: make(chan error, 1)}
+		}
+	}
+
+	sh := newHandle("tail")
+	fill(sh, 2)
+	if err := sh.admit(&sendRequest{payload: small, addr: addr}); err == nil {
+		t.Error("tail: expected drop above high watermark")
+	}
+	if got := sh.DropStats()["watermark"]; got != 1 {
+		t.Errorf("tail: watermark drops = %d, want 1", got)
+	}
+
+	sh = newHandle("head")
+	fill(sh, 2)
+	if err := sh.admit(&sendRequest{payload: large, addr: addr}); err != nil {
+		t.Errorf("head: unexpected error %v", err)
+	}
+	if got := sh.DropStats()["head_drop"]; got != 1 || sh.QueueDepth() != 2 {
+		t.Errorf("head: head_drop = %d, depth = %d; want 1, 2", got, sh.QueueDepth())
+	}
+
+	sh = newHandle("priority")
+	fill(sh, 2)
+	if err := sh.admit(&sendRequest{payload: large, addr: addr}); err == nil {
+		t.Error("priority: expected bulk packet to be dropped")
+	}
+	if err := sh.admit(&sendRequest{payload: small, addr: addr}); err != nil {
+		t.Errorf("priority: control packet rejected: %v", err)
+	}
+	if sh.DroppedPackets() != 2 {
+		t.Errorf("priority: total drops = %d, want 2", sh.DroppedPackets())
+	}
+}
+
+// TestTCPChecksum tests that received segments are verified against the
+// checksum gopacket computes
+func TestTCPChecksum(t *testing.T) {
+	src, dst := net.IPv4(10, 0, 0, 1).To4(), net.IPv4(10, 0, 0, 2).To4()
+	eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: src, DstIP: dst}
+	tcp := &layers.TCP{SrcPort: 1234, DstPort: 80, PSH: true, ACK: true, Window: 65535}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload("hello, world!")); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+
+	if !validTCPChecksum(src, dst, frame[34:54], frame[54:]) {
+		t.Error("valid segment failed verification")
+	}
+	frame[len(frame)-1] ^= 0xff
+	if validTCPChecksum(src, dst, frame[34:54], frame[54:]) {
+		t.Error("corrupted segment passed verification")
+	}
+}
+
+// TestAutosizedQueue tests that an autosized queue holds size packets and
+// takes more once size is raised
+func TestAutosizedQueue(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sh := &SendHandle{
+		cfg:       &conf.Network{PCAP: conf.PCAP{SendQueueSize: 2, DropPolicy: "tail"}},
+		sendQueue: make(chan *sendRequest, 8),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	sh.size.Store(2)
+
+	for i := 0; i < 2; i++ {
+		if err := sh.admit(&sendRequest{payload: []byte{1}, addr: addr}); err != nil {
+			t.Fatalf("packet %d rejected: %v", i, err)
+		}
+	}
+	if err := sh.admit(&sendRequest{payload: []byte{1}, addr: addr}); err == nil {
+		t.Error("expected drop at the queue size")
+	}
+	if got := sh.DropStats()["queue_full"]; got != 1 {
+		t.Errorf("queue_full drops = %d, want 1", got)
+	}
+
+	sh.size.Store(4)
+	if err := sh.admit(&sendRequest{payload: []byte{1}, addr: addr}); err != nil {
+		t.Errorf("packet rejected after growing the queue: %v", err)
+	}
+	if got := sh.queueSize(); got != 4 {
+		t.Errorf("queueSize() = %d, want 4", got)
+	}
+}
+
+// TestNewPacketSocket tests finding the socket a capture handle opened
+func TestNewPacketSocket(t *testing.T) {
+	before := map[uint64]int{100: 3}
+	if fd := newPacketSocket(before, map[uint64]int{100: 3, 200: 7}); fd != 7 {
+		t.Errorf("newPacketSocket() = %d, want 7", fd)
+	}
+	if fd := newPacketSocket(before, map[uint64]int{100: 3, 200: 7, 300: 8}); fd != -1 {
+		t.Errorf("newPacketSocket() with two new sockets = %d, want -1", fd)
+	}
+	if fd := newPacketSocket(nil, nil); fd != -1 {
+		t.Errorf("newPacketSocket() without sockets = %d, want -1", fd)
+	}
+}
@@ -0,0 +1,44 @@
+package socket
+
+import "sync"
+
+var (
+	capturesMu sync.Mutex
+	captures   = make(map[*RecvHandle]struct{}) // open capture handles
+	sockbufs   = make(map[string]int)           // raised capture buffer sizes by interface name
+)
+
+// sockbufFor returns the capture buffer size for a new handle on iface:
+// configured, or as raised by GrowSockbuf.
+func sockbufFor(iface string, configured int) int {
+	capturesMu.Lock()
+	defer capturesMu.Unlock()
+	return max(configured, sockbufs[iface])
+}
+
+// GrowSockbuf raises the capture buffer of the handles on iface, and of
+// those opened later, to at least size bytes, e.g. for a measured
+// bandwidth-delay product. It returns how many open handles were resized.
+func GrowSockbuf(iface string, size int) (int, error) {
+	capturesMu.Lock()
+	sockbufs[iface] = max(sockbufs[iface], size)
+	var grow []*RecvHandle
+	for h := range captures {
+		if h.cfg.Interface_ == iface {
+			grow = append(grow, h)
+		}
+	}
+	capturesMu.Unlock()
+
+	n := 0
+	for _, h := range grow {
+		if h.bufferSize() >= size {
+			continue
+		}
+		if err := h.resize(size); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -19,6 +19,12 @@ type PacketConn struct {
 	recvHandle    *RecvHandle
 	readDeadline  atomic.Value
 	writeDeadline atomic.Value
+	cover         *cover    // idle-period cover traffic, nil when disabled
+	rx            *rxQueues // flow-hashed receive workers, nil to decode inline
+
+	filter atomic.Pointer[func(net.Addr) bool] // drops packets from peers it rejects, see SetFilter
+	hop    *hopper                             // nil unless network.port_hopping is set
+	gate   *gate                               // nil unless network.gate is set on a server
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -31,7 +37,7 @@ func New(ctx context.Context, cfg *conf.Network) (*PacketConn, error) {
 		cfg.Port = 32768 + rand.Intn(32768)
 	}
 
-	sendHandle, err := NewSendHandle(cfg)
+	sendHandle, err := NewSendHandle(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create send handle on %s: %v", cfg.Interface.Name, err)
 	}
@@ -49,6 +55,33 @@ func New(ctx context.Context, cfg *conf.Network) (*PacketConn, error) {
 		recvHandle: recvHandle,
 		ctx:        ctx,
 		cancel:     cancel,
+		cover:      newCover(&cfg.Cover),
+	}
+	if conn.hop = newHopper(&cfg.PortHopping); conn.hop != nil {
+		sendHandle.hop = conn.hop
+		if cfg.PortHopping.Hop == nil {
+			if err := conn.hop.serve(ctx, sendHandle, recvHandle); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
+	if cfg.Gate.Enabled() {
+		if cfg.Gate.Knock != nil {
+			go knock(ctx, &cfg.Gate, sendHandle)
+		} else {
+			conn.gate = newGate(&cfg.Gate)
+			go conn.gate.sweep(ctx)
+		}
+	}
+	if conn.cover != nil {
+		go conn.cover.run(ctx, sendHandle)
+	}
+	if cfg.PCAP.Autosize {
+		go autosize(ctx, &cfg.PCAP, sendHandle, recvHandle)
+	}
+	if cfg.Performance != nil && cfg.Performance.RXQueues > 1 {
+		conn.rx = newRXQueues(ctx, recvHandle, cfg.Performance.RXQueues)
 	}
 
 	return conn, nil
@@ -71,15 +104,55 @@ func (c *PacketConn) ReadFrom(data []byte) (n int, addr net.Addr, err error) {
 	default:
 	}
 
-	payload, addr, err := c.recvHandle.Read()
-	if err != nil {
-		return 0, nil, err
+	var payload []byte
+	for {
+		if c.rx != nil {
+			select {
+			case <-c.ctx.Done():
+				return 0, nil, c.ctx.Err()
+			case <-deadline:
+				return 0, nil, os.ErrDeadlineExceeded
+			case p := <-c.rx.out:
+				if p.err != nil {
+					return 0, nil, p.err
+				}
+				payload, addr = p.payload, p.addr
+			}
+		} else {
+			payload, addr, err = c.recvHandle.Read()
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		if c.hop != nil {
+			c.hop.received(addr)
+		}
+		if c.gate != nil && !c.gate.admit(payload, addr, time.Now()) {
+			continue
+		}
+		if f := c.filter.Load(); f == nil || (*f)(addr) {
+			break
+		}
 	}
 	n = copy(data, payload)
+	if c.cover != nil {
+		c.cover.received(addr)
+	}
 
 	return n, addr, nil
 }
 
+// SetFilter makes ReadFrom drop packets from peers for which accept returns
+// false, so that two processes capturing on the same port during a handoff
+// each see only their own flows. A nil accept removes the filter.
+func (c *PacketConn) SetFilter(accept func(net.Addr) bool) {
+	if accept == nil {
+		c.filter.Store(nil)
+		return
+	}
+	c.filter.Store(&accept)
+}
+
 func (c *PacketConn) WriteTo(data []byte, addr net.Addr) (n int, err error) {
 	var timer *time.Timer
 	var deadline <-chan time.Time
@@ -106,6 +179,9 @@ func (c *PacketConn) WriteTo(data []byte, addr net.Addr) (n int, err error) {
 	if err != nil {
 		return 0, err
 	}
+	if c.cover != nil {
+		c.cover.sent(daddr)
+	}
 
 	return len(data), nil
 }
@@ -126,6 +202,11 @@ func (c *PacketConn) Close() error {
 	return nil
 }
 
+// Done is closed once the PacketConn is closed.
+func (c *PacketConn) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
 func (c *PacketConn) LocalAddr() net.Addr {
 	// Return IPv4 address if configured, otherwise IPv6
 	if c.cfg != nil {
@@ -205,6 +286,32 @@ func (c *PacketConn) DroppedPackets() uint64 {
 	return c.sendHandle.DroppedPackets()
 }
 
+// DropStats returns the number of dropped packets by reason.
+func (c *PacketConn) DropStats() map[string]uint64 {
+	if c.sendHandle == nil {
+		return nil
+	}
+	return c.sendHandle.DropStats()
+}
+
+// BadChecksums returns the number of received packets dropped for a bad
+// TCP checksum when rx_verify_checksum is enabled.
+func (c *PacketConn) BadChecksums() uint64 {
+	if c.recvHandle == nil {
+		return 0
+	}
+	return c.recvHandle.BadChecksums()
+}
+
+// GateDrops returns the number of received packets the gate dropped from
+// sources that had not knocked.
+func (c *PacketConn) GateDrops() uint64 {
+	if c.gate == nil {
+		return 0
+	}
+	return c.gate.dropped.Load()
+}
+
 func (c *PacketConn) QueueDepth() int {
 	if c.sendHandle == nil {
 		return 0
@@ -1,8 +1,10 @@
 package socket
 
 import (
+	"encoding/binary"
 	"net"
 	"testing"
+	"time"
 
 	"paqet/internal/conf"
 )
@@ -128,3 +130,78 @@ func TestPacketConnSetWriteBuffer(t *testing.T) {
 		t.Errorf("SetWriteBuffer() returned error: %v, want nil", err)
 	}
 }
+
+func TestCoverSchedule(t *testing.T) {
+	c := newCover(&conf.Cover{Profile: "rtp", Idle: 100})
+	addr := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 9999}
+	c.received(addr)
+	c.sent(addr)
+
+	now := time.Now()
+	if got := c.due(now); len(got) != 0 {
+		t.Fatalf("cover sent while connection active: %d packets", len(got))
+	}
+
+	now = now.Add(200 * time.Millisecond)
+	got := c.due(now)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 cover packet after idle, got %d", len(got))
+	}
+	if p := got[0].payload; len(p) != 172 || p[0] != 0x80 {
+		t.Errorf("unexpected rtp cover packet: len=%d first=%#x", len(p), p[0])
+	}
+	if len(c.due(now.Add(time.Millisecond))) != 0 {
+		t.Error("cover packet sent before the profile interval elapsed")
+	}
+
+	c.sent(addr)
+	now = time.Now()
+	if len(c.due(now.Add(50*time.Millisecond))) != 0 {
+		t.Error("cover continued after real traffic resumed")
+	}
+
+	if len(c.due(now.Add(coverPeerTTL+time.Minute))) != 0 || len(c.peers) != 0 {
+		t.Error("expired peer was not removed")
+	}
+}
+
+func TestFlowHash(t *testing.T) {
+	frame := func(src net.IP, sport uint16, vlan bool) []byte {
+		b := make([]byte, 12) // destination and source MAC
+		if vlan {
+			b = append(b, 0x81, 0x00, 0x00, 0x07)
+		}
+		if ip4 := src.To4(); ip4 != nil {
+			b = append(b, 0x08, 0x00)
+			ip := make([]byte, 20)
+			ip[0] = 0x45
+			copy(ip[12:16], ip4)
+			b = append(b, ip...)
+		} else {
+			b = append(b, 0x86, 0xdd)
+			ip := make([]byte, 40)
+			copy(ip[8:24], src.To16())
+			b = append(b, ip...)
+		}
+		tcp := make([]byte, 20)
+		binary.BigEndian.PutUint16(tcp, sport)
+		return append(b, tcp...)
+	}
+
+	a := frame(net.ParseIP("192.0.2.1"), 40000, false)
+	if flowHash(a) == 0 {
+		t.Fatal("IPv4 frame hashed to 0")
+	}
+	if flowHash(a) != flowHash(frame(net.ParseIP("192.0.2.1"), 40000, true)) {
+		t.Error("VLAN tag changed the flow hash")
+	}
+	if flowHash(a) == flowHash(frame(net.ParseIP("192.0.2.1"), 40001, false)) {
+		t.Error("different source ports hashed to the same flow")
+	}
+	if flowHash(frame(net.ParseIP("2001:db8::1"), 40000, false)) == 0 {
+		t.Error("IPv6 frame hashed to 0")
+	}
+	if flowHash(a[:20]) != 0 {
+		t.Error("truncated frame did not hash to 0")
+	}
+}
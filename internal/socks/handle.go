@@ -3,6 +3,7 @@ package socks
 import (
 	"context"
 	"paqet/internal/client"
+	"paqet/internal/protocol"
 	"sync"
 )
 
@@ -16,4 +17,8 @@ var rPool = sync.Pool{
 type Handler struct {
 	client *client.Client
 	ctx    context.Context
+	reuse  protocol.Reuse
+
+	assocMu sync.Mutex
+	assocs  []*udpAssoc // active UDP ASSOCIATE grants
 }
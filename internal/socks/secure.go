@@ -0,0 +1,88 @@
+package socks
+
+import (
+	"context"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/pkg/inbound"
+
+	"github.com/txthinking/socks5"
+)
+
+// serveSecure replaces socks5.Server.ListenAndServe for listeners that
+// require TLS or a PROXY header, which the library's accept loop cannot
+// handle. The library is still used for negotiation and request parsing.
+func (s *SOCKS5) serveSecure(ctx context.Context, server *socks5.Server, cfg *conf.SOCKS5) error {
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		flog.Fatalf("SOCKS5 server failed to listen on %s: %v", server.Addr, err)
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", server.Addr)
+	if err == nil {
+		server.UDPConn, err = net.ListenUDP("udp", udpAddr)
+	}
+	if err != nil {
+		ln.Close()
+		flog.Fatalf("SOCKS5 server failed to listen on %s/udp: %v", server.Addr, err)
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+		server.UDPConn.Close()
+	}()
+	go s.serveUDP(server)
+
+	flog.Infof("SOCKS5 server listening on %s (tls: %t, proxy protocol: %t)", server.Addr, cfg.TLSConfig != nil, cfg.ProxyProtocol)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			flog.Errorf("SOCKS5 failed to accept connection on %s: %v", server.Addr, err)
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			c, err := inbound.Wrap(ctx, conn, &cfg.ListenerSecurity)
+			if err != nil {
+				flog.Warnf("SOCKS5 rejected connection from %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			defer c.Close()
+			if err := server.Negotiate(c); err != nil {
+				flog.Debugf("SOCKS5 negotiation with %s failed: %v", c.RemoteAddr(), err)
+				return
+			}
+			r, err := server.GetRequest(c)
+			if err != nil {
+				flog.Debugf("SOCKS5 request from %s failed: %v", c.RemoteAddr(), err)
+				return
+			}
+			if err := s.handle.handleRequest(c, r); err != nil {
+				flog.Debugf("SOCKS5 connection from %s closed with: %v", c.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *SOCKS5) serveUDP(server *socks5.Server) {
+	for {
+		b := make([]byte, 65507)
+		n, addr, err := server.UDPConn.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		go func() {
+			d, err := socks5.NewDatagramFromBytes(b[:n])
+			if err != nil || d.Frag != 0x00 {
+				flog.Debugf("SOCKS5 dropped invalid UDP datagram from %s", addr)
+				return
+			}
+			if err := s.handle.UDPHandle(server, addr, d); err != nil {
+				flog.Debugf("SOCKS5 UDP datagram from %s failed: %v", addr, err)
+			}
+		}()
+	}
+}
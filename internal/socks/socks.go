@@ -6,6 +6,7 @@ import (
 	"paqet/internal/client"
 	"paqet/internal/conf"
 	"paqet/internal/flog"
+	"paqet/internal/protocol"
 
 	"github.com/txthinking/socks5"
 )
@@ -21,7 +22,8 @@ func New(client *client.Client) (*SOCKS5, error) {
 }
 
 func (s *SOCKS5) Start(ctx context.Context, cfg conf.SOCKS5) error {
-	s.handle.ctx = ctx
+	s.handle.ctx = client.WithGroup(ctx, cfg.Group)
+	s.handle.reuse = protocol.ParseReuse(cfg.Reuse)
 	go s.listen(ctx, cfg)
 	return nil
 }
@@ -33,6 +35,10 @@ func (s *SOCKS5) listen(ctx context.Context, cfg conf.SOCKS5) error {
 		flog.Fatalf("SOCKS5 server failed to create on %s: %v", listenAddr.String(), err)
 	}
 
+	if cfg.TLSConfig != nil || cfg.ProxyProtocol {
+		return s.serveSecure(ctx, server, &cfg)
+	}
+
 	go func() {
 		if err := server.ListenAndServe(s.handle); err != nil {
 			flog.Debugf("SOCKS5 server failed to listen on %s: %v", listenAddr.String(), err)
@@ -9,9 +9,13 @@ import (
 )
 
 func (h *Handler) TCPHandle(server *socks5.Server, conn *net.TCPConn, r *socks5.Request) error {
+	return h.handleRequest(conn, r)
+}
+
+func (h *Handler) handleRequest(conn net.Conn, r *socks5.Request) error {
 	if r.Cmd == socks5.CmdUDP {
 		flog.Debugf("SOCKS5 UDP_ASSOCIATE from %s", conn.RemoteAddr())
-		return h.handleUDPAssociate(conn)
+		return h.handleUDPAssociate(conn, r)
 	}
 
 	if r.Cmd == socks5.CmdConnect {
@@ -23,7 +27,7 @@ func (h *Handler) TCPHandle(server *socks5.Server, conn *net.TCPConn, r *socks5.
 	return nil
 }
 
-func (h *Handler) handleTCPConnect(conn *net.TCPConn, r *socks5.Request) error {
+func (h *Handler) handleTCPConnect(conn net.Conn, r *socks5.Request) error {
 	flog.Infof("SOCKS5 accepted TCP connection %s -> %s", conn.RemoteAddr(), r.Address())
 
 	addr := conn.LocalAddr().(*net.TCPAddr)
@@ -50,13 +54,13 @@ func (h *Handler) handleTCPConnect(conn *net.TCPConn, r *socks5.Request) error {
 		return err
 	}
 
-	strm, err := h.client.TCP(r.Address())
+	strm, err := h.client.TCPReuse(h.ctx, r.Address(), h.reuse)
 	if err != nil {
 		flog.Errorf("SOCKS5 failed to establish stream for %s -> %s: %v", conn.RemoteAddr(), r.Address(), err)
 		return err
 	}
 	defer strm.Close()
-	flog.Debugf("SOCKS5 stream %d created for %s -> %s", strm.SID(), conn.RemoteAddr(), r.Address())
+	flog.Debugf("SOCKS5 stream %s created for %s -> %s", strm.CID(), conn.RemoteAddr(), r.Address())
 
 	errCh := make(chan error, 2)
 	go func() {
@@ -77,7 +81,7 @@ func (h *Handler) handleTCPConnect(conn *net.TCPConn, r *socks5.Request) error {
 	select {
 	case err := <-errCh:
 		if err != nil {
-			flog.Errorf("SOCKS5 stream %d failed for %s -> %s: %v", strm.SID(), conn.RemoteAddr(), r.Address(), err)
+			flog.Errorf("SOCKS5 stream %s failed for %s -> %s: %v", strm.CID(), conn.RemoteAddr(), r.Address(), err)
 		}
 		return err
 	case <-h.ctx.Done():
@@ -0,0 +1,107 @@
+package socks
+
+import (
+	"encoding/binary"
+	"net"
+	"paqet/internal/flog"
+	"paqet/internal/tnet"
+	"slices"
+	"sync"
+
+	"github.com/txthinking/socks5"
+)
+
+// udpAssoc is one UDP ASSOCIATE grant. Datagrams are relayed only for the
+// client that opened the control connection, each client source port and
+// target pair is mapped to its own paqet stream (NAT-style), and all of
+// them are closed when the control connection ends.
+type udpAssoc struct {
+	ip    net.IP
+	port  int // client source port; learned from the first datagram when the request left it zero
+	mu    sync.Mutex
+	strms map[uint64]tnet.Strm // keyed by client.UDP key
+}
+
+// associate registers a grant for the client on the control connection.
+// Per RFC 1928 the request carries the address the client will send from,
+// usually all zeros when it does not know yet.
+func (h *Handler) associate(conn net.Conn, r *socks5.Request) *udpAssoc {
+	a := &udpAssoc{strms: make(map[uint64]tnet.Strm)}
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		a.ip = tcpAddr.IP
+	}
+	if len(r.DstPort) == 2 {
+		a.port = int(binary.BigEndian.Uint16(r.DstPort))
+	}
+
+	h.assocMu.Lock()
+	h.assocs = append(h.assocs, a)
+	h.assocMu.Unlock()
+	return a
+}
+
+// lookupAssoc returns the grant that datagrams from addr belong to, binding
+// the source port to a grant that has not seen one yet.
+func (h *Handler) lookupAssoc(addr *net.UDPAddr) *udpAssoc {
+	h.assocMu.Lock()
+	defer h.assocMu.Unlock()
+	var unbound *udpAssoc
+	for _, a := range h.assocs {
+		if !a.ip.Equal(addr.IP) {
+			continue
+		}
+		if a.port == addr.Port {
+			return a
+		}
+		if a.port == 0 && unbound == nil {
+			unbound = a
+		}
+	}
+	if unbound != nil {
+		unbound.port = addr.Port
+		flog.Debugf("SOCKS5 UDP association for %s bound to source port %d", addr.IP, addr.Port)
+	}
+	return unbound
+}
+
+// release drops the grant and closes the streams opened for it.
+func (h *Handler) release(a *udpAssoc) {
+	h.assocMu.Lock()
+	if i := slices.Index(h.assocs, a); i >= 0 {
+		h.assocs = slices.Delete(h.assocs, i, i+1)
+	}
+	h.assocMu.Unlock()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k := range a.strms {
+		h.client.CloseUDP(k)
+	}
+	clear(a.strms)
+}
+
+// stream returns the relay stream for src -> dst, opening one if needed.
+func (a *udpAssoc) stream(h *Handler, src *net.UDPAddr, dst string) (tnet.Strm, bool, uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	strm, new, k, err := h.client.UDP(h.ctx, src.String(), dst)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	if new {
+		a.strms[k] = strm
+	}
+	return strm, new, k, nil
+}
+
+// closeStream closes strm unless it has already been replaced under k.
+func (a *udpAssoc) closeStream(h *Handler, k uint64, strm tnet.Strm) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.strms[k] == strm {
+		delete(a.strms, k)
+		h.client.CloseUDP(k)
+		return
+	}
+	strm.Close()
+}
@@ -0,0 +1,40 @@
+package socks
+
+import (
+	"net"
+	"testing"
+
+	"github.com/txthinking/socks5"
+)
+
+type fakeConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c fakeConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestLookupAssoc(t *testing.T) {
+	h := &Handler{}
+	ctrl := fakeConn{remote: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 40000}}
+
+	// The first grant announces no source port, the second announces 5353.
+	unbound := h.associate(ctrl, &socks5.Request{DstPort: []byte{0, 0}})
+	fixed := h.associate(ctrl, &socks5.Request{DstPort: []byte{0x14, 0xe9}})
+
+	if got := h.lookupAssoc(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5353}); got != nil {
+		t.Fatalf("datagram from another host matched a grant")
+	}
+	if got := h.lookupAssoc(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5353}); got != fixed {
+		t.Fatalf("announced port did not match its grant")
+	}
+	if got := h.lookupAssoc(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6000}); got != unbound {
+		t.Fatalf("first unknown port was not bound to the open grant")
+	}
+	if got := h.lookupAssoc(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6001}); got != nil {
+		t.Fatalf("second unknown port matched a grant that is already bound")
+	}
+	if got := h.lookupAssoc(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6000}); got != unbound {
+		t.Fatalf("bound port no longer maps to its grant")
+	}
+}
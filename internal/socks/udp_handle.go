@@ -1,6 +1,7 @@
 package socks
 
 import (
+	"fmt"
 	"io"
 	"net"
 	"paqet/internal/flog"
@@ -10,11 +11,17 @@ import (
 	"github.com/txthinking/socks5"
 )
 
+// udpIdleTimeout closes a relay stream that has received nothing for this
+// long. It is kept well above typical keepalive intervals of games and QUIC
+// so the mapping, and with it the server's exit port, stays stable.
+const udpIdleTimeout = 60 * time.Second
+
 func (h *Handler) UDPHandle(server *socks5.Server, addr *net.UDPAddr, d *socks5.Datagram) error {
-	bufp := buffer.UPool.Get()
-	defer buffer.UPool.Put(bufp)
-	buf := *bufp
-	strm, new, k, err := h.client.UDP(addr.String(), d.Address())
+	a := h.lookupAssoc(addr)
+	if a == nil {
+		return fmt.Errorf("no UDP association for %s", addr)
+	}
+	strm, new, k, err := a.stream(h, addr, d.Address())
 	if err != nil {
 		flog.Errorf("SOCKS5 failed to establish UDP stream for %s -> %s: %v", addr, d.Address(), err)
 		return err
@@ -24,27 +31,30 @@ func (h *Handler) UDPHandle(server *socks5.Server, addr *net.UDPAddr, d *socks5.
 	strm.SetWriteDeadline(time.Time{})
 	if err != nil {
 		flog.Errorf("SOCKS5 failed to forward %d bytes from %s -> %s: %v", len(d.Data), addr, d.Address(), err)
-		h.client.CloseUDP(k)
+		a.closeStream(h, k, strm)
 		return err
 	}
 
 	if new {
 		flog.Infof("SOCKS5 accepted UDP connection %s -> %s", addr, d.Address())
 		go func() {
+			bufp := buffer.UPool.Get()
+			defer buffer.UPool.Put(bufp)
+			buf := *bufp
 			defer func() {
-				flog.Debugf("SOCKS5 UDP stream %d closed for %s -> %s", strm.SID(), addr, d.Address())
-				h.client.CloseUDP(k)
+				flog.Debugf("SOCKS5 UDP stream %s closed for %s -> %s", strm.CID(), addr, d.Address())
+				a.closeStream(h, k, strm)
 			}()
 			for {
 				select {
 				case <-h.ctx.Done():
 					return
 				default:
-					strm.SetDeadline(time.Now().Add(8 * time.Second))
+					strm.SetDeadline(time.Now().Add(udpIdleTimeout))
 					n, err := strm.Read(buf)
 					strm.SetDeadline(time.Time{})
 					if err != nil {
-						flog.Debugf("SOCKS5 UDP stream %d read error for %s -> %s: %v", strm.SID(), addr, d.Address(), err)
+						flog.Debugf("SOCKS5 UDP stream %s read error for %s -> %s: %v", strm.CID(), addr, d.Address(), err)
 						return
 					}
 					dd := socks5.NewDatagram(d.Atyp, d.DstAddr, d.DstPort, buf[:n])
@@ -60,8 +70,10 @@ func (h *Handler) UDPHandle(server *socks5.Server, addr *net.UDPAddr, d *socks5.
 	return nil
 }
 
-func (h *Handler) handleUDPAssociate(conn *net.TCPConn) error {
+func (h *Handler) handleUDPAssociate(conn net.Conn, r *socks5.Request) error {
 	addr := conn.LocalAddr().(*net.TCPAddr)
+	a := h.associate(conn, r)
+	defer h.release(a)
 
 	bufp := rPool.Get().(*[]byte)
 	defer rPool.Put(bufp)
@@ -0,0 +1,157 @@
+// Package state keeps what the client learns about its servers across
+// restarts: TLS session tickets, so that a restarted client resumes its
+// QUIC sessions instead of running full handshakes, and the certificates
+// trusted on first use.
+package state
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"paqet/internal/flog"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	sessionsFile = "quic_sessions.json"
+	knownFile    = "known_servers.json"
+
+	// maxSessions bounds the tickets kept; a client talks to few servers.
+	maxSessions = 64
+)
+
+// Store is a state directory. It is safe for concurrent use.
+type Store struct {
+	dir string
+
+	mu       sync.Mutex
+	sessions map[string]session // by TLS session cache key
+	known    map[string]string  // server address -> hex SHA-256 of its certificate
+}
+
+type session struct {
+	Ticket []byte `json:"ticket"`
+	State  []byte `json:"state"`
+}
+
+// Open loads the state kept in dir, creating the directory if needed.
+// Unreadable files are logged and start out empty.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	s := &Store{dir: dir, sessions: make(map[string]session), known: make(map[string]string)}
+	s.load(sessionsFile, &s.sessions)
+	s.load(knownFile, &s.known)
+	return s, nil
+}
+
+func (s *Store) load(name string, v any) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		flog.Warnf("ignoring state file %s: %v", filepath.Join(s.dir, name), err)
+	}
+}
+
+// save writes v to name atomically. The caller holds s.mu.
+func (s *Store) save(name string, v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		path := filepath.Join(s.dir, name)
+		if err = os.WriteFile(path+".tmp", data, 0o600); err == nil {
+			err = os.Rename(path+".tmp", path)
+		}
+	}
+	if err != nil {
+		flog.Warnf("failed to save state file %s: %v", name, err)
+	}
+}
+
+// Sessions returns a TLS client session cache backed by the store.
+func (s *Store) Sessions() tls.ClientSessionCache {
+	return sessionCache{s}
+}
+
+type sessionCache struct{ s *Store }
+
+func (c sessionCache) Get(key string) (*tls.ClientSessionState, bool) {
+	c.s.mu.Lock()
+	e, ok := c.s.sessions[key]
+	c.s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	state, err := tls.ParseSessionState(e.State)
+	if err != nil {
+		return nil, false
+	}
+	cs, err := tls.NewResumptionState(e.Ticket, state)
+	if err != nil {
+		return nil, false
+	}
+	return cs, true
+}
+
+func (c sessionCache) Put(key string, cs *tls.ClientSessionState) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if cs == nil {
+		delete(c.s.sessions, key)
+		c.s.save(sessionsFile, c.s.sessions)
+		return
+	}
+	ticket, state, err := cs.ResumptionState()
+	if err != nil || state == nil {
+		return
+	}
+	data, err := state.Bytes()
+	if err != nil {
+		return
+	}
+	if _, ok := c.s.sessions[key]; !ok && len(c.s.sessions) >= maxSessions {
+		for k := range c.s.sessions {
+			delete(c.s.sessions, k)
+			break
+		}
+	}
+	c.s.sessions[key] = session{Ticket: ticket, State: data}
+	c.s.save(sessionsFile, c.s.sessions)
+}
+
+// TrustOnFirstUse returns a certificate check for server that accepts the
+// first certificate it sees and records its fingerprint, then accepts only
+// that certificate.
+func (s *Store) TrustOnFirstUse(server string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("peer presented no certificate")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		fp := hex.EncodeToString(sum[:])
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		known, ok := s.known[server]
+		if !ok {
+			s.known[server] = fp
+			s.save(knownFile, s.known)
+			flog.Infof("trusting certificate %s of %s on first use", fp, server)
+			return nil
+		}
+		if known != fp {
+			return fmt.Errorf("certificate of %s changed from %s to %s; remove it from %s to trust the new one", server, known, fp, filepath.Join(s.dir, knownFile))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func selfSigned(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTrustOnFirstUse(t *testing.T) {
+	dir := t.TempDir()
+	a, b := selfSigned(t), selfSigned(t)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.TrustOnFirstUse("1.2.3.4:443")(a.Certificate, nil); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	// The decision survives a restart.
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := s.TrustOnFirstUse("1.2.3.4:443")
+	if err := verify(a.Certificate, nil); err != nil {
+		t.Fatalf("trusted certificate rejected: %v", err)
+	}
+	if err := verify(b.Certificate, nil); err == nil {
+		t.Fatal("changed certificate accepted")
+	}
+	if err := s.TrustOnFirstUse("5.6.7.8:443")(b.Certificate, nil); err != nil {
+		t.Fatalf("other server: %v", err)
+	}
+}
+
+// handshake runs a TLS 1.3 handshake over loopback TCP and reports whether
+// the client resumed a session.
+func handshake(t *testing.T, srv *tls.Config, cache tls.ClientSessionCache) bool {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		s, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer s.Close()
+		// Tickets follow the handshake; the client's read delivers them.
+		s.Write([]byte{0})
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := tls.Client(conn, &tls.Config{ServerName: "paqet", InsecureSkipVerify: true, ClientSessionCache: cache, MinVersion: tls.VersionTLS13})
+	if err := c.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	return c.ConnectionState().DidResume
+}
+
+func TestSessionsPersist(t *testing.T) {
+	dir := t.TempDir()
+	srv := &tls.Config{Certificates: []tls.Certificate{selfSigned(t)}, MinVersion: tls.VersionTLS13}
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handshake(t, srv, s.Sessions()) {
+		t.Fatal("first handshake resumed")
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !handshake(t, srv, s.Sessions()) {
+		t.Fatal("session was not resumed after reopening the store")
+	}
+}
@@ -0,0 +1,187 @@
+// Package tap mirrors stream activity to local debugging consumers: every
+// open, read, write and close of a tunnel stream is written as a JSON line
+// to each client connected to a unix socket, optionally with the first
+// bytes of the payload. It sees decrypted traffic and is meant for
+// debugging protocol issues only.
+package tap
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"paqet/internal/flog"
+	"paqet/internal/tnet"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queueLen is how many events a slow consumer may fall behind before
+// events are dropped for it; the tunnel never waits for a consumer.
+const queueLen = 4096
+
+// Event is one line of tap output.
+type Event struct {
+	Time  time.Time `json:"time"`
+	CID   string    `json:"cid"`
+	Kind  string    `json:"kind"`            // tcp, udp or tun
+	Event string    `json:"event"`           // open, in (read from the tunnel), out (written to it), close
+	Len   int       `json:"len,omitempty"`   // payload bytes of in and out events
+	Head  []byte    `json:"head,omitempty"`  // first tap.payload bytes, base64
+	Error string    `json:"error,omitempty"` // read or write error, io.EOF included
+}
+
+// Tap serves events to consumers of a unix socket. A nil *Tap is
+// disabled: Wrap returns streams unchanged.
+type Tap struct {
+	payload int
+	ln      net.Listener
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	nsubs   atomic.Int32
+	dropped atomic.Uint64
+}
+
+// Listen creates the socket at path, readable by its owner only, and
+// includes up to payload bytes of every read and write in the events.
+func Listen(path string, payload int) (*Tap, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	t := &Tap{payload: payload, ln: ln, subs: make(map[chan Event]struct{})}
+	go t.accept()
+	return t, nil
+}
+
+func (t *Tap) accept() {
+	for {
+		c, err := t.ln.Accept()
+		if err != nil {
+			return
+		}
+		ch := make(chan Event, queueLen)
+		t.mu.Lock()
+		t.subs[ch] = struct{}{}
+		t.nsubs.Add(1)
+		t.mu.Unlock()
+		flog.Infof("tap consumer connected")
+		go t.serve(c, ch)
+	}
+}
+
+func (t *Tap) serve(c net.Conn, ch chan Event) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.subs, ch)
+		t.nsubs.Add(-1)
+		t.mu.Unlock()
+		_ = c.Close()
+		flog.Infof("tap consumer disconnected")
+	}()
+	w := bufio.NewWriter(c)
+	enc := json.NewEncoder(w)
+	for e := range ch {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+		if len(ch) == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// publish hands e to every consumer that has room for it.
+func (t *Tap) publish(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ch := range t.subs {
+		select {
+		case ch <- e:
+		default:
+			t.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped counts events not delivered to slow consumers.
+func (t *Tap) Dropped() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+// Close stops serving consumers and removes the socket.
+func (t *Tap) Close() error {
+	if t == nil {
+		return nil
+	}
+	err := t.ln.Close()
+	t.mu.Lock()
+	for ch := range t.subs {
+		close(ch)
+		delete(t.subs, ch)
+	}
+	t.mu.Unlock()
+	return err
+}
+
+// Wrap reports the activity of strm, a stream of kind, while consumers are
+// connected.
+func (t *Tap) Wrap(strm tnet.Strm, kind string) tnet.Strm {
+	if t == nil {
+		return strm
+	}
+	s := &tappedStrm{Strm: strm, t: t, kind: kind}
+	s.event("open", nil, 0, nil)
+	return s
+}
+
+type tappedStrm struct {
+	tnet.Strm
+	t      *Tap
+	kind   string
+	closed sync.Once
+}
+
+func (s *tappedStrm) event(ev string, b []byte, n int, err error) {
+	if s.t.nsubs.Load() == 0 {
+		return
+	}
+	e := Event{Time: time.Now(), CID: s.CID(), Kind: s.kind, Event: ev, Len: n}
+	if k := min(n, s.t.payload); k > 0 {
+		e.Head = append([]byte(nil), b[:k]...)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.t.publish(e)
+}
+
+func (s *tappedStrm) Read(b []byte) (int, error) {
+	n, err := s.Strm.Read(b)
+	s.event("in", b, n, err)
+	return n, err
+}
+
+func (s *tappedStrm) Write(b []byte) (int, error) {
+	n, err := s.Strm.Write(b)
+	s.event("out", b, n, err)
+	return n, err
+}
+
+func (s *tappedStrm) Close() error {
+	s.closed.Do(func() { s.event("close", nil, 0, nil) })
+	return s.Strm.Close()
+}
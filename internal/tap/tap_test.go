@@ -0,0 +1,76 @@
+package tap
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type pipeStrm struct{ net.Conn }
+
+func (pipeStrm) SID() int    { return 1 }
+func (pipeStrm) CID() string { return "test" }
+
+func TestTapReportsStreamActivity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tap.sock")
+	tp, err := Listen(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for tp.nsubs.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	a, b := net.Pipe()
+	defer b.Close()
+	strm := tp.Wrap(pipeStrm{a}, "tcp")
+	go b.Read(make([]byte, 64))
+	if _, err := strm.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	strm.Close()
+
+	r := bufio.NewScanner(c)
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var got []Event
+	for len(got) < 3 && r.Scan() {
+		var e Event
+		if err := json.Unmarshal(r.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d events: %v", len(got), r.Err())
+	}
+	if got[0].Event != "open" {
+		t.Errorf("first event = %+v, want open", got[0])
+	}
+	if e := got[1]; e.Event != "out" || e.Len != 11 || string(e.Head) != "hell" || e.CID != "test" || e.Kind != "tcp" {
+		t.Errorf("write event = %+v", e)
+	}
+	if got[2].Event != "close" {
+		t.Errorf("third event = %+v, want close", got[2])
+	}
+}
+
+func TestNilTapIsDisabled(t *testing.T) {
+	var tp *Tap
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	s := pipeStrm{a}
+	if tp.Wrap(s, "tcp") != s {
+		t.Error("nil tap wrapped the stream")
+	}
+}
@@ -1,12 +1,14 @@
 package tnet
 
 import (
+	"context"
 	"net"
 	"time"
 )
 
 type Conn interface {
-	OpenStrm() (Strm, error)
+	// OpenStrm opens a stream, giving up once ctx is done.
+	OpenStrm(ctx context.Context) (Strm, error)
 	AcceptStrm() (Strm, error)
 	Ping(wait bool) error
 	Close() error
@@ -16,3 +18,23 @@ type Conn interface {
 	SetReadDeadline(t time.Time) error
 	SetWriteDeadline(t time.Time) error
 }
+
+// EarlyConn is implemented by connections that can carry streams before
+// their handshake completes, see quic.Dial.
+type EarlyConn interface {
+	Conn
+	// Confirm waits for the handshake and reports whether the server
+	// accepted what was sent ahead of it. If it did not, the streams
+	// opened until then are lost and new ones can be opened.
+	Confirm(ctx context.Context) (bool, error)
+}
+
+// LossCounter is implemented by connections that count the packets they
+// sent and those they had to send again, see server.destStats. KCP does
+// not: kcp-go counts retransmissions for the whole process only.
+type LossCounter interface {
+	// LossCounts returns the packets sent, retransmissions included, and
+	// the packets retransmitted or declared lost, since the connection
+	// was set up.
+	LossCounts() (sent, lost uint64)
+}
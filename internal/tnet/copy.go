@@ -0,0 +1,50 @@
+package tnet
+
+import "io"
+
+// WriteTo and ReadFrom implement io.WriterTo and io.ReaderFrom for a
+// stream wrapper by handing the copy to the stream it wraps, so that relays
+// keep that stream's fast copy path. counted, which may be nil, is called
+// with the bytes that each write or read moved.
+
+// WriteTo copies from strm to w.
+func WriteTo(strm Strm, w io.Writer, counted func(int)) (int64, error) {
+	if counted != nil {
+		w = countingWriter{w, counted}
+	}
+	return io.Copy(w, strm)
+}
+
+// ReadFrom copies from r to strm.
+func ReadFrom(strm Strm, r io.Reader, counted func(int)) (int64, error) {
+	if counted != nil {
+		r = countingReader{r, counted}
+	}
+	return io.Copy(strm, r)
+}
+
+type countingWriter struct {
+	io.Writer
+	counted func(int)
+}
+
+func (w countingWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	if n > 0 {
+		w.counted(n)
+	}
+	return n, err
+}
+
+type countingReader struct {
+	io.Reader
+	counted func(int)
+}
+
+func (r countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if n > 0 {
+		r.counted(n)
+	}
+	return n, err
+}
@@ -0,0 +1,40 @@
+package tnet
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// bufStrm is a Strm over a buffer.
+type bufStrm struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (s *bufStrm) Read(b []byte) (int, error)  { return s.buf.Read(b) }
+func (s *bufStrm) Write(b []byte) (int, error) { return s.buf.Write(b) }
+func (s *bufStrm) SID() int                    { return 0 }
+func (s *bufStrm) CID() string                 { return "" }
+
+func TestCopyCounts(t *testing.T) {
+	strm := &bufStrm{}
+	var in, out int
+	// Hide strings.Reader's WriteTo so that the copy reads from r.
+	r := struct{ io.Reader }{strings.NewReader("upload")}
+	if n, err := ReadFrom(strm, r, func(n int) { out += n }); n != 6 || err != nil || out != 6 {
+		t.Fatalf("ReadFrom: %d, %v, counted %d", n, err, out)
+	}
+	var dst bytes.Buffer
+	if n, err := WriteTo(strm, &dst, func(n int) { in += n }); n != 6 || err != nil || in != 6 {
+		t.Fatalf("WriteTo: %d, %v, counted %d", n, err, in)
+	}
+	if dst.String() != "upload" {
+		t.Errorf("copied %q", dst.String())
+	}
+	if _, err := WriteTo(strm, &dst, nil); err != nil {
+		t.Errorf("WriteTo without a counter: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+// Package dup carries one stream over two transport streams, usually on
+// different connections, for traffic where loss hurts more than bandwidth
+// (DNS, interactive shells). Every write is framed with a sequence number
+// and sent on both legs; the reader delivers each frame from whichever leg
+// brings it first and drops the copy.
+package dup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"paqet/internal/tnet"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxFrame   = 65535           // largest payload of one frame
+	queueLen   = 256             // frames buffered per leg
+	lagTimeout = time.Second     // how long a full leg may hold up writes
+	drainLimit = 5 * time.Second // how long Close waits for queued frames
+)
+
+// leg is one of the transport streams with its own writer, so a stalled
+// path does not delay the other.
+type leg struct {
+	strm tnet.Strm
+	q    chan []byte
+	dead atomic.Bool
+}
+
+// Strm merges up to two legs into one tnet.Strm.
+type Strm struct {
+	legs    []*leg
+	alive   atomic.Int32 // legs still readable
+	writers sync.WaitGroup
+
+	wmu  sync.Mutex
+	wseq uint32
+
+	rmu      sync.Mutex
+	next     uint32 // sequence number of the next frame to deliver
+	frames   chan []byte
+	pending  []byte
+	deadline atomic.Value // time.Time
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// New starts merging strms, which must carry the same frame sequence.
+// A single leg works too; it just has no redundancy.
+func New(strms ...tnet.Strm) *Strm {
+	s := &Strm{
+		frames: make(chan []byte, 64),
+		closed: make(chan struct{}),
+	}
+	s.alive.Store(int32(len(strms)))
+	for _, strm := range strms {
+		l := &leg{strm: strm, q: make(chan []byte, queueLen)}
+		s.legs = append(s.legs, l)
+		s.writers.Add(1)
+		go s.writeLeg(l)
+		go s.readLeg(l)
+	}
+	return s
+}
+
+// writeLeg sends queued frames on l until it fails or s is closed, then
+// flushes what is left.
+func (s *Strm) writeLeg(l *leg) {
+	defer s.writers.Done()
+	for {
+		select {
+		case f := <-l.q:
+			if _, err := l.strm.Write(f); err != nil {
+				s.retire(l)
+				return
+			}
+		case <-s.closed:
+			for {
+				select {
+				case f := <-l.q:
+					if _, err := l.strm.Write(f); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// retire stops using l after it failed or missed a frame; the remaining
+// leg carries the stream alone.
+func (s *Strm) retire(l *leg) {
+	if !l.dead.Swap(true) {
+		_ = l.strm.Close()
+	}
+}
+
+// readLeg delivers the frames of one leg that the other has not.
+func (s *Strm) readLeg(l *leg) {
+	defer func() {
+		if s.alive.Add(-1) == 0 {
+			close(s.frames)
+		}
+	}()
+	var hdr [6]byte
+	for {
+		if _, err := io.ReadFull(l.strm, hdr[:]); err != nil {
+			return
+		}
+		seq := binary.BigEndian.Uint32(hdr[:4])
+		data := make([]byte, binary.BigEndian.Uint16(hdr[4:]))
+		if _, err := io.ReadFull(l.strm, data); err != nil {
+			return
+		}
+
+		// Each leg is ordered and complete, so a frame is either the next
+		// one or a copy of one already delivered from the other leg.
+		s.rmu.Lock()
+		if seq != s.next {
+			s.rmu.Unlock()
+			continue
+		}
+		s.next++
+		select {
+		case s.frames <- data:
+		case <-s.closed:
+			s.rmu.Unlock()
+			return
+		}
+		s.rmu.Unlock()
+	}
+}
+
+func (s *Strm) Read(b []byte) (int, error) {
+	if len(s.pending) == 0 {
+		var timeout <-chan time.Time
+		if d, ok := s.deadline.Load().(time.Time); ok && !d.IsZero() {
+			t := time.NewTimer(time.Until(d))
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case f, ok := <-s.frames:
+			if !ok {
+				return 0, io.EOF
+			}
+			s.pending = f
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-s.closed:
+			return 0, io.ErrClosedPipe
+		}
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write queues b on every live leg. A leg that cannot take a frame within
+// lagTimeout while another leg has it is retired, since its copy of the
+// stream now has a gap.
+func (s *Strm) Write(b []byte) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	for written := 0; written < len(b); {
+		chunk := b[written:min(len(b), written+maxFrame)]
+		f := make([]byte, 0, 6+len(chunk))
+		f = binary.BigEndian.AppendUint32(f, s.wseq)
+		f = binary.BigEndian.AppendUint16(f, uint16(len(chunk)))
+		f = append(f, chunk...)
+		if !s.queue(f) {
+			return written, fmt.Errorf("all duplicate legs failed")
+		}
+		s.wseq++
+		written += len(chunk)
+	}
+	return len(b), nil
+}
+
+// queue hands f to the live legs and reports whether any took it.
+func (s *Strm) queue(f []byte) bool {
+	ok := 0
+	var lagging []*leg
+	for _, l := range s.legs {
+		if l.dead.Load() {
+			continue
+		}
+		select {
+		case l.q <- f:
+			ok++
+		default:
+			lagging = append(lagging, l)
+		}
+	}
+	for _, l := range lagging {
+		var timeout <-chan time.Time
+		if ok > 0 {
+			t := time.NewTimer(lagTimeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case l.q <- f:
+			ok++
+		case <-timeout:
+			s.retire(l)
+		case <-s.closed:
+			return false
+		}
+	}
+	return ok > 0
+}
+
+// Close flushes queued frames for up to drainLimit and closes both legs.
+func (s *Strm) Close() error {
+	var err error
+	s.once.Do(func() {
+		for _, l := range s.legs {
+			_ = l.strm.SetWriteDeadline(time.Now().Add(drainLimit))
+		}
+		close(s.closed)
+		s.writers.Wait()
+		for _, l := range s.legs {
+			if cerr := l.strm.Close(); cerr != nil && !l.dead.Load() {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+func (s *Strm) SetDeadline(t time.Time) error {
+	s.deadline.Store(t)
+	return s.SetWriteDeadline(t)
+}
+
+func (s *Strm) SetReadDeadline(t time.Time) error {
+	s.deadline.Store(t)
+	return nil
+}
+
+func (s *Strm) SetWriteDeadline(t time.Time) error {
+	for _, l := range s.legs {
+		_ = l.strm.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+func (s *Strm) LocalAddr() net.Addr  { return s.legs[0].strm.LocalAddr() }
+func (s *Strm) RemoteAddr() net.Addr { return s.legs[0].strm.RemoteAddr() }
+func (s *Strm) SID() int             { return s.legs[0].strm.SID() }
+func (s *Strm) CID() string          { return s.legs[0].strm.CID() }
@@ -0,0 +1,97 @@
+package dup
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type pipeStrm struct {
+	net.Conn
+	delay time.Duration // added to every write
+}
+
+func (p *pipeStrm) Write(b []byte) (int, error) {
+	time.Sleep(p.delay)
+	return p.Conn.Write(b)
+}
+
+func (p *pipeStrm) SID() int    { return 0 }
+func (p *pipeStrm) CID() string { return "test" }
+
+// pair returns two merged streams connected by two legs; the first leg of
+// the sender is slowed down by delay.
+func pair(delay time.Duration) (*Strm, *Strm, []net.Conn) {
+	a1, a2 := net.Pipe()
+	b1, b2 := net.Pipe()
+	tx := New(&pipeStrm{Conn: a1, delay: delay}, &pipeStrm{Conn: b1})
+	rx := New(&pipeStrm{Conn: a2}, &pipeStrm{Conn: b2})
+	return tx, rx, []net.Conn{a1, b1}
+}
+
+func readN(t *testing.T, s *Strm, n int) []byte {
+	t.Helper()
+	s.SetReadDeadline(time.Now().Add(2 * time.Second))
+	b := make([]byte, n)
+	if _, err := io.ReadFull(s, b); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return b
+}
+
+func TestDeliversOnce(t *testing.T) {
+	tx, rx, _ := pair(0)
+	defer tx.Close()
+	defer rx.Close()
+
+	want := []byte("query one|query two|")
+	if _, err := tx.Write(want[:10]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Write(want[10:]); err != nil {
+		t.Fatal(err)
+	}
+	if got := readN(t, rx, len(want)); !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Both copies have been consumed, nothing is left to read.
+	rx.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := rx.Read(make([]byte, 8)); err == nil {
+		t.Fatalf("read %d duplicate bytes", n)
+	}
+}
+
+func TestFasterLegWins(t *testing.T) {
+	tx, rx, _ := pair(time.Second)
+	defer tx.Close()
+	defer rx.Close()
+
+	start := time.Now()
+	tx.Write([]byte("ping"))
+	readN(t, rx, 4)
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("frame took %v, the slow leg held it up", d)
+	}
+}
+
+func TestSurvivesLegLoss(t *testing.T) {
+	tx, rx, raw := pair(0)
+	defer tx.Close()
+	defer rx.Close()
+
+	tx.Write([]byte("before"))
+	readN(t, rx, 6)
+
+	raw[0].Close()
+	for range 3 {
+		if _, err := tx.Write([]byte("after")); err != nil {
+			t.Fatalf("write with one leg left: %v", err)
+		}
+		if got := readN(t, rx, 5); string(got) != "after" {
+			t.Fatalf("got %q", got)
+		}
+	}
+}
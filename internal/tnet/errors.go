@@ -0,0 +1,30 @@
+package tnet
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by every transport, so that callers can branch with
+// errors.Is instead of matching messages. The transport's own error stays
+// in the chain and in the message.
+var (
+	// ErrConnClosed is returned by a connection or listener that has been
+	// closed, locally or by the peer.
+	ErrConnClosed = errors.New("connection closed")
+	// ErrAcceptTimeout is returned when an accept deadline passes before
+	// anything arrives. The connection is still usable.
+	ErrAcceptTimeout = errors.New("accept timed out")
+	// ErrStreamReset is returned by a stream that was aborted before it
+	// finished, usually by the peer.
+	ErrStreamReset = errors.New("stream reset")
+)
+
+// Wrap marks err as kind. Nil errors and errors already marked as kind are
+// returned unchanged.
+func Wrap(kind, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
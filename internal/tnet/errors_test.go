@@ -0,0 +1,23 @@
+package tnet
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	err := Wrap(ErrConnClosed, io.ErrClosedPipe)
+	if !errors.Is(err, ErrConnClosed) || !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("wrapped error %v lost an identity", err)
+	}
+	if errors.Is(err, ErrStreamReset) {
+		t.Fatalf("wrapped error %v matches another kind", err)
+	}
+	if again := Wrap(ErrConnClosed, err); again != err {
+		t.Errorf("wrapping twice gave %v", again)
+	}
+	if Wrap(ErrConnClosed, nil) != nil {
+		t.Error("wrapping nil gave an error")
+	}
+}
@@ -0,0 +1,113 @@
+// Package framed keeps datagram boundaries on a stream. Transport streams
+// deliver bytes, and reads may merge or split the writes of the peer,
+// which breaks UDP payloads relayed over them. Every write is preceded by
+// its 2-byte length and every read returns exactly one datagram. Writes
+// can optionally be paced, so that bursts do not queue up behind each
+// other on a TCP-based transport.
+package framed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"paqet/internal/metrics"
+	"paqet/internal/tnet"
+	"sync"
+	"time"
+)
+
+// MaxDatagram is the largest payload of one frame.
+const MaxDatagram = 65535
+
+// Stats counts framed datagrams and the time Write spent on them. Delay
+// covers pacing and the transport write itself, in microseconds. One Stats
+// is usually shared by all framed streams of a side.
+type Stats struct {
+	Datagrams metrics.Counter
+	Delay     metrics.Counter
+}
+
+// Strm frames the datagrams written to and read from a transport stream.
+type Strm struct {
+	tnet.Strm
+	stats    *Stats
+	interval time.Duration // between paced writes, 0 = unpaced
+
+	wmu  sync.Mutex
+	next time.Time // earliest start of the next paced write
+	wbuf []byte
+
+	rmu  sync.Mutex
+	rbuf []byte
+}
+
+// New frames strm. pace limits writes to that many datagrams per second,
+// 0 sends them as they come. stats may be nil.
+func New(strm tnet.Strm, pace int, stats *Stats) *Strm {
+	s := &Strm{Strm: strm, stats: stats}
+	if pace > 0 {
+		s.interval = time.Second / time.Duration(pace)
+	}
+	return s
+}
+
+// Read reads one datagram into b. A datagram larger than b is truncated,
+// as on a UDP socket, and the rest of it is discarded.
+func (s *Strm) Read(b []byte) (int, error) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	var hdr [2]byte
+	if _, err := io.ReadFull(s.Strm, hdr[:]); err != nil {
+		return 0, err
+	}
+	size := int(binary.BigEndian.Uint16(hdr[:]))
+	n, err := io.ReadFull(s.Strm, b[:min(size, len(b))])
+	if err != nil {
+		return n, unexpected(err)
+	}
+	if size > n {
+		if cap(s.rbuf) < size-n {
+			s.rbuf = make([]byte, size-n)
+		}
+		if _, err := io.ReadFull(s.Strm, s.rbuf[:size-n]); err != nil {
+			return n, unexpected(err)
+		}
+	}
+	return n, nil
+}
+
+// Write sends b as one datagram, after waiting for its pacing slot.
+func (s *Strm) Write(b []byte) (int, error) {
+	if len(b) > MaxDatagram {
+		return 0, fmt.Errorf("datagram of %d bytes exceeds %d", len(b), MaxDatagram)
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	start := time.Now()
+	if s.interval > 0 {
+		if wait := s.next.Sub(start); wait > 0 {
+			time.Sleep(wait)
+		} else {
+			s.next = start
+		}
+		s.next = s.next.Add(s.interval)
+	}
+	s.wbuf = binary.BigEndian.AppendUint16(s.wbuf[:0], uint16(len(b)))
+	s.wbuf = append(s.wbuf, b...)
+	if _, err := s.Strm.Write(s.wbuf); err != nil {
+		return 0, err
+	}
+	if s.stats != nil {
+		s.stats.Datagrams.Inc()
+		s.stats.Delay.Add(uint64(time.Since(start).Microseconds()))
+	}
+	return len(b), nil
+}
+
+// unexpected turns an EOF inside a frame into io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package framed
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type pipeStrm struct{ net.Conn }
+
+func (p pipeStrm) SID() int    { return 0 }
+func (p pipeStrm) CID() string { return "test" }
+
+func pair(pace int, stats *Stats) (*Strm, *Strm) {
+	a, b := net.Pipe()
+	return New(pipeStrm{a}, pace, stats), New(pipeStrm{b}, 0, nil)
+}
+
+func TestBoundaries(t *testing.T) {
+	var stats Stats
+	tx, rx := pair(0, &stats)
+	defer tx.Close()
+	defer rx.Close()
+
+	want := [][]byte{[]byte("first"), {}, bytes.Repeat([]byte{1}, 1400), []byte("last")}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, d := range want {
+			if _, err := tx.Write(d); err != nil {
+				return
+			}
+		}
+	}()
+	buf := make([]byte, 2048)
+	for i, d := range want {
+		n, err := rx.Read(buf)
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if !bytes.Equal(buf[:n], d) {
+			t.Fatalf("datagram %d: got %d bytes, want %d", i, n, len(d))
+		}
+	}
+	<-done
+	if n := stats.Datagrams.Load(); n != uint64(len(want)) {
+		t.Errorf("counted %d datagrams, want %d", n, len(want))
+	}
+}
+
+func TestTruncates(t *testing.T) {
+	tx, rx := pair(0, nil)
+	defer tx.Close()
+	defer rx.Close()
+
+	go func() {
+		tx.Write([]byte("0123456789"))
+		tx.Write([]byte("next"))
+	}()
+	buf := make([]byte, 4)
+	if n, err := rx.Read(buf); err != nil || string(buf[:n]) != "0123" {
+		t.Fatalf("got %q, %v, want the truncated datagram", buf[:n], err)
+	}
+	if n, err := rx.Read(buf); err != nil || string(buf[:n]) != "next" {
+		t.Fatalf("got %q, %v, want the following datagram whole", buf[:n], err)
+	}
+}
+
+func TestEOFInsideFrame(t *testing.T) {
+	a, b := net.Pipe()
+	rx := New(pipeStrm{b}, 0, nil)
+	go func() {
+		a.Write([]byte{0, 10, 'x'})
+		a.Close()
+	}()
+	if _, err := rx.Read(make([]byte, 16)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestPacing(t *testing.T) {
+	var stats Stats
+	tx, rx := pair(100, &stats)
+	defer tx.Close()
+	defer rx.Close()
+
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := rx.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	start := time.Now()
+	for range 11 {
+		if _, err := tx.Write([]byte("tick")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first datagram goes out at once, the next ten 10ms apart.
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("11 datagrams at 100/s took %s", d)
+	}
+	if d := time.Duration(stats.Delay.Load()) * time.Microsecond; d < 80*time.Millisecond {
+		t.Errorf("recorded %s of delay, want the pacing waits", d)
+	}
+}
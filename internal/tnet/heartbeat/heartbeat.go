@@ -0,0 +1,118 @@
+// Package heartbeat watches transport connections with periodic PPING
+// round trips on short-lived streams. It works the same over every tnet
+// transport, measures the round-trip time and declares the peer dead after
+// a number of consecutive failures, so that a dead connection is replaced
+// before a stream request runs into it.
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"sync"
+	"time"
+)
+
+// Config controls a Monitor.
+type Config struct {
+	Interval time.Duration // between pings
+	Timeout  time.Duration // before a ping counts as failed
+	Failures int           // consecutive failed pings that make the peer dead
+	Gob      bool          // the peer only reads gob messages, see protocol.Negotiate
+}
+
+// Stats is what a Monitor has observed of its peer.
+type Stats struct {
+	RTT      time.Duration // smoothed round-trip time, zero before the first pong
+	Failures int           // consecutive failed pings
+	LastPong time.Time
+}
+
+// Monitor pings one connection.
+type Monitor struct {
+	conn tnet.Conn
+	cfg  Config
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+func New(conn tnet.Conn, cfg Config) *Monitor {
+	return &Monitor{conn: conn, cfg: cfg}
+}
+
+// Stats returns a snapshot of the monitor's observations.
+func (m *Monitor) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Run pings the connection every interval. It returns nil when ctx is done,
+// and the last error once cfg.Failures pings in a row have failed.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		rtt, err := Ping(ctx, m.conn, m.cfg.Timeout, m.cfg.Gob)
+		if ctx.Err() != nil {
+			return nil
+		}
+		m.mu.Lock()
+		if err != nil {
+			m.stats.Failures++
+		} else {
+			m.stats.Failures = 0
+			m.stats.LastPong = time.Now()
+			if m.stats.RTT == 0 {
+				m.stats.RTT = rtt
+			} else {
+				m.stats.RTT = (7*m.stats.RTT + rtt) / 8
+			}
+		}
+		failures := m.stats.Failures
+		m.mu.Unlock()
+		if failures >= m.cfg.Failures {
+			return fmt.Errorf("%d heartbeats failed, last: %w", failures, err)
+		}
+	}
+}
+
+// Ping opens a stream on conn, sends a PPING, as gob if gob is set, and
+// waits up to timeout for the PPONG, returning the round-trip time.
+func Ping(ctx context.Context, conn tnet.Conn, timeout time.Duration, gob bool) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	strm, err := conn.OpenStrm(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer strm.Close()
+	if gob {
+		strm = protocol.GobStrm{Strm: strm}
+	}
+	_ = strm.SetDeadline(start.Add(timeout))
+
+	p := protocol.Proto{Type: protocol.PPING}
+	if err := p.Write(strm); err != nil {
+		return 0, err
+	}
+	if err := p.Read(strm); err != nil {
+		return 0, err
+	}
+	if err := p.Err(); err != nil {
+		return 0, err
+	}
+	if p.Type != protocol.PPONG {
+		return 0, fmt.Errorf("unexpected reply type %d", p.Type)
+	}
+	return time.Since(start), nil
+}
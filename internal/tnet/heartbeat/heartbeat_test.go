@@ -0,0 +1,88 @@
+package heartbeat
+
+import (
+	"context"
+	"net"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type pipeStrm struct{ net.Conn }
+
+func (pipeStrm) SID() int    { return 0 }
+func (pipeStrm) CID() string { return "test" }
+
+// fakeConn answers pings on each stream it opens while alive is set, and
+// leaves them unanswered otherwise.
+type fakeConn struct {
+	tnet.Conn
+	alive atomic.Bool
+}
+
+func (c *fakeConn) OpenStrm(ctx context.Context) (tnet.Strm, error) {
+	a, b := net.Pipe()
+	go func() {
+		defer b.Close()
+		var p protocol.Proto
+		if err := p.Read(b); err != nil || !c.alive.Load() {
+			return
+		}
+		r := p.Reply(protocol.PPONG)
+		r.Write(b)
+	}()
+	return pipeStrm{a}, nil
+}
+
+func TestMonitor(t *testing.T) {
+	conn := &fakeConn{}
+	conn.alive.Store(true)
+	m := New(conn, Config{Interval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond, Failures: 3})
+
+	done := make(chan error, 1)
+	go func() { done <- m.Run(context.Background()) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Stats().LastPong.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("no pong observed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if m.Stats().RTT <= 0 {
+		t.Fatal("RTT not measured")
+	}
+
+	conn.alive.Store(false)
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Run returned nil for a dead peer")
+		}
+		if f := m.Stats().Failures; f != 3 {
+			t.Fatalf("peer declared dead after %d failures, want 3", f)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("dead peer not detected")
+	}
+}
+
+func TestMonitorStops(t *testing.T) {
+	conn := &fakeConn{}
+	m := New(conn, Config{Interval: 10 * time.Millisecond, Timeout: time.Second, Failures: 100})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v after cancel", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
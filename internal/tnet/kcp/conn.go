@@ -1,7 +1,10 @@
 package kcp
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"paqet/internal/protocol"
 	"paqet/internal/socket"
@@ -18,26 +21,35 @@ type Conn struct {
 	Session    *smux.Session
 }
 
-func (c *Conn) OpenStrm() (tnet.Strm, error) {
+// OpenStrm checks ctx before opening: smux opens a stream without a round
+// trip, so only a congested session can hold it up, and that is bounded by
+// the session's own write timeout.
+func (c *Conn) OpenStrm(ctx context.Context) (tnet.Strm, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	strm, err := c.Session.OpenStream()
 	if err != nil {
-		return nil, err
+		return nil, c.sessErr(err)
 	}
-	return &Strm{strm}, nil
+	return &Strm{Stream: strm, cid: tnet.NewCID()}, nil
 }
 
 func (c *Conn) AcceptStrm() (tnet.Strm, error) {
 	strm, err := c.Session.AcceptStream()
+	if errors.Is(err, smux.ErrTimeout) {
+		return nil, tnet.Wrap(tnet.ErrAcceptTimeout, err)
+	}
 	if err != nil {
-		return nil, err
+		return nil, c.sessErr(err)
 	}
-	return &Strm{strm}, nil
+	return &Strm{Stream: strm, cid: tnet.NewCID()}, nil
 }
 
 func (c *Conn) Ping(wait bool) error {
 	strm, err := c.Session.OpenStream()
 	if err != nil {
-		return fmt.Errorf("ping failed: %v", err)
+		return fmt.Errorf("ping failed: %w", c.sessErr(err))
 	}
 	defer strm.Close()
 	if wait {
@@ -57,6 +69,20 @@ func (c *Conn) Ping(wait bool) error {
 	return nil
 }
 
+// sessErr marks err as tnet.ErrConnClosed once the session is closed, or
+// its link has ended.
+func (c *Conn) sessErr(err error) error {
+	if c.Session.IsClosed() || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, io.EOF) {
+		return tnet.Wrap(tnet.ErrConnClosed, err)
+	}
+	return err
+}
+
+// NumStreams returns the number of open streams on the session.
+func (c *Conn) NumStreams() int {
+	return c.Session.NumStreams()
+}
+
 func (c *Conn) Close() error {
 	var err error
 	if c.UDPSession != nil {
@@ -83,3 +109,17 @@ func (c *Conn) PacketStats() (dropped uint64, queueDepth int) {
 	}
 	return c.PacketConn.DroppedPackets(), c.PacketConn.QueueDepth()
 }
+
+// DropStats returns the packet conn's drop counters by reason.
+func (c *Conn) DropStats() map[string]uint64 {
+	if c.PacketConn == nil {
+		return nil
+	}
+	return c.PacketConn.DropStats()
+}
+
+// SetWindowSize changes the session's send and receive windows, in
+// packets, while it runs.
+func (c *Conn) SetWindowSize(sndwnd, rcvwnd int) {
+	c.UDPSession.SetWindowSize(sndwnd, rcvwnd)
+}
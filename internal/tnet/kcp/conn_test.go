@@ -0,0 +1,77 @@
+package kcp
+
+import (
+	"context"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+	"paqet/internal/tnet/tnettest"
+	"testing"
+
+	"github.com/xtaci/kcp-go/v5"
+	"github.com/xtaci/smux"
+)
+
+func testConf() *conf.KCP {
+	return &conf.KCP{Mode: "fast2", MTU: 1350, Rcvwnd: 512, Sndwnd: 512, Smuxbuf: 4 * 1024 * 1024, Streambuf: 2 * 1024 * 1024}
+}
+
+// pipe connects a client and a server Conn over loopback UDP, the way Dial
+// and Listen do over the raw packet conn.
+func pipe(t *testing.T) (tnet.Conn, tnet.Conn, func()) {
+	t.Helper()
+	spc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kl, err := kcp.ServeConn(nil, 0, 0, spc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Listener{cfg: testConf(), listener: kl}
+	accepted := make(chan tnet.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	cpc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := kcp.NewConn(spc.LocalAddr().String(), nil, 0, 0, cpc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aplConf(us, testConf())
+	sess, err := smux.Client(us, smuxConf(testConf()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Conn{nil, us, sess}
+
+	// The server learns of the session from its first packet, so a first
+	// stream brings it up and is then discarded.
+	s1, err := client.OpenStrm(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+	s2, err := server.AcceptStrm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1.Close()
+	s2.Close()
+	return client, server, func() {
+		l.Close()
+		spc.Close()
+		cpc.Close()
+	}
+}
+
+func TestConformance(t *testing.T) {
+	tnettest.TestConn(t, pipe)
+}
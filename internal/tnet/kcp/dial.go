@@ -5,6 +5,7 @@ import (
 	"net"
 	"paqet/internal/conf"
 	"paqet/internal/flog"
+	"paqet/internal/obfs"
 	"paqet/internal/socket"
 	"paqet/internal/tnet"
 
@@ -12,8 +13,8 @@ import (
 	"github.com/xtaci/smux"
 )
 
-func Dial(addr *net.UDPAddr, cfg *conf.KCP, pConn *socket.PacketConn) (tnet.Conn, error) {
-	conn, err := kcp.NewConn(addr.String(), cfg.Block, cfg.Dshard, cfg.Pshard, pConn)
+func Dial(addr *net.UDPAddr, cfg *conf.KCP, ob *conf.Obfs, pConn *socket.PacketConn) (tnet.Conn, error) {
+	conn, err := kcp.NewConn(addr.String(), cfg.Block, cfg.Dshard, cfg.Pshard, obfs.Wrap(pConn, ob))
 	if err != nil {
 		return nil, fmt.Errorf("connection attempt failed: %v", err)
 	}
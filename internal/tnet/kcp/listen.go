@@ -1,8 +1,11 @@
 package kcp
 
 import (
+	"errors"
+	"io"
 	"net"
 	"paqet/internal/conf"
+	"paqet/internal/obfs"
 	"paqet/internal/socket"
 	"paqet/internal/tnet"
 
@@ -16,8 +19,8 @@ type Listener struct {
 	listener   *kcp.Listener
 }
 
-func Listen(cfg *conf.KCP, pConn *socket.PacketConn) (tnet.Listener, error) {
-	l, err := kcp.ServeConn(cfg.Block, cfg.Dshard, cfg.Pshard, pConn)
+func Listen(cfg *conf.KCP, ob *conf.Obfs, pConn *socket.PacketConn) (tnet.Listener, error) {
+	l, err := kcp.ServeConn(cfg.Block, cfg.Dshard, cfg.Pshard, obfs.Wrap(pConn, ob))
 	if err != nil {
 		return nil, err
 	}
@@ -27,6 +30,9 @@ func Listen(cfg *conf.KCP, pConn *socket.PacketConn) (tnet.Listener, error) {
 
 func (l *Listener) Accept() (tnet.Conn, error) {
 	conn, err := l.listener.AcceptKCP()
+	if errors.Is(err, io.ErrClosedPipe) {
+		return nil, tnet.Wrap(tnet.ErrConnClosed, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -6,8 +6,13 @@ import (
 
 type Strm struct {
 	*smux.Stream
+	cid string
 }
 
 func (s *Strm) SID() int {
 	return int(s.ID())
 }
+
+func (s *Strm) CID() string {
+	return s.cid
+}
@@ -0,0 +1,112 @@
+package kcptun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+	"time"
+
+	"github.com/xtaci/kcp-go/v5"
+	"github.com/xtaci/smux"
+)
+
+// Conn is a kcptun session.
+type Conn struct {
+	UDPSession *kcp.UDPSession
+	Session    *smux.Session
+}
+
+// Dial opens a session to the kcptun server cfg.Remote.
+func Dial(cfg *conf.Kcptun) (tnet.Conn, error) {
+	conn, err := kcp.DialWithOptions(cfg.Remote.String(), cfg.Block, *cfg.DataShard, *cfg.ParityShard)
+	if err != nil {
+		return nil, fmt.Errorf("connection attempt failed: %v", err)
+	}
+	_ = conn.SetReadBuffer(sockbuf)
+	_ = conn.SetWriteBuffer(sockbuf)
+	return newSession(conn, cfg, false)
+}
+
+func (c *Conn) OpenStrm(ctx context.Context) (tnet.Strm, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	strm, err := c.Session.OpenStream()
+	if err != nil {
+		return nil, c.sessErr(err)
+	}
+	return newStrm(strm), nil
+}
+
+func (c *Conn) AcceptStrm() (tnet.Strm, error) {
+	strm, err := c.Session.AcceptStream()
+	if errors.Is(err, smux.ErrTimeout) {
+		return nil, tnet.Wrap(tnet.ErrAcceptTimeout, err)
+	}
+	if err != nil {
+		return nil, c.sessErr(err)
+	}
+	return newStrm(strm), nil
+}
+
+// Ping reports whether the session is still open. kcptun has no ping of
+// its own beyond the smux keepalives, which close a dead session.
+func (c *Conn) Ping(bool) error {
+	if c.Session.IsClosed() {
+		return tnet.Wrap(tnet.ErrConnClosed, io.ErrClosedPipe)
+	}
+	return nil
+}
+
+func (c *Conn) sessErr(err error) error {
+	if c.Session.IsClosed() || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, io.EOF) {
+		return tnet.Wrap(tnet.ErrConnClosed, err)
+	}
+	return err
+}
+
+func (c *Conn) Close() error {
+	c.Session.Close()
+	return c.UDPSession.Close()
+}
+
+func (c *Conn) LocalAddr() net.Addr                { return c.UDPSession.LocalAddr() }
+func (c *Conn) RemoteAddr() net.Addr               { return c.UDPSession.RemoteAddr() }
+func (c *Conn) SetDeadline(t time.Time) error      { return c.Session.SetDeadline(t) }
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.UDPSession.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.UDPSession.SetWriteDeadline(t) }
+
+// Listener accepts sessions from kcptun clients.
+type Listener struct {
+	cfg      *conf.Kcptun
+	listener *kcp.Listener
+}
+
+// Listen accepts kcptun clients on the UDP address cfg.Listen.
+func Listen(cfg *conf.Kcptun) (tnet.Listener, error) {
+	l, err := kcp.ListenWithOptions(cfg.Listen.String(), cfg.Block, *cfg.DataShard, *cfg.ParityShard)
+	if err != nil {
+		return nil, err
+	}
+	_ = l.SetReadBuffer(sockbuf)
+	_ = l.SetWriteBuffer(sockbuf)
+	return &Listener{cfg: cfg, listener: l}, nil
+}
+
+func (l *Listener) Accept() (tnet.Conn, error) {
+	conn, err := l.listener.AcceptKCP()
+	if errors.Is(err, io.ErrClosedPipe) {
+		return nil, tnet.Wrap(tnet.ErrConnClosed, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newSession(conn, l.cfg, true)
+}
+
+func (l *Listener) Close() error   { return l.listener.Close() }
+func (l *Listener) Addr() net.Addr { return l.listener.Addr() }
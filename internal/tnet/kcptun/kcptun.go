@@ -0,0 +1,117 @@
+// Package kcptun speaks the wire format of stock kcptun, so that paqet can
+// stand in for either end of an existing kcptun deployment. Unlike the kcp
+// transport it runs over a plain UDP socket, derives its key and picks its
+// KCP, compression and smux settings the way kcptun does, and its streams
+// carry no paqet header.
+package kcptun
+
+import (
+	"io"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/xtaci/kcp-go/v5"
+	"github.com/xtaci/smux"
+)
+
+// sockbuf is the UDP socket buffer size kcptun sets by default.
+const sockbuf = 4 * 1024 * 1024
+
+// configure applies kcptun's session settings for cfg.Mode.
+func configure(conn *kcp.UDPSession, cfg *conf.Kcptun) {
+	var noDelay, interval, resend, noCongestion int
+	switch cfg.Mode {
+	case "normal":
+		noDelay, interval, resend, noCongestion = 0, 40, 2, 1
+	case "fast":
+		noDelay, interval, resend, noCongestion = 0, 30, 2, 1
+	case "fast2":
+		noDelay, interval, resend, noCongestion = 1, 20, 2, 1
+	case "fast3":
+		noDelay, interval, resend, noCongestion = 1, 10, 2, 1
+	}
+	conn.SetStreamMode(true)
+	conn.SetWriteDelay(false)
+	conn.SetNoDelay(noDelay, interval, resend, noCongestion)
+	conn.SetWindowSize(cfg.SndWnd, cfg.RcvWnd)
+	conn.SetMtu(cfg.MTU)
+	conn.SetACKNoDelay(false)
+}
+
+// smuxConf returns the smux settings of a kcptun session.
+func smuxConf(cfg *conf.Kcptun) *smux.Config {
+	sconf := smux.DefaultConfig()
+	sconf.Version = cfg.SmuxVer
+	sconf.MaxReceiveBuffer = cfg.SmuxBuf
+	sconf.MaxStreamBuffer = cfg.StreamBuf
+	sconf.KeepAliveInterval = time.Duration(cfg.KeepAlive) * time.Second
+	sconf.KeepAliveTimeout = max(sconf.KeepAliveTimeout, 3*sconf.KeepAliveInterval)
+	return sconf
+}
+
+// newSession starts smux on conn, through snappy unless cfg.NoComp is set.
+func newSession(conn *kcp.UDPSession, cfg *conf.Kcptun, server bool) (*Conn, error) {
+	configure(conn, cfg)
+	var rwc io.ReadWriteCloser = conn
+	if !cfg.NoComp {
+		rwc = newCompStream(conn)
+	}
+	var sess *smux.Session
+	var err error
+	if server {
+		sess, err = smux.Server(rwc, smuxConf(cfg))
+	} else {
+		sess, err = smux.Client(rwc, smuxConf(cfg))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{UDPSession: conn, Session: sess}, nil
+}
+
+// compStream is kcptun's snappy framing of the whole session: every write
+// is flushed as its own frame.
+type compStream struct {
+	conn net.Conn
+	w    *snappy.Writer
+	r    *snappy.Reader
+}
+
+func newCompStream(conn net.Conn) *compStream {
+	return &compStream{conn: conn, w: snappy.NewBufferedWriter(conn), r: snappy.NewReader(conn)}
+}
+
+func (c *compStream) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *compStream) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(p); err != nil {
+		return 0, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *compStream) Close() error {
+	return c.conn.Close()
+}
+
+// Strm is a kcptun stream.
+type Strm struct {
+	*smux.Stream
+	cid string
+}
+
+func newStrm(s *smux.Stream) tnet.Strm {
+	return &Strm{Stream: s, cid: tnet.NewCID()}
+}
+
+func (s *Strm) SID() int    { return int(s.ID()) }
+func (s *Strm) CID() string { return s.cid }
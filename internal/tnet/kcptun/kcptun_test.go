@@ -0,0 +1,85 @@
+package kcptun
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"paqet/internal/conf"
+	"testing"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// testConf returns the kcptun defaults, as conf would fill them in.
+func testConf(t *testing.T, mod func(*conf.Kcptun)) *conf.Kcptun {
+	t.Helper()
+	block, err := kcp.NewAESBlockCrypt(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, ps := 10, 3
+	cfg := &conf.Kcptun{
+		Mode: "fast", MTU: 1350, SndWnd: 1024, RcvWnd: 1024, DataShard: &ds, ParityShard: &ps,
+		SmuxVer: 1, SmuxBuf: 4 * 1024 * 1024, StreamBuf: 2 * 1024 * 1024, KeepAlive: 10,
+		Block: block,
+	}
+	mod(cfg)
+	return cfg
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mod  func(*conf.Kcptun)
+	}{
+		{"defaults", func(*conf.Kcptun) {}},
+		{"nocomp smux2", func(k *conf.Kcptun) { k.NoComp, k.SmuxVer = true, 2 }},
+		{"no crypt no fec", func(k *conf.Kcptun) {
+			zero := 0
+			k.Block, k.DataShard, k.ParityShard = nil, &zero, &zero
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			scfg := testConf(t, tc.mod)
+			scfg.Listen = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+			l, err := Listen(scfg)
+			if err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+			defer l.Close()
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				strm, err := conn.AcceptStrm()
+				if err != nil {
+					return
+				}
+				_, _ = io.Copy(strm, strm)
+			}()
+
+			ccfg := testConf(t, tc.mod)
+			ccfg.Remote = l.Addr().(*net.UDPAddr)
+			conn, err := Dial(ccfg)
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer conn.Close()
+			strm, err := conn.OpenStrm(context.Background())
+			if err != nil {
+				t.Fatalf("OpenStrm: %v", err)
+			}
+			msg := bytes.Repeat([]byte("kcptun "), 10000)
+			go func() { _, _ = strm.Write(msg) }()
+			got := make([]byte, len(msg))
+			if _, err := io.ReadFull(strm, got); err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !bytes.Equal(got, msg) {
+				t.Error("echoed payload differs")
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+// Package multipath carries datagram traffic (TUN packets, UDP) over
+// several transport streams at once, one per transport connection. In
+// stripe mode each datagram takes the path that currently looks best, which
+// adds the paths' throughput; in duplicate mode every datagram is sent on
+// all paths and the first copy to arrive wins. Each path is probed in band
+// for RTT and loss to steer the choice.
+//
+// Datagrams may be delivered out of order, which TUN and UDP traffic
+// tolerate; ordered byte streams use package dup instead.
+package multipath
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"paqet/internal/flog"
+	"paqet/internal/tnet"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Mode selects how datagrams are spread over the paths.
+type Mode int
+
+const (
+	Stripe    Mode = iota // each datagram on the best path
+	Duplicate             // each datagram on every path
+)
+
+// ParseMode maps a config value ("stripe", "duplicate") to a Mode.
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "stripe":
+		return Stripe, nil
+	case "duplicate":
+		return Duplicate, nil
+	}
+	return 0, fmt.Errorf("unknown multipath mode %q", s)
+}
+
+const (
+	maxFrame   = 65535
+	queueLen   = 256
+	probeEvery = time.Second
+	window     = 4096 // sequence numbers remembered for duplicate detection
+)
+
+// Frame kinds.
+const (
+	kindData     = 0
+	kindProbe    = 1
+	kindProbeAck = 2
+)
+
+// path is one leg with its own writer and measurements.
+type path struct {
+	id   int
+	strm tnet.Strm
+	q    chan []byte
+	dead atomic.Bool
+
+	mu      sync.Mutex
+	srtt    time.Duration
+	loss    float64              // smoothed fraction of unanswered probes
+	probes  map[uint32]time.Time // outstanding probe sequence -> sent
+	sent    float64              // bytes scheduled recently, decays every probe
+	probeID uint32
+}
+
+// Strm spreads datagrams over its paths and merges what they deliver.
+type Strm struct {
+	mode    Mode
+	paths   []*path
+	alive   atomic.Int32 // paths not failed
+	readers atomic.Int32 // frames is closed when the last reader exits
+
+	wmu  sync.Mutex
+	wseq uint32
+
+	rmu      sync.Mutex
+	seen     dedup
+	frames   chan []byte
+	pending  []byte
+	deadline atomic.Value // time.Time
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// New starts a multipath stream over legs, which must be the matching
+// streams on the other side's New.
+func New(mode Mode, legs ...tnet.Strm) *Strm {
+	s := &Strm{
+		mode:   mode,
+		frames: make(chan []byte, queueLen),
+		closed: make(chan struct{}),
+	}
+	s.alive.Store(int32(len(legs)))
+	s.readers.Store(int32(len(legs)))
+	for i, strm := range legs {
+		p := &path{id: i, strm: strm, q: make(chan []byte, queueLen), srtt: 100 * time.Millisecond, probes: make(map[uint32]time.Time)}
+		s.paths = append(s.paths, p)
+		go s.writePath(p)
+		go s.readPath(p)
+	}
+	go s.probe()
+	return s
+}
+
+func frame(kind byte, seq uint32, data []byte) []byte {
+	f := make([]byte, 0, 7+len(data))
+	f = append(f, kind)
+	f = binary.BigEndian.AppendUint32(f, seq)
+	f = binary.BigEndian.AppendUint16(f, uint16(len(data)))
+	return append(f, data...)
+}
+
+func (s *Strm) writePath(p *path) {
+	for {
+		select {
+		case f := <-p.q:
+			if _, err := p.strm.Write(f); err != nil {
+				s.fail(p, err)
+				return
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// fail takes p out of service; the stream continues on the other paths.
+func (s *Strm) fail(p *path, err error) {
+	if p.dead.Swap(true) {
+		return
+	}
+	_ = p.strm.Close()
+	if n := s.alive.Add(-1); n > 0 {
+		flog.Debugf("multipath stream %s lost path %d (%v), %d left", s.CID(), p.id, err, n)
+	}
+}
+
+func (s *Strm) readPath(p *path) {
+	defer func() {
+		if s.readers.Add(-1) == 0 {
+			close(s.frames)
+		}
+	}()
+	var hdr [7]byte
+	for {
+		if _, err := io.ReadFull(p.strm, hdr[:]); err != nil {
+			s.fail(p, err)
+			return
+		}
+		kind, seq := hdr[0], binary.BigEndian.Uint32(hdr[1:5])
+		data := make([]byte, binary.BigEndian.Uint16(hdr[5:]))
+		if _, err := io.ReadFull(p.strm, data); err != nil {
+			s.fail(p, err)
+			return
+		}
+
+		switch kind {
+		case kindProbe:
+			select {
+			case p.q <- frame(kindProbeAck, seq, nil):
+			default:
+			}
+		case kindProbeAck:
+			p.ack(seq)
+		case kindData:
+			s.rmu.Lock()
+			dup := s.seen.check(seq)
+			s.rmu.Unlock()
+			if dup {
+				continue
+			}
+			select {
+			case s.frames <- data:
+			case <-s.closed:
+				return
+			}
+		}
+	}
+}
+
+// probe sends an RTT probe on every path each probeEvery and counts probes
+// left unanswered for too long as lost.
+func (s *Strm) probe() {
+	ticker := time.NewTicker(probeEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.closed:
+			return
+		}
+		now := time.Now()
+		for _, p := range s.paths {
+			if p.dead.Load() {
+				continue
+			}
+			p.mu.Lock()
+			limit := max(4*p.srtt, probeEvery)
+			for id, sent := range p.probes {
+				if now.Sub(sent) > limit {
+					delete(p.probes, id)
+					p.loss = 0.875*p.loss + 0.125
+				}
+			}
+			p.sent /= 2
+			p.probeID++
+			id := p.probeID
+			p.probes[id] = now
+			p.mu.Unlock()
+			select {
+			case p.q <- frame(kindProbe, id, nil):
+			default:
+			}
+		}
+	}
+}
+
+func (p *path) ack(id uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sent, ok := p.probes[id]
+	if !ok {
+		return
+	}
+	delete(p.probes, id)
+	p.srtt = (7*p.srtt + time.Since(sent)) / 8
+	p.loss *= 0.875
+}
+
+// cost ranks paths for the next n bytes: a path with twice the RTT or
+// noticeable loss gets proportionally less traffic.
+func (p *path) cost(n int) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	weight := 1 / (p.srtt.Seconds() + 0.001) / (1 + 20*p.loss)
+	return (p.sent + float64(n)) / weight
+}
+
+func (s *Strm) Read(b []byte) (int, error) {
+	if len(s.pending) == 0 {
+		var timeout <-chan time.Time
+		if d, ok := s.deadline.Load().(time.Time); ok && !d.IsZero() {
+			t := time.NewTimer(time.Until(d))
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case f, ok := <-s.frames:
+			if !ok {
+				return 0, io.EOF
+			}
+			s.pending = f
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-s.closed:
+			return 0, io.ErrClosedPipe
+		}
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write sends b as one datagram, or several if it exceeds a frame.
+func (s *Strm) Write(b []byte) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	for written := 0; written < len(b); {
+		chunk := b[written:min(len(b), written+maxFrame)]
+		f := frame(kindData, s.wseq, chunk)
+		s.wseq++
+		if err := s.send(f); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return len(b), nil
+}
+
+// send queues a data frame on the cheapest path with room, or on every
+// path with room in duplicate mode. Only when no path has room does it
+// wait, for the cheapest one.
+func (s *Strm) send(f []byte) error {
+	var live []*path
+	var costs []float64
+	for _, p := range s.paths {
+		if !p.dead.Load() {
+			live = append(live, p)
+			costs = append(costs, p.cost(len(f)))
+		}
+	}
+	if len(live) == 0 {
+		return fmt.Errorf("all multipath paths failed")
+	}
+	sort.Sort(byCost{live, costs})
+
+	queued := false
+	for _, p := range live {
+		select {
+		case p.q <- f:
+			p.account(len(f))
+			queued = true
+		default:
+			continue
+		}
+		if s.mode == Stripe {
+			break
+		}
+	}
+	if queued {
+		return nil
+	}
+	select {
+	case live[0].q <- f:
+		live[0].account(len(f))
+		return nil
+	case <-s.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+type byCost struct {
+	paths []*path
+	costs []float64
+}
+
+func (b byCost) Len() int           { return len(b.paths) }
+func (b byCost) Less(i, j int) bool { return b.costs[i] < b.costs[j] }
+func (b byCost) Swap(i, j int) {
+	b.paths[i], b.paths[j] = b.paths[j], b.paths[i]
+	b.costs[i], b.costs[j] = b.costs[j], b.costs[i]
+}
+
+func (p *path) account(n int) {
+	p.mu.Lock()
+	p.sent += float64(n)
+	p.mu.Unlock()
+}
+
+func (s *Strm) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.closed)
+		for _, p := range s.paths {
+			if cerr := p.strm.Close(); cerr != nil && !p.dead.Load() {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+func (s *Strm) SetDeadline(t time.Time) error {
+	s.deadline.Store(t)
+	return nil
+}
+
+func (s *Strm) SetReadDeadline(t time.Time) error {
+	s.deadline.Store(t)
+	return nil
+}
+
+// SetWriteDeadline is a no-op: writes only wait for queue space.
+func (s *Strm) SetWriteDeadline(time.Time) error { return nil }
+
+func (s *Strm) LocalAddr() net.Addr  { return s.paths[0].strm.LocalAddr() }
+func (s *Strm) RemoteAddr() net.Addr { return s.paths[0].strm.RemoteAddr() }
+func (s *Strm) SID() int             { return s.paths[0].strm.SID() }
+func (s *Strm) CID() string          { return s.paths[0].strm.CID() }
+
+// dedup remembers the last window sequence numbers delivered.
+type dedup struct {
+	top  uint32
+	bits [window / 64]uint64
+	init bool
+}
+
+// check reports whether seq was delivered already or is too old to tell,
+// and marks it delivered otherwise.
+func (d *dedup) check(seq uint32) bool {
+	if !d.init {
+		d.init = true
+		d.top = seq
+		d.mark(seq)
+		return false
+	}
+	ahead := int32(seq - d.top)
+	switch {
+	case ahead > 0:
+		if ahead >= window {
+			d.bits = [window / 64]uint64{}
+		} else {
+			for i := uint32(1); i <= uint32(ahead); i++ {
+				d.clear(d.top + i)
+			}
+		}
+		d.top = seq
+	case -ahead >= window:
+		return true
+	case d.has(seq):
+		return true
+	}
+	d.mark(seq)
+	return false
+}
+
+func (d *dedup) mark(seq uint32)     { d.bits[seq%window/64] |= 1 << (seq % 64) }
+func (d *dedup) clear(seq uint32)    { d.bits[seq%window/64] &^= 1 << (seq % 64) }
+func (d *dedup) has(seq uint32) bool { return d.bits[seq%window/64]&(1<<(seq%64)) != 0 }
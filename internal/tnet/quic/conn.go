@@ -2,9 +2,12 @@ package quic
 
 import (
 	"context"
+	"errors"
 	"net"
 	"paqet/internal/socket"
 	"paqet/internal/tnet"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
@@ -16,16 +19,14 @@ type Conn struct {
 	packetConn *socket.PacketConn
 	ctx        context.Context
 	cancel     context.CancelFunc
-}
+	streams    atomic.Int64 // streams not yet closed locally
 
-func newConn(qconn *quic.Conn, pConn *socket.PacketConn) *Conn {
-	ctx, cancel := context.WithCancel(context.Background())
-	return &Conn{
-		connection: qconn,
-		packetConn: pConn,
-		ctx:        ctx,
-		cancel:     cancel,
-	}
+	flows     sync.Map // quic.StreamID -> *dgramState, streams in datagram mode
+	dgramOnce sync.Once
+
+	acceptBy atomic.Pointer[time.Time] // AcceptStrm deadline, see SetDeadline
+
+	early bool // dialed with 0-RTT, see Confirm
 }
 
 // newConnWithContext creates a Conn with a parent context for proper cancellation propagation
@@ -39,25 +40,86 @@ func newConnWithContext(qconn *quic.Conn, pConn *socket.PacketConn, parentCtx co
 	}
 }
 
-func (c *Conn) OpenStrm() (tnet.Strm, error) {
-	// Add timeout to prevent indefinite blocking under high load
-	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+func (c *Conn) OpenStrm(ctx context.Context) (tnet.Strm, error) {
+	// Add timeout to prevent indefinite blocking under high load, and give
+	// up as well when the connection itself is closed.
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
 
 	stream, err := c.connection.OpenStreamSync(ctx)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		if _, err = c.connection.NextConnection(ctx); err == nil {
+			stream, err = c.connection.OpenStreamSync(ctx)
+		}
+	}
 	if err != nil {
-		return nil, err
+		return nil, c.connErr(err)
 	}
-	return &Strm{stream: stream}, nil
+	c.streams.Add(1)
+	return &Strm{stream: stream, cid: tnet.NewCID(), open: &c.streams, conn: c}, nil
 }
 
 func (c *Conn) AcceptStrm() (tnet.Strm, error) {
 	// Use connection's context which will be cancelled on shutdown
-	stream, err := c.connection.AcceptStream(c.ctx)
+	ctx := c.ctx
+	if by := c.acceptBy.Load(); by != nil && !by.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, *by)
+		defer cancel()
+	}
+	stream, err := c.connection.AcceptStream(ctx)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		if _, err = c.connection.NextConnection(ctx); err == nil {
+			stream, err = c.connection.AcceptStream(ctx)
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) && c.ctx.Err() == nil {
+		return nil, tnet.Wrap(tnet.ErrAcceptTimeout, err)
+	}
 	if err != nil {
-		return nil, err
+		return nil, c.connErr(err)
+	}
+	c.streams.Add(1)
+	return &Strm{stream: stream, cid: tnet.NewCID(), open: &c.streams, conn: c}, nil
+}
+
+// connErr marks err as tnet.ErrConnClosed once the connection is closed.
+func (c *Conn) connErr(err error) error {
+	if err != nil && (c.ctx.Err() != nil || c.connection.Context().Err() != nil) {
+		return tnet.Wrap(tnet.ErrConnClosed, err)
 	}
-	return &Strm{stream: stream}, nil
+	return err
+}
+
+// Confirm waits for the handshake of a connection dialed with 0-RTT and
+// reports whether the server accepted the early data. If it rejected it,
+// the streams opened so far are reset and the connection is switched to
+// 1-RTT for new ones. Other connections are confirmed at once.
+func (c *Conn) Confirm(ctx context.Context) (bool, error) {
+	if !c.early {
+		return true, nil
+	}
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-c.connection.Context().Done():
+		return false, tnet.Wrap(tnet.ErrConnClosed, context.Cause(c.connection.Context()))
+	case <-c.connection.HandshakeComplete():
+	}
+	if c.connection.ConnectionState().Used0RTT {
+		return true, nil
+	}
+	if _, err := c.connection.NextConnection(ctx); err != nil {
+		return false, c.connErr(err)
+	}
+	return false, nil
+}
+
+// NumStreams returns the number of streams that have not been closed locally.
+func (c *Conn) NumStreams() int {
+	return int(c.streams.Load())
 }
 
 func (c *Conn) Ping(wait bool) error {
@@ -70,7 +132,7 @@ func (c *Conn) Ping(wait bool) error {
 
 		stream, err := c.connection.OpenStreamSync(ctx)
 		if err != nil {
-			return err
+			return c.connErr(err)
 		}
 		return stream.Close()
 	}
@@ -78,14 +140,14 @@ func (c *Conn) Ping(wait bool) error {
 	// Use our context to properly detect shutdown
 	select {
 	case <-c.ctx.Done():
-		return c.ctx.Err()
+		return tnet.Wrap(tnet.ErrConnClosed, c.ctx.Err())
 	default:
 	}
 
 	// Also check the QUIC connection status
 	select {
 	case <-c.connection.Context().Done():
-		return c.connection.Context().Err()
+		return tnet.Wrap(tnet.ErrConnClosed, context.Cause(c.connection.Context()))
 	default:
 		return nil
 	}
@@ -110,9 +172,10 @@ func (c *Conn) RemoteAddr() net.Addr {
 	return c.connection.RemoteAddr()
 }
 
+// SetDeadline bounds AcceptStrm, as on smux sessions. Reads and writes
+// have per-stream deadlines only.
 func (c *Conn) SetDeadline(t time.Time) error {
-	// QUIC connections don't support connection-level deadlines
-	// Deadlines must be set per-stream using stream.SetDeadline()
+	c.acceptBy.Store(&t)
 	return nil
 }
 
@@ -134,3 +197,19 @@ func (c *Conn) PacketStats() (dropped uint64, queueDepth int) {
 	}
 	return c.packetConn.DroppedPackets(), c.packetConn.QueueDepth()
 }
+
+// DropStats returns the packet conn's drop counters by reason.
+func (c *Conn) DropStats() map[string]uint64 {
+	if c.packetConn == nil {
+		return nil
+	}
+	return c.packetConn.DropStats()
+}
+
+// LossCounts returns the packets sent and declared lost on the connection.
+// Packets declared lost that arrive after all are taken back, so lost may
+// go down.
+func (c *Conn) LossCounts() (sent, lost uint64) {
+	st := c.connection.ConnectionStats()
+	return st.PacketsSent, st.PacketsLost
+}
@@ -0,0 +1,14 @@
+package quic
+
+import (
+	"paqet/internal/tnet"
+	"paqet/internal/tnet/tnettest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	tnettest.TestConn(t, func(t *testing.T) (tnet.Conn, tnet.Conn, func()) {
+		client, server := pair(t, false)
+		return client, server, nil
+	})
+}
@@ -0,0 +1,187 @@
+package quic
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Datagram mode carries the writes of a UDP or TUN stream in QUIC DATAGRAM
+// frames (RFC 9221) instead of stream frames, so that a lost packet does
+// not hold up the ones behind it. Each datagram starts with the stream ID
+// as a QUIC varint; both ends know the ID. The opener asks for datagram
+// mode with a flag in the stream header and keeps writing on the stream
+// until the first datagram of the peer, an empty one if need be, shows
+// that the peer switched: a server that predates datagram mode accepts the
+// stream but never reads datagrams. Writes too large for one datagram
+// still go on the stream, and reads merge both paths.
+
+// dgramQueueLen is how many received datagrams wait for the reader of one
+// stream before further ones are dropped.
+const dgramQueueLen = 256
+
+type dgramState struct {
+	prefix   []byte      // stream ID as a varint
+	send     atomic.Bool // the peer reads datagrams, so writes may use them
+	in       chan []byte
+	pending  []byte
+	deadline atomic.Value  // time.Time
+	eof      chan struct{} // closed when the stream path ends
+	err      error         // why the stream path ended, set before eof closes
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// SupportsDatagrams reports whether both peers negotiated QUIC datagrams
+// (transport.quic.enable_datagrams) on the stream's connection.
+func (s *Strm) SupportsDatagrams() bool {
+	if s.conn == nil {
+		return false
+	}
+	d := s.conn.connection.ConnectionState().SupportsDatagrams
+	return d.Local && d.Remote
+}
+
+// OfferDatagrams makes the opener of s, which asked for datagram mode in
+// the stream header, read datagrams. Its writes switch to datagrams once
+// the peer's first datagram arrives.
+func (s *Strm) OfferDatagrams() {
+	s.enableDatagrams()
+}
+
+// UseDatagrams switches s, whose opener asked for datagram mode, to it at
+// once and acknowledges with an empty datagram.
+func (s *Strm) UseDatagrams() {
+	d := s.enableDatagrams()
+	if d == nil || d.send.Swap(true) {
+		return
+	}
+	s.conn.connection.SendDatagram(d.prefix)
+}
+
+// enableDatagrams starts reading datagrams for s and returns its datagram
+// state, or nil if the connection does not support datagrams.
+func (s *Strm) enableDatagrams() *dgramState {
+	if !s.SupportsDatagrams() {
+		return nil
+	}
+	if d := s.dgram.Load(); d != nil {
+		return d
+	}
+	d := &dgramState{
+		prefix: quicvarint.Append(nil, uint64(s.stream.StreamID())),
+		in:     make(chan []byte, dgramQueueLen),
+		eof:    make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	s.conn.flows.Store(s.stream.StreamID(), d)
+	s.dgram.Store(d)
+	s.conn.dgramOnce.Do(func() { go s.conn.receiveDatagrams() })
+	go s.pumpStream(d)
+	return d
+}
+
+// pumpStream feeds what arrives on the stream path into the datagram
+// reader, so that Read can wait on both.
+func (s *Strm) pumpStream(d *dgramState) {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := s.stream.Read(buf)
+		if n > 0 {
+			select {
+			case d.in <- append([]byte(nil), buf[:n]...):
+			case <-d.closed:
+				return
+			}
+		}
+		if err != nil {
+			d.err = err
+			close(d.eof)
+			return
+		}
+	}
+}
+
+// receiveDatagrams hands each datagram on c to the stream it names.
+func (c *Conn) receiveDatagrams() {
+	for {
+		b, err := c.connection.ReceiveDatagram(c.ctx)
+		if err != nil {
+			return
+		}
+		id, n, err := quicvarint.Parse(b)
+		if err != nil {
+			continue
+		}
+		v, ok := c.flows.Load(quic.StreamID(id))
+		if !ok {
+			continue // stream closed, or not yet switched
+		}
+		d := v.(*dgramState)
+		d.send.Store(true)
+		if len(b) == n {
+			continue // acknowledgement of the switch
+		}
+		select {
+		case d.in <- b[n:]:
+		default: // reader behind; datagrams may be lost anyway
+		}
+	}
+}
+
+func (d *dgramState) read(p []byte) (int, error) {
+	if len(d.pending) == 0 {
+		var timeout <-chan time.Time
+		if t, ok := d.deadline.Load().(time.Time); ok && !t.IsZero() {
+			timer := time.NewTimer(time.Until(t))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case f := <-d.in:
+			d.pending = f
+		case <-d.eof:
+			select {
+			case f := <-d.in:
+				d.pending = f
+			default:
+				return 0, d.err
+			}
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-d.closed:
+			return 0, net.ErrClosed
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// writeDatagram sends p as one datagram, reporting false if it has to go
+// on the stream instead.
+func (s *Strm) writeDatagram(d *dgramState, p []byte) bool {
+	b := make([]byte, 0, len(d.prefix)+len(p))
+	b = append(append(b, d.prefix...), p...)
+	return s.conn.connection.SendDatagram(b) == nil
+}
+
+func (s *Strm) closeDatagrams(d *dgramState) {
+	d.once.Do(func() {
+		close(d.closed)
+		s.conn.flows.Delete(s.stream.StreamID())
+		// End the pump, which may be blocked reading the stream.
+		s.stream.CancelRead(0)
+	})
+}
+
+// plainReader and plainWriter hide the io.WriterTo and io.ReaderFrom of a
+// stream in datagram mode, which would bypass it.
+type plainReader struct{ io.Reader }
+type plainWriter struct{ io.Writer }
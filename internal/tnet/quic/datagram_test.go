@@ -0,0 +1,161 @@
+package quic
+
+import (
+	"bytes"
+	"context"
+	"paqet/internal/conf"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// pair connects a client and a server Conn over loopback UDP.
+func pair(t *testing.T, datagrams bool) (client, server *Conn) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	cfg := &conf.QUIC{ALPN: []string{"paqet"}, InsecureSkipVerify: true, EnableDatagrams: datagrams}
+	stls, err := cfg.GenerateTLSConfig("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctls, err := cfg.GenerateTLSConfig("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qcfg := &quic.Config{EnableDatagrams: datagrams}
+
+	ln, err := quic.ListenAddr("127.0.0.1:0", stls, qcfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	accepted := make(chan *quic.Conn, 1)
+	go func() {
+		c, err := ln.Accept(ctx)
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	qc, err := quic.DialAddr(ctx, ln.Addr().String(), ctls, qcfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = newConnWithContext(qc, nil, ctx)
+	server = newConnWithContext(<-accepted, nil, ctx)
+	t.Cleanup(func() { client.Close(); server.Close() })
+	return client, server
+}
+
+// open opens a stream from a to b, which grants the opener's request for
+// datagram mode.
+func open(t *testing.T, a, b *Conn) (*Strm, *Strm) {
+	t.Helper()
+	ctx := context.Background()
+	as, err := a.OpenStrm(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.Write([]byte("hdr")); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := b.AcceptStrm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := make([]byte, 3)
+	if _, err := bs.Read(hdr); err != nil {
+		t.Fatal(err)
+	}
+	as.(*Strm).OfferDatagrams()
+	bs.(*Strm).UseDatagrams()
+	return as.(*Strm), bs.(*Strm)
+}
+
+func TestDatagramMode(t *testing.T) {
+	client, server := pair(t, true)
+	cs, ss := open(t, client, server)
+	if !cs.SupportsDatagrams() || cs.dgram.Load() == nil || ss.dgram.Load() == nil {
+		t.Fatal("streams did not switch to datagram mode")
+	}
+	// The opener writes datagrams once the peer's acknowledgement arrives.
+	for deadline := time.Now().Add(2 * time.Second); !cs.dgram.Load().send.Load(); {
+		if time.Now().After(deadline) {
+			t.Fatal("opener never saw the switch acknowledged")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A small write goes as one datagram, a large one on the stream.
+	small := []byte("ping")
+	large := bytes.Repeat([]byte{1}, 4000)
+	ss.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, msg := range [][]byte{small, large} {
+		if _, err := cs.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 0, len(msg))
+		buf := make([]byte, 8192)
+		for len(got) < len(msg) {
+			n, err := ss.Read(buf)
+			if err != nil {
+				t.Fatalf("read after %d of %d bytes: %v", len(got), len(msg), err)
+			}
+			got = append(got, buf[:n]...)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("got %d bytes, want %d", len(got), len(msg))
+		}
+	}
+
+	// The read deadline applies in datagram mode too.
+	ss.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := ss.Read(make([]byte, 16)); err == nil {
+		t.Fatal("read returned without data before the deadline")
+	}
+}
+
+func TestDatagramsNotNegotiated(t *testing.T) {
+	client, server := pair(t, false)
+	cs, ss := open(t, client, server)
+	if cs.SupportsDatagrams() || cs.dgram.Load() != nil {
+		t.Fatal("stream switched to datagram mode without negotiation")
+	}
+	if _, err := cs.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	ss.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := ss.Read(buf); err != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("got %q, %v", buf[:n], err)
+	}
+}
+
+// TestDatagramsNotGranted tests that an opener keeps writing on the stream
+// when the peer, like a server that predates datagram mode, never switches.
+func TestDatagramsNotGranted(t *testing.T) {
+	client, server := pair(t, true)
+	ctx := context.Background()
+	as, err := client.OpenStrm(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := as.(*Strm)
+	cs.OfferDatagrams()
+	if _, err := cs.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := server.AcceptStrm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	ss.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := ss.Read(buf); err != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("got %q, %v", buf[:n], err)
+	}
+	if cs.dgram.Load().send.Load() {
+		t.Error("opener switched its writes without an acknowledgement")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"paqet/internal/conf"
 	"paqet/internal/flog"
+	"paqet/internal/obfs"
 	"paqet/internal/socket"
 	"paqet/internal/tnet"
 	"time"
@@ -13,7 +14,7 @@ import (
 	"github.com/quic-go/quic-go"
 )
 
-func Dial(ctx context.Context, addr *net.UDPAddr, cfg *conf.QUIC, pConn *socket.PacketConn) (tnet.Conn, error) {
+func Dial(ctx context.Context, addr *net.UDPAddr, cfg *conf.QUIC, ob *conf.Obfs, pConn *socket.PacketConn) (tnet.Conn, error) {
 	// Generate TLS config for client
 	tlsConfig, err := cfg.GenerateTLSConfig("client")
 	if err != nil {
@@ -35,13 +36,37 @@ func Dial(ctx context.Context, addr *net.UDPAddr, cfg *conf.QUIC, pConn *socket.
 	dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	// Dial QUIC connection using the packet connection
-	qconn, err := quic.Dial(dialCtx, pConn, addr, tlsConfig, quicConfig)
+	// Dial QUIC connection using the packet connection. With a session
+	// ticket from an earlier connection, an early dial returns before the
+	// handshake completes and streams go out as 0-RTT data.
+	pc := wrapPadding(obfs.Wrap(pConn, ob), cfg)
+	var qconn *quic.Conn
+	if cfg.Enable0RTTValue() {
+		qconn, err = quic.DialEarly(dialCtx, pc, addr, tlsConfig, quicConfig)
+	} else {
+		qconn, err = quic.Dial(dialCtx, pc, addr, tlsConfig, quicConfig)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("QUIC connection attempt failed: %v", err)
 	}
 
-	flog.Debugf("QUIC connection established to %s", addr.String())
+	c := dialed(ctx, qconn, pConn)
+	if c.early {
+		flog.Debugf("QUIC connection to %s resumed with 0-RTT", addr.String())
+	} else {
+		flog.Debugf("QUIC connection established to %s", addr.String())
+	}
+	return c, nil
+}
 
-	return newConn(qconn, pConn), nil
+// dialed wraps a dialed connection, noting whether it is still in a 0-RTT
+// handshake.
+func dialed(ctx context.Context, qconn *quic.Conn, pConn *socket.PacketConn) *Conn {
+	c := newConnWithContext(qconn, pConn, ctx)
+	select {
+	case <-qconn.HandshakeComplete():
+	default:
+		c.early = true
+	}
+	return c
 }
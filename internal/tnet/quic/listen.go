@@ -3,8 +3,10 @@ package quic
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"net"
 	"paqet/internal/conf"
+	"paqet/internal/obfs"
 	"paqet/internal/socket"
 	"paqet/internal/tnet"
 	"time"
@@ -15,12 +17,21 @@ import (
 type Listener struct {
 	packetConn *socket.PacketConn
 	cfg        *conf.QUIC
-	listener   *quic.Listener
+	listener   acceptor
 	tlsConfig  *tls.Config
 	ctx        context.Context
 }
 
-func Listen(cfg *conf.QUIC, pConn *socket.PacketConn) (tnet.Listener, error) {
+// acceptor is a *quic.Listener or *quic.EarlyListener.
+type acceptor interface {
+	Accept(ctx context.Context) (*quic.Conn, error)
+	Close() error
+	Addr() net.Addr
+}
+
+// Listen starts a QUIC listener on pConn. Accept returns once ctx is done,
+// and the connections it accepts are closed along with ctx.
+func Listen(ctx context.Context, cfg *conf.QUIC, ob *conf.Obfs, pConn *socket.PacketConn) (tnet.Listener, error) {
 	// Generate TLS config for server
 	tlsConfig, err := cfg.GenerateTLSConfig("server")
 	if err != nil {
@@ -30,8 +41,18 @@ func Listen(cfg *conf.QUIC, pConn *socket.PacketConn) (tnet.Listener, error) {
 	// Create QUIC config
 	quicConfig := getQUICConfig(cfg)
 
-	// Create QUIC listener using the packet connection
-	listener, err := quic.Listen(pConn, tlsConfig, quicConfig)
+	// Create QUIC listener using the packet connection. Only an early
+	// listener takes 0-RTT data. Its connections come before the
+	// handshake completes, but a client's 1-RTT streams cannot arrive
+	// before its Finished is verified, and 0-RTT ones only under a ticket
+	// from a handshake that was.
+	var listener acceptor
+	pc := wrapPadding(obfs.Wrap(pConn, ob), cfg)
+	if cfg.Enable0RTTValue() {
+		listener, err = quic.ListenEarly(pc, tlsConfig, quicConfig)
+	} else {
+		listener, err = quic.Listen(pc, tlsConfig, quicConfig)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -41,21 +62,12 @@ func Listen(cfg *conf.QUIC, pConn *socket.PacketConn) (tnet.Listener, error) {
 		cfg:        cfg,
 		listener:   listener,
 		tlsConfig:  tlsConfig,
-		ctx:        context.Background(),
+		ctx:        ctx,
 	}, nil
 }
 
-// SetContext allows setting a context for the listener for proper cancellation
-func (l *Listener) SetContext(ctx context.Context) {
-	l.ctx = ctx
-}
-
 func (l *Listener) Accept() (tnet.Conn, error) {
-	// Use listener's context with timeout to prevent indefinite blocking
 	ctx := l.ctx
-	if ctx == nil {
-		ctx = context.Background()
-	}
 
 	// Accept with timeout to allow periodic context checks
 	// Use a loop instead of recursion to prevent stack overflow under sustained timeouts
@@ -71,12 +83,15 @@ func (l *Listener) Accept() (tnet.Conn, error) {
 			if err == context.DeadlineExceeded {
 				select {
 				case <-ctx.Done():
-					return nil, ctx.Err()
+					return nil, tnet.Wrap(tnet.ErrConnClosed, ctx.Err())
 				default:
 					// Parent context not cancelled, just a timeout, continue loop
 					continue
 				}
 			}
+			if errors.Is(err, quic.ErrServerClosed) {
+				return nil, tnet.Wrap(tnet.ErrConnClosed, err)
+			}
 			return nil, err
 		}
 
@@ -0,0 +1,122 @@
+package quic
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"net"
+	"paqet/internal/conf"
+)
+
+// paddedConn pads outgoing handshake datagrams with trailing zeros and
+// strips them again on receipt. A zero byte can never start a valid QUIC
+// packet, so the trailer is unambiguous.
+type paddedConn struct {
+	net.PacketConn
+	cfg *conf.QUICPadding
+}
+
+func wrapPadding(pConn net.PacketConn, cfg *conf.QUIC) net.PacketConn {
+	if !cfg.Padding.Enabled() {
+		return pConn
+	}
+	return &paddedConn{PacketConn: pConn, cfg: &cfg.Padding}
+}
+
+func (c *paddedConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	end, ok := longHeaderEnd(b)
+	if !ok || end != len(b) {
+		return c.PacketConn.WriteTo(b, addr)
+	}
+	size := c.size()
+	if size <= len(b) {
+		return c.PacketConn.WriteTo(b, addr)
+	}
+	padded := make([]byte, size)
+	copy(padded, b)
+	if _, err := c.PacketConn.WriteTo(padded, addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *paddedConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	if err != nil || n == 0 {
+		return n, addr, err
+	}
+	if end, ok := longHeaderEnd(b[:n]); ok && end < n && allZero(b[end:n]) {
+		n = end
+	}
+	return n, addr, nil
+}
+
+// size draws a padded datagram size from the configured distribution.
+func (c *paddedConn) size() int {
+	lo, hi := c.cfg.Min, c.cfg.Max
+	if c.cfg.Distribution == "normal" {
+		mean, sd := float64(lo+hi)/2, float64(hi-lo)/6
+		return min(max(int(rand.NormFloat64()*sd+mean), lo), hi)
+	}
+	return lo + rand.IntN(hi-lo+1)
+}
+
+// longHeaderEnd walks the coalesced long-header packets at the start of b
+// and returns the offset just past the last one. ok is false unless b starts
+// with an Initial, 0-RTT or Handshake packet.
+func longHeaderEnd(b []byte) (end int, ok bool) {
+	for end < len(b) {
+		p := b[end:]
+		if p[0]&0xc0 != 0xc0 { // long header form with fixed bit
+			break
+		}
+		typ := (p[0] >> 4) & 0x3
+		if typ == 3 || len(p) < 7 { // Retry has no length field
+			break
+		}
+		i := 5
+		for range 2 { // destination and source connection IDs
+			if i >= len(p) {
+				return end, end > 0
+			}
+			i += 1 + int(p[i])
+		}
+		if typ == 0 { // Initial carries a token
+			tl, n := readVarint(p[min(i, len(p)):])
+			if n == 0 {
+				return end, end > 0
+			}
+			i += n + int(tl)
+		}
+		length, n := readVarint(p[min(i, len(p)):])
+		if n == 0 || i+n+int(length) > len(p) {
+			return end, end > 0
+		}
+		end += i + n + int(length)
+	}
+	return end, end > 0
+}
+
+// readVarint decodes a QUIC variable-length integer, returning n == 0 if b
+// is too short.
+func readVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	buf := make([]byte, 8)
+	copy(buf[8-n:], b[:n])
+	buf[8-n] &= 0x3f
+	return binary.BigEndian.Uint64(buf), n
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
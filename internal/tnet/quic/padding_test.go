@@ -0,0 +1,35 @@
+package quic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLongHeaderEnd(t *testing.T) {
+	// Initial: flags, version, dcid(4), scid(0), token(0), length(2-byte varint 10), payload
+	initial := []byte{0xc0, 0, 0, 0, 1, 4, 1, 2, 3, 4, 0, 0, 0x40, 10}
+	initial = append(initial, bytes.Repeat([]byte{0xaa}, 10)...)
+	// Handshake: flags, version, dcid(0), scid(0), length(1-byte varint 3), payload
+	handshake := []byte{0xe0, 0, 0, 0, 1, 0, 0, 3, 0xbb, 0xbb, 0xbb}
+	coalesced := append(append([]byte{}, initial...), handshake...)
+
+	tests := []struct {
+		name string
+		b    []byte
+		end  int
+		ok   bool
+	}{
+		{"initial", initial, len(initial), true},
+		{"coalesced", coalesced, len(coalesced), true},
+		{"padded", append(append([]byte{}, coalesced...), make([]byte, 64)...), len(coalesced), true},
+		{"short header", []byte{0x40, 1, 2, 3}, 0, false},
+		{"retry", []byte{0xf0, 0, 0, 0, 1, 0, 0, 1, 2, 3}, 0, false},
+		{"truncated", initial[:len(initial)-1], 0, false},
+	}
+	for _, tt := range tests {
+		end, ok := longHeaderEnd(tt.b)
+		if end != tt.end || ok != tt.ok {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", tt.name, end, ok, tt.end, tt.ok)
+		}
+	}
+}
@@ -20,6 +20,7 @@ func getQUICConfig(cfg *conf.QUIC) *quic.Config {
 		KeepAlivePeriod:                time.Duration(cfg.KeepAlivePeriod) * time.Second,
 		EnableDatagrams:                cfg.EnableDatagrams,
 		Allow0RTT:                      cfg.Enable0RTTValue(),
+		InitialPacketSize:              uint16(cfg.InitialPacketSize),
 	}
 
 	return config
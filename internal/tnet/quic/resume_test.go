@@ -0,0 +1,136 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"paqet/internal/conf"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// resumeTo dials an early listener twice with one session cache and
+// returns the second, resumed connection and the server's side of it. With
+// reject, the second connection goes to a listener that refuses 0-RTT.
+func resumeTo(t *testing.T, reject bool) (client, server *Conn) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	cfg := &conf.QUIC{ALPN: []string{"paqet"}, InsecureSkipVerify: true, ServerName: "paqet"}
+	stls, err := cfg.GenerateTLSConfig("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SessionCache = tls.NewLRUClientSessionCache(0)
+	ctls, err := cfg.GenerateTLSConfig("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qcfg := &quic.Config{Allow0RTT: true}
+
+	accepted := make(chan *quic.Conn, 2)
+	listen := func(qcfg *quic.Config) string {
+		ln, err := quic.ListenAddrEarly("127.0.0.1:0", stls, qcfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			for {
+				c, err := ln.Accept(ctx)
+				if err != nil {
+					return
+				}
+				accepted <- c
+			}
+		}()
+		return ln.Addr().String()
+	}
+	addr := listen(qcfg)
+
+	// The first connection completes a full handshake and gets a ticket.
+	first, err := quic.DialAddrEarly(ctx, addr, ctls, qcfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := dialed(ctx, first, nil); c.early {
+		t.Fatal("first connection claims 0-RTT without a ticket")
+	}
+	sc := <-accepted
+	// Tickets come after the handshake; a round trip makes sure it arrived.
+	strm, err := first.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = strm.Write([]byte("x"))
+	ss, err := sc.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.ReadFull(ss, make([]byte, 1))
+	_, _ = ss.Write([]byte("y"))
+	_, _ = io.ReadFull(strm, make([]byte, 1))
+	first.CloseWithError(0, "")
+
+	if reject {
+		addr = listen(&quic.Config{})
+	}
+	second, err := quic.DialAddrEarly(ctx, addr, ctls, qcfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = dialed(ctx, second, nil)
+	if !client.early {
+		t.Fatal("second connection did not use its session ticket")
+	}
+	server = newConnWithContext(<-accepted, nil, ctx)
+	t.Cleanup(func() { client.Close(); server.Close() })
+	return client, server
+}
+
+func TestResume0RTT(t *testing.T) {
+	client, server := resumeTo(t, false)
+	strm, err := client.OpenStrm(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strm.Write([]byte("early")); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := server.AcceptStrm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(ss, buf); err != nil || string(buf) != "early" {
+		t.Fatalf("server read %q, %v", buf, err)
+	}
+	if ok, err := client.Confirm(context.Background()); !ok || err != nil {
+		t.Fatalf("Confirm() = %v, %v, want accepted", ok, err)
+	}
+}
+
+func TestResume0RTTRejected(t *testing.T) {
+	client, server := resumeTo(t, true)
+	if ok, err := client.Confirm(context.Background()); ok || err != nil {
+		t.Fatalf("Confirm() = %v, %v, want rejected", ok, err)
+	}
+	// The connection carries new streams after the rejection.
+	strm, err := client.OpenStrm(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strm.Write([]byte("late")); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := server.AcceptStrm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(ss, buf); err != nil || string(buf) != "late" {
+		t.Fatalf("server read %q, %v", buf, err)
+	}
+}
@@ -1,8 +1,11 @@
 package quic
 
 import (
+	"errors"
 	"io"
 	"net"
+	"paqet/internal/tnet"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
@@ -11,17 +14,52 @@ import (
 // Strm wraps a QUIC stream to implement the tnet.Strm interface
 type Strm struct {
 	stream *quic.Stream
+	cid    string
+	open   *atomic.Int64 // the connection's open stream count
+	closed atomic.Bool
+
+	conn  *Conn
+	dgram atomic.Pointer[dgramState] // nil unless in datagram mode, see UseDatagrams
 }
 
 func (s *Strm) Read(p []byte) (n int, err error) {
-	return s.stream.Read(p)
+	if d := s.dgram.Load(); d != nil {
+		return d.read(p)
+	}
+	n, err = s.stream.Read(p)
+	return n, s.strmErr(err)
 }
 
 func (s *Strm) Write(p []byte) (n int, err error) {
-	return s.stream.Write(p)
+	if d := s.dgram.Load(); d != nil && d.send.Load() && s.writeDatagram(d, p) {
+		return len(p), nil
+	}
+	n, err = s.stream.Write(p)
+	return n, s.strmErr(err)
+}
+
+// strmErr marks an aborted stream as tnet.ErrStreamReset and a stream of a
+// closed connection as tnet.ErrConnClosed. io.EOF is returned unchanged.
+func (s *Strm) strmErr(err error) error {
+	var se *quic.StreamError
+	switch {
+	case err == nil || err == io.EOF:
+		return err
+	case errors.As(err, &se):
+		return tnet.Wrap(tnet.ErrStreamReset, err)
+	case s.conn != nil:
+		return s.conn.connErr(err)
+	}
+	return err
 }
 
 func (s *Strm) Close() error {
+	if !s.closed.Swap(true) {
+		s.open.Add(-1)
+	}
+	if d := s.dgram.Load(); d != nil {
+		s.closeDatagrams(d)
+	}
 	return s.stream.Close()
 }
 
@@ -36,10 +74,20 @@ func (s *Strm) RemoteAddr() net.Addr {
 }
 
 func (s *Strm) SetDeadline(t time.Time) error {
+	if d := s.dgram.Load(); d != nil {
+		d.deadline.Store(t)
+		return s.stream.SetWriteDeadline(t)
+	}
 	return s.stream.SetDeadline(t)
 }
 
 func (s *Strm) SetReadDeadline(t time.Time) error {
+	// In datagram mode the deadline applies to Read, not to the pump
+	// reading the stream path.
+	if d := s.dgram.Load(); d != nil {
+		d.deadline.Store(t)
+		return nil
+	}
 	return s.stream.SetReadDeadline(t)
 }
 
@@ -59,15 +107,28 @@ func (s *Strm) CloseRead() error {
 
 // WriteTo implements io.WriterTo for efficient copying
 func (s *Strm) WriteTo(w io.Writer) (n int64, err error) {
-	return io.Copy(w, s.stream)
+	if s.dgram.Load() != nil {
+		return io.Copy(w, plainReader{s})
+	}
+	n, err = io.Copy(w, s.stream)
+	return n, s.strmErr(err)
 }
 
 // ReadFrom implements io.ReaderFrom for efficient copying
 func (s *Strm) ReadFrom(r io.Reader) (n int64, err error) {
-	return io.Copy(s.stream, r)
+	if s.dgram.Load() != nil {
+		return io.Copy(plainWriter{s}, r)
+	}
+	n, err = io.Copy(s.stream, r)
+	return n, s.strmErr(err)
 }
 
 // SID returns the stream ID to implement the tnet.Strm interface
 func (s *Strm) SID() int {
 	return int(s.stream.StreamID())
 }
+
+// CID returns the log correlation ID to implement the tnet.Strm interface
+func (s *Strm) CID() string {
+	return s.cid
+}
@@ -1,10 +1,39 @@
 package tnet
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net"
 )
 
 type Strm interface {
 	net.Conn
 	SID() int
+	// CID is a short random correlation ID used to identify the stream in
+	// logs. Client and server assign their own; the client sends its CID
+	// when opening the stream so the pair can be matched.
+	CID() string
+}
+
+// DatagramStrm is implemented by streams that can carry their writes as
+// unreliable datagrams, see quic.Strm.
+type DatagramStrm interface {
+	Strm
+	// SupportsDatagrams reports whether both peers negotiated datagrams on
+	// the stream's connection.
+	SupportsDatagrams() bool
+	// OfferDatagrams is called by the opener of a stream that asked for
+	// datagrams in its header. Received datagrams are merged into reads,
+	// and writes that fit go as datagrams once the peer has switched.
+	OfferDatagrams()
+	// UseDatagrams is called by the peer that grants the request: writes
+	// that fit go as datagrams at once, and received ones merge into reads.
+	UseDatagrams()
+}
+
+// NewCID returns a 6-character stream correlation ID.
+func NewCID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
 }
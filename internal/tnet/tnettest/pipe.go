@@ -0,0 +1,84 @@
+package tnettest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"paqet/internal/tnet"
+	"time"
+
+	"github.com/xtaci/smux"
+)
+
+// Pipe returns the two ends of an in-memory transport connection, for
+// tests of code that runs on top of a tnet.Conn. Streams are multiplexed
+// with smux over a net.Pipe, as the kcp and websocket transports do over
+// their own links.
+func Pipe() (tnet.Conn, tnet.Conn) {
+	a, b := net.Pipe()
+	cfg := smux.DefaultConfig()
+	cfg.Version = 2
+	client, _ := smux.Client(a, cfg)
+	server, _ := smux.Server(b, cfg)
+	return &pipeConn{sess: client, link: a}, &pipeConn{sess: server, link: b}
+}
+
+type pipeConn struct {
+	sess *smux.Session
+	link net.Conn
+}
+
+type pipeStrm struct {
+	*smux.Stream
+}
+
+func (s pipeStrm) SID() int    { return int(s.ID()) }
+func (s pipeStrm) CID() string { return "pipe" }
+
+func (c *pipeConn) OpenStrm(ctx context.Context) (tnet.Strm, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s, err := c.sess.OpenStream()
+	if err != nil {
+		return nil, c.sessErr(err)
+	}
+	return pipeStrm{s}, nil
+}
+
+func (c *pipeConn) AcceptStrm() (tnet.Strm, error) {
+	s, err := c.sess.AcceptStream()
+	if errors.Is(err, smux.ErrTimeout) {
+		return nil, tnet.Wrap(tnet.ErrAcceptTimeout, err)
+	}
+	if err != nil {
+		return nil, c.sessErr(err)
+	}
+	return pipeStrm{s}, nil
+}
+
+func (c *pipeConn) sessErr(err error) error {
+	if c.sess.IsClosed() || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, io.EOF) {
+		return tnet.Wrap(tnet.ErrConnClosed, err)
+	}
+	return err
+}
+
+func (c *pipeConn) Ping(bool) error {
+	if c.sess.IsClosed() {
+		return tnet.Wrap(tnet.ErrConnClosed, io.ErrClosedPipe)
+	}
+	return nil
+}
+
+func (c *pipeConn) Close() error {
+	c.sess.Close()
+	return c.link.Close()
+}
+
+func (c *pipeConn) LocalAddr() net.Addr                { return c.link.LocalAddr() }
+func (c *pipeConn) RemoteAddr() net.Addr               { return c.link.RemoteAddr() }
+func (c *pipeConn) SetDeadline(t time.Time) error      { return c.sess.SetDeadline(t) }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return c.link.SetReadDeadline(t) }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return c.link.SetWriteDeadline(t) }
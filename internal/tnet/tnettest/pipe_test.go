@@ -0,0 +1,14 @@
+package tnettest
+
+import (
+	"testing"
+
+	"paqet/internal/tnet"
+)
+
+func TestPipe(t *testing.T) {
+	TestConn(t, func(t *testing.T) (tnet.Conn, tnet.Conn, func()) {
+		c1, c2 := Pipe()
+		return c1, c2, nil
+	})
+}
@@ -0,0 +1,290 @@
+// Package tnettest checks that a transport behaves the way the rest of
+// paqet expects from a tnet.Conn and tnet.Listener: streams deliver bytes
+// in order, many of them at once, honour read deadlines and report closes
+// with the errors defined in tnet. Transports run it from their own tests.
+package tnettest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"paqet/internal/tnet"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MakePipe connects a fresh pair of conns: c1 opens streams, c2 accepts
+// them. stop releases whatever else the transport set up, and may be nil.
+type MakePipe func(t *testing.T) (c1, c2 tnet.Conn, stop func())
+
+// TestConn runs the conformance checks for tnet.Conn and tnet.Strm against
+// the conns that mp returns.
+func TestConn(t *testing.T, mp MakePipe) {
+	for _, tc := range []struct {
+		name string
+		fn   func(*testing.T, tnet.Conn, tnet.Conn)
+	}{
+		{"Ordering", testOrdering},
+		{"Concurrency", testConcurrency},
+		{"ReadDeadline", testReadDeadline},
+		{"AcceptTimeout", testAcceptTimeout},
+		{"CloseStream", testCloseStream},
+		{"CloseConn", testCloseConn},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c1, c2, stop := mp(t)
+			t.Cleanup(func() {
+				c1.Close()
+				c2.Close()
+				if stop != nil {
+					stop()
+				}
+			})
+			tc.fn(t, c1, c2)
+		})
+	}
+}
+
+// TestListener checks that l hands out the conns that dial connects, and
+// that Accept fails with tnet.ErrConnClosed once l is closed.
+func TestListener(t *testing.T, l tnet.Listener, dial func(ctx context.Context) (tnet.Conn, error)) {
+	accepted := make(chan tnet.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+	c1, err := dial(context.Background())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c1.Close()
+	c2, ok := <-accepted
+	if !ok {
+		t.Fatal("Accept failed")
+	}
+	defer c2.Close()
+	testOrdering(t, c1, c2)
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, tnet.ErrConnClosed) {
+			t.Errorf("Accept on a closed listener: got %v, want tnet.ErrConnClosed", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Accept on a closed listener did not return")
+	}
+}
+
+// pair opens a stream on c1 and accepts it on c2. smux announces a stream
+// with its first frame, so a byte is sent ahead and consumed.
+func pair(t *testing.T, c1, c2 tnet.Conn) (tnet.Strm, tnet.Strm) {
+	t.Helper()
+	s1, err := c1.OpenStrm(context.Background())
+	if err != nil {
+		t.Fatalf("OpenStrm: %v", err)
+	}
+	if _, err := s1.Write([]byte{0}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	s2, err := c2.AcceptStrm()
+	if err != nil {
+		t.Fatalf("AcceptStrm: %v", err)
+	}
+	if _, err := io.ReadFull(s2, make([]byte, 1)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return s1, s2
+}
+
+// testOrdering sends numbered writes of varying size and checks that they
+// arrive whole and in order.
+func testOrdering(t *testing.T, c1, c2 tnet.Conn) {
+	s1, s2 := pair(t, c1, c2)
+	defer s1.Close()
+	defer s2.Close()
+
+	const writes = 500
+	errc := make(chan error, 1)
+	go func() {
+		for i := range writes {
+			b := make([]byte, 4+i*7%1500)
+			binary.BigEndian.PutUint32(b, uint32(i))
+			if _, err := s1.Write(b); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- nil
+	}()
+	for i := range writes {
+		b := make([]byte, 4+i*7%1500)
+		if _, err := io.ReadFull(s2, b); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if n := binary.BigEndian.Uint32(b); n != uint32(i) {
+			t.Fatalf("write %d arrived as number %d", i, n)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+// testConcurrency echoes data on many streams at once.
+func testConcurrency(t *testing.T, c1, c2 tnet.Conn) {
+	go func() {
+		for {
+			s, err := c2.AcceptStrm()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer s.Close()
+				_, _ = io.Copy(s, s)
+			}()
+		}
+	}()
+
+	const streams = 16
+	var wg sync.WaitGroup
+	errc := make(chan error, streams)
+	for range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := c1.OpenStrm(context.Background())
+			if err != nil {
+				errc <- err
+				return
+			}
+			defer s.Close()
+			msg := make([]byte, 64*1024)
+			_, _ = rand.Read(msg)
+			go func() { _, _ = s.Write(msg) }()
+			got := make([]byte, len(msg))
+			_ = s.SetReadDeadline(time.Now().Add(20 * time.Second))
+			if _, err := io.ReadFull(s, got); err != nil {
+				errc <- err
+				return
+			}
+			if !bytes.Equal(got, msg) {
+				errc <- errors.New("echo differs from what was sent")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+}
+
+// testReadDeadline checks that an expired read deadline fails with a
+// timeout, and that the stream works again once it is cleared.
+func testReadDeadline(t *testing.T, c1, c2 tnet.Conn) {
+	s1, s2 := pair(t, c1, c2)
+	defer s1.Close()
+	defer s2.Close()
+
+	_ = s2.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	start := time.Now()
+	_, err := s2.Read(make([]byte, 1))
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("Read past the deadline: got %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Read returned %s after a 50ms deadline", d)
+	}
+
+	_ = s2.SetReadDeadline(time.Time{})
+	if _, err := s1.Write([]byte("after")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got := make([]byte, 5)
+	if _, err := io.ReadFull(s2, got); err != nil || string(got) != "after" {
+		t.Fatalf("Read after clearing the deadline: %q, %v", got, err)
+	}
+}
+
+// testAcceptTimeout checks that a conn deadline ends AcceptStrm with
+// tnet.ErrAcceptTimeout and leaves the conn usable.
+func testAcceptTimeout(t *testing.T, c1, c2 tnet.Conn) {
+	_ = c2.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := c2.AcceptStrm()
+	if !errors.Is(err, tnet.ErrAcceptTimeout) {
+		t.Fatalf("AcceptStrm past the deadline: got %v, want tnet.ErrAcceptTimeout", err)
+	}
+	_ = c2.SetDeadline(time.Time{})
+	s1, s2 := pair(t, c1, c2)
+	s1.Close()
+	s2.Close()
+}
+
+// testCloseStream checks that data written before Close is delivered and
+// followed by io.EOF.
+func testCloseStream(t *testing.T, c1, c2 tnet.Conn) {
+	s1, s2 := pair(t, c1, c2)
+	defer s2.Close()
+	if _, err := s1.Write([]byte("last")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := s1.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	_ = s2.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got, err := io.ReadAll(s2)
+	if err != nil {
+		t.Fatalf("Read after the peer closed: %v, want io.EOF", err)
+	}
+	if string(got) != "last" {
+		t.Errorf("got %q, want %q", got, "last")
+	}
+}
+
+// testCloseConn checks that both ends report tnet.ErrConnClosed once one
+// end is closed. KCP sends nothing when a session closes, so its peer only
+// notices when the smux keepalive times out, which takes up to twice the
+// 8 second timeout.
+func testCloseConn(t *testing.T, c1, c2 tnet.Conn) {
+	s1, s2 := pair(t, c1, c2)
+	defer s1.Close()
+	defer s2.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c2.AcceptStrm()
+		errc <- err
+	}()
+	if err := c1.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := c1.OpenStrm(context.Background()); !errors.Is(err, tnet.ErrConnClosed) {
+		t.Errorf("OpenStrm on a closed conn: got %v, want tnet.ErrConnClosed", err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, tnet.ErrConnClosed) {
+			t.Errorf("AcceptStrm after the peer closed: got %v, want tnet.ErrConnClosed", err)
+		}
+	case <-time.After(20 * time.Second):
+		t.Error("AcceptStrm did not return after the peer closed")
+	}
+}
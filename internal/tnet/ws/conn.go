@@ -0,0 +1,102 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"paqet/internal/protocol"
+	"paqet/internal/tnet"
+	"time"
+
+	"github.com/xtaci/smux"
+	"golang.org/x/net/websocket"
+)
+
+type Conn struct {
+	WSConn  *websocket.Conn
+	Session *smux.Session
+
+	// The websocket package reports URLs as its addresses; keep the TCP
+	// endpoints so logs and the server's per-client state see real ones.
+	local, remote net.Addr
+}
+
+// OpenStrm checks ctx before opening: smux opens a stream without a round
+// trip, so only a congested session can hold it up, and that is bounded by
+// the session's own write timeout.
+func (c *Conn) OpenStrm(ctx context.Context) (tnet.Strm, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	strm, err := c.Session.OpenStream()
+	if err != nil {
+		return nil, c.sessErr(err)
+	}
+	return &Strm{Stream: strm, cid: tnet.NewCID()}, nil
+}
+
+func (c *Conn) AcceptStrm() (tnet.Strm, error) {
+	strm, err := c.Session.AcceptStream()
+	if errors.Is(err, smux.ErrTimeout) {
+		return nil, tnet.Wrap(tnet.ErrAcceptTimeout, err)
+	}
+	if err != nil {
+		return nil, c.sessErr(err)
+	}
+	return &Strm{Stream: strm, cid: tnet.NewCID()}, nil
+}
+
+func (c *Conn) Ping(wait bool) error {
+	strm, err := c.Session.OpenStream()
+	if err != nil {
+		return fmt.Errorf("ping failed: %w", c.sessErr(err))
+	}
+	defer strm.Close()
+	if wait {
+		p := protocol.Proto{Type: protocol.PPING}
+		err = p.Write(strm)
+		if err != nil {
+			return fmt.Errorf("strm ping write failed: %v", err)
+		}
+		err = p.Read(strm)
+		if err != nil {
+			return fmt.Errorf("strm ping read failed: %v", err)
+		}
+		if p.Type != protocol.PPONG {
+			return fmt.Errorf("strm pong failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// sessErr marks err as tnet.ErrConnClosed once the session is closed, or
+// its link has ended.
+func (c *Conn) sessErr(err error) error {
+	if c.Session.IsClosed() || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, io.EOF) {
+		return tnet.Wrap(tnet.ErrConnClosed, err)
+	}
+	return err
+}
+
+// NumStreams returns the number of open streams on the session.
+func (c *Conn) NumStreams() int {
+	return c.Session.NumStreams()
+}
+
+func (c *Conn) Close() error {
+	if c.Session != nil {
+		c.Session.Close()
+	}
+	if c.WSConn != nil {
+		c.WSConn.Close()
+	}
+	return nil
+}
+
+func (c *Conn) LocalAddr() net.Addr                { return c.local }
+func (c *Conn) RemoteAddr() net.Addr               { return c.remote }
+func (c *Conn) SetDeadline(t time.Time) error      { return c.Session.SetDeadline(t) }
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.WSConn.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.WSConn.SetWriteDeadline(t) }
@@ -0,0 +1,79 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/tnet"
+	"time"
+
+	"github.com/xtaci/smux"
+	"golang.org/x/net/websocket"
+)
+
+const handshakeTimeout = 10 * time.Second
+
+func Dial(ctx context.Context, addr *net.UDPAddr, cfg *conf.WebSocket) (tnet.Conn, error) {
+	d := net.Dialer{Timeout: handshakeTimeout}
+	tcpConn, err := d.DialContext(ctx, "tcp", addr.String())
+	if err != nil {
+		return nil, fmt.Errorf("connection attempt failed: %v", err)
+	}
+
+	host := cfg.Host
+	if host == "" {
+		host = addr.String()
+	}
+	scheme, origin := "ws", "http"
+	var conn net.Conn = tcpConn
+	if cfg.TLS {
+		serverName := cfg.ServerName
+		if serverName == "" {
+			serverName, _, err = net.SplitHostPort(host)
+			if err != nil {
+				serverName = host
+			}
+		}
+		tlsConn := tls.Client(tcpConn, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			NextProtos:         []string{"http/1.1"},
+		})
+		hctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		err = tlsConn.HandshakeContext(hctx)
+		cancel()
+		if err != nil {
+			_ = tcpConn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %v", err)
+		}
+		conn = tlsConn
+		scheme, origin = "wss", "https"
+	}
+
+	wsCfg, err := websocket.NewConfig(scheme+"://"+host+cfg.Path, origin+"://"+host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("invalid websocket url: %v", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	wsConn, err := websocket.NewClient(wsCfg, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %v", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	wsConn.PayloadType = websocket.BinaryFrame
+	flog.Debugf("WebSocket connection to %s%s established, creating smux session", host, cfg.Path)
+
+	sess, err := smux.Client(wsConn, smuxConf(cfg))
+	if err != nil {
+		_ = wsConn.Close()
+		return nil, fmt.Errorf("failed to create smux session: %w", err)
+	}
+
+	flog.Debugf("smux session created successfully")
+	return &Conn{WSConn: wsConn, Session: sess, local: tcpConn.LocalAddr(), remote: tcpConn.RemoteAddr()}, nil
+}
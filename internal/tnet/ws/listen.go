@@ -0,0 +1,163 @@
+package ws
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"paqet/internal/handoff"
+	"paqet/internal/tnet"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xtaci/smux"
+	"golang.org/x/net/websocket"
+)
+
+type Listener struct {
+	cfg      *conf.WebSocket
+	listener net.Listener
+	server   *http.Server
+	conns    chan *Conn
+	done     chan struct{}
+	once     sync.Once
+	draining atomic.Bool
+}
+
+// Listen serves WebSocket connections on addr, or on cfg.Bind when the
+// server sits behind a reverse proxy.
+func Listen(addr *net.UDPAddr, cfg *conf.WebSocket) (tnet.Listener, error) {
+	network, bind := cfg.BindNetwork()
+	if network == "" {
+		network, bind = "tcp", addr.String()
+	}
+	ln, err := handoff.Listen(network, bind)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		// The proxy usually runs as another user, so its group may connect.
+		// Nothing above the socket authenticates the connection: anyone who
+		// can open it reaches the server as a trusted proxy.
+		if err := os.Chmod(bind, 0o660); err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+	}
+	if cfg.RealIP == "proxy" {
+		ln = &proxyListener{Listener: ln, cfg: cfg}
+	}
+	if cfg.TLS {
+		tlsCfg, err := cfg.ServerTLSConfig()
+		if err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+		tlsCfg.NextProtos = []string{"http/1.1"}
+		ln = tls.NewListener(ln, tlsCfg)
+	}
+
+	l := &Listener{
+		cfg:      cfg,
+		listener: ln,
+		conns:    make(chan *Conn),
+		done:     make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, websocket.Server{
+		// Clients may sit behind a CDN that rewrites or drops Origin.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   l.handle,
+	})
+	l.server = &http.Server{Handler: mux}
+	go func() {
+		err := l.server.Serve(ln)
+		if l.draining.Load() {
+			return // the accepted connections keep running
+		}
+		if err != nil && err != http.ErrServerClosed {
+			flog.Errorf("WebSocket listener stopped: %v", err)
+		}
+		l.close()
+	}()
+	return l, nil
+}
+
+// handle runs for the lifetime of one WebSocket connection; the websocket
+// package closes the connection when it returns.
+func (l *Listener) handle(wsConn *websocket.Conn) {
+	wsConn.PayloadType = websocket.BinaryFrame
+	sess, err := smux.Server(wsConn, smuxConf(l.cfg))
+	if err != nil {
+		flog.Errorf("failed to create smux session for %s: %v", wsConn.Request().RemoteAddr, err)
+		return
+	}
+	defer sess.Close()
+
+	req := wsConn.Request()
+	conn := &Conn{WSConn: wsConn, Session: sess}
+	conn.local, _ = req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if remote, err := net.ResolveTCPAddr("tcp", req.RemoteAddr); err == nil {
+		conn.remote = remote
+	}
+	if cfg := l.cfg; cfg.RealIP == "x-forwarded-for" && trustedPeer(cfg, l.peer(conn)) {
+		if client := forwardedFor(cfg, req); client != nil {
+			conn.remote = client
+		}
+	}
+	if conn.remote == nil {
+		// Unix socket peers have no address of their own.
+		conn.remote = l.listener.Addr()
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		return
+	}
+	select {
+	case <-sess.CloseChan():
+	case <-l.done:
+	}
+}
+
+// peer is the address of the directly connected peer of conn, which for a
+// unix socket listener is the listener's own address.
+func (l *Listener) peer(conn *Conn) net.Addr {
+	if _, ok := l.listener.Addr().(*net.UnixAddr); ok {
+		return l.listener.Addr()
+	}
+	return conn.remote
+}
+
+func (l *Listener) Accept() (tnet.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, tnet.Wrap(tnet.ErrConnClosed, fmt.Errorf("websocket listener closed: %w", net.ErrClosed))
+	}
+}
+
+func (l *Listener) close() {
+	l.once.Do(func() { close(l.done) })
+}
+
+// Drain stops taking new connections while the accepted ones keep running
+// until Close.
+func (l *Listener) Drain() {
+	l.draining.Store(true)
+	_ = l.listener.Close()
+}
+
+func (l *Listener) Close() error {
+	l.close()
+	return l.server.Close()
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
@@ -0,0 +1,185 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout bounds how long a trusted peer may take to send its
+// PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+var proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// trustedPeer reports whether addr is a reverse proxy allowed to supply the
+// client address. Peers on a unix socket are always trusted.
+func trustedPeer(cfg *conf.WebSocket, addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		ip, ok := netip.AddrFromSlice(a.IP)
+		return ok && cfg.Trusted(ip)
+	}
+	return false
+}
+
+// proxyListener accepts connections that start with a PROXY protocol
+// header (v1 or v2) from trusted peers, as sent by nginx "proxy_protocol"
+// or HAProxy "send-proxy".
+type proxyListener struct {
+	net.Listener
+	cfg *conf.WebSocket
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !trustedPeer(l.cfg, c.RemoteAddr()) {
+		return c, nil
+	}
+	// The header is read lazily on the connection's own goroutine so a
+	// slow peer cannot hold up Accept.
+	return &proxyConn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.r)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			flog.Debugf("invalid PROXY header from %s: %v", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if c.init(); c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.init(); c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader consumes a PROXY protocol header from r and returns the
+// client address it carries. It returns a nil address when the header
+// carries none (LOCAL, UNKNOWN), and an error when there is no header.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	if sig, err := r.Peek(len(proxyV2Sig)); err == nil && bytes.Equal(sig, proxyV2Sig) {
+		return readProxyV2(r)
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading PROXY v1 header: %w", err)
+	}
+	if len(line) > 107 || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("malformed PROXY v1 header")
+	}
+	f := strings.Fields(string(line))
+	if len(f) < 2 || f[0] != "PROXY" {
+		return nil, fmt.Errorf("missing PROXY header")
+	}
+	if f[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(f) != 6 || (f[1] != "TCP4" && f[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header")
+	}
+	ip, err := netip.ParseAddr(f[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY source address: %w", err)
+	}
+	port, err := strconv.ParseUint(f[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY source port: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("reading PROXY v2 header: %w", err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY version %d", hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("reading PROXY v2 addresses: %w", err)
+	}
+	if hdr[12]&0x0f == 0 { // LOCAL: health check by the proxy itself
+		return nil, nil
+	}
+	switch hdr[13] >> 4 {
+	case 1: // AF_INET
+		if len(body) < 12 {
+			return nil, fmt.Errorf("short PROXY v2 IPv4 block")
+		}
+		ip := netip.AddrFrom4([4]byte(body[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(body[8:]))), nil
+	case 2: // AF_INET6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("short PROXY v2 IPv6 block")
+		}
+		ip := netip.AddrFrom16([16]byte(body[0:16]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(body[32:]))), nil
+	}
+	return nil, nil
+}
+
+// forwardedFor returns the client address from the X-Forwarded-For header
+// of req, skipping trusted proxies from the right so that a client cannot
+// spoof its address by sending the header itself.
+func forwardedFor(cfg *conf.WebSocket, req *http.Request) net.Addr {
+	var hops []string
+	for _, v := range req.Header.Values("X-Forwarded-For") {
+		for _, h := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(h))
+		}
+	}
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		client = ip
+		if !cfg.Trusted(ip) {
+			break
+		}
+	}
+	if !client.IsValid() {
+		return nil
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(client.Unmap(), 0))
+}
@@ -0,0 +1,76 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/netip"
+	"paqet/internal/conf"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyHeaderV1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 198.51.100.7 10.0.0.1 51234 443\r\nGET / HTTP/1.1\r\n"))
+	addr, err := readProxyHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != "198.51.100.7:51234" {
+		t.Errorf("got %v", addr)
+	}
+	if rest, _ := r.ReadString('\n'); rest != "GET / HTTP/1.1\r\n" {
+		t.Errorf("header not fully consumed, next line %q", rest)
+	}
+
+	if _, err := readProxyHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))); err == nil {
+		t.Error("accepted a connection without header")
+	}
+}
+
+func TestReadProxyHeaderV2(t *testing.T) {
+	var b bytes.Buffer
+	b.Write(proxyV2Sig)
+	b.Write([]byte{0x21, 0x21}) // PROXY, TCP over IPv6
+	b.Write(binary.BigEndian.AppendUint16(nil, 36))
+	src := [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 7}
+	b.Write(src[:])
+	b.Write(make([]byte, 16))
+	b.Write(binary.BigEndian.AppendUint16(nil, 40000))
+	b.Write(binary.BigEndian.AppendUint16(nil, 443))
+	b.WriteString("payload")
+
+	r := bufio.NewReader(&b)
+	addr, err := readProxyHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != "[2001:db8::7]:40000" {
+		t.Errorf("got %v", addr)
+	}
+	if rest, _ := r.ReadString(0); rest != "payload" {
+		t.Errorf("header not fully consumed, rest %q", rest)
+	}
+}
+
+func TestForwardedForSkipsTrustedHops(t *testing.T) {
+	cfg := &conf.WebSocket{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.0/8"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+	}}
+	for header, want := range map[string]string{
+		"203.0.113.9":                    "203.0.113.9:0",
+		"1.2.3.4, 203.0.113.9, 10.0.0.2": "203.0.113.9:0", // 1.2.3.4 was sent by the client
+		"10.0.0.3":                       "10.0.0.3:0",
+		"bogus, 203.0.113.9":             "203.0.113.9:0",
+	} {
+		req := &http.Request{Header: http.Header{"X-Forwarded-For": {header}}}
+		if got := forwardedFor(cfg, req); got == nil || got.String() != want {
+			t.Errorf("X-Forwarded-For %q: got %v, want %s", header, got, want)
+		}
+	}
+	if got := forwardedFor(cfg, &http.Request{Header: http.Header{}}); got != nil {
+		t.Errorf("no header: got %v", got)
+	}
+}
@@ -0,0 +1,18 @@
+package ws
+
+import (
+	"github.com/xtaci/smux"
+)
+
+type Strm struct {
+	*smux.Stream
+	cid string
+}
+
+func (s *Strm) SID() int {
+	return int(s.ID())
+}
+
+func (s *Strm) CID() string {
+	return s.cid
+}
@@ -0,0 +1,19 @@
+package ws
+
+import (
+	"paqet/internal/conf"
+	"time"
+
+	"github.com/xtaci/smux"
+)
+
+func smuxConf(cfg *conf.WebSocket) *smux.Config {
+	var sconf = smux.DefaultConfig()
+	sconf.Version = 2
+	sconf.KeepAliveInterval = 10 * time.Second
+	sconf.KeepAliveTimeout = 30 * time.Second
+	sconf.MaxFrameSize = 65535
+	sconf.MaxReceiveBuffer = cfg.Smuxbuf
+	sconf.MaxStreamBuffer = cfg.Streambuf
+	return sconf
+}
@@ -0,0 +1,103 @@
+package ws
+
+import (
+	"context"
+	"io"
+	"net"
+	"paqet/internal/conf"
+	"paqet/internal/tnet"
+	"paqet/internal/tnet/tnettest"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, useTLS := range []bool{false, true} {
+		cfg := &conf.WebSocket{
+			Path:               "/tunnel",
+			TLS:                useTLS,
+			InsecureSkipVerify: true,
+			Smuxbuf:            4 * 1024 * 1024,
+			Streambuf:          2 * 1024 * 1024,
+		}
+
+		l, err := Listen(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, cfg)
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		addr := l.Addr().(*net.TCPAddr)
+
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			strm, err := conn.AcceptStrm()
+			if err != nil {
+				return
+			}
+			_, _ = io.Copy(strm, strm)
+		}()
+
+		conn, err := Dial(context.Background(), &net.UDPAddr{IP: addr.IP, Port: addr.Port}, cfg)
+		if err != nil {
+			t.Fatalf("Dial (tls=%v): %v", useTLS, err)
+		}
+		strm, err := conn.OpenStrm(context.Background())
+		if err != nil {
+			t.Fatalf("OpenStrm: %v", err)
+		}
+		msg := []byte("hello over websocket")
+		if _, err := strm.Write(msg); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(strm, got); err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if string(got) != string(msg) {
+			t.Errorf("tls=%v: got %q, want %q", useTLS, got, msg)
+		}
+		if conn.RemoteAddr().String() != addr.String() {
+			t.Errorf("RemoteAddr = %v, want %v", conn.RemoteAddr(), addr)
+		}
+		conn.Close()
+		l.Close()
+	}
+}
+
+func testConf() *conf.WebSocket {
+	return &conf.WebSocket{Path: "/tunnel", Smuxbuf: 4 * 1024 * 1024, Streambuf: 2 * 1024 * 1024}
+}
+
+func TestConformance(t *testing.T) {
+	tnettest.TestConn(t, func(t *testing.T) (tnet.Conn, tnet.Conn, func()) {
+		l, err := Listen(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, testConf())
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		accepted := make(chan tnet.Conn, 1)
+		go func() {
+			c, err := l.Accept()
+			if err == nil {
+				accepted <- c
+			}
+		}()
+		addr := l.Addr().(*net.TCPAddr)
+		c1, err := Dial(context.Background(), &net.UDPAddr{IP: addr.IP, Port: addr.Port}, testConf())
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		return c1, <-accepted, func() { l.Close() }
+	})
+}
+
+func TestListenerConformance(t *testing.T) {
+	l, err := Listen(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, testConf())
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	tnettest.TestListener(t, l, func(ctx context.Context) (tnet.Conn, error) {
+		return Dial(ctx, &net.UDPAddr{IP: addr.IP, Port: addr.Port}, testConf())
+	})
+}
@@ -0,0 +1,65 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDevice opens the TUN device name with the given number of queues,
+// one file per queue. With offload, every packet has a virtio-net header in
+// front and TCP segmentation and checksum offload is enabled, so that the
+// kernel hands over and accepts TCP super-packets of up to 64KB.
+func openDevice(name string, queues int, offload bool) ([]io.ReadWriteCloser, error) {
+	flags := uint16(unix.IFF_TUN | unix.IFF_NO_PI)
+	if queues > 1 {
+		flags |= unix.IFF_MULTI_QUEUE
+	}
+	if offload {
+		flags |= unix.IFF_VNET_HDR
+	}
+	files := make([]io.ReadWriteCloser, 0, queues)
+	for range queues {
+		f, err := openQueue(name, flags, offload)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func openQueue(name string, flags uint16, offload bool) (io.ReadWriteCloser, error) {
+	fd, err := unix.Open("/dev/net/tun", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	ifr.SetUint16(flags)
+	if err := unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("TUNSETIFF: %w", err)
+	}
+	if offload {
+		if err := unix.IoctlSetInt(fd, unix.TUNSETOFFLOAD, unix.TUN_F_CSUM|unix.TUN_F_TSO4|unix.TUN_F_TSO6); err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("TUNSETOFFLOAD: %w", err)
+		}
+	}
+	// Non-blocking, so that the runtime poller serves the device and Close
+	// interrupts a pending Read.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "/dev/net/tun"), nil
+}
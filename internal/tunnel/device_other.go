@@ -0,0 +1,14 @@
+//go:build !linux
+
+package tunnel
+
+import (
+	"fmt"
+	"io"
+)
+
+// Virtio-net headers and multiqueue TUN devices are Linux-only; conf
+// rejects tun.offload and tun.queues elsewhere.
+func openDevice(string, int, bool) ([]io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("tun.offload and tun.queues are only supported on Linux")
+}
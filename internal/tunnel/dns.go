@@ -0,0 +1,105 @@
+package tunnel
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"paqet/internal/flog"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// darwinResolverDir holds per-domain resolver files honoured by macOS.
+const darwinResolverDir = "/etc/resolver"
+
+// resolverMarker identifies resolver files written by paqet so that
+// teardown never removes files owned by the user or other software.
+const resolverMarker = "# managed by paqet"
+
+// configureDNS installs split DNS for the TUN device. Only queries for the
+// configured domains are routed to the tunnel-side servers.
+func (t *TUN) configureDNS() error {
+	if !t.cfg.DNS.Enabled() {
+		return nil
+	}
+	switch runtime.GOOS {
+	case "linux":
+		return t.configureDNSLinux()
+	case "darwin":
+		return t.configureDNSDarwin()
+	default:
+		return fmt.Errorf("split DNS is not supported on %s", runtime.GOOS)
+	}
+}
+
+// configureDNSLinux configures per-link DNS through systemd-resolved, which
+// is also the backend NetworkManager uses on most distributions.
+func (t *TUN) configureDNSLinux() error {
+	if _, err := exec.LookPath("resolvectl"); err != nil {
+		return fmt.Errorf("split DNS requires systemd-resolved (resolvectl not found)")
+	}
+
+	if err := t.journal.record(journalEntry{Cmd: []string{"resolvectl", "revert", t.cfg.Name}, Active: true}); err != nil {
+		return fmt.Errorf("failed to journal DNS change: %v", err)
+	}
+
+	args := []string{"dns", t.cfg.Name}
+	for _, ip := range t.cfg.DNS.Servers {
+		args = append(args, ip.String())
+	}
+	cmd := exec.Command("resolvectl", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set link DNS servers: %v, output: %s", err, output)
+	}
+
+	// A "~" prefix makes the domain routing-only, so it is not added to the
+	// search list.
+	args = []string{"domain", t.cfg.Name}
+	for _, d := range t.cfg.DNS.Domains {
+		args = append(args, "~"+d)
+	}
+	cmd = exec.Command("resolvectl", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set link DNS domains: %v, output: %s", err, output)
+	}
+
+	// Keep the system resolver as the default route for all other names.
+	cmd = exec.Command("resolvectl", "default-route", t.cfg.Name, "false")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		flog.Debugf("failed to clear DNS default route on %s: %v, output: %s", t.cfg.Name, err, output)
+	}
+
+	flog.Infof("split DNS enabled on %s for %s", t.cfg.Name, strings.Join(t.cfg.DNS.Domains, ", "))
+	return nil
+}
+
+// configureDNSDarwin writes one /etc/resolver/<domain> file per domain.
+func (t *TUN) configureDNSDarwin() error {
+	if err := os.MkdirAll(darwinResolverDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", darwinResolverDir, err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(resolverMarker + " (" + t.cfg.Name + ")\n")
+	for _, ip := range t.cfg.DNS.Servers {
+		sb.WriteString("nameserver " + ip.String() + "\n")
+	}
+
+	for _, d := range t.cfg.DNS.Domains {
+		path := filepath.Join(darwinResolverDir, d)
+		if data, err := os.ReadFile(path); err == nil && !strings.HasPrefix(string(data), resolverMarker) {
+			flog.Warnf("resolver file %s exists and is not managed by paqet, leaving it untouched", path)
+			continue
+		}
+		if err := t.journal.record(journalEntry{Remove: path, Active: true, Guard: path, GuardPrefix: resolverMarker}); err != nil {
+			return fmt.Errorf("failed to journal DNS change: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write resolver file %s: %v", path, err)
+		}
+	}
+
+	flog.Infof("split DNS enabled on %s for %s", t.cfg.Name, strings.Join(t.cfg.DNS.Domains, ", "))
+	return nil
+}
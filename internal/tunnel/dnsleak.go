@@ -0,0 +1,120 @@
+package tunnel
+
+import (
+	"fmt"
+	"os/exec"
+	"paqet/internal/flog"
+	"strings"
+)
+
+// blockDNSLeaks rejects plaintext DNS leaving through any interface other
+// than the TUN device or loopback, so that applications with hard-coded
+// resolvers cannot bypass the tunnel. The rules live in a chain of their own
+// hooked into OUTPUT, and are journaled as part of Activate, so Deactivate
+// lifts them together with the routes.
+func (t *TUN) blockDNSLeaks() error {
+	if !t.cfg.DNS.BlockLeaks {
+		return nil
+	}
+	if err := t.installLeakChain("iptables"); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("ip6tables"); err != nil {
+		flog.Warnf("ip6tables not found, IPv6 DNS leaks are not blocked")
+	} else if err := t.installLeakChain("ip6tables"); err != nil {
+		return err
+	}
+	flog.Infof("DNS leak protection enabled: port 53 only allowed through %s", t.cfg.Name)
+	return nil
+}
+
+func (t *TUN) installLeakChain(bin string) error {
+	if _, err := exec.LookPath(bin); err != nil {
+		return fmt.Errorf("DNS leak protection requires %s: %v", bin, err)
+	}
+	chain := "paqet-dns-" + t.cfg.Name
+	// Every rule carries the chain name as its comment, which is how
+	// removeStaleRules recognizes what a crashed instance left behind.
+	tag := []string{"-m", "comment", "--comment", chain}
+
+	// The journal has been replayed by now and Deactivate unhooked the chain
+	// of this instance, so any hook into it is left over from an instance
+	// that died without a journal.
+	t.removeStaleRules(bin, "filter", "OUTPUT", chain)
+
+	// Rollback runs these in reverse: unhook, flush, then delete the chain.
+	for _, undo := range [][]string{
+		{bin, "-X", chain},
+		{bin, "-F", chain},
+		append(append([]string{bin, "-D", "OUTPUT"}, tag...), "-j", chain),
+	} {
+		if err := t.journal.record(journalEntry{Cmd: undo, Active: true}); err != nil {
+			return fmt.Errorf("failed to journal %s change: %v", bin, err)
+		}
+	}
+
+	// A chain left behind by a crash without a journal is reused.
+	if output, err := exec.Command(bin, "-N", chain).CombinedOutput(); err != nil {
+		flog.Debugf("%s chain %s not created (%v: %s), flushing existing one", bin, chain, err, output)
+		if output, err := exec.Command(bin, "-F", chain).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to create %s chain %s: %v, output: %s", bin, chain, err, output)
+		}
+	}
+	for _, rule := range [][]string{
+		{"-o", "lo", "-j", "RETURN"},
+		{"-o", t.cfg.Name, "-j", "RETURN"},
+		{"-p", "udp", "--dport", "53", "-j", "REJECT"},
+		{"-p", "tcp", "--dport", "53", "-j", "REJECT", "--reject-with", "tcp-reset"},
+	} {
+		args := append(append([]string{"-A", chain}, tag...), rule...)
+		if output, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to add %s rule to %s: %v, output: %s", bin, chain, err, output)
+		}
+	}
+	args := append(append([]string{"-I", "OUTPUT", "1"}, tag...), "-j", chain)
+	if output, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to hook %s chain %s into OUTPUT: %v, output: %s", bin, chain, err, output)
+	}
+	return nil
+}
+
+// removeStaleRules deletes the rules of the hook chain in table that jump
+// to tag or carry it as their comment. Without this, every crash that lost
+// its journal would leave one more rule behind.
+func (t *TUN) removeStaleRules(bin, table, hook, tag string) {
+	out, err := exec.Command(bin, "-t", table, "-S", hook).Output()
+	if err != nil {
+		flog.Debugf("failed to list %s %s rules: %v", bin, hook, err)
+		return
+	}
+	for _, rule := range staleRules(string(out), tag) {
+		args := append([]string{"-t", table, "-D"}, rule[1:]...)
+		if output, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+			flog.Warnf("failed to remove stale %s rule %q: %v, output: %s", bin, strings.Join(rule, " "), err, output)
+			continue
+		}
+		flog.Infof("removed stale %s rule left by a previous instance: %s", bin, strings.Join(rule, " "))
+	}
+}
+
+// staleRules picks the rules tagged with tag from the output of
+// "iptables -S", split into arguments.
+func staleRules(listing, tag string) [][]string {
+	var rules [][]string
+	for _, line := range strings.Split(listing, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 || f[0] != "-A" {
+			continue
+		}
+		for i := range f {
+			f[i] = strings.Trim(f[i], `"`)
+		}
+		for i := 0; i+1 < len(f); i++ {
+			if (f[i] == "-j" || f[i] == "--comment") && f[i+1] == tag {
+				rules = append(rules, f)
+				break
+			}
+		}
+	}
+	return rules
+}
@@ -0,0 +1,25 @@
+package tunnel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStaleRules(t *testing.T) {
+	listing := `-P OUTPUT ACCEPT
+-A OUTPUT -m comment --comment paqet-dns-tun0 -j paqet-dns-tun0
+-A OUTPUT -j paqet-dns-tun0
+-A OUTPUT -m comment --comment paqet-dns-tun1 -j paqet-dns-tun1
+-A OUTPUT -p tcp --dport 22 -j ACCEPT
+-A OUTPUT -m comment --comment "paqet-dns-tun0" -j paqet-dns-tun0
+`
+	got := staleRules(listing, "paqet-dns-tun0")
+	want := [][]string{
+		{"-A", "OUTPUT", "-m", "comment", "--comment", "paqet-dns-tun0", "-j", "paqet-dns-tun0"},
+		{"-A", "OUTPUT", "-j", "paqet-dns-tun0"}, // hooked before rules were tagged
+		{"-A", "OUTPUT", "-m", "comment", "--comment", "paqet-dns-tun0", "-j", "paqet-dns-tun0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
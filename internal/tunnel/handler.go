@@ -4,23 +4,33 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"paqet/internal/flog"
 	"paqet/internal/pkg/buffer"
 	"paqet/internal/tnet"
+	"sync"
+	"time"
 )
 
+// Client is the subset of the paqet client used by the tunnel handler
+type Client interface {
+	TUN(ctx context.Context) (tnet.Strm, error)
+	Prefix(ctx context.Context) (*net.IPNet, error)
+	Lease(ctx context.Context) (*Lease, error)
+}
+
 // Handler manages TUN tunnel connections
 type Handler struct {
 	tun    *TUN
-	client interface {
-		TUN() (tnet.Strm, error)
-	}
+	client Client
+
+	mu       sync.Mutex  // guards live and withdraw against the grace timer
+	live     bool        // the TUN streams are up
+	withdraw *time.Timer // pending Deactivate after tun.down_grace, nil if none
 }
 
 // NewHandler creates a new tunnel handler
-func NewHandler(tun *TUN, client interface {
-	TUN() (tnet.Strm, error)
-}) *Handler {
+func NewHandler(tun *TUN, client Client) *Handler {
 	return &Handler{
 		tun:    tun,
 		client: client,
@@ -31,43 +41,143 @@ func NewHandler(tun *TUN, client interface {
 func (h *Handler) Start(ctx context.Context) error {
 	flog.Infof("Starting TUN tunnel handler for %s", h.tun.Name())
 
-	// Create a TUN stream
-	strm, err := h.client.TUN()
-	if err != nil {
-		return fmt.Errorf("failed to create TUN stream: %v", err)
+	if h.tun.Sharded() {
+		go func() {
+			if err := h.tun.Shard(ctx); err != nil && ctx.Err() == nil {
+				flog.Errorf("TUN queue relay stopped: %v", err)
+			}
+		}()
+	}
+
+	for {
+		err := h.relay(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The stream ends when its transport connection is rotated or lost;
+		// open a new one on the current connection.
+		flog.Warnf("TUN stream ended (%v), reconnecting", err)
+		h.down()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
 	}
-	defer strm.Close()
+}
 
-	flog.Infof("TUN tunnel stream %d established", strm.SID())
+// up marks the tunnel as carrying traffic, cancels a pending withdrawal
+// and activates routes and split DNS.
+func (h *Handler) up() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.live = true
+	if h.withdraw != nil {
+		h.withdraw.Stop()
+		h.withdraw = nil
+	}
+	return h.tun.Activate()
+}
 
-	// Start bidirectional copy between TUN device and stream
-	errCh := make(chan error, 2)
+// down marks the tunnel as lost. Under tun.down_grace, routes and split
+// DNS are withdrawn if it is not back within the grace period, so that
+// traffic takes the host network instead of a dead tunnel.
+func (h *Handler) down() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.live = false
+	grace := h.tun.cfg.DownGrace
+	if grace <= 0 || h.withdraw != nil {
+		return
+	}
+	h.withdraw = time.AfterFunc(time.Duration(grace)*time.Second, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.withdraw = nil
+		if h.live {
+			return
+		}
+		flog.Warnf("TUN tunnel down for %ds, handing traffic back to the host network until it reconnects", grace)
+		h.tun.Deactivate()
+	})
+}
 
-	// TUN -> Stream (using large buffer pool)
-	go func() {
-		err := buffer.CopyTUN(ctx, strm, h.tun)
-		if err != nil && err != io.EOF && err != context.Canceled {
-			flog.Debugf("TUN to Stream copy error: %v", err)
+// relay copies packets between the TUN device and its streams, one per
+// queue, until any of them fails.
+func (h *Handler) relay(ctx context.Context) error {
+	// The lease is renewed on every reconnect, in case the server has
+	// restarted and handed the address to another client.
+	if h.tun.cfg.Auto {
+		lease, err := h.client.Lease(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to lease a tunnel address: %v", err)
 		}
-		errCh <- err
-	}()
-
-	// Stream -> TUN (using large buffer pool)
-	go func() {
-		err := buffer.CopyTUN(ctx, h.tun, strm)
-		if err != nil && err != io.EOF && err != context.Canceled {
-			flog.Debugf("Stream to TUN copy error: %v", err)
+		if err := h.tun.Assign(lease); err != nil {
+			return err
 		}
-		errCh <- err
-	}()
+	}
+	// So is the delegated prefix, which the server routes to the new
+	// connection, or replaces if it lost the lease. The tunnel comes up
+	// without one if delegation fails.
+	if h.tun.cfg.RequestPrefix {
+		prefix, err := h.client.Prefix(ctx)
+		if err != nil {
+			flog.Warnf("IPv6 prefix delegation failed: %v", err)
+		} else if err := h.tun.ApplyPrefix(prefix); err != nil {
+			flog.Warnf("failed to apply delegated prefix: %v", err)
+		}
+	}
+
+	queues := h.tun.Queues()
+	errCh := make(chan error, 2*queues)
+	for range queues {
+		strm, err := h.client.TUN(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create TUN stream: %v", err)
+		}
+		defer strm.Close()
+
+		flog.Infof("TUN tunnel stream %s established", strm.CID())
+
+		// Start bidirectional copy between TUN device and stream
+		peer, detach := h.tun.Peer(strm)
+		defer detach()
+
+		// TUN -> Stream (using large buffer pool); with several queues
+		// the device's Shard workers feed every stream instead
+		if queues == 1 {
+			go func() {
+				err := buffer.CopyTUN(ctx, peer, h.tun)
+				if err != nil && err != io.EOF && err != context.Canceled {
+					flog.Debugf("TUN to Stream copy error: %v", err)
+				}
+				errCh <- err
+			}()
+		}
+
+		// Stream -> TUN (using large buffer pool)
+		go func() {
+			err := buffer.CopyTUN(ctx, h.tun.NextQueue(), h.tun.Source(strm))
+			if err != nil && err != io.EOF && err != context.Canceled {
+				flog.Debugf("Stream to TUN copy error: %v", err)
+			}
+			errCh <- err
+		}()
+	}
+
+	// Routes and split DNS go in once the tunnel carries traffic, and stay
+	// across reconnects shorter than tun.down_grace
+	if err := h.up(); err != nil {
+		return fmt.Errorf("failed to install tun.routes and split DNS: %v", err)
+	}
 
 	// Wait for error or context cancellation
 	select {
 	case err := <-errCh:
-		if err != context.Canceled && err != io.EOF {
-			return fmt.Errorf("tunnel handler error: %v", err)
+		if err == nil {
+			err = io.EOF
 		}
-		return nil
+		return err
 	case <-ctx.Done():
 		return ctx.Err()
 	}
@@ -0,0 +1,183 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Direction is the way a packet travels on the TUN relay path.
+type Direction int
+
+const (
+	Outbound Direction = iota // read from the device, relayed to the peer
+	Inbound                   // relayed from the peer, written to the device
+)
+
+func (d Direction) String() string {
+	if d == Inbound {
+		return "inbound"
+	}
+	return "outbound"
+}
+
+// ParseDirection parses the String form of a Direction.
+func ParseDirection(s string) (Direction, error) {
+	switch s {
+	case "outbound":
+		return Outbound, nil
+	case "inbound":
+		return Inbound, nil
+	}
+	return 0, fmt.Errorf("direction must be inbound or outbound")
+}
+
+// MirrorFunc sees a packet on the relay path. The packet is only valid for
+// the duration of the call, and the call delays the relay, so it must copy
+// what it keeps and not block. With tun.offload, TCP packets may be
+// super-packets of up to 64KB that the kernel segments later.
+type MirrorFunc func(dir Direction, pkt []byte)
+
+// hooks are the mirrors and relay streams integrations use to take part in
+// the relay path without changes to it.
+type hooks struct {
+	mu       sync.RWMutex
+	mirrors  map[*MirrorFunc]struct{}
+	nmirrors atomic.Int32  // spares the relay the lock while nothing mirrors
+	peers    []*peerWriter // in attach order, which Shard hashes flows over
+}
+
+// Mirror calls fn with every packet relayed in either direction until the
+// returned function is called.
+func (t *TUN) Mirror(fn MirrorFunc) (remove func()) {
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	if t.hooks.mirrors == nil {
+		t.hooks.mirrors = make(map[*MirrorFunc]struct{})
+	}
+	key := &fn
+	t.hooks.mirrors[key] = struct{}{}
+	t.hooks.nmirrors.Add(1)
+	return func() {
+		t.hooks.mu.Lock()
+		defer t.hooks.mu.Unlock()
+		if _, ok := t.hooks.mirrors[key]; ok {
+			delete(t.hooks.mirrors, key)
+			t.hooks.nmirrors.Add(-1)
+		}
+	}
+}
+
+func (t *TUN) mirror(dir Direction, pkt []byte) {
+	if t.hooks.nmirrors.Load() == 0 {
+		return
+	}
+	t.hooks.mu.RLock()
+	defer t.hooks.mu.RUnlock()
+	for fn := range t.hooks.mirrors {
+		(*fn)(dir, pkt)
+	}
+}
+
+// Inject puts pkt, an IP packet, on the relay path as if it had travelled
+// in dir: inbound packets are written to the device, outbound ones to every
+// peer stream relaying the device, or to the one Shard would pick when it
+// relays the device. Mirrors see injected packets too.
+func (t *TUN) Inject(dir Direction, pkt []byte) error {
+	if err := checkPacket(pkt, t.cfg.MTU); err != nil {
+		return err
+	}
+	if t.cfg.Offload {
+		// A zeroed virtio-net header: no segmentation, checksums complete.
+		pkt = append(make([]byte, vnetHdrLen, vnetHdrLen+len(pkt)), pkt...)
+	}
+	if dir == Inbound {
+		_, err := t.Write(pkt)
+		return err
+	}
+
+	t.mirror(Outbound, t.packet(pkt))
+	t.hooks.mu.RLock()
+	defer t.hooks.mu.RUnlock()
+	if len(t.hooks.peers) == 0 {
+		return fmt.Errorf("no peer stream is relaying %s", t.cfg.Name)
+	}
+	if t.Sharded() {
+		pw := t.pick(t.packet(pkt))
+		if pw == nil {
+			return fmt.Errorf("no peer stream is relaying %s for the destination", t.cfg.Name)
+		}
+		_, err := pw.Write(pkt)
+		return err
+	}
+	for _, w := range t.hooks.peers {
+		if _, err := w.Write(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Peer registers strm as a stream that relays the device's outbound packets,
+// so that Inject can reach it. The relay must write to strm only through the
+// returned writer, which keeps injected packets from splitting its own, and
+// call detach once it stops. With tun.offload the writer frames every
+// packet, see Source for the other direction.
+func (t *TUN) Peer(strm io.Writer) (w io.Writer, detach func()) {
+	pw := &peerWriter{w: strm, framed: t.cfg.Offload}
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	t.hooks.peers = append(t.hooks.peers, pw)
+	return pw, func() {
+		t.hooks.mu.Lock()
+		defer t.hooks.mu.Unlock()
+		if i := slices.Index(t.hooks.peers, pw); i >= 0 {
+			t.hooks.peers = slices.Delete(t.hooks.peers, i, i+1)
+		}
+		if t.router != nil {
+			t.router.detach(pw)
+		}
+	}
+}
+
+type peerWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	framed bool
+	buf    []byte
+}
+
+func (p *peerWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.framed {
+		return p.w.Write(b)
+	}
+	p.buf = frame(p.buf, b)
+	if _, err := p.w.Write(p.buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// checkPacket rejects what is not an IPv4 or IPv6 packet of at most mtu bytes.
+func checkPacket(pkt []byte, mtu int) error {
+	if len(pkt) > mtu {
+		return fmt.Errorf("packet of %d bytes exceeds the TUN MTU %d", len(pkt), mtu)
+	}
+	minLen := 0
+	if len(pkt) > 0 {
+		switch pkt[0] >> 4 {
+		case 4:
+			minLen = 20
+		case 6:
+			minLen = 40
+		}
+	}
+	if minLen == 0 || len(pkt) < minLen {
+		return fmt.Errorf("not an IPv4 or IPv6 packet")
+	}
+	return nil
+}
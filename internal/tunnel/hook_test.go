@@ -0,0 +1,82 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"paqet/internal/conf"
+	"testing"
+)
+
+// fakeDevice hands out one queued packet per Read and records writes.
+type fakeDevice struct {
+	in      [][]byte
+	written [][]byte
+}
+
+func (d *fakeDevice) Read(b []byte) (int, error) {
+	if len(d.in) == 0 {
+		return 0, io.EOF
+	}
+	p := d.in[0]
+	d.in = d.in[1:]
+	return copy(b, p), nil
+}
+
+func (d *fakeDevice) Write(b []byte) (int, error) {
+	d.written = append(d.written, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (d *fakeDevice) Close() error { return nil }
+
+func ipv4Packet(n int) []byte {
+	p := make([]byte, n)
+	p[0] = 0x45
+	return p
+}
+
+func TestMirror(t *testing.T) {
+	out, in := ipv4Packet(40), ipv4Packet(60)
+	dev := &fakeDevice{in: [][]byte{out}}
+	tun := &TUN{iface: dev, cfg: &conf.TUN{Name: "tun0", MTU: 1500}}
+
+	var seen []Direction
+	remove := tun.Mirror(func(dir Direction, pkt []byte) {
+		seen = append(seen, dir)
+	})
+	buf := make([]byte, 1500)
+	tun.Read(buf)
+	tun.Write(in)
+	remove()
+	tun.Write(in)
+
+	if len(seen) != 2 || seen[0] != Outbound || seen[1] != Inbound {
+		t.Fatalf("mirror saw %v, want [outbound inbound]", seen)
+	}
+}
+
+func TestInject(t *testing.T) {
+	dev := &fakeDevice{}
+	tun := &TUN{iface: dev, cfg: &conf.TUN{Name: "tun0", MTU: 1500}}
+	pkt := ipv4Packet(28)
+
+	if err := tun.Inject(Inbound, pkt); err != nil || len(dev.written) != 1 {
+		t.Fatalf("inbound inject: %v, %d packets written", err, len(dev.written))
+	}
+	if err := tun.Inject(Outbound, pkt); err == nil {
+		t.Fatal("outbound inject succeeded without a peer stream")
+	}
+
+	var strm bytes.Buffer
+	_, detach := tun.Peer(&strm)
+	if err := tun.Inject(Outbound, pkt); err != nil || !bytes.Equal(strm.Bytes(), pkt) {
+		t.Fatalf("outbound inject: %v, stream got %d bytes", err, strm.Len())
+	}
+	detach()
+
+	for _, bad := range [][]byte{nil, {0x45, 0}, ipv4Packet(1501), make([]byte, 40)} {
+		if err := tun.Inject(Inbound, bad); err == nil {
+			t.Errorf("%d-byte invalid packet injected", len(bad))
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"paqet/internal/flog"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// journalEntry is a single undo step. Exactly one of Cmd, Remove and
+// Snapshot is set.
+type journalEntry struct {
+	Cmd      []string  `json:"cmd,omitempty"`      // command that reverts a change
+	Remove   string    `json:"remove,omitempty"`   // file created by paqet
+	Snapshot *snapshot `json:"snapshot,omitempty"` // host state before setup
+
+	Active bool `json:"active,omitempty"` // part of Activate, undone by Deactivate too
+
+	// Guard, if set, is a file that must still start with GuardPrefix for
+	// the undo to run, so a change someone else made since is left alone.
+	Guard       string `json:"guard,omitempty"`
+	GuardPrefix string `json:"guard_prefix,omitempty"`
+}
+
+// snapshot captures the default routes, which the tunnel must never leave
+// missing.
+type snapshot struct {
+	DefaultRoutes []string `json:"default_routes,omitempty"`
+}
+
+// journal is a persisted undo log of every host change made for a TUN
+// device. It is rewritten on each record so that a killed process can be
+// rolled back by the next start.
+type journal struct {
+	path    string
+	entries []journalEntry
+	mu      sync.Mutex
+}
+
+func newJournal(path string) *journal {
+	return &journal{path: path}
+}
+
+// Journal is an undo log for host changes made outside a TUN device, such
+// as the pacing qdisc. Like a device's own journal it is persisted on every
+// record and rolled back by the next start if the process is killed.
+type Journal struct {
+	j *journal
+}
+
+// OpenJournal rolls back what a previous process left in the journal at
+// path and returns it empty.
+func OpenJournal(path string) *Journal {
+	j := newJournal(path)
+	if err := j.recover(); err != nil {
+		flog.Warnf("failed to recover journal %s: %v", path, err)
+	}
+	return &Journal{j: j}
+}
+
+// Record persists the command that reverts a change, before the change.
+func (j *Journal) Record(undo ...string) error {
+	return j.j.record(journalEntry{Cmd: undo})
+}
+
+// Rollback runs the recorded commands in reverse and removes the journal.
+func (j *Journal) Rollback() {
+	j.j.rollback()
+}
+
+// recover rolls back a journal left behind by an unclean shutdown.
+func (j *journal) recover() error {
+	data, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &j.entries); err != nil {
+		flog.Warnf("discarding unreadable journal %s: %v", j.path, err)
+		j.entries = nil
+		return os.Remove(j.path)
+	}
+	flog.Warnf("found journal %s from an unclean shutdown, restoring host state", j.path)
+	j.rollback()
+	return nil
+}
+
+// snapshot records the current default routes.
+func (j *journal) snapshot() error {
+	return j.record(journalEntry{Snapshot: &snapshot{DefaultRoutes: defaultRoutes()}})
+}
+
+// record persists e before the change it reverts is applied.
+func (j *journal) record(e journalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, e)
+	return j.flush()
+}
+
+func (j *journal) flush() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(j.entries)
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// rollback undoes all recorded changes in reverse order, then restores the
+// snapshot and removes the journal file.
+func (j *journal) rollback() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var snap *snapshot
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		e := j.entries[i]
+		if e.Snapshot != nil {
+			snap = e.Snapshot
+			continue
+		}
+		e.undo()
+	}
+	if snap != nil {
+		snap.restore()
+	}
+
+	j.entries = nil
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		flog.Warnf("failed to remove journal %s: %v", j.path, err)
+	}
+}
+
+// withdraw undoes the changes recorded as Active in reverse order and
+// drops them from the journal, leaving the others in place.
+func (j *journal) withdraw() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// Nothing to do after rollback, which must leave no journal file behind
+	if !slices.ContainsFunc(j.entries, func(e journalEntry) bool { return e.Active }) {
+		return
+	}
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if j.entries[i].Active {
+			j.entries[i].undo()
+		}
+	}
+	j.entries = slices.DeleteFunc(j.entries, func(e journalEntry) bool { return e.Active })
+	if err := j.flush(); err != nil {
+		flog.Warnf("failed to persist TUN journal %s: %v", j.path, err)
+	}
+}
+
+// undo reverts the change e records, other than a snapshot.
+func (e journalEntry) undo() {
+	if e.Guard != "" {
+		data, err := os.ReadFile(e.Guard)
+		if err != nil || !strings.HasPrefix(string(data), e.GuardPrefix) {
+			flog.Debugf("leaving %s alone, it changed since paqet wrote it", e.Guard)
+			return
+		}
+	}
+	switch {
+	case len(e.Cmd) > 0:
+		if output, err := exec.Command(e.Cmd[0], e.Cmd[1:]...).CombinedOutput(); err != nil {
+			flog.Debugf("undo %s: %v, output: %s", strings.Join(e.Cmd, " "), err, output)
+		}
+	case e.Remove != "":
+		if err := os.Remove(e.Remove); err != nil && !os.IsNotExist(err) {
+			flog.Warnf("failed to remove %s: %v", e.Remove, err)
+		}
+	}
+}
+
+// restore adds back the default routes of each address family that has
+// none left. A family with any default route, such as one a DHCP renewal
+// or a roam installed since the snapshot, is left alone.
+func (s *snapshot) restore() {
+	current := defaultRoutes()
+	for _, r := range s.DefaultRoutes {
+		family := routeFamily(r)
+		if slices.ContainsFunc(current, func(c string) bool { return routeFamily(c) == family }) {
+			continue
+		}
+		flog.Infof("restoring default route: %s", r)
+		if err := addDefaultRoute(r); err != nil {
+			flog.Errorf("failed to restore default route %q: %v", r, err)
+		}
+	}
+}
+
+// defaultRoutes returns the current default routes, one per line, in a form
+// that addDefaultRoute accepts.
+func defaultRoutes() []string {
+	var routes []string
+	switch runtime.GOOS {
+	case "linux":
+		for _, family := range []string{"-4", "-6"} {
+			out, err := exec.Command("ip", family, "route", "show", "default").Output()
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					routes = append(routes, family+" "+line)
+				}
+			}
+		}
+	case "darwin":
+		out, err := exec.Command("route", "-n", "get", "default").Output()
+		if err != nil {
+			return nil
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if gw, ok := strings.CutPrefix(strings.TrimSpace(line), "gateway:"); ok {
+				routes = append(routes, strings.TrimSpace(gw))
+			}
+		}
+	}
+	return routes
+}
+
+// routeFamily returns the address family of a route from defaultRoutes, or
+// "" where the routes are not split by family.
+func routeFamily(r string) string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	family, _, _ := strings.Cut(r, " ")
+	return family
+}
+
+func addDefaultRoute(r string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		fields := strings.Fields(r)
+		if len(fields) < 2 {
+			return fmt.Errorf("malformed route")
+		}
+		// Drop state flags that "ip route show" prints but "add" rejects.
+		args := []string{fields[0], "route", "add"}
+		for _, f := range fields[1:] {
+			if !slices.Contains([]string{"linkdown", "dead", "offload", "trap"}, f) {
+				args = append(args, f)
+			}
+		}
+		cmd = exec.Command("ip", args...)
+	case "darwin":
+		cmd = exec.Command("route", "-n", "add", "default", r)
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v, output: %s", err, output)
+	}
+	return nil
+}
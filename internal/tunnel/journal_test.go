@@ -0,0 +1,101 @@
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalPersistAndRecover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tun0.journal")
+	created := filepath.Join(dir, "resolver-file")
+	if err := os.WriteFile(created, []byte("nameserver 10.0.8.2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	j := newJournal(path)
+	if err := j.record(journalEntry{Remove: created}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("journal not persisted: %v", err)
+	}
+
+	// Simulate a restart after a crash: a fresh journal replays the file.
+	if err := newJournal(path).recover(); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Error("expected recorded file to be removed on recovery")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected journal to be removed after recovery")
+	}
+}
+
+func TestJournalRecoverMissing(t *testing.T) {
+	j := newJournal(filepath.Join(t.TempDir(), "none.journal"))
+	if err := j.recover(); err != nil {
+		t.Errorf("recover with no journal: %v", err)
+	}
+}
+
+func TestJournalWithdraw(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept")
+	active := filepath.Join(dir, "active")
+	for _, f := range []string{kept, active} {
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j := newJournal(filepath.Join(dir, "tun0.journal"))
+	if err := j.record(journalEntry{Remove: kept}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if err := j.record(journalEntry{Remove: active, Active: true}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	j.withdraw()
+	if _, err := os.Stat(active); !os.IsNotExist(err) {
+		t.Error("expected the active entry to be undone")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("expected the other entry to stay: %v", err)
+	}
+	if len(j.entries) != 1 || j.entries[0].Remove != kept {
+		t.Errorf("entries after withdraw = %+v, want only the kept file", j.entries)
+	}
+}
+
+func TestJournalGuard(t *testing.T) {
+	dir := t.TempDir()
+	ours := filepath.Join(dir, "ours")
+	theirs := filepath.Join(dir, "theirs")
+	for _, f := range []string{ours, theirs} {
+		if err := os.WriteFile(f, []byte("# managed by paqet\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j := newJournal(filepath.Join(dir, "tun0.journal"))
+	for _, f := range []string{ours, theirs} {
+		if err := j.record(journalEntry{Remove: f, Guard: f, GuardPrefix: "# managed by paqet"}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	// Someone else rewrote the file since it was recorded.
+	if err := os.WriteFile(theirs, []byte("nameserver 192.0.2.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	j.rollback()
+	if _, err := os.Stat(ours); !os.IsNotExist(err) {
+		t.Error("expected the unchanged file to be removed")
+	}
+	if _, err := os.Stat(theirs); err != nil {
+		t.Errorf("expected the rewritten file to stay: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"paqet/internal/flog"
+	"runtime"
+)
+
+// Lease is the tunnel configuration a server assigns from tun.pool to a
+// client with tun.addr "auto".
+type Lease struct {
+	Addr   string // the client's address in CIDR notation
+	MTU    int    // 0 keeps tun.mtu
+	Routes []*net.IPNet
+}
+
+// Assign configures the device with l. The first lease brings the device
+// up; a later one with another address replaces the old address, and
+// routes that already exist are left alone.
+func (t *TUN) Assign(l *Lease) error {
+	ip, ipNet, err := net.ParseCIDR(l.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid leased address %q: %v", l.Addr, err)
+	}
+	if l.MTU != 0 && (l.MTU < 68 || l.MTU > 65535) {
+		return fmt.Errorf("invalid leased MTU %d", l.MTU)
+	}
+
+	t.leaseMu.Lock()
+	defer t.leaseMu.Unlock()
+	if l.Addr != t.cfg.Addr || (l.MTU != 0 && l.MTU != t.cfg.MTU) {
+		if t.cfg.IP != nil && runtime.GOOS == "linux" {
+			if output, err := exec.Command("ip", "addr", "del", t.cfg.Addr, "dev", t.cfg.Name).CombinedOutput(); err != nil {
+				flog.Debugf("failed to remove address %s from %s: %v, output: %s", t.cfg.Addr, t.cfg.Name, err, output)
+			}
+		}
+		t.cfg.Addr, t.cfg.IP, t.cfg.Net = l.Addr, ip, ipNet
+		if l.MTU != 0 {
+			t.cfg.MTU = l.MTU
+		}
+		if err := t.configure(); err != nil {
+			return err
+		}
+		flog.Infof("TUN device %s leased address %s (mtu %d)", t.cfg.Name, t.cfg.Addr, t.cfg.MTU)
+	}
+	for _, r := range l.Routes {
+		if err := t.AddRoute(r); err != nil {
+			// The route survives from the previous lease.
+			flog.Debugf("pushed route %s: %v", r, err)
+		}
+	}
+	return nil
+}
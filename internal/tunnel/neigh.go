@@ -0,0 +1,156 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"paqet/internal/flog"
+	"sync"
+)
+
+// neighProxy answers ARP and neighbor solicitations on the LAN interface
+// named by tun.proxy_arp for the overlay addresses routed into the device,
+// so that hosts on a bridged LAN reach clients without static neighbor
+// entries. IPv4 is left to the kernel's proxy_arp, which answers for every
+// address routed through another interface; IPv6 proxy_ndp answers only for
+// listed addresses, so the worker keeps a proxy entry for each address the
+// router learns.
+type neighProxy struct {
+	t   *TUN
+	dev string
+
+	mu   sync.Mutex
+	want map[netip.Addr]bool
+
+	have      map[netip.Addr]bool // owned by run
+	journaled map[netip.Addr]bool // owned by run
+	wake      chan struct{}
+	done      chan struct{}
+}
+
+// enableProxyNeigh turns on forwarding and proxy ARP/NDP on tun.proxy_arp
+// for the families the tunnel carries, journaling every change.
+func (t *TUN) enableProxyNeigh() error {
+	dev := t.cfg.ProxyARP
+	if dev == "" {
+		return nil
+	}
+	v6 := t.cfg.Net.IP.To4() == nil || t.cfg.Net6 != nil || t.cfg.PrefixPool != nil
+	var keys []string
+	if t.cfg.Net.IP.To4() != nil {
+		keys = append(keys, "net.ipv4.ip_forward", "net.ipv4.conf."+dev+".proxy_arp")
+	}
+	if v6 {
+		keys = append(keys, "net.ipv6.conf.all.forwarding", "net.ipv6.conf."+dev+".proxy_ndp")
+	}
+	for _, key := range keys {
+		if err := t.enableSysctl(key); err != nil {
+			return err
+		}
+	}
+	if !v6 {
+		flog.Infof("proxy ARP enabled on %s for addresses routed through %s", dev, t.cfg.Name)
+		return nil
+	}
+
+	n := &neighProxy{
+		t:         t,
+		dev:       dev,
+		want:      make(map[netip.Addr]bool),
+		have:      make(map[netip.Addr]bool),
+		journaled: make(map[netip.Addr]bool),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	t.neigh = n
+	if t.router != nil {
+		t.router.neigh = n
+	}
+	for _, ip := range []net.IP{t.cfg.IP, t.cfg.IP6} {
+		if self, ok := netip.AddrFromSlice(ip); ok {
+			n.set(self.Unmap(), true)
+		}
+	}
+	go n.run()
+	flog.Infof("proxy ARP/NDP enabled on %s for addresses routed through %s", dev, t.cfg.Name)
+	return nil
+}
+
+// set asks for a proxy entry for addr, or for its removal. Only IPv6
+// addresses need one.
+func (n *neighProxy) set(addr netip.Addr, on bool) {
+	if !addr.Is6() {
+		return
+	}
+	n.mu.Lock()
+	if on {
+		n.want[addr] = true
+	} else {
+		delete(n.want, addr)
+	}
+	n.mu.Unlock()
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (n *neighProxy) close() {
+	close(n.done)
+}
+
+// run brings the kernel's proxy entries in line with the wanted ones each
+// time they change, so that the packet path never waits for ip(8). The
+// entries left at exit are removed by the journal rollback.
+func (n *neighProxy) run() {
+	for {
+		select {
+		case <-n.wake:
+		case <-n.done:
+			return
+		}
+		n.mu.Lock()
+		var add, del []netip.Addr
+		for a := range n.want {
+			if !n.have[a] {
+				add = append(add, a)
+			}
+		}
+		for a := range n.have {
+			if !n.want[a] {
+				del = append(del, a)
+			}
+		}
+		n.mu.Unlock()
+
+		for _, a := range add {
+			if err := n.add(a); err != nil {
+				flog.Warnf("%v", err)
+				continue
+			}
+			n.have[a] = true
+		}
+		for _, a := range del {
+			if output, err := exec.Command("ip", "-6", "neigh", "del", "proxy", a.String(), "dev", n.dev).CombinedOutput(); err != nil {
+				flog.Debugf("failed to remove NDP proxy entry for %s: %v, output: %s", a, err, output)
+			}
+			delete(n.have, a)
+		}
+	}
+}
+
+func (n *neighProxy) add(a netip.Addr) error {
+	if !n.journaled[a] {
+		undo := []string{"ip", "-6", "neigh", "del", "proxy", a.String(), "dev", n.dev}
+		if err := n.t.journal.record(journalEntry{Cmd: undo}); err != nil {
+			return fmt.Errorf("failed to journal NDP proxy entry for %s: %v", a, err)
+		}
+		n.journaled[a] = true
+	}
+	if output, err := exec.Command("ip", "-6", "neigh", "replace", "proxy", a.String(), "dev", n.dev).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add NDP proxy entry for %s on %s: %v, output: %s", a, n.dev, err, output)
+	}
+	flog.Debugf("answering neighbor solicitations for %s on %s", a, n.dev)
+	return nil
+}
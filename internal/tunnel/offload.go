@@ -0,0 +1,61 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// vnetHdrLen is the size of the virtio-net header in front of every packet
+// on a device opened with tun.offload. It carries the segmentation and
+// checksum state of the packet behind it, which is passed to the peer as
+// is: a super-packet read from one kernel is written to the other whole,
+// and only the receiving kernel splits it, if it has to at all.
+const vnetHdrLen = 10
+
+// Packets on an offload stream are framed with a 4-byte length, since a
+// super-packet is far larger than one read from the stream may return.
+const frameHdrLen = 4
+
+// Source returns the reader the relay copies a peer's packets to the device
+// from: r itself, or with tun.offload a reader that returns one frame, a
+// virtio-net header and its packet, per Read.
+func (t *TUN) Source(r io.Reader) io.Reader {
+	if !t.cfg.Offload {
+		return r
+	}
+	return &frameReader{r: r}
+}
+
+type frameReader struct {
+	r   io.Reader
+	hdr [frameHdrLen]byte
+}
+
+func (f *frameReader) Read(b []byte) (int, error) {
+	if _, err := io.ReadFull(f.r, f.hdr[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint32(f.hdr[:]))
+	if n > len(b) || n <= vnetHdrLen {
+		return 0, fmt.Errorf("invalid TUN frame of %d bytes", n)
+	}
+	return io.ReadFull(f.r, b[:n])
+}
+
+// frame returns b behind its length, reusing buf.
+func frame(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf[:0], uint32(len(b)))
+	return append(buf, b...)
+}
+
+// packet returns the IP packet in b, a read from or write to the device.
+func (t *TUN) packet(b []byte) []byte {
+	if !t.cfg.Offload {
+		return b
+	}
+	if len(b) < vnetHdrLen {
+		return nil
+	}
+	return b[vnetHdrLen:]
+}
@@ -0,0 +1,49 @@
+package tunnel
+
+import (
+	"bytes"
+	"paqet/internal/conf"
+	"testing"
+)
+
+func TestOffload(t *testing.T) {
+	// A super-packet read from the device, behind its virtio-net header.
+	super := append(make([]byte, vnetHdrLen), ipv4Packet(60000)...)
+	super[0] = 1 // VIRTIO_NET_HDR_F_NEEDS_CSUM
+	dev := &fakeDevice{in: [][]byte{super}}
+	tun := &TUN{iface: dev, cfg: &conf.TUN{Name: "tun0", MTU: 1500, Offload: true}}
+
+	var mirrored []int
+	tun.Mirror(func(dir Direction, pkt []byte) {
+		mirrored = append(mirrored, len(pkt))
+	})
+
+	var strm bytes.Buffer
+	peer, detach := tun.Peer(&strm)
+	defer detach()
+	buf := make([]byte, 128*1024)
+	n, _ := tun.Read(buf)
+	peer.Write(buf[:n])
+	if err := tun.Inject(Outbound, ipv4Packet(28)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other end gets both packets whole, headers included.
+	src := tun.Source(&strm)
+	for _, want := range [][]byte{super, append(make([]byte, vnetHdrLen), ipv4Packet(28)...)} {
+		n, err := src.Read(buf)
+		if err != nil || !bytes.Equal(buf[:n], want) {
+			t.Fatalf("read %d-byte frame (%v), want %d bytes", n, err, len(want))
+		}
+	}
+	if len(mirrored) != 2 || mirrored[0] != 60000 || mirrored[1] != 28 {
+		t.Errorf("mirror saw packets of %v bytes, want [60000 28] without headers", mirrored)
+	}
+
+	// A frame larger than the relay buffer is refused, not split.
+	strm.Reset()
+	peer.Write(super)
+	if _, err := src.Read(make([]byte, 1500)); err == nil {
+		t.Error("oversized frame read into a short buffer")
+	}
+}
@@ -0,0 +1,138 @@
+package tunnel
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+)
+
+// SubnetPool hands out fixed-size subnets carved from a larger prefix, e.g.
+// /64s from a /48. Leases are keyed by an owner string and are sticky: the
+// same owner gets the same subnet back until it is released.
+type SubnetPool struct {
+	base   *net.IPNet
+	bits   int      // prefix length of each leased subnet
+	size   *big.Int // number of subnets in base
+	next   *big.Int
+	free   []*big.Int
+	leases map[string]*big.Int // owner -> subnet index
+	taken  map[string]string   // subnet index -> owner
+	mu     sync.Mutex
+}
+
+// NewSubnetPool returns a pool of /bits subnets inside base.
+func NewSubnetPool(base *net.IPNet, bits int) (*SubnetPool, error) {
+	ones, total := base.Mask.Size()
+	if bits < ones || bits > total {
+		return nil, fmt.Errorf("cannot carve /%d subnets from %s", bits, base)
+	}
+	return &SubnetPool{
+		base:   base,
+		bits:   bits,
+		size:   new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)),
+		next:   new(big.Int),
+		leases: make(map[string]*big.Int),
+		taken:  make(map[string]string),
+	}, nil
+}
+
+// Acquire returns the subnet leased to owner, allocating one if needed.
+func (p *SubnetPool) Acquire(owner string) (*net.IPNet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if idx, ok := p.leases[owner]; ok {
+		return p.subnet(idx), nil
+	}
+
+	var idx *big.Int
+	for len(p.free) > 0 && idx == nil {
+		n := len(p.free)
+		if _, taken := p.taken[p.free[n-1].String()]; !taken {
+			idx = p.free[n-1]
+		}
+		p.free = p.free[:n-1]
+	}
+	for idx == nil && p.next.Cmp(p.size) < 0 {
+		if _, taken := p.taken[p.next.String()]; !taken {
+			idx = new(big.Int).Set(p.next)
+		}
+		p.next.Add(p.next, big.NewInt(1))
+	}
+	if idx == nil {
+		return nil, fmt.Errorf("subnet pool %s exhausted", p.base)
+	}
+	p.leases[owner] = idx
+	p.taken[idx.String()] = owner
+	return p.subnet(idx), nil
+}
+
+// Restore records that subnet is leased to owner, e.g. from state
+// replicated by a peer server.
+func (p *SubnetPool) Restore(owner string, subnet *net.IPNet) error {
+	ones, _ := subnet.Mask.Size()
+	if ones != p.bits || !p.base.Contains(subnet.IP) {
+		return fmt.Errorf("subnet %s does not belong to pool %s", subnet, p.base)
+	}
+	_, total := p.base.Mask.Size()
+	idx := new(big.Int).SetBytes(subnet.IP.To16())
+	if p.base.IP.To4() != nil {
+		idx.SetBytes(subnet.IP.To4())
+	}
+	idx.Sub(idx, new(big.Int).SetBytes(p.base.IP))
+	idx.Rsh(idx, uint(total-p.bits))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cur, ok := p.taken[idx.String()]; ok && cur != owner {
+		return fmt.Errorf("subnet %s already leased to %s", subnet, cur)
+	}
+	if old, ok := p.leases[owner]; ok {
+		delete(p.taken, old.String())
+		p.free = append(p.free, old)
+	}
+	p.leases[owner] = idx
+	p.taken[idx.String()] = owner
+	return nil
+}
+
+// Release returns owner's subnet to the pool. It returns the released
+// subnet, or nil if owner held no lease.
+func (p *SubnetPool) Release(owner string) *net.IPNet {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idx, ok := p.leases[owner]
+	if !ok {
+		return nil
+	}
+	delete(p.leases, owner)
+	delete(p.taken, idx.String())
+	p.free = append(p.free, idx)
+	return p.subnet(idx)
+}
+
+// Leases returns a copy of all current leases keyed by owner.
+func (p *SubnetPool) Leases() map[string]*net.IPNet {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make(map[string]*net.IPNet, len(p.leases))
+	for owner, idx := range p.leases {
+		out[owner] = p.subnet(idx)
+	}
+	return out
+}
+
+func (p *SubnetPool) subnet(idx *big.Int) *net.IPNet {
+	_, total := p.base.Mask.Size()
+	off := new(big.Int).Lsh(idx, uint(total-p.bits))
+	ip := new(big.Int).SetBytes(p.base.IP)
+	ip.Add(ip, off)
+
+	b := ip.Bytes()
+	out := make(net.IP, len(p.base.IP))
+	copy(out[len(out)-len(b):], b)
+	return &net.IPNet{IP: out, Mask: net.CIDRMask(p.bits, total)}
+}
@@ -0,0 +1,66 @@
+package tunnel
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSubnetPoolAcquireRelease(t *testing.T) {
+	_, base, _ := net.ParseCIDR("2001:db8:100::/62")
+	p, err := NewSubnetPool(base, 64)
+	if err != nil {
+		t.Fatalf("NewSubnetPool: %v", err)
+	}
+
+	a, err := p.Acquire("a")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if a.String() != "2001:db8:100::/64" {
+		t.Errorf("first lease = %s, want 2001:db8:100::/64", a)
+	}
+	b, _ := p.Acquire("b")
+	if b.String() != "2001:db8:100:1::/64" {
+		t.Errorf("second lease = %s, want 2001:db8:100:1::/64", b)
+	}
+	if again, _ := p.Acquire("a"); again.String() != a.String() {
+		t.Errorf("lease for same owner changed: %s != %s", again, a)
+	}
+
+	p.Acquire("c")
+	p.Acquire("d")
+	if _, err := p.Acquire("e"); err == nil {
+		t.Error("expected exhaustion error")
+	}
+
+	if r := p.Release("b"); r == nil || r.String() != b.String() {
+		t.Errorf("Release returned %v, want %s", r, b)
+	}
+	if e, err := p.Acquire("e"); err != nil || e.String() != b.String() {
+		t.Errorf("expected released subnet to be reused, got %v, %v", e, err)
+	}
+}
+
+func TestSubnetPoolRestore(t *testing.T) {
+	_, base, _ := net.ParseCIDR("2001:db8:100::/62")
+	p, _ := NewSubnetPool(base, 64)
+
+	_, peer, _ := net.ParseCIDR("2001:db8:100::/64")
+	if err := p.Restore("peer-client", peer); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if a, _ := p.Acquire("local"); a.String() == peer.String() {
+		t.Errorf("Acquire handed out restored subnet %s", a)
+	}
+	if err := p.Restore("other", peer); err == nil {
+		t.Error("expected conflict restoring a leased subnet to another owner")
+	}
+	if got := p.Leases()["peer-client"]; got == nil || got.String() != peer.String() {
+		t.Errorf("Leases()[peer-client] = %v, want %s", got, peer)
+	}
+
+	_, outside, _ := net.ParseCIDR("2001:db8:200::/64")
+	if err := p.Restore("x", outside); err == nil {
+		t.Error("expected error restoring a subnet outside the pool")
+	}
+}
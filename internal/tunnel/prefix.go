@@ -0,0 +1,79 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"paqet/internal/conf"
+	"paqet/internal/flog"
+	"runtime"
+)
+
+// ApplyPrefix installs a prefix delegated by the server: IPv6 traffic
+// sourced from the prefix is routed into the tunnel and, if configured, the
+// first address of the prefix is assigned to the downstream interface so
+// LAN devices can autoconfigure from it. The prefix in effect is kept when
+// the server delegates it again, and replaced when it delegates another.
+func (t *TUN) ApplyPrefix(prefix *net.IPNet) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("prefix delegation is not supported on %s", runtime.GOOS)
+	}
+	t.leaseMu.Lock()
+	defer t.leaseMu.Unlock()
+	if old := t.prefix; old != nil {
+		if old.String() == prefix.String() {
+			return nil
+		}
+		for _, undo := range prefixUndo(old, t.cfg) {
+			if output, err := exec.Command(undo[0], undo[1:]...).CombinedOutput(); err != nil {
+				flog.Debugf("failed to remove delegated prefix %s: %v, output: %s", old, err, output)
+			}
+		}
+		flog.Infof("delegated IPv6 prefix %s replaced by %s", old, prefix)
+	}
+	t.prefix = nil
+
+	undo := prefixUndo(prefix, t.cfg)
+	if err := t.journal.record(journalEntry{Cmd: undo[0]}); err != nil {
+		return fmt.Errorf("failed to journal prefix route: %v", err)
+	}
+	cmd := exec.Command("ip", "-6", "route", "replace", "default", "from", prefix.String(), "dev", t.cfg.Name)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to route delegated prefix %s: %v, output: %s", prefix, err, output)
+	}
+
+	if t.cfg.DelegateIface != "" {
+		addr := delegatedAddr(prefix)
+		if err := t.journal.record(journalEntry{Cmd: undo[1]}); err != nil {
+			return fmt.Errorf("failed to journal prefix address: %v", err)
+		}
+		cmd = exec.Command("ip", "-6", "addr", "replace", addr, "dev", t.cfg.DelegateIface)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to assign %s to %s: %v, output: %s", addr, t.cfg.DelegateIface, err, output)
+		}
+	}
+
+	t.prefix = prefix
+	flog.Infof("delegated IPv6 prefix %s applied on %s", prefix, t.cfg.Name)
+	return nil
+}
+
+// prefixUndo returns the commands that remove what ApplyPrefix installs
+// for prefix: the source route, and the downstream address if any.
+func prefixUndo(prefix *net.IPNet, cfg *conf.TUN) [][]string {
+	undo := [][]string{{"ip", "-6", "route", "del", "default", "from", prefix.String(), "dev", cfg.Name}}
+	if cfg.DelegateIface != "" {
+		undo = append(undo, []string{"ip", "-6", "addr", "del", delegatedAddr(prefix), "dev", cfg.DelegateIface})
+	}
+	return undo
+}
+
+// delegatedAddr returns the first address of prefix, which is assigned to
+// tun.delegate_iface.
+func delegatedAddr(prefix *net.IPNet) string {
+	ip := make(net.IP, len(prefix.IP))
+	copy(ip, prefix.IP)
+	ip[len(ip)-1] |= 1
+	ones, _ := prefix.Mask.Size()
+	return fmt.Sprintf("%s/%d", ip, ones)
+}
@@ -0,0 +1,160 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"paqet/internal/flog"
+	"paqet/internal/pkg/buffer"
+)
+
+// Queues returns the number of queues of the device, see tun.queues.
+func (t *TUN) Queues() int {
+	return max(len(t.queues), 1)
+}
+
+// NextQueue returns a writer to the next queue of the device in rotation,
+// for a stream that relays packets from the peer. Writes go through the
+// mirrors like those of Write.
+func (t *TUN) NextQueue() io.Writer {
+	if len(t.queues) == 0 {
+		return t
+	}
+	q := t.queues[int(t.nextQueue.Add(1)-1)%len(t.queues)]
+	return &queueWriter{t: t, q: q}
+}
+
+type queueWriter struct {
+	t *TUN
+	q io.Writer
+}
+
+func (w *queueWriter) Write(b []byte) (int, error) {
+	return w.t.write(w.q, b)
+}
+
+// Sharded reports whether Shard relays the device's outbound packets, which
+// it does with several queues or tun.routing.
+func (t *TUN) Sharded() bool {
+	return t.Queues() > 1 || t.router != nil
+}
+
+// Shard relays the device's outbound packets to the peer streams when
+// Sharded, in place of a copy per stream: a worker per queue reads packets
+// and writes each to the peer stream picked by the hash of its 5-tuple, so
+// that a flow stays in order on one stream while the queues are read in
+// parallel. With tun.routing only the streams of the client the destination
+// belongs to are candidates. Packets no stream is picked for are dropped.
+// Shard returns when ctx is done or a queue fails.
+func (t *TUN) Shard(ctx context.Context) error {
+	queues := t.queues
+	if len(queues) == 0 {
+		queues = []io.ReadWriteCloser{t.iface}
+	}
+	errCh := make(chan error, len(queues))
+	for _, q := range queues {
+		go func() {
+			errCh <- t.shard(q)
+		}()
+	}
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shard relays the packets of one queue until it fails.
+func (t *TUN) shard(q io.Reader) error {
+	bufp := buffer.TUNPool.Get()
+	defer buffer.TUNPool.Put(bufp)
+	buf := *bufp
+	for {
+		n, err := t.read(q, buf)
+		if err != nil {
+			return err
+		}
+		t.hooks.mu.RLock()
+		pw := t.pick(t.packet(buf[:n]))
+		t.hooks.mu.RUnlock()
+		if pw == nil {
+			continue
+		}
+		if _, err := pw.Write(buf[:n]); err != nil {
+			flog.Debugf("TUN queue to stream write error: %v", err)
+		}
+	}
+}
+
+// pick returns the peer stream for the flow of pkt, or nil if there is
+// none. t.hooks.mu must be held.
+func (t *TUN) pick(pkt []byte) *peerWriter {
+	if t.router != nil {
+		return t.router.pick(pkt)
+	}
+	if len(t.hooks.peers) == 0 {
+		return nil
+	}
+	return t.hooks.peers[flowHash(pkt)%uint32(len(t.hooks.peers))]
+}
+
+// ipv6Upper skips the extension headers of an IPv6 packet and returns the
+// upper-layer protocol and its header, or a nil header for fragments after
+// the first and packets cut short.
+func ipv6Upper(pkt []byte) (proto byte, l4 []byte) {
+	proto, l4 = pkt[6], pkt[40:]
+	for {
+		switch proto {
+		case 0, 43, 60: // hop-by-hop, routing, destination options
+			if len(l4) < 8 {
+				return proto, nil
+			}
+			n := 8 + int(l4[1])*8
+			if len(l4) < n {
+				return proto, nil
+			}
+			proto, l4 = l4[0], l4[n:]
+		case 44: // fragment
+			if len(l4) < 8 {
+				return proto, nil
+			}
+			next := l4[0]
+			if binary.BigEndian.Uint16(l4[2:4])&0xfff8 != 0 {
+				return next, nil
+			}
+			proto, l4 = next, l4[8:]
+		default:
+			return proto, l4
+		}
+	}
+}
+
+// flowHash hashes the protocol, addresses and, for TCP and UDP, ports of an
+// IP packet. Fragments after the first and other protocols hash on the
+// protocol and addresses alone.
+func flowHash(pkt []byte) uint32 {
+	h := fnv.New32a()
+	var proto byte
+	var l4 []byte
+	switch {
+	case len(pkt) >= 20 && pkt[0]>>4 == 4:
+		ihl := int(pkt[0]&0x0f) * 4
+		proto = pkt[9]
+		h.Write(pkt[12:20])
+		if binary.BigEndian.Uint16(pkt[6:8])&0x1fff == 0 && len(pkt) >= ihl {
+			l4 = pkt[ihl:]
+		}
+	case len(pkt) >= 40 && pkt[0]>>4 == 6:
+		h.Write(pkt[8:40])
+		proto, l4 = ipv6Upper(pkt)
+	default:
+		return 0
+	}
+	h.Write([]byte{proto})
+	if (proto == 6 || proto == 17) && len(l4) >= 4 {
+		h.Write(l4[:4])
+	}
+	return h.Sum32()
+}
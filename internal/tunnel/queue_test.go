@@ -0,0 +1,84 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"paqet/internal/conf"
+	"paqet/internal/pkg/buffer"
+	"testing"
+)
+
+// tcpPacket returns an IPv4 TCP packet from 10.0.0.1:sport to 10.0.0.2:443
+// with n bytes of payload.
+func tcpPacket(sport byte, n int) []byte {
+	p := ipv4Packet(40 + n)
+	p[9] = 6
+	copy(p[12:20], []byte{10, 0, 0, 1, 10, 0, 0, 2})
+	copy(p[20:24], []byte{0x9c, sport, 0x01, 0xbb})
+	return p
+}
+
+func TestShard(t *testing.T) {
+	buffer.Initialize(4096, 4096, 4096)
+	// Two flows, each with packets on both queues.
+	q0 := &fakeDevice{in: [][]byte{tcpPacket(1, 10), tcpPacket(2, 20)}}
+	q1 := &fakeDevice{in: [][]byte{tcpPacket(2, 30), tcpPacket(1, 40)}}
+	tun := &TUN{iface: q0, queues: []io.ReadWriteCloser{q0, q1}, cfg: &conf.TUN{Name: "tun0", MTU: 1500}}
+
+	if flowHash(tcpPacket(1, 10)) != flowHash(tcpPacket(1, 500)) {
+		t.Fatal("packets of one flow hash differently")
+	}
+	var strms [8]bytes.Buffer
+	for i := range strms {
+		_, detach := tun.Peer(&strms[i])
+		defer detach()
+	}
+	for _, q := range tun.queues {
+		if err := tun.shard(q); err != io.EOF {
+			t.Fatalf("shard returned %v, want EOF", err)
+		}
+	}
+
+	// Each flow whole on the stream its hash picks.
+	want := make([]int, len(strms))
+	for _, sport := range []byte{1, 2} {
+		want[flowHash(tcpPacket(sport, 0))%uint32(len(strms))] += 2*40 + 50
+	}
+	for i := range strms {
+		if strms[i].Len() != want[i] {
+			t.Errorf("stream %d got %d bytes, want %d", i, strms[i].Len(), want[i])
+		}
+	}
+
+	// Writes from the peer rotate over the queues.
+	tun.NextQueue().Write(tcpPacket(1, 0))
+	tun.NextQueue().Write(tcpPacket(1, 0))
+	if len(q0.written) != 1 || len(q1.written) != 1 {
+		t.Errorf("queues got %d and %d writes, want 1 each", len(q0.written), len(q1.written))
+	}
+}
+
+func TestFlowHashIPv6(t *testing.T) {
+	// A TCP segment from port sport behind a destination options header.
+	pkt := func(sport byte) []byte {
+		p := make([]byte, 40+8+20)
+		p[0], p[6] = 0x60, 60
+		p[40] = 6
+		copy(p[48:52], []byte{0x9c, sport, 0x01, 0xbb})
+		return p
+	}
+	if proto, l4 := ipv6Upper(pkt(1)); proto != 6 || len(l4) != 20 {
+		t.Fatalf("upper layer = %d with %d bytes, want TCP with 20", proto, len(l4))
+	}
+	if flowHash(pkt(1)) == flowHash(pkt(2)) {
+		t.Error("ports behind an extension header are not hashed")
+	}
+
+	// Fragments after the first carry no ports.
+	frag := make([]byte, 40+8+20)
+	frag[0], frag[6] = 0x60, 44
+	frag[40], frag[43] = 17, 0x08
+	if proto, l4 := ipv6Upper(frag); proto != 17 || l4 != nil {
+		t.Errorf("later fragment = %d with %v, want UDP without header", proto, l4)
+	}
+}
@@ -0,0 +1,246 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"paqet/internal/flog"
+	"runtime"
+	"strings"
+)
+
+// AddRoute routes dst through the TUN device.
+func (t *TUN) AddRoute(dst *net.IPNet) error {
+	return t.route("add", dst)
+}
+
+// DelRoute removes a route previously added with AddRoute.
+func (t *TUN) DelRoute(dst *net.IPNet) error {
+	return t.route("delete", dst)
+}
+
+func (t *TUN) route(action string, dst *net.IPNet) error {
+	args, err := t.routeCmd(action, dst)
+	if err != nil {
+		return err
+	}
+	if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to %s route %s: %v, output: %s", action, dst, err, output)
+	}
+	return nil
+}
+
+// routeCmd returns the command that adds or deletes the route of dst
+// through the device.
+func (t *TUN) routeCmd(action string, dst *net.IPNet) ([]string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		if action == "delete" {
+			action = "del"
+		}
+		return []string{"ip", family(dst, "-4", "-6"), "route", action, dst.String(), "dev", t.cfg.Name}, nil
+	case "darwin":
+		return []string{"route", "-n", action, family(dst, "-inet", "-inet6"), dst.String(), "-interface", t.cfg.Name}, nil
+	default:
+		return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
+func family(n *net.IPNet, v4, v6 string) string {
+	if n.IP.To4() == nil {
+		return v6
+	}
+	return v4
+}
+
+// Activate switches traffic over to the device once the tunnel carries
+// it: DNS leak protection, split DNS for tun.dns, and tun.routes. Every
+// change is journaled, so that Deactivate, shutdown, or the next start
+// after a crash undoes it; a failed Activate undoes its changes at once.
+// Activate does nothing while it is in effect.
+func (t *TUN) Activate() error {
+	if (len(t.cfg.Routes) == 0 && !t.cfg.DNS.Enabled() && !t.cfg.DNS.BlockLeaks) || t.routed.Load() {
+		return nil
+	}
+	t.leaseMu.Lock()
+	defer t.leaseMu.Unlock()
+	if t.routed.Load() {
+		return nil
+	}
+	if err := t.blockDNSLeaks(); err != nil {
+		t.journal.withdraw()
+		return err
+	}
+	if err := t.configureDNS(); err != nil {
+		t.journal.withdraw()
+		return err
+	}
+	if err := t.installRoutes(); err != nil {
+		t.journal.withdraw()
+		return err
+	}
+	t.routed.Store(true)
+	return nil
+}
+
+// installRoutes routes tun.routes into the device. Routes that cover the
+// server, and every tun.exclude_routes entry, are first pinned to the
+// gateway they use now, so that the transport does not loop through the
+// tunnel. A default route goes in as its two halves, which win over the
+// system default without replacing it.
+func (t *TUN) installRoutes() error {
+	if len(t.cfg.Routes) == 0 {
+		return nil
+	}
+	var bypass []*net.IPNet
+	for _, s := range t.cfg.Servers {
+		if s == nil || !covers(t.cfg.Routes, s.IP) {
+			continue
+		}
+		bits := 128
+		if s.IP.To4() != nil {
+			bits = 32
+		}
+		bypass = append(bypass, &net.IPNet{IP: s.IP, Mask: net.CIDRMask(bits, bits)})
+	}
+	bypass = append(bypass, t.cfg.ExcludeRoutes...)
+	for _, n := range bypass {
+		if err := t.pinRoute(n); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range splitDefault(t.cfg.Routes) {
+		undo, err := t.routeCmd("delete", n)
+		if err != nil {
+			return err
+		}
+		if err := t.journal.record(journalEntry{Cmd: undo, Active: true}); err != nil {
+			return fmt.Errorf("failed to journal route %s: %v", n, err)
+		}
+		if err := t.AddRoute(n); err != nil {
+			return err
+		}
+	}
+	flog.Infof("routed %d networks through %s (%d kept on the original gateway)", len(t.cfg.Routes), t.cfg.Name, len(bypass))
+	return nil
+}
+
+// Deactivate hands traffic back to the host network by undoing what
+// Activate did, until the next Activate.
+func (t *TUN) Deactivate() {
+	t.leaseMu.Lock()
+	defer t.leaseMu.Unlock()
+	if !t.routed.Load() {
+		return
+	}
+	t.journal.withdraw()
+	t.routed.Store(false)
+	flog.Infof("withdrew tun.routes, split DNS and DNS leak protection from %s", t.cfg.Name)
+}
+
+// pinRoute routes n through the gateway that currently carries its first
+// address.
+func (t *TUN) pinRoute(n *net.IPNet) error {
+	var out []byte
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		out, err = exec.Command("ip", "route", "get", n.IP.String()).Output()
+	case "darwin":
+		out, err = exec.Command("route", "-n", "get", family(n, "-inet", "-inet6"), n.IP.String()).Output()
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up the route to %s: %v", n.IP, err)
+	}
+	gw, dev := parseRouteGet(string(out))
+	if dev == "" {
+		return fmt.Errorf("no route to %s to keep it off the tunnel", n.IP)
+	}
+	if dev == t.cfg.Name {
+		return fmt.Errorf("%s already routes through %s", n.IP, t.cfg.Name)
+	}
+
+	var add, undo []string
+	switch runtime.GOOS {
+	case "linux":
+		add = []string{"ip", family(n, "-4", "-6"), "route", "replace", n.String()}
+		if gw != "" {
+			add = append(add, "via", gw)
+		}
+		add = append(add, "dev", dev)
+		undo = []string{"ip", family(n, "-4", "-6"), "route", "del", n.String(), "dev", dev}
+	case "darwin":
+		add = []string{"route", "-n", "add", family(n, "-inet", "-inet6"), n.String()}
+		if gw != "" {
+			add = append(add, gw)
+		} else {
+			add = append(add, "-interface", dev)
+		}
+		undo = []string{"route", "-n", "delete", family(n, "-inet", "-inet6"), n.String()}
+	}
+	if err := t.journal.record(journalEntry{Cmd: undo, Active: true}); err != nil {
+		return fmt.Errorf("failed to journal route %s: %v", n, err)
+	}
+	if output, err := exec.Command(add[0], add[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to keep %s off the tunnel: %v, output: %s", n, err, output)
+	}
+	flog.Debugf("route %s pinned to %s via %s", n, dev, gw)
+	return nil
+}
+
+// parseRouteGet extracts the gateway, empty if on-link, and the interface
+// from the output of "ip route get" on Linux or "route -n get" on macOS.
+func parseRouteGet(out string) (gw, dev string) {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if v, ok := strings.CutPrefix(line, "gateway:"); ok {
+			gw = strings.TrimSpace(v)
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "interface:"); ok {
+			dev = strings.TrimSpace(v)
+			continue
+		}
+		f := strings.Fields(line)
+		for i := 0; i+1 < len(f); i++ {
+			switch f[i] {
+			case "via":
+				gw = f[i+1]
+			case "dev":
+				dev = f[i+1]
+			}
+		}
+	}
+	return gw, dev
+}
+
+// covers reports whether any of nets contains ip.
+func covers(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitDefault replaces default routes in nets by their two halves.
+func splitDefault(nets []*net.IPNet) []*net.IPNet {
+	var out []*net.IPNet
+	for _, n := range nets {
+		ones, bits := n.Mask.Size()
+		if ones != 0 {
+			out = append(out, n)
+			continue
+		}
+		hi := make(net.IP, len(n.IP))
+		hi[0] = 0x80
+		out = append(out,
+			&net.IPNet{IP: make(net.IP, len(n.IP)), Mask: net.CIDRMask(1, bits)},
+			&net.IPNet{IP: hi, Mask: net.CIDRMask(1, bits)})
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package tunnel
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseRouteGet(t *testing.T) {
+	tests := []struct {
+		name, out, gw, dev string
+	}{
+		{"linux via", "203.0.113.7 via 192.168.1.1 dev eth0 src 192.168.1.100 uid 0 \n    cache \n", "192.168.1.1", "eth0"},
+		{"linux on-link", "192.168.1.20 dev wlan0 src 192.168.1.100 uid 0 \n    cache \n", "", "wlan0"},
+		{"darwin", "   route to: 203.0.113.7\ndestination: default\n       mask: default\n    gateway: 192.168.1.1\n  interface: en0\n      flags: <UP,GATEWAY,DONE,STATIC,PRCLONING>\n", "192.168.1.1", "en0"},
+	}
+	for _, tt := range tests {
+		gw, dev := parseRouteGet(tt.out)
+		if gw != tt.gw || dev != tt.dev {
+			t.Errorf("%s: got gateway %q dev %q, want %q %q", tt.name, gw, dev, tt.gw, tt.dev)
+		}
+	}
+}
+
+func TestSplitDefault(t *testing.T) {
+	var nets []*net.IPNet
+	for _, s := range []string{"0.0.0.0/0", "10.0.0.0/8", "::/0"} {
+		_, n, _ := net.ParseCIDR(s)
+		nets = append(nets, n)
+	}
+	var got []string
+	for _, n := range splitDefault(nets) {
+		got = append(got, n.String())
+	}
+	want := []string{"0.0.0.0/1", "128.0.0.0/1", "10.0.0.0/8", "::/1", "8000::/1"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
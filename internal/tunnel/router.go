@@ -0,0 +1,278 @@
+package tunnel
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/netip"
+	"paqet/internal/flog"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// router delivers the packets read from the device to the client they are
+// addressed to, with tun.routing. It learns the tunnel addresses of each
+// client from the source addresses of the packets the client sends, and
+// knows the addresses leased and the prefixes delegated to it.
+type router struct {
+	self  []netip.Addr   // the device's own addresses, never learned
+	local []netip.Prefix // the tunnel networks, where clients without a lease may pick addresses
+	pool  netip.Prefix   // tun.pool, whose addresses only their lessee may use; zero if unset
+	neigh *neighProxy    // told about learned addresses, may be nil
+
+	mu      sync.RWMutex
+	clients map[string]*routeClient
+	hosts   map[netip.Addr]*routeClient
+	nets    map[netip.Prefix]*routeClient
+	leases  map[string]netip.Addr // address leased from tun.pool, by client
+
+	unrouted atomic.Uint64
+}
+
+// routeClient is one client and the streams its packets can go to.
+type routeClient struct {
+	id    string
+	peers []*peerWriter
+}
+
+// Route is an entry of the routing table.
+type Route struct {
+	Dst     string `json:"dst"`
+	Client  string `json:"client"`
+	Streams int    `json:"streams"`
+}
+
+func newRouter(local []netip.Prefix, self ...netip.Addr) *router {
+	return &router{
+		self:    self,
+		local:   local,
+		clients: make(map[string]*routeClient),
+		hosts:   make(map[netip.Addr]*routeClient),
+		nets:    make(map[netip.Prefix]*routeClient),
+		leases:  make(map[string]netip.Addr),
+	}
+}
+
+// Route returns the writer the relay of a stream's packets to the device
+// goes through. With tun.routing it attaches peer, the writer Peer returned
+// for the stream, to client, and learns the client's addresses from the
+// packets written; otherwise it returns dev unchanged.
+func (t *TUN) Route(dev io.Writer, peer io.Writer, client string) io.Writer {
+	pw, ok := peer.(*peerWriter)
+	if t.router == nil || !ok {
+		return dev
+	}
+	c := t.router.attach(client, pw)
+	return &routedWriter{t: t, dev: dev, c: c}
+}
+
+// RoutePrefix routes prefix, delegated to client, to the client's streams.
+func (t *TUN) RoutePrefix(client string, prefix netip.Prefix) {
+	if t.router == nil {
+		return
+	}
+	r := t.router
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c := r.clients[client]; c != nil {
+		r.nets[prefix.Masked()] = c
+	}
+}
+
+// RouteLease routes addr, leased to client from tun.pool, to the client's
+// streams. It is the only address of its family the client may send from
+// outside its delegated prefix.
+func (t *TUN) RouteLease(client string, addr netip.Addr) {
+	if t.router == nil {
+		return
+	}
+	r := t.router
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.clients[client]
+	if c == nil {
+		return
+	}
+	r.leases[client] = addr
+	if owner := r.hosts[addr]; owner != nil && owner != c {
+		flog.Warnf("TUN address %s leased to client %s was in use by client %s", addr, client, owner.id)
+	}
+	r.hosts[addr] = c
+}
+
+// Routes returns the routing table, or an error without tun.routing.
+func (t *TUN) Routes() ([]Route, error) {
+	if t.router == nil {
+		return nil, fmt.Errorf("tun.routing is not enabled")
+	}
+	r := t.router
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := []Route{}
+	for a, c := range r.hosts {
+		routes = append(routes, Route{Dst: netip.PrefixFrom(a, a.BitLen()).String(), Client: c.id, Streams: len(c.peers)})
+	}
+	for p, c := range r.nets {
+		routes = append(routes, Route{Dst: p.String(), Client: c.id, Streams: len(c.peers)})
+	}
+	slices.SortFunc(routes, func(a, b Route) int {
+		if a.Client != b.Client {
+			return cmp.Compare(a.Client, b.Client)
+		}
+		return cmp.Compare(a.Dst, b.Dst)
+	})
+	return routes, nil
+}
+
+// Unrouted returns the number of packets dropped for a destination no
+// client has.
+func (t *TUN) Unrouted() uint64 {
+	if t.router == nil {
+		return 0
+	}
+	return t.router.unrouted.Load()
+}
+
+func (r *router) attach(id string, pw *peerWriter) *routeClient {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.clients[id]
+	if c == nil {
+		c = &routeClient{id: id}
+		r.clients[id] = c
+	}
+	c.peers = append(c.peers, pw)
+	return c
+}
+
+// detach removes pw, and with the last stream of its client every route to
+// the client.
+func (r *router) detach(pw *peerWriter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, c := range r.clients {
+		i := slices.Index(c.peers, pw)
+		if i < 0 {
+			continue
+		}
+		c.peers = slices.Delete(c.peers, i, i+1)
+		if len(c.peers) > 0 {
+			return
+		}
+		delete(r.clients, id)
+		delete(r.leases, id)
+		for a, hc := range r.hosts {
+			if hc == c && r.neigh != nil {
+				r.neigh.set(a, false)
+			}
+		}
+		unroute(r.hosts, c)
+		unroute(r.nets, c)
+		return
+	}
+}
+
+// unroute deletes the entries of m that route to c.
+func unroute[K comparable](m map[K]*routeClient, c *routeClient) {
+	for k, v := range m {
+		if v == c {
+			delete(m, k)
+		}
+	}
+}
+
+// pick returns the stream for pkt: one of the streams of the client its
+// destination belongs to, by flow, or nil if no client has it.
+func (r *router) pick(pkt []byte) *peerWriter {
+	dst := packetAddr(pkt, false)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := r.hosts[dst]
+	if c == nil {
+		bits := -1
+		for p, pc := range r.nets {
+			if p.Bits() > bits && p.Contains(dst) {
+				c, bits = pc, p.Bits()
+			}
+		}
+	}
+	if c == nil || len(c.peers) == 0 {
+		r.unrouted.Add(1)
+		return nil
+	}
+	return c.peers[flowHash(pkt)%uint32(len(c.peers))]
+}
+
+// learn makes the source address of pkt, a packet c sent, an address of c
+// if c may use it and no other connected client has it, so that a client
+// cannot take over another one's address by spoofing its packets.
+func (r *router) learn(c *routeClient, pkt []byte) {
+	src := packetAddr(pkt, true)
+	if !src.IsGlobalUnicast() || slices.Contains(r.self, src) {
+		return
+	}
+	r.mu.RLock()
+	learn := r.hosts[src] == nil && r.allowed(c, src)
+	r.mu.RUnlock()
+	if !learn {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients[c.id] != c || r.hosts[src] != nil {
+		return // detached or taken meanwhile
+	}
+	r.hosts[src] = c
+	if r.neigh != nil {
+		r.neigh.set(src, true)
+	}
+}
+
+// allowed reports whether c may send from src: inside a prefix delegated to
+// it, at its leased address, or else anywhere in the tunnel networks but
+// tun.pool. The caller holds r.mu.
+func (r *router) allowed(c *routeClient, src netip.Addr) bool {
+	for p, pc := range r.nets {
+		if p.Contains(src) {
+			return pc == c
+		}
+	}
+	if a, ok := r.leases[c.id]; ok && a.Is4() == src.Is4() {
+		return src == a
+	}
+	if r.pool.IsValid() && r.pool.Contains(src) {
+		return false
+	}
+	return slices.ContainsFunc(r.local, func(p netip.Prefix) bool { return p.Contains(src) })
+}
+
+type routedWriter struct {
+	t   *TUN
+	dev io.Writer
+	c   *routeClient
+}
+
+func (w *routedWriter) Write(b []byte) (int, error) {
+	w.t.router.learn(w.c, w.t.packet(b))
+	return w.dev.Write(b)
+}
+
+// packetAddr returns the source or destination address of an IP packet.
+func packetAddr(pkt []byte, src bool) netip.Addr {
+	switch {
+	case len(pkt) >= 20 && pkt[0]>>4 == 4:
+		off := 16
+		if src {
+			off = 12
+		}
+		return netip.AddrFrom4([4]byte(pkt[off : off+4]))
+	case len(pkt) >= 40 && pkt[0]>>4 == 6:
+		off := 24
+		if src {
+			off = 8
+		}
+		return netip.AddrFrom16([16]byte(pkt[off : off+16]))
+	}
+	return netip.Addr{}
+}
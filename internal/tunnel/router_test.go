@@ -0,0 +1,143 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"paqet/internal/conf"
+	"paqet/internal/pkg/buffer"
+	"testing"
+)
+
+// addrPacket returns a 40-byte IPv4 or IPv6 packet from src to dst.
+func addrPacket(src, dst string) []byte {
+	s, d := netip.MustParseAddr(src), netip.MustParseAddr(dst)
+	if s.Is4() {
+		p := ipv4Packet(40)
+		copy(p[12:16], s.AsSlice())
+		copy(p[16:20], d.AsSlice())
+		return p
+	}
+	p := make([]byte, 40)
+	p[0] = 0x60
+	copy(p[8:24], s.AsSlice())
+	copy(p[24:40], d.AsSlice())
+	return p
+}
+
+func TestRouter(t *testing.T) {
+	buffer.Initialize(4096, 4096, 4096)
+	dev := &fakeDevice{in: [][]byte{
+		addrPacket("10.0.0.1", "10.0.0.2"),
+		addrPacket("10.0.0.1", "10.0.0.3"),
+		addrPacket("10.0.0.1", "10.0.0.9"),
+		addrPacket("2001:db8::1", "2001:db8:0:b::5"),
+	}}
+	local := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")}
+	tun := &TUN{iface: dev, cfg: &conf.TUN{Name: "tun0", MTU: 1500}, router: newRouter(local, netip.MustParseAddr("10.0.0.1"))}
+
+	var a, b bytes.Buffer
+	peerA, detachA := tun.Peer(&a)
+	defer detachA()
+	peerB, detachB := tun.Peer(&b)
+	wa := tun.Route(dev, peerA, "a")
+	wb := tun.Route(dev, peerB, "b")
+
+	// Each client's address is learned from what it sends, but never the
+	// device's own.
+	wa.Write(addrPacket("10.0.0.2", "10.0.0.1"))
+	wa.Write(addrPacket("10.0.0.1", "10.0.0.1"))
+	wb.Write(addrPacket("10.0.0.3", "10.0.0.1"))
+	tun.RoutePrefix("b", netip.MustParsePrefix("2001:db8:0:b::/64"))
+	if len(dev.written) != 3 {
+		t.Fatalf("device got %d packets, want 3", len(dev.written))
+	}
+	routes, err := tun.Routes()
+	if err != nil || len(routes) != 3 {
+		t.Fatalf("routes = %v (%v), want 3", routes, err)
+	}
+
+	if err := tun.shard(dev); err != io.EOF {
+		t.Fatalf("shard returned %v, want EOF", err)
+	}
+	if a.Len() != 40 || b.Len() != 80 {
+		t.Errorf("clients got %d and %d bytes, want 40 and 80", a.Len(), b.Len())
+	}
+	if tun.Unrouted() != 1 {
+		t.Errorf("unrouted = %d, want 1", tun.Unrouted())
+	}
+
+	// An address stays with the connected client that owns it, and
+	// addresses outside the tunnel network or another client's prefix are
+	// never learned.
+	wb.Write(addrPacket("10.0.0.2", "10.0.0.1"))
+	wa.Write(addrPacket("192.0.2.1", "10.0.0.1"))
+	wa.Write(addrPacket("2001:db8:0:b::9", "10.0.0.1"))
+	if err := tun.Inject(Outbound, addrPacket("10.0.0.1", "10.0.0.2")); err != nil || a.Len() != 80 || b.Len() != 80 {
+		t.Errorf("inject after spoofing: %v, clients have %d and %d bytes, want 80 and 80", err, a.Len(), b.Len())
+	}
+	if routes, _ := tun.Routes(); len(routes) != 3 {
+		t.Errorf("routes after spoofing = %v, want 3", routes)
+	}
+
+	// The last stream of a client takes its routes along.
+	detachB()
+	if routes, _ := tun.Routes(); len(routes) != 1 || routes[0].Client != "a" {
+		t.Errorf("routes after detach = %v, want client a's only", routes)
+	}
+	if err := tun.Inject(Outbound, addrPacket("10.0.0.1", "10.0.0.3")); err == nil {
+		t.Error("packet for a detached client injected")
+	}
+}
+
+func TestRouterNeighProxy(t *testing.T) {
+	n := &neighProxy{want: make(map[netip.Addr]bool), wake: make(chan struct{}, 1)}
+	r := newRouter([]netip.Prefix{netip.MustParsePrefix("2001:db8::/64")}, netip.MustParseAddr("2001:db8::1"))
+	r.neigh = n
+	tun := &TUN{cfg: &conf.TUN{Name: "tun0", MTU: 1500}, router: r}
+
+	var a bytes.Buffer
+	peer, detach := tun.Peer(&a)
+	w := tun.Route(io.Discard, peer, "a")
+	w.Write(addrPacket("2001:db8::2", "2001:db8::1"))
+	w.Write(addrPacket("10.0.0.2", "10.0.0.1"))
+	if len(n.want) != 1 || !n.want[netip.MustParseAddr("2001:db8::2")] {
+		t.Fatalf("proxy entries = %v, want 2001:db8::2 only", n.want)
+	}
+
+	detach()
+	if len(n.want) != 0 {
+		t.Errorf("proxy entries after detach = %v, want none", n.want)
+	}
+}
+
+func TestRouterLease(t *testing.T) {
+	r := newRouter([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")}, netip.MustParseAddr("10.0.0.1"))
+	r.pool = netip.MustParsePrefix("10.0.0.128/25")
+	tun := &TUN{cfg: &conf.TUN{Name: "tun0", MTU: 1500}, router: r}
+
+	var a, b bytes.Buffer
+	peerA, detachA := tun.Peer(&a)
+	defer detachA()
+	peerB, detachB := tun.Peer(&b)
+	defer detachB()
+	wa := tun.Route(io.Discard, peerA, "a")
+	wb := tun.Route(io.Discard, peerB, "b")
+	tun.RouteLease("a", netip.MustParseAddr("10.0.0.130"))
+
+	// A leased client only sends from its lease; others may not use the
+	// pool, but static addresses outside it.
+	wa.Write(addrPacket("10.0.0.5", "10.0.0.1"))
+	wb.Write(addrPacket("10.0.0.131", "10.0.0.1"))
+	wb.Write(addrPacket("10.0.0.6", "10.0.0.1"))
+	want := map[string]string{"10.0.0.130/32": "a", "10.0.0.6/32": "b"}
+	routes, _ := tun.Routes()
+	if len(routes) != len(want) {
+		t.Fatalf("routes = %v, want %v", routes, want)
+	}
+	for _, rt := range routes {
+		if want[rt.Dst] != rt.Client {
+			t.Errorf("route %s to %s, want %v", rt.Dst, rt.Client, want)
+		}
+	}
+}
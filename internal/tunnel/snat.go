@@ -0,0 +1,75 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"paqet/internal/flog"
+	"strings"
+)
+
+// enableSNAT lets clients reach beyond the server: it turns on IP
+// forwarding and masquerades packets from the tunnel networks that leave
+// through any other interface. Both changes are journaled, and the rules are
+// tagged so that removeStaleRules finds them after a crash without a journal.
+func (t *TUN) enableSNAT() error {
+	if !t.cfg.SNAT {
+		return nil
+	}
+	for _, n := range t.nets() {
+		if err := t.masquerade(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TUN) masquerade(n *net.IPNet) error {
+	bin, sysctl := "iptables", "net.ipv4.ip_forward"
+	if n.IP.To4() == nil {
+		bin, sysctl = "ip6tables", "net.ipv6.conf.all.forwarding"
+	}
+	if _, err := exec.LookPath(bin); err != nil {
+		return fmt.Errorf("tun.snat requires %s: %v", bin, err)
+	}
+	if err := t.enableSysctl(sysctl); err != nil {
+		return err
+	}
+
+	tag := "paqet-nat-" + t.cfg.Name
+	t.removeStaleRules(bin, "nat", "POSTROUTING", tag)
+	rule := []string{"-s", n.String(), "!", "-o", t.cfg.Name, "-m", "comment", "--comment", tag, "-j", "MASQUERADE"}
+	undo := append([]string{bin, "-t", "nat", "-D", "POSTROUTING"}, rule...)
+	if err := t.journal.record(journalEntry{Cmd: undo}); err != nil {
+		return fmt.Errorf("failed to journal %s change: %v", bin, err)
+	}
+	args := append([]string{"-t", "nat", "-A", "POSTROUTING"}, rule...)
+	if output, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add %s masquerade rule: %v, output: %s", bin, err, output)
+	}
+	flog.Infof("SNAT enabled: traffic from %s is masqueraded when it leaves through another interface", n)
+	return nil
+}
+
+// enableSysctl sets the sysctl key to 1, journaling the previous value.
+func (t *TUN) enableSysctl(key string) error {
+	path := "/proc/sys/" + strings.ReplaceAll(key, ".", "/")
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	prev := strings.TrimSpace(string(old))
+	if prev == "1" {
+		return nil
+	}
+	undo := journalEntry{Cmd: []string{"sysctl", "-w", key + "=" + prev}, Guard: path, GuardPrefix: "1"}
+	if err := t.journal.record(undo); err != nil {
+		return fmt.Errorf("failed to journal %s change: %v", key, err)
+	}
+	if err := os.WriteFile(path, []byte("1\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", key, err)
+	}
+	flog.Infof("enabled %s (was %s)", key, prev)
+	return nil
+}
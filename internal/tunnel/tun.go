@@ -2,19 +2,34 @@ package tunnel
 
 import (
 	"fmt"
+	"io"
 	"net"
+	"net/netip"
 	"os/exec"
 	"paqet/internal/conf"
 	"paqet/internal/flog"
 	"runtime"
+	"sync"
+	"sync/atomic"
 
 	"github.com/songgao/water"
 )
 
 // TUN represents a TUN device for layer 3 networking
 type TUN struct {
-	iface *water.Interface
+	iface io.ReadWriteCloser
 	cfg   *conf.TUN
+
+	queues    []io.ReadWriteCloser // every queue with tun.queues above 1, iface first
+	nextQueue atomic.Uint32
+	router    *router     // nil unless tun.routing is set
+	neigh     *neighProxy // nil unless tun.proxy_arp needs NDP entries
+
+	journal *journal    // undo log of host changes made for this device
+	leaseMu sync.Mutex  // serializes Assign, ApplyPrefix, Activate and Deactivate
+	prefix  *net.IPNet  // the delegated prefix in effect, see ApplyPrefix
+	routed  atomic.Bool // tun.routes, split DNS and leak protection are in effect, see Activate
+	hooks   hooks       // mirrors and peer streams, see Mirror and Inject
 }
 
 // New creates and configures a new TUN device
@@ -23,23 +38,73 @@ func New(cfg *conf.TUN) (*TUN, error) {
 		return nil, fmt.Errorf("TUN is not enabled in configuration")
 	}
 
-	config := water.Config{
-		DeviceType: water.TUN,
+	j := newJournal(cfg.Journal)
+	if err := j.recover(); err != nil {
+		flog.Warnf("failed to recover TUN journal %s: %v", cfg.Journal, err)
+	}
+	if err := j.snapshot(); err != nil {
+		flog.Warnf("failed to persist TUN journal %s: %v", cfg.Journal, err)
 	}
-	config.Name = cfg.Name
 
-	iface, err := water.New(config)
+	var iface io.ReadWriteCloser
+	var queues []io.ReadWriteCloser
+	var err error
+	if cfg.Offload || cfg.Queues > 1 {
+		queues, err = openDevice(cfg.Name, cfg.Queues, cfg.Offload)
+		if err == nil {
+			iface = queues[0]
+		}
+	} else {
+		config := water.Config{
+			DeviceType: water.TUN,
+		}
+		config.Name = cfg.Name
+		iface, err = water.New(config)
+	}
 	if err != nil {
+		j.rollback()
 		return nil, fmt.Errorf("failed to create TUN device: %v", err)
 	}
 
 	t := &TUN{
-		iface: iface,
-		cfg:   cfg,
+		iface:   iface,
+		cfg:     cfg,
+		journal: j,
+	}
+	if len(queues) > 1 {
+		t.queues = queues
+	}
+	if cfg.Routing {
+		var self []netip.Addr
+		for _, ip := range []net.IP{cfg.IP, cfg.IP6} {
+			if a, ok := netip.AddrFromSlice(ip); ok {
+				self = append(self, a.Unmap())
+			}
+		}
+		t.router = newRouter(prefixes(t.nets()), self...)
+		if p := prefixes([]*net.IPNet{cfg.Pool}); len(p) > 0 {
+			t.router.pool = p[0]
+		}
 	}
 
-	if err := t.configure(); err != nil {
-		iface.Close()
+	// With tun.addr "auto" the device is configured by Assign once the
+	// server has leased an address.
+	if !cfg.Auto {
+		if err := t.configure(); err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+	if err := t.configure6(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if err := t.enableSNAT(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if err := t.enableProxyNeigh(); err != nil {
+		t.Close()
 		return nil, err
 	}
 
@@ -87,15 +152,7 @@ func (t *TUN) configureDarwin() error {
 	// Set IP address and destination (for point-to-point)
 	// For macOS, we need to set both local and destination addresses
 	ip := t.cfg.IP.String()
-	network := t.cfg.Net
-	
-	// Calculate a destination address (typically the network address + 1 or last address - 1)
-	destIP := make(net.IP, len(network.IP))
-	copy(destIP, network.IP)
-	destIP[len(destIP)-1]++
-	if destIP.Equal(t.cfg.IP) {
-		destIP[len(destIP)-1] += 1
-	}
+	destIP := peerAddr(t.cfg.Net, t.cfg.IP)
 
 	cmd := exec.Command("ifconfig", t.cfg.Name, ip, destIP.String(), "up")
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -111,12 +168,61 @@ func (t *TUN) configureDarwin() error {
 	return nil
 }
 
+// configure6 adds tun.addr6 to the interface, if set. It is kept apart from
+// configure, which Assign repeats for every lease of tun.addr.
+func (t *TUN) configure6() error {
+	if t.cfg.IP6 == nil {
+		return nil
+	}
+	ones, _ := t.cfg.Net6.Mask.Size()
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("ip", "-6", "addr", "add", t.cfg.Addr6, "dev", t.cfg.Name)
+	case "darwin":
+		cmd = exec.Command("ifconfig", t.cfg.Name, "inet6", t.cfg.IP6.String(), "prefixlen", fmt.Sprintf("%d", ones))
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set IPv6 address: %v, output: %s", err, output)
+	}
+	// A utun device is point-to-point, so the on-link route for the
+	// prefix has to be added by hand.
+	if runtime.GOOS == "darwin" {
+		if err := t.AddRoute(t.cfg.Net6); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peerAddr returns the first address of n other than self, which macOS
+// needs as the destination of a point-to-point interface.
+func peerAddr(n *net.IPNet, self net.IP) net.IP {
+	first, _ := netip.AddrFromSlice(n.IP)
+	s, _ := netip.AddrFromSlice(self)
+	peer := first.Unmap().Next()
+	if peer == s.Unmap() {
+		peer = peer.Next()
+	}
+	return net.IP(peer.AsSlice())
+}
+
 // Read reads a packet from the TUN device.
 // Note: TUN intentionally does NOT implement the io.ReaderFrom interface to ensure
 // that io.CopyBuffer uses the provided 256KB buffer pool instead of allocating
 // small MTU-sized buffers repeatedly, which significantly improves throughput.
 func (t *TUN) Read(buf []byte) (int, error) {
-	return t.iface.Read(buf)
+	return t.read(t.iface, buf)
+}
+
+func (t *TUN) read(q io.Reader, buf []byte) (int, error) {
+	n, err := q.Read(buf)
+	if pkt := t.packet(buf[:max(n, 0)]); len(pkt) > 0 {
+		t.mirror(Outbound, pkt)
+	}
+	return n, err
 }
 
 // Write writes a packet to the TUN device.
@@ -124,12 +230,62 @@ func (t *TUN) Read(buf []byte) (int, error) {
 // that io.CopyBuffer uses the provided 256KB buffer pool instead of allocating
 // small MTU-sized buffers repeatedly, which significantly improves throughput.
 func (t *TUN) Write(buf []byte) (int, error) {
-	return t.iface.Write(buf)
+	return t.write(t.iface, buf)
 }
 
-// Close closes the TUN device
+func (t *TUN) write(q io.Writer, buf []byte) (int, error) {
+	if pkt := t.packet(buf); len(pkt) > 0 {
+		t.mirror(Inbound, pkt)
+	}
+	return q.Write(buf)
+}
+
+// Close closes the TUN device and rolls back every host change recorded in
+// the journal, restoring the routes and resolver state from before setup.
 func (t *TUN) Close() error {
-	return t.iface.Close()
+	err := t.iface.Close()
+	for _, q := range t.queues {
+		if q != t.iface {
+			q.Close()
+		}
+	}
+	if t.neigh != nil {
+		t.neigh.close()
+	}
+	t.journal.rollback()
+	return err
+}
+
+// nets returns the tunnel networks: tun.addr's, and tun.addr6's if set.
+func (t *TUN) nets() []*net.IPNet {
+	var nets []*net.IPNet
+	if t.cfg.Net != nil {
+		nets = append(nets, t.cfg.Net)
+	}
+	if t.cfg.Net6 != nil {
+		nets = append(nets, t.cfg.Net6)
+	}
+	return nets
+}
+
+// prefixes converts nets to netip prefixes, skipping nil entries.
+func prefixes(nets []*net.IPNet) []netip.Prefix {
+	var out []netip.Prefix
+	for _, n := range nets {
+		if n == nil {
+			continue
+		}
+		a, ok := netip.AddrFromSlice(n.IP)
+		if !ok {
+			continue
+		}
+		ones, bits := n.Mask.Size()
+		if a.Is4In6() && bits == 128 {
+			ones -= 96
+		}
+		out = append(out, netip.PrefixFrom(a.Unmap(), ones).Masked())
+	}
+	return out
 }
 
 // Name returns the interface name
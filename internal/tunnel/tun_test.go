@@ -3,6 +3,7 @@ package tunnel
 import (
 	"bytes"
 	"io"
+	"net"
 	"testing"
 )
 
@@ -119,3 +120,17 @@ func TestTUNBufferUsage(t *testing.T) {
 	t.Log("✓ io.CopyBuffer correctly uses provided buffer with Read/Write methods")
 	t.Logf("✓ Copied %d bytes using %d byte buffer", copied, len(buf))
 }
+
+func TestPeerAddr(t *testing.T) {
+	for _, tc := range []struct{ cidr, peer string }{
+		{"10.0.8.2/24", "10.0.8.1"},
+		{"10.0.8.1/24", "10.0.8.2"},
+		{"10.0.8.255/23", "10.0.8.1"},
+		{"fd00:8::1/64", "fd00:8::2"},
+	} {
+		ip, n, _ := net.ParseCIDR(tc.cidr)
+		if got := peerAddr(n, ip).String(); got != tc.peer {
+			t.Errorf("peerAddr(%s) = %s, want %s", tc.cidr, got, tc.peer)
+		}
+	}
+}